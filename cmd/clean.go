@@ -0,0 +1,91 @@
+package cmd
+
+import (
+    "fmt"
+    "os"
+    "time"
+
+    "github.com/cvega/gh-migrate-packages/pkg/filter"
+    "github.com/cvega/gh-migrate-packages/pkg/run"
+    "github.com/pterm/pterm"
+    "github.com/spf13/cobra"
+)
+
+var cleanCmd = &cobra.Command{
+    Use:   "clean",
+    Short: "Removes staging files left behind by interrupted or crashed runs",
+    Long:  "Finds the ghmp-* staging directories in the system temp directory whose run is no longer running and removes them. Directories from versions that didn't record their process are removed once they are older than --older-than. With --dir, also removes repacked NuGet directories and partial proxy downloads left under an export or proxy cache directory",
+    Args:  cobra.NoArgs,
+    RunE: func(cmd *cobra.Command, args []string) error {
+        cmd.SilenceUsage = true
+
+        olderThan, err := cmd.Flags().GetDuration("older-than")
+        if err != nil {
+            return err
+        }
+        dryRun, _ := cmd.Flags().GetBool("dry-run")
+        dirs, _ := cmd.Flags().GetStringArray("dir")
+
+        stale, err := run.Stale(olderThan)
+        if err != nil {
+            return err
+        }
+        for _, dir := range dirs {
+            leftovers, err := run.Leftovers(dir, olderThan)
+            if err != nil {
+                return err
+            }
+            stale = append(stale, leftovers...)
+        }
+        if len(stale) == 0 {
+            pterm.Success.Println("No stale staging files found")
+            return nil
+        }
+
+        table := pterm.TableData{
+            {"Path", "Kind", "Size", "Last modified"},
+        }
+        var total, freed int64
+        removed := 0
+        for _, s := range stale {
+            table = append(table, []string{s.Path, s.Kind, filter.FormatSize(s.Size), s.Modified.Format(time.RFC3339)})
+            total += s.Size
+            if dryRun {
+                continue
+            }
+            if err := os.RemoveAll(s.Path); err != nil {
+                pterm.Warning.Printf("Failed to remove %s: %v\n", s.Path, err)
+                continue
+            }
+            removed++
+            freed += s.Size
+        }
+        pterm.DefaultTable.WithHasHeader().WithData(table).Render()
+
+        if dryRun {
+            pterm.Info.Printf("Would remove %d stale staging paths, freeing %s\n", len(stale), filter.FormatSize(total))
+            return nil
+        }
+        pterm.Success.Printf("Removed %d stale staging paths, freeing %s\n", removed, filter.FormatSize(freed))
+        if removed < len(stale) {
+            return fmt.Errorf("failed to remove %d of %d stale staging paths", len(stale)-removed, len(stale))
+        }
+        return nil
+    },
+}
+
+func init() {
+    rootCmd.AddCommand(cleanCmd)
+
+    cleanCmd.Flags().Duration("older-than", 24*time.Hour, "Only remove staging files that don't name their run, and --dir leftovers, once unchanged this long")
+    cleanCmd.Flags().Bool("dry-run", false, "List what would be removed without removing it")
+    cleanCmd.Flags().StringArray("dir", nil, "Also clean up this export or proxy cache directory (repeatable)")
+    cleanCmd.MarkFlagDirname("dir")
+
+    cleanCmd.Example = examples(cleanCmd,
+        example{comment: "See what interrupted runs left behind", flags: []string{"dry-run", ""}},
+        example{comment: "Also clean an export directory an interrupted import used", flags: []string{
+            "dir", "./export",
+        }},
+    )
+}
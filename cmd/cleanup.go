@@ -0,0 +1,96 @@
+package cmd
+
+import (
+    "fmt"
+    "strings"
+
+    "github.com/cvega/gh-migrate-packages/pkg/sync"
+    "github.com/spf13/cobra"
+    "github.com/spf13/viper"
+)
+
+var cleanupCmd = &cobra.Command{
+    Use:   "cleanup",
+    Short: "Deletes packages or versions from the target organization to roll back a migration",
+    Long:  "Deletes packages or versions a failed or partial migration left in the target organization, so it can be retried from scratch. Source names are mapped to target names with the mapping file sync used. A package loses all of its versions by being deleted whole. With --state, only what a sync recorded as migrated is deleted, and the state file records the removals so the next run migrates those versions again",
+    RunE: func(cmd *cobra.Command, args []string) error {
+        cmd.SilenceUsage = true
+        return sync.CleanupTarget()
+    },
+}
+
+var cleanupSettings = []setting{
+    {flag: "target-organization", key: "TARGET_ORGANIZATION", required: true},
+    {flag: "target-token", key: "TARGET_TOKEN", required: true, redact: redactToken},
+    {flag: "package-type", key: "PACKAGE_TYPE", required: true, check: checkDeletableType},
+    {flag: "mapping-file", key: "MAPPING_FILE", check: checkFileExists},
+    {flag: "package", key: "CLEANUP_PACKAGES"},
+    {flag: "version", key: "CLEANUP_VERSIONS"},
+    {flag: "all", key: "CLEANUP_ALL"},
+    {flag: "state", key: "CLEANUP_STATE", check: checkFileExists},
+    {flag: "run-id", key: "CLEANUP_RUN_ID"},
+    {flag: "version-range", key: "VERSION_RANGE"},
+    {flag: "exclude-prereleases", key: "EXCLUDE_PRERELEASES"},
+    {flag: "only-releases", key: "ONLY_RELEASES"},
+    {flag: "dry-run", key: "DRY_RUN"},
+}
+
+// checkDeletableType accepts the types the REST deletion endpoints reach
+func checkDeletableType(value string) error {
+    for _, packageType := range sync.DeletableTypes {
+        if strings.EqualFold(value, packageType) {
+            return nil
+        }
+    }
+    return fmt.Errorf("only packages hosted by GitHub Packages can be deleted (%s), got %q", strings.Join(sync.DeletableTypes, ", "), value)
+}
+
+// checkCleanupScope needs something to delete, named one way only
+func checkCleanupScope() error {
+    packages := viper.GetString("CLEANUP_PACKAGES") != ""
+    state := viper.GetString("CLEANUP_STATE") != ""
+    if !packages && !state && !viper.GetBool("CLEANUP_ALL") {
+        return fmt.Errorf("choose what to delete with --package, --state, or --all")
+    }
+    if viper.GetString("CLEANUP_VERSIONS") != "" && !packages {
+        return fmt.Errorf("--version names versions of the --package packages and needs it set")
+    }
+    if viper.GetString("CLEANUP_RUN_ID") != "" && !state {
+        return fmt.Errorf("--run-id picks the entries of the --state file and needs it set")
+    }
+    return nil
+}
+
+func init() {
+    rootCmd.AddCommand(cleanupCmd)
+    configure(cleanupCmd, cleanupSettings, checkVersionFilter, checkCleanupScope)
+
+    cleanupCmd.Flags().StringP("target-organization", "t", "", "Target Organization to delete packages from")
+    cleanupCmd.Flags().StringP("target-token", "b", "", "Target Organization GitHub token, allowed to delete packages")
+    cleanupCmd.Flags().StringP("package-type", "p", "", "Package type to delete (container, npm, maven, nuget, rubygems)")
+    cleanupCmd.Flags().StringP("mapping-file", "m", "", "Mapping file the sync used, so --package and --version take source names")
+    cleanupCmd.Flags().StringArray("package", nil, "Source name of a package to delete, or to delete versions of (repeatable)")
+    cleanupCmd.Flags().StringArray("version", nil, "Source name of a version, or container tag, to delete from every --package (repeatable)")
+    cleanupCmd.Flags().Bool("all", false, "Delete every package of the type in the target organization")
+    cleanupCmd.Flags().String("state", "", "Delete what a sync recorded as migrated in this checkpoint state file, and record the removals in it")
+    cleanupCmd.Flags().String("run-id", "", "Only delete what the run with this ID migrated, from the --state file (optional)")
+    cleanupCmd.Flags().String("version-range", "", "Only delete versions of --package or --all packages in this semver range")
+    cleanupCmd.Flags().Bool("exclude-prereleases", false, "Keep pre-release versions of --package or --all packages")
+    cleanupCmd.Flags().Bool("only-releases", false, "Only delete release versions of --package or --all packages")
+    cleanupCmd.Flags().Bool("dry-run", false, "List what would be deleted without deleting anything")
+
+    completeFlags(cleanupCmd, map[string][]string{
+        "mapping-file": {"csv"},
+        "state":        {"jsonl"},
+    })
+    cleanupCmd.Example = examples(cleanupCmd,
+        example{comment: "See what rolling back a partial sync would delete", flags: []string{
+            "target-organization", "target-org", "target-token", "$TARGET_TOKEN", "package-type", "npm",
+            "state", "sync-state.jsonl", "dry-run", "",
+        }},
+        example{comment: "Delete two versions of a package renamed by the mapping file", flags: []string{
+            "target-organization", "target-org", "target-token", "$TARGET_TOKEN", "package-type", "maven",
+            "mapping-file", "mapping.csv", "package", "com.acme.core", "version", "2.0.0", "version", "2.0.1",
+        }},
+    )
+}
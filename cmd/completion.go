@@ -0,0 +1,60 @@
+package cmd
+
+import (
+    "os"
+
+    "github.com/spf13/cobra"
+)
+
+var completionCmd = &cobra.Command{
+    Use:   "completion [bash|zsh|fish|powershell]",
+    Short: "Generates a shell completion script",
+    Long: `Generates a completion script for commands, flags, package types, and file
+arguments. The script completes the migrate-packages command, so run the
+extension under that name, e.g. alias migrate-packages='gh migrate-packages'.
+
+  Bash:        source <(gh migrate-packages completion bash)
+  Zsh:         gh migrate-packages completion zsh > "${fpath[1]}/_migrate-packages"
+  Fish:        gh migrate-packages completion fish > ~/.config/fish/completions/migrate-packages.fish
+  PowerShell:  gh migrate-packages completion powershell | Out-String | Invoke-Expression`,
+    ValidArgs:             []string{"bash", "zsh", "fish", "powershell"},
+    Args:                  cobra.MatchAll(cobra.ExactArgs(1), cobra.OnlyValidArgs),
+    DisableFlagsInUseLine: true,
+    RunE: func(cmd *cobra.Command, args []string) error {
+        switch args[0] {
+        case "bash":
+            return rootCmd.GenBashCompletionV2(os.Stdout, true)
+        case "zsh":
+            return rootCmd.GenZshCompletion(os.Stdout)
+        case "fish":
+            return rootCmd.GenFishCompletion(os.Stdout, true)
+        default:
+            return rootCmd.GenPowerShellCompletionWithDesc(os.Stdout)
+        }
+    },
+}
+
+// packageTypes are offered when completing --package-type
+var packageTypes = []string{
+    "container", "npm", "maven", "nuget", "rubygems", "cargo", "go", "deb",
+    "rpm", "composer", "conda", "terraform", "swift", "cocoapods", "generic",
+}
+
+func completePackageTypes(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+    return packageTypes, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeFlags registers value completions for the flags cmd has: package
+// types for --package-type and matching files for file arguments
+func completeFlags(cmd *cobra.Command, files map[string][]string) {
+    if cmd.Flags().Lookup("package-type") != nil {
+        cmd.RegisterFlagCompletionFunc("package-type", completePackageTypes)
+    }
+    for flag, extensions := range files {
+        cmd.MarkFlagFilename(flag, extensions...)
+    }
+}
+
+func init() {
+    rootCmd.AddCommand(completionCmd)
+}
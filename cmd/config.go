@@ -0,0 +1,347 @@
+package cmd
+
+import (
+    "fmt"
+    "os"
+    "strings"
+
+    "github.com/cvega/gh-migrate-packages/pkg/api"
+    "github.com/cvega/gh-migrate-packages/pkg/extension"
+    "github.com/cvega/gh-migrate-packages/pkg/filter"
+    "github.com/cvega/gh-migrate-packages/pkg/package"
+    "github.com/cvega/gh-migrate-packages/pkg/run"
+    "github.com/pterm/pterm"
+    "github.com/spf13/cobra"
+    "github.com/spf13/viper"
+)
+
+// setting ties a command flag to the configuration key the packages read.
+// A flag given on the command line wins over its GHMP_ environment
+// variable, then the config file, then the flag's default
+type setting struct {
+    flag     string
+    key      string
+    required bool
+    check    func(value string) error  // validates a non-empty value
+    redact   func(value string) string // hides secrets in config show
+}
+
+// Settings and cross-setting checks of every configured command, by name
+var (
+    commandSettings = make(map[string][]setting)
+    commandChecks   = make(map[string][]func() error)
+)
+
+// configure binds cmd's flags to their keys and validates the effective
+// configuration before the command runs, so a misconfigured run fails
+// before doing any work
+func configure(cmd *cobra.Command, settings []setting, checks ...func() error) {
+    commandSettings[cmd.Name()] = settings
+    commandChecks[cmd.Name()] = checks
+
+    cmd.PreRunE = func(cmd *cobra.Command, args []string) error {
+        if err := bindSettings(cmd, settings); err != nil {
+            return err
+        }
+        run.SetCommand(cmd.CommandPath(), commandArgs(cmd, settings))
+        if err := validateSettings(settings, checks); err != nil {
+            cmd.SilenceUsage = true
+            return err
+        }
+        return nil
+    }
+}
+
+// bindSettings binds cmd's flags to viper. Repeatable flags are joined with
+// ';', the form the packages split them in, and only override the
+// environment when given
+func bindSettings(cmd *cobra.Command, settings []setting) error {
+    for _, s := range settings {
+        flag := cmd.Flags().Lookup(s.flag)
+        if flag == nil {
+            return fmt.Errorf("%s has no --%s flag", cmd.Name(), s.flag)
+        }
+
+        if flag.Value.Type() == "stringArray" {
+            if flag.Changed {
+                values, _ := cmd.Flags().GetStringArray(s.flag)
+                viper.Set(s.key, strings.Join(values, ";"))
+            }
+            continue
+        }
+
+        if err := viper.BindPFlag(s.key, flag); err != nil {
+            return fmt.Errorf("failed to bind --%s: %v", s.flag, err)
+        }
+    }
+    return nil
+}
+
+// commandArgs lists the flags given on cmd's command line, with secrets
+// replaced by their GHMP_ environment variable so the commands a run
+// prints can be shared
+func commandArgs(cmd *cobra.Command, settings []setting) []run.Arg {
+    var args []run.Arg
+    for _, name := range rootFlags {
+        if flag := cmd.Flags().Lookup(name); flag != nil && flag.Changed {
+            args = append(args, commandArg(name, flag.Value.Type(), flag.Value.String())...)
+        }
+    }
+    for _, s := range settings {
+        flag := cmd.Flags().Lookup(s.flag)
+        switch {
+        case flag == nil || !flag.Changed:
+        case s.redact != nil:
+            args = append(args, run.Arg{Flag: s.flag, Value: "$" + envName(s.key)})
+        case flag.Value.Type() == "stringArray":
+            values, _ := cmd.Flags().GetStringArray(s.flag)
+            for _, value := range values {
+                args = append(args, run.Arg{Flag: s.flag, Value: value})
+            }
+        default:
+            args = append(args, commandArg(s.flag, flag.Value.Type(), flag.Value.String())...)
+        }
+    }
+    return args
+}
+
+func commandArg(flag, kind, value string) []run.Arg {
+    if kind != "bool" {
+        return []run.Arg{{Flag: flag, Value: value}}
+    }
+    if value == "true" {
+        return []run.Arg{{Flag: flag, Bool: true}}
+    }
+    return []run.Arg{{Flag: flag + "=false", Bool: true}}
+}
+
+// validateSettings reports every problem with the effective configuration
+// at once rather than the first one a run would trip over
+func validateSettings(settings []setting, checks []func() error) error {
+    var problems []string
+    for _, s := range settings {
+        value := viper.GetString(s.key)
+        if value == "" {
+            if s.required {
+                problems = append(problems, fmt.Sprintf("--%s (or %s) is required", s.flag, envName(s.key)))
+            }
+            continue
+        }
+        if s.check != nil {
+            if err := s.check(value); err != nil {
+                problems = append(problems, fmt.Sprintf("--%s: %v", s.flag, err))
+            }
+        }
+    }
+
+    for _, check := range checks {
+        if err := check(); err != nil {
+            problems = append(problems, err.Error())
+        }
+    }
+
+    if len(problems) > 0 {
+        return fmt.Errorf("invalid configuration:\n  - %s", strings.Join(problems, "\n  - "))
+    }
+    return nil
+}
+
+func envName(key string) string {
+    return "GHMP_" + key
+}
+
+func checkSize(value string) error {
+    _, err := filter.ParseSize(value)
+    return err
+}
+
+func checkAge(value string) error {
+    _, err := filter.ParseAge(value)
+    return err
+}
+
+func checkRegistries(value string) error {
+    _, err := api.ParseRegistries(value)
+    return err
+}
+
+func checkRegistryTokens(value string) error {
+    _, err := api.ParseRegistryTokens(value)
+    return err
+}
+
+func checkSidecars(value string) error {
+    _, err := api.ParseSidecars(value)
+    return err
+}
+
+func checkHandlers(value string) error {
+    for _, spec := range strings.Split(value, ";") {
+        if _, err := extension.ParseSpec(spec); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+func checkFileExists(value string) error {
+    if _, err := os.Stat(value); err != nil {
+        return fmt.Errorf("can't read %s: %v", value, err)
+    }
+    return nil
+}
+
+func checkRepository(value string) error {
+    parts := strings.Split(value, "/")
+    if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+        return fmt.Errorf("expected owner/repo, got %q", value)
+    }
+    return nil
+}
+
+// checkPackageType accepts the built-in types and those of --handler
+func checkPackageType() error {
+    packageType := viper.GetString("PACKAGE_TYPE")
+    if packageType == "" {
+        return nil
+    }
+    if _, err := pkg.GetValidator(pkg.PackageType(packageType)); err == nil {
+        return nil
+    }
+    if handlers := viper.GetString("HANDLERS"); handlers != "" {
+        for _, spec := range strings.Split(handlers, ";") {
+            if h, err := extension.ParseSpec(spec); err == nil && h.Type == strings.ToLower(packageType) {
+                return nil
+            }
+        }
+    }
+    return fmt.Errorf("--package-type: unsupported package type %q", packageType)
+}
+
+// checkVersionFilter builds the version filter the run would use, which
+// covers the range, size limits, file filters and approvals file together
+func checkVersionFilter() error {
+    _, err := filter.FromConfig(viper.GetString("PACKAGE_TYPE"))
+    return err
+}
+
+// checkInteractive makes sure --interactive has a terminal to pick on
+func checkInteractive() error {
+    if !viper.GetBool("INTERACTIVE") {
+        return nil
+    }
+    if info, err := os.Stdin.Stat(); err != nil || info.Mode()&os.ModeCharDevice == 0 {
+        return fmt.Errorf("--interactive picks packages in a terminal and can't be used without one, e.g. in CI")
+    }
+    return nil
+}
+
+// checkOrphaned rejects leaving out orphaned packages while keeping only them
+func checkOrphaned() error {
+    if viper.GetBool("EXCLUDE_ORPHANED") && viper.GetBool("ONLY_ORPHANED") {
+        return fmt.Errorf("--exclude-orphaned and --only-orphaned select opposite packages and can't be combined")
+    }
+    return nil
+}
+
+func redactToken(value string) string {
+    if value == "" {
+        return ""
+    }
+    return "[redacted]"
+}
+
+// redactSourceTokens hides the tokens of [HOST/]ORG=TOKEN and TYPE=TOKEN
+// specs
+func redactSourceTokens(value string) string {
+    specs := strings.Split(value, ";")
+    for i, spec := range specs {
+        if j := strings.Index(spec, "="); j >= 0 {
+            specs[i] = spec[:j+1] + "[redacted]"
+        }
+    }
+    return strings.Join(specs, ";")
+}
+
+var configCmd = &cobra.Command{
+    Use:   "config",
+    Short: "Inspects the configuration commands run with",
+}
+
+var configShowCmd = &cobra.Command{
+    Use:   "show COMMAND [flags]",
+    Short: "Prints the resolved configuration of a command",
+    Long:  "Resolves a command's flags, GHMP_ environment variables, env and config files, and defaults the way the command would, then prints every setting with its source and validates them. Tokens are redacted",
+    Example: "  gh migrate-packages config show sync -s source-org -t target-org --max-transfer 500GiB",
+    Args:               cobra.MinimumNArgs(1),
+    DisableFlagParsing: true,
+    RunE: func(cmd *cobra.Command, args []string) error {
+        if args[0] == "-h" || args[0] == "--help" {
+            return cmd.Help()
+        }
+        cmd.SilenceUsage = true
+
+        target, _, err := rootCmd.Find(args[:1])
+        if err != nil {
+            return err
+        }
+        settings, ok := commandSettings[target.Name()]
+        if !ok || target == rootCmd {
+            return fmt.Errorf("%s has no configuration to show", args[0])
+        }
+
+        if err := target.ParseFlags(args[1:]); err != nil {
+            return err
+        }
+        if flag := target.Flags().Lookup("env-file"); flag != nil && flag.Changed {
+            if err := loadEnvFile(flag.Value.String()); err != nil {
+                return err
+            }
+        }
+        if flag := target.Flags().Lookup("config"); flag != nil && flag.Changed {
+            if err := loadConfigFile(flag.Value.String()); err != nil {
+                return err
+            }
+        }
+        if err := bindSettings(target, settings); err != nil {
+            return err
+        }
+
+        table := pterm.TableData{
+            {"Flag", "Environment", "Value", "Source"},
+        }
+        for _, s := range settings {
+            value := viper.GetString(s.key)
+            if s.redact != nil {
+                value = s.redact(value)
+            }
+
+            source := "default"
+            if flag := target.Flags().Lookup(s.flag); flag != nil && flag.Changed {
+                source = "flag"
+            } else if envFileKeys[envName(s.key)] {
+                source = "env file"
+            } else if _, ok := os.LookupEnv(envName(s.key)); ok {
+                source = "env"
+            } else if viper.InConfig(s.key) {
+                source = "config"
+            }
+            table = append(table, []string{"--" + s.flag, envName(s.key), value, source})
+        }
+        if file := viper.ConfigFileUsed(); file != "" {
+            pterm.Info.Printf("Config file: %s\n", file)
+        }
+        pterm.DefaultTable.WithHasHeader().WithData(table).Render()
+
+        if err := validateSettings(settings, commandChecks[target.Name()]); err != nil {
+            return err
+        }
+        pterm.Success.Println("Configuration is valid")
+        return nil
+    },
+}
+
+func init() {
+    rootCmd.AddCommand(configCmd)
+    configCmd.AddCommand(configShowCmd)
+}
@@ -0,0 +1,47 @@
+package cmd
+
+import (
+    "github.com/cvega/gh-migrate-packages/pkg/control"
+    "github.com/pterm/pterm"
+    "github.com/spf13/cobra"
+)
+
+var controlCmd = &cobra.Command{
+    Use:       "control [pause|resume|abort|status]",
+    Short:     "Controls a running sync through its control socket",
+    Long:      "Pauses, resumes, aborts, or reports the status of a running sync started with --control-socket",
+    Args:      cobra.MatchAll(cobra.ExactArgs(1), cobra.OnlyValidArgs),
+    ValidArgs: []string{"pause", "resume", "abort", "status"},
+    RunE: func(cmd *cobra.Command, args []string) error {
+        socket := cmd.Flag("socket").Value.String()
+
+        status, err := control.Send(socket, args[0])
+        if err != nil {
+            return err
+        }
+
+        pterm.Info.Printf("State: %s\n", status.State)
+        pterm.Info.Printf("Processed: %d/%d\n", status.Processed, status.Total)
+        if status.Current != "" {
+            pterm.Info.Printf("Current: %s\n", status.Current)
+        }
+
+        return nil
+    },
+}
+
+func init() {
+    rootCmd.AddCommand(controlCmd)
+
+    controlCmd.Flags().StringP("socket", "c", "", "Control socket path of the running sync")
+    controlCmd.MarkFlagRequired("socket")
+
+    controlCmd.Example = examples(controlCmd,
+        example{comment: "Pause a sync started with --control-socket /tmp/sync.sock", args: []string{"pause"}, flags: []string{
+            "socket", "/tmp/sync.sock",
+        }},
+        example{comment: "Show how far it got", args: []string{"status"}, flags: []string{
+            "socket", "/tmp/sync.sock",
+        }},
+    )
+}
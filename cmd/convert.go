@@ -0,0 +1,62 @@
+package cmd
+
+import (
+    "fmt"
+
+    "github.com/cvega/gh-migrate-packages/pkg/convert"
+    "github.com/spf13/cobra"
+)
+
+var convertCmd = &cobra.Command{
+    Use:   "convert",
+    Short: "Converts an export inventory between CSV, JSON, SQLite, and archive formats",
+    Long:  "Reads the packages and versions listing of an export in one format and writes it in another, so CSV exports from earlier versions can be used wherever another format is expected without exporting again. Formats are taken from the file extensions unless --from or --to is given: .json, .db/.sqlite, .tar.gz/.tgz, and anything else as the CSV file prefix. The sqlite format needs the sqlite3 command",
+    RunE: func(cmd *cobra.Command, args []string) error {
+        return convert.ConvertFromConfig()
+    },
+}
+
+var convertSettings = []setting{
+    {flag: "input", key: "INPUT_FILE", required: true},
+    {flag: "output", key: "OUTPUT_FILE", required: true},
+    {flag: "from", key: "FROM_FORMAT", check: checkConvertFormat},
+    {flag: "to", key: "TO_FORMAT", check: checkConvertFormat},
+    {flag: "download-path", key: "DOWNLOAD_PATH"},
+}
+
+// checkConvertFormat accepts the formats convert reads and writes
+func checkConvertFormat(value string) error {
+    for _, format := range convert.Formats {
+        if value == format {
+            return nil
+        }
+    }
+    return fmt.Errorf("unsupported format %q", value)
+}
+
+func init() {
+    rootCmd.AddCommand(convertCmd)
+    configure(convertCmd, convertSettings)
+
+    convertCmd.Flags().StringP("input", "i", "", "Inventory to read: a CSV file prefix or either CSV, a .json, .db, or .tar.gz file")
+    convertCmd.Flags().StringP("output", "o", "", "Inventory to write, named the same way as --input")
+    convertCmd.Flags().String("from", "", "Format of --input when its name doesn't tell: csv, json, sqlite, or archive (optional)")
+    convertCmd.Flags().String("to", "", "Format of --output when its name doesn't tell: csv, json, sqlite, or archive (optional)")
+    convertCmd.Flags().String("download-path", "", "Downloads directory packed into an archive written, or extracted from an archive read (optional)")
+
+    completeFlags(convertCmd, nil)
+    convertCmd.RegisterFlagCompletionFunc("from", cobra.FixedCompletions(convert.Formats, cobra.ShellCompDirectiveNoFileComp))
+    convertCmd.RegisterFlagCompletionFunc("to", cobra.FixedCompletions(convert.Formats, cobra.ShellCompDirectiveNoFileComp))
+    convertCmd.MarkFlagDirname("download-path")
+    convertCmd.Example = examples(convertCmd,
+        example{comment: "Turn an older CSV-only export into JSON", flags: []string{
+            "input", "source-org", "output", "source-org.json",
+        }},
+        example{comment: "Load it into SQLite for ad hoc queries", flags: []string{
+            "input", "source-org_packages.csv", "output", "source-org.db",
+        }},
+        example{comment: "Bundle the inventory with its downloads", flags: []string{
+            "input", "source-org", "output", "source-org.tar.gz", "download-path", "downloads",
+        }},
+    )
+}
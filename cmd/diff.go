@@ -0,0 +1,79 @@
+package cmd
+
+import (
+    "github.com/cvega/gh-migrate-packages/pkg/sync"
+    "github.com/spf13/cobra"
+)
+
+var diffCmd = &cobra.Command{
+    Use:   "diff",
+    Short: "Lists the versions the source has and the target lacks, and the other way around",
+    Long:  "Compares the package inventories of the source and target organizations by type. Each source version is looked for under the name a sync with the same mapping file and prefix flags would give it, so only what a sync would still migrate shows as missing. Versions only the target has are listed too. Nothing is changed in either organization",
+    Args:  cobra.NoArgs,
+    RunE: func(cmd *cobra.Command, args []string) error {
+        cmd.SilenceUsage = true
+        return sync.DiffOrganizations()
+    },
+}
+
+var diffSettings = []setting{
+    {flag: "source-organization", key: "SOURCE_ORGANIZATION", required: true},
+    {flag: "target-organization", key: "TARGET_ORGANIZATION", required: true},
+    {flag: "source-token", key: "SOURCE_TOKEN", required: true, redact: redactToken},
+    {flag: "target-token", key: "TARGET_TOKEN", required: true, redact: redactToken},
+    {flag: "mapping-file", key: "MAPPING_FILE", check: checkFileExists},
+    {flag: "source-hostname", key: "SOURCE_HOSTNAME"},
+    {flag: "package-type", key: "PACKAGE_TYPE"},
+    {flag: "source-registry-url", key: "SOURCE_REGISTRY_URLS", check: checkRegistries},
+    {flag: "source-registry-token", key: "SOURCE_REGISTRY_TOKENS", check: checkRegistryTokens, redact: redactSourceTokens},
+    {flag: "registry-url", key: "TARGET_REGISTRY_URLS", check: checkRegistries},
+    {flag: "registry-token", key: "TARGET_REGISTRY_TOKENS", check: checkRegistryTokens, redact: redactSourceTokens},
+    {flag: "normalize-names", key: "NORMALIZE_NAMES"},
+    {flag: "target-prefix", key: "TARGET_PREFIX"},
+    {flag: "npm-scope-suffix", key: "NPM_SCOPE_SUFFIX"},
+    {flag: "maven-group-prefix", key: "MAVEN_GROUP_PREFIX"},
+    {flag: "container-path-prefix", key: "CONTAINER_PATH_PREFIX"},
+    {flag: "output", key: "OUTPUT_FILE"},
+    {flag: "delta-snapshot", key: "DELTA_SNAPSHOT"},
+}
+
+func init() {
+    rootCmd.AddCommand(diffCmd)
+    configure(diffCmd, diffSettings, checkPackageType)
+
+    diffCmd.Flags().StringP("source-organization", "s", "", "Source Organization packages would be migrated from")
+    diffCmd.Flags().StringP("target-organization", "t", "", "Target Organization packages would be migrated to")
+    diffCmd.Flags().StringP("source-token", "a", "", "Source Organization GitHub token")
+    diffCmd.Flags().StringP("target-token", "b", "", "Target Organization GitHub token")
+    diffCmd.Flags().StringP("mapping-file", "m", "", "Mapping file path for package name and container name:tag mappings, as given to sync")
+    diffCmd.Flags().StringP("source-hostname", "u", "", "GitHub Enterprise source hostname url (optional)")
+    diffCmd.Flags().StringP("package-type", "p", "", "Package type to compare, every type hosted by GitHub when empty (optional)")
+    diffCmd.Flags().StringArray("source-registry-url", nil, "Source registry for types not hosted by GitHub as type=url (repeatable)")
+    diffCmd.Flags().StringArray("source-registry-token", nil, "Token for a source registry of --source-registry-url as type=token; the GitHub token is never sent to it (repeatable)")
+    diffCmd.Flags().StringArray("registry-url", nil, "Target registry for types not hosted by GitHub as type=url (repeatable)")
+    diffCmd.Flags().StringArray("registry-token", nil, "Token for a target registry of --registry-url as type=token; the GitHub token is never sent to it (repeatable)")
+    diffCmd.Flags().Bool("normalize-names", false, "Look for target names the way sync --normalize-names rewrites them")
+    diffCmd.Flags().String("target-prefix", "", "Prefix sync adds to every target package name not renamed by the mapping file (optional)")
+    diffCmd.Flags().String("npm-scope-suffix", "", "Suffix sync adds to the scope of npm packages instead of --target-prefix (optional)")
+    diffCmd.Flags().String("maven-group-prefix", "", "Prefix sync adds to the groupId of Maven packages instead of --target-prefix (optional)")
+    diffCmd.Flags().String("container-path-prefix", "", "Path prefix sync adds to container images instead of --target-prefix (optional)")
+    diffCmd.Flags().StringP("output", "o", "", "CSV path listing every version missing in the target or only in it (optional)")
+    diffCmd.Flags().String("delta-snapshot", "", "Snapshot path receiving the versions missing in the target, for sync --snapshot (optional)")
+
+    completeFlags(diffCmd, map[string][]string{
+        "mapping-file":   {"csv"},
+        "output":         {"csv"},
+        "delta-snapshot": {"json"},
+    })
+    diffCmd.Example = examples(diffCmd,
+        example{comment: "Compare every package type of two organizations", flags: []string{
+            "source-organization", "source-org", "target-organization", "target-org",
+            "source-token", "$SOURCE_TOKEN", "target-token", "$TARGET_TOKEN",
+        }},
+        example{comment: "List the renamed npm versions still to migrate, and snapshot them for sync", flags: []string{
+            "source-organization", "source-org", "target-organization", "target-org",
+            "source-token", "$SOURCE_TOKEN", "target-token", "$TARGET_TOKEN", "package-type", "npm",
+            "mapping-file", "mappings.csv", "output", "org-diff.csv", "delta-snapshot", "missing.json",
+        }},
+    )
+}
@@ -0,0 +1,41 @@
+package cmd
+
+import (
+    "github.com/cvega/gh-migrate-packages/pkg/diff"
+    "github.com/spf13/cobra"
+)
+
+var diffExportsCmd = &cobra.Command{
+    Use:   "diff-exports OLD NEW",
+    Short: "Lists the versions added, removed, or changed between two exports",
+    Long:  "Compares two exports of the same organizations taken at different times, either download directories with a metadata.json per version or snapshots written by export --snapshot. Versions are changed when republished under a new ID, updated, or when their files differ. The added and changed versions can be written as a snapshot for the final delta sync",
+    Args:  cobra.ExactArgs(2),
+    RunE: func(cmd *cobra.Command, args []string) error {
+        cmd.SilenceUsage = true
+        return diff.DiffFromConfig(args[0], args[1])
+    },
+}
+
+var diffExportsSettings = []setting{
+    {flag: "output", key: "OUTPUT_FILE"},
+    {flag: "delta-snapshot", key: "DELTA_SNAPSHOT"},
+}
+
+func init() {
+    rootCmd.AddCommand(diffExportsCmd)
+    configure(diffExportsCmd, diffExportsSettings)
+
+    diffExportsCmd.Flags().StringP("output", "o", "export-diff.csv", "CSV path listing every added, removed, and changed version (empty to disable)")
+    diffExportsCmd.Flags().String("delta-snapshot", "", "Snapshot path receiving the added and changed versions, for sync --snapshot (optional)")
+
+    completeFlags(diffExportsCmd, map[string][]string{
+        "output":         {"csv"},
+        "delta-snapshot": {"json"},
+    })
+    diffExportsCmd.Example = examples(diffExportsCmd,
+        example{comment: "Compare last month's export with today's", args: []string{"exports/2026-09/", "exports/2026-10/"}},
+        example{comment: "Plan the final delta sync", args: []string{"plan-old.json", "plan-new.json"}, flags: []string{
+            "delta-snapshot", "delta.json",
+        }},
+    )
+}
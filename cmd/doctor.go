@@ -0,0 +1,72 @@
+package cmd
+
+import (
+    "fmt"
+
+    "github.com/cvega/gh-migrate-packages/pkg/doctor"
+    "github.com/cvega/gh-migrate-packages/pkg/package"
+    "github.com/spf13/cobra"
+)
+
+var doctorCmd = &cobra.Command{
+    Use:   "doctor",
+    Short: "Checks tokens, scopes, organizations, and registry endpoints before a migration",
+    Long:  "Checks that the source token has read:packages and the target token has write:packages, that both organizations exist and the tokens are authorized for their SAML SSO, and that every registry endpoint answers through the proxy set by HTTPS_PROXY. Each check is listed with what to fix, and the command fails when any does, so misconfigured tokens surface before a migration rather than as upload failures halfway through it. Nothing is changed in either organization",
+    Args:  cobra.NoArgs,
+    RunE: func(cmd *cobra.Command, args []string) error {
+        cmd.SilenceUsage = true
+        return doctor.RunFromConfig()
+    },
+}
+
+var doctorSettings = []setting{
+    {flag: "source-organization", key: "SOURCE_ORGANIZATION", required: true},
+    {flag: "target-organization", key: "TARGET_ORGANIZATION", required: true},
+    {flag: "source-token", key: "SOURCE_TOKEN", required: true, redact: redactToken},
+    {flag: "target-token", key: "TARGET_TOKEN", required: true, redact: redactToken},
+    {flag: "source-hostname", key: "SOURCE_HOSTNAME"},
+    {flag: "package-type", key: "PACKAGE_TYPE", check: checkHostedType},
+    {flag: "source-registry-url", key: "SOURCE_REGISTRY_URLS", check: checkRegistries},
+    {flag: "source-registry-token", key: "SOURCE_REGISTRY_TOKENS", check: checkRegistryTokens, redact: redactSourceTokens},
+    {flag: "registry-url", key: "TARGET_REGISTRY_URLS", check: checkRegistries},
+    {flag: "registry-token", key: "TARGET_REGISTRY_TOKENS", check: checkRegistryTokens, redact: redactSourceTokens},
+}
+
+// checkHostedType accepts the types GitHub Packages hosts, whose registries
+// doctor knows how to reach
+func checkHostedType(value string) error {
+    for _, packageType := range pkg.HostedTypes {
+        if value == string(packageType) {
+            return nil
+        }
+    }
+    return fmt.Errorf("%q isn't hosted by GitHub Packages, configure its registry with --registry-url instead", value)
+}
+
+func init() {
+    rootCmd.AddCommand(doctorCmd)
+    configure(doctorCmd, doctorSettings)
+
+    doctorCmd.Flags().StringP("source-organization", "s", "", "Source Organization packages will be migrated from")
+    doctorCmd.Flags().StringP("target-organization", "t", "", "Target Organization packages will be migrated to")
+    doctorCmd.Flags().StringP("source-token", "a", "", "Source Organization GitHub token, with read:packages")
+    doctorCmd.Flags().StringP("target-token", "b", "", "Target Organization GitHub token, with write:packages")
+    doctorCmd.Flags().StringP("source-hostname", "u", "", "GitHub Enterprise source hostname url (optional)")
+    doctorCmd.Flags().StringP("package-type", "p", "", "Only check the registry of this type (default: every type GitHub Packages hosts)")
+    doctorCmd.Flags().StringArray("source-registry-url", nil, "Source registry for types not hosted by GitHub as type=url, to check it answers (repeatable)")
+    doctorCmd.Flags().StringArray("source-registry-token", nil, "Token for a source registry of --source-registry-url as type=token; the GitHub token is never sent to it (repeatable)")
+    doctorCmd.Flags().StringArray("registry-url", nil, "Target registry for types not hosted by GitHub as type=url, to check it answers (repeatable)")
+    doctorCmd.Flags().StringArray("registry-token", nil, "Token for a target registry of --registry-url as type=token; the GitHub token is never sent to it (repeatable)")
+
+    doctorCmd.Example = examples(doctorCmd,
+        example{comment: "Check everything before migrating between two organizations", flags: []string{
+            "source-organization", "source-org", "target-organization", "target-org",
+            "source-token", "$SOURCE_TOKEN", "target-token", "$TARGET_TOKEN",
+        }},
+        example{comment: "Check a GitHub Enterprise source and an external Cargo registry", flags: []string{
+            "source-organization", "source-org", "target-organization", "target-org",
+            "source-token", "$SOURCE_TOKEN", "target-token", "$TARGET_TOKEN",
+            "source-hostname", "github.example.com", "registry-url", "cargo=https://crates.example.com",
+        }},
+    )
+}
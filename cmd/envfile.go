@@ -0,0 +1,84 @@
+package cmd
+
+import (
+    "bufio"
+    "fmt"
+    "os"
+    "runtime"
+    "strings"
+
+    "github.com/pterm/pterm"
+)
+
+// defaultEnvFile is read from the working directory unless --env-file is given
+const defaultEnvFile = ".ghmp.env"
+
+// envFileKeys are the variables set from an env file, so config show can
+// tell them apart from the shell's
+var envFileKeys = make(map[string]bool)
+
+// loadEnvFile sets KEY=VALUE lines of path, or of defaultEnvFile when path
+// is empty and that file exists, as environment variables. Variables
+// already set in the shell win, so a one-off override doesn't need the
+// file edited
+func loadEnvFile(path string) error {
+    if path == "" {
+        if _, err := os.Stat(defaultEnvFile); err != nil {
+            return nil
+        }
+        path = defaultEnvFile
+    }
+
+    info, err := os.Stat(path)
+    if err != nil {
+        return fmt.Errorf("failed to read env file %s: %v", path, err)
+    }
+    // Windows has no permission bits to check
+    if runtime.GOOS != "windows" && info.Mode().Perm()&0o004 != 0 {
+        pterm.Warning.Printf("%s is readable by every user on this machine, restrict it with: chmod 600 %s\n", path, path)
+    }
+
+    file, err := os.Open(path)
+    if err != nil {
+        return fmt.Errorf("failed to read env file %s: %v", path, err)
+    }
+    defer file.Close()
+
+    scanner := bufio.NewScanner(file)
+    for n := 1; scanner.Scan(); n++ {
+        line := strings.TrimSpace(scanner.Text())
+        if line == "" || strings.HasPrefix(line, "#") {
+            continue
+        }
+        line = strings.TrimPrefix(line, "export ")
+
+        key, value, ok := strings.Cut(line, "=")
+        key = strings.TrimSpace(key)
+        if !ok || key == "" {
+            return fmt.Errorf("%s:%d: expected KEY=VALUE", path, n)
+        }
+        value = unquote(strings.TrimSpace(value))
+
+        if _, set := os.LookupEnv(key); set && !envFileKeys[key] {
+            continue
+        }
+        if err := os.Setenv(key, value); err != nil {
+            return fmt.Errorf("%s:%d: failed to set %s: %v", path, n, key, err)
+        }
+        envFileKeys[key] = true
+    }
+    if err := scanner.Err(); err != nil {
+        return fmt.Errorf("failed to read env file %s: %v", path, err)
+    }
+    return nil
+}
+
+// unquote strips one pair of matching quotes around value
+func unquote(value string) string {
+    if len(value) >= 2 {
+        if q := value[0]; (q == '"' || q == '\'') && value[len(value)-1] == q {
+            return value[1 : len(value)-1]
+        }
+    }
+    return value
+}
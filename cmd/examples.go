@@ -0,0 +1,51 @@
+package cmd
+
+import (
+    "fmt"
+    "strings"
+
+    "github.com/spf13/cobra"
+)
+
+// example is one documented invocation of a command
+type example struct {
+    comment string
+    args    []string
+    flags   []string // flag names each followed by its value, "" for booleans
+}
+
+// examples renders cmd's Example section from its real flag set, using the
+// shorthand where a flag has one. A flag cmd doesn't define panics, so the
+// help can't drift from the flags it documents
+func examples(cmd *cobra.Command, list ...example) string {
+    var b strings.Builder
+    for i, e := range list {
+        if i > 0 {
+            b.WriteString("\n\n")
+        }
+        fmt.Fprintf(&b, "  # %s\n  gh %s", e.comment, cmd.CommandPath())
+        for _, arg := range e.args {
+            fmt.Fprintf(&b, " %s", arg)
+        }
+
+        for j := 0; j+1 < len(e.flags); j += 2 {
+            flag := cmd.Flags().Lookup(e.flags[j])
+            if flag == nil {
+                panic(fmt.Sprintf("example for %s uses unknown flag --%s", cmd.Name(), e.flags[j]))
+            }
+
+            if flag.Shorthand != "" {
+                fmt.Fprintf(&b, " -%s", flag.Shorthand)
+            } else {
+                fmt.Fprintf(&b, " --%s", flag.Name)
+            }
+            if value := e.flags[j+1]; value != "" {
+                if strings.ContainsAny(value, " <>*!|()[]\"") {
+                    value = "'" + value + "'"
+                }
+                fmt.Fprintf(&b, " %s", value)
+            }
+        }
+    }
+    return b.String()
+}
@@ -1,7 +1,8 @@
 package cmd
 
 import (
-    "os"
+    "time"
+
     "github.com/cvega/gh-migrate-packages/pkg/export"
     "github.com/spf13/cobra"
     "github.com/spf13/viper"
@@ -9,47 +10,116 @@ import (
 
 var exportCmd = &cobra.Command{
     Use:   "export",
-    Short: "Creates CSV files of packages, versions, and their metadata in an organization",
-    Long:  "Creates CSV files of packages, versions, and their metadata in an organization",
+    Short: "Creates CSV, JSON, or SQLite files of packages, versions, and their metadata in an organization",
+    Long:  "Creates CSV files of packages, versions, and their metadata in an organization, or with --format json a single JSON document and with --format sqlite a database of packages, their versions, and the versions' files, and downloads every version",
     Run: func(cmd *cobra.Command, args []string) {
-        organization := cmd.Flag("organization").Value.String()
-        token := cmd.Flag("token").Value.String()
-        filePrefix := cmd.Flag("file-prefix").Value.String()
-        ghHostname := cmd.Flag("hostname").Value.String()
-        packageType := cmd.Flag("package-type").Value.String()
-
-        if filePrefix == "" {
-            filePrefix = organization
-        }
-
-        // Set ENV variables
-        os.Setenv("GHMP_SOURCE_ORGANIZATION", organization)
-        os.Setenv("GHMP_SOURCE_TOKEN", token)
-        os.Setenv("GHMP_OUTPUT_FILE", filePrefix)
-        os.Setenv("GHMP_SOURCE_HOSTNAME", ghHostname)
-        os.Setenv("GHMP_PACKAGE_TYPE", packageType)
-
-        // Bind ENV variables in Viper
-        viper.BindEnv("SOURCE_ORGANIZATION")
-        viper.BindEnv("SOURCE_TOKEN")
-        viper.BindEnv("OUTPUT_FILE")
-        viper.BindEnv("SOURCE_HOSTNAME")
-        viper.BindEnv("PACKAGE_TYPE")
-
         export.CreateCSVs()
     },
 }
 
+var exportSettings = []setting{
+    {flag: "organization", key: "SOURCE_ORGANIZATION", required: true},
+    {flag: "token", key: "SOURCE_TOKEN", required: true, redact: redactToken},
+    {flag: "tokens", key: "SOURCE_TOKENS", redact: redactToken},
+    {flag: "file-prefix", key: "OUTPUT_FILE"},
+    {flag: "format", key: "EXPORT_FORMAT", check: checkExportFormat},
+    {flag: "archive", key: "EXPORT_ARCHIVE", check: checkExportArchive},
+    {flag: "hostname", key: "SOURCE_HOSTNAME"},
+    {flag: "package-type", key: "PACKAGE_TYPE"},
+    {flag: "handler", key: "HANDLERS", check: checkHandlers},
+    {flag: "source-registry-url", key: "SOURCE_REGISTRY_URLS", check: checkRegistries},
+    {flag: "source-registry-token", key: "SOURCE_REGISTRY_TOKENS", check: checkRegistryTokens, redact: redactSourceTokens},
+    {flag: "version-range", key: "VERSION_RANGE"},
+    {flag: "publisher-report", key: "PUBLISHER_REPORT"},
+    {flag: "exclude-prereleases", key: "EXCLUDE_PRERELEASES"},
+    {flag: "only-releases", key: "ONLY_RELEASES"},
+    {flag: "exclude-orphaned", key: "EXCLUDE_ORPHANED"},
+    {flag: "only-orphaned", key: "ONLY_ORPHANED"},
+    {flag: "min-version-size", key: "MIN_VERSION_SIZE"},
+    {flag: "max-version-size", key: "MAX_VERSION_SIZE"},
+    {flag: "file-filter", key: "FILE_FILTERS"},
+    {flag: "excluded-files-report", key: "EXCLUDED_FILES_REPORT"},
+    {flag: "time-limit", key: "TIME_LIMIT"},
+    {flag: "merge-source", key: "MERGE_SOURCES", redact: redactSourceTokens},
+    {flag: "restore-deleted", key: "RESTORE_DELETED"},
+    {flag: "snapshot", key: "SNAPSHOT"},
+    {flag: "download-report", key: "DOWNLOAD_REPORT"},
+    {flag: "report-interval", key: "REPORT_INTERVAL"},
+}
+
+// checkMergeSources parses --merge-source the way the export will
+func checkMergeSources() error {
+    _, err := export.ParseSources(viper.GetString("MERGE_SOURCES"), viper.GetString("SOURCE_TOKEN"))
+    return err
+}
+
+// checkExportFormat parses --format the way the export will
+func checkExportFormat(value string) error {
+    _, err := export.ParseFormats(value)
+    return err
+}
+
+// checkExportArchive accepts the archive names export can compress
+func checkExportArchive(value string) error {
+    _, err := export.ArchiveCompression(value)
+    return err
+}
+
 func init() {
     rootCmd.AddCommand(exportCmd)
+    configure(exportCmd, exportSettings, checkPackageType, checkVersionFilter, checkOrphaned, checkMergeSources)
 
     exportCmd.Flags().StringP("organization", "o", "", "Organization to export packages from")
-    exportCmd.MarkFlagRequired("organization")
-
     exportCmd.Flags().StringP("token", "t", "", "GitHub token")
-    exportCmd.MarkFlagRequired("token")
-
+    exportCmd.Flags().String("tokens", "", "More tokens for --organization, comma-separated, to rotate with --token (optional)")
     exportCmd.Flags().StringP("file-prefix", "f", "", "Output filenames prefix")
+    exportCmd.Flags().String("format", export.FormatCSV, "Listing formats, comma-separated: csv, json for one PREFIX_export.json of packages, versions, and files, sqlite for PREFIX_export.db tables (needs the sqlite3 command), or both for csv,json")
+    exportCmd.Flags().String("archive", "", "Pack the listing, downloads, and a manifest with checksums into one .tar.zst (needs the zstd command), .tar.gz, or .tar file (optional)")
     exportCmd.Flags().StringP("hostname", "u", "", "GitHub Enterprise hostname url (optional)")
-    exportCmd.Flags().StringP("package-type", "p", "", "Package type to export (container, npm, maven, nuget, rubygems)")
+    exportCmd.Flags().StringP("package-type", "p", "", "Package type to export (container, npm, maven, nuget, rubygems, cargo, go, deb, rpm, composer, conda, terraform, swift, cocoapods, generic)")
+    exportCmd.Flags().StringArray("source-registry-url", nil, "Registry for types not hosted by GitHub as type=url, e.g. cargo=https://crates.example.com (repeatable)")
+    exportCmd.Flags().StringArray("source-registry-token", nil, "Token for a source registry of --source-registry-url as type=token; the GitHub token is never sent to it (repeatable)")
+    exportCmd.Flags().String("version-range", "", "Only export versions in this range, e.g. \">=2.0.0\", \"[1.0,2.0)\", or tag globs \"v1.*\" for containers (optional)")
+    exportCmd.Flags().Bool("exclude-prereleases", false, "Skip prerelease versions such as -beta, -rc, and Maven SNAPSHOTs")
+    exportCmd.Flags().Bool("only-releases", false, "Only export plain release versions, skipping prereleases, build metadata, and non-version tags like latest")
+    exportCmd.Flags().Bool("exclude-orphaned", false, "Leave out packages with no linked repository; they are still listed in an \"Orphaned packages\" section")
+    exportCmd.Flags().Bool("only-orphaned", false, "Only export packages with no linked repository, e.g. to settle their ownership first")
+    exportCmd.Flags().String("min-version-size", "", "Skip versions smaller than this total size, e.g. 1KB (optional)")
+    exportCmd.Flags().StringArray("file-filter", nil, "Glob selecting files to export within each version; prefix with ! to exclude, e.g. '!*-javadoc.jar' (repeatable)")
+    exportCmd.Flags().String("excluded-files-report", "excluded-files.csv", "CSV path listing the files left out by --file-filter")
+    exportCmd.Flags().String("max-version-size", "", "Skip versions larger than this total size, e.g. 2GiB (optional)")
+    exportCmd.Flags().String("publisher-report", "", "CSV path mapping each version to the login that published it, from the org audit log (optional)")
+    exportCmd.Flags().StringArray("merge-source", nil, "Additional organization to merge into the inventory as [HOSTNAME/]ORG[=TOKEN], using --token when no token is given (repeatable)")
+    exportCmd.Flags().Bool("restore-deleted", false, "Restore source versions deleted within the last 30 days before exporting; needs a token allowed to restore packages")
+    exportCmd.Flags().String("snapshot", "", "JSON path recording every listed version, so sync --snapshot migrates exactly this plan (optional)")
+    exportCmd.Flags().String("download-report", "download-report.csv", "CSV path listing every version's download outcome, rewritten while the export runs (empty to disable)")
+    exportCmd.Flags().Duration("report-interval", 5*time.Minute, "How often the download report is rewritten with the results so far (0 to only write it at the end)")
+    exportCmd.Flags().Duration("time-limit", 0, "Stop starting new downloads after this long, e.g. 6h; the next run resumes where this one stopped (optional)")
+    exportCmd.Flags().StringArray("handler", nil, "Custom package type handler as type=/path/to/executable (repeatable)")
+
+    completeFlags(exportCmd, map[string][]string{
+        "archive": {"zst", "tzst", "gz", "tgz", "tar"},
+    })
+    exportCmd.RegisterFlagCompletionFunc("format", cobra.FixedCompletions(export.Formats, cobra.ShellCompDirectiveNoFileComp))
+    exportCmd.Example = examples(exportCmd,
+        example{comment: "Inventory and download every container image", flags: []string{
+            "organization", "source-org", "token", "$SOURCE_TOKEN", "package-type", "container",
+        }},
+        example{comment: "Merge a GitHub Enterprise Server organization into one inventory", flags: []string{
+            "organization", "acme", "token", "$SOURCE_TOKEN", "package-type", "npm",
+            "merge-source", "ghes.example.com/acme-legacy=$GHES_TOKEN", "file-prefix", "inventory",
+        }},
+        example{comment: "Write the listing as JSON as well as CSV, for tooling", flags: []string{
+            "organization", "source-org", "token", "$SOURCE_TOKEN", "format", "both",
+        }},
+        example{comment: "Write the listing to an SQLite database to query", flags: []string{
+            "organization", "source-org", "token", "$SOURCE_TOKEN", "format", "sqlite",
+        }},
+        example{comment: "Export into one archive to carry to another network", flags: []string{
+            "organization", "source-org", "token", "$SOURCE_TOKEN", "archive", "source-org.tar.zst",
+        }},
+        example{comment: "Export for at most 6 hours, then run again to continue", flags: []string{
+            "organization", "source-org", "token", "$SOURCE_TOKEN", "package-type", "maven", "time-limit", "6h",
+        }},
+    )
 }
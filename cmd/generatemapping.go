@@ -0,0 +1,66 @@
+package cmd
+
+import (
+    "github.com/cvega/gh-migrate-packages/pkg/sync"
+    "github.com/spf13/cobra"
+)
+
+var generateMappingCmd = &cobra.Command{
+    Use:   "generate-mapping",
+    Short: "Writes a mapping file with a row for every source package to review and edit",
+    Long:  "Lists the source organization's packages and writes a mapping file for sync -m with a row for each: the source name, a proposed target name, the type, the visibility, and the linked repository. Target names are the source names, rewritten by --replace-prefix, --lowercase, and --normalize-names when given. Edit the rows before the migration; nothing is changed in the organization",
+    Args:  cobra.NoArgs,
+    RunE: func(cmd *cobra.Command, args []string) error {
+        cmd.SilenceUsage = true
+        return sync.GenerateMapping()
+    },
+}
+
+var generateMappingSettings = []setting{
+    {flag: "source-organization", key: "SOURCE_ORGANIZATION", required: true},
+    {flag: "source-token", key: "SOURCE_TOKEN", required: true, redact: redactToken},
+    {flag: "source-hostname", key: "SOURCE_HOSTNAME"},
+    {flag: "package-type", key: "PACKAGE_TYPE"},
+    {flag: "source-registry-url", key: "SOURCE_REGISTRY_URLS", check: checkRegistries},
+    {flag: "source-registry-token", key: "SOURCE_REGISTRY_TOKENS", check: checkRegistryTokens, redact: redactSourceTokens},
+    {flag: "replace-prefix", key: "REPLACE_PREFIXES", check: checkPrefixReplacements},
+    {flag: "lowercase", key: "LOWERCASE_NAMES"},
+    {flag: "normalize-names", key: "NORMALIZE_NAMES"},
+    {flag: "output", key: "OUTPUT_FILE"},
+    {flag: "force", key: "FORCE"},
+}
+
+func init() {
+    rootCmd.AddCommand(generateMappingCmd)
+    configure(generateMappingCmd, generateMappingSettings, checkPackageType)
+
+    generateMappingCmd.Flags().StringP("source-organization", "s", "", "Source Organization whose packages are listed")
+    generateMappingCmd.Flags().StringP("source-token", "a", "", "Source Organization GitHub token")
+    generateMappingCmd.Flags().StringP("source-hostname", "u", "", "GitHub Enterprise source hostname url (optional)")
+    generateMappingCmd.Flags().StringP("package-type", "p", "", "Only list packages of this type (default: every type GitHub Packages hosts)")
+    generateMappingCmd.Flags().StringArray("source-registry-url", nil, "Source registry for types not hosted by GitHub as type=url (repeatable)")
+    generateMappingCmd.Flags().StringArray("source-registry-token", nil, "Token for a source registry of --source-registry-url as type=token; the GitHub token is never sent to it (repeatable)")
+    generateMappingCmd.Flags().StringArray("replace-prefix", nil, "Replace the leading part of target names as from=to, e.g. @acme-old/=@acme/ or com.old.=com.new.; the first match applies (repeatable)")
+    generateMappingCmd.Flags().Bool("lowercase", false, "Lowercase target names")
+    generateMappingCmd.Flags().Bool("normalize-names", false, "Rewrite target names the target registry would reject, as sync --normalize-names does")
+    generateMappingCmd.Flags().StringP("output", "o", "mappings.csv", "Path the mapping file is written to")
+    generateMappingCmd.Flags().Bool("force", false, "Replace the mapping file if it exists")
+
+    completeFlags(generateMappingCmd, map[string][]string{
+        "output": {"csv"},
+    })
+    generateMappingCmd.Example = examples(generateMappingCmd,
+        example{comment: "Write a mapping file keeping every name, to edit by hand", flags: []string{
+            "source-organization", "source-org", "source-token", "$SOURCE_TOKEN",
+        }},
+        example{comment: "Propose lowercase npm names in a new scope", flags: []string{
+            "source-organization", "source-org", "source-token", "$SOURCE_TOKEN", "package-type", "npm",
+            "replace-prefix", "@acme-old/=@acme/", "lowercase", "", "output", "npm-mappings.csv",
+        }},
+    )
+}
+
+func checkPrefixReplacements(value string) error {
+    _, err := sync.ParsePrefixReplacements(value)
+    return err
+}
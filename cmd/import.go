@@ -0,0 +1,65 @@
+package cmd
+
+import (
+    "github.com/cvega/gh-migrate-packages/pkg/importer"
+    "github.com/spf13/cobra"
+)
+
+var importCmd = &cobra.Command{
+    Use:   "import",
+    Short: "Uploads the packages an earlier export downloaded to a target organization",
+    Long:  "Walks the download directory written by export, reads each version's metadata.json, and uploads its files to the target organization. Directories without a metadata.json, as other tools write them, have their package type and versions detected from their files. Export and import can run on different networks, for air-gapped migrations such as GHES to GitHub.com. Versions a previous import finished are skipped, so a failed import can simply be run again",
+    RunE: func(cmd *cobra.Command, args []string) error {
+        cmd.SilenceUsage = true
+        return importer.ImportFromConfig()
+    },
+}
+
+var importSettings = []setting{
+    {flag: "source-dir", key: "SOURCE_DIR", check: checkFileExists},
+    {flag: "target-organization", key: "TARGET_ORGANIZATION", required: true},
+    {flag: "target-token", key: "TARGET_TOKEN", required: true, redact: redactToken},
+    {flag: "target-tokens", key: "TARGET_TOKENS", redact: redactToken},
+    {flag: "package-type", key: "PACKAGE_TYPE"},
+    {flag: "registry-url", key: "TARGET_REGISTRY_URLS", check: checkRegistries},
+    {flag: "registry-token", key: "TARGET_REGISTRY_TOKENS", check: checkRegistryTokens, redact: redactSourceTokens},
+    {flag: "handler", key: "HANDLERS", check: checkHandlers},
+    {flag: "sidecar", key: "SIDECARS", check: checkSidecars},
+    {flag: "compress-uploads", key: "COMPRESS_UPLOADS"},
+    {flag: "cargo-max-crate-size", key: "CARGO_MAX_CRATE_SIZE", check: checkSize},
+    {flag: "checkpoint", key: "CHECKPOINT"},
+    {flag: "report", key: "IMPORT_REPORT"},
+}
+
+func init() {
+    rootCmd.AddCommand(importCmd)
+    configure(importCmd, importSettings, checkPackageType)
+
+    importCmd.Flags().String("source-dir", "downloads", "Download directory written by export, merged or not, or an artifact tree from another tool")
+    importCmd.Flags().StringP("target-organization", "t", "", "Target Organization to import packages to")
+    importCmd.Flags().StringP("target-token", "b", "", "Target Organization GitHub token")
+    importCmd.Flags().String("target-tokens", "", "More target tokens, comma-separated, to rotate with --target-token (optional)")
+    importCmd.Flags().StringP("package-type", "p", "", "Only import packages of this type (default: all in the directory)")
+    importCmd.Flags().StringArray("registry-url", nil, "Target registry for types not hosted by GitHub as type=url, e.g. cargo=https://crates.example.com (repeatable)")
+    importCmd.Flags().StringArray("registry-token", nil, "Token for a target registry of --registry-url as type=token; the GitHub token is never sent to it (repeatable)")
+    importCmd.Flags().StringArray("handler", nil, "Custom package type handler as type=/path/to/executable (repeatable)")
+    importCmd.Flags().StringArray("sidecar", nil, "Copy, regenerate, or skip checksum and signature files as [TYPE:]EXT=MODE, e.g. maven:md5=skip (repeatable)")
+    importCmd.Flags().Bool("compress-uploads", false, "Gzip JSON, XML, and text request bodies such as npm publishes, falling back to plain bodies for hosts that reject them")
+    importCmd.Flags().String("cargo-max-crate-size", "", "Largest crate the target cargo registry accepts, e.g. 50MiB (default: the crates.io limit of 10MiB)")
+    importCmd.Flags().String("checkpoint", "import-state.jsonl", "JSONL path recording every imported version, so a rerun skips them")
+    importCmd.Flags().String("report", "import-report.csv", "CSV path listing every version's import outcome (empty to disable)")
+
+    completeFlags(importCmd, map[string][]string{
+        "checkpoint": {"jsonl"},
+    })
+    importCmd.MarkFlagDirname("source-dir")
+    importCmd.Example = examples(importCmd,
+        example{comment: "Import an export carried over from another network", flags: []string{
+            "source-dir", "./downloads", "target-organization", "target-org", "target-token", "$TARGET_TOKEN",
+        }},
+        example{comment: "Only import the npm packages", flags: []string{
+            "source-dir", "./downloads", "target-organization", "target-org", "target-token", "$TARGET_TOKEN",
+            "package-type", "npm",
+        }},
+    )
+}
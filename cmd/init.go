@@ -0,0 +1,47 @@
+package cmd
+
+import (
+    "github.com/cvega/gh-migrate-packages/pkg/scaffold"
+    "github.com/pterm/pterm"
+    "github.com/spf13/cobra"
+)
+
+var initCmd = &cobra.Command{
+    Use:   "init [DIRECTORY]",
+    Short: "Creates a migration project with a starter config, mapping file, and workflow",
+    Long:  "Creates a migration project directory (the current directory by default) with a starter migrate-packages.yaml, an empty mappings.csv documenting its columns, a .gitignore for state and download directories, and a GitHub Actions workflow that plans and applies the migration",
+    Args:  cobra.MaximumNArgs(1),
+    RunE: func(cmd *cobra.Command, args []string) error {
+        dir := "."
+        if len(args) > 0 {
+            dir = args[0]
+        }
+        force, _ := cmd.Flags().GetBool("force")
+
+        written, err := scaffold.Create(dir, force)
+        for _, path := range written {
+            pterm.Success.Printf("Created %s\n", path)
+        }
+        if err != nil {
+            return err
+        }
+        if len(written) == 0 {
+            pterm.Info.Printf("%s already has every project file, use --force to overwrite them\n", dir)
+            return nil
+        }
+
+        pterm.Info.Println("Fill in migrate-packages.yaml, then check it with: gh migrate-packages config show sync")
+        return nil
+    },
+}
+
+func init() {
+    rootCmd.AddCommand(initCmd)
+
+    initCmd.Flags().Bool("force", false, "Overwrite project files that already exist")
+
+    initCmd.Example = examples(initCmd,
+        example{comment: "Start a migration project in ./acme-migration", args: []string{"acme-migration"}},
+        example{comment: "Reset the current project's files to the templates", flags: []string{"force", ""}},
+    )
+}
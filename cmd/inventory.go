@@ -0,0 +1,54 @@
+package cmd
+
+import (
+    "github.com/cvega/gh-migrate-packages/pkg/inventory"
+    "github.com/spf13/cobra"
+)
+
+var inventoryCmd = &cobra.Command{
+    Use:   "inventory",
+    Short: "Prints aggregate statistics of the packages in an organization",
+    Long:  "Lists an organization's packages and prints their totals: packages, versions, files, size, and downloads by type, the largest packages, and the stale packages nothing was published to in --stale-days. Without --package-type, every type GitHub Packages hosts is counted. Nothing is downloaded or changed",
+    Args:  cobra.NoArgs,
+    RunE: func(cmd *cobra.Command, args []string) error {
+        cmd.SilenceUsage = true
+        return inventory.InventoryFromConfig()
+    },
+}
+
+var inventorySettings = []setting{
+    {flag: "organization", key: "SOURCE_ORGANIZATION", required: true},
+    {flag: "token", key: "SOURCE_TOKEN", required: true, redact: redactToken},
+    {flag: "tokens", key: "SOURCE_TOKENS", redact: redactToken},
+    {flag: "hostname", key: "SOURCE_HOSTNAME"},
+    {flag: "package-type", key: "PACKAGE_TYPE"},
+    {flag: "source-registry-url", key: "SOURCE_REGISTRY_URLS", check: checkRegistries},
+    {flag: "source-registry-token", key: "SOURCE_REGISTRY_TOKENS", check: checkRegistryTokens, redact: redactSourceTokens},
+    {flag: "top", key: "INVENTORY_TOP"},
+    {flag: "stale-days", key: "STALE_DAYS"},
+}
+
+func init() {
+    rootCmd.AddCommand(inventoryCmd)
+    configure(inventoryCmd, inventorySettings, checkPackageType)
+
+    inventoryCmd.Flags().StringP("organization", "o", "", "Organization to take the inventory of")
+    inventoryCmd.Flags().StringP("token", "t", "", "GitHub token")
+    inventoryCmd.Flags().String("tokens", "", "More tokens for --organization, comma-separated, to rotate with --token (optional)")
+    inventoryCmd.Flags().StringP("hostname", "u", "", "GitHub Enterprise hostname url (optional)")
+    inventoryCmd.Flags().StringP("package-type", "p", "", "Only count packages of this type (default: every type GitHub Packages hosts)")
+    inventoryCmd.Flags().StringArray("source-registry-url", nil, "Registry for types not hosted by GitHub as type=url, e.g. cargo=https://crates.example.com (repeatable)")
+    inventoryCmd.Flags().StringArray("source-registry-token", nil, "Token for a source registry of --source-registry-url as type=token; the GitHub token is never sent to it (repeatable)")
+    inventoryCmd.Flags().Int("top", 10, "How many of the largest and stale packages to list")
+    inventoryCmd.Flags().Int("stale-days", 365, "Count a package as stale when nothing was published to it in this many days")
+
+    inventoryCmd.Example = examples(inventoryCmd,
+        example{comment: "Take the inventory of an organization before planning its migration", flags: []string{
+            "organization", "source-org", "token", "$SOURCE_TOKEN",
+        }},
+        example{comment: "List the 25 largest container images and those untouched for six months", flags: []string{
+            "organization", "source-org", "token", "$SOURCE_TOKEN", "package-type", "container",
+            "top", "25", "stale-days", "180",
+        }},
+    )
+}
@@ -0,0 +1,53 @@
+package cmd
+
+import (
+    "github.com/cvega/gh-migrate-packages/pkg/sync"
+    "github.com/spf13/cobra"
+)
+
+var orgSettingsCmd = &cobra.Command{
+    Use:   "org-settings",
+    Short: "Compares the package settings of the source and target organizations",
+    Long:  "Compares the organization settings that govern packages, copies those the API can set with --apply, and writes a checklist of the rest, such as package creation permissions, to compare in the web UI",
+    RunE: func(cmd *cobra.Command, args []string) error {
+        cmd.SilenceUsage = true
+        return sync.ReplicateSettings()
+    },
+}
+
+var orgSettingsSettings = []setting{
+    {flag: "source-organization", key: "SOURCE_ORGANIZATION", required: true},
+    {flag: "target-organization", key: "TARGET_ORGANIZATION", required: true},
+    {flag: "source-token", key: "SOURCE_TOKEN", required: true, redact: redactToken},
+    {flag: "target-token", key: "TARGET_TOKEN", required: true, redact: redactToken},
+    {flag: "source-hostname", key: "SOURCE_HOSTNAME"},
+    {flag: "apply", key: "APPLY"},
+    {flag: "checklist", key: "CHECKLIST"},
+}
+
+func init() {
+    rootCmd.AddCommand(orgSettingsCmd)
+    configure(orgSettingsCmd, orgSettingsSettings)
+
+    orgSettingsCmd.Flags().StringP("source-organization", "s", "", "Organization whose package settings are copied")
+    orgSettingsCmd.Flags().StringP("target-organization", "t", "", "Organization receiving the package settings")
+    orgSettingsCmd.Flags().StringP("source-token", "a", "", "Source organization GitHub token; owner tokens can read every setting")
+    orgSettingsCmd.Flags().StringP("target-token", "b", "", "Target organization GitHub token; --apply needs an owner's token")
+    orgSettingsCmd.Flags().StringP("source-hostname", "u", "", "GitHub Enterprise source hostname url (optional)")
+    orgSettingsCmd.Flags().Bool("apply", false, "Copy the settings that differ and that the API can set to the target")
+    orgSettingsCmd.Flags().String("checklist", "package-settings.md", "Markdown path listing every setting as a task, ticked when it matches (empty to disable)")
+
+    completeFlags(orgSettingsCmd, map[string][]string{
+        "checklist": {"md"},
+    })
+    orgSettingsCmd.Example = examples(orgSettingsCmd,
+        example{comment: "Compare the package settings and write a checklist", flags: []string{
+            "source-organization", "source-org", "target-organization", "target-org",
+            "source-token", "$SOURCE_TOKEN", "target-token", "$TARGET_TOKEN",
+        }},
+        example{comment: "Also copy the settings the API can set", flags: []string{
+            "source-organization", "source-org", "target-organization", "target-org",
+            "source-token", "$SOURCE_TOKEN", "target-token", "$TARGET_TOKEN", "apply", "",
+        }},
+    )
+}
@@ -0,0 +1,115 @@
+package cmd
+
+import (
+    "github.com/cvega/gh-migrate-packages/pkg/sync"
+    "github.com/spf13/cobra"
+)
+
+var planCmd = &cobra.Command{
+    Use:   "plan",
+    Short: "Writes every action a sync would take as a plan to review and apply",
+    Long:  "Lists and maps everything the way sync does, uploading nothing, and writes each version it would create, overwrite, or skip, and why, to a JSON plan, optionally signed. Once the plan is reviewed, sync --plan-file executes exactly its creates and overwrites, and fails the versions that changed since it was made instead of migrating them",
+    Args:  cobra.NoArgs,
+    RunE: func(cmd *cobra.Command, args []string) error {
+        cmd.SilenceUsage = true
+        return sync.PlanMigration()
+    },
+}
+
+var planSettings = []setting{
+    {flag: "source-organization", key: "SOURCE_ORGANIZATION", required: true},
+    {flag: "target-organization", key: "TARGET_ORGANIZATION", required: true},
+    {flag: "source-token", key: "SOURCE_TOKEN", required: true, redact: redactToken},
+    {flag: "target-token", key: "TARGET_TOKEN", required: true, redact: redactToken},
+    {flag: "mapping-file", key: "MAPPING_FILE", check: checkFileExists},
+    {flag: "source-hostname", key: "SOURCE_HOSTNAME"},
+    {flag: "package-type", key: "PACKAGE_TYPE"},
+    {flag: "handler", key: "HANDLERS", check: checkHandlers},
+    {flag: "source-registry-url", key: "SOURCE_REGISTRY_URLS", check: checkRegistries},
+    {flag: "source-registry-token", key: "SOURCE_REGISTRY_TOKENS", check: checkRegistryTokens, redact: redactSourceTokens},
+    {flag: "registry-url", key: "TARGET_REGISTRY_URLS", check: checkRegistries},
+    {flag: "registry-token", key: "TARGET_REGISTRY_TOKENS", check: checkRegistryTokens, redact: redactSourceTokens},
+    {flag: "skip-existing", key: "SKIP_EXISTING"},
+    {flag: "version-range", key: "VERSION_RANGE"},
+    {flag: "exclude-prereleases", key: "EXCLUDE_PRERELEASES"},
+    {flag: "only-releases", key: "ONLY_RELEASES"},
+    {flag: "exclude-orphaned", key: "EXCLUDE_ORPHANED"},
+    {flag: "only-orphaned", key: "ONLY_ORPHANED"},
+    {flag: "min-downloads", key: "MIN_DOWNLOADS"},
+    {flag: "interactive", key: "INTERACTIVE"},
+    {flag: "normalize-names", key: "NORMALIZE_NAMES"},
+    {flag: "normalization-report", key: "NORMALIZATION_REPORT"},
+    {flag: "min-version-size", key: "MIN_VERSION_SIZE"},
+    {flag: "max-version-size", key: "MAX_VERSION_SIZE"},
+    {flag: "file-filter", key: "FILE_FILTERS"},
+    {flag: "review-threshold", key: "REVIEW_THRESHOLD"},
+    {flag: "approvals-file", key: "APPROVALS_FILE"},
+    {flag: "target-prefix", key: "TARGET_PREFIX"},
+    {flag: "npm-scope-suffix", key: "NPM_SCOPE_SUFFIX"},
+    {flag: "maven-group-prefix", key: "MAVEN_GROUP_PREFIX"},
+    {flag: "container-path-prefix", key: "CONTAINER_PATH_PREFIX"},
+    {flag: "snapshot", key: "SNAPSHOT", check: checkFileExists},
+    {flag: "late-publishes-report", key: "LATE_PUBLISHES_REPORT"},
+    {flag: "out", key: "PLAN_OUT"},
+    {flag: "plan-key", key: "PLAN_KEY", check: checkProvenanceKey},
+}
+
+func init() {
+    rootCmd.AddCommand(planCmd)
+    configure(planCmd, planSettings, checkPackageType, checkVersionFilter, checkOrphaned, checkInteractive)
+
+    planCmd.Flags().StringP("source-organization", "s", "", "Source Organization packages will be migrated from")
+    planCmd.Flags().StringP("target-organization", "t", "", "Target Organization packages will be migrated to")
+    planCmd.Flags().StringP("source-token", "a", "", "Source Organization GitHub token")
+    planCmd.Flags().StringP("target-token", "b", "", "Target Organization GitHub token, to list what the target already has")
+    planCmd.Flags().StringP("mapping-file", "m", "", "Mapping file path for package name and container name:tag mappings")
+    planCmd.Flags().StringP("source-hostname", "u", "", "GitHub Enterprise source hostname url (optional)")
+    planCmd.Flags().StringP("package-type", "p", "", "Package type to plan (container, npm, maven, nuget, rubygems, cargo, go, deb, rpm, composer, conda, terraform, swift, cocoapods, generic)")
+    planCmd.Flags().StringArray("handler", nil, "Custom package type handler as type=/path/to/executable (repeatable)")
+    planCmd.Flags().StringArray("source-registry-url", nil, "Source registry for types not hosted by GitHub as type=url (repeatable)")
+    planCmd.Flags().StringArray("source-registry-token", nil, "Token for a source registry of --source-registry-url as type=token; the GitHub token is never sent to it (repeatable)")
+    planCmd.Flags().StringArray("registry-url", nil, "Target registry for types not hosted by GitHub as type=url, e.g. cargo=https://crates.example.com (repeatable)")
+    planCmd.Flags().StringArray("registry-token", nil, "Token for a target registry of --registry-url as type=token; the GitHub token is never sent to it (repeatable)")
+    planCmd.Flags().BoolP("skip-existing", "k", false, "Skip packages that already exist in the target")
+    planCmd.Flags().String("version-range", "", "Only plan versions in this range, e.g. \">=2.0.0\", \"[1.0,2.0)\", or tag globs \"v1.*\" for containers (optional)")
+    planCmd.Flags().Bool("exclude-prereleases", false, "Skip prerelease versions such as -beta, -rc, and Maven SNAPSHOTs")
+    planCmd.Flags().Bool("only-releases", false, "Only plan plain release versions, skipping prereleases, build metadata, and non-version tags like latest")
+    planCmd.Flags().Bool("exclude-orphaned", false, "Leave out packages with no linked repository")
+    planCmd.Flags().Bool("only-orphaned", false, "Only plan packages with no linked repository")
+    planCmd.Flags().Int("min-downloads", 0, "Skip packages downloaded fewer than this many times in the source (optional)")
+    planCmd.Flags().BoolP("interactive", "i", false, "Pick the packages to plan from a list showing their type, version count, and size")
+    planCmd.Flags().Bool("normalize-names", false, "Rewrite target names the target registry would reject (case, characters, length) instead of stopping")
+    planCmd.Flags().String("normalization-report", "name-normalizations.csv", "CSV path recording every name normalization applied")
+    planCmd.Flags().String("min-version-size", "", "Skip versions smaller than this total size, e.g. 1KB (optional)")
+    planCmd.Flags().String("max-version-size", "", "Skip versions larger than this total size, e.g. 2GiB (optional)")
+    planCmd.Flags().StringArray("file-filter", nil, "Glob selecting files to migrate within each version; prefix with ! to exclude, e.g. '!*-javadoc.jar' (repeatable)")
+    planCmd.Flags().String("review-threshold", "", "Skip versions larger than this unless approved, e.g. 10GiB (optional)")
+    planCmd.Flags().String("approvals-file", "", "CSV of approved package/version rows to plan despite the review threshold")
+    planCmd.Flags().String("target-prefix", "", "Prefix added to every target package name not renamed by the mapping file, e.g. legacy- (optional)")
+    planCmd.Flags().String("npm-scope-suffix", "", "Suffix added to the scope of npm packages instead of --target-prefix, e.g. -legacy for @acme-legacy/ui (optional)")
+    planCmd.Flags().String("maven-group-prefix", "", "Prefix added to the groupId of Maven packages instead of --target-prefix, e.g. legacy. (optional)")
+    planCmd.Flags().String("container-path-prefix", "", "Path prefix added to container images instead of --target-prefix, e.g. legacy/ (optional)")
+    planCmd.Flags().String("snapshot", "", "Version snapshot written by export --snapshot; only its versions are planned (optional)")
+    planCmd.Flags().String("late-publishes-report", "late-publishes.csv", "CSV path listing versions published after the --snapshot")
+    planCmd.Flags().StringP("out", "o", "migration-plan.json", "Path the plan is written to")
+    planCmd.Flags().String("plan-key", "", "PEM private key (Ed25519, ECDSA, or RSA) signing the plan as a DSSE envelope, for sync --plan-public-key to check (optional)")
+
+    completeFlags(planCmd, map[string][]string{
+        "mapping-file":   {"csv"},
+        "approvals-file": {"csv"},
+        "snapshot":       {"json"},
+        "out":            {"json"},
+        "plan-key":       {"pem", "key"},
+    })
+    planCmd.Example = examples(planCmd,
+        example{comment: "Plan the migration of every npm package", flags: []string{
+            "source-organization", "source-org", "target-organization", "target-org",
+            "source-token", "$SOURCE_TOKEN", "target-token", "$TARGET_TOKEN", "package-type", "npm",
+        }},
+        example{comment: "Sign a plan of renamed Maven releases for review", flags: []string{
+            "source-organization", "source-org", "target-organization", "target-org",
+            "source-token", "$SOURCE_TOKEN", "target-token", "$TARGET_TOKEN", "package-type", "maven",
+            "mapping-file", "mappings.csv", "only-releases", "", "plan-key", "plan-key.pem",
+        }},
+    )
+}
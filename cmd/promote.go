@@ -0,0 +1,67 @@
+package cmd
+
+import (
+    "fmt"
+
+    "github.com/cvega/gh-migrate-packages/pkg/sync"
+    "github.com/spf13/cobra"
+    "github.com/spf13/viper"
+)
+
+var promoteCmd = &cobra.Command{
+    Use:   "promote",
+    Short: "Promotes packages migrated into a staging organization to the final organization",
+    Long:  "Verifies a staging organization against the original source, copies its packages into the final organization, and checks that every staged version arrived",
+    Run: func(cmd *cobra.Command, args []string) {
+        sync.PromotePackages()
+    },
+}
+
+var promoteSettings = []setting{
+    {flag: "staging-organization", key: "STAGING_ORGANIZATION", required: true},
+    {flag: "target-organization", key: "TARGET_ORGANIZATION", required: true},
+    {flag: "target-token", key: "TARGET_TOKEN", required: true, redact: redactToken},
+    {flag: "package-type", key: "PACKAGE_TYPE"},
+    {flag: "verify-source-organization", key: "VERIFY_SOURCE_ORGANIZATION"},
+    {flag: "verify-source-token", key: "VERIFY_SOURCE_TOKEN", redact: redactToken},
+    {flag: "source-hostname", key: "SOURCE_HOSTNAME"},
+    {flag: "mapping-file", key: "MAPPING_FILE", check: checkFileExists},
+    {flag: "force", key: "FORCE"},
+    {flag: "gap-report", key: "GAP_REPORT"},
+}
+
+// checkVerifySource needs a token for the organization staging is checked against
+func checkVerifySource() error {
+    if viper.GetString("VERIFY_SOURCE_ORGANIZATION") != "" && viper.GetString("VERIFY_SOURCE_TOKEN") == "" {
+        return fmt.Errorf("--verify-source-organization needs --verify-source-token")
+    }
+    return nil
+}
+
+func init() {
+    rootCmd.AddCommand(promoteCmd)
+    configure(promoteCmd, promoteSettings, checkPackageType, checkVerifySource)
+
+    promoteCmd.Flags().StringP("staging-organization", "s", "", "Staging organization a previous sync migrated into")
+    promoteCmd.Flags().StringP("target-organization", "t", "", "Final organization to promote packages to")
+    promoteCmd.Flags().StringP("target-token", "b", "", "GitHub token with access to both the staging and final organizations")
+    promoteCmd.Flags().StringP("package-type", "p", "", "Package type to promote (container, npm, maven, nuget, rubygems, cargo, go, deb, rpm, composer, conda, terraform, swift, cocoapods, generic)")
+    promoteCmd.Flags().String("verify-source-organization", "", "Original source organization staging must contain every version of before promoting (optional)")
+    promoteCmd.Flags().String("verify-source-token", "", "Token for --verify-source-organization")
+    promoteCmd.Flags().StringP("source-hostname", "u", "", "GitHub Enterprise hostname of the original source (optional)")
+    promoteCmd.Flags().StringP("mapping-file", "m", "", "Mapping file the staging sync used, so source names are checked under their target names")
+    promoteCmd.Flags().Bool("force", false, "Promote even if staging is missing versions from the source")
+    promoteCmd.Flags().String("gap-report", "", "CSV path listing versions missing from staging or the final organization (optional)")
+
+    completeFlags(promoteCmd, map[string][]string{
+        "mapping-file": {"csv"},
+    })
+    promoteCmd.Example = examples(promoteCmd,
+        example{comment: "Promote staged npm packages once staging matches the source", flags: []string{
+            "staging-organization", "staging-org", "target-organization", "final-org",
+            "target-token", "$TARGET_TOKEN", "package-type", "npm",
+            "verify-source-organization", "source-org", "verify-source-token", "$SOURCE_TOKEN",
+            "gap-report", "gaps.csv",
+        }},
+    )
+}
@@ -0,0 +1,58 @@
+package cmd
+
+import (
+    "github.com/cvega/gh-migrate-packages/pkg/proxy"
+    "github.com/spf13/cobra"
+)
+
+var proxyCmd = &cobra.Command{
+    Use:   "proxy",
+    Short: "Serves the target registries with fallback to the source during cutover",
+    Long:  "Serves npm, Maven, NuGet, RubyGems, and container registry reads from the target organization. Anything the target doesn't have yet is fetched from the source, cached, and forward-published to the target in the background, so consumers can switch to the target before the migration is complete",
+    RunE: func(cmd *cobra.Command, args []string) error {
+        cmd.SilenceUsage = true
+        return proxy.ServeFromConfig()
+    },
+}
+
+var proxySettings = []setting{
+    {flag: "source-organization", key: "SOURCE_ORGANIZATION", required: true},
+    {flag: "target-organization", key: "TARGET_ORGANIZATION", required: true},
+    {flag: "source-token", key: "SOURCE_TOKEN", required: true, redact: redactToken},
+    {flag: "target-token", key: "TARGET_TOKEN", required: true, redact: redactToken},
+    {flag: "source-hostname", key: "SOURCE_HOSTNAME"},
+    {flag: "listen", key: "LISTEN"},
+    {flag: "public-url", key: "PUBLIC_URL"},
+    {flag: "cache-dir", key: "CACHE_DIR"},
+    {flag: "proxy-token", key: "PROXY_TOKEN", redact: redactToken},
+    {flag: "no-publish", key: "NO_PUBLISH"},
+}
+
+func init() {
+    rootCmd.AddCommand(proxyCmd)
+    configure(proxyCmd, proxySettings)
+
+    proxyCmd.Flags().StringP("source-organization", "s", "", "Organization packages are still being migrated from")
+    proxyCmd.Flags().StringP("target-organization", "t", "", "Organization consumers are switched to")
+    proxyCmd.Flags().StringP("source-token", "a", "", "Source organization GitHub token")
+    proxyCmd.Flags().StringP("target-token", "b", "", "Target organization GitHub token")
+    proxyCmd.Flags().StringP("source-hostname", "u", "", "GitHub Enterprise source hostname url (optional)")
+    proxyCmd.Flags().String("listen", ":8080", "Address to serve on; types are under /npm, /maven, /nuget, /rubygems, and containers at /v2")
+    proxyCmd.Flags().String("public-url", "", "Base URL clients reach the proxy at, used in rewritten metadata (default: the requested host)")
+    proxyCmd.Flags().String("cache-dir", "proxy-cache", "Directory caching artifacts fetched from the source (empty to disable)")
+    proxyCmd.Flags().String("proxy-token", "", "Token clients must send as their registry token or password (default: no authentication)")
+    proxyCmd.Flags().Bool("no-publish", false, "Serve versions from the source without forward-publishing them to the target")
+
+    proxyCmd.MarkFlagDirname("cache-dir")
+    proxyCmd.Example = examples(proxyCmd,
+        example{comment: "Serve the target with fallback to the source on port 8080", flags: []string{
+            "source-organization", "source-org", "target-organization", "target-org",
+            "source-token", "$SOURCE_TOKEN", "target-token", "$TARGET_TOKEN",
+        }},
+        example{comment: "Require a token from clients and only read from the source", flags: []string{
+            "source-organization", "source-org", "target-organization", "target-org",
+            "source-token", "$SOURCE_TOKEN", "target-token", "$TARGET_TOKEN",
+            "proxy-token", "$PROXY_TOKEN", "no-publish", "",
+        }},
+    )
+}
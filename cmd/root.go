@@ -1,7 +1,13 @@
 package cmd
 
 import (
+    "fmt"
+    "log"
     "os"
+    "github.com/cvega/gh-migrate-packages/pkg/api"
+    "github.com/cvega/gh-migrate-packages/pkg/csvfile"
+    "github.com/cvega/gh-migrate-packages/pkg/run"
+    "github.com/pterm/pterm"
     "github.com/spf13/cobra"
     "github.com/spf13/viper"
 )
@@ -13,17 +19,93 @@ var rootCmd = &cobra.Command{
 }
 
 func Execute() {
-    err := rootCmd.Execute()
+    // Interrupted and failed runs don't leave their staging files behind
+    run.HandleSignals()
+    err := rootCmd.ExecuteContext(run.Context())
+    run.Cleanup()
     if err != nil {
         os.Exit(1)
     }
 }
 
+// rootFlags apply to every command, and are repeated in the commands a
+// run prints for the user to continue it with
+var rootFlags = []string{"config", "env-file", "fips", "log-file", "csv-delimiter", "csv-bom", "csv-crlf"}
+
+// defaultConfigFile is read from the working directory unless --config is given
+const defaultConfigFile = "migrate-packages.yaml"
+
 func init() {
     cobra.OnInitialize(initConfig)
+
+    rootCmd.PersistentFlags().String("config", "", "YAML file with settings for any command (defaults to ./migrate-packages.yaml when present)")
+    rootCmd.PersistentFlags().String("env-file", "", "File of KEY=VALUE environment variables, e.g. GHMP_SOURCE_TOKEN (defaults to ./.ghmp.env when present)")
+    rootCmd.PersistentFlags().Bool("fips", false, "Never compute MD5 or SHA-1 hashes, for FIPS-constrained hosts; Maven checksums become SHA-256 and SHA-512")
+    rootCmd.PersistentFlags().String("log-file", "", "Also append log lines to this file (optional)")
+    rootCmd.PersistentFlags().String("csv-delimiter", "comma", "Field delimiter of the CSV files written: comma, semicolon, tab, pipe, or a single character, e.g. semicolon for spreadsheets in locales with decimal commas")
+    rootCmd.PersistentFlags().Bool("csv-bom", false, "Start CSV files with a UTF-8 byte order mark, so spreadsheet applications read non-ASCII names correctly")
+    rootCmd.PersistentFlags().Bool("csv-crlf", false, "End CSV lines with CRLF, as RFC 4180 specifies, instead of LF")
+    viper.BindPFlag("FIPS", rootCmd.PersistentFlags().Lookup("fips"))
+    viper.BindPFlag("LOG_FILE", rootCmd.PersistentFlags().Lookup("log-file"))
+    viper.BindPFlag("CSV_DELIMITER", rootCmd.PersistentFlags().Lookup("csv-delimiter"))
+    viper.BindPFlag("CSV_BOM", rootCmd.PersistentFlags().Lookup("csv-bom"))
+    viper.BindPFlag("CSV_CRLF", rootCmd.PersistentFlags().Lookup("csv-crlf"))
 }
 
+// initConfig lets GHMP_ environment variables, and below them the config
+// file, stand in for any flag a command binds with configure
 func initConfig() {
     viper.SetEnvPrefix("GHMP")
     viper.AutomaticEnv()
+
+    if err := loadEnvFile(rootCmd.PersistentFlags().Lookup("env-file").Value.String()); err != nil {
+        pterm.Error.Println(err)
+        os.Exit(1)
+    }
+    if err := loadConfigFile(rootCmd.PersistentFlags().Lookup("config").Value.String()); err != nil {
+        pterm.Error.Println(err)
+        os.Exit(1)
+    }
+
+    if viper.GetBool("FIPS") {
+        api.EnableFIPS()
+    }
+
+    // Every CSV file written, reports and exports alike, is laid out alike
+    delimiter, err := csvfile.ParseDelimiter(viper.GetString("CSV_DELIMITER"))
+    if err != nil {
+        pterm.Error.Printf("Invalid --csv-delimiter: %v\n", err)
+        os.Exit(1)
+    }
+    csvfile.Configure(csvfile.Options{
+        Delimiter: delimiter,
+        BOM:       viper.GetBool("CSV_BOM"),
+        CRLF:      viper.GetBool("CSV_CRLF"),
+    })
+
+    // Tell apart the log lines of concurrent or past runs
+    log.SetPrefix("[" + run.ID() + "] ")
+    if path := viper.GetString("LOG_FILE"); path != "" {
+        if err := run.OpenLog(path); err != nil {
+            pterm.Error.Println(err)
+            os.Exit(1)
+        }
+    }
+}
+
+// loadConfigFile reads settings from path, or from defaultConfigFile when
+// path is empty and that file exists
+func loadConfigFile(path string) error {
+    if path == "" {
+        if _, err := os.Stat(defaultConfigFile); err != nil {
+            return nil
+        }
+        path = defaultConfigFile
+    }
+
+    viper.SetConfigFile(path)
+    if err := viper.ReadInConfig(); err != nil {
+        return fmt.Errorf("failed to read config file %s: %v", path, err)
+    }
+    return nil
 }
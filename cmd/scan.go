@@ -0,0 +1,45 @@
+package cmd
+
+import (
+    "github.com/cvega/gh-migrate-packages/pkg/scan"
+    "github.com/spf13/cobra"
+)
+
+var scanManifestsCmd = &cobra.Command{
+    Use:   "scan-manifests",
+    Short: "Finds image references to the source organization in Kubernetes manifests and Helm charts",
+    Long:  "Walks a directory of Kubernetes manifests and Helm charts for images pointing at the source registry and reports or rewrites them using the digest map written by sync",
+    RunE: func(cmd *cobra.Command, args []string) error {
+        return scan.ScanManifestsFromConfig()
+    },
+}
+
+var scanManifestsSettings = []setting{
+    {flag: "path", key: "MANIFEST_PATH", check: checkFileExists},
+    {flag: "digest-map", key: "DIGEST_MAP", required: true, check: checkFileExists},
+    {flag: "rewrite", key: "REWRITE"},
+    {flag: "output", key: "OUTPUT_FILE"},
+}
+
+func init() {
+    rootCmd.AddCommand(scanManifestsCmd)
+    configure(scanManifestsCmd, scanManifestsSettings)
+
+    scanManifestsCmd.Flags().StringP("path", "d", ".", "Directory of manifests and charts to scan")
+    scanManifestsCmd.Flags().StringP("digest-map", "m", "digest-map.csv", "Digest map written by sync")
+    scanManifestsCmd.Flags().BoolP("rewrite", "w", false, "Rewrite mapped references in place instead of only reporting them")
+    scanManifestsCmd.Flags().StringP("output", "o", "", "Write findings to a CSV file (optional)")
+
+    completeFlags(scanManifestsCmd, map[string][]string{
+        "digest-map": {"csv"},
+    })
+    scanManifestsCmd.MarkFlagDirname("path")
+    scanManifestsCmd.Example = examples(scanManifestsCmd,
+        example{comment: "Report source image references under ./deploy", flags: []string{
+            "path", "./deploy", "digest-map", "digest-map.csv", "output", "findings.csv",
+        }},
+        example{comment: "Rewrite them to the migrated images in place", flags: []string{
+            "path", "./deploy", "digest-map", "digest-map.csv", "rewrite", "",
+        }},
+    )
+}
@@ -0,0 +1,76 @@
+package cmd
+
+import (
+    "fmt"
+    "os"
+    "path/filepath"
+
+    "github.com/cvega/gh-migrate-packages/pkg/schema"
+    "github.com/pterm/pterm"
+    "github.com/spf13/cobra"
+)
+
+var schemaCmd = &cobra.Command{
+    Use:   "schema [NAME]",
+    Short: "Prints the JSON Schema of a machine-readable output",
+    Long:  "Prints the JSON Schema of the export manifests, checkpoint state files, snapshot plans, or JSON inventories, the contracts to build tooling on. Without a name, lists the schemas; with --output-dir, writes all of them as NAME.schema.json",
+    Args:  cobra.MaximumNArgs(1),
+    ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+        if len(args) > 0 {
+            return nil, cobra.ShellCompDirectiveNoFileComp
+        }
+        return schema.Names(), cobra.ShellCompDirectiveNoFileComp
+    },
+    RunE: func(cmd *cobra.Command, args []string) error {
+        cmd.SilenceUsage = true
+
+        if dir, _ := cmd.Flags().GetString("output-dir"); dir != "" {
+            if err := os.MkdirAll(dir, 0755); err != nil {
+                return fmt.Errorf("failed to create %s: %v", dir, err)
+            }
+            for _, name := range schema.Names() {
+                data, err := schema.Get(name)
+                if err != nil {
+                    return err
+                }
+                path := filepath.Join(dir, name+".schema.json")
+                if err := os.WriteFile(path, data, 0644); err != nil {
+                    return fmt.Errorf("failed to write %s: %v", path, err)
+                }
+                pterm.Success.Printf("Created %s\n", path)
+            }
+            return nil
+        }
+
+        if len(args) == 0 {
+            table := pterm.TableData{
+                {"Schema", "Describes", "Written by"},
+            }
+            for _, s := range schema.All {
+                table = append(table, []string{s.Name, s.Description, s.Files})
+            }
+            pterm.DefaultTable.WithHasHeader().WithData(table).Render()
+            return nil
+        }
+
+        data, err := schema.Get(args[0])
+        if err != nil {
+            return err
+        }
+        _, err = os.Stdout.Write(data)
+        return err
+    },
+}
+
+func init() {
+    rootCmd.AddCommand(schemaCmd)
+
+    schemaCmd.Flags().String("output-dir", "", "Write every schema into this directory instead of printing one (optional)")
+    schemaCmd.MarkFlagDirname("output-dir")
+
+    schemaCmd.Example = examples(schemaCmd,
+        example{comment: "List the published schemas"},
+        example{comment: "Print the schema of the snapshot plan file", args: []string{"plan"}},
+        example{comment: "Write all schemas for a validation pipeline", flags: []string{"output-dir", "schemas"}},
+    )
+}
@@ -0,0 +1,76 @@
+package cmd
+
+import (
+    "fmt"
+    "strings"
+
+    "github.com/cvega/gh-migrate-packages/pkg/selftest"
+    "github.com/cvega/gh-migrate-packages/pkg/transport"
+    "github.com/spf13/cobra"
+)
+
+var selftestCmd = &cobra.Command{
+    Use:   "selftest",
+    Short: "Runs an end-to-end migration of fixture packages between two scratch organizations",
+    Long:  "Publishes a tiny fixture package of each supported type to a scratch source organization, runs export, sync, and verify against it and a scratch target, reports each step, and deletes the fixtures from both organizations. Use it to check tokens, organization policies, and GHES connectivity before a real migration",
+    RunE: func(cmd *cobra.Command, args []string) error {
+        cmd.SilenceUsage = true
+        return selftest.RunFromConfig()
+    },
+}
+
+var selftestSettings = []setting{
+    {flag: "source-organization", key: "SOURCE_ORGANIZATION", required: true},
+    {flag: "target-organization", key: "TARGET_ORGANIZATION", required: true},
+    {flag: "source-token", key: "SOURCE_TOKEN", required: true, redact: redactToken},
+    {flag: "target-token", key: "TARGET_TOKEN", required: true, redact: redactToken},
+    {flag: "source-hostname", key: "SOURCE_HOSTNAME"},
+    {flag: "package-type", key: "PACKAGE_TYPE", check: checkSelftestType},
+    {flag: "keep", key: "KEEP"},
+    {flag: "chaos", key: "CHAOS", check: checkChaos},
+}
+
+// checkChaos parses the rate of simulated failures
+func checkChaos(value string) error {
+    _, err := transport.ParseRate(value)
+    return err
+}
+
+func checkSelftestType(value string) error {
+    for _, t := range selftest.Types {
+        if value == t {
+            return nil
+        }
+    }
+    return fmt.Errorf("no fixture for %q, expected one of %s", value, strings.Join(selftest.Types, ", "))
+}
+
+func init() {
+    rootCmd.AddCommand(selftestCmd)
+    configure(selftestCmd, selftestSettings)
+
+    selftestCmd.Flags().StringP("source-organization", "s", "", "Scratch organization the fixtures are published to and migrated from")
+    selftestCmd.Flags().StringP("target-organization", "t", "", "Scratch organization the fixtures are migrated to")
+    selftestCmd.Flags().StringP("source-token", "a", "", "Source organization GitHub token, with write:packages and delete:packages")
+    selftestCmd.Flags().StringP("target-token", "b", "", "Target organization GitHub token, with write:packages and delete:packages")
+    selftestCmd.Flags().StringP("source-hostname", "u", "", "GitHub Enterprise source hostname url (optional)")
+    selftestCmd.Flags().StringP("package-type", "p", "", "Only test one package type (npm, maven, nuget, rubygems, container; default: all)")
+    selftestCmd.Flags().Bool("keep", false, "Leave the fixtures and working files in place for inspection")
+    selftestCmd.Flags().String("chaos", "", "Share of target requests the sync step fails or pauses on purpose, e.g. 2%, to rehearse retry and rollback runbooks (optional)")
+
+    selftestCmd.Example = examples(selftestCmd,
+        example{comment: "Test every package type between two scratch organizations", flags: []string{
+            "source-organization", "scratch-source", "target-organization", "scratch-target",
+            "source-token", "$SOURCE_TOKEN", "target-token", "$TARGET_TOKEN",
+        }},
+        example{comment: "Test npm from GitHub Enterprise Server and keep the fixtures", flags: []string{
+            "source-organization", "scratch-source", "target-organization", "scratch-target",
+            "source-token", "$SOURCE_TOKEN", "target-token", "$TARGET_TOKEN",
+            "source-hostname", "github.example.com", "package-type", "npm", "keep", "",
+        }},
+        example{comment: "Rehearse the runbooks with 2% simulated upload failures and rate limit pauses", flags: []string{
+            "source-organization", "scratch-source", "target-organization", "scratch-target",
+            "source-token", "$SOURCE_TOKEN", "target-token", "$TARGET_TOKEN", "chaos", "2%",
+        }},
+    )
+}
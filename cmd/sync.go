@@ -1,7 +1,14 @@
 package cmd
 
 import (
-    "os"
+    "fmt"
+    "net/url"
+    "strings"
+    "time"
+
+    "github.com/cvega/gh-migrate-packages/pkg/api"
+    "github.com/cvega/gh-migrate-packages/pkg/attest"
+    "github.com/cvega/gh-migrate-packages/pkg/provenance"
     "github.com/cvega/gh-migrate-packages/pkg/sync"
     "github.com/spf13/cobra"
     "github.com/spf13/viper"
@@ -11,57 +18,361 @@ var syncCmd = &cobra.Command{
     Use:   "sync",
     Short: "Migrates packages from a source organization to a target organization",
     Long:  "Migrates packages, versions, and metadata from a source organization to a target organization",
-    Run: func(cmd *cobra.Command, args []string) {
-        sourceOrg := cmd.Flag("source-organization").Value.String()
-        targetOrg := cmd.Flag("target-organization").Value.String()
-        sourceToken := cmd.Flag("source-token").Value.String()
-        targetToken := cmd.Flag("target-token").Value.String()
-        mappingFile := cmd.Flag("mapping-file").Value.String()
-        ghHostname := cmd.Flag("source-hostname").Value.String()
-        packageType := cmd.Flag("package-type").Value.String()
-        skipExisting := cmd.Flag("skip-existing").Value.String()
+    RunE: func(cmd *cobra.Command, args []string) error {
+        cmd.SilenceUsage = true
+        if viper.GetBool("WATCH") {
+            return sync.WatchPackages()
+        }
+        return sync.SyncPackages()
+    },
+}
 
-        // Set ENV variables
-        os.Setenv("GHMP_SOURCE_ORGANIZATION", sourceOrg)
-        os.Setenv("GHMP_TARGET_ORGANIZATION", targetOrg)
-        os.Setenv("GHMP_SOURCE_TOKEN", sourceToken)
-        os.Setenv("GHMP_TARGET_TOKEN", targetToken)
-        os.Setenv("GHMP_MAPPING_FILE", mappingFile)
-        os.Setenv("GHMP_SOURCE_HOSTNAME", ghHostname)
-        os.Setenv("GHMP_PACKAGE_TYPE", packageType)
-        os.Setenv("GHMP_SKIP_EXISTING", skipExisting)
+var syncSettings = []setting{
+    {flag: "source-organization", key: "SOURCE_ORGANIZATION", required: true},
+    {flag: "target-organization", key: "TARGET_ORGANIZATION", required: true},
+    {flag: "source-token", key: "SOURCE_TOKEN", required: true, redact: redactToken},
+    {flag: "target-token", key: "TARGET_TOKEN", required: true, redact: redactToken},
+    {flag: "source-tokens", key: "SOURCE_TOKENS", redact: redactToken},
+    {flag: "target-tokens", key: "TARGET_TOKENS", redact: redactToken},
+    {flag: "mapping-file", key: "MAPPING_FILE", check: checkFileExists},
+    {flag: "source-hostname", key: "SOURCE_HOSTNAME"},
+    {flag: "package-type", key: "PACKAGE_TYPE"},
+    {flag: "handler", key: "HANDLERS", check: checkHandlers},
+    {flag: "source-registry-url", key: "SOURCE_REGISTRY_URLS", check: checkRegistries},
+    {flag: "source-registry-token", key: "SOURCE_REGISTRY_TOKENS", check: checkRegistryTokens, redact: redactSourceTokens},
+    {flag: "registry-url", key: "TARGET_REGISTRY_URLS", check: checkRegistries},
+    {flag: "registry-token", key: "TARGET_REGISTRY_TOKENS", check: checkRegistryTokens, redact: redactSourceTokens},
+    {flag: "skip-existing", key: "SKIP_EXISTING"},
+    {flag: "dry-run", key: "DRY_RUN"},
+    {flag: "dry-run-report", key: "DRY_RUN_REPORT"},
+    {flag: "control-socket", key: "CONTROL_SOCKET"},
+    {flag: "transform-plugin", key: "TRANSFORM_PLUGINS"},
+    {flag: "image-report", key: "IMAGE_REPORT"},
+    {flag: "digest-map", key: "DIGEST_MAP"},
+    {flag: "copy-attached", key: "COPY_ATTACHED"},
+    {flag: "notify-manifest", key: "NOTIFY_MANIFEST"},
+    {flag: "open-issues", key: "OPEN_ISSUES", check: checkRepository},
+    {flag: "version-range", key: "VERSION_RANGE"},
+    {flag: "exclude-prereleases", key: "EXCLUDE_PRERELEASES"},
+    {flag: "only-releases", key: "ONLY_RELEASES"},
+    {flag: "exclude-orphaned", key: "EXCLUDE_ORPHANED"},
+    {flag: "only-orphaned", key: "ONLY_ORPHANED"},
+    {flag: "min-downloads", key: "MIN_DOWNLOADS"},
+    {flag: "interactive", key: "INTERACTIVE"},
+    {flag: "order", key: "ORDER", check: checkOrder},
+    {flag: "describe-migration", key: "DESCRIBE_MIGRATION", check: checkDescribeMigration},
+    {flag: "normalize-names", key: "NORMALIZE_NAMES"},
+    {flag: "normalization-report", key: "NORMALIZATION_REPORT"},
+    {flag: "min-version-size", key: "MIN_VERSION_SIZE"},
+    {flag: "max-version-size", key: "MAX_VERSION_SIZE"},
+    {flag: "file-filter", key: "FILE_FILTERS"},
+    {flag: "excluded-files-report", key: "EXCLUDED_FILES_REPORT"},
+    {flag: "file-report", key: "FILE_REPORT"},
+    {flag: "review-threshold", key: "REVIEW_THRESHOLD"},
+    {flag: "review-file", key: "REVIEW_FILE"},
+    {flag: "approvals-file", key: "APPROVALS_FILE"},
+    {flag: "assert-read-only-source", key: "ASSERT_READ_ONLY_SOURCE"},
+    {flag: "restore-deleted", key: "RESTORE_DELETED"},
+    {flag: "target-prefix", key: "TARGET_PREFIX"},
+    {flag: "max-transfer", key: "MAX_TRANSFER", check: checkSize},
+    {flag: "max-api-calls", key: "MAX_API_CALLS"},
+    {flag: "checkpoint", key: "CHECKPOINT"},
+    {flag: "resume", key: "RESUME", check: checkFileExists},
+    {flag: "duplicates-report", key: "DUPLICATES_REPORT"},
+    {flag: "npm-scope-suffix", key: "NPM_SCOPE_SUFFIX"},
+    {flag: "maven-group-prefix", key: "MAVEN_GROUP_PREFIX"},
+    {flag: "container-path-prefix", key: "CONTAINER_PATH_PREFIX"},
+    {flag: "snapshot", key: "SNAPSHOT", check: checkFileExists},
+    {flag: "late-publishes-report", key: "LATE_PUBLISHES_REPORT"},
+    {flag: "final-check", key: "FINAL_CHECK", check: checkFinalCheck},
+    {flag: "watch", key: "WATCH"},
+    {flag: "watch-interval", key: "WATCH_INTERVAL"},
+    {flag: "watch-state", key: "WATCH_STATE"},
+    {flag: "no-rewrite", key: "NO_REWRITE"},
+    {flag: "sidecar", key: "SIDECARS", check: checkSidecars},
+    {flag: "compress-uploads", key: "COMPRESS_UPLOADS"},
+    {flag: "cargo-max-crate-size", key: "CARGO_MAX_CRATE_SIZE", check: checkSize},
+    {flag: "gem-reindex", key: "GEM_REINDEX", check: checkGemReindex},
+    {flag: "provenance", key: "PROVENANCE"},
+    {flag: "provenance-key", key: "PROVENANCE_KEY", check: checkProvenanceKey},
+    {flag: "attest-repository", key: "ATTEST_REPOSITORY", check: checkAttestRepository},
+    {flag: "smoke-test", key: "SMOKE_TEST", check: checkVerifySample},
+    {flag: "smoke-report", key: "SMOKE_REPORT"},
+    {flag: "archive-older-than", key: "ARCHIVE_OLDER_THAN", check: checkAge},
+    {flag: "archive-path", key: "ARCHIVE_PATH"},
+    {flag: "must-migrate", key: "MUST_MIGRATE", check: checkFileExists},
+    {flag: "metadata-workers", key: "METADATA_WORKERS"},
+    {flag: "metadata-retries", key: "METADATA_RETRIES"},
+    {flag: "metadata-report", key: "METADATA_REPORT"},
+    {flag: "migration-archive", key: "MIGRATION_ARCHIVE", check: checkFileExists},
+    {flag: "cleanup-dangling", key: "CLEANUP_DANGLING"},
+    {flag: "progress-url", key: "PROGRESS_URL", check: checkProgressURL},
+    {flag: "progress-interval", key: "PROGRESS_INTERVAL"},
+    {flag: "progress-secret", key: "PROGRESS_SECRET", redact: redactToken},
+    {flag: "plan-file", key: "PLAN_FILE", check: checkFileExists},
+    {flag: "plan-public-key", key: "PLAN_PUBLIC_KEY", check: checkProvenancePublicKey},
+}
 
-        // Bind ENV variables in Viper
-        viper.BindEnv("SOURCE_ORGANIZATION")
-        viper.BindEnv("TARGET_ORGANIZATION")
-        viper.BindEnv("SOURCE_TOKEN")
-        viper.BindEnv("TARGET_TOKEN")
-        viper.BindEnv("MAPPING_FILE")
-        viper.BindEnv("SOURCE_HOSTNAME")
-        viper.BindEnv("PACKAGE_TYPE")
-        viper.BindEnv("SKIP_EXISTING")
+// checkProvenanceKey loads the signing key the way the run will
+func checkProvenanceKey(value string) error {
+    _, err := provenance.LoadSigner(value)
+    return err
+}
 
-        sync.SyncPackages()
-    },
+// checkGemReindex accepts generate or a hook URL
+func checkGemReindex(value string) error {
+    if value == api.GemReindexGenerate {
+        return nil
+    }
+    if u, err := url.Parse(value); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+        return fmt.Errorf("expected %s or an http(s) hook URL, got %q", api.GemReindexGenerate, value)
+    }
+    return nil
+}
+
+// checkAttestRepository accepts the name of a repository in the target
+// organization
+func checkAttestRepository(value string) error {
+    if strings.Contains(value, "/") {
+        return fmt.Errorf("expected a repository name in the target organization, got %q", value)
+    }
+    return nil
+}
+
+// checkProgressURL accepts an http(s) endpoint for progress events
+func checkProgressURL(value string) error {
+    if u, err := url.Parse(value); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+        return fmt.Errorf("expected an http(s) URL, got %q", value)
+    }
+    return nil
+}
+
+// checkFinalCheck accepts the --final-check modes
+func checkFinalCheck(value string) error {
+    if value != sync.FinalCheckReport && value != sync.FinalCheckMigrate {
+        return fmt.Errorf("expected %s or %s, got %q", sync.FinalCheckReport, sync.FinalCheckMigrate, value)
+    }
+    return nil
+}
+
+// checkOrder accepts the --order package orders
+func checkOrder(value string) error {
+    if value != sync.OrderListing && value != sync.OrderDownloadsDesc {
+        return fmt.Errorf("expected %s or %s, got %q", sync.OrderListing, sync.OrderDownloadsDesc, value)
+    }
+    return nil
+}
+
+// checkDescribeMigration accepts the placements of the migration note
+func checkDescribeMigration(value string) error {
+    if value != api.NoteAppend && value != api.NotePrepend {
+        return fmt.Errorf("expected %s or %s, got %q", api.NoteAppend, api.NotePrepend, value)
+    }
+    return nil
+}
+
+// checkSyncSource rejects option combinations that contradict each other
+func checkSyncSource() error {
+    if viper.GetBool("RESTORE_DELETED") && viper.GetBool("ASSERT_READ_ONLY_SOURCE") {
+        return fmt.Errorf("--restore-deleted writes to the source and can't be combined with --assert-read-only-source")
+    }
+    if viper.GetBool("NO_REWRITE") && viper.GetString("TRANSFORM_PLUGINS") != "" {
+        return fmt.Errorf("--no-rewrite uploads artifacts untouched and can't be combined with --transform-plugin")
+    }
+    if viper.GetBool("NO_REWRITE") && viper.GetString("DESCRIBE_MIGRATION") != "" {
+        return fmt.Errorf("--no-rewrite uploads artifacts untouched and can't be combined with --describe-migration")
+    }
+    if viper.GetString("PROVENANCE_KEY") != "" && viper.GetString("PROVENANCE") == "" {
+        return fmt.Errorf("--provenance-key signs the --provenance log and needs it set")
+    }
+    if viper.GetString("ATTEST_REPOSITORY") != "" && !attest.InActions() {
+        return fmt.Errorf("--attest-repository signs with the workflow's identity and must run in GitHub Actions with the id-token: write permission")
+    }
+    if viper.GetString("PROGRESS_SECRET") != "" && viper.GetString("PROGRESS_URL") == "" {
+        return fmt.Errorf("--progress-secret signs the events posted to --progress-url and needs it set")
+    }
+    if viper.GetString("RESUME") != "" && viper.GetString("CHECKPOINT") != "" {
+        return fmt.Errorf("--resume continues in its state file and can't be combined with --checkpoint")
+    }
+    if viper.GetString("PLAN_PUBLIC_KEY") != "" && viper.GetString("PLAN_FILE") == "" {
+        return fmt.Errorf("--plan-public-key checks the signature of --plan-file and needs it set")
+    }
+    if viper.GetString("PLAN_FILE") != "" && viper.GetBool("DRY_RUN") {
+        return fmt.Errorf("--plan-file executes a plan and can't be combined with --dry-run, which makes one")
+    }
+    if viper.GetBool("WATCH") {
+        for _, conflict := range []struct {
+            flag string
+            set  bool
+        }{
+            {"dry-run", viper.GetBool("DRY_RUN")},
+            {"plan-file", viper.GetString("PLAN_FILE") != ""},
+            {"snapshot", viper.GetString("SNAPSHOT") != ""},
+            {"interactive", viper.GetBool("INTERACTIVE")},
+        } {
+            if conflict.set {
+                return fmt.Errorf("--watch migrates new versions until stopped and can't be combined with --%s", conflict.flag)
+            }
+        }
+        if viper.GetDuration("WATCH_INTERVAL") <= 0 {
+            return fmt.Errorf("--watch-interval must be positive")
+        }
+    }
+    if viper.GetInt("MIN_DOWNLOADS") < 0 {
+        return fmt.Errorf("--min-downloads can't be negative")
+    }
+    if viper.GetInt64("MAX_API_CALLS") < 0 {
+        return fmt.Errorf("--max-api-calls can't be negative")
+    }
+    return nil
 }
 
 func init() {
     rootCmd.AddCommand(syncCmd)
+    configure(syncCmd, syncSettings, checkPackageType, checkVersionFilter, checkOrphaned, checkInteractive, checkSyncSource)
 
     syncCmd.Flags().StringP("source-organization", "s", "", "Source Organization to sync packages from")
-    syncCmd.MarkFlagRequired("source-organization")
-
     syncCmd.Flags().StringP("target-organization", "t", "", "Target Organization to sync packages to")
-    syncCmd.MarkFlagRequired("target-organization")
-
     syncCmd.Flags().StringP("source-token", "a", "", "Source Organization GitHub token")
-    syncCmd.MarkFlagRequired("source-token")
-
     syncCmd.Flags().StringP("target-token", "b", "", "Target Organization GitHub token")
-    syncCmd.MarkFlagRequired("target-token")
-
-    syncCmd.Flags().StringP("mapping-file", "m", "", "Mapping file path for package name mappings")
+    syncCmd.Flags().String("source-tokens", "", "More source tokens, comma-separated, to rotate with --source-token; exhausted ones wait for their reset and invalid ones are dropped (optional)")
+    syncCmd.Flags().String("target-tokens", "", "More target tokens, comma-separated, to rotate with --target-token (optional)")
+    syncCmd.Flags().StringP("mapping-file", "m", "", "Mapping file path for package name and container name:tag mappings")
     syncCmd.Flags().StringP("source-hostname", "u", "", "GitHub Enterprise source hostname url (optional)")
-    syncCmd.Flags().StringP("package-type", "p", "", "Package type to sync (container, npm, maven, nuget, rubygems)")
+    syncCmd.Flags().StringP("package-type", "p", "", "Package type to sync (container, npm, maven, nuget, rubygems, cargo, go, deb, rpm, composer, conda, terraform, swift, cocoapods, generic)")
     syncCmd.Flags().BoolP("skip-existing", "k", false, "Skip existing packages to save API requests")
+    syncCmd.Flags().Bool("dry-run", false, "List and map everything, but upload nothing; report which versions would be created, overwritten, or skipped")
+    syncCmd.Flags().String("dry-run-report", "dry-run.csv", "CSV path, or JSON if it ends in .json, listing each version's planned action with --dry-run (empty to disable)")
+    syncCmd.Flags().String("control-socket", "", "Unix socket path exposing pause/resume/abort/status controls (optional)")
+    syncCmd.Flags().StringArray("transform-plugin", nil, "Executable that may rewrite each artifact before upload (repeatable)")
+    syncCmd.Flags().StringArray("source-registry-url", nil, "Source registry for types not hosted by GitHub as type=url (repeatable)")
+    syncCmd.Flags().StringArray("source-registry-token", nil, "Token for a source registry of --source-registry-url as type=token; the GitHub token is never sent to it (repeatable)")
+    syncCmd.Flags().StringArray("registry-url", nil, "Target registry for types not hosted by GitHub as type=url, e.g. cargo=https://crates.example.com (repeatable)")
+    syncCmd.Flags().StringArray("registry-token", nil, "Token for a target registry of --registry-url as type=token; the GitHub token is never sent to it (repeatable)")
+    syncCmd.Flags().String("image-report", "", "CSV path listing migrated container images whose labels or build history still reference the source organization (optional)")
+    syncCmd.Flags().String("digest-map", "digest-map.csv", "CSV path mapping source image@digest to target image@digest for migrated containers (empty to disable)")
+    syncCmd.Flags().Bool("copy-attached", false, "Copy container signatures, attestations and SBOMs, through the referrers API or cosign's sha256-<digest>.sig/.att tags when the target lacks it")
+    syncCmd.Flags().String("notify-manifest", "", "JSON path listing migrated packages and their new URLs per owning team, inferred from CODEOWNERS or topics (optional)")
+    syncCmd.Flags().String("open-issues", "", "Repository (owner/repo) in which to file or update a tracking issue per failed package, using the target token (optional)")
+    syncCmd.Flags().String("version-range", "", "Only migrate versions in this range, e.g. \">=2.0.0\", \"[1.0,2.0)\", or tag globs \"v1.*\" for containers (optional)")
+    syncCmd.Flags().Bool("exclude-prereleases", false, "Skip prerelease versions such as -beta, -rc, and Maven SNAPSHOTs")
+    syncCmd.Flags().Bool("only-releases", false, "Only migrate plain release versions, skipping prereleases, build metadata, and non-version tags like latest")
+    syncCmd.Flags().Bool("exclude-orphaned", false, "Leave out packages with no linked repository; they are still listed in an \"Orphaned packages\" section")
+    syncCmd.Flags().Bool("only-orphaned", false, "Only migrate packages with no linked repository")
+    syncCmd.Flags().Int("min-downloads", 0, "Skip packages downloaded fewer than this many times in the source (optional)")
+    syncCmd.Flags().BoolP("interactive", "i", false, "Pick the packages to migrate from a list showing their type, version count, and size")
+    syncCmd.Flags().String("describe-migration", "", "Add \"Migrated from HOST/ORG on DATE, run ID\" to the description of container, npm and NuGet packages: append or prepend (optional)")
+    syncCmd.Flags().String("order", sync.OrderListing, "Order packages are migrated in: listing (as the source lists them) or downloads-desc (most downloaded first)")
+    syncCmd.Flags().String("min-version-size", "", "Skip versions smaller than this total size, e.g. 1KB (optional)")
+    syncCmd.Flags().StringArray("file-filter", nil, "Glob selecting files to migrate within each version; prefix with ! to exclude, e.g. '!*-javadoc.jar' (repeatable)")
+    syncCmd.Flags().String("excluded-files-report", "excluded-files.csv", "CSV path listing the files left out by --file-filter")
+    syncCmd.Flags().String("file-report", "file-report.csv", "CSV path recording each uploaded file's status, size, duration, and digest check (empty to disable)")
+    syncCmd.Flags().String("max-version-size", "", "Skip versions larger than this total size, e.g. 2GiB (optional)")
+    syncCmd.Flags().String("review-threshold", "", "Hold versions larger than this for approval instead of migrating them, e.g. 10GiB (optional)")
+    syncCmd.Flags().String("review-file", "needs-approval.csv", "CSV path listing versions held for approval")
+    syncCmd.Flags().String("approvals-file", "", "CSV of approved package/version rows, in the review file format, to migrate despite the review threshold")
+    syncCmd.Flags().Bool("normalize-names", false, "Rewrite target names the target registry would reject (case, characters, length) instead of stopping")
+    syncCmd.Flags().String("normalization-report", "name-normalizations.csv", "CSV path recording every name normalization applied")
+    syncCmd.Flags().String("max-transfer", "", "Stop before the next version once this much has been transferred, e.g. 500GiB (optional)")
+    syncCmd.Flags().Int64("max-api-calls", 0, "Stop before the next version once this many API requests have been made (optional)")
+    syncCmd.Flags().String("checkpoint", "", "File recording each version's outcome so a later run skips migrated versions (defaults to sync-state.jsonl when a budget is set)")
+    syncCmd.Flags().String("resume", "", "Continue an interrupted run from its state file, skipping migrated versions and retrying failed ones")
+    syncCmd.Flags().String("duplicates-report", "duplicate-versions.csv", "CSV path listing versions found in the target under their new name with identical content")
+    syncCmd.Flags().String("target-prefix", "", "Prefix added to every target package name not renamed by the mapping file, e.g. legacy- (optional)")
+    syncCmd.Flags().String("npm-scope-suffix", "", "Suffix added to the scope of npm packages instead of --target-prefix, e.g. -legacy for @acme-legacy/ui (optional)")
+    syncCmd.Flags().String("maven-group-prefix", "", "Prefix added to the groupId of Maven packages instead of --target-prefix, e.g. legacy. (optional)")
+    syncCmd.Flags().String("container-path-prefix", "", "Path prefix added to container images instead of --target-prefix, e.g. legacy/ (optional)")
+    syncCmd.Flags().Bool("restore-deleted", false, "Restore source versions deleted within the last 30 days before migrating; writes to the source, so it can't be combined with --assert-read-only-source")
+    syncCmd.Flags().Bool("assert-read-only-source", false, "Block every request that could modify the source organization; only GET, HEAD, and GraphQL queries reach the source host")
+    syncCmd.Flags().StringArray("handler", nil, "Custom package type handler as type=/path/to/executable (repeatable)")
+    syncCmd.Flags().String("snapshot", "", "Version snapshot written by export --snapshot; only its versions are migrated and later publishes are reported (optional)")
+    syncCmd.Flags().String("late-publishes-report", "late-publishes.csv", "CSV path listing versions published after the --snapshot or during the run")
+    syncCmd.Flags().Bool("no-rewrite", false, "Upload artifacts byte for byte as downloaded, skipping metadata rewrites such as the NuGet repository URL")
+    syncCmd.Flags().StringArray("sidecar", nil, "Copy, regenerate, or skip checksum and signature files as [TYPE:]EXT=MODE, e.g. maven:md5=skip or generic:sha256=regenerate (repeatable)")
+    syncCmd.Flags().Bool("compress-uploads", false, "Gzip JSON, XML, and text request bodies such as npm publishes, falling back to plain bodies for hosts that reject them")
+    syncCmd.Flags().String("cargo-max-crate-size", "", "Largest crate the target cargo registry accepts, e.g. 50MiB (default: the crates.io limit of 10MiB)")
+    syncCmd.Flags().String("gem-reindex", "", "After migrating gems to --registry-url rubygems=URL, regenerate its index (generate, for file:// registries) or POST to this reindex hook URL (optional)")
+    syncCmd.Flags().String("provenance", "", "JSON Lines path appended with an in-toto SLSA provenance statement per migrated version, tying target digests to the source artifacts (optional)")
+    syncCmd.Flags().String("provenance-key", "", "PEM private key (Ed25519, ECDSA, or RSA) signing each provenance statement as a DSSE envelope (optional)")
+    syncCmd.Flags().String("attest-repository", "", "Repository in the target organization in which each migrated version's provenance is stored as a GitHub artifact attestation, signed with the workflow's identity (optional)")
+    syncCmd.Flags().String("smoke-test", "", "After migrating, resolve a sample of packages from the target with npm, mvn, docker, nuget, or gem, as a percentage such as 5% or a number of packages (optional)")
+    syncCmd.Flags().String("smoke-report", "smoke-tests.csv", "CSV path listing each smoke test, the command run, and its outcome")
+    syncCmd.Flags().String("archive-older-than", "", "Store versions created longer ago than this, e.g. 2y, 18mo, or 90d, in --archive-path instead of the target (optional)")
+    syncCmd.Flags().String("archive-path", "archive", "Directory receiving archived versions, in the export download layout, and their archive-manifest.jsonl")
+    syncCmd.Flags().String("must-migrate", "", "File listing critical packages as [TYPE:]NAME[@VERSION] globs; the run fails unless all of them are in the target afterwards (optional)")
+    syncCmd.Flags().Int("metadata-workers", 4, "Concurrent visibility and metadata updates, applied after every artifact is transferred")
+    syncCmd.Flags().Int("metadata-retries", 2, "Times a visibility or metadata update failing with a rate limit, server, or network error is retried")
+    syncCmd.Flags().String("metadata-report", "metadata-updates.csv", "CSV path listing each visibility and metadata update and its outcome (empty to disable)")
+    syncCmd.Flags().String("migration-archive", "", "Repository migration archive from ghe-migrator or GitHub Enterprise Importer, .tar.gz or extracted, used to link npm and NuGet packages to their migrated repositories (optional)")
+    syncCmd.Flags().Bool("cleanup-dangling", false, "Delete untagged versions of the migrated container packages that a run of this tool pushed, such as those left by failed runs")
+    syncCmd.Flags().String("progress-url", "", "Endpoint receiving a JSON POST with the run ID, counts, and throughput when the run starts, every --progress-interval, and when it ends (optional)")
+    syncCmd.Flags().Duration("progress-interval", 30*time.Second, "How often progress is posted to --progress-url (0 to only post at start and end)")
+    syncCmd.Flags().String("progress-secret", "", "Secret signing each progress event with HMAC-SHA256 in the X-Ghmp-Signature-256 header (optional)")
+    syncCmd.Flags().String("plan-file", "", "Plan written by the plan command; only its creates and overwrites are executed, and versions changed since it was made fail (optional)")
+    syncCmd.Flags().String("plan-public-key", "", "PEM public key the --plan-file must be signed with, so a plan edited after review is refused (optional)")
+    syncCmd.Flags().String("final-check", "", "After migrating, list the source again and report (report) or also migrate (migrate) versions published since the run or --snapshot began (optional)")
+    syncCmd.Flags().Bool("watch", false, "Keep running, migrating the versions published since the last pass every --watch-interval, until interrupted")
+    syncCmd.Flags().Duration("watch-interval", 15*time.Minute, "How long --watch waits between passes")
+    syncCmd.Flags().String("watch-state", "watch-state.json", "File where --watch records its last complete pass, to continue from when restarted")
+
+    completeFlags(syncCmd, map[string][]string{
+        "mapping-file":      {"csv"},
+        "resume":            {"jsonl"},
+        "dry-run-report":    {"csv", "json"},
+        "approvals-file":    {"csv"},
+        "snapshot":          {"json"},
+        "watch-state":       {"json"},
+        "plan-file":         {"json"},
+        "plan-public-key":   {"pem", "pub"},
+        "provenance-key":    {"pem", "key"},
+        "must-migrate":      {"txt"},
+        "migration-archive": {"gz", "tgz", "tar"},
+    })
+    syncCmd.RegisterFlagCompletionFunc("final-check", cobra.FixedCompletions(
+        []string{sync.FinalCheckReport, sync.FinalCheckMigrate}, cobra.ShellCompDirectiveNoFileComp))
+    syncCmd.RegisterFlagCompletionFunc("describe-migration", cobra.FixedCompletions(
+        []string{api.NoteAppend, api.NotePrepend}, cobra.ShellCompDirectiveNoFileComp))
+    syncCmd.RegisterFlagCompletionFunc("order", cobra.FixedCompletions(
+        []string{sync.OrderListing, sync.OrderDownloadsDesc}, cobra.ShellCompDirectiveNoFileComp))
+    syncCmd.Example = examples(syncCmd,
+        example{comment: "Migrate every npm package", flags: []string{
+            "source-organization", "source-org", "target-organization", "target-org",
+            "source-token", "$SOURCE_TOKEN", "target-token", "$TARGET_TOKEN", "package-type", "npm",
+        }},
+        example{comment: "Rename containers and tags from a mapping file, stopping after 500GiB", flags: []string{
+            "source-organization", "source-org", "target-organization", "target-org",
+            "source-token", "$SOURCE_TOKEN", "target-token", "$TARGET_TOKEN", "package-type", "container",
+            "mapping-file", "mappings.csv", "max-transfer", "500GiB",
+        }},
+        example{comment: "Only Maven releases from 2.0 on, without javadoc jars", flags: []string{
+            "source-organization", "source-org", "target-organization", "target-org",
+            "source-token", "$SOURCE_TOKEN", "target-token", "$TARGET_TOKEN", "package-type", "maven",
+            "version-range", ">=2.0", "only-releases", "", "file-filter", "!*-javadoc.jar",
+        }},
+        example{comment: "Most downloaded containers first, skipping those never pulled", flags: []string{
+            "source-organization", "source-org", "target-organization", "target-org",
+            "source-token", "$SOURCE_TOKEN", "target-token", "$TARGET_TOKEN", "package-type", "container",
+            "order", "downloads-desc", "min-downloads", "1",
+        }},
+        example{comment: "Pick the container images to migrate from a list", flags: []string{
+            "source-organization", "source-org", "target-organization", "target-org",
+            "source-token", "$SOURCE_TOKEN", "target-token", "$TARGET_TOKEN", "package-type", "container",
+            "interactive", "",
+        }},
+        example{comment: "Review what would be migrated before touching the target", flags: []string{
+            "source-organization", "source-org", "target-organization", "target-org",
+            "source-token", "$SOURCE_TOKEN", "target-token", "$TARGET_TOKEN",
+            "mapping-file", "mappings.csv", "dry-run", "", "dry-run-report", "plan.json",
+        }},
+        example{comment: "Keep the target current during a phased cutover, checking hourly", flags: []string{
+            "source-organization", "source-org", "target-organization", "target-org",
+            "source-token", "$SOURCE_TOKEN", "target-token", "$TARGET_TOKEN",
+            "mapping-file", "mappings.csv", "watch", "", "watch-interval", "1h",
+        }},
+        example{comment: "Execute a plan signed at review, and nothing else", flags: []string{
+            "source-organization", "source-org", "target-organization", "target-org",
+            "source-token", "$SOURCE_TOKEN", "target-token", "$TARGET_TOKEN",
+            "mapping-file", "mappings.csv", "plan-file", "migration-plan.json", "plan-public-key", "plan-key.pub",
+        }},
+    )
 }
@@ -0,0 +1,77 @@
+package cmd
+
+import (
+    "github.com/cvega/gh-migrate-packages/pkg/provenance"
+    "github.com/cvega/gh-migrate-packages/pkg/verify"
+    "github.com/spf13/cobra"
+)
+
+var verifyCmd = &cobra.Command{
+    Use:   "verify",
+    Short: "Checks migrated artifacts in the target against the digests sync recorded",
+    Long:  "Compares migrated versions in the target with the digests in the provenance log written by sync --provenance, several at a time. Containers are compared by manifest digest and other packages by the file digests the registry lists, falling back to downloading the files when it lists none. Packages listed in --verify-full are checked completely, and --verify-sample checks a random sample of the rest and reports how many bad versions it could have missed. Fails when any checked version doesn't match",
+    RunE: func(cmd *cobra.Command, args []string) error {
+        cmd.SilenceUsage = true
+        return verify.VerifyFromConfig()
+    },
+}
+
+var verifySettings = []setting{
+    {flag: "provenance", key: "PROVENANCE", required: true, check: checkFileExists},
+    {flag: "target-token", key: "TARGET_TOKEN", required: true, redact: redactToken},
+    {flag: "registry-url", key: "TARGET_REGISTRY_URLS", check: checkRegistries},
+    {flag: "registry-token", key: "TARGET_REGISTRY_TOKENS", check: checkRegistryTokens, redact: redactSourceTokens},
+    {flag: "verify-sample", key: "VERIFY_SAMPLE", check: checkVerifySample},
+    {flag: "verify-full", key: "VERIFY_FULL", check: checkFileExists},
+    {flag: "seed", key: "VERIFY_SEED"},
+    {flag: "report", key: "VERIFY_REPORT"},
+    {flag: "workers", key: "VERIFY_WORKERS"},
+    {flag: "download", key: "VERIFY_DOWNLOAD"},
+    {flag: "provenance-public-key", key: "PROVENANCE_PUBLIC_KEY", check: checkProvenancePublicKey},
+}
+
+func checkVerifySample(value string) error {
+    _, err := verify.ParseSample(value)
+    return err
+}
+
+// checkProvenancePublicKey loads the key the way the run will
+func checkProvenancePublicKey(value string) error {
+    _, err := provenance.LoadPublicKey(value)
+    return err
+}
+
+func init() {
+    rootCmd.AddCommand(verifyCmd)
+    configure(verifyCmd, verifySettings)
+
+    verifyCmd.Flags().String("provenance", "", "Provenance log written by sync --provenance, holding the digest of every migrated artifact")
+    verifyCmd.Flags().StringP("target-token", "b", "", "Token with read access to the target organization")
+    verifyCmd.Flags().StringArray("registry-url", nil, "Target registry for types not hosted by GitHub as type=url, as given to sync (repeatable)")
+    verifyCmd.Flags().StringArray("registry-token", nil, "Token for a target registry of --registry-url as type=token; the GitHub token is never sent to it (repeatable)")
+    verifyCmd.Flags().String("verify-sample", "", "Only check a random sample of versions outside --verify-full, as a percentage such as 5% or a number of versions (default: check all)")
+    verifyCmd.Flags().String("verify-full", "", "File listing critical packages, one name or glob per line as [TYPE:]NAME, whose every version is checked (optional)")
+    verifyCmd.Flags().Int64("seed", 0, "Random seed of the sample, to repeat an earlier verification (default: printed at start)")
+    verifyCmd.Flags().String("report", "verify-report.csv", "CSV path listing every checked version and its outcome")
+    verifyCmd.Flags().Int("workers", 8, "Versions checked concurrently")
+    verifyCmd.Flags().Bool("download", false, "Download and hash every file instead of trusting the digests the registry lists")
+    verifyCmd.Flags().String("provenance-public-key", "", "PEM public key of sync --provenance-key; every statement must carry a valid signature by it (optional)")
+
+    completeFlags(verifyCmd, map[string][]string{
+        "provenance":            {"jsonl"},
+        "provenance-public-key": {"pem", "pub", "key"},
+    })
+    verifyCmd.Example = examples(verifyCmd,
+        example{comment: "Check every migrated version", flags: []string{
+            "provenance", "provenance.jsonl", "target-token", "$TARGET_TOKEN",
+        }},
+        example{comment: "Check 5% of versions, and all of those in critical.txt", flags: []string{
+            "provenance", "provenance.jsonl", "target-token", "$TARGET_TOKEN",
+            "verify-sample", "5%", "verify-full", "critical.txt",
+        }},
+        example{comment: "Check a signed log with 32 workers", flags: []string{
+            "provenance", "provenance.jsonl", "target-token", "$TARGET_TOKEN",
+            "provenance-public-key", "key.pub", "workers", "32",
+        }},
+    )
+}
@@ -0,0 +1,66 @@
+package cmd
+
+import (
+    "fmt"
+
+    "github.com/cvega/gh-migrate-packages/pkg/api"
+    "github.com/cvega/gh-migrate-packages/pkg/version"
+    "github.com/pterm/pterm"
+    "github.com/spf13/cobra"
+)
+
+var versionCmd = &cobra.Command{
+    Use:   "version",
+    Short: "Prints build information and optionally checks for a newer release",
+    Long:  "Prints the version, commit, and Go toolchain of this build. With --check, also looks up newer releases on GitHub and warns when one fixes a registry protocol issue; registry endpoints change between GHES releases, so staying current matters more than usual",
+    Args:  cobra.NoArgs,
+    RunE: func(cmd *cobra.Command, args []string) error {
+        info := version.Get()
+        fmt.Printf("gh-migrate-packages %s\n", info.Version)
+        if info.Commit != "" {
+            fmt.Printf("commit:   %s\n", info.Commit)
+        }
+        if info.BuildTime != "" {
+            fmt.Printf("built:    %s\n", info.BuildTime)
+        }
+        fmt.Printf("go:       %s\n", info.GoVersion)
+        fmt.Printf("platform: %s\n", info.Platform)
+        if api.FIPS() {
+            fmt.Printf("fips:     on, no MD5 or SHA-1 hashes are computed\n")
+        }
+
+        check, _ := cmd.Flags().GetBool("check")
+        if !check {
+            return nil
+        }
+        cmd.SilenceUsage = true
+
+        newer, err := version.Newer(info.Version, version.TokenFromEnv())
+        if err != nil {
+            return err
+        }
+        if len(newer) == 0 {
+            pterm.Success.Println("This is the latest release")
+            return nil
+        }
+
+        pterm.Info.Printf("%s is available: %s (upgrade with: gh extension upgrade migrate-packages)\n", newer[0].Tag, newer[0].URL)
+        for _, r := range newer {
+            for _, fix := range r.RegistryFixes {
+                pterm.Warning.Printf("%s fixes a registry protocol issue: %s\n", r.Tag, fix)
+            }
+        }
+        return nil
+    },
+}
+
+func init() {
+    rootCmd.AddCommand(versionCmd)
+
+    versionCmd.Flags().Bool("check", false, "Look up newer releases on GitHub and warn about registry protocol fixes (makes a network request)")
+
+    versionCmd.Example = examples(versionCmd,
+        example{comment: "Print build information"},
+        example{comment: "Check whether a newer release fixes registry issues", flags: []string{"check", ""}},
+    )
+}
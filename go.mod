@@ -3,12 +3,38 @@ module github.com/cvega/gh-migrate-packages
 go 1.21
 
 require (
-    github.com/spf13/cobra v1.8.0
-    github.com/spf13/viper v1.18.2
-    github.com/shurcooL/githubv4 v0.0.0-20240429030203-be2daab69064
-    github.com/pterm/pterm v0.12.79
-    golang.org/x/oauth2 v0.20.0
-    github.com/gofri/go-github-ratelimit v1.1.0
-    github.com/google/go-github/v62 v62.0.0
-    gopkg.in/yaml.v3 v3.0.1
+	github.com/gofri/go-github-ratelimit v1.1.0
+	github.com/google/go-github/v62 v62.0.0
+	github.com/pelletier/go-toml/v2 v2.1.0
+	github.com/pterm/pterm v0.12.79
+	github.com/shurcooL/githubv4 v0.0.0-20240429030203-be2daab69064
+	github.com/spf13/cobra v1.8.0
+	github.com/spf13/viper v1.18.2
+	golang.org/x/oauth2 v0.20.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
+	atomicgo.dev/cursor v0.2.0 // indirect
+	atomicgo.dev/keyboard v0.2.9 // indirect
+	atomicgo.dev/schedule v0.1.0 // indirect
+	github.com/containerd/console v1.0.3 // indirect
+	github.com/fsnotify/fsnotify v1.7.0 // indirect
+	github.com/gookit/color v1.5.4 // indirect
+	github.com/hashicorp/hcl v1.0.0 // indirect
+	github.com/lithammer/fuzzysearch v1.1.8 // indirect
+	github.com/magiconair/properties v1.8.7 // indirect
+	github.com/mattn/go-runewidth v0.0.15 // indirect
+	github.com/mitchellh/mapstructure v1.5.0 // indirect
+	github.com/rivo/uniseg v0.4.4 // indirect
+	github.com/sagikazarmark/slog-shim v0.1.0 // indirect
+	github.com/spf13/afero v1.11.0 // indirect
+	github.com/spf13/cast v1.6.0 // indirect
+	github.com/spf13/pflag v1.0.5 // indirect
+	github.com/subosito/gotenv v1.6.0 // indirect
+	github.com/xo/terminfo v0.0.0-20220910002029-abceb7e1c41e // indirect
+	golang.org/x/sys v0.16.0 // indirect
+	golang.org/x/term v0.16.0 // indirect
+	golang.org/x/text v0.14.0 // indirect
+	gopkg.in/ini.v1 v1.67.0 // indirect
 )
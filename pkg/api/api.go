@@ -5,16 +5,30 @@ import (
     "context"
     "fmt"
     "log"
+    "net/http"
+    "net/url"
+    "strings"
+    "sync"
+    "sync/atomic"
     "time"
 
     "github.com/gofri/go-github-ratelimit/github_ratelimit"
     "github.com/shurcooL/githubv4"
     "golang.org/x/oauth2"
+    "github.com/cvega/gh-migrate-packages/pkg/extension"
     "github.com/cvega/gh-migrate-packages/pkg/package"
+    "github.com/cvega/gh-migrate-packages/pkg/run"
+    "github.com/cvega/gh-migrate-packages/pkg/transform"
+    "github.com/cvega/gh-migrate-packages/pkg/transport"
 )
 
+// maxRateLimitWait caps a rate limit sleep; primary limits reset hourly, so
+// anything longer comes from a bad reset time or clock
+const maxRateLimitWait = time.Hour
+
 type RateLimitAwareGraphQLClient struct {
     client *githubv4.Client
+    clock  *transport.Clock // corrects ResetAt for local clock skew
 }
 
 func (c *RateLimitAwareGraphQLClient) Query(ctx context.Context, q interface{}, variables map[string]interface{}) error {
@@ -36,19 +50,56 @@ func (c *RateLimitAwareGraphQLClient) Query(ctx context.Context, q interface{},
             return c.client.Query(ctx, q, variables)
         }
 
-        log.Printf("Rate limit exceeded, sleeping until %v\n", rateLimitQuery.RateLimit.ResetAt.Time)
-        time.Sleep(time.Until(rateLimitQuery.RateLimit.ResetAt.Time))
+        wait := c.clock.Until(rateLimitQuery.RateLimit.ResetAt.Time, maxRateLimitWait)
+        log.Printf("Rate limit exceeded, sleeping %v until %v\n", wait.Round(time.Second), rateLimitQuery.RateLimit.ResetAt.Time)
+        time.Sleep(wait)
     }
 }
 
 type API struct {
     graphqlClient *RateLimitAwareGraphQLClient
     ctx           context.Context
+    token         string
+    hostname      string
+    registries    Registries
+    registryTokens Registries // credentials for registries, by package type
+    transformers  transform.Chain
+    client        *http.Client     // for REST and registry requests
+    guard         *transport.Guard // shared by every client of this API
+    meter         *transport.Meter
+    chaos         *transport.Chaos // simulated failures, off unless SetChaos is called
+    compress      *transport.Compress // gzip request bodies, off unless SetCompression is called
+    tokens        *transport.Tokens   // rotates extra tokens in for token, see SetTokens
+    noRewrite     bool // upload artifacts exactly as downloaded
+    cargoMaxCrate int64 // publish limit of the target cargo registry, see SetCargoMaxCrateSize
+    sidecars      Sidecars // checksum and signature handling, defaults when nil
+    gemsPushed    atomic.Int64 // to an external rubygems registry, see ReindexGems
+    referrersMu       sync.Mutex
+    referrersStrategy string // probed once, see ReferrersStrategy
 }
 
 func NewAPI(token, hostname string) *API {
+    // Every request, GraphQL or not, goes Guard -> Chaos -> Compress -> Meter
+    // -> Tokens -> Clock -> UserAgent -> Retry, so the meter counts what is
+    // sent, compressed, once: simulated failures never reach it, and token
+    // turns and retried connections happen below it
+    clock := transport.NewClock(transport.NewUserAgent(transport.NewRetry(nil), run.UserAgent()))
+    if hostname != "" {
+        host := strings.TrimSuffix(hostname, "/")
+        if u, err := url.Parse(hostname); err == nil && u.Host != "" {
+            host = u.Hostname()
+        }
+        clock.AddHost(host)
+    }
+    tokens := transport.NewTokens(clock, token)
+    meter := transport.NewMeter(tokens)
+    compress := transport.NewCompress(meter)
+    chaos := transport.NewChaos(compress)
+    guard := transport.NewGuard(chaos)
+    base := context.WithValue(context.Background(), oauth2.HTTPClient, &http.Client{Transport: guard})
+
     src := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token})
-    httpClient := oauth2.NewClient(context.Background(), src)
+    httpClient := oauth2.NewClient(base, src)
     
     rateLimiter, err := github_ratelimit.NewRateLimitWaiterClient(httpClient.Transport)
     if err != nil {
@@ -63,11 +114,81 @@ func NewAPI(token, hostname string) *API {
     }
 
     return &API{
-        graphqlClient: &RateLimitAwareGraphQLClient{client: baseClient},
+        graphqlClient: &RateLimitAwareGraphQLClient{client: baseClient, clock: clock},
         ctx:          context.Background(),
+        token:        token,
+        hostname:     hostname,
+        client:       &http.Client{Transport: guard},
+        guard:        guard,
+        meter:        meter,
+        chaos:        chaos,
+        compress:     compress,
+        tokens:       tokens,
     }
 }
 
+// SetReadOnly makes this API refuse any request that could modify the
+// organization it talks to: only GET, HEAD, OPTIONS and GraphQL queries pass
+func (a *API) SetReadOnly() {
+    a.guard.SetReadOnly()
+}
+
+// SetBudget counts every request this API makes against budget
+func (a *API) SetBudget(budget *transport.Budget) {
+    a.meter.SetBudget(budget)
+}
+
+// SetChaos makes this API simulate upload failures and rate limit pauses
+// for the given share of requests, to rehearse a migration's runbooks
+func (a *API) SetChaos(rate float64) {
+    a.chaos.SetRate(rate)
+}
+
+// ChaosInjected returns the simulated upload failures and pauses so far
+func (a *API) ChaosInjected() (int64, int64) {
+    return a.chaos.Injected()
+}
+
+// SetCompression gzips JSON, XML, and text request bodies for the hosts
+// that accept them
+func (a *API) SetCompression() {
+    a.compress.Enable()
+}
+
+// CompressionSaved returns the compressed bytes sent and the bytes saved
+func (a *API) CompressionSaved() (int64, int64) {
+    return a.compress.Saved()
+}
+
+// SetTokens adds tokens for the same organization to rotate with the one
+// this API was created with, so requests draw on all of their rate limits
+func (a *API) SetTokens(tokens []string) {
+    a.tokens.Add(tokens)
+}
+
+// TokenCounts returns the tokens in rotation, those waiting for a rate
+// limit reset, and those removed as invalid
+func (a *API) TokenCounts() (int, int, int) {
+    return a.tokens.Counts()
+}
+
+// SetNoRewrite makes uploads send artifacts byte for byte as downloaded,
+// skipping metadata rewrites such as the NuGet repository URL
+func (a *API) SetNoRewrite() {
+    a.noRewrite = true
+}
+
+// SetCargoMaxCrateSize sets the largest crate the target cargo registry
+// accepts, instead of the crates.io limit
+func (a *API) SetCargoMaxCrateSize(size int64) {
+    a.cargoMaxCrate = size
+}
+
+// SetTransformers registers plugins applied to every artifact before upload
+func (a *API) SetTransformers(chain transform.Chain) {
+    a.transformers = chain
+}
+
 // Query structures for GraphQL
 type PackageQuery struct {
     Organization struct {
@@ -76,42 +197,78 @@ type PackageQuery struct {
                 EndCursor   githubv4.String
                 HasNextPage bool
             }
-            Nodes []struct {
-                ID          githubv4.ID
-                Name        githubv4.String
-                PackageType githubv4.String
-                Repository  struct {
-                    Name githubv4.String
-                    URL  githubv4.String
-                }
-                Statistics struct {
-                    DownloadsTotalCount githubv4.Int
-                }
-                Versions struct {
-                    Nodes []struct {
-                        ID        githubv4.ID
-                        Version   githubv4.String
-                        Files struct {
-                            Nodes []struct {
-                                Name   githubv4.String
-                                Size   githubv4.Int
-                                SHA256 githubv4.String
-                                URL    githubv4.URI
-                            }
-                        } `graphql:"files(first: 100)"`
-                        Metadata struct {
-                            PackageType githubv4.String
-                        }
-                        CreatedAt githubv4.DateTime
-                        UpdatedAt githubv4.DateTime
-                    }
-                } `graphql:"versions(first: 100)"`
-            }
+            Nodes []packageNode
         } `graphql:"packages(first: $first, after: $after, packageType: $packageType)"`
     } `graphql:"organization(login: $login)"`
 }
 
+type packageNode struct {
+    ID          githubv4.ID
+    Name        githubv4.String
+    PackageType githubv4.String
+    Repository  struct {
+        Name          githubv4.String
+        NameWithOwner githubv4.String
+        URL           githubv4.String
+    }
+    Statistics struct {
+        DownloadsTotalCount githubv4.Int
+    }
+    Versions struct {
+        Nodes []versionNode
+    } `graphql:"versions(first: 100)"`
+}
+
+type versionNode struct {
+    ID      githubv4.ID
+    Version githubv4.String
+    Files   struct {
+        Nodes []fileNode
+    } `graphql:"files(first: 100)"`
+    PreRelease githubv4.Boolean
+    Platform   githubv4.String
+    Summary    githubv4.String
+    CreatedAt  githubv4.DateTime
+    UpdatedAt  githubv4.DateTime
+}
+
+type fileNode struct {
+    Name   githubv4.String
+    Size   githubv4.Int
+    SHA256 githubv4.String
+    URL    githubv4.URI
+}
+
 func (a *API) GetOrganizationPackages(org, packageType string) ([]Package, error) {
+    // Custom package types are listed by their external handler
+    if handler, ok := extension.Lookup(packageType); ok {
+        return a.getHandlerPackages(handler, org)
+    }
+
+    // Some types live in an external registry rather than GitHub Packages
+    switch pkg.PackageType(packageType) {
+    case pkg.PackageTypeCargo:
+        return a.getCargoPackages()
+    case pkg.PackageTypeGo:
+        return a.getGoModules()
+    case pkg.PackageTypeDeb:
+        return a.getDebPackages()
+    case pkg.PackageTypeRPM:
+        return a.getRPMPackages()
+    case pkg.PackageTypeComposer:
+        return a.getComposerPackages()
+    case pkg.PackageTypeTerraform:
+        return a.getTerraformPackages(org)
+    case pkg.PackageTypeConda:
+        return a.getCondaPackages()
+    case pkg.PackageTypeSwift:
+        return a.getSwiftPackages()
+    case pkg.PackageTypeCocoaPods:
+        return a.getCocoaPods()
+    case pkg.PackageTypeGeneric:
+        return a.getGenericPackages()
+    }
+
     var query PackageQuery
     variables := map[string]interface{}{
         "login": githubv4.String(org),
@@ -130,42 +287,7 @@ func (a *API) GetOrganizationPackages(org, packageType string) ([]Package, error
 
         // Process packages from the current page
         for _, node := range query.Organization.Packages.Nodes {
-            pkg := Package{
-                ID:          string(node.ID.(string)),
-                Name:        string(node.Name),
-                PackageType: string(node.PackageType),
-                Repository: &Repository{
-                    Name: string(node.Repository.Name),
-                    URL:  string(node.Repository.URL),
-                },
-                Statistics: &Statistics{
-                    DownloadsCount: int(node.Statistics.DownloadsTotalCount),
-                },
-            }
-
-            // Process versions
-            for _, ver := range node.Versions.Nodes {
-                version := Version{
-                    ID:        string(ver.ID.(string)),
-                    Name:      string(ver.Version),
-                    CreatedAt: ver.CreatedAt.String(),
-                    UpdatedAt: ver.UpdatedAt.String(),
-                }
-
-                // Process files
-                for _, file := range ver.Files.Nodes {
-                    version.Files = append(version.Files, File{
-                        Name:   string(file.Name),
-                        Size:   int(file.Size),
-                        SHA256: string(file.SHA256),
-                        URL:    string(file.URL),
-                    })
-                }
-
-                pkg.Versions = append(pkg.Versions, version)
-            }
-
-            packages = append(packages, pkg)
+            packages = append(packages, packageFromNode(node))
         }
 
         // Check if there are more pages
@@ -177,39 +299,48 @@ func (a *API) GetOrganizationPackages(org, packageType string) ([]Package, error
         variables["after"] = githubv4.String(query.Organization.Packages.PageInfo.EndCursor)
     }
 
+    // Visibility, owner and version metadata only come from REST
+    if err := a.fillPackageDetails(org, packageType, packages); err != nil {
+        return nil, err
+    }
+
     return packages, nil
 }
 
-// Additional types moved from package/package.go
-type Package struct {
-    ID          string
-    Name        string
-    PackageType string
-    Repository  *Repository
-    Statistics  *Statistics
-    Versions    []Version
-}
+func (a *API) getHandlerPackages(handler *extension.Handler, org string) ([]Package, error) {
+    listed, err := handler.List(a.ctx, a.token, extension.Request{
+        Organization: org,
+        Hostname:     a.hostname,
+    })
+    if err != nil {
+        return nil, fmt.Errorf("failed to list %s packages: %v", handler.Type, err)
+    }
 
-type Version struct {
-    ID        string
-    Name      string
-    Files     []File
-    CreatedAt string
-    UpdatedAt string
-}
+    // Handlers speak the domain model already, only fill what they left out
+    for i := range listed {
+        if listed[i].Repository == nil {
+            listed[i].Repository = &Repository{}
+        }
+        if listed[i].Statistics == nil {
+            listed[i].Statistics = &Statistics{}
+        }
+    }
 
-type File struct {
-    Name   string
-    Size   int
-    SHA256 string
-    URL    string
+    return listed, nil
 }
 
-type Repository struct {
-    Name string
-    URL  string
-}
+// The API layer works on the pkg/package domain model directly, so nothing
+// the source reports is lost between listing and migrating
+type (
+    Package    = pkg.Package
+    Version    = pkg.Version
+    File       = pkg.File
+    Owner      = pkg.Owner
+    Repository = pkg.Repository
+    Statistics = pkg.Statistics
+)
 
-type Statistics struct {
-    DownloadsCount int
-}
+const (
+    PackageStatusActive = pkg.PackageStatusActive
+    PackageStatusEmpty  = pkg.PackageStatusEmpty
+)
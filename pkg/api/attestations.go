@@ -0,0 +1,23 @@
+package api
+
+import (
+    "fmt"
+    "net/url"
+)
+
+// CreateAttestation stores a Sigstore bundle as an artifact attestation of
+// a repository, and returns the attestation's ID. The token needs write
+// access to the repository's attestations
+func (a *API) CreateAttestation(owner, repo string, bundle interface{}) (int64, error) {
+    attestationsURL := fmt.Sprintf("%s/repos/%s/%s/attestations",
+        a.restBaseURL(), url.PathEscape(owner), url.PathEscape(repo))
+
+    var created struct {
+        ID int64 `json:"id"`
+    }
+    in := map[string]interface{}{"bundle": bundle}
+    if err := a.restJSON("POST", attestationsURL, in, &created); err != nil {
+        return 0, fmt.Errorf("failed to create attestation in %s/%s: %v", owner, repo, err)
+    }
+    return created.ID, nil
+}
@@ -0,0 +1,439 @@
+package api
+
+import (
+    "archive/tar"
+    "bytes"
+    "compress/gzip"
+    "encoding/binary"
+    "encoding/json"
+    "fmt"
+    "io"
+    "net/http"
+    "net/url"
+    "os"
+    "path"
+    "sort"
+    "strings"
+
+    "github.com/pelletier/go-toml/v2"
+    "github.com/cvega/gh-migrate-packages/pkg/package"
+)
+
+// Cargo.toml [package] fields needed to publish a crate
+type CargoManifest struct {
+    Name         string
+    Version      string
+    Authors      []string
+    Description  string
+    License      string
+    Repository   string
+    Dependencies []CargoDependency
+    Features     map[string][]string
+}
+
+type CargoDependency struct {
+    Name               string   `json:"name"`
+    VersionReq         string   `json:"version_req"`
+    Features           []string `json:"features"`
+    Optional           bool     `json:"optional"`
+    DefaultFeatures    bool     `json:"default_features"`
+    Target             *string  `json:"target"`
+    Kind               string   `json:"kind"`
+    Registry           *string  `json:"registry,omitempty"`              // index of a registry other than the target's
+    ExplicitNameInToml *string  `json:"explicit_name_in_toml,omitempty"` // when renamed with package = "..."
+}
+
+// Publish metadata sent ahead of the .crate bytes to /api/v1/crates/new
+type cargoPublishMetadata struct {
+    Name        string              `json:"name"`
+    Vers        string              `json:"vers"`
+    Deps        []CargoDependency   `json:"deps"`
+    Features    map[string][]string `json:"features"`
+    Authors     []string            `json:"authors"`
+    Description string              `json:"description,omitempty"`
+    License     string              `json:"license,omitempty"`
+    Repository  string              `json:"repository,omitempty"`
+}
+
+// parseCrate reads Cargo.toml out of a .crate archive (a gzipped tarball)
+func parseCrate(crateFile string) (*CargoManifest, error) {
+    file, err := os.Open(crateFile)
+    if err != nil {
+        return nil, fmt.Errorf("failed to open crate: %v", err)
+    }
+    defer file.Close()
+
+    gz, err := gzip.NewReader(file)
+    if err != nil {
+        return nil, fmt.Errorf("crate is not a gzip archive: %v", err)
+    }
+    defer gz.Close()
+
+    tr := tar.NewReader(gz)
+    for {
+        header, err := tr.Next()
+        if err == io.EOF {
+            break
+        }
+        if err != nil {
+            return nil, fmt.Errorf("failed to read crate: %v", err)
+        }
+
+        // Cargo.toml lives at <name>-<version>/Cargo.toml
+        if strings.Count(header.Name, "/") == 1 && path.Base(header.Name) == "Cargo.toml" {
+            manifest, err := parseCargoToml(tr)
+            if err != nil {
+                return nil, err
+            }
+            if manifest.Name == "" {
+                return nil, fmt.Errorf("Cargo.toml missing required field: name")
+            }
+            if manifest.Version == "" {
+                return nil, fmt.Errorf("Cargo.toml missing required field: version")
+            }
+            return manifest, nil
+        }
+    }
+
+    return nil, fmt.Errorf("no Cargo.toml found in crate")
+}
+
+// cargoToml is the part of a Cargo.toml that goes into publish metadata
+type cargoToml struct {
+    Package struct {
+        Name        string   `toml:"name"`
+        Version     string   `toml:"version"`
+        Authors     []string `toml:"authors"`
+        Description string   `toml:"description"`
+        License     string   `toml:"license"`
+        Repository  string   `toml:"repository"`
+    } `toml:"package"`
+    Features map[string][]string `toml:"features"`
+    cargoDependencyTables
+    Target map[string]cargoDependencyTables `toml:"target"` // by cfg() expression or target triple
+}
+
+type cargoDependencyTables struct {
+    Dependencies      map[string]interface{} `toml:"dependencies"`
+    DevDependencies   map[string]interface{} `toml:"dev-dependencies"`
+    BuildDependencies map[string]interface{} `toml:"build-dependencies"`
+}
+
+// parseCargoToml reads the package fields, the features, and every
+// dependency table, platform specific ones included
+func parseCargoToml(r io.Reader) (*CargoManifest, error) {
+    var doc cargoToml
+    if err := toml.NewDecoder(r).Decode(&doc); err != nil {
+        return nil, fmt.Errorf("failed to parse Cargo.toml: %v", err)
+    }
+
+    manifest := &CargoManifest{
+        Name:         doc.Package.Name,
+        Version:      doc.Package.Version,
+        Authors:      doc.Package.Authors,
+        Description:  doc.Package.Description,
+        License:      doc.Package.License,
+        Repository:   doc.Package.Repository,
+        Features:     doc.Features,
+        Dependencies: []CargoDependency{},
+    }
+    if manifest.Features == nil {
+        manifest.Features = map[string][]string{}
+    }
+
+    if err := manifest.addDependencies(doc.cargoDependencyTables, nil); err != nil {
+        return nil, err
+    }
+    targets := make([]string, 0, len(doc.Target))
+    for target := range doc.Target {
+        targets = append(targets, target)
+    }
+    sort.Strings(targets)
+    for _, target := range targets {
+        target := target
+        if err := manifest.addDependencies(doc.Target[target], &target); err != nil {
+            return nil, err
+        }
+    }
+
+    return manifest, nil
+}
+
+// addDependencies adds the normal, dev, and build dependencies of tables,
+// for target when it is set
+func (m *CargoManifest) addDependencies(tables cargoDependencyTables, target *string) error {
+    for _, kind := range []struct {
+        name  string
+        table map[string]interface{}
+    }{{"normal", tables.Dependencies}, {"dev", tables.DevDependencies}, {"build", tables.BuildDependencies}} {
+        names := make([]string, 0, len(kind.table))
+        for name := range kind.table {
+            names = append(names, name)
+        }
+        sort.Strings(names)
+
+        for _, name := range names {
+            dep, err := parseCargoDependency(name, kind.table[name])
+            if err != nil {
+                return err
+            }
+            dep.Kind = kind.name
+            dep.Target = target
+            m.Dependencies = append(m.Dependencies, dep)
+        }
+    }
+    return nil
+}
+
+// parseCargoDependency reads a dependency given as a version requirement,
+// name = "1.0", or as a table of version, features, optional, and so on
+func parseCargoDependency(name string, value interface{}) (CargoDependency, error) {
+    dep := CargoDependency{Name: name, DefaultFeatures: true, Features: []string{}}
+
+    switch spec := value.(type) {
+    case string:
+        dep.VersionReq = spec
+    case map[string]interface{}:
+        for key, field := range spec {
+            var ok bool
+            switch key {
+            case "version":
+                dep.VersionReq, ok = field.(string)
+            case "optional":
+                dep.Optional, ok = field.(bool)
+            case "default-features", "default_features":
+                dep.DefaultFeatures, ok = field.(bool)
+            case "features":
+                var features []interface{}
+                if features, ok = field.([]interface{}); ok {
+                    for _, feature := range features {
+                        f, isString := feature.(string)
+                        if !isString {
+                            ok = false
+                            break
+                        }
+                        dep.Features = append(dep.Features, f)
+                    }
+                }
+            case "package":
+                // Renamed: the crate is package, the manifest calls it name
+                var crate string
+                if crate, ok = field.(string); ok {
+                    explicit := name
+                    dep.Name, dep.ExplicitNameInToml = crate, &explicit
+                }
+            case "registry-index":
+                var index string
+                if index, ok = field.(string); ok {
+                    dep.Registry = &index
+                }
+            default:
+                // path, git, registry names, and the like aren't published
+                ok = true
+            }
+            if !ok {
+                return dep, fmt.Errorf("Cargo.toml dependency %s has an invalid %s", name, key)
+            }
+        }
+    default:
+        return dep, fmt.Errorf("Cargo.toml dependency %s is neither a version nor a table", name)
+    }
+
+    if dep.VersionReq == "" {
+        dep.VersionReq = "*"
+    }
+    return dep, nil
+}
+
+func (a *API) uploadCargo(opts UploadOptions) error {
+    var crateFile string
+    for _, file := range opts.Files {
+        if strings.HasSuffix(file, ".crate") {
+            crateFile = file
+            break
+        }
+    }
+
+    if crateFile == "" {
+        return fmt.Errorf("missing required .crate file")
+    }
+
+    registry, err := a.registryURL("cargo")
+    if err != nil {
+        return err
+    }
+
+    manifest, err := parseCrate(crateFile)
+    if err != nil {
+        return err
+    }
+
+    // The registry checks the name against the Cargo.toml inside the crate,
+    // which can't be rewritten without changing its checksum
+    if manifest.Name != opts.PackageName {
+        return fmt.Errorf("crate %s can't be published as %s: its Cargo.toml keeps the original name", manifest.Name, opts.PackageName)
+    }
+
+    crate, err := os.ReadFile(crateFile)
+    if err != nil {
+        return fmt.Errorf("failed to read crate: %v", err)
+    }
+
+    validator := &pkg.CargoValidator{MaxFileSize: a.cargoMaxCrate}
+    if int64(len(crate)) > validator.GetMaxFileSize() {
+        return fmt.Errorf("crate %s %s is %d bytes, over the registry limit of %d; raise it with --cargo-max-crate-size", opts.PackageName, opts.Version, len(crate), validator.GetMaxFileSize())
+    }
+
+    metadata, err := json.Marshal(cargoPublishMetadata{
+        Name:        manifest.Name,
+        Vers:        manifest.Version,
+        Deps:        manifest.Dependencies,
+        Features:    manifest.Features,
+        Authors:     manifest.Authors,
+        Description: manifest.Description,
+        License:     manifest.License,
+        Repository:  manifest.Repository,
+    })
+    if err != nil {
+        return fmt.Errorf("failed to marshal publish metadata: %v", err)
+    }
+
+    // Publish body: u32 metadata length, metadata, u32 crate length, crate
+    body := &bytes.Buffer{}
+    binary.Write(body, binary.LittleEndian, uint32(len(metadata)))
+    body.Write(metadata)
+    binary.Write(body, binary.LittleEndian, uint32(len(crate)))
+    body.Write(crate)
+
+    req, err := http.NewRequestWithContext(a.ctx, "PUT", registry+"/api/v1/crates/new", body)
+    if err != nil {
+        return err
+    }
+
+    // Cargo registries take the raw token, without a scheme
+    a.setRegistryAuth(req, "cargo", "")
+    req.Header.Set("Content-Type", "application/octet-stream")
+
+    resp, err := a.client.Do(req)
+    if err != nil {
+        return err
+    }
+    defer resp.Body.Close()
+
+    if resp.StatusCode != http.StatusOK {
+        return fmt.Errorf("cargo publish failed with status: %s", resp.Status)
+    }
+
+    // Registries report publish errors in a 200 response body
+    var result struct {
+        Errors []struct {
+            Detail string `json:"detail"`
+        } `json:"errors"`
+    }
+    if err := json.NewDecoder(resp.Body).Decode(&result); err == nil && len(result.Errors) > 0 {
+        if strings.Contains(result.Errors[0].Detail, "already exists") {
+            return &ErrVersionExists{PackageName: opts.PackageName, Version: opts.Version}
+        }
+        return fmt.Errorf("cargo publish failed: %s", result.Errors[0].Detail)
+    }
+
+    return nil
+}
+
+// getCargoPackages lists crates and their versions through the registry web API
+func (a *API) getCargoPackages() ([]Package, error) {
+    registry, err := a.registryURL("cargo")
+    if err != nil {
+        return nil, err
+    }
+
+    var packages []Package
+    for page := 1; ; page++ {
+        var listing struct {
+            Crates []struct {
+                Name string `json:"name"`
+            } `json:"crates"`
+        }
+        listURL := fmt.Sprintf("%s/api/v1/crates?page=%d&per_page=100", registry, page)
+        if err := a.getRegistryJSON("cargo", listURL, &listing); err != nil {
+            return nil, fmt.Errorf("failed to list crates: %v", err)
+        }
+
+        if len(listing.Crates) == 0 {
+            break
+        }
+
+        for _, crate := range listing.Crates {
+            var detail struct {
+                Versions []struct {
+                    ID        int    `json:"id"`
+                    Num       string `json:"num"`
+                    DlPath    string `json:"dl_path"`
+                    Checksum  string `json:"checksum"`
+                    CrateSize int    `json:"crate_size"`
+                    Yanked    bool   `json:"yanked"`
+                    CreatedAt string `json:"created_at"`
+                    UpdatedAt string `json:"updated_at"`
+                } `json:"versions"`
+            }
+            detailURL := fmt.Sprintf("%s/api/v1/crates/%s", registry, url.PathEscape(crate.Name))
+            if err := a.getRegistryJSON("cargo", detailURL, &detail); err != nil {
+                return nil, fmt.Errorf("failed to get crate %s: %v", crate.Name, err)
+            }
+
+            p := Package{
+                ID:          crate.Name,
+                Name:        crate.Name,
+                PackageType: "cargo",
+                Repository:  &Repository{},
+                Statistics:  &Statistics{},
+            }
+
+            for _, v := range detail.Versions {
+                // Yanked versions cannot be republished as resolvable releases
+                if v.Yanked {
+                    continue
+                }
+                p.Versions = append(p.Versions, Version{
+                    ID:        fmt.Sprintf("%d", v.ID),
+                    Name:      v.Num,
+                    CreatedAt: v.CreatedAt,
+                    UpdatedAt: v.UpdatedAt,
+                    Files: []File{{
+                        Name:   fmt.Sprintf("%s-%s.crate", crate.Name, v.Num),
+                        Size:   v.CrateSize,
+                        SHA256: v.Checksum,
+                        URL:    registry + v.DlPath,
+                    }},
+                })
+            }
+
+            packages = append(packages, p)
+        }
+    }
+
+    return packages, nil
+}
+
+// getRegistryJSON reads url from the registry of packageType, with that
+// registry's token
+func (a *API) getRegistryJSON(packageType, url string, out interface{}) error {
+    req, err := http.NewRequestWithContext(a.ctx, "GET", url, nil)
+    if err != nil {
+        return err
+    }
+    a.setRegistryAuth(req, packageType, registryScheme(packageType))
+    req.Header.Set("Accept", "application/json")
+
+    resp, err := a.client.Do(req)
+    if err != nil {
+        return err
+    }
+    defer resp.Body.Close()
+
+    if resp.StatusCode != http.StatusOK {
+        return fmt.Errorf("request failed with status: %s", resp.Status)
+    }
+
+    return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,175 @@
+package api
+
+import (
+    "crypto/md5"
+    "crypto/sha1"
+    "crypto/sha256"
+    "crypto/sha512"
+    "fmt"
+    "hash"
+    "io"
+    "os"
+    "sync"
+    "time"
+)
+
+// Digests each registry needs on upload, computed while a file downloads so
+// it is never read again just to hash it
+var digestAlgorithms = map[string][]string{
+    "npm":       {"sha512", "sha1"},
+    "maven":     {"md5", "sha1", "sha256", "sha512"},
+    "container": {"sha256"},
+    "generic":   {"sha256"},
+    "terraform": {"sha256"},
+}
+
+// MultiHash computes several digests of one stream in a single pass
+type MultiHash struct {
+    io.Writer
+    hashes map[string]hash.Hash
+}
+
+func NewMultiHash(algorithms ...string) (*MultiHash, error) {
+    m := &MultiHash{hashes: make(map[string]hash.Hash)}
+    var writers []io.Writer
+    for _, algorithm := range algorithms {
+        if _, exists := m.hashes[algorithm]; exists {
+            continue
+        }
+        h, err := newHash(algorithm)
+        if err != nil {
+            return nil, err
+        }
+        m.hashes[algorithm] = h
+        writers = append(writers, h)
+    }
+    m.Writer = io.MultiWriter(writers...)
+    return m, nil
+}
+
+// Digests returns the hex digest of everything written so far, by algorithm
+func (m *MultiHash) Digests() map[string]string {
+    digests := make(map[string]string, len(m.hashes))
+    for algorithm, h := range m.hashes {
+        digests[algorithm] = fmt.Sprintf("%x", h.Sum(nil))
+    }
+    return digests
+}
+
+func newHash(algorithm string) (hash.Hash, error) {
+    if FIPS() && legacyAlgorithms[algorithm] {
+        return nil, fmt.Errorf("%s hashes can't be computed in FIPS mode", algorithm)
+    }
+    switch algorithm {
+    case "md5":
+        return md5.New(), nil
+    case "sha1":
+        return sha1.New(), nil
+    case "sha256":
+        return sha256.New(), nil
+    case "sha512":
+        return sha512.New(), nil
+    }
+    return nil, fmt.Errorf("unsupported hash algorithm: %s", algorithm)
+}
+
+// cachedDigests are only trusted while the file is unchanged, since
+// transform plugins may rewrite it after download
+type cachedDigests struct {
+    size    int64
+    modTime time.Time
+    digests map[string]string
+}
+
+var digestCache sync.Map // path -> *cachedDigests
+
+// rememberDigests caches digests computed for path
+func rememberDigests(path string, digests map[string]string) {
+    info, err := os.Stat(path)
+    if err != nil {
+        return
+    }
+
+    merged := make(map[string]string, len(digests))
+    if cached, ok := lookupDigests(path, info); ok {
+        for algorithm, digest := range cached.digests {
+            merged[algorithm] = digest
+        }
+    }
+    for algorithm, digest := range digests {
+        merged[algorithm] = digest
+    }
+    digestCache.Store(path, &cachedDigests{size: info.Size(), modTime: info.ModTime(), digests: merged})
+}
+
+func lookupDigests(path string, info os.FileInfo) (*cachedDigests, bool) {
+    value, ok := digestCache.Load(path)
+    if !ok {
+        return nil, false
+    }
+    cached := value.(*cachedDigests)
+    if cached.size != info.Size() || !cached.modTime.Equal(info.ModTime()) {
+        return nil, false
+    }
+    return cached, true
+}
+
+// fileDigests returns the hex digests of a file for each algorithm, reusing
+// those computed during download and reading the file at most once for the rest
+func fileDigests(path string, algorithms ...string) (map[string]string, error) {
+    info, err := os.Stat(path)
+    if err != nil {
+        return nil, fmt.Errorf("failed to open file: %v", err)
+    }
+
+    digests := make(map[string]string, len(algorithms))
+    var missing []string
+    cached, _ := lookupDigests(path, info)
+    for _, algorithm := range algorithms {
+        if cached != nil && cached.digests[algorithm] != "" {
+            digests[algorithm] = cached.digests[algorithm]
+        } else {
+            missing = append(missing, algorithm)
+        }
+    }
+    if len(missing) == 0 {
+        return digests, nil
+    }
+
+    m, err := NewMultiHash(missing...)
+    if err != nil {
+        return nil, err
+    }
+
+    file, err := os.Open(path)
+    if err != nil {
+        return nil, fmt.Errorf("failed to open file: %v", err)
+    }
+    defer file.Close()
+
+    if _, err := io.Copy(m, file); err != nil {
+        return nil, fmt.Errorf("failed to calculate hash: %v", err)
+    }
+
+    computed := m.Digests()
+    rememberDigests(path, computed)
+    for algorithm, digest := range computed {
+        digests[algorithm] = digest
+    }
+    return digests, nil
+}
+
+// calculateFileHash returns the hex digest of a file for the named algorithm
+func calculateFileHash(path, algorithm string) (string, error) {
+    digests, err := fileDigests(path, algorithm)
+    if err != nil {
+        return "", err
+    }
+    return digests[algorithm], nil
+}
+
+// FileSHA256 returns the hex SHA-256 of a file, reusing the digest computed
+// while it downloaded when the file hasn't changed since
+func FileSHA256(path string) (string, error) {
+    return calculateFileHash(path, "sha256")
+}
@@ -0,0 +1,169 @@
+package api
+
+import (
+    "bufio"
+    "bytes"
+    "crypto/md5"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "os"
+    "strings"
+)
+
+// Podspec fields checked before publishing
+type Podspec struct {
+    Name    string `json:"name"`
+    Version string `json:"version"`
+}
+
+// podShard returns the CDN shard of a pod: the first three hex digits of
+// the md5 of its name, e.g. ["f", "2", "a"]. The CDN layout mandates MD5,
+// so FIPS mode can't list pods
+func podShard(name string) []string {
+    sum := fmt.Sprintf("%x", md5.Sum([]byte(name)))
+    return []string{sum[0:1], sum[1:2], sum[2:3]}
+}
+
+// getCocoaPods lists pods from a CDN-layout spec repository
+// (all_pods_versions_*.txt shards and Specs/<shard>/<pod>/<version>/)
+func (a *API) getCocoaPods() ([]Package, error) {
+    if FIPS() {
+        return nil, fmt.Errorf("cocoapods can't be listed in FIPS mode, the CDN shards pods by the MD5 of their name")
+    }
+
+    cdn, err := a.registryURL("cocoapods")
+    if err != nil {
+        return nil, err
+    }
+
+    var packages []Package
+    hex := "0123456789abcdef"
+    for _, a1 := range hex {
+        for _, a2 := range hex {
+            for _, a3 := range hex {
+                shardURL := fmt.Sprintf("%s/all_pods_versions_%c_%c_%c.txt", cdn, a1, a2, a3)
+                pods, err := a.getPodShard(cdn, shardURL)
+                if err != nil {
+                    return nil, err
+                }
+                packages = append(packages, pods...)
+            }
+        }
+    }
+
+    return packages, nil
+}
+
+func (a *API) getPodShard(cdn, shardURL string) ([]Package, error) {
+    req, err := http.NewRequestWithContext(a.ctx, "GET", shardURL, nil)
+    if err != nil {
+        return nil, err
+    }
+
+    resp, err := a.client.Do(req)
+    if err != nil {
+        return nil, fmt.Errorf("failed to fetch pod shard: %v", err)
+    }
+    defer resp.Body.Close()
+
+    // Empty shards are not published
+    if resp.StatusCode == http.StatusNotFound {
+        return nil, nil
+    }
+    if resp.StatusCode != http.StatusOK {
+        return nil, fmt.Errorf("pod shard request failed with status: %s", resp.Status)
+    }
+
+    var packages []Package
+    scanner := bufio.NewScanner(resp.Body)
+    for scanner.Scan() {
+        // Each line is Name/1.0.0/1.1.0
+        fields := strings.Split(strings.TrimSpace(scanner.Text()), "/")
+        if len(fields) < 2 || fields[0] == "" {
+            continue
+        }
+
+        name := fields[0]
+        shard := strings.Join(podShard(name), "/")
+        p := Package{
+            ID:          name,
+            Name:        name,
+            PackageType: "cocoapods",
+            Repository:  &Repository{},
+            Statistics:  &Statistics{},
+        }
+        for _, version := range fields[1:] {
+            p.Versions = append(p.Versions, Version{
+                ID:   name + "@" + version,
+                Name: version,
+                Files: []File{{
+                    Name: name + ".podspec.json",
+                    URL:  fmt.Sprintf("%s/Specs/%s/%s/%s/%s.podspec.json", cdn, shard, name, version, name),
+                }},
+            })
+        }
+        packages = append(packages, p)
+    }
+
+    return packages, scanner.Err()
+}
+
+// uploadCocoaPod pushes a podspec with the trunk API (POST /api/v1/pods)
+func (a *API) uploadCocoaPod(opts UploadOptions) error {
+    var specFile string
+    for _, file := range opts.Files {
+        if strings.HasSuffix(file, ".podspec.json") {
+            specFile = file
+            break
+        }
+    }
+
+    if specFile == "" {
+        return fmt.Errorf("missing required .podspec.json file")
+    }
+
+    registry, err := a.registryURL("cocoapods")
+    if err != nil {
+        return err
+    }
+
+    data, err := os.ReadFile(specFile)
+    if err != nil {
+        return fmt.Errorf("failed to read podspec: %v", err)
+    }
+
+    var spec Podspec
+    if err := json.Unmarshal(data, &spec); err != nil {
+        return fmt.Errorf("failed to parse podspec: %v", err)
+    }
+    if spec.Version != opts.Version {
+        return fmt.Errorf("version mismatch: podspec has %s, expected %s", spec.Version, opts.Version)
+    }
+    if spec.Name != opts.PackageName {
+        return fmt.Errorf("name mismatch: podspec has %s, expected %s", spec.Name, opts.PackageName)
+    }
+
+    req, err := http.NewRequestWithContext(a.ctx, "POST", registry+"/api/v1/pods", bytes.NewReader(data))
+    if err != nil {
+        return err
+    }
+
+    req.Header.Set("Content-Type", "application/json; charset=utf-8")
+    a.setRegistryAuth(req, "cocoapods", "Token")
+
+    resp, err := a.client.Do(req)
+    if err != nil {
+        return err
+    }
+    defer resp.Body.Close()
+
+    switch resp.StatusCode {
+    case http.StatusCreated, http.StatusOK, http.StatusFound:
+        return nil
+    case http.StatusConflict:
+        return &ErrVersionExists{PackageName: opts.PackageName, Version: opts.Version}
+    default:
+        return fmt.Errorf("podspec push failed with status: %s", resp.Status)
+    }
+}
@@ -0,0 +1,196 @@
+package api
+
+import (
+    "archive/zip"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "net/url"
+    "os"
+    "path"
+    "strings"
+)
+
+// composer.json fields needed to publish a dist archive
+type ComposerManifest struct {
+    Name    string `json:"name"`
+    Version string `json:"version,omitempty"`
+    Type    string `json:"type,omitempty"`
+}
+
+// A version entry in Composer repository metadata
+type composerVersion struct {
+    Name    string `json:"name"`
+    Version string `json:"version"`
+    Time    string `json:"time"`
+    Dist    struct {
+        Type   string `json:"type"`
+        URL    string `json:"url"`
+        Shasum string `json:"shasum"`
+    } `json:"dist"`
+}
+
+// parseComposerArchive reads composer.json from the root of a dist archive.
+// Archives built from VCS tags often wrap the sources in one top directory.
+func parseComposerArchive(archive string) (*ComposerManifest, error) {
+    reader, err := zip.OpenReader(archive)
+    if err != nil {
+        return nil, fmt.Errorf("failed to open dist archive: %v", err)
+    }
+    defer reader.Close()
+
+    var manifestFile *zip.File
+    for _, file := range reader.File {
+        if file.Name == "composer.json" || (strings.Count(file.Name, "/") == 1 && path.Base(file.Name) == "composer.json") {
+            manifestFile = file
+            break
+        }
+    }
+
+    if manifestFile == nil {
+        return nil, fmt.Errorf("no composer.json found in dist archive")
+    }
+
+    rc, err := manifestFile.Open()
+    if err != nil {
+        return nil, fmt.Errorf("failed to open composer.json: %v", err)
+    }
+    defer rc.Close()
+
+    var manifest ComposerManifest
+    if err := json.NewDecoder(rc).Decode(&manifest); err != nil {
+        return nil, fmt.Errorf("failed to parse composer.json: %v", err)
+    }
+
+    if manifest.Name == "" {
+        return nil, fmt.Errorf("composer.json missing required field: name")
+    }
+
+    return &manifest, nil
+}
+
+// getComposerPackages lists packages from a Composer repository. Inline
+// (v1) package maps are used when present, otherwise each package listed
+// in available-packages is resolved through the v2 metadata-url.
+func (a *API) getComposerPackages() ([]Package, error) {
+    base, err := a.registryURL("composer")
+    if err != nil {
+        return nil, err
+    }
+
+    var root struct {
+        Packages          map[string]map[string]composerVersion `json:"packages"`
+        MetadataURL       string                                `json:"metadata-url"`
+        AvailablePackages []string                              `json:"available-packages"`
+    }
+    if err := a.getRegistryJSON("composer", base+"/packages.json", &root); err != nil {
+        return nil, fmt.Errorf("failed to read packages.json: %v", err)
+    }
+
+    versionsByName := make(map[string][]composerVersion)
+    var names []string
+    for name, versions := range root.Packages {
+        names = append(names, name)
+        for _, v := range versions {
+            versionsByName[name] = append(versionsByName[name], v)
+        }
+    }
+
+    if len(names) == 0 && root.MetadataURL != "" {
+        for _, name := range root.AvailablePackages {
+            var meta struct {
+                Packages map[string][]composerVersion `json:"packages"`
+            }
+            metaURL := resolveURL(base+"/", strings.Replace(root.MetadataURL, "%package%", name, 1))
+            if err := a.getRegistryJSON("composer", metaURL, &meta); err != nil {
+                return nil, fmt.Errorf("failed to read metadata for %s: %v", name, err)
+            }
+            names = append(names, name)
+            versionsByName[name] = meta.Packages[name]
+        }
+    }
+
+    var packages []Package
+    for _, name := range names {
+        p := Package{
+            ID:          name,
+            Name:        name,
+            PackageType: "composer",
+            Repository:  &Repository{},
+            Statistics:  &Statistics{},
+        }
+
+        for _, v := range versionsByName[name] {
+            // Only versions with a downloadable dist archive can be migrated
+            if v.Dist.URL == "" {
+                continue
+            }
+            p.Versions = append(p.Versions, Version{
+                ID:        name + "@" + v.Version,
+                Name:      v.Version,
+                CreatedAt: v.Time,
+                UpdatedAt: v.Time,
+                Files: []File{{
+                    Name: fmt.Sprintf("%s-%s.zip", strings.ReplaceAll(name, "/", "-"), v.Version),
+                    URL:  resolveURL(base+"/", v.Dist.URL),
+                }},
+            })
+        }
+
+        packages = append(packages, p)
+    }
+
+    return packages, nil
+}
+
+// uploadComposer publishes a dist archive to a hosted Composer repository
+// using the /packages/upload/<vendor>/<package>/<version> convention
+func (a *API) uploadComposer(opts UploadOptions) error {
+    var archive string
+    for _, file := range opts.Files {
+        if strings.HasSuffix(file, ".zip") {
+            archive = file
+            break
+        }
+    }
+
+    if archive == "" {
+        return fmt.Errorf("missing required .zip dist archive")
+    }
+
+    base, err := a.registryURL("composer")
+    if err != nil {
+        return err
+    }
+
+    if _, err := parseComposerArchive(archive); err != nil {
+        return err
+    }
+
+    file, err := os.Open(archive)
+    if err != nil {
+        return err
+    }
+    defer file.Close()
+
+    uploadURL := fmt.Sprintf("%s/packages/upload/%s/%s", base, opts.PackageName, url.PathEscape(opts.Version))
+    req, err := http.NewRequestWithContext(a.ctx, "PUT", uploadURL, file)
+    if err != nil {
+        return err
+    }
+
+    req.Header.Set("Content-Type", "application/zip")
+    a.setRegistryAuth(req, "composer", "Bearer")
+
+    resp, err := a.client.Do(req)
+    if err != nil {
+        return err
+    }
+    defer resp.Body.Close()
+
+    if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusNoContent {
+        return fmt.Errorf("composer upload failed with status: %s", resp.Status)
+    }
+
+    return nil
+}
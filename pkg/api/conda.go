@@ -0,0 +1,193 @@
+package api
+
+import (
+    "fmt"
+    "io"
+    "net/http"
+    "os"
+    "path"
+    "path/filepath"
+    "strings"
+
+    "github.com/cvega/gh-migrate-packages/pkg/package"
+)
+
+// A package record in a channel subdir's repodata.json
+type condaRecord struct {
+    Name      string `json:"name"`
+    Version   string `json:"version"`
+    Build     string `json:"build"`
+    Subdir    string `json:"subdir"`
+    SHA256    string `json:"sha256"`
+    Size      int    `json:"size"`
+    Timestamp int64  `json:"timestamp"`
+}
+
+type condaRepodata struct {
+    Packages      map[string]condaRecord `json:"packages"`
+    PackagesConda map[string]condaRecord `json:"packages.conda"`
+}
+
+// condaChannelSubdirs returns the platform subdirs a channel publishes,
+// falling back to probing every known subdir when channeldata.json is absent
+func (a *API) condaChannelSubdirs(channel string) []string {
+    var channeldata struct {
+        Subdirs []string `json:"subdirs"`
+    }
+    if err := a.getRegistryJSON("conda", channel+"/channeldata.json", &channeldata); err == nil && len(channeldata.Subdirs) > 0 {
+        return channeldata.Subdirs
+    }
+    return pkg.CondaSubdirs
+}
+
+// getCondaPackages lists packages from each subdir's repodata.json. Files
+// are named <subdir>/<filename> so the channel layout survives download.
+func (a *API) getCondaPackages() ([]Package, error) {
+    channel, err := a.registryURL("conda")
+    if err != nil {
+        return nil, err
+    }
+
+    byName := make(map[string]*Package)
+    versionIndex := make(map[string]int)
+    var order []string
+
+    for _, subdir := range a.condaChannelSubdirs(channel) {
+        var repodata condaRepodata
+        if err := a.getRegistryJSON("conda", fmt.Sprintf("%s/%s/repodata.json", channel, subdir), &repodata); err != nil {
+            // Channels only publish the subdirs they have packages for
+            continue
+        }
+
+        records := make(map[string]condaRecord)
+        for filename, record := range repodata.Packages {
+            records[filename] = record
+        }
+        for filename, record := range repodata.PackagesConda {
+            records[filename] = record
+        }
+
+        for filename, record := range records {
+            p, ok := byName[record.Name]
+            if !ok {
+                p = &Package{
+                    ID:          record.Name,
+                    Name:        record.Name,
+                    PackageType: "conda",
+                    Repository:  &Repository{},
+                    Statistics:  &Statistics{},
+                }
+                byName[record.Name] = p
+                order = append(order, record.Name)
+            }
+
+            // Builds for every platform are grouped under one version
+            key := record.Name + "@" + record.Version
+            idx, ok := versionIndex[key]
+            if !ok {
+                p.Versions = append(p.Versions, Version{
+                    ID:   key,
+                    Name: record.Version,
+                })
+                idx = len(p.Versions) - 1
+                versionIndex[key] = idx
+            }
+
+            p.Versions[idx].Files = append(p.Versions[idx].Files, File{
+                Name:   subdir + "/" + filename,
+                Size:   record.Size,
+                SHA256: record.SHA256,
+                URL:    fmt.Sprintf("%s/%s/%s", channel, subdir, filename),
+            })
+        }
+    }
+
+    var packages []Package
+    for _, name := range order {
+        packages = append(packages, *byName[name])
+    }
+    return packages, nil
+}
+
+// DownloadCondaRepodata saves the channel metadata of every subdir into dir
+func (a *API) DownloadCondaRepodata(dir string) error {
+    channel, err := a.registryURL("conda")
+    if err != nil {
+        return err
+    }
+
+    for _, subdir := range a.condaChannelSubdirs(channel) {
+        destDir := filepath.Join(dir, subdir)
+        if err := os.MkdirAll(destDir, 0755); err != nil {
+            return fmt.Errorf("failed to create directory: %v", err)
+        }
+
+        err := a.DownloadFile("conda", fmt.Sprintf("%s/%s/repodata.json", channel, subdir), filepath.Join(destDir, "repodata.json"))
+        if err != nil {
+            os.Remove(destDir)
+        }
+    }
+
+    return nil
+}
+
+// uploadConda uploads each build into the target channel under the subdir
+// it was downloaded from
+func (a *API) uploadConda(opts UploadOptions) error {
+    channel, err := a.registryURL("conda")
+    if err != nil {
+        return err
+    }
+
+    uploaded := 0
+    for _, file := range opts.Files {
+        if !strings.HasSuffix(file, ".conda") && !strings.HasSuffix(file, ".tar.bz2") {
+            continue
+        }
+
+        subdir := filepath.Base(filepath.Dir(file))
+        if !pkg.IsCondaSubdir(subdir) {
+            return fmt.Errorf("file %s is not inside a conda platform subdir", file)
+        }
+
+        if err := a.uploadCondaFile(fmt.Sprintf("%s/%s/%s", channel, subdir, path.Base(file)), file); err != nil {
+            return err
+        }
+        uploaded++
+    }
+
+    if uploaded == 0 {
+        return fmt.Errorf("missing required .conda or .tar.bz2 file")
+    }
+
+    return nil
+}
+
+func (a *API) uploadCondaFile(url, path string) error {
+    file, err := os.Open(path)
+    if err != nil {
+        return err
+    }
+    defer file.Close()
+
+    req, err := http.NewRequestWithContext(a.ctx, "PUT", url, file)
+    if err != nil {
+        return err
+    }
+
+    req.Header.Set("Content-Type", "application/octet-stream")
+    a.setRegistryAuth(req, "conda", "Bearer")
+
+    resp, err := a.client.Do(req)
+    if err != nil {
+        return err
+    }
+    defer resp.Body.Close()
+    io.Copy(io.Discard, resp.Body)
+
+    if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+        return fmt.Errorf("conda upload of %s failed with status: %s", filepath.Base(path), resp.Status)
+    }
+
+    return nil
+}
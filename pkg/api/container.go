@@ -9,6 +9,7 @@ import (
     "net/http"
     "os"
     "strings"
+    "sync"
 )
 
 // ContainerManifest represents an OCI compliant container manifest
@@ -38,77 +39,156 @@ const (
     mediaTypeConfig   = "application/vnd.docker.container.image.v1+json"
 )
 
-func (a *API) uploadContainerLayer(baseURL, file string) (string, error) {
-    // Calculate file size and SHA256
-    fileInfo, err := os.Stat(file)
+// layerDigest is the digest the registry stores a layer file by, taken
+// from the one computed while it downloaded when the file is unchanged
+func layerDigest(file string) (string, error) {
+    digests, err := fileDigests(file, "sha256")
     if err != nil {
-        return "", fmt.Errorf("failed to stat file: %v", err)
+        return "", err
     }
+    return "sha256:" + digests["sha256"], nil
+}
 
-    f, err := os.Open(file)
+// checkExists reports whether the registry has url, answering a HEAD
+func (a *API) checkExists(url string) (bool, error) {
+    req, err := http.NewRequestWithContext(a.ctx, "HEAD", url, nil)
     if err != nil {
-        return "", fmt.Errorf("failed to open file: %v", err)
+        return false, err
     }
-    defer f.Close()
+    req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", a.token))
 
-    hash := sha256.New()
-    if _, err := io.Copy(hash, f); err != nil {
-        return "", fmt.Errorf("failed to calculate hash: %v", err)
+    resp, err := a.client.Do(req)
+    if err != nil {
+        return false, err
     }
-    digest := fmt.Sprintf("sha256:%x", hash.Sum(nil))
+    resp.Body.Close()
+
+    switch resp.StatusCode {
+    case http.StatusOK:
+        return true, nil
+    case http.StatusNotFound:
+        return false, nil
+    }
+    return false, fmt.Errorf("existence check for %s failed with status: %s", url, resp.Status)
+}
 
-    // Check if layer already exists
-    checkURL := fmt.Sprintf("%s/blobs/%s", baseURL, digest)
-    exists, err := a.checkExists(checkURL)
+// post sends body to a registry URL, as JSON unless it is nil
+func (a *API) post(url string, body interface{}) (*http.Response, error) {
+    var reader io.Reader
+    if body != nil {
+        data, err := json.Marshal(body)
+        if err != nil {
+            return nil, fmt.Errorf("failed to marshal request: %v", err)
+        }
+        reader = bytes.NewReader(data)
+    }
+
+    req, err := http.NewRequestWithContext(a.ctx, "POST", url, reader)
     if err != nil {
-        return "", err
+        return nil, err
     }
-    if exists {
-        return digest, nil // Layer already exists
+    if body != nil {
+        req.Header.Set("Content-Type", "application/json")
     }
+    req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", a.token))
+    return a.client.Do(req)
+}
+
+// existingBlobs checks every digest with concurrent HEAD requests, at most
+// concurrency at a time, and returns those the registry already has. A
+// re-run against a mostly populated target then waits for one round of
+// checks instead of one per layer. A failed check counts as missing, so
+// the upload that follows reports the real problem
+func (a *API) existingBlobs(baseURL string, digests []string, concurrency int) map[string]bool {
+    if concurrency < 1 {
+        concurrency = 1
+    }
+
+    var mu sync.Mutex
+    var wg sync.WaitGroup
+    existing := make(map[string]bool)
+    sem := make(chan struct{}, concurrency)
+    for _, digest := range digests {
+        wg.Add(1)
+        sem <- struct{}{}
+        go func(digest string) {
+            defer wg.Done()
+            defer func() { <-sem }()
+
+            exists, err := a.checkExists(fmt.Sprintf("%s/blobs/%s", baseURL, digest))
+            if err != nil || !exists {
+                return
+            }
+            mu.Lock()
+            existing[digest] = true
+            mu.Unlock()
+        }(digest)
+    }
+    wg.Wait()
+    return existing
+}
+
+// uploadContainerLayer pushes file as the blob digest; callers check with
+// existingBlobs first
+func (a *API) uploadContainerLayer(baseURL, file, digest string) error {
+    fileInfo, err := os.Stat(file)
+    if err != nil {
+        return fmt.Errorf("failed to stat file: %v", err)
+    }
+
+    f, err := os.Open(file)
+    if err != nil {
+        return fmt.Errorf("failed to open file: %v", err)
+    }
+    defer f.Close()
 
     // Start upload session
     uploadURL := fmt.Sprintf("%s/blobs/uploads/", baseURL)
     resp, err := a.post(uploadURL, nil)
     if err != nil {
-        return "", fmt.Errorf("failed to start upload: %v", err)
+        return fmt.Errorf("failed to start upload: %v", err)
     }
     defer resp.Body.Close()
 
     if resp.StatusCode != http.StatusAccepted {
-        return "", fmt.Errorf("unexpected status starting upload: %s", resp.Status)
+        return fmt.Errorf("unexpected status starting upload: %s", resp.Status)
     }
 
     // Get upload location from header
     location := resp.Header.Get("Location")
     if location == "" {
-        return "", fmt.Errorf("no upload location received")
+        return fmt.Errorf("no upload location received")
     }
 
-    // Upload the layer
-    f.Seek(0, 0) // Reset file pointer to beginning
-    uploadURL = fmt.Sprintf("%s&digest=%s", location, digest)
+    // Upload the layer; registries may answer with a relative location,
+    // with or without a query of its own
+    uploadURL = resolveURL(uploadURL, location)
+    separator := "?"
+    if strings.Contains(uploadURL, "?") {
+        separator = "&"
+    }
+    uploadURL = fmt.Sprintf("%s%sdigest=%s", uploadURL, separator, digest)
     
     req, err := http.NewRequestWithContext(a.ctx, "PUT", uploadURL, f)
     if err != nil {
-        return "", err
+        return err
     }
 
     req.Header.Set("Content-Type", mediaTypeLayer)
     req.Header.Set("Content-Length", fmt.Sprintf("%d", fileInfo.Size()))
     req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", a.token))
 
-    resp, err = http.DefaultClient.Do(req)
+    resp, err = a.client.Do(req)
     if err != nil {
-        return "", fmt.Errorf("failed to upload layer: %v", err)
+        return fmt.Errorf("failed to upload layer: %v", err)
     }
     defer resp.Body.Close()
 
     if resp.StatusCode != http.StatusCreated {
-        return "", fmt.Errorf("layer upload failed with status: %s", resp.Status)
+        return fmt.Errorf("layer upload failed with status: %s", resp.Status)
     }
 
-    return digest, nil
+    return nil
 }
 
 func generateContainerManifest(layers []string, opts UploadOptions) (*ContainerManifest, error) {
@@ -167,6 +247,10 @@ func generateContainerManifest(layers []string, opts UploadOptions) (*ContainerM
             }
         }
     }
+    manifest.Annotations = runAnnotations(manifest.Annotations)
+    if opts.Note != "" {
+        manifest.Annotations[descriptionAnnotation] = annotateDescription(manifest.Annotations[descriptionAnnotation], opts.Note, opts.NotePlacement)
+    }
 
     return manifest, nil
 }
@@ -185,7 +269,7 @@ func (a *API) uploadContainerManifest(url string, manifest *ContainerManifest) e
     req.Header.Set("Content-Type", mediaTypeManifest)
     req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", a.token))
 
-    resp, err := http.DefaultClient.Do(req)
+    resp, err := a.client.Do(req)
     if err != nil {
         return fmt.Errorf("failed to upload manifest: %v", err)
     }
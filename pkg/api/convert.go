@@ -0,0 +1,150 @@
+package api
+
+import (
+    "fmt"
+    "net/url"
+    "strings"
+)
+
+// packageFromNode converts a GraphQL package node to the domain model
+func packageFromNode(node packageNode) Package {
+    p := Package{
+        ID:          fmt.Sprint(node.ID),
+        Name:        string(node.Name),
+        PackageType: string(node.PackageType),
+        Repository: &Repository{
+            Name:     string(node.Repository.Name),
+            FullName: string(node.Repository.NameWithOwner),
+            URL:      string(node.Repository.URL),
+        },
+        Statistics: &Statistics{
+            DownloadsCount: int(node.Statistics.DownloadsTotalCount),
+        },
+    }
+
+    for _, v := range node.Versions.Nodes {
+        p.Versions = append(p.Versions, versionFromNode(v))
+    }
+    return p
+}
+
+func versionFromNode(node versionNode) Version {
+    v := Version{
+        ID:        fmt.Sprint(node.ID),
+        Name:      string(node.Version),
+        CreatedAt: node.CreatedAt.String(),
+        UpdatedAt: node.UpdatedAt.String(),
+        Metadata:  make(map[string]interface{}),
+    }
+
+    if node.PreRelease {
+        v.Metadata["pre_release"] = true
+    }
+    if node.Platform != "" {
+        v.Metadata["platform"] = string(node.Platform)
+    }
+    if node.Summary != "" {
+        v.Metadata["summary"] = string(node.Summary)
+    }
+
+    for _, f := range node.Files.Nodes {
+        v.Files = append(v.Files, File{
+            Name:   string(f.Name),
+            Size:   int(f.Size),
+            SHA256: string(f.SHA256),
+            URL:    f.URL.String(),
+        })
+    }
+    return v
+}
+
+// restPackage is the subset of the REST package object GraphQL lacks
+type restPackage struct {
+    Name       string `json:"name"`
+    Visibility string `json:"visibility"`
+    Owner      struct {
+        Login string `json:"login"`
+        Type  string `json:"type"`
+    } `json:"owner"`
+}
+
+type restVersion struct {
+    Name     string                 `json:"name"`
+    Metadata map[string]interface{} `json:"metadata"`
+}
+
+// fillPackageDetails adds each package's visibility and owner, and for
+// containers the tags of every version, from the REST API
+func (a *API) fillPackageDetails(org, packageType string, packages []Package) error {
+    if len(packages) == 0 {
+        return nil
+    }
+
+    byName := make(map[string]*Package, len(packages))
+    for i := range packages {
+        byName[packages[i].Name] = &packages[i]
+    }
+
+    for page := 1; ; page++ {
+        var listed []restPackage
+        listURL := fmt.Sprintf("%s/orgs/%s/packages?package_type=%s&per_page=100&page=%d",
+            a.restBaseURL(), url.PathEscape(org), url.QueryEscape(strings.ToLower(packageType)), page)
+        if err := a.restJSON("GET", listURL, nil, &listed); err != nil {
+            return fmt.Errorf("failed to list package details: %v", err)
+        }
+
+        for _, r := range listed {
+            if p, ok := byName[r.Name]; ok {
+                p.Visibility = r.Visibility
+                p.Owner = Owner{Login: r.Owner.Login, Type: r.Owner.Type}
+            }
+        }
+        if len(listed) < 100 {
+            break
+        }
+    }
+
+    // Container tags live in version metadata, which GraphQL doesn't expose
+    if packageType != "container" {
+        return nil
+    }
+    for i := range packages {
+        if err := a.fillVersionMetadata(org, &packages[i]); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+func (a *API) fillVersionMetadata(org string, p *Package) error {
+    byName := make(map[string]*Version, len(p.Versions))
+    for i := range p.Versions {
+        byName[p.Versions[i].Name] = &p.Versions[i]
+    }
+
+    for page := 1; ; page++ {
+        var listed []restVersion
+        versionsURL := fmt.Sprintf("%s/orgs/%s/packages/%s/%s/versions?per_page=100&page=%d",
+            a.restBaseURL(), url.PathEscape(org), url.PathEscape(strings.ToLower(p.PackageType)), url.PathEscape(p.Name), page)
+        if err := a.restJSON("GET", versionsURL, nil, &listed); err != nil {
+            return fmt.Errorf("failed to list versions of %s: %v", p.Name, err)
+        }
+
+        for _, r := range listed {
+            v, ok := byName[r.Name]
+            if !ok {
+                continue
+            }
+            if v.Metadata == nil {
+                v.Metadata = make(map[string]interface{})
+            }
+            for key, value := range r.Metadata {
+                v.Metadata[key] = value
+            }
+        }
+        if len(listed) < 100 {
+            break
+        }
+    }
+    return nil
+}
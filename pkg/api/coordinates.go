@@ -0,0 +1,153 @@
+package api
+
+import (
+    "archive/tar"
+    "compress/gzip"
+    "encoding/xml"
+    "fmt"
+    "io"
+    "os"
+    "path/filepath"
+
+    "github.com/cvega/gh-migrate-packages/pkg/package"
+    "gopkg.in/yaml.v3"
+)
+
+// ReadCoordinates returns the name and version a package file declares: an
+// npm package.json, a Maven POM, a NuGet .nupkg, or a RubyGems .gem. Import
+// identifies artifacts that came without export's metadata.json this way.
+// Maven names are groupId.artifactId, as GitHub Packages names them
+func ReadCoordinates(packageType, file string) (string, string, error) {
+    switch pkg.PackageType(packageType) {
+    case pkg.PackageTypeNpm:
+        p, err := parseNPMPackage(file)
+        if err != nil {
+            return "", "", err
+        }
+        return p.Name, p.Version, nil
+    case pkg.PackageTypeMaven:
+        groupID, artifactID, err := parseMavenPOM(file)
+        if err != nil {
+            return "", "", err
+        }
+        version, err := parseMavenVersion(file)
+        if err != nil {
+            return "", "", err
+        }
+        return groupID + "." + artifactID, version, nil
+    case pkg.PackageTypeNuGet:
+        manifest, err := parseNuspec(file)
+        if err != nil {
+            return "", "", err
+        }
+        if manifest.Metadata.ID == "" || manifest.Metadata.Version == "" {
+            return "", "", fmt.Errorf("nuspec missing required field: id or version")
+        }
+        return manifest.Metadata.ID, manifest.Metadata.Version, nil
+    case pkg.PackageTypeRubyGems:
+        return readGemCoordinates(file)
+    }
+    return "", "", fmt.Errorf("can't read the coordinates of %s packages", packageType)
+}
+
+// parseMavenVersion reads a POM's version, inherited from its parent when
+// it doesn't set one
+func parseMavenVersion(pomFile string) (string, error) {
+    data, err := os.ReadFile(pomFile)
+    if err != nil {
+        return "", fmt.Errorf("failed to read POM file: %v", err)
+    }
+
+    var pom MavenPOM
+    if err := xml.Unmarshal(data, &pom); err != nil {
+        return "", fmt.Errorf("failed to parse POM file: %v", err)
+    }
+    if pom.Version == "" && pom.Parent != nil {
+        return pom.Parent.Version, nil
+    }
+    if pom.Version == "" {
+        return "", fmt.Errorf("no version found in POM file")
+    }
+    return pom.Version, nil
+}
+
+// readGemCoordinates reads the name and version from the gemspec a .gem
+// carries as metadata.gz, without needing the gem command
+func readGemCoordinates(gemFile string) (string, string, error) {
+    file, err := os.Open(gemFile)
+    if err != nil {
+        return "", "", fmt.Errorf("failed to open gem: %v", err)
+    }
+    defer file.Close()
+
+    reader := tar.NewReader(file)
+    for {
+        header, err := reader.Next()
+        if err == io.EOF {
+            return "", "", fmt.Errorf("no metadata.gz found in gem")
+        }
+        if err != nil {
+            return "", "", fmt.Errorf("failed to read gem: %v", err)
+        }
+        if header.Name != "metadata.gz" {
+            continue
+        }
+
+        metadata, err := gzip.NewReader(reader)
+        if err != nil {
+            return "", "", fmt.Errorf("failed to read gem metadata: %v", err)
+        }
+        var spec struct {
+            Name    string `yaml:"name"`
+            Version struct {
+                Version string `yaml:"version"`
+            } `yaml:"version"`
+        }
+        if err := yaml.NewDecoder(metadata).Decode(&spec); err != nil {
+            return "", "", fmt.Errorf("failed to parse gemspec: %v", err)
+        }
+        if spec.Name == "" || spec.Version.Version == "" {
+            return "", "", fmt.Errorf("gemspec missing required field: name or version")
+        }
+        return spec.Name, spec.Version.Version, nil
+    }
+}
+
+// ExtractNPMManifest writes the package.json packed in an npm tarball to
+// dir, for tarballs found without one next to them
+func ExtractNPMManifest(tarball, dir string) (string, error) {
+    file, err := os.Open(tarball)
+    if err != nil {
+        return "", fmt.Errorf("failed to open tarball: %v", err)
+    }
+    defer file.Close()
+
+    gz, err := gzip.NewReader(file)
+    if err != nil {
+        return "", fmt.Errorf("failed to read tarball: %v", err)
+    }
+    reader := tar.NewReader(gz)
+    for {
+        header, err := reader.Next()
+        if err == io.EOF {
+            return "", fmt.Errorf("no package/package.json found in tarball")
+        }
+        if err != nil {
+            return "", fmt.Errorf("failed to read tarball: %v", err)
+        }
+        if header.Name != "package/package.json" {
+            continue
+        }
+
+        path := filepath.Join(dir, "package.json")
+        out, err := os.Create(path)
+        if err != nil {
+            return "", fmt.Errorf("failed to create package.json: %v", err)
+        }
+        defer out.Close()
+        if _, err := io.Copy(out, reader); err != nil {
+            return "", fmt.Errorf("failed to write package.json: %v", err)
+        }
+        return path, nil
+    }
+}
@@ -0,0 +1,170 @@
+package api
+
+import (
+    "fmt"
+    "net/http"
+    "net/url"
+    "strconv"
+
+    "github.com/cvega/gh-migrate-packages/pkg/run"
+)
+
+// RunIDAnnotation is set on every manifest this tool generates, so the
+// versions a run pushed can be told apart from those of other publishers
+const RunIDAnnotation = "com.github.gh-migrate-packages.run-id"
+
+// DanglingVersion is an untagged container version left in the target,
+// typically by a failed or repeated run re-pushing a tag
+type DanglingVersion struct {
+    PackageName string
+    ID          int64
+    Digest      string
+    CreatedAt   string
+    RunID       string   // empty when another publisher pushed it
+    Blobs       []string // config and layers no tagged version references
+    Size        int64    // of Blobs
+}
+
+type restContainerVersion struct {
+    ID        int64  `json:"id"`
+    Name      string `json:"name"`
+    CreatedAt string `json:"created_at"`
+    Metadata  struct {
+        Container struct {
+            Tags []string `json:"tags"`
+        } `json:"container"`
+    } `json:"metadata"`
+}
+
+// FindDanglingVersions lists the untagged versions of the container
+// org/name, with the blobs only they reference and the size of those. Tagged
+// manifests are only read when there is something dangling to compare with
+func (a *API) FindDanglingVersions(org, name string) ([]DanglingVersion, error) {
+    var tagged []string
+    var dangling []DanglingVersion
+    for page := 1; ; page++ {
+        var listed []restContainerVersion
+        versionsURL := fmt.Sprintf("%s/orgs/%s/packages/container/%s/versions?per_page=100&page=%d",
+            a.restBaseURL(), url.PathEscape(org), url.PathEscape(name), page)
+        if err := a.restJSON("GET", versionsURL, nil, &listed); err != nil {
+            return nil, fmt.Errorf("failed to list versions of %s: %v", name, err)
+        }
+        for _, v := range listed {
+            if len(v.Metadata.Container.Tags) > 0 {
+                tagged = append(tagged, v.Name)
+                continue
+            }
+            dangling = append(dangling, DanglingVersion{PackageName: name, ID: v.ID, Digest: v.Name, CreatedAt: v.CreatedAt})
+        }
+        if len(listed) < 100 {
+            break
+        }
+    }
+    if len(dangling) == 0 {
+        return nil, nil
+    }
+
+    baseURL := a.imageBaseURL(org, name)
+    referenced := make(map[string]bool)
+    for _, digest := range tagged {
+        blobs, _, err := a.manifestBlobs(baseURL, digest, true)
+        if err != nil {
+            return nil, err
+        }
+        for _, blob := range blobs {
+            referenced[blob] = true
+        }
+    }
+
+    for i := range dangling {
+        d := &dangling[i]
+        blobs, annotations, err := a.manifestBlobs(baseURL, d.Digest, false)
+        if err != nil {
+            return nil, err
+        }
+        d.RunID = annotations[RunIDAnnotation]
+        for _, blob := range blobs {
+            if referenced[blob] {
+                continue
+            }
+            // Counted once, under the first version referencing it
+            referenced[blob] = true
+            size, err := a.blobSize(baseURL, blob)
+            if err != nil {
+                return nil, err
+            }
+            d.Blobs = append(d.Blobs, blob)
+            d.Size += size
+        }
+    }
+    return dangling, nil
+}
+
+// manifestBlobs returns the config and layer digests of a manifest, and
+// with children set those of the manifests an index lists as well
+func (a *API) manifestBlobs(baseURL, digest string, children bool) ([]string, map[string]string, error) {
+    manifest, _, err := a.getImageManifest(baseURL, digest)
+    if err != nil {
+        return nil, nil, err
+    }
+    var blobs []string
+    if manifest.Config.Digest != "" {
+        blobs = append(blobs, manifest.Config.Digest)
+    }
+    for _, layer := range manifest.Layers {
+        blobs = append(blobs, layer.Digest)
+    }
+    for _, child := range manifest.Manifests {
+        blobs = append(blobs, child.Digest)
+        if children {
+            childBlobs, _, err := a.manifestBlobs(baseURL, child.Digest, false)
+            if err != nil {
+                return nil, nil, err
+            }
+            blobs = append(blobs, childBlobs...)
+        }
+    }
+    return blobs, manifest.Annotations, nil
+}
+
+func (a *API) blobSize(baseURL, digest string) (int64, error) {
+    req, err := http.NewRequestWithContext(a.ctx, "HEAD", fmt.Sprintf("%s/blobs/%s", baseURL, digest), nil)
+    if err != nil {
+        return 0, err
+    }
+    req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", a.token))
+
+    resp, err := a.client.Do(req)
+    if err != nil {
+        return 0, fmt.Errorf("failed to fetch blob: %v", err)
+    }
+    defer resp.Body.Close()
+
+    switch resp.StatusCode {
+    case http.StatusOK:
+        return resp.ContentLength, nil
+    case http.StatusNotFound:
+        // A child manifest rather than a blob, or already collected
+        return 0, nil
+    }
+    return 0, fmt.Errorf("blob request for %s failed with status: %s", digest, resp.Status)
+}
+
+// DeletePackageVersion deletes one version of a package by its ID
+func (a *API) DeletePackageVersion(org, packageType, name string, id int64) error {
+    versionURL := fmt.Sprintf("%s/orgs/%s/packages/%s/%s/versions/%s",
+        a.restBaseURL(), url.PathEscape(org), url.PathEscape(packageType), url.PathEscape(name), strconv.FormatInt(id, 10))
+    if err := a.restJSON("DELETE", versionURL, nil, nil); err != nil {
+        return fmt.Errorf("failed to delete version %d of %s: %v", id, name, err)
+    }
+    return nil
+}
+
+// runAnnotations marks a generated manifest with the run that pushed it
+func runAnnotations(annotations map[string]string) map[string]string {
+    if annotations == nil {
+        annotations = make(map[string]string)
+    }
+    annotations[RunIDAnnotation] = run.ID()
+    return annotations
+}
@@ -0,0 +1,284 @@
+package api
+
+import (
+    "bufio"
+    "compress/gzip"
+    "fmt"
+    "io"
+    "net/http"
+    "net/url"
+    "os"
+    "os/exec"
+    "path"
+    "strconv"
+    "strings"
+)
+
+// Debian control fields needed to place a .deb in an APT repository
+type DebControl struct {
+    Package      string
+    Version      string
+    Architecture string
+}
+
+// aptRepo describes an APT repository given as
+// https://host/repo?dist=stable&component=main&arch=amd64
+type aptRepo struct {
+    base      string
+    dist      string
+    component string
+    arch      string
+}
+
+func parseAptRepo(raw string) (*aptRepo, error) {
+    u, err := url.Parse(raw)
+    if err != nil {
+        return nil, fmt.Errorf("invalid apt repository url: %v", err)
+    }
+
+    q := u.Query()
+    repo := &aptRepo{
+        dist:      q.Get("dist"),
+        component: q.Get("component"),
+        arch:      q.Get("arch"),
+    }
+    if repo.dist == "" {
+        return nil, fmt.Errorf("apt repository url must set ?dist=")
+    }
+    if repo.component == "" {
+        repo.component = "main"
+    }
+    if repo.arch == "" {
+        repo.arch = "amd64"
+    }
+
+    u.RawQuery = ""
+    repo.base = strings.TrimSuffix(u.String(), "/")
+    return repo, nil
+}
+
+// parseDebControl reads the control fields of a .deb using dpkg-deb, which
+// handles every control.tar compression the format allows
+func parseDebControl(debFile string) (*DebControl, error) {
+    cmd := exec.Command("dpkg-deb", "--field", debFile, "Package", "Version", "Architecture")
+    output, err := cmd.Output()
+    if err != nil {
+        return nil, fmt.Errorf("failed to read deb control: %v", err)
+    }
+
+    control := &DebControl{}
+    for _, line := range strings.Split(string(output), "\n") {
+        key, value, ok := strings.Cut(line, ":")
+        if !ok {
+            continue
+        }
+        value = strings.TrimSpace(value)
+        switch strings.TrimSpace(key) {
+        case "Package":
+            control.Package = value
+        case "Version":
+            control.Version = value
+        case "Architecture":
+            control.Architecture = value
+        }
+    }
+
+    if control.Package == "" {
+        return nil, fmt.Errorf("deb control missing required field: Package")
+    }
+    if control.Version == "" {
+        return nil, fmt.Errorf("deb control missing required field: Version")
+    }
+    if control.Architecture == "" {
+        return nil, fmt.Errorf("deb control missing required field: Architecture")
+    }
+
+    return control, nil
+}
+
+// getDebPackages lists packages from the repository's Packages index
+func (a *API) getDebPackages() ([]Package, error) {
+    raw, err := a.registryURL("deb")
+    if err != nil {
+        return nil, err
+    }
+    repo, err := parseAptRepo(raw)
+    if err != nil {
+        return nil, err
+    }
+
+    indexURL := fmt.Sprintf("%s/dists/%s/%s/binary-%s/Packages.gz", repo.base, repo.dist, repo.component, repo.arch)
+    req, err := http.NewRequestWithContext(a.ctx, "GET", indexURL, nil)
+    if err != nil {
+        return nil, err
+    }
+    a.setRegistryAuth(req, "deb", "Bearer")
+
+    resp, err := a.client.Do(req)
+    if err != nil {
+        return nil, fmt.Errorf("failed to fetch Packages index: %v", err)
+    }
+    defer resp.Body.Close()
+
+    if resp.StatusCode != http.StatusOK {
+        return nil, fmt.Errorf("Packages index request failed with status: %s", resp.Status)
+    }
+
+    gz, err := gzip.NewReader(resp.Body)
+    if err != nil {
+        return nil, fmt.Errorf("failed to decompress Packages index: %v", err)
+    }
+    defer gz.Close()
+
+    return parseAptPackagesIndex(gz, repo.base)
+}
+
+// parseAptPackagesIndex groups the stanzas of a Packages index by package name
+func parseAptPackagesIndex(r io.Reader, base string) ([]Package, error) {
+    byName := make(map[string]*Package)
+    var order []string
+
+    flush := func(fields map[string]string) {
+        name := fields["Package"]
+        if name == "" || fields["Filename"] == "" {
+            return
+        }
+
+        p, ok := byName[name]
+        if !ok {
+            p = &Package{
+                ID:          name,
+                Name:        name,
+                PackageType: "deb",
+                Repository:  &Repository{},
+                Statistics:  &Statistics{},
+            }
+            byName[name] = p
+            order = append(order, name)
+        }
+
+        size, _ := strconv.Atoi(fields["Size"])
+        p.Versions = append(p.Versions, Version{
+            ID:   fmt.Sprintf("%s_%s_%s", name, fields["Version"], fields["Architecture"]),
+            Name: fields["Version"],
+            Files: []File{{
+                Name:   path.Base(fields["Filename"]),
+                Size:   size,
+                SHA256: fields["SHA256"],
+                URL:    base + "/" + fields["Filename"],
+            }},
+        })
+    }
+
+    fields := make(map[string]string)
+    scanner := bufio.NewScanner(r)
+    scanner.Buffer(make([]byte, 1024*1024), 1024*1024)
+    for scanner.Scan() {
+        line := scanner.Text()
+
+        // A blank line ends a stanza
+        if strings.TrimSpace(line) == "" {
+            flush(fields)
+            fields = make(map[string]string)
+            continue
+        }
+
+        // Continuation lines belong to multi-line fields we do not need
+        if strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t") {
+            continue
+        }
+
+        if key, value, ok := strings.Cut(line, ":"); ok {
+            fields[key] = strings.TrimSpace(value)
+        }
+    }
+    flush(fields)
+
+    if err := scanner.Err(); err != nil {
+        return nil, fmt.Errorf("failed to parse Packages index: %v", err)
+    }
+
+    var packages []Package
+    for _, name := range order {
+        packages = append(packages, *byName[name])
+    }
+    return packages, nil
+}
+
+// uploadDeb deploys a .deb into the target repository pool, passing the
+// distribution coordinates as matrix parameters so the repository indexes it
+func (a *API) uploadDeb(opts UploadOptions) error {
+    var debFile string
+    for _, file := range opts.Files {
+        if strings.HasSuffix(file, ".deb") {
+            debFile = file
+            break
+        }
+    }
+
+    if debFile == "" {
+        return fmt.Errorf("missing required .deb file")
+    }
+
+    raw, err := a.registryURL("deb")
+    if err != nil {
+        return err
+    }
+    repo, err := parseAptRepo(raw)
+    if err != nil {
+        return err
+    }
+
+    control, err := parseDebControl(debFile)
+    if err != nil {
+        return err
+    }
+
+    if control.Version != opts.Version {
+        return fmt.Errorf("version mismatch: .deb has %s, expected %s", control.Version, opts.Version)
+    }
+
+    // Pool filenames leave out the epoch: 1:2.3-1 is pkg_2.3-1_amd64.deb
+    version := control.Version
+    if i := strings.Index(version, ":"); i >= 0 {
+        version = version[i+1:]
+    }
+    filename := fmt.Sprintf("%s_%s_%s.deb", opts.PackageName, version, control.Architecture)
+    uploadURL := fmt.Sprintf("%s/pool/%s/%s/%s/%s;deb.distribution=%s;deb.component=%s;deb.architecture=%s",
+        repo.base, repo.component, debPoolPrefix(opts.PackageName), opts.PackageName, filename,
+        repo.dist, repo.component, control.Architecture)
+
+    file, err := os.Open(debFile)
+    if err != nil {
+        return err
+    }
+    defer file.Close()
+
+    req, err := http.NewRequestWithContext(a.ctx, "PUT", uploadURL, file)
+    if err != nil {
+        return err
+    }
+
+    req.Header.Set("Content-Type", "application/vnd.debian.binary-package")
+    a.setRegistryAuth(req, "deb", "Bearer")
+
+    resp, err := a.client.Do(req)
+    if err != nil {
+        return err
+    }
+    defer resp.Body.Close()
+
+    if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+        return fmt.Errorf("deb upload failed with status: %s", resp.Status)
+    }
+
+    return nil
+}
+
+// debPoolPrefix returns the pool directory for a package (libfoo -> libf)
+func debPoolPrefix(name string) string {
+    if strings.HasPrefix(name, "lib") && len(name) > 3 {
+        return name[:4]
+    }
+    return name[:1]
+}
@@ -0,0 +1,65 @@
+package api
+
+import (
+    "fmt"
+    "net/url"
+    "strings"
+)
+
+// DeletePackage deletes a package with every version. Public packages
+// downloaded more than 5,000 times can only be deleted by GitHub Support
+func (a *API) DeletePackage(org, packageType, name string) error {
+    packageURL := fmt.Sprintf("%s/orgs/%s/packages/%s/%s",
+        a.restBaseURL(), url.PathEscape(org), url.PathEscape(packageType), url.PathEscape(name))
+    if err := a.restJSON("DELETE", packageURL, nil, nil); err != nil {
+        return fmt.Errorf("failed to delete %s: %v", name, err)
+    }
+    return nil
+}
+
+// PackageVersion is a version as the REST API lists it, with the ID its
+// deletion endpoint takes
+type PackageVersion struct {
+    ID        int64
+    Name      string
+    Tags      []string // container tags
+    CreatedAt string
+}
+
+// ListPackageNames lists the names of org's packages of packageType
+func (a *API) ListPackageNames(org, packageType string) ([]string, error) {
+    var names []string
+    for page := 1; ; page++ {
+        var listed []restPackage
+        listURL := fmt.Sprintf("%s/orgs/%s/packages?package_type=%s&per_page=100&page=%d",
+            a.restBaseURL(), url.PathEscape(org), url.QueryEscape(strings.ToLower(packageType)), page)
+        if err := a.restJSON("GET", listURL, nil, &listed); err != nil {
+            return nil, fmt.Errorf("failed to list packages: %v", err)
+        }
+        for _, p := range listed {
+            names = append(names, p.Name)
+        }
+        if len(listed) < 100 {
+            return names, nil
+        }
+    }
+}
+
+// ListPackageVersions lists every version of a package
+func (a *API) ListPackageVersions(org, packageType, name string) ([]PackageVersion, error) {
+    var versions []PackageVersion
+    for page := 1; ; page++ {
+        var listed []restContainerVersion
+        versionsURL := fmt.Sprintf("%s/orgs/%s/packages/%s/%s/versions?per_page=100&page=%d",
+            a.restBaseURL(), url.PathEscape(org), url.PathEscape(strings.ToLower(packageType)), url.PathEscape(name), page)
+        if err := a.restJSON("GET", versionsURL, nil, &listed); err != nil {
+            return nil, fmt.Errorf("failed to list versions of %s: %v", name, err)
+        }
+        for _, v := range listed {
+            versions = append(versions, PackageVersion{ID: v.ID, Name: v.Name, Tags: v.Metadata.Container.Tags, CreatedAt: v.CreatedAt})
+        }
+        if len(listed) < 100 {
+            return versions, nil
+        }
+    }
+}
@@ -0,0 +1,74 @@
+package api
+
+import (
+    "bytes"
+    "encoding/xml"
+    "fmt"
+    "regexp"
+    "strings"
+    "time"
+
+    "github.com/cvega/gh-migrate-packages/pkg/run"
+)
+
+// Placements of the migration note in target package descriptions
+const (
+    NoteAppend  = "append"
+    NotePrepend = "prepend"
+)
+
+// descriptionAnnotation is the manifest annotation the container registry
+// shows as the package description
+const descriptionAnnotation = "org.opencontainers.image.description"
+
+var nuspecDescription = regexp.MustCompile(`(?s)<description>(.*?)</description>`)
+
+// MigrationNote is the note marking a package migrated from org on the
+// given host, github.com when empty
+func MigrationNote(hostname, org string, at time.Time) string {
+    host := strings.TrimPrefix(strings.TrimPrefix(hostname, "https://"), "http://")
+    host = strings.TrimSuffix(host, "/")
+    if host == "" {
+        host = "github.com"
+    }
+    return fmt.Sprintf("Migrated from %s/%s on %s, run %s", host, org, at.UTC().Format("2006-01-02"), run.ID())
+}
+
+// annotateDescription places note before or after description, on its own
+// paragraph unless the description is empty
+func annotateDescription(description, note, placement string) string {
+    if note == "" {
+        return description
+    }
+    description = strings.TrimSpace(description)
+    switch {
+    case description == "":
+        return note
+    case placement == NotePrepend:
+        return note + "\n\n" + description
+    }
+    return description + "\n\n" + note
+}
+
+// rewriteNuspecDescription adds note to the nuspec's <description>, adding
+// the element if there is none, and leaves every other byte alone
+func rewriteNuspecDescription(nuspec []byte, note, placement string) ([]byte, error) {
+    var escaped bytes.Buffer
+    if err := xml.EscapeText(&escaped, []byte(note)); err != nil {
+        return nil, err
+    }
+
+    loc := nuspecDescription.FindSubmatchIndex(nuspec)
+    if loc == nil {
+        end := bytes.Index(nuspec, []byte("</metadata>"))
+        if end < 0 {
+            return nil, fmt.Errorf("nuspec has no </metadata>")
+        }
+        element := []byte("<description>" + escaped.String() + "</description>")
+        return append(append(append([]byte{}, nuspec[:end]...), element...), nuspec[end:]...), nil
+    }
+
+    // Already escaped, so the note is escaped to match
+    text := annotateDescription(string(nuspec[loc[2]:loc[3]]), escaped.String(), placement)
+    return append(append(append([]byte{}, nuspec[:loc[2]]...), text...), nuspec[loc[3]:]...), nil
+}
@@ -0,0 +1,45 @@
+package api
+
+import (
+    "fmt"
+    "net/http"
+)
+
+// Fetch sends a registry request authenticated with this API's token,
+// copying header, and returns the response for the caller to stream and
+// close. Error statuses are returned as responses, not errors
+func (a *API) Fetch(method, url string, header http.Header) (*http.Response, error) {
+    return a.fetch(method, url, header, func(req *http.Request) {
+        req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", a.token))
+    })
+}
+
+// FetchRegistry is Fetch for the registry of packageType. A registry
+// outside GitHub gets its own token, if any, never this API's
+func (a *API) FetchRegistry(packageType, method, url string, header http.Header) (*http.Response, error) {
+    if _, external := a.registries[packageType]; !external {
+        return a.Fetch(method, url, header)
+    }
+    return a.fetch(method, url, header, func(req *http.Request) {
+        a.setRegistryAuth(req, packageType, registryScheme(packageType))
+    })
+}
+
+func (a *API) fetch(method, url string, header http.Header, authenticate func(*http.Request)) (*http.Response, error) {
+    req, err := http.NewRequestWithContext(a.ctx, method, url, nil)
+    if err != nil {
+        return nil, err
+    }
+    for name, values := range header {
+        for _, value := range values {
+            req.Header.Add(name, value)
+        }
+    }
+    authenticate(req)
+
+    resp, err := a.client.Do(req)
+    if err != nil {
+        return nil, fmt.Errorf("failed to send request: %v", err)
+    }
+    return resp, nil
+}
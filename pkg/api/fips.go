@@ -0,0 +1,39 @@
+package api
+
+import "sync/atomic"
+
+// fips is set when only FIPS 140 approved hashes may be computed: builds
+// tagged fips have it from the start, others get it from EnableFIPS
+var fips atomic.Bool
+
+// legacyAlgorithms are the hashes FIPS mode never computes
+var legacyAlgorithms = map[string]bool{
+    "md5":  true,
+    "sha1": true,
+}
+
+// EnableFIPS stops every computation of MD5 and SHA-1 for the rest of the
+// run. Maven checksums are then SHA-256 and SHA-512 only, and anything a
+// registry can only take with a legacy hash fails instead
+func EnableFIPS() {
+    fips.Store(true)
+}
+
+// FIPS reports whether FIPS mode is on
+func FIPS() bool {
+    return fips.Load()
+}
+
+// approvedAlgorithms leaves the legacy hashes out of algorithms in FIPS mode
+func approvedAlgorithms(algorithms []string) []string {
+    if !FIPS() {
+        return algorithms
+    }
+    var approved []string
+    for _, algorithm := range algorithms {
+        if !legacyAlgorithms[algorithm] {
+            approved = append(approved, algorithm)
+        }
+    }
+    return approved
+}
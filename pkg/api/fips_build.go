@@ -0,0 +1,8 @@
+//go:build fips
+
+package api
+
+// Builds for FIPS-constrained hosts can't be run without FIPS mode
+func init() {
+    fips.Store(true)
+}
@@ -0,0 +1,141 @@
+package api
+
+import (
+    "fmt"
+    "io"
+    "net/http"
+    "net/url"
+    "os"
+    "os/exec"
+    "path/filepath"
+    "strings"
+)
+
+// GemReindexGenerate rebuilds the indexes of a file:// gem repository with
+// gem generate_index; any other --gem-reindex value is a hook URL
+const GemReindexGenerate = "generate"
+
+// pushExternalGem publishes a gem to a rubygems registry outside GitHub.
+// http(s) registries such as gemstash take the RubyGems push API; file://
+// registries are static gem servers the gem is copied into
+func (a *API) pushExternalGem(opts UploadOptions, registry, gemFile string) error {
+    if path, ok := fileRegistryPath(registry); ok {
+        dir := filepath.Join(path, "gems")
+        if err := os.MkdirAll(dir, 0755); err != nil {
+            return fmt.Errorf("failed to create %s: %v", dir, err)
+        }
+        if err := copyFile(gemFile, filepath.Join(dir, filepath.Base(gemFile))); err != nil {
+            return err
+        }
+        a.gemsPushed.Add(1)
+        return nil
+    }
+
+    file, err := os.Open(gemFile)
+    if err != nil {
+        return err
+    }
+    defer file.Close()
+
+    req, err := http.NewRequestWithContext(a.ctx, "POST", registry+"/api/v1/gems", file)
+    if err != nil {
+        return err
+    }
+
+    // RubyGems-compatible registries take the raw API key, without a scheme
+    a.setRegistryAuth(req, "rubygems", "")
+    req.Header.Set("Content-Type", "application/octet-stream")
+
+    resp, err := a.client.Do(req)
+    if err != nil {
+        return err
+    }
+    defer resp.Body.Close()
+
+    if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+        message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+        if strings.Contains(string(message), "already") {
+            return &ErrVersionExists{PackageName: opts.PackageName, Version: opts.Version}
+        }
+        return fmt.Errorf("gem push failed with status: %s: %s", resp.Status, strings.TrimSpace(string(message)))
+    }
+    a.gemsPushed.Add(1)
+    return nil
+}
+
+// ReindexGems makes gems pushed to an external rubygems registry
+// resolvable right away. mode is GemReindexGenerate, which regenerates the
+// specs and compact index of a file:// registry, or a hook URL the
+// registry rebuilds its index on when POSTed to. Nothing is done when no
+// gem was pushed
+func (a *API) ReindexGems(mode string) error {
+    if mode == "" || a.gemsPushed.Load() == 0 {
+        return nil
+    }
+
+    registry, err := a.registryURL("rubygems")
+    if err != nil {
+        return fmt.Errorf("--gem-reindex needs --registry-url rubygems=URL: %v", err)
+    }
+
+    if mode == GemReindexGenerate {
+        path, ok := fileRegistryPath(registry)
+        if !ok {
+            return fmt.Errorf("--gem-reindex %s needs a file:// rubygems registry, use a hook URL for %s", GemReindexGenerate, registry)
+        }
+        args := []string{"generate_index", "--directory", path}
+        // A repository indexed before only needs the new gems added
+        if _, err := os.Stat(filepath.Join(path, "specs.4.8.gz")); err == nil {
+            args = append(args, "--update")
+        }
+        cmd := exec.CommandContext(a.ctx, "gem", args...)
+        if output, err := cmd.CombinedOutput(); err != nil {
+            return fmt.Errorf("gem generate_index failed: %v: %s", err, strings.TrimSpace(string(output)))
+        }
+        return nil
+    }
+
+    req, err := http.NewRequestWithContext(a.ctx, "POST", mode, nil)
+    if err != nil {
+        return err
+    }
+    a.setRegistryAuth(req, "rubygems", "")
+
+    resp, err := a.client.Do(req)
+    if err != nil {
+        return fmt.Errorf("failed to call reindex hook: %v", err)
+    }
+    defer resp.Body.Close()
+
+    if resp.StatusCode < 200 || resp.StatusCode > 299 {
+        return fmt.Errorf("reindex hook failed with status: %s", resp.Status)
+    }
+    return nil
+}
+
+// fileRegistryPath returns the directory of a file:// registry URL
+func fileRegistryPath(registry string) (string, bool) {
+    u, err := url.Parse(registry)
+    if err != nil || u.Scheme != "file" {
+        return "", false
+    }
+    return u.Path, true
+}
+
+func copyFile(src, dst string) error {
+    in, err := os.Open(src)
+    if err != nil {
+        return fmt.Errorf("failed to open %s: %v", src, err)
+    }
+    defer in.Close()
+
+    out, err := os.Create(dst)
+    if err != nil {
+        return fmt.Errorf("failed to create %s: %v", dst, err)
+    }
+    if _, err := io.Copy(out, in); err != nil {
+        out.Close()
+        return fmt.Errorf("failed to copy %s: %v", src, err)
+    }
+    return out.Close()
+}
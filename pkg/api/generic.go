@@ -0,0 +1,215 @@
+package api
+
+import (
+    "fmt"
+    "net/http"
+    "net/url"
+    "os"
+    "path/filepath"
+    "strings"
+
+    "github.com/cvega/gh-migrate-packages/pkg/run"
+)
+
+// Default layout used when a generic target URL has no placeholders
+const genericDefaultTemplate = "{org}/{name}/{version}/{file}"
+
+// genericInventory is the source manifest describing opaque file sets
+type genericInventory struct {
+    Packages []struct {
+        Name     string `json:"name"`
+        Versions []struct {
+            Name      string `json:"name"`
+            CreatedAt string `json:"created_at"`
+            Files     []struct {
+                Name   string `json:"name"`
+                URL    string `json:"url"`
+                Size   int    `json:"size"`
+                SHA256 string `json:"sha256"`
+            } `json:"files"`
+        } `json:"versions"`
+    } `json:"packages"`
+}
+
+// getGenericPackages reads the JSON inventory the generic source URL points at
+func (a *API) getGenericPackages() ([]Package, error) {
+    source, err := a.registryURL("generic")
+    if err != nil {
+        return nil, err
+    }
+
+    var inventory genericInventory
+    if err := a.getRegistryJSON("generic", source, &inventory); err != nil {
+        return nil, fmt.Errorf("failed to read generic inventory: %v", err)
+    }
+
+    var packages []Package
+    for _, p := range inventory.Packages {
+        converted := Package{
+            ID:          p.Name,
+            Name:        p.Name,
+            PackageType: "generic",
+            Repository:  &Repository{},
+            Statistics:  &Statistics{},
+        }
+        for _, v := range p.Versions {
+            version := Version{
+                ID:        p.Name + "@" + v.Name,
+                Name:      v.Name,
+                CreatedAt: v.CreatedAt,
+                UpdatedAt: v.CreatedAt,
+            }
+            for _, f := range v.Files {
+                version.Files = append(version.Files, File{
+                    Name:   f.Name,
+                    Size:   f.Size,
+                    SHA256: f.SHA256,
+                    URL:    resolveURL(source, f.URL),
+                })
+            }
+            converted.Versions = append(converted.Versions, version)
+        }
+        packages = append(packages, converted)
+    }
+
+    return packages, nil
+}
+
+// expandGenericTemplate fills {org}, {name}, {version}, and {file}
+func expandGenericTemplate(template, org, name, version, file string) string {
+    if !strings.Contains(template, "{") {
+        template = strings.TrimSuffix(template, "/") + "/" + genericDefaultTemplate
+    }
+    return strings.NewReplacer(
+        "{org}", url.PathEscape(org),
+        "{name}", escapePathSegments(name),
+        "{version}", url.PathEscape(version),
+        "{file}", escapePathSegments(file),
+    ).Replace(template)
+}
+
+// escapePathSegments escapes each segment but keeps "/" separators
+func escapePathSegments(p string) string {
+    segments := strings.Split(p, "/")
+    for i, segment := range segments {
+        segments[i] = url.PathEscape(segment)
+    }
+    return strings.Join(segments, "/")
+}
+
+// uploadGeneric PUTs every file of the version to the target URL template,
+// sending its SHA-256 and checking the digest the target reports back
+func (a *API) uploadGeneric(opts UploadOptions) error {
+    if len(opts.Files) == 0 {
+        return fmt.Errorf("version has no files to upload")
+    }
+
+    template, err := a.registryURL("generic")
+    if err != nil {
+        return err
+    }
+
+    // Checksums and signatures go with the file they belong to
+    files, sidecars := splitSidecars(opts.Files)
+    var generated string
+    for _, path := range files {
+        if err := a.putGenericPath(template, opts, path); err != nil {
+            return err
+        }
+
+        for _, extension := range sidecarExtensions() {
+            sidecar := path + "." + extension
+            switch a.sidecarMode("generic", extension) {
+            case SidecarCopy:
+                if !sidecars[sidecar] {
+                    continue
+                }
+            case SidecarRegenerate:
+                if generated == "" {
+                    if generated, err = run.TempDir("sidecars"); err != nil {
+                        return fmt.Errorf("failed to create sidecar directory: %v", err)
+                    }
+                    defer run.RemoveTempDir(generated)
+                }
+                digest, err := calculateFileHash(path, sidecarAlgorithms[extension])
+                if err != nil {
+                    return err
+                }
+                sidecar = filepath.Join(generated, filepath.Base(sidecar))
+                if err := os.WriteFile(sidecar, []byte(digest), 0644); err != nil {
+                    return fmt.Errorf("failed to write %s sidecar: %v", extension, err)
+                }
+            default:
+                continue
+            }
+            if err := a.putGenericPath(template, opts, sidecar); err != nil {
+                return err
+            }
+        }
+    }
+
+    return nil
+}
+
+// putGenericPath uploads path under its base name in the version's location
+func (a *API) putGenericPath(template string, opts UploadOptions, path string) error {
+    digest, err := calculateFileHash(path, "sha256")
+    if err != nil {
+        return err
+    }
+
+    target := expandGenericTemplate(template, opts.Organization, opts.PackageName, opts.Version, filepath.Base(path))
+    return a.putGenericFile(target, path, digest)
+}
+
+func (a *API) putGenericFile(target, path, digest string) error {
+    file, err := os.Open(path)
+    if err != nil {
+        return err
+    }
+    defer file.Close()
+
+    info, err := file.Stat()
+    if err != nil {
+        return err
+    }
+
+    req, err := http.NewRequestWithContext(a.ctx, "PUT", target, file)
+    if err != nil {
+        return err
+    }
+
+    req.ContentLength = info.Size()
+    req.Header.Set("Content-Type", "application/octet-stream")
+    req.Header.Set("X-Checksum-Sha256", digest)
+    a.setRegistryAuth(req, "generic", "Bearer")
+
+    resp, err := a.client.Do(req)
+    if err != nil {
+        return err
+    }
+    defer resp.Body.Close()
+
+    if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusNoContent {
+        return fmt.Errorf("upload of %s failed with status: %s", filepath.Base(path), resp.Status)
+    }
+
+    // Confirm the stored object when the target exposes its digest
+    head, err := http.NewRequestWithContext(a.ctx, "HEAD", target, nil)
+    if err != nil {
+        return err
+    }
+    a.setRegistryAuth(head, "generic", "Bearer")
+
+    headResp, err := a.client.Do(head)
+    if err != nil {
+        return fmt.Errorf("failed to verify %s: %v", filepath.Base(path), err)
+    }
+    headResp.Body.Close()
+
+    if remote := headResp.Header.Get("X-Checksum-Sha256"); remote != "" && !strings.EqualFold(remote, digest) {
+        return fmt.Errorf("checksum mismatch for %s: uploaded %s, target reports %s", filepath.Base(path), digest, remote)
+    }
+
+    return nil
+}
@@ -0,0 +1,216 @@
+package api
+
+import (
+    "bufio"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "net/url"
+    "os"
+    "path/filepath"
+    "strings"
+)
+
+// Go module version metadata served at @v/<version>.info
+type GoModuleInfo struct {
+    Version string
+    Time    string
+}
+
+// Go modules are stored as .info/.mod/.zip triplets per version
+var goModuleExtensions = []string{".info", ".mod", ".zip"}
+
+// escapeModulePath applies the GOPROXY case encoding (Upper -> !upper)
+func escapeModulePath(module string) string {
+    var b strings.Builder
+    for _, r := range module {
+        if r >= 'A' && r <= 'Z' {
+            b.WriteByte('!')
+            b.WriteRune(r + ('a' - 'A'))
+            continue
+        }
+        b.WriteRune(r)
+    }
+    return b.String()
+}
+
+// getGoModules lists modules from a GOPROXY-compatible source. Plain proxies
+// cannot enumerate their contents, so the module catalog endpoint exposed by
+// Athens-style proxies is used.
+func (a *API) getGoModules() ([]Package, error) {
+    proxy, err := a.registryURL("go")
+    if err != nil {
+        return nil, err
+    }
+
+    // Collect module paths from the paginated catalog
+    seen := make(map[string]bool)
+    var modules []string
+    pageToken := ""
+    for {
+        catalogURL := proxy + "/catalog?pagesize=1000"
+        if pageToken != "" {
+            catalogURL += "&token=" + url.QueryEscape(pageToken)
+        }
+
+        var catalog struct {
+            Modules []struct {
+                Module string `json:"module"`
+            } `json:"modules"`
+            NextPageToken string `json:"next_page_token"`
+        }
+        if err := a.getRegistryJSON("go", catalogURL, &catalog); err != nil {
+            return nil, fmt.Errorf("failed to read module catalog: %v", err)
+        }
+
+        for _, m := range catalog.Modules {
+            if !seen[m.Module] {
+                seen[m.Module] = true
+                modules = append(modules, m.Module)
+            }
+        }
+
+        if catalog.NextPageToken == "" {
+            break
+        }
+        pageToken = catalog.NextPageToken
+    }
+
+    var packages []Package
+    for _, module := range modules {
+        base := fmt.Sprintf("%s/%s/@v/", proxy, escapeModulePath(module))
+
+        versions, err := a.getGoModuleVersions(base + "list")
+        if err != nil {
+            return nil, fmt.Errorf("failed to list versions of %s: %v", module, err)
+        }
+
+        p := Package{
+            ID:          module,
+            Name:        module,
+            PackageType: "go",
+            Repository:  &Repository{},
+            Statistics:  &Statistics{},
+        }
+
+        for _, version := range versions {
+            var info GoModuleInfo
+            if err := a.getRegistryJSON("go", base+version+".info", &info); err != nil {
+                return nil, fmt.Errorf("failed to get %s@%s info: %v", module, version, err)
+            }
+
+            v := Version{
+                ID:        module + "@" + version,
+                Name:      version,
+                CreatedAt: info.Time,
+                UpdatedAt: info.Time,
+            }
+            for _, ext := range goModuleExtensions {
+                v.Files = append(v.Files, File{
+                    Name: version + ext,
+                    URL:  base + version + ext,
+                })
+            }
+            p.Versions = append(p.Versions, v)
+        }
+
+        packages = append(packages, p)
+    }
+
+    return packages, nil
+}
+
+func (a *API) getGoModuleVersions(listURL string) ([]string, error) {
+    req, err := http.NewRequestWithContext(a.ctx, "GET", listURL, nil)
+    if err != nil {
+        return nil, err
+    }
+
+    resp, err := a.client.Do(req)
+    if err != nil {
+        return nil, err
+    }
+    defer resp.Body.Close()
+
+    if resp.StatusCode != http.StatusOK {
+        return nil, fmt.Errorf("request failed with status: %s", resp.Status)
+    }
+
+    var versions []string
+    scanner := bufio.NewScanner(resp.Body)
+    for scanner.Scan() {
+        if version := strings.TrimSpace(scanner.Text()); version != "" {
+            versions = append(versions, version)
+        }
+    }
+
+    return versions, scanner.Err()
+}
+
+// uploadGoModule deploys the .info/.mod/.zip triplet to a Go registry that
+// accepts PUT uploads at the GOPROXY paths (e.g. Artifactory)
+func (a *API) uploadGoModule(opts UploadOptions) error {
+    registry, err := a.registryURL("go")
+    if err != nil {
+        return err
+    }
+
+    found := make(map[string]string)
+    for _, file := range opts.Files {
+        ext := filepath.Ext(file)
+        for _, want := range goModuleExtensions {
+            if ext == want {
+                found[ext] = file
+            }
+        }
+    }
+
+    for _, ext := range goModuleExtensions {
+        if found[ext] == "" {
+            return fmt.Errorf("missing required %s file", ext)
+        }
+    }
+
+    // The .info must describe the version being published
+    data, err := os.ReadFile(found[".info"])
+    if err != nil {
+        return fmt.Errorf("failed to read .info: %v", err)
+    }
+    var info GoModuleInfo
+    if err := json.Unmarshal(data, &info); err != nil {
+        return fmt.Errorf("failed to parse .info: %v", err)
+    }
+    if info.Version != opts.Version {
+        return fmt.Errorf("version mismatch: .info has %s, expected %s", info.Version, opts.Version)
+    }
+
+    base := fmt.Sprintf("%s/%s/@v/%s", registry, escapeModulePath(opts.PackageName), opts.Version)
+
+    // Upload the zip first so the version only becomes visible once complete
+    for _, ext := range []string{".zip", ".mod", ".info"} {
+        file, err := os.Open(found[ext])
+        if err != nil {
+            return err
+        }
+
+        req, err := http.NewRequestWithContext(a.ctx, "PUT", base+ext, file)
+        if err != nil {
+            file.Close()
+            return err
+        }
+        a.setRegistryAuth(req, "go", "Bearer")
+
+        resp, err := a.client.Do(req)
+        file.Close()
+        if err != nil {
+            return err
+        }
+        resp.Body.Close()
+
+        if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+            return fmt.Errorf("go module %s upload failed with status: %s", ext, resp.Status)
+        }
+    }
+
+    return nil
+}
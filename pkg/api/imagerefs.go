@@ -0,0 +1,270 @@
+package api
+
+import (
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "net/url"
+    "sort"
+    "strings"
+)
+
+const (
+    mediaTypeManifestList = "application/vnd.docker.distribution.manifest.list.v2+json"
+    mediaTypeOCIManifest  = "application/vnd.oci.image.manifest.v1+json"
+    mediaTypeOCIIndex     = "application/vnd.oci.image.index.v1+json"
+)
+
+// Accept every manifest flavour so the registry returns the stored digest
+var manifestAccept = strings.Join([]string{
+    mediaTypeManifest, mediaTypeManifestList, mediaTypeOCIManifest, mediaTypeOCIIndex,
+}, ", ")
+
+// ImageReference is a label, annotation or build step of a migrated image
+// that still points at the source organization
+type ImageReference struct {
+    PackageName string
+    Version     string
+    Digest      string
+    Location    string
+    Key         string
+    Value       string
+}
+
+type imageManifest struct {
+    MediaType   string            `json:"mediaType"`
+    Config      ConfigObject      `json:"config"`
+    Layers      []LayerObject     `json:"layers"`
+    Manifests   []imageDescriptor `json:"manifests"`
+    Annotations map[string]string `json:"annotations"`
+}
+
+type imageDescriptor struct {
+    Digest   string `json:"digest"`
+    Platform struct {
+        OS           string `json:"os"`
+        Architecture string `json:"architecture"`
+    } `json:"platform"`
+}
+
+type imageConfig struct {
+    Config struct {
+        Labels map[string]string `json:"Labels"`
+    } `json:"config"`
+    History []struct {
+        CreatedBy string `json:"created_by"`
+    } `json:"history"`
+}
+
+// SourceReferencePrefixes returns the registry and repository prefixes an
+// image built in the source organization would carry, lowercased
+func SourceReferencePrefixes(hostname, org string) []string {
+    org = strings.ToLower(org)
+    host := "github.com"
+    if hostname != "" {
+        host = hostname
+        if u, err := url.Parse(hostname); err == nil && u.Host != "" {
+            host = u.Host
+        }
+        host = strings.ToLower(strings.TrimSuffix(host, "/"))
+    }
+
+    if host == "github.com" {
+        return []string{
+            "ghcr.io/" + org + "/",
+            "docker.pkg.github.com/" + org + "/",
+            "github.com/" + org + "/",
+        }
+    }
+    return []string{
+        "containers." + host + "/" + org + "/",
+        "docker." + host + "/" + org + "/",
+        host + "/" + org + "/",
+    }
+}
+
+// FindSourceReferences inspects a migrated container image's manifest,
+// config labels and build history for any of the given prefixes
+func (a *API) FindSourceReferences(org, name, reference string, prefixes []string) ([]ImageReference, error) {
+    baseURL := fmt.Sprintf("https://%s/v2/%s/%s", a.ContainerRegistry(), org, name)
+
+    manifest, digest, err := a.getImageManifest(baseURL, reference)
+    if err != nil {
+        return nil, err
+    }
+
+    var refs []ImageReference
+    add := func(digest, location, key, value string) {
+        if matchesPrefix(value, prefixes) {
+            refs = append(refs, ImageReference{
+                PackageName: name,
+                Version:     reference,
+                Digest:      digest,
+                Location:    location,
+                Key:         key,
+                Value:       value,
+            })
+        }
+    }
+
+    manifests := []*imageManifest{manifest}
+    digests := []string{digest}
+
+    // Multi-platform images carry labels per platform manifest
+    if manifest.MediaType == mediaTypeManifestList || manifest.MediaType == mediaTypeOCIIndex || len(manifest.Manifests) > 0 {
+        for _, key := range sortedKeys(manifest.Annotations) {
+            add(digest, "index annotation", key, manifest.Annotations[key])
+        }
+
+        manifests, digests = nil, nil
+        for _, desc := range manifest.Manifests {
+            child, _, err := a.getImageManifest(baseURL, desc.Digest)
+            if err != nil {
+                return nil, err
+            }
+            manifests = append(manifests, child)
+            digests = append(digests, desc.Digest)
+        }
+    }
+
+    for i, m := range manifests {
+        for _, key := range sortedKeys(m.Annotations) {
+            add(digests[i], "annotation", key, m.Annotations[key])
+        }
+
+        if m.Config.Digest == "" {
+            continue
+        }
+
+        var config imageConfig
+        if err := a.getImageBlob(baseURL, m.Config.Digest, &config); err != nil {
+            return nil, err
+        }
+
+        for _, key := range sortedKeys(config.Config.Labels) {
+            add(digests[i], "label", key, config.Config.Labels[key])
+        }
+        for step, h := range config.History {
+            add(digests[i], "history", fmt.Sprintf("step %d", step), h.CreatedBy)
+        }
+    }
+
+    return refs, nil
+}
+
+// ContainerRegistry returns the host serving this instance's container images
+func (a *API) ContainerRegistry() string {
+    if a.hostname == "" {
+        return "ghcr.io"
+    }
+
+    host := a.hostname
+    if u, err := url.Parse(a.hostname); err == nil && u.Host != "" {
+        host = u.Host
+    }
+    return "containers." + strings.TrimSuffix(host, "/")
+}
+
+// GetImageDigest resolves a tag to the digest of its manifest
+func (a *API) GetImageDigest(org, name, reference string) (string, error) {
+    manifestURL := fmt.Sprintf("https://%s/v2/%s/%s/manifests/%s", a.ContainerRegistry(), org, name, reference)
+    req, err := http.NewRequestWithContext(a.ctx, "HEAD", manifestURL, nil)
+    if err != nil {
+        return "", err
+    }
+
+    req.Header.Set("Accept", manifestAccept)
+    req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", a.token))
+
+    resp, err := a.client.Do(req)
+    if err != nil {
+        return "", fmt.Errorf("failed to fetch manifest: %v", err)
+    }
+    defer resp.Body.Close()
+
+    if resp.StatusCode != http.StatusOK {
+        return "", fmt.Errorf("manifest request for %s failed with status: %s", reference, resp.Status)
+    }
+
+    digest := resp.Header.Get("Docker-Content-Digest")
+    if digest == "" {
+        return "", fmt.Errorf("registry returned no digest for %s:%s", name, reference)
+    }
+    return digest, nil
+}
+
+func (a *API) getImageManifest(baseURL, reference string) (*imageManifest, string, error) {
+    req, err := http.NewRequestWithContext(a.ctx, "GET", fmt.Sprintf("%s/manifests/%s", baseURL, reference), nil)
+    if err != nil {
+        return nil, "", err
+    }
+
+    req.Header.Set("Accept", manifestAccept)
+    req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", a.token))
+
+    resp, err := a.client.Do(req)
+    if err != nil {
+        return nil, "", fmt.Errorf("failed to fetch manifest: %v", err)
+    }
+    defer resp.Body.Close()
+
+    if resp.StatusCode != http.StatusOK {
+        return nil, "", fmt.Errorf("manifest request for %s failed with status: %s", reference, resp.Status)
+    }
+
+    var manifest imageManifest
+    if err := json.NewDecoder(resp.Body).Decode(&manifest); err != nil {
+        return nil, "", fmt.Errorf("failed to parse manifest: %v", err)
+    }
+
+    digest := resp.Header.Get("Docker-Content-Digest")
+    if digest == "" {
+        digest = reference
+    }
+
+    return &manifest, digest, nil
+}
+
+func (a *API) getImageBlob(baseURL, digest string, out interface{}) error {
+    req, err := http.NewRequestWithContext(a.ctx, "GET", fmt.Sprintf("%s/blobs/%s", baseURL, digest), nil)
+    if err != nil {
+        return err
+    }
+
+    req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", a.token))
+
+    resp, err := a.client.Do(req)
+    if err != nil {
+        return fmt.Errorf("failed to fetch blob: %v", err)
+    }
+    defer resp.Body.Close()
+
+    if resp.StatusCode != http.StatusOK {
+        return fmt.Errorf("blob request for %s failed with status: %s", digest, resp.Status)
+    }
+
+    if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+        return fmt.Errorf("failed to parse image config: %v", err)
+    }
+
+    return nil
+}
+
+func matchesPrefix(value string, prefixes []string) bool {
+    value = strings.ToLower(value)
+    for _, prefix := range prefixes {
+        if strings.Contains(value, prefix) {
+            return true
+        }
+    }
+    return false
+}
+
+func sortedKeys(m map[string]string) []string {
+    keys := make([]string, 0, len(m))
+    for k := range m {
+        keys = append(keys, k)
+    }
+    sort.Strings(keys)
+    return keys
+}
@@ -0,0 +1,70 @@
+package api
+
+import (
+    "fmt"
+    "net/url"
+)
+
+// Label marking issues filed by the migration
+const MigrationIssueLabel = "package-migration"
+
+type issue struct {
+    Number  int    `json:"number"`
+    Title   string `json:"title"`
+    HTMLURL string `json:"html_url"`
+}
+
+// UpsertIssue opens an issue in repo (owner/name) or, if an open issue with
+// the same title and the migration label exists, replaces its body. It
+// returns the issue's URL
+func (a *API) UpsertIssue(repo, title, body string) (string, error) {
+    base := fmt.Sprintf("%s/repos/%s/issues", a.restBaseURL(), repo)
+
+    existing, err := a.findOpenIssue(base, title)
+    if err != nil {
+        return "", err
+    }
+
+    var result issue
+    if existing != nil {
+        update := map[string]interface{}{"body": body}
+        if err := a.restJSON("PATCH", fmt.Sprintf("%s/%d", base, existing.Number), update, &result); err != nil {
+            return "", fmt.Errorf("failed to update issue #%d: %v", existing.Number, err)
+        }
+        return result.HTMLURL, nil
+    }
+
+    create := map[string]interface{}{
+        "title":  title,
+        "body":   body,
+        "labels": []string{MigrationIssueLabel},
+    }
+    if err := a.restJSON("POST", base, create, &result); err != nil {
+        return "", fmt.Errorf("failed to open issue: %v", err)
+    }
+    return result.HTMLURL, nil
+}
+
+func (a *API) findOpenIssue(base, title string) (*issue, error) {
+    for page := 1; ; page++ {
+        query := url.Values{}
+        query.Set("state", "open")
+        query.Set("labels", MigrationIssueLabel)
+        query.Set("per_page", "100")
+        query.Set("page", fmt.Sprintf("%d", page))
+
+        var issues []issue
+        if err := a.restJSON("GET", base+"?"+query.Encode(), nil, &issues); err != nil {
+            return nil, fmt.Errorf("failed to list issues: %v", err)
+        }
+
+        for i := range issues {
+            if issues[i].Title == title {
+                return &issues[i], nil
+            }
+        }
+        if len(issues) < 100 {
+            return nil, nil
+        }
+    }
+}
@@ -1,6 +1,7 @@
 package api
 
 import (
+    "archive/zip"
     "bytes"
     "encoding/xml"
     "fmt"
@@ -17,6 +18,7 @@ type MavenPOM struct {
     GroupID    string   `xml:"groupId"`
     ArtifactID string   `xml:"artifactId"`
     Version    string   `xml:"version"`
+    Packaging  string   `xml:"packaging"`
     Parent     *Parent  `xml:"parent"`
 }
 
@@ -60,38 +62,218 @@ func parseMavenPOM(pomFile string) (groupID, artifactID string, err error) {
     return groupID, pom.ArtifactID, nil
 }
 
+// mavenArtifactExtensions maps a packaging to the extension of the main
+// artifact it builds. pom packaging (BOMs and parent POMs) builds none
+var mavenArtifactExtensions = map[string]string{
+    "jar":          "jar",
+    "maven-plugin": "jar",
+    "bundle":       "jar",
+    "ejb":          "jar",
+    "war":          "war",
+    "ear":          "ear",
+    "rar":          "rar",
+    "aar":          "aar",
+    "pom":          "",
+}
+
+// mavenCompoundExtensions are extensions with a dot of their own, mostly
+// assembly archives
+var mavenCompoundExtensions = []string{"tar.gz", "tar.bz2", "tar.xz"}
+
+// mavenArtifact is a file of a Maven version identified by its coordinates
+type mavenArtifact struct {
+    File       string
+    Classifier string // e.g. sources, tests, bin; empty for the main artifact
+    Extension  string // e.g. jar, war, zip, tar.gz
+}
+
+// TargetName is the repository layout filename of the artifact
+func (m mavenArtifact) TargetName(artifactID, version string) string {
+    name := artifactID + "-" + version
+    if m.Classifier != "" {
+        name += "-" + m.Classifier
+    }
+    return name + "." + m.Extension
+}
+
+// parseMavenArtifacts identifies every artifact file of a version by the
+// classifier and extension around the version in its name, so uploads are
+// named after the POM's coordinates whatever the local files are called.
+// Repository metadata is skipped, the target maintains its own
+func parseMavenArtifacts(version string, files []string) ([]mavenArtifact, error) {
+    var artifacts []mavenArtifact
+    for _, file := range files {
+        base := filepath.Base(file)
+        if strings.HasPrefix(base, "maven-metadata") {
+            continue
+        }
+
+        ext := strings.TrimPrefix(filepath.Ext(base), ".")
+        for _, compound := range mavenCompoundExtensions {
+            if strings.HasSuffix(base, "."+compound) {
+                ext = compound
+                break
+            }
+        }
+        stem := strings.TrimSuffix(base, "."+ext)
+
+        i := strings.LastIndex(stem, "-"+version)
+        if ext == "" || i < 0 {
+            return nil, fmt.Errorf("can't tell the classifier of %s, its name doesn't contain version %s", base, version)
+        }
+        rest := stem[i+len(version)+1:]
+        if rest != "" && !strings.HasPrefix(rest, "-") {
+            return nil, fmt.Errorf("can't tell the classifier of %s, its name doesn't contain version %s", base, version)
+        }
+
+        artifacts = append(artifacts, mavenArtifact{
+            File:       file,
+            Classifier: strings.TrimPrefix(rest, "-"),
+            Extension:  ext,
+        })
+    }
+    return artifacts, nil
+}
+
+// mavenPluginDescriptor is where maven-plugin packaging keeps the goals and
+// parameters Maven loads the plugin by
+const mavenPluginDescriptor = "META-INF/maven/plugin.xml"
+
+// parseMavenPackaging returns the POM's packaging, jar when it has none
+func parseMavenPackaging(pomFile string) (string, error) {
+    data, err := os.ReadFile(pomFile)
+    if err != nil {
+        return "", fmt.Errorf("failed to read POM file: %v", err)
+    }
+
+    var pom MavenPOM
+    if err := xml.Unmarshal(data, &pom); err != nil {
+        return "", fmt.Errorf("failed to parse POM file: %v", err)
+    }
+    if packaging := strings.TrimSpace(pom.Packaging); packaging != "" {
+        return packaging, nil
+    }
+    return "jar", nil
+}
+
+// checkMavenPackaging validates a version's artifacts against its
+// packaging before anything is uploaded, so a target never gets a POM
+// promising an artifact that isn't there. pom packaging and custom
+// packagings, whose artifact can't be predicted, need none
+func checkMavenPackaging(packaging, artifactID, version string, artifacts []mavenArtifact) error {
+    ext, known := mavenArtifactExtensions[packaging]
+    if !known || ext == "" {
+        return nil
+    }
+
+    var main *mavenArtifact
+    for i := range artifacts {
+        if artifacts[i].Classifier == "" && artifacts[i].Extension == ext {
+            main = &artifacts[i]
+            break
+        }
+    }
+    if main == nil {
+        return fmt.Errorf("%s packaging needs %s-%s.%s, which the version doesn't have", packaging, artifactID, version, ext)
+    }
+
+    if packaging == "maven-plugin" {
+        return checkPluginDescriptor(main.File)
+    }
+    return nil
+}
+
+// checkPluginDescriptor makes sure a plugin jar still has its descriptor;
+// Maven can't load the plugin without it
+func checkPluginDescriptor(jarFile string) error {
+    reader, err := zip.OpenReader(jarFile)
+    if err != nil {
+        return fmt.Errorf("failed to open plugin jar %s: %v", filepath.Base(jarFile), err)
+    }
+    defer reader.Close()
+
+    for _, f := range reader.File {
+        if f.Name == mavenPluginDescriptor {
+            return nil
+        }
+    }
+    return fmt.Errorf("plugin jar %s has no %s", filepath.Base(jarFile), mavenPluginDescriptor)
+}
+
+// isMavenSidecar reports whether file is a checksum or signature, uploaded
+// with the file it belongs to as the sidecar modes say
+func isMavenSidecar(file string) bool {
+    extension := strings.TrimPrefix(filepath.Ext(file), ".")
+    return sidecarAlgorithms[extension] != "" || sidecarSignatures[extension]
+}
+
 func (a *API) uploadMavenFile(url, file string) error {
-    // Calculate checksums
+    // Calculate checksums in one pass, usually already known from the download
+    var algorithms []string
+    for extension, algorithm := range sidecarAlgorithms {
+        if a.sidecarMode("maven", extension) != SidecarSkip {
+            algorithms = append(algorithms, algorithm)
+        }
+    }
+    if _, err := fileDigests(file, approvedAlgorithms(algorithms)...); err != nil {
+        return err
+    }
+
     data, err := os.ReadFile(file)
     if err != nil {
         return fmt.Errorf("failed to read file: %v", err)
     }
 
-    md5sum := md5.Sum(data)
-    sha1sum := sha1.Sum(data)
-    sha256sum := sha256.Sum256(data)
-
     // Upload the main file
     if err := a.uploadFile(url, bytes.NewReader(data)); err != nil {
         return fmt.Errorf("failed to upload file: %v", err)
     }
 
-    // Upload checksums
-    checksums := map[string][]byte{
-        url + ".md5":    []byte(fmt.Sprintf("%x", md5sum)),
-        url + ".sha1":   []byte(fmt.Sprintf("%x", sha1sum)),
-        url + ".sha256": []byte(fmt.Sprintf("%x", sha256sum)),
-    }
-
-    for checksumURL, checksumData := range checksums {
-        if err := a.uploadFile(checksumURL, bytes.NewReader(checksumData)); err != nil {
-            return fmt.Errorf("failed to upload checksum: %v", err)
+    // Checksums and signatures follow, copied from the download or
+    // calculated
+    for _, extension := range sidecarExtensions() {
+        sidecar, err := a.mavenSidecar(file, extension)
+        if err != nil {
+            return err
+        }
+        if sidecar == nil {
+            continue
+        }
+        if err := a.uploadFile(url+"."+extension, bytes.NewReader(sidecar)); err != nil {
+            return fmt.Errorf("failed to upload %s sidecar: %v", extension, err)
         }
     }
 
     return nil
 }
 
+// mavenSidecar returns the content of file's sidecar with extension, or nil
+// when none is uploaded. A checksum set to copy that wasn't downloaded is
+// regenerated, since Maven clients expect one, unless FIPS mode rules out
+// its hash
+func (a *API) mavenSidecar(file, extension string) ([]byte, error) {
+    mode := a.sidecarMode("maven", extension)
+    if mode == SidecarCopy {
+        data, err := os.ReadFile(file + "." + extension)
+        if err == nil {
+            return data, nil
+        }
+        if !os.IsNotExist(err) {
+            return nil, fmt.Errorf("failed to read %s sidecar: %v", extension, err)
+        }
+        mode = SidecarRegenerate
+    }
+    algorithm := sidecarAlgorithms[extension]
+    if mode != SidecarRegenerate || algorithm == "" || len(approvedAlgorithms([]string{algorithm})) == 0 {
+        return nil, nil
+    }
+    digest, err := calculateFileHash(file, algorithm)
+    if err != nil {
+        return nil, err
+    }
+    return []byte(digest), nil
+}
+
 func (a *API) uploadFile(url string, content io.Reader) error {
     req, err := http.NewRequestWithContext(a.ctx, "PUT", url, content)
     if err != nil {
@@ -100,7 +282,7 @@ func (a *API) uploadFile(url string, content io.Reader) error {
 
     req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", a.token))
 
-    resp, err := http.DefaultClient.Do(req)
+    resp, err := a.client.Do(req)
     if err != nil {
         return err
     }
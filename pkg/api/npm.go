@@ -60,10 +60,15 @@ func (a *API) publishNPMPackage(opts UploadOptions, packageJSON, tarball string)
     }
 
     // Update package.json with GitHub-specific fields
+    repository := fmt.Sprintf("https://github.com/%s/%s", opts.Organization, filepath.Base(opts.PackageName))
+    if opts.Repository != "" {
+        repository = opts.Repository
+    }
     pkg.Repository = map[string]string{
         "type": "git",
-        "url":  fmt.Sprintf("https://github.com/%s/%s.git", opts.Organization, filepath.Base(opts.PackageName)),
+        "url":  repository + ".git",
     }
+    pkg.Description = annotateDescription(pkg.Description, opts.Note, opts.NotePlacement)
     pkg.Dist.Shasum = sha512
     pkg.Dist.Tarball = fmt.Sprintf("https://npm.pkg.github.com/%s/-/%s-%s.tgz",
         opts.Organization, pkg.Name, pkg.Version)
@@ -2,11 +2,13 @@ package api
 
 import (
     "archive/zip"
+    "bytes"
     "encoding/xml"
     "fmt"
     "io"
     "os"
     "path/filepath"
+    "regexp"
     "strings"
 )
 
@@ -78,25 +80,195 @@ func parseNuspec(nupkgPath string) (*NuspecManifest, error) {
     return &manifest, nil
 }
 
-func (a *API) publishNuGetPackage(opts UploadOptions, nupkgPath string) error {
+// nuspecRepository finds the <repository> element of a nuspec
+var nuspecRepository = regexp.MustCompile(`<repository\b[^>]*?(/?)>`)
+
+// nuspecAttribute matches one attribute of an element, by name
+func nuspecAttribute(name string) *regexp.Regexp {
+    return regexp.MustCompile(`\s` + name + `\s*=\s*("[^"]*"|'[^']*')`)
+}
+
+// nugetSignature is the package signature part. It signs the original
+// content, so a repacked package must drop it or clients refuse to install
+const nugetSignature = ".signature.p7s"
+
+// nugetFrameworks are the target framework identifiers NuGet recognizes,
+// lowercased without dots, e.g. net, netstandard, netframework
+var nugetFrameworks = map[string]bool{
+    "net": true, "netstandard": true, "netcoreapp": true, "netframework": true,
+    "netcore": true, "netmicroframework": true, "netplatform": true, "dotnet": true,
+    "uap": true, "win": true, "winrt": true, "wp": true, "wpa": true, "sl": true,
+    "silverlight": true, "monoandroid": true, "monotouch": true, "monomac": true,
+    "xamarinios": true, "xamarinmac": true, "xamarintvos": true, "xamarinwatchos": true,
+    "tizen": true, "native": true, "portable": true,
+}
+
+var frameworkIdentifier = regexp.MustCompile(`^[.A-Za-z]+`)
+
+// validateTargetFrameworks rejects dependency groups whose framework NuGet
+// wouldn't recognize; clients silently ignore such groups, so the migrated
+// package would install without its dependencies
+func validateTargetFrameworks(manifest *NuspecManifest) error {
+    for _, group := range manifest.Metadata.Dependencies.Groups {
+        framework := strings.TrimSpace(group.TargetFramework)
+        if framework == "" {
+            continue // applies to every framework
+        }
+        identifier := strings.ToLower(strings.ReplaceAll(frameworkIdentifier.FindString(framework), ".", ""))
+        if !nugetFrameworks[identifier] {
+            return fmt.Errorf("dependency group has unrecognized target framework %q", framework)
+        }
+    }
+    return nil
+}
+
+// rewriteNuspecRepository points the nuspec's <repository> at url, adding
+// the element if there is none, and leaves every other byte alone
+func rewriteNuspecRepository(nuspec []byte, url string) ([]byte, error) {
+    var escaped bytes.Buffer
+    if err := xml.EscapeText(&escaped, []byte(url)); err != nil {
+        return nil, err
+    }
+    value := `"` + strings.ReplaceAll(escaped.String(), `"`, "&quot;") + `"`
+
+    loc := nuspecRepository.FindSubmatchIndex(nuspec)
+    if loc == nil {
+        end := bytes.Index(nuspec, []byte("</metadata>"))
+        if end < 0 {
+            return nil, fmt.Errorf("nuspec has no </metadata>")
+        }
+        element := []byte(`<repository type="git" url=` + value + ` />`)
+        return append(append(append([]byte{}, nuspec[:end]...), element...), nuspec[end:]...), nil
+    }
+
+    tag := nuspec[loc[0]:loc[1]]
+    urlAttribute := nuspecAttribute("url")
+    var rewritten []byte
+    if urlAttribute.Match(tag) {
+        rewritten = urlAttribute.ReplaceAll(tag, []byte(" url="+value))
+    } else {
+        // Before the closing > or />
+        end := loc[2] - loc[0]
+        rewritten = append(append(append([]byte{}, tag[:end]...), []byte(" url="+value)...), tag[end:]...)
+    }
+    if !nuspecAttribute("type").Match(rewritten) {
+        rewritten = bytes.Replace(rewritten, []byte("<repository"), []byte(`<repository type="git"`), 1)
+    }
+    return append(append(append([]byte{}, nuspec[:loc[0]]...), rewritten...), nuspec[loc[1]:]...), nil
+}
+
+// repackNupkg writes src to dst with the nuspec passed through edit. Every
+// other entry is copied raw, keeping its order, timestamps, compression and
+// bytes, so the same input always repacks to the same output. The signature
+// is dropped since it no longer matches
+func repackNupkg(src, dst string, edit func([]byte) ([]byte, error)) error {
+    reader, err := zip.OpenReader(src)
+    if err != nil {
+        return fmt.Errorf("failed to open nupkg: %v", err)
+    }
+    defer reader.Close()
+
+    out, err := os.Create(dst)
+    if err != nil {
+        return fmt.Errorf("failed to create repacked nupkg: %v", err)
+    }
+    defer out.Close()
+
+    writer := zip.NewWriter(out)
+    writer.SetComment(reader.Comment)
+    for _, file := range reader.File {
+        switch {
+        case file.Name == nugetSignature:
+            continue
+        case !strings.Contains(file.Name, "/") && strings.HasSuffix(file.Name, ".nuspec"):
+            rc, err := file.Open()
+            if err != nil {
+                return fmt.Errorf("failed to open nuspec: %v", err)
+            }
+            nuspec, err := io.ReadAll(rc)
+            rc.Close()
+            if err != nil {
+                return fmt.Errorf("failed to read nuspec: %v", err)
+            }
+            if nuspec, err = edit(nuspec); err != nil {
+                return fmt.Errorf("failed to rewrite nuspec: %v", err)
+            }
+
+            header := file.FileHeader
+            w, err := writer.CreateHeader(&header)
+            if err != nil {
+                return err
+            }
+            if _, err := w.Write(nuspec); err != nil {
+                return err
+            }
+        default:
+            if err := writer.Copy(file); err != nil {
+                return fmt.Errorf("failed to copy %s: %v", file.Name, err)
+            }
+        }
+    }
+    if err := writer.Close(); err != nil {
+        return fmt.Errorf("failed to write repacked nupkg: %v", err)
+    }
+    return nil
+}
+
+// prepareNuGetPackage validates a .nupkg and, unless rewrites are off,
+// repacks it into the staging directory with the nuspec repository
+// pointing at the target organization. It returns the path to upload
+func (a *API) prepareNuGetPackage(opts UploadOptions, nupkgPath string) (string, error) {
     // Parse and validate .nupkg
     manifest, err := parseNuspec(nupkgPath)
     if err != nil {
-        return err
+        return "", err
     }
 
     // Validate required fields
     if manifest.Metadata.ID == "" {
-        return fmt.Errorf("nuspec missing required field: id")
+        return "", fmt.Errorf("nuspec missing required field: id")
     }
     if manifest.Metadata.Version == "" {
-        return fmt.Errorf("nuspec missing required field: version")
+        return "", fmt.Errorf("nuspec missing required field: version")
+    }
+    if err := validateTargetFrameworks(manifest); err != nil {
+        return "", err
     }
 
-    // Update repository information
-    manifest.Metadata.Repository.Type = "git"
-    manifest.Metadata.Repository.URL = fmt.Sprintf("https://github.com/%s/%s",
-        opts.Organization, manifest.Metadata.ID)
+    if a.noRewrite {
+        return nupkgPath, nil
+    }
 
-    return nil
+    // Update repository information
+    repository := fmt.Sprintf("https://github.com/%s/%s", opts.Organization, manifest.Metadata.ID)
+    if opts.Repository != "" {
+        repository = opts.Repository
+    }
+    staging := opts.Staging
+    if staging == "" {
+        staging = filepath.Dir(nupkgPath)
+    }
+    dir := filepath.Join(staging, "repacked")
+    if err := os.MkdirAll(dir, 0755); err != nil {
+        return "", fmt.Errorf("failed to create repack directory: %v", err)
+    }
+    repacked := filepath.Join(dir, filepath.Base(nupkgPath))
+    err = repackNupkg(nupkgPath, repacked, func(nuspec []byte) ([]byte, error) {
+        nuspec, err := rewriteNuspecRepository(nuspec, repository)
+        if err != nil || opts.Note == "" {
+            return nuspec, err
+        }
+        return rewriteNuspecDescription(nuspec, opts.Note, opts.NotePlacement)
+    })
+    if err != nil {
+        return "", err
+    }
+    if opts.Uploaded != nil {
+        for i, file := range *opts.Uploaded {
+            if file == nupkgPath {
+                (*opts.Uploaded)[i] = repacked
+            }
+        }
+    }
+    return repacked, nil
 }
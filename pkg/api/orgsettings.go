@@ -0,0 +1,37 @@
+package api
+
+import (
+    "fmt"
+    "strings"
+)
+
+// GetOrganizationSettings returns the settings of org as the REST API
+// reports them. Fields only visible to owners are missing for other tokens
+func (a *API) GetOrganizationSettings(org string) (map[string]interface{}, error) {
+    var settings map[string]interface{}
+    if err := a.restJSON("GET", fmt.Sprintf("%s/orgs/%s", a.restBaseURL(), org), nil, &settings); err != nil {
+        return nil, fmt.Errorf("failed to get settings of %s: %v", org, err)
+    }
+    return settings, nil
+}
+
+// UpdateOrganizationSettings changes the given settings of org, which
+// needs an owner's token
+func (a *API) UpdateOrganizationSettings(org string, settings map[string]interface{}) error {
+    if err := a.restJSON("PATCH", fmt.Sprintf("%s/orgs/%s", a.restBaseURL(), org), settings, nil); err != nil {
+        return fmt.Errorf("failed to update settings of %s: %v", org, err)
+    }
+    return nil
+}
+
+// PackageSettingsURL returns the web page holding org's package settings
+func (a *API) PackageSettingsURL(org string) string {
+    host := "github.com"
+    if a.hostname != "" {
+        host = strings.TrimSuffix(a.hostname, "/")
+        if i := strings.Index(host, "://"); i >= 0 {
+            host = host[i+3:]
+        }
+    }
+    return fmt.Sprintf("https://%s/organizations/%s/settings/packages", host, org)
+}
@@ -0,0 +1,174 @@
+package api
+
+import (
+    "bufio"
+    "encoding/json"
+    "fmt"
+    "io"
+    "net/http"
+    "net/url"
+    "strings"
+)
+
+// Ways an owner was inferred
+const (
+    OwnerSourceCodeowners = "codeowners"
+    OwnerSourceTopics     = "topics"
+)
+
+// Where GitHub looks for a CODEOWNERS file, in order
+var codeownersPaths = []string{".github/CODEOWNERS", "CODEOWNERS", "docs/CODEOWNERS"}
+
+// Topics naming an owning team, e.g. team-platform or owner-payments
+var ownerTopicPrefixes = []string{"team-", "owner-", "owned-by-"}
+
+// InferOwners guesses the teams or users owning the repository at repoURL,
+// first from the catch-all rule of its CODEOWNERS file and then from topics
+// like team-platform. It returns no owners if neither is present
+func (a *API) InferOwners(repoURL string) ([]string, string, error) {
+    owner, repo, err := splitRepositoryURL(repoURL)
+    if err != nil {
+        return nil, "", err
+    }
+
+    for _, path := range codeownersPaths {
+        content, err := a.getRepositoryFile(owner, repo, path)
+        if err != nil {
+            return nil, "", err
+        }
+        if content == "" {
+            continue
+        }
+        if owners := parseCodeowners(content); len(owners) > 0 {
+            return owners, OwnerSourceCodeowners, nil
+        }
+    }
+
+    topics, err := a.getRepositoryTopics(owner, repo)
+    if err != nil {
+        return nil, "", err
+    }
+
+    var owners []string
+    for _, topic := range topics {
+        for _, prefix := range ownerTopicPrefixes {
+            if strings.HasPrefix(topic, prefix) {
+                owners = append(owners, fmt.Sprintf("@%s/%s", owner, strings.TrimPrefix(topic, prefix)))
+                break
+            }
+        }
+    }
+    if len(owners) > 0 {
+        return owners, OwnerSourceTopics, nil
+    }
+
+    return nil, "", nil
+}
+
+// parseCodeowners returns the owners of the last "*" rule, which own any
+// file not claimed by a narrower rule, or failing that every listed owner
+func parseCodeowners(content string) []string {
+    var catchAll []string
+    seen := make(map[string]bool)
+    var all []string
+
+    scanner := bufio.NewScanner(strings.NewReader(content))
+    for scanner.Scan() {
+        line := strings.TrimSpace(scanner.Text())
+        if i := strings.Index(line, "#"); i >= 0 {
+            line = strings.TrimSpace(line[:i])
+        }
+        fields := strings.Fields(line)
+        if len(fields) < 2 {
+            continue
+        }
+
+        if fields[0] == "*" || fields[0] == "/*" || fields[0] == "/" {
+            catchAll = fields[1:]
+        }
+        for _, owner := range fields[1:] {
+            if !seen[owner] {
+                seen[owner] = true
+                all = append(all, owner)
+            }
+        }
+    }
+
+    if len(catchAll) > 0 {
+        return catchAll
+    }
+    return all
+}
+
+// getRepositoryFile returns a file's raw content, or "" if it doesn't exist
+func (a *API) getRepositoryFile(owner, repo, path string) (string, error) {
+    fileURL := fmt.Sprintf("%s/repos/%s/%s/contents/%s", a.restBaseURL(), owner, repo, path)
+    req, err := http.NewRequestWithContext(a.ctx, "GET", fileURL, nil)
+    if err != nil {
+        return "", err
+    }
+
+    req.Header.Set("Accept", "application/vnd.github.raw")
+    req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", a.token))
+
+    resp, err := a.client.Do(req)
+    if err != nil {
+        return "", fmt.Errorf("failed to fetch %s: %v", path, err)
+    }
+    defer resp.Body.Close()
+
+    if resp.StatusCode == http.StatusNotFound {
+        return "", nil
+    }
+    if resp.StatusCode != http.StatusOK {
+        return "", fmt.Errorf("request for %s/%s/%s failed with status: %s", owner, repo, path, resp.Status)
+    }
+
+    data, err := io.ReadAll(resp.Body)
+    if err != nil {
+        return "", fmt.Errorf("failed to read %s: %v", path, err)
+    }
+    return string(data), nil
+}
+
+func (a *API) getRepositoryTopics(owner, repo string) ([]string, error) {
+    req, err := http.NewRequestWithContext(a.ctx, "GET", fmt.Sprintf("%s/repos/%s/%s/topics", a.restBaseURL(), owner, repo), nil)
+    if err != nil {
+        return nil, err
+    }
+
+    req.Header.Set("Accept", "application/vnd.github+json")
+    req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", a.token))
+
+    resp, err := a.client.Do(req)
+    if err != nil {
+        return nil, fmt.Errorf("failed to fetch topics: %v", err)
+    }
+    defer resp.Body.Close()
+
+    if resp.StatusCode != http.StatusOK {
+        return nil, fmt.Errorf("topics request for %s/%s failed with status: %s", owner, repo, resp.Status)
+    }
+
+    var topics struct {
+        Names []string `json:"names"`
+    }
+    if err := json.NewDecoder(resp.Body).Decode(&topics); err != nil {
+        return nil, fmt.Errorf("failed to parse topics: %v", err)
+    }
+    return topics.Names, nil
+}
+
+// splitRepositoryURL extracts owner and name from a repository's web URL
+func splitRepositoryURL(repoURL string) (string, string, error) {
+    u, err := url.Parse(repoURL)
+    if err != nil {
+        return "", "", fmt.Errorf("invalid repository url %q: %v", repoURL, err)
+    }
+
+    parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+    if len(parts) < 2 {
+        return "", "", fmt.Errorf("invalid repository url %q", repoURL)
+    }
+    return parts[0], strings.TrimSuffix(parts[1], ".git"), nil
+}
@@ -0,0 +1,129 @@
+package api
+
+import (
+    "encoding/json"
+    "fmt"
+    "io"
+    "net/http"
+    "net/url"
+    "strings"
+)
+
+// TokenInfo is what GitHub tells about the token an API authenticates with
+type TokenInfo struct {
+    Login string
+    // Scopes are only listed for classic tokens. Fine-grained and GitHub
+    // App tokens have permissions instead, which can't be read ahead of use
+    Scopes  []string
+    Classic bool
+}
+
+// HasScope reports whether the token was granted scope, or a scope that
+// includes it, as write:packages includes read:packages
+func (t TokenInfo) HasScope(scope string) bool {
+    for _, granted := range t.Scopes {
+        if granted == scope {
+            return true
+        }
+        if scope == "read:packages" && (granted == "write:packages" || granted == "delete:packages") {
+            return true
+        }
+    }
+    return false
+}
+
+// AccessError is a request the token isn't allowed to make. SSOURL is set
+// when the organization enforces SAML single sign-on and the token hasn't
+// been authorized for it, and is where to authorize it
+type AccessError struct {
+    Status int
+    SSOURL string
+    Detail string
+}
+
+func (e *AccessError) Error() string {
+    if e.SSOURL != "" {
+        return fmt.Sprintf("the token isn't authorized for SAML SSO, authorize it at %s", e.SSOURL)
+    }
+    if e.Detail == "" {
+        return fmt.Sprintf("status %d %s", e.Status, http.StatusText(e.Status))
+    }
+    return fmt.Sprintf("status %d %s: %s", e.Status, http.StatusText(e.Status), e.Detail)
+}
+
+// GetTokenInfo reads who the token belongs to and the scopes it was granted
+func (a *API) GetTokenInfo() (TokenInfo, error) {
+    resp, err := a.preflight(a.restBaseURL() + "/user")
+    if err != nil {
+        return TokenInfo{}, err
+    }
+    defer resp.Body.Close()
+
+    var user struct {
+        Login string `json:"login"`
+    }
+    if err := json.NewDecoder(resp.Body).Decode(&user); err != nil {
+        return TokenInfo{}, fmt.Errorf("failed to parse response: %v", err)
+    }
+
+    info := TokenInfo{Login: user.Login}
+    if header, ok := resp.Header["X-Oauth-Scopes"]; ok {
+        info.Classic = true
+        for _, scope := range strings.Split(strings.Join(header, ","), ",") {
+            if scope = strings.TrimSpace(scope); scope != "" {
+                info.Scopes = append(info.Scopes, scope)
+            }
+        }
+    }
+    return info, nil
+}
+
+// CheckOrganization makes sure org exists and its packages of packageType
+// can be listed with the token, which fails for tokens missing
+// read:packages or SAML SSO authorization
+func (a *API) CheckOrganization(org, packageType string) error {
+    resp, err := a.preflight(fmt.Sprintf("%s/orgs/%s", a.restBaseURL(), url.PathEscape(org)))
+    if err != nil {
+        if access, ok := err.(*AccessError); ok && access.Status == http.StatusNotFound {
+            return fmt.Errorf("organization %s not found, or not visible to the token", org)
+        }
+        return err
+    }
+    resp.Body.Close()
+
+    resp, err = a.preflight(fmt.Sprintf("%s/orgs/%s/packages?package_type=%s&per_page=1", a.restBaseURL(), url.PathEscape(org), url.QueryEscape(packageType)))
+    if err != nil {
+        return err
+    }
+    resp.Body.Close()
+    return nil
+}
+
+// preflight sends an authenticated GET and turns responses outside 2xx
+// into an AccessError
+func (a *API) preflight(endpoint string) (*http.Response, error) {
+    resp, err := a.Fetch(http.MethodGet, endpoint, http.Header{"Accept": {"application/vnd.github+json"}})
+    if err != nil {
+        return nil, err
+    }
+    if resp.StatusCode >= 200 && resp.StatusCode <= 299 {
+        return resp, nil
+    }
+    defer resp.Body.Close()
+
+    detail, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+    access := &AccessError{Status: resp.StatusCode, Detail: strings.TrimSpace(string(detail))}
+    var message struct {
+        Message string `json:"message"`
+    }
+    if json.Unmarshal(detail, &message) == nil && message.Message != "" {
+        access.Detail = message.Message
+    }
+    // X-GitHub-SSO: required; url=https://github.com/orgs/<org>/sso?authorization_request=...
+    for _, part := range strings.Split(resp.Header.Get("X-GitHub-SSO"), ";") {
+        if value, ok := strings.CutPrefix(strings.TrimSpace(part), "url="); ok {
+            access.SSOURL = value
+        }
+    }
+    return nil, access
+}
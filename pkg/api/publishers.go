@@ -0,0 +1,103 @@
+package api
+
+import (
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "net/url"
+    "regexp"
+    "time"
+)
+
+// Publisher is the account that published a package version on the source
+type Publisher struct {
+    Login       string
+    PublishedAt string
+}
+
+var linkNextPattern = regexp.MustCompile(`<([^>]+)>;\s*rel="next"`)
+
+// GetPackagePublishers reads the organization audit log for package publish
+// events and returns the publishing login keyed by package name and version
+// (see PublisherKey). The audit log needs an org owner token with
+// read:audit_log; it only reaches back as far as the instance retains events
+func (a *API) GetPackagePublishers(org string) (map[string]Publisher, error) {
+    query := url.Values{}
+    query.Set("phrase", "action:packages.package_version_published")
+    query.Set("per_page", "100")
+    next := fmt.Sprintf("%s/orgs/%s/audit-log?%s", a.restBaseURL(), url.PathEscape(org), query.Encode())
+
+    publishers := make(map[string]Publisher)
+    for next != "" {
+        req, err := http.NewRequestWithContext(a.ctx, "GET", next, nil)
+        if err != nil {
+            return nil, err
+        }
+
+        req.Header.Set("Accept", "application/vnd.github+json")
+        req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", a.token))
+
+        resp, err := a.client.Do(req)
+        if err != nil {
+            return nil, fmt.Errorf("failed to query audit log: %v", err)
+        }
+
+        if resp.StatusCode != http.StatusOK {
+            resp.Body.Close()
+            return nil, fmt.Errorf("audit log request failed with status: %s", resp.Status)
+        }
+
+        var events []map[string]interface{}
+        err = json.NewDecoder(resp.Body).Decode(&events)
+        resp.Body.Close()
+        if err != nil {
+            return nil, fmt.Errorf("failed to parse audit log: %v", err)
+        }
+
+        for _, event := range events {
+            name := eventString(event, "package", "package_name", "name")
+            version := eventString(event, "version", "package_version")
+            actor := eventString(event, "actor")
+            if name == "" || version == "" || actor == "" {
+                continue
+            }
+
+            // Events come newest first, keep the first publish we see
+            key := PublisherKey(name, version)
+            if _, exists := publishers[key]; exists {
+                continue
+            }
+            publishers[key] = Publisher{Login: actor, PublishedAt: eventTime(event)}
+        }
+
+        next = ""
+        if m := linkNextPattern.FindStringSubmatch(resp.Header.Get("Link")); m != nil {
+            next = m[1]
+        }
+    }
+
+    return publishers, nil
+}
+
+// PublisherKey identifies a package version in the publishers map
+func PublisherKey(packageName, version string) string {
+    return packageName + "@" + version
+}
+
+func eventString(event map[string]interface{}, keys ...string) string {
+    for _, key := range keys {
+        if s, ok := event[key].(string); ok && s != "" {
+            return s
+        }
+    }
+    return ""
+}
+
+// eventTime converts the audit log's millisecond timestamp to RFC 3339
+func eventTime(event map[string]interface{}) string {
+    ms, ok := event["@timestamp"].(float64)
+    if !ok {
+        return ""
+    }
+    return time.UnixMilli(int64(ms)).UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,166 @@
+package api
+
+import (
+    "crypto/sha256"
+    "encoding/json"
+    "fmt"
+    "io"
+    "net/http"
+    "os"
+    "path/filepath"
+    "strings"
+)
+
+// Images are listed, pulled and pushed with the registry HTTP API alone, so
+// the container path never needs a Docker daemon or socket; some migrations
+// run on locked-down bastion hosts that have neither
+
+// imageBaseURL is the registry API prefix of org/name
+func (a *API) imageBaseURL(org, name string) string {
+    return fmt.Sprintf("https://%s/v2/%s/%s", a.ContainerRegistry(), org, name)
+}
+
+// ListImageTags returns every tag of org/name, following the registry's
+// Link header across pages
+func (a *API) ListImageTags(org, name string) ([]string, error) {
+    var tags []string
+    next := a.imageBaseURL(org, name) + "/tags/list?n=1000"
+    for next != "" {
+        req, err := http.NewRequestWithContext(a.ctx, "GET", next, nil)
+        if err != nil {
+            return nil, err
+        }
+        req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", a.token))
+
+        resp, err := a.client.Do(req)
+        if err != nil {
+            return nil, fmt.Errorf("failed to list tags: %v", err)
+        }
+
+        var page struct {
+            Tags []string `json:"tags"`
+        }
+        if resp.StatusCode != http.StatusOK {
+            resp.Body.Close()
+            return nil, fmt.Errorf("tag list request for %s failed with status: %s", name, resp.Status)
+        }
+        err = json.NewDecoder(resp.Body).Decode(&page)
+        link := resp.Header.Get("Link")
+        resp.Body.Close()
+        if err != nil {
+            return nil, fmt.Errorf("failed to parse tag list: %v", err)
+        }
+
+        tags = append(tags, page.Tags...)
+        next = nextLink(next, link)
+    }
+    return tags, nil
+}
+
+// nextLink resolves the rel="next" target of a Link header against current
+func nextLink(current, header string) string {
+    for _, part := range strings.Split(header, ",") {
+        part = strings.TrimSpace(part)
+        if !strings.Contains(part, `rel="next"`) {
+            continue
+        }
+        start, end := strings.Index(part, "<"), strings.Index(part, ">")
+        if start < 0 || end <= start {
+            return ""
+        }
+        return resolveURL(current, part[start+1:end])
+    }
+    return ""
+}
+
+// PullImage downloads the manifest, config and layers of org/name:reference
+// into dir, verifying every blob against its digest. Layers are written as
+// .tar.gz files so ContainerUpload picks them up; the manifest and config
+// keep their raw bytes in manifest.json and config.json
+func (a *API) PullImage(org, name, reference, dir string) ([]string, error) {
+    baseURL := a.imageBaseURL(org, name)
+
+    req, err := http.NewRequestWithContext(a.ctx, "GET", fmt.Sprintf("%s/manifests/%s", baseURL, reference), nil)
+    if err != nil {
+        return nil, err
+    }
+    req.Header.Set("Accept", manifestAccept)
+    req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", a.token))
+
+    resp, err := a.client.Do(req)
+    if err != nil {
+        return nil, fmt.Errorf("failed to fetch manifest: %v", err)
+    }
+    raw, err := io.ReadAll(resp.Body)
+    resp.Body.Close()
+    if err != nil {
+        return nil, fmt.Errorf("failed to read manifest: %v", err)
+    }
+    if resp.StatusCode != http.StatusOK {
+        return nil, fmt.Errorf("manifest request for %s failed with status: %s", reference, resp.Status)
+    }
+
+    var manifest ContainerManifest
+    if err := json.Unmarshal(raw, &manifest); err != nil {
+        return nil, fmt.Errorf("failed to parse manifest: %v", err)
+    }
+    if manifest.MediaType == mediaTypeManifestList || manifest.MediaType == mediaTypeOCIIndex {
+        return nil, fmt.Errorf("%s:%s is a multi-platform index, pull each platform's manifest by digest", name, reference)
+    }
+
+    manifestFile := filepath.Join(dir, "manifest.json")
+    if err := os.WriteFile(manifestFile, raw, 0644); err != nil {
+        return nil, fmt.Errorf("failed to write manifest: %v", err)
+    }
+    files := []string{manifestFile}
+
+    configFile := filepath.Join(dir, "config.json")
+    if err := a.pullBlob(baseURL, manifest.Config.Digest, configFile); err != nil {
+        return files, err
+    }
+    files = append(files, configFile)
+
+    for i, layer := range manifest.Layers {
+        layerFile := filepath.Join(dir, fmt.Sprintf("layer-%03d.tar.gz", i))
+        if err := a.pullBlob(baseURL, layer.Digest, layerFile); err != nil {
+            return files, err
+        }
+        files = append(files, layerFile)
+    }
+    return files, nil
+}
+
+// pullBlob streams a blob to path and fails if its content doesn't hash to
+// digest, so a truncated or tampered download is never pushed
+func (a *API) pullBlob(baseURL, digest, path string) error {
+    req, err := http.NewRequestWithContext(a.ctx, "GET", fmt.Sprintf("%s/blobs/%s", baseURL, digest), nil)
+    if err != nil {
+        return err
+    }
+    req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", a.token))
+
+    resp, err := a.client.Do(req)
+    if err != nil {
+        return fmt.Errorf("failed to fetch blob: %v", err)
+    }
+    defer resp.Body.Close()
+
+    if resp.StatusCode != http.StatusOK {
+        return fmt.Errorf("blob request for %s failed with status: %s", digest, resp.Status)
+    }
+
+    f, err := os.Create(path)
+    if err != nil {
+        return fmt.Errorf("failed to create %s: %v", path, err)
+    }
+    defer f.Close()
+
+    hash := sha256.New()
+    if _, err := io.Copy(io.MultiWriter(f, hash), resp.Body); err != nil {
+        return fmt.Errorf("failed to download blob %s: %v", digest, err)
+    }
+    if got := fmt.Sprintf("sha256:%x", hash.Sum(nil)); got != digest {
+        return fmt.Errorf("blob %s downloaded with digest %s", digest, got)
+    }
+    return nil
+}
@@ -0,0 +1,404 @@
+package api
+
+import (
+    "bytes"
+    "context"
+    "crypto/sha256"
+    "encoding/json"
+    "fmt"
+    "io"
+    "net/http"
+    "net/http/httptest"
+    "net/url"
+    "os"
+    "path/filepath"
+    "strconv"
+    "strings"
+    "sync"
+    "testing"
+)
+
+// testRegistry is an in-memory registry serving the parts of the
+// distribution API the container path uses, for one repository. Nothing
+// here needs a Docker daemon or socket
+type testRegistry struct {
+    repository string // e.g. /v2/octo-org/app/
+    pageSize   int
+
+    mu        sync.Mutex
+    tags      []string
+    blobs     map[string][]byte // by digest
+    manifests map[string][]byte // by tag or digest
+    uploaded  []string          // digests pushed, in order
+    requests  int
+}
+
+func newTestRegistry(org, name string) *testRegistry {
+    return &testRegistry{
+        repository: fmt.Sprintf("/v2/%s/%s/", org, name),
+        pageSize:   1000,
+        blobs:      make(map[string][]byte),
+        manifests:  make(map[string][]byte),
+    }
+}
+
+func digestOf(data []byte) string {
+    return fmt.Sprintf("sha256:%x", sha256.Sum256(data))
+}
+
+// addBlob stores data and returns its digest
+func (r *testRegistry) addBlob(data []byte) string {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    digest := digestOf(data)
+    r.blobs[digest] = data
+    return digest
+}
+
+// addImage stores a manifest of config and layers under tag
+func (r *testRegistry) addImage(t *testing.T, tag string, config []byte, layers ...[]byte) ContainerManifest {
+    manifest := ContainerManifest{
+        SchemaVersion: 2,
+        MediaType:     mediaTypeManifest,
+        Config:        ConfigObject{MediaType: mediaTypeConfig, Size: int64(len(config)), Digest: r.addBlob(config)},
+    }
+    for _, layer := range layers {
+        manifest.Layers = append(manifest.Layers, LayerObject{MediaType: mediaTypeLayer, Size: int64(len(layer)), Digest: r.addBlob(layer)})
+    }
+    data, err := json.Marshal(manifest)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    r.manifests[tag] = data
+    r.tags = append(r.tags, tag)
+    return manifest
+}
+
+func (r *testRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    r.requests++
+
+    if req.Header.Get("Authorization") != "Bearer token" {
+        http.Error(w, "unauthorized", http.StatusUnauthorized)
+        return
+    }
+    if !strings.HasPrefix(req.URL.Path, r.repository) {
+        http.NotFound(w, req)
+        return
+    }
+    path := strings.TrimPrefix(req.URL.Path, r.repository)
+
+    switch {
+    case path == "tags/list" && req.Method == "GET":
+        r.serveTags(w, req)
+
+    case strings.HasPrefix(path, "manifests/"):
+        reference := strings.TrimPrefix(path, "manifests/")
+        switch req.Method {
+        case "GET", "HEAD":
+            manifest, ok := r.manifests[reference]
+            if !ok {
+                http.NotFound(w, req)
+                return
+            }
+            w.Header().Set("Content-Type", mediaTypeManifest)
+            w.Write(manifest)
+        case "PUT":
+            data, _ := io.ReadAll(req.Body)
+            r.manifests[reference] = data
+            w.WriteHeader(http.StatusCreated)
+        }
+
+    case path == "blobs/uploads/" && req.Method == "POST":
+        // A relative location with a query, as the distribution spec allows
+        w.Header().Set("Location", fmt.Sprintf("%sblobs/uploads/%d?_state=opaque", r.repository, len(r.uploaded)))
+        w.WriteHeader(http.StatusAccepted)
+
+    case strings.HasPrefix(path, "blobs/uploads/") && req.Method == "PUT":
+        data, _ := io.ReadAll(req.Body)
+        digest := req.URL.Query().Get("digest")
+        if req.URL.Query().Get("_state") != "opaque" || digest != digestOf(data) {
+            http.Error(w, "digest invalid", http.StatusBadRequest)
+            return
+        }
+        r.blobs[digest] = data
+        r.uploaded = append(r.uploaded, digest)
+        w.WriteHeader(http.StatusCreated)
+
+    case strings.HasPrefix(path, "blobs/"):
+        blob, ok := r.blobs[strings.TrimPrefix(path, "blobs/")]
+        if !ok {
+            http.NotFound(w, req)
+            return
+        }
+        w.Header().Set("Content-Length", strconv.Itoa(len(blob)))
+        if req.Method == "GET" {
+            w.Write(blob)
+        }
+
+    default:
+        http.Error(w, "unsupported", http.StatusMethodNotAllowed)
+    }
+}
+
+// serveTags pages through the tags, pageSize at a time, linking the next page
+func (r *testRegistry) serveTags(w http.ResponseWriter, req *http.Request) {
+    start := 0
+    if last := req.URL.Query().Get("last"); last != "" {
+        for i, tag := range r.tags {
+            if tag == last {
+                start = i + 1
+            }
+        }
+    }
+    end := start + r.pageSize
+    if end >= len(r.tags) {
+        end = len(r.tags)
+    } else {
+        w.Header().Set("Link", fmt.Sprintf(`<%stags/list?n=%d&last=%s>; rel="next"`, r.repository, r.pageSize, r.tags[end-1]))
+    }
+    json.NewEncoder(w).Encode(map[string]interface{}{"tags": r.tags[start:end]})
+}
+
+// redirect sends every request to a test server, whichever registry host
+// it names, so the API's own registry URLs are exercised
+type redirect struct {
+    target *url.URL
+}
+
+func (r redirect) RoundTrip(req *http.Request) (*http.Response, error) {
+    req = req.Clone(req.Context())
+    req.URL.Scheme, req.URL.Host = r.target.Scheme, r.target.Host
+    return http.DefaultTransport.RoundTrip(req)
+}
+
+// registryAPI returns an API whose registry requests all go to registry
+func registryAPI(t *testing.T, registry http.Handler) *API {
+    server := httptest.NewServer(registry)
+    t.Cleanup(server.Close)
+    target, err := url.Parse(server.URL)
+    if err != nil {
+        t.Fatal(err)
+    }
+    return &API{
+        ctx:    context.Background(),
+        token:  "token",
+        client: &http.Client{Transport: redirect{target: target}},
+    }
+}
+
+func TestListImageTags(t *testing.T) {
+    tests := []struct {
+        name     string
+        tags     []string
+        pageSize int
+        requests int
+    }{
+        {"one page", []string{"1.0", "1.1", "latest"}, 1000, 1},
+        {"several pages", []string{"a", "b", "c", "d", "e"}, 2, 3},
+        {"exact pages", []string{"a", "b", "c", "d"}, 2, 2},
+        {"no tags", nil, 1000, 1},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            registry := newTestRegistry("octo-org", "app")
+            registry.tags, registry.pageSize = tt.tags, tt.pageSize
+            api := registryAPI(t, registry)
+
+            tags, err := api.ListImageTags("octo-org", "app")
+            if err != nil {
+                t.Fatal(err)
+            }
+            if strings.Join(tags, ",") != strings.Join(tt.tags, ",") {
+                t.Errorf("tags = %v, want %v", tags, tt.tags)
+            }
+            if registry.requests != tt.requests {
+                t.Errorf("made %d requests, want %d", registry.requests, tt.requests)
+            }
+        })
+    }
+}
+
+func TestListImageTagsFails(t *testing.T) {
+    api := registryAPI(t, newTestRegistry("octo-org", "app"))
+    if _, err := api.ListImageTags("octo-org", "missing"); err == nil || !strings.Contains(err.Error(), "404") {
+        t.Errorf("err = %v, want a 404", err)
+    }
+}
+
+func TestPullImage(t *testing.T) {
+    config := []byte(`{"architecture":"amd64","os":"linux"}`)
+    layers := [][]byte{[]byte("layer one"), []byte("layer two")}
+
+    tests := []struct {
+        name    string
+        setup   func(t *testing.T, r *testRegistry) string // returns the reference to pull
+        files   int
+        wantErr string
+    }{
+        {
+            name: "by tag",
+            setup: func(t *testing.T, r *testRegistry) string {
+                r.addImage(t, "1.0", config, layers...)
+                return "1.0"
+            },
+            files: 4,
+        },
+        {
+            name: "by digest",
+            setup: func(t *testing.T, r *testRegistry) string {
+                r.addImage(t, "1.0", config, layers...)
+                digest := digestOf(r.manifests["1.0"])
+                r.manifests[digest] = r.manifests["1.0"]
+                return digest
+            },
+            files: 4,
+        },
+        {
+            name: "corrupt layer",
+            setup: func(t *testing.T, r *testRegistry) string {
+                manifest := r.addImage(t, "1.0", config, layers...)
+                r.blobs[manifest.Layers[1].Digest] = []byte("tampered")
+                return "1.0"
+            },
+            files:   3,
+            wantErr: "downloaded with digest",
+        },
+        {
+            name: "missing config",
+            setup: func(t *testing.T, r *testRegistry) string {
+                manifest := r.addImage(t, "1.0", config, layers...)
+                delete(r.blobs, manifest.Config.Digest)
+                return "1.0"
+            },
+            files:   1,
+            wantErr: "404",
+        },
+        {
+            name: "multi-platform index",
+            setup: func(t *testing.T, r *testRegistry) string {
+                r.manifests["1.0"] = []byte(`{"schemaVersion":2,"mediaType":"` + mediaTypeOCIIndex + `","manifests":[]}`)
+                return "1.0"
+            },
+            wantErr: "multi-platform index",
+        },
+        {
+            name:    "unknown tag",
+            setup:   func(t *testing.T, r *testRegistry) string { return "2.0" },
+            wantErr: "404",
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            registry := newTestRegistry("octo-org", "app")
+            reference := tt.setup(t, registry)
+            api := registryAPI(t, registry)
+
+            dir := t.TempDir()
+            files, err := api.PullImage("octo-org", "app", reference, dir)
+            if tt.wantErr != "" {
+                if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+                    t.Fatalf("err = %v, want one containing %q", err, tt.wantErr)
+                }
+            } else if err != nil {
+                t.Fatal(err)
+            }
+            if len(files) != tt.files {
+                t.Fatalf("pulled %d files, want %d: %v", len(files), tt.files, files)
+            }
+            if tt.wantErr != "" {
+                return
+            }
+
+            want := append([][]byte{registry.manifests[reference], config}, layers...)
+            for i, file := range files {
+                data, err := os.ReadFile(file)
+                if err != nil {
+                    t.Fatal(err)
+                }
+                if !bytes.Equal(data, want[i]) {
+                    t.Errorf("%s holds %q, want %q", filepath.Base(file), data, want[i])
+                }
+            }
+        })
+    }
+}
+
+func TestContainerUploadPushesPulledImage(t *testing.T) {
+    config := []byte(`{"architecture":"amd64","os":"linux"}`)
+    layers := [][]byte{[]byte("base layer"), []byte("app layer")}
+
+    source := newTestRegistry("source-org", "app")
+    pulled := source.addImage(t, "1.0", config, layers...)
+    files, err := registryAPI(t, source).PullImage("source-org", "app", "1.0", t.TempDir())
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    // The target already has the base layer, only the other one is pushed
+    target := newTestRegistry("target-org", "app")
+    target.addBlob(layers[0])
+    uploads := NewUploadManager(registryAPI(t, target))
+    err = uploads.ContainerUpload(context.Background(), UploadOptions{
+        Organization: "target-org",
+        PackageName:  "app",
+        Version:      "1.0",
+        Files:        files,
+    })
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    if len(target.uploaded) != 1 || target.uploaded[0] != pulled.Layers[1].Digest {
+        t.Errorf("pushed %v, want only %s", target.uploaded, pulled.Layers[1].Digest)
+    }
+
+    var pushed ContainerManifest
+    if err := json.Unmarshal(target.manifests["1.0"], &pushed); err != nil {
+        t.Fatalf("no manifest pushed for 1.0: %v", err)
+    }
+    if len(pushed.Layers) != len(pulled.Layers) {
+        t.Fatalf("pushed manifest has %d layers, want %d", len(pushed.Layers), len(pulled.Layers))
+    }
+    for i, layer := range pushed.Layers {
+        if layer.Digest != pulled.Layers[i].Digest {
+            t.Errorf("layer %d is %s, want %s", i, layer.Digest, pulled.Layers[i].Digest)
+        }
+    }
+}
+
+func TestUploadContainerLayerRejected(t *testing.T) {
+    registry := newTestRegistry("octo-org", "app")
+    api := registryAPI(t, registry)
+
+    file := filepath.Join(t.TempDir(), "layer-000.tar.gz")
+    if err := os.WriteFile(file, []byte("layer"), 0644); err != nil {
+        t.Fatal(err)
+    }
+
+    // The registry refuses content that doesn't match the digest
+    err := api.uploadContainerLayer(api.imageBaseURL("octo-org", "app"), file, digestOf([]byte("other")))
+    if err == nil || !strings.Contains(err.Error(), "400") {
+        t.Errorf("err = %v, want a 400", err)
+    }
+}
+
+func TestExistingBlobs(t *testing.T) {
+    registry := newTestRegistry("octo-org", "app")
+    have := registry.addBlob([]byte("present"))
+    missing := digestOf([]byte("absent"))
+    api := registryAPI(t, registry)
+
+    for _, concurrency := range []int{0, 1, 4} {
+        existing := api.existingBlobs(api.imageBaseURL("octo-org", "app"), []string{have, missing}, concurrency)
+        if !existing[have] || existing[missing] || len(existing) != 1 {
+            t.Errorf("concurrency %d: existing = %v, want only %s", concurrency, existing, have)
+        }
+    }
+}
@@ -0,0 +1,405 @@
+package api
+
+import (
+    "bytes"
+    "crypto/sha256"
+    "encoding/json"
+    "fmt"
+    "io"
+    "log"
+    "net/http"
+    "path/filepath"
+    "strings"
+
+    "github.com/cvega/gh-migrate-packages/pkg/run"
+)
+
+// Ways a registry links signatures, attestations and SBOMs to an image
+const (
+    ReferrersAPI       = "referrers"  // the OCI 1.1 referrers API, artifacts name their subject
+    ReferrersTagSchema = "tag-schema" // cosign's sha256-<hex>.sig, .att and .sbom tags
+)
+
+// Artifact kinds of the cosign tag schema, which are its tag suffixes
+var tagSchemaKinds = []string{"sig", "att", "sbom"}
+
+// artifactKinds maps artifact and config media types to their tag schema
+// kind; other artifact types have no tag to fall back to
+var artifactKinds = map[string]string{
+    "application/vnd.dev.cosign.artifact.sig.v1+json":  "sig",
+    "application/vnd.dev.cosign.simplesigning.v1+json": "sig",
+    "application/vnd.dev.cosign.artifact.att.v1+json":  "att",
+    "application/vnd.dsse.envelope.v1+json":            "att",
+    "application/vnd.in-toto+json":                     "att",
+    "application/vnd.dev.sigstore.bundle.v0.3+json":    "att",
+    "application/vnd.dev.cosign.artifact.sbom.v1+json": "sbom",
+    "application/spdx+json":                            "sbom",
+    "application/vnd.cyclonedx+json":                   "sbom",
+}
+
+// kindArtifactTypes is the artifact type given to tag schema artifacts
+// pushed to a registry with the referrers API
+var kindArtifactTypes = map[string]string{
+    "sig":  "application/vnd.dev.cosign.artifact.sig.v1+json",
+    "att":  "application/vnd.dev.cosign.artifact.att.v1+json",
+    "sbom": "application/vnd.dev.cosign.artifact.sbom.v1+json",
+}
+
+// Attached is an artifact attached to an image, such as a signature
+type Attached struct {
+    Digest       string
+    ArtifactType string
+    Kind         string // sig, att or sbom, empty when the tag schema has none
+}
+
+// referrersManifest is an artifact manifest, keeping the fields this tool
+// doesn't touch as they are
+type referrersManifest map[string]json.RawMessage
+
+type referrersDescriptor struct {
+    MediaType    string `json:"mediaType"`
+    Digest       string `json:"digest"`
+    Size         int64  `json:"size"`
+    ArtifactType string `json:"artifactType,omitempty"`
+}
+
+// ReferrersStrategy probes whether the registry of org/name serves the
+// referrers API, falling back to the tag schema when it doesn't. The answer
+// is kept for the rest of the run, it is the same for every repository
+func (a *API) ReferrersStrategy(org, name string) string {
+    a.referrersMu.Lock()
+    defer a.referrersMu.Unlock()
+    if a.referrersStrategy != "" {
+        return a.referrersStrategy
+    }
+
+    // A registry without the API answers 404 for any subject
+    probe := "sha256:" + strings.Repeat("0", 64)
+    req, err := http.NewRequestWithContext(a.ctx, "GET", fmt.Sprintf("%s/referrers/%s", a.imageBaseURL(org, name), probe), nil)
+    if err != nil {
+        return ReferrersTagSchema
+    }
+    req.Header.Set("Accept", mediaTypeOCIIndex)
+    req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", a.token))
+
+    a.referrersStrategy = ReferrersTagSchema
+    resp, err := a.client.Do(req)
+    if err != nil {
+        log.Printf("Referrers API probe of %s failed, using the tag schema: %v", a.ContainerRegistry(), err)
+        return a.referrersStrategy
+    }
+    resp.Body.Close()
+    if resp.StatusCode == http.StatusOK && strings.HasPrefix(resp.Header.Get("Content-Type"), mediaTypeOCIIndex) {
+        a.referrersStrategy = ReferrersAPI
+    }
+    log.Printf("Registry %s attaches artifacts with the %s strategy", a.ContainerRegistry(), a.referrersStrategy)
+    return a.referrersStrategy
+}
+
+// ListAttached returns the artifacts attached to org/name@digest, through
+// the referrers API when the registry has it and the tag schema either way,
+// since cosign pushes to tags by default
+func (a *API) ListAttached(org, name, digest string) ([]Attached, error) {
+    baseURL := a.imageBaseURL(org, name)
+    seen := make(map[string]bool)
+    var attached []Attached
+
+    if a.ReferrersStrategy(org, name) == ReferrersAPI {
+        var index struct {
+            Manifests []referrersDescriptor `json:"manifests"`
+        }
+        if err := a.registryJSON(fmt.Sprintf("%s/referrers/%s", baseURL, digest), mediaTypeOCIIndex, &index); err != nil {
+            return nil, fmt.Errorf("failed to list referrers of %s@%s: %v", name, digest, err)
+        }
+        for _, m := range index.Manifests {
+            seen[m.Digest] = true
+            attached = append(attached, Attached{Digest: m.Digest, ArtifactType: m.ArtifactType, Kind: artifactKinds[m.ArtifactType]})
+        }
+    }
+
+    for _, kind := range tagSchemaKinds {
+        found, err := a.headManifest(baseURL, tagSchemaTag(digest, kind))
+        if err != nil {
+            return nil, err
+        }
+        if found == nil || seen[found.Digest] {
+            continue
+        }
+        seen[found.Digest] = true
+        attached = append(attached, Attached{Digest: found.Digest, ArtifactType: kindArtifactTypes[kind], Kind: kind})
+    }
+    return attached, nil
+}
+
+// CopyAttached copies an artifact attached to an image in source to the
+// same image migrated to targetOrg/targetName@targetDigest, with the given
+// strategy. Through the referrers API the artifact's subject is pointed at
+// the target image; with the tag schema it is merged into the image's
+// .sig, .att or .sbom tag, as cosign would
+func (a *API) CopyAttached(source *API, sourceOrg, sourceName string, artifact Attached, targetOrg, targetName, targetDigest, strategy string) error {
+    if strategy == ReferrersTagSchema && artifact.Kind == "" {
+        return fmt.Errorf("artifact type %q has no tag in the tag schema", artifact.ArtifactType)
+    }
+
+    sourceBase := source.imageBaseURL(sourceOrg, sourceName)
+    targetBase := a.imageBaseURL(targetOrg, targetName)
+    raw, mediaType, err := source.getRawManifest(sourceBase, artifact.Digest)
+    if err != nil {
+        return err
+    }
+    var manifest referrersManifest
+    if err := json.Unmarshal(raw, &manifest); err != nil {
+        return fmt.Errorf("failed to parse artifact manifest %s: %v", artifact.Digest, err)
+    }
+    if err := a.copyArtifactBlobs(source, sourceBase, targetBase, manifest); err != nil {
+        return err
+    }
+
+    if strategy == ReferrersAPI {
+        subject, err := a.headManifest(targetBase, targetDigest)
+        if err != nil {
+            return err
+        }
+        if subject == nil {
+            return fmt.Errorf("target image %s@%s not found", targetName, targetDigest)
+        }
+        if err := manifest.set("subject", subject); err != nil {
+            return err
+        }
+        if _, ok := manifest["artifactType"]; !ok && artifact.ArtifactType != "" {
+            if err := manifest.set("artifactType", artifact.ArtifactType); err != nil {
+                return err
+            }
+        }
+        // Only OCI manifests can carry a subject
+        mediaType = mediaTypeOCIManifest
+        if err := manifest.set("mediaType", mediaType); err != nil {
+            return err
+        }
+        data, err := json.Marshal(manifest)
+        if err != nil {
+            return err
+        }
+        return a.putManifest(fmt.Sprintf("%s/manifests/%s", targetBase, digestOf(data)), mediaType, data)
+    }
+
+    // The subject would name the source image, the tag links it instead
+    delete(manifest, "subject")
+    tag := tagSchemaTag(targetDigest, artifact.Kind)
+    if err := a.mergeTagSchema(targetBase, tag, manifest); err != nil {
+        return err
+    }
+    data, err := json.Marshal(manifest)
+    if err != nil {
+        return err
+    }
+    return a.putManifest(fmt.Sprintf("%s/manifests/%s", targetBase, tag), mediaType, data)
+}
+
+// mergeTagSchema adds the layers already under tag in the target to
+// manifest, so every signature or attestation pushed there is kept
+func (a *API) mergeTagSchema(baseURL, tag string, manifest referrersManifest) error {
+    existing, err := a.headManifest(baseURL, tag)
+    if err != nil || existing == nil {
+        return err
+    }
+    raw, _, err := a.getRawManifest(baseURL, tag)
+    if err != nil {
+        return err
+    }
+    var current referrersManifest
+    if err := json.Unmarshal(raw, &current); err != nil {
+        return fmt.Errorf("failed to parse %s: %v", tag, err)
+    }
+
+    var layers, currentLayers []json.RawMessage
+    if err := manifest.get("layers", &layers); err != nil {
+        return err
+    }
+    if err := current.get("layers", &currentLayers); err != nil {
+        return err
+    }
+    have := make(map[string]bool)
+    for _, layer := range layers {
+        have[layerKey(layer)] = true
+    }
+    for _, layer := range currentLayers {
+        if !have[layerKey(layer)] {
+            layers = append(layers, layer)
+        }
+    }
+    return manifest.set("layers", layers)
+}
+
+// copyArtifactBlobs copies the config and layers of an artifact manifest
+// the target doesn't have yet
+func (a *API) copyArtifactBlobs(source *API, sourceBase, targetBase string, manifest referrersManifest) error {
+    var config referrersDescriptor
+    var layers []referrersDescriptor
+    if err := manifest.get("config", &config); err != nil {
+        return err
+    }
+    if err := manifest.get("layers", &layers); err != nil {
+        return err
+    }
+
+    var digests []string
+    if config.Digest != "" {
+        digests = append(digests, config.Digest)
+    }
+    for _, layer := range layers {
+        digests = append(digests, layer.Digest)
+    }
+    existing := a.existingBlobs(targetBase, digests, 4)
+
+    dir, err := run.TempDir("attached")
+    if err != nil {
+        return fmt.Errorf("failed to create staging directory: %v", err)
+    }
+    defer run.RemoveTempDir(dir)
+    for i, digest := range digests {
+        if existing[digest] {
+            continue
+        }
+        file := filepath.Join(dir, fmt.Sprintf("blob-%03d", i))
+        if err := source.pullBlob(sourceBase, digest, file); err != nil {
+            return err
+        }
+        if err := a.uploadContainerLayer(targetBase, file, digest); err != nil {
+            return fmt.Errorf("failed to upload blob %s: %v", digest, err)
+        }
+    }
+    return nil
+}
+
+// headManifest returns the descriptor of the manifest at reference, or nil
+// when there is none
+func (a *API) headManifest(baseURL, reference string) (*referrersDescriptor, error) {
+    req, err := http.NewRequestWithContext(a.ctx, "HEAD", fmt.Sprintf("%s/manifests/%s", baseURL, reference), nil)
+    if err != nil {
+        return nil, err
+    }
+    req.Header.Set("Accept", manifestAccept)
+    req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", a.token))
+
+    resp, err := a.client.Do(req)
+    if err != nil {
+        return nil, fmt.Errorf("failed to fetch manifest: %v", err)
+    }
+    resp.Body.Close()
+
+    switch resp.StatusCode {
+    case http.StatusOK:
+    case http.StatusNotFound:
+        return nil, nil
+    default:
+        return nil, fmt.Errorf("manifest request for %s failed with status: %s", reference, resp.Status)
+    }
+    digest := resp.Header.Get("Docker-Content-Digest")
+    if digest == "" {
+        return nil, fmt.Errorf("registry returned no digest for %s", reference)
+    }
+    return &referrersDescriptor{MediaType: resp.Header.Get("Content-Type"), Digest: digest, Size: resp.ContentLength}, nil
+}
+
+// getRawManifest returns the manifest at reference byte for byte, with its
+// media type
+func (a *API) getRawManifest(baseURL, reference string) ([]byte, string, error) {
+    req, err := http.NewRequestWithContext(a.ctx, "GET", fmt.Sprintf("%s/manifests/%s", baseURL, reference), nil)
+    if err != nil {
+        return nil, "", err
+    }
+    req.Header.Set("Accept", manifestAccept)
+    req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", a.token))
+
+    resp, err := a.client.Do(req)
+    if err != nil {
+        return nil, "", fmt.Errorf("failed to fetch manifest: %v", err)
+    }
+    defer resp.Body.Close()
+
+    if resp.StatusCode != http.StatusOK {
+        return nil, "", fmt.Errorf("manifest request for %s failed with status: %s", reference, resp.Status)
+    }
+    raw, err := io.ReadAll(resp.Body)
+    if err != nil {
+        return nil, "", fmt.Errorf("failed to read manifest: %v", err)
+    }
+    return raw, resp.Header.Get("Content-Type"), nil
+}
+
+func (a *API) putManifest(url, mediaType string, data []byte) error {
+    req, err := http.NewRequestWithContext(a.ctx, "PUT", url, bytes.NewReader(data))
+    if err != nil {
+        return err
+    }
+    req.Header.Set("Content-Type", mediaType)
+    req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", a.token))
+
+    resp, err := a.client.Do(req)
+    if err != nil {
+        return fmt.Errorf("failed to upload manifest: %v", err)
+    }
+    defer resp.Body.Close()
+
+    if resp.StatusCode != http.StatusCreated {
+        return fmt.Errorf("manifest upload failed with status: %s", resp.Status)
+    }
+    return nil
+}
+
+func (a *API) registryJSON(url, accept string, out interface{}) error {
+    req, err := http.NewRequestWithContext(a.ctx, "GET", url, nil)
+    if err != nil {
+        return err
+    }
+    req.Header.Set("Accept", accept)
+    req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", a.token))
+
+    resp, err := a.client.Do(req)
+    if err != nil {
+        return err
+    }
+    defer resp.Body.Close()
+
+    if resp.StatusCode != http.StatusOK {
+        return fmt.Errorf("request failed with status: %s", resp.Status)
+    }
+    return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func (m referrersManifest) get(key string, out interface{}) error {
+    value, ok := m[key]
+    if !ok {
+        return nil
+    }
+    if err := json.Unmarshal(value, out); err != nil {
+        return fmt.Errorf("failed to parse artifact %s: %v", key, err)
+    }
+    return nil
+}
+
+func (m referrersManifest) set(key string, value interface{}) error {
+    data, err := json.Marshal(value)
+    if err != nil {
+        return err
+    }
+    m[key] = data
+    return nil
+}
+
+// layerKey identifies a layer by its digest
+func layerKey(layer json.RawMessage) string {
+    var descriptor referrersDescriptor
+    json.Unmarshal(layer, &descriptor)
+    return descriptor.Digest
+}
+
+// tagSchemaTag is the cosign tag of an artifact kind for digest
+func tagSchemaTag(digest, kind string) string {
+    return strings.Replace(digest, ":", "-", 1) + "." + kind
+}
+
+func digestOf(data []byte) string {
+    return fmt.Sprintf("sha256:%x", sha256.Sum256(data))
+}
@@ -0,0 +1,140 @@
+package api
+
+import (
+    "fmt"
+    "net/http"
+    "net/url"
+    "strings"
+)
+
+// Registries maps package types to the base URL of the registry that hosts
+// them, for types that GitHub Packages does not serve itself
+type Registries map[string]string
+
+// ParseRegistries parses a ";"-separated list of type=url pairs
+func ParseRegistries(spec string) (Registries, error) {
+    registries := make(Registries)
+    for _, pair := range strings.Split(spec, ";") {
+        if strings.TrimSpace(pair) == "" {
+            continue
+        }
+        parts := strings.SplitN(pair, "=", 2)
+        if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+            return nil, fmt.Errorf("invalid registry url %q: expected type=url", pair)
+        }
+        registries[strings.ToLower(strings.TrimSpace(parts[0]))] = strings.TrimSuffix(strings.TrimSpace(parts[1]), "/")
+    }
+    return registries, nil
+}
+
+// SetRegistries configures the registries used for non-GitHub package types
+func (a *API) SetRegistries(registries Registries) {
+    a.registries = registries
+}
+
+// ParseRegistryTokens parses a ";"-separated list of type=token pairs
+func ParseRegistryTokens(spec string) (Registries, error) {
+    tokens := make(Registries)
+    for _, pair := range strings.Split(spec, ";") {
+        if strings.TrimSpace(pair) == "" {
+            continue
+        }
+        packageType, token, ok := strings.Cut(pair, "=")
+        if !ok || strings.TrimSpace(packageType) == "" || strings.TrimSpace(token) == "" {
+            // The value is left out, it may be a token given without its type
+            return nil, fmt.Errorf("invalid registry token: expected type=token")
+        }
+        tokens[strings.ToLower(strings.TrimSpace(packageType))] = strings.TrimSpace(token)
+    }
+    return tokens, nil
+}
+
+// SetRegistryTokens configures the credentials of the registries used for
+// non-GitHub package types. The GitHub token is never sent to them
+func (a *API) SetRegistryTokens(tokens Registries) {
+    a.registryTokens = tokens
+}
+
+// registrySchemes is how registries outside GitHub take their token in the
+// Authorization header, as a bearer token unless listed
+var registrySchemes = map[string]string{"cargo": "", "rubygems": "", "cocoapods": "Token"}
+
+func registryScheme(packageType string) string {
+    if scheme, ok := registrySchemes[packageType]; ok {
+        return scheme
+    }
+    return "Bearer"
+}
+
+// setRegistryAuth authenticates req to the registry of packageType with
+// its own token, after scheme when given. Without one nothing is sent
+func (a *API) setRegistryAuth(req *http.Request, packageType, scheme string) {
+    token := a.registryTokens[packageType]
+    if token == "" {
+        return
+    }
+    if scheme != "" {
+        token = scheme + " " + token
+    }
+    req.Header.Set("Authorization", token)
+}
+
+func (a *API) registryURL(packageType string) (string, error) {
+    url, ok := a.registries[packageType]
+    if !ok || url == "" {
+        return "", fmt.Errorf("no registry url configured for %s packages", packageType)
+    }
+    return url, nil
+}
+
+// resolveURL resolves a possibly relative reference found in registry metadata
+func resolveURL(base, ref string) string {
+    baseURL, err := url.Parse(base)
+    if err != nil {
+        return ref
+    }
+    refURL, err := url.Parse(ref)
+    if err != nil {
+        return ref
+    }
+    return baseURL.ResolveReference(refURL).String()
+}
+
+// PackageURL returns where consumers find a migrated package: the GitHub
+// Packages registry endpoint for its type, or the configured external registry
+func (a *API) PackageURL(org, packageType, name string) string {
+    switch packageType {
+    case "container":
+        return fmt.Sprintf("%s/%s/%s", a.ContainerRegistry(), org, name)
+    case "npm":
+        return "https://npm.pkg.github.com/" + name
+    case "maven":
+        return fmt.Sprintf("https://maven.pkg.github.com/%s/%s", org, name)
+    case "nuget":
+        return fmt.Sprintf("https://nuget.pkg.github.com/%s/index.json", org)
+    case "rubygems":
+        // Unless gems go to an external registry such as gemstash
+        if registry, err := a.registryURL(packageType); err == nil {
+            return registry
+        }
+        return fmt.Sprintf("https://rubygems.pkg.github.com/%s", org)
+    }
+
+    if registry, err := a.registryURL(packageType); err == nil {
+        return registry
+    }
+    return fmt.Sprintf("https://github.com/orgs/%s/packages?ecosystem=%s", org, packageType)
+}
+
+// RegistryBaseURL returns the base URL clients install packageType from:
+// the configured external registry, the container registry, or the GitHub
+// Packages endpoint for the type
+func (a *API) RegistryBaseURL(packageType string) string {
+    if registry, err := a.registryURL(packageType); err == nil {
+        return registry
+    }
+    if packageType == "container" {
+        return "https://" + a.ContainerRegistry()
+    }
+    return fmt.Sprintf("https://%s.pkg.github.com", packageType)
+}
@@ -0,0 +1,66 @@
+package api
+
+import (
+    "bytes"
+    "encoding/json"
+    "fmt"
+    "io"
+    "net/http"
+    "strings"
+)
+
+// restBaseURL returns the REST API root for github.com or a GHES hostname
+func (a *API) restBaseURL() string {
+    if a.hostname == "" {
+        return "https://api.github.com"
+    }
+
+    host := strings.TrimSuffix(a.hostname, "/")
+    if !strings.Contains(host, "://") {
+        host = "https://" + host
+    }
+    return host + "/api/v3"
+}
+
+// restJSON sends a REST API request with an optional JSON body and decodes
+// the JSON response into out when it is not nil
+func (a *API) restJSON(method, url string, in, out interface{}) error {
+    var body io.Reader
+    if in != nil {
+        data, err := json.Marshal(in)
+        if err != nil {
+            return fmt.Errorf("failed to marshal request: %v", err)
+        }
+        body = bytes.NewReader(data)
+    }
+
+    req, err := http.NewRequestWithContext(a.ctx, method, url, body)
+    if err != nil {
+        return err
+    }
+
+    req.Header.Set("Accept", "application/vnd.github+json")
+    req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", a.token))
+    if in != nil {
+        req.Header.Set("Content-Type", "application/json")
+    }
+
+    resp, err := a.client.Do(req)
+    if err != nil {
+        return fmt.Errorf("failed to send request: %v", err)
+    }
+    defer resp.Body.Close()
+
+    if resp.StatusCode < 200 || resp.StatusCode > 299 {
+        detail, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+        return fmt.Errorf("%s %s failed with status: %s: %s", method, url, resp.Status, strings.TrimSpace(string(detail)))
+    }
+
+    if out == nil {
+        return nil
+    }
+    if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+        return fmt.Errorf("failed to parse response: %v", err)
+    }
+    return nil
+}
@@ -0,0 +1,112 @@
+package api
+
+import (
+    "fmt"
+    "net/url"
+    "strings"
+    "time"
+)
+
+// RestoreWindow is how long GitHub Packages keeps a deleted version around
+// before it can no longer be restored
+const RestoreWindow = 30 * 24 * time.Hour
+
+// restorableTypes are the package types the restore endpoints accept
+var restorableTypes = map[string]bool{
+    "container": true,
+    "npm":       true,
+    "maven":     true,
+    "nuget":     true,
+    "rubygems":  true,
+}
+
+// RestoredVersion is a deleted source version brought back before migrating
+type RestoredVersion struct {
+    PackageName string
+    PackageType string
+    Version     string
+    DeletedAt   string
+}
+
+type deletedVersion struct {
+    ID        int64  `json:"id"`
+    Name      string `json:"name"`
+    DeletedAt string `json:"deleted_at"`
+    UpdatedAt string `json:"updated_at"`
+}
+
+// RestoreDeletedVersions restores every version of org's packageType
+// packages deleted within the recovery window, so deletions made right
+// before a migration don't leave gaps in the target. Versions whose restore
+// fails are skipped and reported in the returned error
+func (a *API) RestoreDeletedVersions(org, packageType string) ([]RestoredVersion, error) {
+    packageType = strings.ToLower(packageType)
+    if !restorableTypes[packageType] {
+        return nil, fmt.Errorf("%s packages can't be restored", packageType)
+    }
+
+    var names []string
+    for page := 1; ; page++ {
+        var listed []restPackage
+        listURL := fmt.Sprintf("%s/orgs/%s/packages?package_type=%s&per_page=100&page=%d",
+            a.restBaseURL(), url.PathEscape(org), url.QueryEscape(packageType), page)
+        if err := a.restJSON("GET", listURL, nil, &listed); err != nil {
+            return nil, fmt.Errorf("failed to list packages: %v", err)
+        }
+        for _, r := range listed {
+            names = append(names, r.Name)
+        }
+        if len(listed) < 100 {
+            break
+        }
+    }
+
+    cutoff := time.Now().Add(-RestoreWindow)
+    var restored []RestoredVersion
+    var failed []string
+    for _, name := range names {
+        packageURL := fmt.Sprintf("%s/orgs/%s/packages/%s/%s",
+            a.restBaseURL(), url.PathEscape(org), url.PathEscape(packageType), url.PathEscape(name))
+
+        var deleted []deletedVersion
+        for page := 1; ; page++ {
+            var listed []deletedVersion
+            versionsURL := fmt.Sprintf("%s/versions?state=deleted&per_page=100&page=%d", packageURL, page)
+            if err := a.restJSON("GET", versionsURL, nil, &listed); err != nil {
+                return restored, fmt.Errorf("failed to list deleted versions of %s: %v", name, err)
+            }
+            deleted = append(deleted, listed...)
+            if len(listed) < 100 {
+                break
+            }
+        }
+
+        for _, v := range deleted {
+            deletedAt := v.DeletedAt
+            if deletedAt == "" {
+                deletedAt = v.UpdatedAt
+            }
+            // Past the window the restore call fails anyway
+            if t, err := time.Parse(time.RFC3339, deletedAt); err == nil && t.Before(cutoff) {
+                continue
+            }
+
+            restoreURL := fmt.Sprintf("%s/versions/%d/restore", packageURL, v.ID)
+            if err := a.restJSON("POST", restoreURL, nil, nil); err != nil {
+                failed = append(failed, fmt.Sprintf("%s@%s: %v", name, v.Name, err))
+                continue
+            }
+            restored = append(restored, RestoredVersion{
+                PackageName: name,
+                PackageType: packageType,
+                Version:     v.Name,
+                DeletedAt:   deletedAt,
+            })
+        }
+    }
+
+    if len(failed) > 0 {
+        return restored, fmt.Errorf("failed to restore %d versions: %s", len(failed), strings.Join(failed, "; "))
+    }
+    return restored, nil
+}
@@ -0,0 +1,85 @@
+package api
+
+import (
+    "os"
+    "path/filepath"
+    "sync"
+    "time"
+)
+
+// File statuses in per-file upload results
+const (
+    FileUploaded = "uploaded"
+    FileSkipped  = "skipped" // already in the target
+    FileFailed   = "failed"
+    FilePending  = "pending" // not attempted before the upload stopped
+)
+
+// FileResult is the outcome of uploading one file of a version
+type FileResult struct {
+    File     string
+    Status   string
+    Size     int64
+    Duration time.Duration
+    Digest   string // sha256 digest, when the upload computed it
+    Verified bool   // the registry checked the content against Digest
+    Error    string
+}
+
+// FileResults collects the outcome of every file of an upload, including
+// files uploaded concurrently. A nil FileResults records nothing
+type FileResults struct {
+    mu      sync.Mutex
+    results []FileResult
+}
+
+// record adds the outcome of uploading file, started at start
+func (r *FileResults) record(file string, start time.Time, digest string, verified bool, err error) {
+    if r == nil {
+        return
+    }
+    result := FileResult{
+        File:     filepath.Base(file),
+        Status:   FileUploaded,
+        Duration: time.Since(start),
+        Digest:   digest,
+        Verified: verified,
+    }
+    if err != nil {
+        result.Status = FileFailed
+        result.Verified = false
+        result.Error = err.Error()
+    }
+    if info, statErr := os.Stat(file); statErr == nil {
+        result.Size = info.Size()
+    }
+    r.add(result)
+}
+
+// skip records file as already present in the target
+func (r *FileResults) skip(file, digest string, verified bool) {
+    if r == nil {
+        return
+    }
+    result := FileResult{File: filepath.Base(file), Status: FileSkipped, Digest: digest, Verified: verified}
+    if info, err := os.Stat(file); err == nil {
+        result.Size = info.Size()
+    }
+    r.add(result)
+}
+
+func (r *FileResults) add(result FileResult) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    r.results = append(r.results, result)
+}
+
+// All returns the results recorded so far, in the order they finished
+func (r *FileResults) All() []FileResult {
+    if r == nil {
+        return nil
+    }
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    return append([]FileResult(nil), r.results...)
+}
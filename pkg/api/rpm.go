@@ -0,0 +1,254 @@
+package api
+
+import (
+    "compress/gzip"
+    "encoding/xml"
+    "fmt"
+    "io"
+    "net/http"
+    "os"
+    "os/exec"
+    "path"
+    "strings"
+)
+
+// RPM NEVRA identifies a package build: name-[epoch:]version-release.arch
+type RPMHeader struct {
+    Name    string
+    Epoch   string
+    Version string
+    Release string
+    Arch    string
+}
+
+// EVR returns the version string used to identify the package version
+func (h *RPMHeader) EVR() string {
+    evr := h.Version + "-" + h.Release
+    if h.Epoch != "" && h.Epoch != "0" {
+        evr = h.Epoch + ":" + evr
+    }
+    return evr
+}
+
+// Filename returns the canonical NEVRA filename of the package
+func (h *RPMHeader) Filename() string {
+    return fmt.Sprintf("%s-%s-%s.%s.rpm", h.Name, h.Version, h.Release, h.Arch)
+}
+
+// parseRPMHeader reads the NEVRA of an .rpm using the rpm tool
+func parseRPMHeader(rpmFile string) (*RPMHeader, error) {
+    cmd := exec.Command("rpm", "-qp", "--nosignature",
+        "--queryformat", "%{NAME}\n%{EPOCHNUM}\n%{VERSION}\n%{RELEASE}\n%{ARCH}\n", rpmFile)
+    output, err := cmd.Output()
+    if err != nil {
+        return nil, fmt.Errorf("failed to read rpm header: %v", err)
+    }
+
+    fields := strings.Split(strings.TrimSpace(string(output)), "\n")
+    if len(fields) != 5 {
+        return nil, fmt.Errorf("unexpected rpm header output")
+    }
+
+    header := &RPMHeader{
+        Name:    fields[0],
+        Epoch:   fields[1],
+        Version: fields[2],
+        Release: fields[3],
+        Arch:    fields[4],
+    }
+
+    if header.Name == "" || header.Version == "" || header.Release == "" || header.Arch == "" {
+        return nil, fmt.Errorf("rpm header missing required NEVRA fields")
+    }
+
+    return header, nil
+}
+
+// YUM repository metadata
+type repoMD struct {
+    Data []struct {
+        Type     string `xml:"type,attr"`
+        Location struct {
+            Href string `xml:"href,attr"`
+        } `xml:"location"`
+    } `xml:"data"`
+}
+
+type primaryMetadata struct {
+    Packages []struct {
+        Name    string `xml:"name"`
+        Arch    string `xml:"arch"`
+        Version struct {
+            Epoch string `xml:"epoch,attr"`
+            Ver   string `xml:"ver,attr"`
+            Rel   string `xml:"rel,attr"`
+        } `xml:"version"`
+        Checksum struct {
+            Type  string `xml:"type,attr"`
+            Value string `xml:",chardata"`
+        } `xml:"checksum"`
+        Time struct {
+            File int64 `xml:"file,attr"`
+        } `xml:"time"`
+        Size struct {
+            Package int `xml:"package,attr"`
+        } `xml:"size"`
+        Location struct {
+            Href string `xml:"href,attr"`
+        } `xml:"location"`
+    } `xml:"package"`
+}
+
+// getRPMPackages lists packages from the repository's primary metadata
+func (a *API) getRPMPackages() ([]Package, error) {
+    base, err := a.registryURL("rpm")
+    if err != nil {
+        return nil, err
+    }
+
+    var md repoMD
+    if err := a.getRegistryXML(base+"/repodata/repomd.xml", false, &md); err != nil {
+        return nil, fmt.Errorf("failed to read repomd.xml: %v", err)
+    }
+
+    primaryHref := ""
+    for _, data := range md.Data {
+        if data.Type == "primary" {
+            primaryHref = data.Location.Href
+            break
+        }
+    }
+    if primaryHref == "" {
+        return nil, fmt.Errorf("repomd.xml has no primary metadata")
+    }
+
+    var primary primaryMetadata
+    if err := a.getRegistryXML(base+"/"+primaryHref, strings.HasSuffix(primaryHref, ".gz"), &primary); err != nil {
+        return nil, fmt.Errorf("failed to read primary metadata: %v", err)
+    }
+
+    byName := make(map[string]*Package)
+    var order []string
+    for _, p := range primary.Packages {
+        pkgEntry, ok := byName[p.Name]
+        if !ok {
+            pkgEntry = &Package{
+                ID:          p.Name,
+                Name:        p.Name,
+                PackageType: "rpm",
+                Repository:  &Repository{},
+                Statistics:  &Statistics{},
+            }
+            byName[p.Name] = pkgEntry
+            order = append(order, p.Name)
+        }
+
+        header := RPMHeader{Name: p.Name, Epoch: p.Version.Epoch, Version: p.Version.Ver, Release: p.Version.Rel, Arch: p.Arch}
+        file := File{
+            Name: path.Base(p.Location.Href),
+            Size: p.Size.Package,
+            URL:  base + "/" + p.Location.Href,
+        }
+        if p.Checksum.Type == "sha256" {
+            file.SHA256 = p.Checksum.Value
+        }
+
+        pkgEntry.Versions = append(pkgEntry.Versions, Version{
+            ID:    strings.TrimSuffix(header.Filename(), ".rpm"),
+            Name:  header.EVR(),
+            Files: []File{file},
+        })
+    }
+
+    var packages []Package
+    for _, name := range order {
+        packages = append(packages, *byName[name])
+    }
+    return packages, nil
+}
+
+func (a *API) getRegistryXML(url string, gzipped bool, out interface{}) error {
+    req, err := http.NewRequestWithContext(a.ctx, "GET", url, nil)
+    if err != nil {
+        return err
+    }
+    a.setRegistryAuth(req, "rpm", "Bearer")
+
+    resp, err := a.client.Do(req)
+    if err != nil {
+        return err
+    }
+    defer resp.Body.Close()
+
+    if resp.StatusCode != http.StatusOK {
+        return fmt.Errorf("request failed with status: %s", resp.Status)
+    }
+
+    var body io.Reader = resp.Body
+    if gzipped {
+        gz, err := gzip.NewReader(resp.Body)
+        if err != nil {
+            return err
+        }
+        defer gz.Close()
+        body = gz
+    }
+
+    return xml.NewDecoder(body).Decode(out)
+}
+
+// uploadRPM deploys an .rpm under its canonical NEVRA filename; the target
+// repository regenerates its repodata on upload
+func (a *API) uploadRPM(opts UploadOptions) error {
+    var rpmFile string
+    for _, file := range opts.Files {
+        if strings.HasSuffix(file, ".rpm") {
+            rpmFile = file
+            break
+        }
+    }
+
+    if rpmFile == "" {
+        return fmt.Errorf("missing required .rpm file")
+    }
+
+    base, err := a.registryURL("rpm")
+    if err != nil {
+        return err
+    }
+
+    header, err := parseRPMHeader(rpmFile)
+    if err != nil {
+        return err
+    }
+
+    if header.EVR() != opts.Version {
+        return fmt.Errorf("version mismatch: .rpm has %s, expected %s", header.EVR(), opts.Version)
+    }
+
+    file, err := os.Open(rpmFile)
+    if err != nil {
+        return err
+    }
+    defer file.Close()
+
+    req, err := http.NewRequestWithContext(a.ctx, "PUT", fmt.Sprintf("%s/%s/%s", base, header.Arch, header.Filename()), file)
+    if err != nil {
+        return err
+    }
+
+    req.Header.Set("Content-Type", "application/x-rpm")
+    a.setRegistryAuth(req, "rpm", "Bearer")
+
+    resp, err := a.client.Do(req)
+    if err != nil {
+        return err
+    }
+    defer resp.Body.Close()
+
+    if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+        return fmt.Errorf("rpm upload failed with status: %s", resp.Status)
+    }
+
+    return nil
+}
@@ -6,6 +6,8 @@ import (
     "os/exec"
     "path/filepath"
     "strings"
+
+    "github.com/cvega/gh-migrate-packages/pkg/run"
 )
 
 // RubyGems specification structure
@@ -31,11 +33,11 @@ type GemDependency struct {
 
 func parseGemspec(gemFile string) (*GemSpec, error) {
     // Get the gemspec from the .gem file
-    tmpDir, err := os.MkdirTemp("", "gem-extract-*")
+    tmpDir, err := run.TempDir("gem")
     if err != nil {
         return nil, fmt.Errorf("failed to create temp directory: %v", err)
     }
-    defer os.RemoveAll(tmpDir)
+    defer run.RemoveTempDir(tmpDir)
 
     // Extract the gemspec using gem specification
     cmd := exec.Command("gem", "spec", gemFile)
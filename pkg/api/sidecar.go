@@ -0,0 +1,186 @@
+package api
+
+import (
+    "fmt"
+    "path/filepath"
+    "sort"
+    "strings"
+)
+
+// What an upload does with a checksum or signature sidecar file
+const (
+    SidecarCopy       = "copy"       // upload the downloaded sidecar byte for byte
+    SidecarRegenerate = "regenerate" // compute it again from the uploaded file
+    SidecarSkip       = "skip"       // leave it out of the target
+)
+
+// sidecarAlgorithms maps checksum sidecar extensions to their hash
+var sidecarAlgorithms = map[string]string{
+    "md5":    "md5",
+    "sha1":   "sha1",
+    "sha256": "sha256",
+    "sha512": "sha512",
+}
+
+// sidecarSignatures can only be copied or skipped, regenerating them would
+// need the publisher's key
+var sidecarSignatures = map[string]bool{
+    "asc": true,
+    "sig": true,
+}
+
+// Sidecars is the mode of each sidecar extension, by package type
+type Sidecars map[string]map[string]string
+
+// defaultSidecars is what uploads do unless told otherwise: Maven checksums
+// are regenerated as Maven clients do, everything else is copied
+var defaultSidecars = Sidecars{
+    "maven": {
+        "md5":    SidecarRegenerate,
+        "sha1":   SidecarRegenerate,
+        "sha256": SidecarRegenerate,
+        "sha512": SidecarSkip,
+        "asc":    SidecarCopy,
+        "sig":    SidecarCopy,
+    },
+    "generic": {
+        "md5":    SidecarCopy,
+        "sha1":   SidecarCopy,
+        "sha256": SidecarCopy,
+        "sha512": SidecarCopy,
+        "asc":    SidecarCopy,
+        "sig":    SidecarCopy,
+    },
+}
+
+// fipsSidecars replaces the defaults in FIPS mode: Maven checksums are
+// SHA-256 and SHA-512, which Maven 3.9 and later verify, instead of MD5
+// and SHA-1. Downloaded legacy checksums can still be copied, as that
+// computes nothing
+var fipsSidecars = Sidecars{
+    "maven": {
+        "md5":    SidecarSkip,
+        "sha1":   SidecarSkip,
+        "sha256": SidecarRegenerate,
+        "sha512": SidecarRegenerate,
+        "asc":    SidecarCopy,
+        "sig":    SidecarCopy,
+    },
+    "generic": defaultSidecars["generic"],
+}
+
+// sidecarDefaults returns the modes uploads start from
+func sidecarDefaults() Sidecars {
+    if FIPS() {
+        return fipsSidecars
+    }
+    return defaultSidecars
+}
+
+// ParseSidecars parses a ";"-separated list of [type:]extension=mode
+// rules, e.g. maven:md5=skip. A rule without a type applies to every type
+// with configurable sidecars
+func ParseSidecars(spec string) (Sidecars, error) {
+    sidecars := make(Sidecars)
+    for packageType, modes := range sidecarDefaults() {
+        sidecars[packageType] = make(map[string]string)
+        for extension, mode := range modes {
+            sidecars[packageType][extension] = mode
+        }
+    }
+
+    for _, rule := range strings.Split(spec, ";") {
+        if strings.TrimSpace(rule) == "" {
+            continue
+        }
+        parts := strings.SplitN(rule, "=", 2)
+        if len(parts) != 2 {
+            return nil, fmt.Errorf("invalid sidecar rule %q: expected [type:]extension=mode", rule)
+        }
+        types := sidecarTypes()
+        extension := strings.ToLower(strings.TrimPrefix(strings.TrimSpace(parts[0]), "."))
+        if i := strings.Index(extension, ":"); i >= 0 {
+            types = []string{extension[:i]}
+            extension = strings.TrimPrefix(extension[i+1:], ".")
+        }
+        mode := strings.ToLower(strings.TrimSpace(parts[1]))
+
+        if sidecarAlgorithms[extension] == "" && !sidecarSignatures[extension] {
+            return nil, fmt.Errorf("invalid sidecar rule %q: extension must be md5, sha1, sha256, sha512, asc, or sig", rule)
+        }
+        switch mode {
+        case SidecarCopy, SidecarSkip:
+        case SidecarRegenerate:
+            if sidecarSignatures[extension] {
+                return nil, fmt.Errorf("invalid sidecar rule %q: .%s signatures can only be copied or skipped", rule, extension)
+            }
+            if FIPS() && legacyAlgorithms[extension] {
+                return nil, fmt.Errorf("invalid sidecar rule %q: %s checksums can't be regenerated in FIPS mode, copy or skip them", rule, extension)
+            }
+        default:
+            return nil, fmt.Errorf("invalid sidecar rule %q: mode must be copy, regenerate, or skip", rule)
+        }
+        for _, packageType := range types {
+            if sidecars[packageType] == nil {
+                return nil, fmt.Errorf("invalid sidecar rule %q: sidecars of %s packages are set by the registry", rule, packageType)
+            }
+            sidecars[packageType][extension] = mode
+        }
+    }
+    return sidecars, nil
+}
+
+// sidecarTypes lists the package types whose sidecars can be configured
+func sidecarTypes() []string {
+    var types []string
+    for packageType := range defaultSidecars {
+        types = append(types, packageType)
+    }
+    sort.Strings(types)
+    return types
+}
+
+// SetSidecars configures what uploads do with checksum and signature files
+func (a *API) SetSidecars(sidecars Sidecars) {
+    a.sidecars = sidecars
+}
+
+// sidecarMode returns the mode of extension for packageType
+func (a *API) sidecarMode(packageType, extension string) string {
+    if a.sidecars != nil {
+        return a.sidecars[packageType][extension]
+    }
+    return sidecarDefaults()[packageType][extension]
+}
+
+// sidecarExtensions lists the sidecar extensions in a stable order
+func sidecarExtensions() []string {
+    var extensions []string
+    for extension := range sidecarAlgorithms {
+        extensions = append(extensions, extension)
+    }
+    for extension := range sidecarSignatures {
+        extensions = append(extensions, extension)
+    }
+    sort.Strings(extensions)
+    return extensions
+}
+
+// splitSidecars separates the sidecar files among files, those whose name
+// is another file's plus a sidecar extension, from the files they belong to
+func splitSidecars(files []string) (main []string, sidecars map[string]bool) {
+    names := make(map[string]bool, len(files))
+    for _, file := range files {
+        names[file] = true
+    }
+    sidecars = make(map[string]bool)
+    for _, file := range files {
+        extension := strings.TrimPrefix(filepath.Ext(file), ".")
+        if (sidecarAlgorithms[extension] != "" || sidecarSignatures[extension]) && names[strings.TrimSuffix(file, "."+extension)] {
+            sidecars[file] = true
+            continue
+        }
+        main = append(main, file)
+    }
+    return main, sidecars
+}
@@ -0,0 +1,250 @@
+package api
+
+import (
+    "bytes"
+    "encoding/json"
+    "fmt"
+    "io"
+    "mime/multipart"
+    "net/http"
+    "net/url"
+    "os"
+    "path/filepath"
+    "strings"
+)
+
+const mediaTypeSwiftRegistry = "application/vnd.swift.registry.v1+json"
+
+// swiftRegistry is a Swift package registry given as
+// https://host/path?packages=scope.Name,scope.Other. The registry API has no
+// way to enumerate packages, so the packages to migrate are listed explicitly.
+type swiftRegistry struct {
+    base     string
+    packages []string
+}
+
+func parseSwiftRegistry(raw string) (*swiftRegistry, error) {
+    u, err := url.Parse(raw)
+    if err != nil {
+        return nil, fmt.Errorf("invalid swift registry url: %v", err)
+    }
+
+    registry := &swiftRegistry{}
+    for _, name := range strings.Split(u.Query().Get("packages"), ",") {
+        if name = strings.TrimSpace(name); name != "" {
+            registry.packages = append(registry.packages, name)
+        }
+    }
+
+    u.RawQuery = ""
+    registry.base = strings.TrimSuffix(u.String(), "/")
+    return registry, nil
+}
+
+// splitSwiftIdentifier splits "scope.Name" into its scope and name
+func splitSwiftIdentifier(id string) (scope, name string, err error) {
+    scope, name, ok := strings.Cut(id, ".")
+    if !ok || scope == "" || name == "" {
+        return "", "", fmt.Errorf("swift package identifier %q must be scope.name", id)
+    }
+    return scope, name, nil
+}
+
+func (a *API) getSwiftPackages() ([]Package, error) {
+    raw, err := a.registryURL("swift")
+    if err != nil {
+        return nil, err
+    }
+    registry, err := parseSwiftRegistry(raw)
+    if err != nil {
+        return nil, err
+    }
+    if len(registry.packages) == 0 {
+        return nil, fmt.Errorf("swift registry url must list the packages to migrate with ?packages=scope.name,...")
+    }
+
+    var packages []Package
+    for _, id := range registry.packages {
+        scope, name, err := splitSwiftIdentifier(id)
+        if err != nil {
+            return nil, err
+        }
+        packageURL := fmt.Sprintf("%s/%s/%s", registry.base, scope, name)
+
+        var releases struct {
+            Releases map[string]struct {
+                Problem *struct {
+                    Status int `json:"status"`
+                } `json:"problem"`
+            } `json:"releases"`
+        }
+        if err := a.getSwiftJSON(packageURL, &releases); err != nil {
+            return nil, fmt.Errorf("failed to list releases of %s: %v", id, err)
+        }
+
+        p := Package{
+            ID:          id,
+            Name:        id,
+            PackageType: "swift",
+            Repository:  &Repository{},
+            Statistics:  &Statistics{},
+        }
+
+        for version, release := range releases.Releases {
+            // Releases with a problem (e.g. 410 Gone) cannot be downloaded
+            if release.Problem != nil {
+                continue
+            }
+
+            var detail struct {
+                PublishedAt string `json:"publishedAt"`
+                Resources   []struct {
+                    Name     string `json:"name"`
+                    Checksum string `json:"checksum"`
+                } `json:"resources"`
+            }
+            if err := a.getSwiftJSON(packageURL+"/"+version, &detail); err != nil {
+                return nil, fmt.Errorf("failed to get %s %s: %v", id, version, err)
+            }
+
+            v := Version{
+                ID:        id + "@" + version,
+                Name:      version,
+                CreatedAt: detail.PublishedAt,
+                UpdatedAt: detail.PublishedAt,
+            }
+            for _, resource := range detail.Resources {
+                if resource.Name == "source-archive" {
+                    v.Files = append(v.Files, File{
+                        Name:   fmt.Sprintf("%s-%s.zip", name, version),
+                        SHA256: resource.Checksum,
+                        URL:    fmt.Sprintf("%s/%s.zip", packageURL, version),
+                    })
+                }
+            }
+            p.Versions = append(p.Versions, v)
+        }
+
+        packages = append(packages, p)
+    }
+
+    return packages, nil
+}
+
+func (a *API) getSwiftJSON(url string, out interface{}) error {
+    req, err := http.NewRequestWithContext(a.ctx, "GET", url, nil)
+    if err != nil {
+        return err
+    }
+    req.Header.Set("Accept", mediaTypeSwiftRegistry)
+    a.setRegistryAuth(req, "swift", "Bearer")
+
+    resp, err := a.client.Do(req)
+    if err != nil {
+        return err
+    }
+    defer resp.Body.Close()
+
+    if resp.StatusCode != http.StatusOK {
+        return fmt.Errorf("request failed with status: %s", resp.Status)
+    }
+
+    return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// uploadSwift publishes a source archive with PUT /{scope}/{name}/{version}
+func (a *API) uploadSwift(opts UploadOptions) error {
+    var archive, signature string
+    for _, file := range opts.Files {
+        switch {
+        case strings.HasSuffix(file, ".zip"):
+            archive = file
+        case strings.HasSuffix(file, ".sig"):
+            signature = file
+        }
+    }
+
+    if archive == "" {
+        return fmt.Errorf("missing required source archive .zip file")
+    }
+
+    raw, err := a.registryURL("swift")
+    if err != nil {
+        return err
+    }
+    registry, err := parseSwiftRegistry(raw)
+    if err != nil {
+        return err
+    }
+
+    scope, name, err := splitSwiftIdentifier(opts.PackageName)
+    if err != nil {
+        return err
+    }
+
+    body := &bytes.Buffer{}
+    writer := multipart.NewWriter(body)
+
+    if err := addMultipartFile(writer, "source-archive", archive, "application/zip"); err != nil {
+        return err
+    }
+    if signature != "" {
+        if err := addMultipartFile(writer, "source-archive-signature", signature, "application/octet-stream"); err != nil {
+            return err
+        }
+    }
+    if len(opts.Metadata) > 0 {
+        metadata, err := json.Marshal(opts.Metadata)
+        if err != nil {
+            return fmt.Errorf("failed to marshal metadata: %v", err)
+        }
+        if err := writer.WriteField("metadata", string(metadata)); err != nil {
+            return err
+        }
+    }
+    writer.Close()
+
+    uploadURL := fmt.Sprintf("%s/%s/%s/%s", registry.base, scope, name, url.PathEscape(opts.Version))
+    req, err := http.NewRequestWithContext(a.ctx, "PUT", uploadURL, body)
+    if err != nil {
+        return err
+    }
+
+    req.Header.Set("Content-Type", writer.FormDataContentType())
+    req.Header.Set("Accept", mediaTypeSwiftRegistry)
+    a.setRegistryAuth(req, "swift", "Bearer")
+
+    resp, err := a.client.Do(req)
+    if err != nil {
+        return err
+    }
+    defer resp.Body.Close()
+
+    switch resp.StatusCode {
+    case http.StatusCreated, http.StatusAccepted, http.StatusOK:
+        return nil
+    case http.StatusConflict:
+        return &ErrVersionExists{PackageName: opts.PackageName, Version: opts.Version}
+    default:
+        return fmt.Errorf("swift publish failed with status: %s", resp.Status)
+    }
+}
+
+func addMultipartFile(writer *multipart.Writer, field, path, contentType string) error {
+    file, err := os.Open(path)
+    if err != nil {
+        return err
+    }
+    defer file.Close()
+
+    header := make(map[string][]string)
+    header["Content-Disposition"] = []string{fmt.Sprintf(`form-data; name="%s"; filename="%s"`, field, filepath.Base(path))}
+    header["Content-Type"] = []string{contentType}
+
+    part, err := writer.CreatePart(header)
+    if err != nil {
+        return err
+    }
+    _, err = io.Copy(part, file)
+    return err
+}
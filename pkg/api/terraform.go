@@ -0,0 +1,517 @@
+package api
+
+import (
+    "bytes"
+    "encoding/json"
+    "fmt"
+    "io"
+    "net/http"
+    "net/url"
+    "os"
+    "path/filepath"
+    "strings"
+)
+
+// Terraform package names are "modules/<name>/<provider>" or "providers/<type>";
+// the namespace is the organization being migrated.
+const (
+    terraformModulePrefix   = "modules/"
+    terraformProviderPrefix = "providers/"
+    terraformDownloadFile   = "download.json"
+)
+
+// Provider download payload from the registry protocol
+type terraformProviderDownload struct {
+    Filename            string `json:"filename"`
+    DownloadURL         string `json:"download_url"`
+    ShasumsURL          string `json:"shasums_url"`
+    ShasumsSignatureURL string `json:"shasums_signature_url"`
+    Shasum              string `json:"shasum"`
+    OS                  string `json:"os"`
+    Arch                string `json:"arch"`
+    SigningKeys         struct {
+        GPGPublicKeys []struct {
+            KeyID      string `json:"key_id"`
+            ASCIIArmor string `json:"ascii_armor"`
+        } `json:"gpg_public_keys"`
+    } `json:"signing_keys"`
+}
+
+// terraformServices resolves the registry protocol endpoints through
+// service discovery, defaulting to the public registry layout
+func (a *API) terraformServices(base string) (modules, providers string) {
+    modules, providers = base+"/v1/modules/", base+"/v1/providers/"
+
+    var discovery map[string]string
+    if err := a.getRegistryJSON("terraform", base+"/.well-known/terraform.json", &discovery); err != nil {
+        return modules, providers
+    }
+    if path, ok := discovery["modules.v1"]; ok {
+        modules = resolveURL(base+"/.well-known/terraform.json", path)
+    }
+    if path, ok := discovery["providers.v1"]; ok {
+        providers = resolveURL(base+"/.well-known/terraform.json", path)
+    }
+    return modules, providers
+}
+
+// getTerraformPackages lists the modules and providers of a registry namespace
+func (a *API) getTerraformPackages(namespace string) ([]Package, error) {
+    base, err := a.registryURL("terraform")
+    if err != nil {
+        return nil, err
+    }
+
+    modulesURL, providersURL := a.terraformServices(base)
+
+    modules, err := a.getTerraformModules(modulesURL, namespace)
+    if err != nil {
+        return nil, err
+    }
+
+    providers, err := a.getTerraformProviders(providersURL, namespace)
+    if err != nil {
+        return nil, err
+    }
+
+    return append(modules, providers...), nil
+}
+
+func (a *API) getTerraformModules(modulesURL, namespace string) ([]Package, error) {
+    var packages []Package
+    offset := 0
+    for {
+        var listing struct {
+            Meta struct {
+                NextOffset int `json:"next_offset"`
+            } `json:"meta"`
+            Modules []struct {
+                Name        string `json:"name"`
+                Provider    string `json:"provider"`
+                Source      string `json:"source"`
+                Downloads   int    `json:"downloads"`
+                PublishedAt string `json:"published_at"`
+            } `json:"modules"`
+        }
+        listURL := fmt.Sprintf("%s%s?offset=%d", modulesURL, url.PathEscape(namespace), offset)
+        if err := a.getRegistryJSON("terraform", listURL, &listing); err != nil {
+            return nil, fmt.Errorf("failed to list terraform modules: %v", err)
+        }
+
+        for _, m := range listing.Modules {
+            moduleURL := fmt.Sprintf("%s%s/%s/%s", modulesURL, namespace, m.Name, m.Provider)
+
+            var versions struct {
+                Modules []struct {
+                    Versions []struct {
+                        Version string `json:"version"`
+                    } `json:"versions"`
+                } `json:"modules"`
+            }
+            if err := a.getRegistryJSON("terraform", moduleURL+"/versions", &versions); err != nil {
+                return nil, fmt.Errorf("failed to list versions of module %s/%s: %v", m.Name, m.Provider, err)
+            }
+
+            p := Package{
+                ID:          fmt.Sprintf("%s/%s/%s", namespace, m.Name, m.Provider),
+                Name:        terraformModulePrefix + m.Name + "/" + m.Provider,
+                PackageType: "terraform",
+                Repository:  &Repository{URL: m.Source},
+                Statistics:  &Statistics{DownloadsCount: m.Downloads},
+            }
+
+            for _, group := range versions.Modules {
+                for _, v := range group.Versions {
+                    archiveURL, err := a.terraformModuleArchive(moduleURL + "/" + v.Version + "/download")
+                    if err != nil {
+                        return nil, fmt.Errorf("failed to resolve module %s/%s %s: %v", m.Name, m.Provider, v.Version, err)
+                    }
+                    p.Versions = append(p.Versions, Version{
+                        ID:   p.ID + "@" + v.Version,
+                        Name: v.Version,
+                        Files: []File{{
+                            Name: fmt.Sprintf("%s-%s-%s.tar.gz", m.Name, m.Provider, v.Version),
+                            URL:  archiveURL,
+                        }},
+                    })
+                }
+            }
+
+            packages = append(packages, p)
+        }
+
+        if listing.Meta.NextOffset == 0 || len(listing.Modules) == 0 {
+            break
+        }
+        offset = listing.Meta.NextOffset
+    }
+
+    return packages, nil
+}
+
+// terraformModuleArchive follows a module download endpoint to its archive
+// URL, which is returned in the X-Terraform-Get header
+func (a *API) terraformModuleArchive(downloadURL string) (string, error) {
+    req, err := http.NewRequestWithContext(a.ctx, "GET", downloadURL, nil)
+    if err != nil {
+        return "", err
+    }
+    a.setRegistryAuth(req, "terraform", "Bearer")
+
+    resp, err := a.client.Do(req)
+    if err != nil {
+        return "", err
+    }
+    defer resp.Body.Close()
+
+    if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+        return "", fmt.Errorf("download request failed with status: %s", resp.Status)
+    }
+
+    location := resp.Header.Get("X-Terraform-Get")
+    if location == "" {
+        return "", fmt.Errorf("registry returned no X-Terraform-Get location")
+    }
+
+    // Only archives served over HTTP can be re-published; VCS sources cannot
+    resolved := resolveURL(downloadURL, location)
+    if !strings.HasPrefix(resolved, "http://") && !strings.HasPrefix(resolved, "https://") {
+        return "", fmt.Errorf("module source %s is not an HTTP archive", location)
+    }
+
+    return resolved, nil
+}
+
+func (a *API) getTerraformProviders(providersURL, namespace string) ([]Package, error) {
+    var listing struct {
+        Providers []struct {
+            Name      string `json:"name"`
+            Source    string `json:"source"`
+            Downloads int    `json:"downloads"`
+        } `json:"providers"`
+    }
+    if err := a.getRegistryJSON("terraform", providersURL+url.PathEscape(namespace), &listing); err != nil {
+        return nil, fmt.Errorf("failed to list terraform providers: %v", err)
+    }
+
+    var packages []Package
+    for _, pr := range listing.Providers {
+        providerURL := fmt.Sprintf("%s%s/%s", providersURL, namespace, pr.Name)
+
+        var versions struct {
+            Versions []struct {
+                Version   string `json:"version"`
+                Platforms []struct {
+                    OS   string `json:"os"`
+                    Arch string `json:"arch"`
+                } `json:"platforms"`
+            } `json:"versions"`
+        }
+        if err := a.getRegistryJSON("terraform", providerURL+"/versions", &versions); err != nil {
+            return nil, fmt.Errorf("failed to list versions of provider %s: %v", pr.Name, err)
+        }
+
+        p := Package{
+            ID:          namespace + "/" + pr.Name,
+            Name:        terraformProviderPrefix + pr.Name,
+            PackageType: "terraform",
+            Repository:  &Repository{URL: pr.Source},
+            Statistics:  &Statistics{DownloadsCount: pr.Downloads},
+        }
+
+        for _, v := range versions.Versions {
+            version := Version{ID: p.ID + "@" + v.Version, Name: v.Version}
+
+            for i, platform := range v.Platforms {
+                platformURL := fmt.Sprintf("%s/%s/download/%s/%s", providerURL, v.Version, platform.OS, platform.Arch)
+
+                var download terraformProviderDownload
+                if err := a.getRegistryJSON("terraform", platformURL, &download); err != nil {
+                    return nil, fmt.Errorf("failed to get provider %s %s %s/%s: %v", pr.Name, v.Version, platform.OS, platform.Arch, err)
+                }
+
+                version.Files = append(version.Files, File{
+                    Name:   download.Filename,
+                    SHA256: download.Shasum,
+                    URL:    resolveURL(platformURL, download.DownloadURL),
+                })
+
+                // Checksums, their signature, and the signing key are shared by all platforms
+                if i == 0 {
+                    shasumsName := fmt.Sprintf("terraform-provider-%s_%s_SHA256SUMS", pr.Name, v.Version)
+                    version.Files = append(version.Files,
+                        File{Name: terraformDownloadFile, URL: platformURL},
+                        File{Name: shasumsName, URL: resolveURL(platformURL, download.ShasumsURL)},
+                        File{Name: shasumsName + ".sig", URL: resolveURL(platformURL, download.ShasumsSignatureURL)},
+                    )
+                }
+            }
+
+            p.Versions = append(p.Versions, version)
+        }
+
+        packages = append(packages, p)
+    }
+
+    return packages, nil
+}
+
+// uploadTerraform publishes a module or provider version to a private
+// registry using the HCP Terraform / Terraform Enterprise registry API
+func (a *API) uploadTerraform(opts UploadOptions) error {
+    switch {
+    case strings.HasPrefix(opts.PackageName, terraformModulePrefix):
+        return a.uploadTerraformModule(opts)
+    case strings.HasPrefix(opts.PackageName, terraformProviderPrefix):
+        return a.uploadTerraformProvider(opts)
+    default:
+        return fmt.Errorf("terraform package name must start with %q or %q", terraformModulePrefix, terraformProviderPrefix)
+    }
+}
+
+func (a *API) uploadTerraformModule(opts UploadOptions) error {
+    parts := strings.Split(strings.TrimPrefix(opts.PackageName, terraformModulePrefix), "/")
+    if len(parts) != 2 {
+        return fmt.Errorf("terraform module name must be modules/<name>/<provider>")
+    }
+    name, provider := parts[0], parts[1]
+
+    var archive string
+    for _, file := range opts.Files {
+        if strings.HasSuffix(file, ".tar.gz") {
+            archive = file
+            break
+        }
+    }
+    if archive == "" {
+        return fmt.Errorf("missing required module .tar.gz archive")
+    }
+
+    base, err := a.registryURL("terraform")
+    if err != nil {
+        return err
+    }
+    orgURL := fmt.Sprintf("%s/api/v2/organizations/%s", base, url.PathEscape(opts.Organization))
+
+    // Create the module; it already existing is fine
+    if _, err := a.terraformAPI("POST", orgURL+"/registry-modules", map[string]interface{}{
+        "type": "registry-modules",
+        "attributes": map[string]interface{}{
+            "name":          name,
+            "provider":      provider,
+            "registry-name": "private",
+        },
+    }, http.StatusUnprocessableEntity); err != nil {
+        return err
+    }
+
+    created, err := a.terraformAPI("POST",
+        fmt.Sprintf("%s/registry-modules/private/%s/%s/%s/versions", orgURL, opts.Organization, name, provider),
+        map[string]interface{}{
+            "type":       "registry-module-versions",
+            "attributes": map[string]interface{}{"version": opts.Version},
+        })
+    if err != nil {
+        return err
+    }
+
+    return a.terraformUpload(created.Links["upload"], archive)
+}
+
+func (a *API) uploadTerraformProvider(opts UploadOptions) error {
+    name := strings.TrimPrefix(opts.PackageName, terraformProviderPrefix)
+
+    var downloadFile, shasums, signature string
+    var binaries []string
+    for _, file := range opts.Files {
+        switch {
+        case filepath.Base(file) == terraformDownloadFile:
+            downloadFile = file
+        case strings.HasSuffix(file, "_SHA256SUMS"):
+            shasums = file
+        case strings.HasSuffix(file, "_SHA256SUMS.sig"):
+            signature = file
+        case strings.HasSuffix(file, ".zip"):
+            binaries = append(binaries, file)
+        }
+    }
+    if downloadFile == "" || shasums == "" || signature == "" || len(binaries) == 0 {
+        return fmt.Errorf("missing required provider files: %s, SHA256SUMS, SHA256SUMS.sig, and platform archives", terraformDownloadFile)
+    }
+
+    data, err := os.ReadFile(downloadFile)
+    if err != nil {
+        return fmt.Errorf("failed to read %s: %v", terraformDownloadFile, err)
+    }
+    var download terraformProviderDownload
+    if err := json.Unmarshal(data, &download); err != nil {
+        return fmt.Errorf("failed to parse %s: %v", terraformDownloadFile, err)
+    }
+    if len(download.SigningKeys.GPGPublicKeys) == 0 {
+        return fmt.Errorf("provider has no signing key")
+    }
+
+    base, err := a.registryURL("terraform")
+    if err != nil {
+        return err
+    }
+    orgURL := fmt.Sprintf("%s/api/v2/organizations/%s", base, url.PathEscape(opts.Organization))
+
+    if _, err := a.terraformAPI("POST", orgURL+"/registry-providers", map[string]interface{}{
+        "type": "registry-providers",
+        "attributes": map[string]interface{}{
+            "name":          name,
+            "namespace":     opts.Organization,
+            "registry-name": "private",
+        },
+    }, http.StatusUnprocessableEntity); err != nil {
+        return err
+    }
+
+    // Register the original signing key so the untouched signature verifies
+    key, err := a.terraformAPI("POST", base+"/api/registry/private/v2/gpg-keys", map[string]interface{}{
+        "type": "gpg-keys",
+        "attributes": map[string]interface{}{
+            "namespace":   opts.Organization,
+            "ascii-armor": download.SigningKeys.GPGPublicKeys[0].ASCIIArmor,
+        },
+    }, http.StatusUnprocessableEntity)
+    if err != nil {
+        return err
+    }
+    keyID := download.SigningKeys.GPGPublicKeys[0].KeyID
+    if id, ok := key.Attributes["key-id"].(string); ok && id != "" {
+        keyID = id
+    }
+
+    versionURL := fmt.Sprintf("%s/registry-providers/private/%s/%s/versions", orgURL, opts.Organization, name)
+    created, err := a.terraformAPI("POST", versionURL, map[string]interface{}{
+        "type": "registry-provider-versions",
+        "attributes": map[string]interface{}{
+            "version":   opts.Version,
+            "key-id":    keyID,
+            "protocols": []string{"5.0"},
+        },
+    })
+    if err != nil {
+        return err
+    }
+
+    if err := a.terraformUpload(created.Links["shasums-upload"], shasums); err != nil {
+        return err
+    }
+    if err := a.terraformUpload(created.Links["shasums-sig-upload"], signature); err != nil {
+        return err
+    }
+
+    for _, binary := range binaries {
+        // Archives are named terraform-provider-<name>_<version>_<os>_<arch>.zip
+        fields := strings.Split(strings.TrimSuffix(filepath.Base(binary), ".zip"), "_")
+        if len(fields) < 4 {
+            return fmt.Errorf("cannot determine platform of %s", filepath.Base(binary))
+        }
+
+        shasum, err := calculateFileHash(binary, "sha256")
+        if err != nil {
+            return err
+        }
+
+        platform, err := a.terraformAPI("POST", fmt.Sprintf("%s/%s/platforms", versionURL, opts.Version), map[string]interface{}{
+            "type": "registry-provider-version-platforms",
+            "attributes": map[string]interface{}{
+                "os":       fields[len(fields)-2],
+                "arch":     fields[len(fields)-1],
+                "shasum":   shasum,
+                "filename": filepath.Base(binary),
+            },
+        })
+        if err != nil {
+            return err
+        }
+
+        if err := a.terraformUpload(platform.Links["provider-binary-upload"], binary); err != nil {
+            return err
+        }
+    }
+
+    return nil
+}
+
+// JSON:API resource returned by the Terraform registry API
+type terraformResource struct {
+    Attributes map[string]interface{} `json:"attributes"`
+    Links      map[string]string      `json:"links"`
+}
+
+// terraformAPI sends a JSON:API request; statuses in tolerated are treated as
+// success with an empty resource (e.g. 422 when the object already exists)
+func (a *API) terraformAPI(method, url string, data map[string]interface{}, tolerated ...int) (*terraformResource, error) {
+    body, err := json.Marshal(map[string]interface{}{"data": data})
+    if err != nil {
+        return nil, err
+    }
+
+    req, err := http.NewRequestWithContext(a.ctx, method, url, bytes.NewReader(body))
+    if err != nil {
+        return nil, err
+    }
+    req.Header.Set("Content-Type", "application/vnd.api+json")
+    a.setRegistryAuth(req, "terraform", "Bearer")
+
+    resp, err := a.client.Do(req)
+    if err != nil {
+        return nil, err
+    }
+    defer resp.Body.Close()
+
+    for _, status := range tolerated {
+        if resp.StatusCode == status {
+            return &terraformResource{}, nil
+        }
+    }
+
+    if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+        msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+        return nil, fmt.Errorf("terraform registry request failed with status: %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+    }
+
+    var result struct {
+        Data terraformResource `json:"data"`
+    }
+    if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+        return nil, fmt.Errorf("failed to decode terraform registry response: %v", err)
+    }
+
+    return &result.Data, nil
+}
+
+func (a *API) terraformUpload(uploadURL, path string) error {
+    if uploadURL == "" {
+        return fmt.Errorf("terraform registry returned no upload link for %s", filepath.Base(path))
+    }
+
+    file, err := os.Open(path)
+    if err != nil {
+        return err
+    }
+    defer file.Close()
+
+    // Upload links are pre-signed and must not carry the API token
+    req, err := http.NewRequestWithContext(a.ctx, "PUT", uploadURL, file)
+    if err != nil {
+        return err
+    }
+    req.Header.Set("Content-Type", "application/octet-stream")
+
+    resp, err := a.client.Do(req)
+    if err != nil {
+        return err
+    }
+    defer resp.Body.Close()
+
+    if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+        return fmt.Errorf("upload of %s failed with status: %s", filepath.Base(path), resp.Status)
+    }
+
+    return nil
+}
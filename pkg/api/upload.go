@@ -9,6 +9,10 @@ import (
     "path/filepath"
     "sync"
     "time"
+
+    "github.com/cvega/gh-migrate-packages/pkg/extension"
+    "github.com/cvega/gh-migrate-packages/pkg/package"
+    "github.com/cvega/gh-migrate-packages/pkg/run"
 )
 
 // UploadManager handles package uploads across different registries
@@ -61,38 +65,54 @@ func (m *UploadManager) ContainerUpload(ctx context.Context, opts UploadOptions)
         return fmt.Errorf("container validation failed: %w", err)
     }
 
-    // Upload layers concurrently
-    var wg sync.WaitGroup
-    layerResults := make(chan string, len(opts.Files))
-    layerErrors := make(chan error, len(opts.Files))
-    
-    sem := make(chan struct{}, m.concurrency)
+    baseURL := m.client.imageBaseURL(opts.Organization, opts.PackageName)
+
+    // Digests in file order, which is the image's layer order
+    var layerFiles, layers []string
     for _, file := range opts.Files {
         if !isContainerLayer(file) {
             continue
         }
+        digest, err := layerDigest(file)
+        if err != nil {
+            return fmt.Errorf("layer upload failed: %w", err)
+        }
+        layerFiles = append(layerFiles, file)
+        layers = append(layers, digest)
+    }
+
+    // Check every layer up front so only the missing ones are uploaded
+    existing := m.client.existingBlobs(baseURL, layers, m.concurrency)
+
+    // Upload missing layers concurrently
+    var wg sync.WaitGroup
+    layerErrors := make(chan error, len(layerFiles))
+
+    sem := make(chan struct{}, m.concurrency)
+    for i, file := range layerFiles {
+        if existing[layers[i]] {
+            opts.Results.skip(file, layers[i], true)
+            continue
+        }
 
         wg.Add(1)
         sem <- struct{}{} // Acquire semaphore
-        
-        go func(layerFile string) {
+
+        go func(layerFile, digest string) {
             defer wg.Done()
             defer func() { <-sem }() // Release semaphore
-            
-            digest, err := m.client.uploadContainerLayer(
-                fmt.Sprintf("%s/%s", opts.Organization, opts.PackageName),
-                layerFile,
-            )
+
+            // The registry rejects a layer whose content doesn't match digest
+            start := time.Now()
+            err := m.client.uploadContainerLayer(baseURL, layerFile, digest)
+            opts.Results.record(layerFile, start, digest, err == nil, err)
             if err != nil {
                 layerErrors <- fmt.Errorf("layer upload failed: %w", err)
-                return
             }
-            layerResults <- digest
-        }(file)
+        }(file, layers[i])
     }
 
     wg.Wait()
-    close(layerResults)
     close(layerErrors)
 
     // Check for any layer upload errors
@@ -100,20 +120,13 @@ func (m *UploadManager) ContainerUpload(ctx context.Context, opts UploadOptions)
         return <-layerErrors
     }
 
-    // Collect layer digests
-    var layers []string
-    for digest := range layerResults {
-        layers = append(layers, digest)
-    }
-
     // Generate and upload manifest
     manifest, err := generateContainerManifest(layers, opts)
     if err != nil {
         return fmt.Errorf("manifest generation failed: %w", err)
     }
 
-    manifestURL := fmt.Sprintf("%s/%s/manifests/%s",
-        opts.Organization, opts.PackageName, opts.Version)
+    manifestURL := fmt.Sprintf("%s/manifests/%s", baseURL, opts.Version)
     
     return m.retryableUpload(ctx, func() error {
         return m.client.uploadContainerManifest(manifestURL, manifest)
@@ -161,15 +174,17 @@ func (m *UploadManager) NPMUpload(ctx context.Context, opts UploadOptions) error
 
 // MavenUpload handles Maven artifact uploads
 func (m *UploadManager) MavenUpload(ctx context.Context, opts UploadOptions) error {
-    // Find POM and JAR files
+    // Find the POM and the artifacts it describes
     var pomFile string
-    var jarFiles []string
+    var files []string
     for _, file := range opts.Files {
         switch {
-        case filepath.Ext(file) == ".pom":
+        case filepath.Ext(file) == ".pom" || filepath.Base(file) == "pom.xml":
             pomFile = file
-        case filepath.Ext(file) == ".jar":
-            jarFiles = append(jarFiles, file)
+        case isMavenSidecar(file):
+            // Uploaded with the file it belongs to
+        default:
+            files = append(files, file)
         }
     }
 
@@ -183,42 +198,60 @@ func (m *UploadManager) MavenUpload(ctx context.Context, opts UploadOptions) err
         return fmt.Errorf("failed to parse POM: %w", err)
     }
 
+    // BOMs and parent POMs have no jar, plugins need their descriptor
+    packaging, err := parseMavenPackaging(pomFile)
+    if err != nil {
+        return fmt.Errorf("failed to parse POM: %w", err)
+    }
+    artifacts, err := parseMavenArtifacts(opts.Version, files)
+    if err != nil {
+        return err
+    }
+    if err := checkMavenPackaging(packaging, artifactID, opts.Version, artifacts); err != nil {
+        return err
+    }
+
     // Upload POM first
-    if err := m.retryableUpload(ctx, func() error {
+    start := time.Now()
+    err = m.retryableUpload(ctx, func() error {
         return m.client.uploadMavenFile(
             fmt.Sprintf("%s/%s/%s/%s/pom.xml",
                 opts.Organization, groupID, artifactID, opts.Version),
             pomFile,
         )
-    }); err != nil {
+    })
+    opts.Results.record(pomFile, start, "", false, err)
+    if err != nil {
         return err
     }
 
-    // Upload JARs concurrently
+    // Upload artifacts concurrently, named after the POM's coordinates
     var wg sync.WaitGroup
-    uploadErrors := make(chan error, len(jarFiles))
+    uploadErrors := make(chan error, len(artifacts))
     
     sem := make(chan struct{}, m.concurrency)
-    for _, jar := range jarFiles {
+    for _, artifact := range artifacts {
         wg.Add(1)
         sem <- struct{}{} // Acquire semaphore
         
-        go func(jarFile string) {
+        go func(artifact mavenArtifact) {
             defer wg.Done()
             defer func() { <-sem }() // Release semaphore
             
+            start := time.Now()
             err := m.retryableUpload(ctx, func() error {
                 return m.client.uploadMavenFile(
                     fmt.Sprintf("%s/%s/%s/%s/%s",
                         opts.Organization, groupID, artifactID, opts.Version,
-                        filepath.Base(jarFile)),
-                    jarFile,
+                        artifact.TargetName(artifactID, opts.Version)),
+                    artifact.File,
                 )
             })
+            opts.Results.record(artifact.File, start, "", false, err)
             if err != nil {
                 uploadErrors <- err
             }
-        }(jar)
+        }(artifact)
     }
 
     wg.Wait()
@@ -259,6 +292,12 @@ func (m *UploadManager) NuGetUpload(ctx context.Context, opts UploadOptions) err
             manifest.Metadata.Version, opts.Version)
     }
 
+    // Point the nuspec at the target organization, unless --no-rewrite
+    nupkgFile, err = m.client.prepareNuGetPackage(opts, nupkgFile)
+    if err != nil {
+        return err
+    }
+
     // Upload package
     return m.retryableUpload(ctx, func() error {
         return m.client.uploadNuGetPackage(opts.Organization, nupkgFile)
@@ -303,6 +342,168 @@ func (m *UploadManager) RubyGemsUpload(ctx context.Context, opts UploadOptions)
     })
 }
 
+// CargoUpload handles Rust crate uploads
+func (m *UploadManager) CargoUpload(ctx context.Context, opts UploadOptions) error {
+    // Find .crate file
+    var crateFile string
+    for _, file := range opts.Files {
+        if filepath.Ext(file) == ".crate" {
+            crateFile = file
+            break
+        }
+    }
+
+    if crateFile == "" {
+        return fmt.Errorf("missing required .crate file")
+    }
+
+    // Parse and validate crate
+    manifest, err := parseCrate(crateFile)
+    if err != nil {
+        return fmt.Errorf("failed to parse .crate: %w", err)
+    }
+
+    // Verify version matches
+    if manifest.Version != opts.Version {
+        return fmt.Errorf("version mismatch: .crate has %s, expected %s",
+            manifest.Version, opts.Version)
+    }
+
+    // Upload crate
+    return m.retryableUpload(ctx, func() error {
+        return m.client.uploadCargo(opts)
+    })
+}
+
+// GoModuleUpload handles Go module uploads
+func (m *UploadManager) GoModuleUpload(ctx context.Context, opts UploadOptions) error {
+    if opts.PackageName == "" || opts.Version == "" {
+        return fmt.Errorf("module path and version are required")
+    }
+
+    // Upload module triplet
+    return m.retryableUpload(ctx, func() error {
+        return m.client.uploadGoModule(opts)
+    })
+}
+
+// DebUpload handles Debian package uploads
+func (m *UploadManager) DebUpload(ctx context.Context, opts UploadOptions) error {
+    return m.retryableUpload(ctx, func() error {
+        return m.client.uploadDeb(opts)
+    })
+}
+
+// RPMUpload handles RPM package uploads
+func (m *UploadManager) RPMUpload(ctx context.Context, opts UploadOptions) error {
+    return m.retryableUpload(ctx, func() error {
+        return m.client.uploadRPM(opts)
+    })
+}
+
+// ComposerUpload handles Composer package uploads
+func (m *UploadManager) ComposerUpload(ctx context.Context, opts UploadOptions) error {
+    return m.retryableUpload(ctx, func() error {
+        return m.client.uploadComposer(opts)
+    })
+}
+
+// CondaUpload handles conda package uploads
+func (m *UploadManager) CondaUpload(ctx context.Context, opts UploadOptions) error {
+    return m.retryableUpload(ctx, func() error {
+        return m.client.uploadConda(opts)
+    })
+}
+
+// TerraformUpload handles Terraform module and provider uploads
+func (m *UploadManager) TerraformUpload(ctx context.Context, opts UploadOptions) error {
+    return m.retryableUpload(ctx, func() error {
+        return m.client.uploadTerraform(opts)
+    })
+}
+
+// SwiftUpload handles Swift package registry uploads
+func (m *UploadManager) SwiftUpload(ctx context.Context, opts UploadOptions) error {
+    return m.retryableUpload(ctx, func() error {
+        return m.client.uploadSwift(opts)
+    })
+}
+
+// CocoaPodsUpload handles CocoaPods podspec uploads
+func (m *UploadManager) CocoaPodsUpload(ctx context.Context, opts UploadOptions) error {
+    return m.retryableUpload(ctx, func() error {
+        return m.client.uploadCocoaPod(opts)
+    })
+}
+
+// GenericUpload handles generic file set uploads
+func (m *UploadManager) GenericUpload(ctx context.Context, opts UploadOptions) error {
+    return m.retryableUpload(ctx, func() error {
+        return m.client.uploadGeneric(opts)
+    })
+}
+
+// Upload sends a version with the uploader of its package type, or the
+// external handler registered for it
+func (m *UploadManager) Upload(ctx context.Context, opts UploadOptions) error {
+    if opts.Staging == "" {
+        staging, err := run.TempDir("upload")
+        if err != nil {
+            return fmt.Errorf("failed to create staging directory: %v", err)
+        }
+        defer run.RemoveTempDir(staging)
+        opts.Staging = staging
+    }
+
+    switch pkg.PackageType(opts.PackageType) {
+    case pkg.PackageTypeContainer:
+        return m.ContainerUpload(ctx, opts)
+    case pkg.PackageTypeNpm:
+        return m.NPMUpload(ctx, opts)
+    case pkg.PackageTypeMaven:
+        return m.MavenUpload(ctx, opts)
+    case pkg.PackageTypeNuGet:
+        return m.NuGetUpload(ctx, opts)
+    case pkg.PackageTypeRubyGems:
+        return m.RubyGemsUpload(ctx, opts)
+    case pkg.PackageTypeCargo:
+        return m.CargoUpload(ctx, opts)
+    case pkg.PackageTypeGo:
+        return m.GoModuleUpload(ctx, opts)
+    case pkg.PackageTypeDeb:
+        return m.DebUpload(ctx, opts)
+    case pkg.PackageTypeRPM:
+        return m.RPMUpload(ctx, opts)
+    case pkg.PackageTypeComposer:
+        return m.ComposerUpload(ctx, opts)
+    case pkg.PackageTypeConda:
+        return m.CondaUpload(ctx, opts)
+    case pkg.PackageTypeTerraform:
+        return m.TerraformUpload(ctx, opts)
+    case pkg.PackageTypeSwift:
+        return m.SwiftUpload(ctx, opts)
+    case pkg.PackageTypeCocoaPods:
+        return m.CocoaPodsUpload(ctx, opts)
+    case pkg.PackageTypeGeneric:
+        return m.GenericUpload(ctx, opts)
+    }
+
+    handler, ok := extension.Lookup(opts.PackageType)
+    if !ok {
+        return fmt.Errorf("unsupported package type: %s", opts.PackageType)
+    }
+    return m.retryableUpload(ctx, func() error {
+        return handler.Upload(ctx, m.client.token, extension.Request{
+            Organization: opts.Organization,
+            Hostname:     m.client.hostname,
+            PackageName:  opts.PackageName,
+            Version:      opts.Version,
+            Files:        opts.Files,
+            Metadata:     opts.Metadata,
+        })
+    })
+}
+
 // Generic helpers
 func validateContainerUpload(opts UploadOptions) error {
     if opts.Organization == "" {
@@ -319,5 +520,12 @@ func validateContainerUpload(opts UploadOptions) error {
 
 func isContainerLayer(file string) bool {
     ext := filepath.Ext(file)
-    return ext == ".tar" || ext == ".gz" || ext == ".tgz"
+    return ext == ".tar" || ext == ".gz" || ext == ".tgz" || isOCIBlob(file)
+}
+
+// isOCIBlob reports whether file is in an OCI image layout's blobs/sha256
+// directory, where import finds the layers of images it detects
+func isOCIBlob(file string) bool {
+    dir := filepath.Dir(file)
+    return filepath.Base(dir) == "sha256" && filepath.Base(filepath.Dir(dir)) == "blobs"
 }
@@ -0,0 +1,183 @@
+package attest
+
+import (
+    "crypto/ecdsa"
+    "crypto/elliptic"
+    "crypto/rand"
+    "crypto/x509"
+    "encoding/base64"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "sync"
+    "time"
+
+    "github.com/cvega/gh-migrate-packages/pkg/api"
+    "github.com/cvega/gh-migrate-packages/pkg/provenance"
+)
+
+// BundleMediaType is the Sigstore bundle version written, the one
+// actions/attest-build-provenance produces
+const BundleMediaType = "application/vnd.dev.sigstore.bundle.v0.3+json"
+
+const (
+    requestTimeout = 30 * time.Second
+    renewBefore    = time.Minute // Fulcio certificates last ten minutes
+)
+
+// Bundle is a Sigstore bundle: a DSSE envelope with the certificate that
+// signed it and the timestamp proving when
+type Bundle struct {
+    MediaType            string               `json:"mediaType"`
+    VerificationMaterial VerificationMaterial `json:"verificationMaterial"`
+    DSSEEnvelope         provenance.Envelope  `json:"dsseEnvelope"`
+}
+
+type VerificationMaterial struct {
+    Certificate               Certificate               `json:"certificate"`
+    TlogEntries               []interface{}             `json:"tlogEntries"`
+    TimestampVerificationData TimestampVerificationData `json:"timestampVerificationData"`
+}
+
+type Certificate struct {
+    RawBytes string `json:"rawBytes"`
+}
+
+type TimestampVerificationData struct {
+    RFC3161Timestamps []SignedTimestamp `json:"rfc3161Timestamps"`
+}
+
+type SignedTimestamp struct {
+    SignedTimestamp string `json:"signedTimestamp"`
+}
+
+// Attester signs provenance statements keylessly, with an ephemeral key
+// certified for the running GitHub Actions workflow, and stores them as
+// artifact attestations of a target repository. Attestations are then
+// verifiable with gh attestation verify and usable by attestation policies
+// like those of actions/attest-build-provenance
+type Attester struct {
+    client *api.API
+    owner  string
+    repo   string
+    http   *http.Client
+
+    mu      sync.Mutex // serializes signing and certificate renewal
+    key     *ecdsa.PrivateKey
+    signer  *provenance.Signer
+    cert    *x509.Certificate
+    created int
+}
+
+// New attests to owner/repo through client, and requests the first signing
+// certificate so a workflow without id-token: write fails before anything
+// is migrated
+func New(client *api.API, owner, repo string) (*Attester, error) {
+    a := &Attester{
+        client: client,
+        owner:  owner,
+        repo:   repo,
+        http:   &http.Client{Timeout: requestTimeout},
+    }
+    if err := a.renew(); err != nil {
+        return nil, err
+    }
+    return a, nil
+}
+
+// Repository returns the owner/name attestations are stored in
+func (a *Attester) Repository() string {
+    return a.owner + "/" + a.repo
+}
+
+// renew replaces the key and its certificate with fresh ones
+func (a *Attester) renew() error {
+    key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+    if err != nil {
+        return fmt.Errorf("failed to generate signing key: %v", err)
+    }
+    signer, err := provenance.NewSigner(key)
+    if err != nil {
+        return fmt.Errorf("failed to create signer: %v", err)
+    }
+    token, err := identityToken(a.http)
+    if err != nil {
+        return err
+    }
+    cert, err := signingCertificate(a.http, key, token)
+    if err != nil {
+        return err
+    }
+    a.key, a.signer, a.cert = key, signer, cert
+    return nil
+}
+
+// Attest signs statement and stores it as an attestation of each of its
+// subjects, returning the attestation's ID
+func (a *Attester) Attest(statement provenance.Statement) (int64, error) {
+    payload, err := json.Marshal(statement)
+    if err != nil {
+        return 0, fmt.Errorf("failed to encode statement: %v", err)
+    }
+
+    bundle, err := a.sign(payload)
+    if err != nil {
+        return 0, err
+    }
+    id, err := a.client.CreateAttestation(a.owner, a.repo, bundle)
+    if err != nil {
+        return 0, err
+    }
+
+    a.mu.Lock()
+    a.created++
+    a.mu.Unlock()
+    return id, nil
+}
+
+func (a *Attester) sign(payload []byte) (*Bundle, error) {
+    a.mu.Lock()
+    defer a.mu.Unlock()
+
+    // The timestamp must fall inside the certificate's validity
+    if time.Until(a.cert.NotAfter) < renewBefore {
+        if err := a.renew(); err != nil {
+            return nil, err
+        }
+    }
+
+    envelope, err := a.signer.Sign(payload)
+    if err != nil {
+        return nil, err
+    }
+    // Keyless signatures are identified by the certificate, not a key ID
+    envelope.Signatures[0].KeyID = ""
+
+    signature, err := base64.StdEncoding.DecodeString(envelope.Signatures[0].Sig)
+    if err != nil {
+        return nil, err
+    }
+    stamp, err := timestamp(a.http, signature)
+    if err != nil {
+        return nil, err
+    }
+
+    return &Bundle{
+        MediaType: BundleMediaType,
+        VerificationMaterial: VerificationMaterial{
+            Certificate: Certificate{RawBytes: base64.StdEncoding.EncodeToString(a.cert.Raw)},
+            TlogEntries: []interface{}{},
+            TimestampVerificationData: TimestampVerificationData{
+                RFC3161Timestamps: []SignedTimestamp{{SignedTimestamp: base64.StdEncoding.EncodeToString(stamp)}},
+            },
+        },
+        DSSEEnvelope: *envelope,
+    }, nil
+}
+
+// Count returns the attestations created by this run
+func (a *Attester) Count() int {
+    a.mu.Lock()
+    defer a.mu.Unlock()
+    return a.created
+}
@@ -0,0 +1,247 @@
+package attest
+
+import (
+    "bytes"
+    "crypto"
+    "crypto/ecdsa"
+    "crypto/rand"
+    "crypto/sha256"
+    "crypto/x509"
+    "crypto/x509/pkix"
+    "encoding/asn1"
+    "encoding/base64"
+    "encoding/json"
+    "encoding/pem"
+    "fmt"
+    "io"
+    "math/big"
+    "net/http"
+    "net/url"
+    "os"
+    "strings"
+)
+
+// GitHub's Sigstore instance, which actions/attest-build-provenance signs
+// with for private repositories and GitHub verifies attestations against
+const (
+    FulcioURL    = "https://fulcio.githubapp.com"
+    TimestampURL = "https://timestamp.githubapp.com/api/v1/timestamp"
+)
+
+const oidcAudience = "sigstore"
+
+var oidSHA256 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+
+// InActions reports whether the run can request a GitHub Actions OIDC
+// token, which needs the workflow's id-token: write permission
+func InActions() bool {
+    return os.Getenv("ACTIONS_ID_TOKEN_REQUEST_URL") != "" && os.Getenv("ACTIONS_ID_TOKEN_REQUEST_TOKEN") != ""
+}
+
+// identityToken requests an OIDC token for Fulcio from GitHub Actions
+func identityToken(client *http.Client) (string, error) {
+    if !InActions() {
+        return "", fmt.Errorf("no GitHub Actions OIDC token available, run in a workflow with the id-token: write permission")
+    }
+    requestURL, err := url.Parse(os.Getenv("ACTIONS_ID_TOKEN_REQUEST_URL"))
+    if err != nil {
+        return "", fmt.Errorf("failed to parse ACTIONS_ID_TOKEN_REQUEST_URL: %v", err)
+    }
+    query := requestURL.Query()
+    query.Set("audience", oidcAudience)
+    requestURL.RawQuery = query.Encode()
+
+    req, err := http.NewRequest("GET", requestURL.String(), nil)
+    if err != nil {
+        return "", err
+    }
+    req.Header.Set("Authorization", "Bearer "+os.Getenv("ACTIONS_ID_TOKEN_REQUEST_TOKEN"))
+
+    var token struct {
+        Value string `json:"value"`
+    }
+    if err := doJSON(client, req, &token); err != nil {
+        return "", fmt.Errorf("failed to request OIDC token: %v", err)
+    }
+    if token.Value == "" {
+        return "", fmt.Errorf("failed to request OIDC token: empty response")
+    }
+    return token.Value, nil
+}
+
+// tokenSubject reads the sub claim of a JWT, which Fulcio asks to be signed
+// as proof of possession of the key
+func tokenSubject(token string) (string, error) {
+    parts := strings.Split(token, ".")
+    if len(parts) != 3 {
+        return "", fmt.Errorf("OIDC token is not a JWT")
+    }
+    payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+    if err != nil {
+        return "", fmt.Errorf("failed to decode OIDC token: %v", err)
+    }
+    var claims struct {
+        Subject string `json:"sub"`
+    }
+    if err := json.Unmarshal(payload, &claims); err != nil {
+        return "", fmt.Errorf("failed to decode OIDC token: %v", err)
+    }
+    if claims.Subject == "" {
+        return "", fmt.Errorf("OIDC token has no subject")
+    }
+    return claims.Subject, nil
+}
+
+// signingCertificate exchanges an OIDC token for a short-lived Fulcio
+// certificate of key, binding it to the workflow's identity
+func signingCertificate(client *http.Client, key *ecdsa.PrivateKey, token string) (*x509.Certificate, error) {
+    subject, err := tokenSubject(token)
+    if err != nil {
+        return nil, err
+    }
+    digest := sha256.Sum256([]byte(subject))
+    proof, err := key.Sign(rand.Reader, digest[:], crypto.SHA256)
+    if err != nil {
+        return nil, fmt.Errorf("failed to sign proof of possession: %v", err)
+    }
+    public, err := x509.MarshalPKIXPublicKey(key.Public())
+    if err != nil {
+        return nil, err
+    }
+
+    request := map[string]interface{}{
+        "credentials": map[string]string{"oidcIdentityToken": token},
+        "publicKeyRequest": map[string]interface{}{
+            "publicKey": map[string]string{
+                "algorithm": "ECDSA",
+                "content":   string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: public})),
+            },
+            "proofOfPossession": base64.StdEncoding.EncodeToString(proof),
+        },
+    }
+    body, err := json.Marshal(request)
+    if err != nil {
+        return nil, err
+    }
+    req, err := http.NewRequest("POST", FulcioURL+"/api/v2/signingCert", bytes.NewReader(body))
+    if err != nil {
+        return nil, err
+    }
+    req.Header.Set("Content-Type", "application/json")
+
+    type chain struct {
+        Chain struct {
+            Certificates []string `json:"certificates"`
+        } `json:"chain"`
+    }
+    var response struct {
+        Embedded *chain `json:"signedCertificateEmbeddedSct"`
+        Detached *chain `json:"signedCertificateDetachedSct"`
+    }
+    if err := doJSON(client, req, &response); err != nil {
+        return nil, fmt.Errorf("failed to request signing certificate: %v", err)
+    }
+
+    issued := response.Embedded
+    if issued == nil {
+        issued = response.Detached
+    }
+    if issued == nil || len(issued.Chain.Certificates) == 0 {
+        return nil, fmt.Errorf("failed to request signing certificate: no certificate returned")
+    }
+    block, _ := pem.Decode([]byte(issued.Chain.Certificates[0]))
+    if block == nil {
+        return nil, fmt.Errorf("signing certificate is not PEM encoded")
+    }
+    cert, err := x509.ParseCertificate(block.Bytes)
+    if err != nil {
+        return nil, fmt.Errorf("failed to parse signing certificate: %v", err)
+    }
+    return cert, nil
+}
+
+// RFC 3161 request, the parts of it we send
+type timeStampReq struct {
+    Version        int
+    MessageImprint messageImprint
+    Nonce          *big.Int `asn1:"optional"`
+    CertReq        bool     `asn1:"optional"`
+}
+
+type messageImprint struct {
+    HashAlgorithm pkix.AlgorithmIdentifier
+    HashedMessage []byte
+}
+
+type timeStampResp struct {
+    Status         asn1.RawValue
+    TimeStampToken asn1.RawValue `asn1:"optional"`
+}
+
+// timestamp has the timestamp authority countersign signature, proving it
+// was made while the short-lived certificate was valid. The response is
+// returned as received, the form Sigstore bundles carry
+func timestamp(client *http.Client, signature []byte) ([]byte, error) {
+    digest := sha256.Sum256(signature)
+    nonce, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 64))
+    if err != nil {
+        return nil, err
+    }
+    query, err := asn1.Marshal(timeStampReq{
+        Version: 1,
+        MessageImprint: messageImprint{
+            HashAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidSHA256, Parameters: asn1.NullRawValue},
+            HashedMessage: digest[:],
+        },
+        Nonce:   nonce,
+        CertReq: true,
+    })
+    if err != nil {
+        return nil, fmt.Errorf("failed to encode timestamp request: %v", err)
+    }
+
+    req, err := http.NewRequest("POST", TimestampURL, bytes.NewReader(query))
+    if err != nil {
+        return nil, err
+    }
+    req.Header.Set("Content-Type", "application/timestamp-query")
+    resp, err := client.Do(req)
+    if err != nil {
+        return nil, fmt.Errorf("failed to request timestamp: %v", err)
+    }
+    defer resp.Body.Close()
+    data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+    if err != nil {
+        return nil, fmt.Errorf("failed to read timestamp: %v", err)
+    }
+    if resp.StatusCode != http.StatusOK {
+        return nil, fmt.Errorf("timestamp authority returned %s: %s", resp.Status, strings.TrimSpace(string(data)))
+    }
+
+    // Status 0 is granted and 1 granted with modifications
+    var parsed timeStampResp
+    if _, err := asn1.Unmarshal(data, &parsed); err != nil {
+        return nil, fmt.Errorf("failed to parse timestamp: %v", err)
+    }
+    var status int
+    if _, err := asn1.Unmarshal(parsed.Status.Bytes, &status); err != nil {
+        return nil, fmt.Errorf("failed to parse timestamp status: %v", err)
+    }
+    if status > 1 || len(parsed.TimeStampToken.FullBytes) == 0 {
+        return nil, fmt.Errorf("timestamp authority refused the request with status %d", status)
+    }
+    return data, nil
+}
+
+func doJSON(client *http.Client, req *http.Request, out interface{}) error {
+    resp, err := client.Do(req)
+    if err != nil {
+        return err
+    }
+    defer resp.Body.Close()
+    if resp.StatusCode < 200 || resp.StatusCode > 299 {
+        detail, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+        return fmt.Errorf("%s %s returned %s: %s", req.Method, req.URL.Host, resp.Status, strings.TrimSpace(string(detail)))
+    }
+    return json.NewDecoder(resp.Body).Decode(out)
+}
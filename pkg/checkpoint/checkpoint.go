@@ -0,0 +1,285 @@
+package checkpoint
+
+import (
+    "bufio"
+    "encoding/json"
+    "fmt"
+    "io"
+    "os"
+    "sync"
+    "time"
+    "unicode/utf8"
+
+    "github.com/cvega/gh-migrate-packages/pkg/run"
+)
+
+// StatusFailed marks an entry recording a failed attempt, and
+// StatusRemoved one whose migrated version cleanup deleted from the target
+// again. Entries without a status are done, as older runs wrote them
+const (
+    StatusFailed  = "failed"
+    StatusRemoved = "removed"
+)
+
+// maxError caps the cause recorded with a failed attempt, so a registry
+// that answers with a whole HTML page doesn't bloat the log
+const maxError = 1024
+
+// Entry records one package version a run finished with, or failed on
+type Entry struct {
+    PackageType string    `json:"package_type"`
+    PackageName string    `json:"package_name"`
+    VersionID   string    `json:"version_id"`
+    Version     string    `json:"version"`
+    Target      string    `json:"target,omitempty"` // name:version it was migrated as
+    Files       int       `json:"files"`
+    Size        int64     `json:"size"`
+    CompletedAt time.Time `json:"completed_at"`
+    RunID       string    `json:"run_id,omitempty"` // run that finished it
+    Status      string    `json:"status,omitempty"` // StatusFailed or StatusRemoved, empty once done
+    Error       string    `json:"error,omitempty"`  // why the attempt failed
+}
+
+// Scope names what a log's versions were migrated between. It is recorded
+// in the log's first line, so a log is never used for another migration
+type Scope struct {
+    Source string `json:"source,omitempty"` // [HOST/]ORG versions came from
+    Target string `json:"target,omitempty"` // organization they went to
+}
+
+func (s Scope) String() string {
+    return s.Source + " -> " + s.Target
+}
+
+// Checkpoint is the metadata database of a resumable run: an append-only
+// log of completed versions, so a later run skips them without touching the
+// registry. A version is only recorded as done once it is completely done;
+// failed attempts are recorded too, until a later run finishes the version
+type Checkpoint struct {
+    mu      sync.Mutex
+    path    string
+    file    *os.File
+    scope   *Scope // recorded by Claim, nil for a new log or an older one
+    entries int    // lines read, a log without any is new
+    done    map[string]Entry
+    failed  map[string]Entry
+}
+
+// Open loads the completed versions recorded at path, creating the log if
+// it doesn't exist yet
+func Open(path string) (*Checkpoint, error) {
+    c := &Checkpoint{path: path, done: make(map[string]Entry), failed: make(map[string]Entry)}
+
+    if existing, err := os.Open(path); err == nil {
+        // Lines have no length limit: older runs wrote failure causes whole
+        reader := bufio.NewReader(existing)
+        for {
+            line, readErr := reader.ReadBytes('\n')
+            if readErr != nil && readErr != io.EOF {
+                existing.Close()
+                return nil, fmt.Errorf("failed to read checkpoint: %v", readErr)
+            }
+            c.readLine(line)
+            if readErr == io.EOF {
+                break
+            }
+        }
+        existing.Close()
+    } else if !os.IsNotExist(err) {
+        return nil, fmt.Errorf("failed to open checkpoint: %v", err)
+    }
+
+    file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+    if err != nil {
+        return nil, fmt.Errorf("failed to open checkpoint: %v", err)
+    }
+    c.file = file
+
+    // Start after any partial last line instead of appending to it
+    if info, err := file.Stat(); err == nil && info.Size() > 0 {
+        last := make([]byte, 1)
+        if reader, err := os.Open(path); err == nil {
+            if _, err := reader.ReadAt(last, info.Size()-1); err == nil && last[0] != '\n' {
+                file.Write([]byte("\n"))
+            }
+            reader.Close()
+        }
+    }
+
+    return c, nil
+}
+
+// readLine applies one line of the log: the scope header or an entry
+func (c *Checkpoint) readLine(line []byte) {
+    var header struct {
+        Scope *Scope `json:"scope"`
+    }
+    if err := json.Unmarshal(line, &header); err == nil && header.Scope != nil {
+        c.scope = header.Scope
+        return
+    }
+
+    var entry Entry
+    // A line cut short by an interrupted run is simply not done
+    if err := json.Unmarshal(line, &entry); err != nil {
+        return
+    }
+    c.record(entry)
+    c.entries++
+}
+
+// Claim ties the log to scope. A new log records it, and a log recorded for
+// another scope is refused: its versions were migrated elsewhere, and
+// skipping them here would leave them out of this migration. Logs written
+// before scopes were recorded are taken as they are
+func (c *Checkpoint) Claim(scope Scope) error {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+
+    if c.scope != nil {
+        if *c.scope != scope {
+            return fmt.Errorf("checkpoint %s records %s, not %s; name another file to start this migration", c.path, *c.scope, scope)
+        }
+        return nil
+    }
+    if c.entries > 0 {
+        return nil
+    }
+
+    data, err := json.Marshal(struct {
+        Scope Scope `json:"scope"`
+    }{scope})
+    if err != nil {
+        return err
+    }
+    if _, err := c.file.Write(append(data, '\n')); err != nil {
+        return fmt.Errorf("failed to write checkpoint: %v", err)
+    }
+    if err := c.file.Sync(); err != nil {
+        return fmt.Errorf("failed to write checkpoint: %v", err)
+    }
+    c.scope = &scope
+    return nil
+}
+
+// Done reports whether a previous run finished the version
+func (c *Checkpoint) Done(packageType, packageName, versionID string) bool {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    _, ok := c.done[checkpointKey(packageType, packageName, versionID)]
+    return ok
+}
+
+// Completed returns how many versions the checkpoint holds
+func (c *Checkpoint) Completed() int {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    return len(c.done)
+}
+
+// Failed returns the versions whose last attempt failed and that no run
+// has finished since
+func (c *Checkpoint) Failed() int {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    return len(c.failed)
+}
+
+// MarkDone records a completed version, syncing the log so a killed
+// process never loses it. Entries are stamped with the current run's ID
+func (c *Checkpoint) MarkDone(entry Entry) error {
+    entry.Status, entry.Error = "", ""
+    return c.write(entry)
+}
+
+// MarkFailed records a failed attempt at a version, which later runs try
+// again. Long causes are cut to maxError bytes
+func (c *Checkpoint) MarkFailed(entry Entry, cause error) error {
+    entry.Status, entry.Error = StatusFailed, truncateError(cause.Error())
+    if entry.CompletedAt.IsZero() {
+        entry.CompletedAt = time.Now().UTC()
+    }
+    return c.write(entry)
+}
+
+// MarkRemoved records that a finished version was deleted from the target,
+// so later runs migrate it again
+func (c *Checkpoint) MarkRemoved(entry Entry) error {
+    entry.Status, entry.Error = StatusRemoved, ""
+    entry.CompletedAt = time.Now().UTC()
+    entry.RunID = ""
+    return c.write(entry)
+}
+
+// Entries returns the finished versions, in no particular order
+func (c *Checkpoint) Entries() []Entry {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    entries := make([]Entry, 0, len(c.done))
+    for _, entry := range c.done {
+        entries = append(entries, entry)
+    }
+    return entries
+}
+
+func (c *Checkpoint) write(entry Entry) error {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+
+    if entry.RunID == "" {
+        entry.RunID = run.ID()
+    }
+
+    data, err := json.Marshal(entry)
+    if err != nil {
+        return err
+    }
+    if _, err := c.file.Write(append(data, '\n')); err != nil {
+        return fmt.Errorf("failed to write checkpoint: %v", err)
+    }
+    if err := c.file.Sync(); err != nil {
+        return fmt.Errorf("failed to write checkpoint: %v", err)
+    }
+
+    c.record(entry)
+    return nil
+}
+
+// record applies entry to the done and failed versions; a failure never
+// undoes a version finished earlier, a removal does
+func (c *Checkpoint) record(entry Entry) {
+    key := checkpointKey(entry.PackageType, entry.PackageName, entry.VersionID)
+    if entry.Status == StatusRemoved {
+        delete(c.done, key)
+        delete(c.failed, key)
+        return
+    }
+    if entry.Status != StatusFailed {
+        c.done[key] = entry
+        delete(c.failed, key)
+        return
+    }
+    if _, ok := c.done[key]; !ok {
+        c.failed[key] = entry
+    }
+}
+
+func (c *Checkpoint) Close() error {
+    return c.file.Close()
+}
+
+// truncateError cuts message to maxError bytes without splitting a character
+func truncateError(message string) string {
+    if len(message) <= maxError {
+        return message
+    }
+    cut := maxError
+    for cut > 0 && !utf8.RuneStart(message[cut]) {
+        cut--
+    }
+    return message[:cut] + "..."
+}
+
+func checkpointKey(packageType, packageName, versionID string) string {
+    return packageType + "/" + packageName + "@" + versionID
+}
@@ -0,0 +1,270 @@
+package checkpoint
+
+import (
+    "errors"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+    "unicode/utf8"
+)
+
+func entry(version string) Entry {
+    return Entry{PackageType: "npm", PackageName: "lib", VersionID: version, Version: version}
+}
+
+func TestRecord(t *testing.T) {
+    tests := []struct {
+        name         string
+        steps        func(c *Checkpoint) error
+        done, failed int
+        doneVersion  bool
+    }{
+        {
+            name:        "done",
+            steps:       func(c *Checkpoint) error { return c.MarkDone(entry("1")) },
+            done:        1,
+            doneVersion: true,
+        },
+        {
+            name:   "failed",
+            steps:  func(c *Checkpoint) error { return c.MarkFailed(entry("1"), errors.New("boom")) },
+            failed: 1,
+        },
+        {
+            name: "failed then done",
+            steps: func(c *Checkpoint) error {
+                if err := c.MarkFailed(entry("1"), errors.New("boom")); err != nil {
+                    return err
+                }
+                return c.MarkDone(entry("1"))
+            },
+            done:        1,
+            doneVersion: true,
+        },
+        {
+            name: "failure never undoes done",
+            steps: func(c *Checkpoint) error {
+                if err := c.MarkDone(entry("1")); err != nil {
+                    return err
+                }
+                return c.MarkFailed(entry("1"), errors.New("boom"))
+            },
+            done:        1,
+            doneVersion: true,
+        },
+        {
+            name: "removed",
+            steps: func(c *Checkpoint) error {
+                if err := c.MarkDone(entry("1")); err != nil {
+                    return err
+                }
+                return c.MarkRemoved(entry("1"))
+            },
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            path := filepath.Join(t.TempDir(), "state.jsonl")
+            c, err := Open(path)
+            if err != nil {
+                t.Fatal(err)
+            }
+            if err := tt.steps(c); err != nil {
+                t.Fatal(err)
+            }
+            c.Close()
+
+            // The log reads back to the same state
+            reopened, err := Open(path)
+            if err != nil {
+                t.Fatal(err)
+            }
+            defer reopened.Close()
+            for _, got := range []*Checkpoint{c, reopened} {
+                if got.Completed() != tt.done || got.Failed() != tt.failed {
+                    t.Errorf("completed %d, failed %d, want %d and %d", got.Completed(), got.Failed(), tt.done, tt.failed)
+                }
+                if got.Done("npm", "lib", "1") != tt.doneVersion {
+                    t.Errorf("Done = %v, want %v", !tt.doneVersion, tt.doneVersion)
+                }
+            }
+        })
+    }
+}
+
+func TestOpenSkipsPartialLines(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "state.jsonl")
+    c, err := Open(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if err := c.MarkDone(entry("1")); err != nil {
+        t.Fatal(err)
+    }
+    c.Close()
+
+    // An interrupted run left half a line behind
+    f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+    if err != nil {
+        t.Fatal(err)
+    }
+    f.WriteString(`{"package_type":"npm","package_na`)
+    f.Close()
+
+    c, err = Open(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if err := c.MarkDone(entry("2")); err != nil {
+        t.Fatal(err)
+    }
+    c.Close()
+
+    c, err = Open(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer c.Close()
+    if c.Completed() != 2 {
+        t.Errorf("completed %d, want 2: the entry after the partial line was lost", c.Completed())
+    }
+}
+
+func TestOpenReadsLongLines(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "state.jsonl")
+    c, err := Open(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    long := entry("1")
+    long.Target = strings.Repeat("x", 256*1024)
+    if err := c.MarkDone(long); err != nil {
+        t.Fatal(err)
+    }
+    c.Close()
+
+    c, err = Open(path)
+    if err != nil {
+        t.Fatalf("Open: %v", err)
+    }
+    defer c.Close()
+    if !c.Done("npm", "lib", "1") {
+        t.Error("a version recorded on a line over 64KiB was not read back")
+    }
+}
+
+func TestTruncateError(t *testing.T) {
+    tests := []struct {
+        name    string
+        message string
+        want    int // bytes kept before the ellipsis, -1 for unchanged
+    }{
+        {"short", "boom", -1},
+        {"exact", strings.Repeat("a", maxError), -1},
+        {"long", strings.Repeat("a", maxError+1), maxError},
+        {"multibyte", strings.Repeat("é", maxError), maxError},
+        {"rune across the cut", "a" + strings.Repeat("é", maxError), maxError - 1},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            got := truncateError(tt.message)
+            if tt.want < 0 {
+                if got != tt.message {
+                    t.Errorf("truncateError changed a %d byte message", len(tt.message))
+                }
+                return
+            }
+            if !strings.HasSuffix(got, "...") || len(got) != tt.want+3 {
+                t.Errorf("truncateError kept %d bytes, want %d and an ellipsis", len(got), tt.want)
+            }
+            if !utf8.ValidString(got) {
+                t.Error("truncateError split a character")
+            }
+        })
+    }
+}
+
+func TestClaim(t *testing.T) {
+    scope := Scope{Source: "source-org", Target: "target-org"}
+    tests := []struct {
+        name    string
+        setup   func(path string) error
+        wantErr bool
+    }{
+        {
+            name:  "new log",
+            setup: func(path string) error { return nil },
+        },
+        {
+            name: "same scope",
+            setup: func(path string) error {
+                return claimed(path, scope, entry("1"))
+            },
+        },
+        {
+            name: "other target",
+            setup: func(path string) error {
+                return claimed(path, Scope{Source: "source-org", Target: "elsewhere"}, entry("1"))
+            },
+            wantErr: true,
+        },
+        {
+            name: "other source",
+            setup: func(path string) error {
+                return claimed(path, Scope{Source: "ghes.example.com/source-org", Target: "target-org"}, entry("1"))
+            },
+            wantErr: true,
+        },
+        {
+            name: "log without a scope",
+            setup: func(path string) error {
+                c, err := Open(path)
+                if err != nil {
+                    return err
+                }
+                defer c.Close()
+                return c.MarkDone(entry("1"))
+            },
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            path := filepath.Join(t.TempDir(), "state.jsonl")
+            if err := tt.setup(path); err != nil {
+                t.Fatal(err)
+            }
+
+            c, err := Open(path)
+            if err != nil {
+                t.Fatal(err)
+            }
+            defer c.Close()
+            err = c.Claim(scope)
+            if (err != nil) != tt.wantErr {
+                t.Fatalf("Claim error = %v, wantErr %v", err, tt.wantErr)
+            }
+        })
+    }
+}
+
+// claimed writes a log for scope holding entries
+func claimed(path string, scope Scope, entries ...Entry) error {
+    c, err := Open(path)
+    if err != nil {
+        return err
+    }
+    defer c.Close()
+    if err := c.Claim(scope); err != nil {
+        return err
+    }
+    for _, e := range entries {
+        if err := c.MarkDone(e); err != nil {
+            return err
+        }
+    }
+    return nil
+}
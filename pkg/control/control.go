@@ -0,0 +1,217 @@
+package control
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "net"
+    "net/http"
+    "os"
+    "sync"
+)
+
+// Run states reported by the control endpoint
+const (
+    StateRunning = "running"
+    StatePaused  = "paused"
+    StateAborted = "aborted"
+)
+
+// ErrAborted is returned by Wait once an operator has aborted the run
+var ErrAborted = fmt.Errorf("migration aborted by operator")
+
+// Status is the payload returned by the status verb
+type Status struct {
+    State     string `json:"state"`
+    Current   string `json:"current,omitempty"`
+    Processed int    `json:"processed"`
+    Total     int    `json:"total"`
+}
+
+// Controller lets a running migration be paused, resumed, or aborted
+type Controller struct {
+    mu     sync.Mutex
+    cond   *sync.Cond
+    status Status
+    server *http.Server
+    socket string
+}
+
+func NewController() *Controller {
+    c := &Controller{status: Status{State: StateRunning}}
+    c.cond = sync.NewCond(&c.mu)
+    return c
+}
+
+func (c *Controller) Pause() {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    if c.status.State == StateRunning {
+        c.status.State = StatePaused
+    }
+}
+
+func (c *Controller) Resume() {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    if c.status.State == StatePaused {
+        c.status.State = StateRunning
+        c.cond.Broadcast()
+    }
+}
+
+func (c *Controller) Abort() {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    c.status.State = StateAborted
+    c.cond.Broadcast()
+}
+
+func (c *Controller) Status() Status {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    return c.status
+}
+
+// SetTotal records the number of packages the run will process
+func (c *Controller) SetTotal(total int) {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    c.status.Total = total
+}
+
+// Track records the package currently being processed
+func (c *Controller) Track(current string) {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    c.status.Current = current
+}
+
+// Done marks the current package as processed
+func (c *Controller) Done() {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    c.status.Processed++
+    c.status.Current = ""
+}
+
+// Wait blocks while the run is paused and returns ErrAborted once aborted
+func (c *Controller) Wait(ctx context.Context) error {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+
+    // Wake the waiter if the context is cancelled while paused
+    stop := context.AfterFunc(ctx, func() {
+        c.mu.Lock()
+        defer c.mu.Unlock()
+        c.cond.Broadcast()
+    })
+    defer stop()
+
+    for c.status.State == StatePaused {
+        if ctx.Err() != nil {
+            return ctx.Err()
+        }
+        c.cond.Wait()
+    }
+
+    if c.status.State == StateAborted {
+        return ErrAborted
+    }
+    return ctx.Err()
+}
+
+// Serve exposes the pause/resume/abort/status verbs over HTTP on a unix socket
+func (c *Controller) Serve(socketPath string) error {
+    // Remove a stale socket left behind by a previous run
+    if _, err := os.Stat(socketPath); err == nil {
+        if err := os.Remove(socketPath); err != nil {
+            return fmt.Errorf("failed to remove stale control socket: %v", err)
+        }
+    }
+
+    listener, err := net.Listen("unix", socketPath)
+    if err != nil {
+        return fmt.Errorf("failed to listen on control socket: %v", err)
+    }
+
+    if err := os.Chmod(socketPath, 0600); err != nil {
+        listener.Close()
+        return fmt.Errorf("failed to restrict control socket permissions: %v", err)
+    }
+
+    mux := http.NewServeMux()
+    mux.HandleFunc("/pause", c.handle(c.Pause))
+    mux.HandleFunc("/resume", c.handle(c.Resume))
+    mux.HandleFunc("/abort", c.handle(c.Abort))
+    mux.HandleFunc("/status", c.handle(nil))
+
+    c.server = &http.Server{Handler: mux}
+    c.socket = socketPath
+
+    go c.server.Serve(listener)
+    return nil
+}
+
+// Close shuts down the control endpoint and removes its socket
+func (c *Controller) Close() error {
+    if c.server == nil {
+        return nil
+    }
+    err := c.server.Close()
+    os.Remove(c.socket)
+    return err
+}
+
+func (c *Controller) handle(action func()) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        if action != nil {
+            if r.Method != http.MethodPost {
+                http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+                return
+            }
+            action()
+        }
+
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(c.Status())
+    }
+}
+
+// Send issues a verb against the control socket of a running migration
+func Send(socketPath, verb string) (*Status, error) {
+    client := &http.Client{
+        Transport: &http.Transport{
+            DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+                return (&net.Dialer{}).DialContext(ctx, "unix", socketPath)
+            },
+        },
+    }
+
+    method := http.MethodPost
+    if verb == "status" {
+        method = http.MethodGet
+    }
+
+    req, err := http.NewRequest(method, "http://control/"+verb, nil)
+    if err != nil {
+        return nil, err
+    }
+
+    resp, err := client.Do(req)
+    if err != nil {
+        return nil, fmt.Errorf("failed to reach control socket: %v", err)
+    }
+    defer resp.Body.Close()
+
+    if resp.StatusCode != http.StatusOK {
+        return nil, fmt.Errorf("control request failed with status: %s", resp.Status)
+    }
+
+    var status Status
+    if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+        return nil, fmt.Errorf("failed to decode status: %v", err)
+    }
+
+    return &status, nil
+}
@@ -0,0 +1,662 @@
+package convert
+
+import (
+    "archive/tar"
+    "bufio"
+    "bytes"
+    "compress/gzip"
+    "encoding/csv"
+    "encoding/json"
+    "fmt"
+    "io"
+    "os"
+    "os/exec"
+    "path/filepath"
+    "strings"
+
+    "github.com/cvega/gh-migrate-packages/pkg/csvfile"
+    "github.com/pterm/pterm"
+    "github.com/spf13/viper"
+)
+
+// Formats an export inventory can be converted between
+const (
+    FormatCSV     = "csv"     // PREFIX_packages.csv and PREFIX_versions.csv, as written by export
+    FormatJSON    = "json"    // one document with a packages and a versions array
+    FormatSQLite  = "sqlite"  // packages and versions tables, through the sqlite3 CLI
+    FormatArchive = "archive" // tar.gz of the CSVs and, optionally, the downloads
+)
+
+var Formats = []string{FormatCSV, FormatJSON, FormatSQLite, FormatArchive}
+
+// The tables of an inventory, named as in the CSV files and SQLite tables
+const (
+    packagesTable = "packages"
+    versionsTable = "versions"
+)
+
+// downloadsDir holds the downloaded versions within an archive
+const downloadsDir = "downloads"
+
+// Table is a header and the rows under it, every value kept as the string
+// the CSV export wrote so conversions round-trip exactly
+type Table struct {
+    Header []string
+    Rows   [][]string
+}
+
+// Inventory is the packages and versions listing of an export
+type Inventory struct {
+    Packages Table
+    Versions Table
+}
+
+// DetectFormat guesses the format of path from its extension; anything
+// else is taken as a CSV prefix
+func DetectFormat(path string) string {
+    lower := strings.ToLower(path)
+    switch {
+    case strings.HasSuffix(lower, ".json"):
+        return FormatJSON
+    case strings.HasSuffix(lower, ".db"), strings.HasSuffix(lower, ".sqlite"), strings.HasSuffix(lower, ".sqlite3"):
+        return FormatSQLite
+    case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+        return FormatArchive
+    }
+    return FormatCSV
+}
+
+// csvPrefix accepts a prefix or either of the CSV files written for it
+func csvPrefix(path string) string {
+    for _, suffix := range []string{"_packages.csv", "_versions.csv"} {
+        if strings.HasSuffix(path, suffix) {
+            return strings.TrimSuffix(path, suffix)
+        }
+    }
+    return path
+}
+
+// Read loads the inventory at path in format
+func Read(path, format string) (*Inventory, error) {
+    switch format {
+    case FormatCSV:
+        return readCSVs(csvPrefix(path))
+    case FormatJSON:
+        return readJSON(path)
+    case FormatSQLite:
+        return readSQLite(path)
+    case FormatArchive:
+        return readArchive(path, "")
+    }
+    return nil, fmt.Errorf("unsupported format %q", format)
+}
+
+// Write stores inv at path in format
+func Write(inv *Inventory, path, format string) error {
+    switch format {
+    case FormatCSV:
+        return writeCSVs(inv, csvPrefix(path))
+    case FormatJSON:
+        return writeJSON(inv, path)
+    case FormatSQLite:
+        return writeSQLite(inv, path)
+    case FormatArchive:
+        return writeArchive(inv, path, "")
+    }
+    return fmt.Errorf("unsupported format %q", format)
+}
+
+func readCSVs(prefix string) (*Inventory, error) {
+    inv := &Inventory{}
+    for _, t := range []struct {
+        name  string
+        table *Table
+    }{{packagesTable, &inv.Packages}, {versionsTable, &inv.Versions}} {
+        file, err := os.Open(fmt.Sprintf("%s_%s.csv", prefix, t.name))
+        if err != nil {
+            return nil, fmt.Errorf("failed to open %s CSV: %v", t.name, err)
+        }
+        table, err := readTable(file)
+        file.Close()
+        if err != nil {
+            return nil, fmt.Errorf("failed to read %s CSV: %v", t.name, err)
+        }
+        *t.table = table
+    }
+    return inv, nil
+}
+
+func readTable(r io.Reader) (Table, error) {
+    reader := csvfile.NewReader(r)
+    // Merged inventories carry extra origin columns
+    reader.FieldsPerRecord = -1
+    records, err := reader.ReadAll()
+    if err != nil {
+        return Table{}, err
+    }
+    if len(records) == 0 {
+        return Table{}, fmt.Errorf("missing header row")
+    }
+    return Table{Header: records[0], Rows: records[1:]}, nil
+}
+
+func writeCSVs(inv *Inventory, prefix string) error {
+    for name, table := range map[string]Table{packagesTable: inv.Packages, versionsTable: inv.Versions} {
+        file, err := os.Create(fmt.Sprintf("%s_%s.csv", prefix, name))
+        if err != nil {
+            return fmt.Errorf("failed to create %s CSV: %v", name, err)
+        }
+        err = writeTable(file, table)
+        if closeErr := file.Close(); err == nil {
+            err = closeErr
+        }
+        if err != nil {
+            return fmt.Errorf("failed to write %s CSV: %v", name, err)
+        }
+    }
+    return nil
+}
+
+func writeTable(w io.Writer, table Table) error {
+    writer := csvfile.NewWriter(w)
+    if err := writer.Write(table.Header); err != nil {
+        return err
+    }
+    if err := writer.WriteAll(table.Rows); err != nil {
+        return err
+    }
+    return writer.Error()
+}
+
+// writeJSON writes every row as an object keyed by column, in column order
+func writeJSON(inv *Inventory, path string) error {
+    var buf bytes.Buffer
+    buf.WriteString("{\n")
+    for i, t := range []struct {
+        name  string
+        table Table
+    }{{packagesTable, inv.Packages}, {versionsTable, inv.Versions}} {
+        if i > 0 {
+            buf.WriteString(",\n")
+        }
+        fmt.Fprintf(&buf, "  %q: [", t.name)
+        for j, row := range t.table.Rows {
+            if j > 0 {
+                buf.WriteString(",")
+            }
+            buf.WriteString("\n    {")
+            for k, column := range t.table.Header {
+                if k > 0 {
+                    buf.WriteString(", ")
+                }
+                value := ""
+                if k < len(row) {
+                    value = row[k]
+                }
+                key, _ := json.Marshal(column)
+                val, _ := json.Marshal(value)
+                fmt.Fprintf(&buf, "%s: %s", key, val)
+            }
+            buf.WriteString("}")
+        }
+        if len(t.table.Rows) > 0 {
+            buf.WriteString("\n  ")
+        }
+        buf.WriteString("]")
+    }
+    buf.WriteString("\n}\n")
+
+    if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+        return fmt.Errorf("failed to write %s: %v", path, err)
+    }
+    return nil
+}
+
+// readJSON reads the rows back in their key order, which a map would lose;
+// the columns are those of the first row followed by any new ones later rows add
+func readJSON(path string) (*Inventory, error) {
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return nil, fmt.Errorf("failed to read %s: %v", path, err)
+    }
+
+    var doc map[string]json.RawMessage
+    if err := json.Unmarshal(data, &doc); err != nil {
+        return nil, fmt.Errorf("failed to parse %s: %v", path, err)
+    }
+
+    inv := &Inventory{}
+    for _, t := range []struct {
+        name  string
+        table *Table
+    }{{packagesTable, &inv.Packages}, {versionsTable, &inv.Versions}} {
+        raw, ok := doc[t.name]
+        if !ok {
+            return nil, fmt.Errorf("%s has no %s array", path, t.name)
+        }
+        table, err := parseJSONRows(raw)
+        if err != nil {
+            return nil, fmt.Errorf("failed to parse %s in %s: %v", t.name, path, err)
+        }
+        *t.table = table
+    }
+    return inv, nil
+}
+
+func parseJSONRows(raw json.RawMessage) (Table, error) {
+    decoder := json.NewDecoder(bytes.NewReader(raw))
+    if tok, err := decoder.Token(); err != nil || tok != json.Delim('[') {
+        return Table{}, fmt.Errorf("expected an array of objects")
+    }
+
+    var table Table
+    columns := make(map[string]int)
+    for decoder.More() {
+        if tok, err := decoder.Token(); err != nil || tok != json.Delim('{') {
+            return Table{}, fmt.Errorf("expected an array of objects")
+        }
+        values := make(map[int]string)
+        for decoder.More() {
+            tok, err := decoder.Token()
+            if err != nil {
+                return Table{}, err
+            }
+            key := tok.(string)
+
+            var value interface{}
+            if err := decoder.Decode(&value); err != nil {
+                return Table{}, err
+            }
+            i, ok := columns[key]
+            if !ok {
+                i = len(table.Header)
+                columns[key] = i
+                table.Header = append(table.Header, key)
+            }
+            values[i] = jsonString(value)
+        }
+        if _, err := decoder.Token(); err != nil {
+            return Table{}, err
+        }
+
+        row := make([]string, len(table.Header))
+        for i, value := range values {
+            row[i] = value
+        }
+        table.Rows = append(table.Rows, row)
+    }
+
+    // Earlier rows are padded to columns added after them
+    for i, row := range table.Rows {
+        for len(row) < len(table.Header) {
+            row = append(row, "")
+        }
+        table.Rows[i] = row
+    }
+    return table, nil
+}
+
+// jsonString turns a value hand-written as a number or bool back into the
+// text the CSV would hold
+func jsonString(value interface{}) string {
+    switch v := value.(type) {
+    case nil:
+        return ""
+    case string:
+        return v
+    default:
+        data, _ := json.Marshal(v)
+        return string(data)
+    }
+}
+
+// RequireSQLite3 fails with how to get the sqlite3 CLI when it isn't on
+// the PATH, so a run can check before doing any work
+func RequireSQLite3() error {
+    if _, err := exec.LookPath("sqlite3"); err != nil {
+        return fmt.Errorf("the sqlite format needs the sqlite3 command on the PATH: install SQLite (e.g. apt install sqlite3 or brew install sqlite) or use another format")
+    }
+    return nil
+}
+
+// SQLite3 runs the sqlite3 CLI on db with input as its script
+func SQLite3(db string, input string, args ...string) ([]byte, error) {
+    if err := RequireSQLite3(); err != nil {
+        return nil, err
+    }
+    var stderr bytes.Buffer
+    cmd := exec.Command("sqlite3", append([]string{"-batch", db}, args...)...)
+    cmd.Stdin = strings.NewReader(input)
+    cmd.Stderr = &stderr
+    out, err := cmd.Output()
+    if err != nil {
+        return nil, fmt.Errorf("sqlite3 failed: %v: %s", err, strings.TrimSpace(stderr.String()))
+    }
+    return out, nil
+}
+
+// SQLite3Stream runs the sqlite3 CLI on db with the script write produces,
+// streamed to its stdin so a large script is never held in memory. The
+// first failing statement stops it
+func SQLite3Stream(db string, write func(io.Writer) error) error {
+    if err := RequireSQLite3(); err != nil {
+        return err
+    }
+    var stderr bytes.Buffer
+    cmd := exec.Command("sqlite3", "-batch", "-bail", db)
+    cmd.Stderr = &stderr
+    stdin, err := cmd.StdinPipe()
+    if err != nil {
+        return err
+    }
+    if err := cmd.Start(); err != nil {
+        return fmt.Errorf("failed to start sqlite3: %v", err)
+    }
+
+    script := bufio.NewWriterSize(stdin, 1<<20)
+    writeErr := write(script)
+    if writeErr == nil {
+        writeErr = script.Flush()
+    }
+    stdin.Close()
+
+    // sqlite3 stopping early breaks the pipe, its own error says why
+    if err := cmd.Wait(); err != nil {
+        return fmt.Errorf("sqlite3 failed: %v: %s", err, strings.TrimSpace(stderr.String()))
+    }
+    return writeErr
+}
+
+// SQLQuote quotes value as an SQL string literal
+func SQLQuote(value string) string {
+    return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
+
+func sqlIdentifier(name string) string {
+    return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// writeSQLite replaces the database at path with one table per CSV, every
+// column as TEXT under its CSV header
+func writeSQLite(inv *Inventory, path string) error {
+    if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+        return fmt.Errorf("failed to replace %s: %v", path, err)
+    }
+
+    var script strings.Builder
+    script.WriteString("BEGIN;\n")
+    for _, t := range []struct {
+        name  string
+        table Table
+    }{{packagesTable, inv.Packages}, {versionsTable, inv.Versions}} {
+        columns := make([]string, len(t.table.Header))
+        for i, column := range t.table.Header {
+            columns[i] = sqlIdentifier(column) + " TEXT"
+        }
+        fmt.Fprintf(&script, "CREATE TABLE %s (%s);\n", t.name, strings.Join(columns, ", "))
+
+        for _, row := range t.table.Rows {
+            values := make([]string, len(t.table.Header))
+            for i := range values {
+                value := ""
+                if i < len(row) {
+                    value = row[i]
+                }
+                values[i] = SQLQuote(value)
+            }
+            fmt.Fprintf(&script, "INSERT INTO %s VALUES (%s);\n", t.name, strings.Join(values, ", "))
+        }
+    }
+    script.WriteString("COMMIT;\n")
+
+    _, err := SQLite3(path, script.String())
+    return err
+}
+
+func readSQLite(path string) (*Inventory, error) {
+    if _, err := os.Stat(path); err != nil {
+        return nil, fmt.Errorf("can't read %s: %v", path, err)
+    }
+
+    inv := &Inventory{}
+    for _, t := range []struct {
+        name  string
+        table *Table
+    }{{packagesTable, &inv.Packages}, {versionsTable, &inv.Versions}} {
+        // The header is read separately, sqlite3 prints none for an empty table
+        out, err := SQLite3(path, fmt.Sprintf("SELECT name FROM pragma_table_info('%s') ORDER BY cid;\n", t.name), "-csv")
+        if err != nil {
+            return nil, err
+        }
+        columns, err := csv.NewReader(bytes.NewReader(out)).ReadAll()
+        if err != nil {
+            return nil, fmt.Errorf("failed to read %s columns: %v", t.name, err)
+        }
+        if len(columns) == 0 {
+            return nil, fmt.Errorf("%s has no %s table", path, t.name)
+        }
+        for _, column := range columns {
+            t.table.Header = append(t.table.Header, column[0])
+        }
+
+        out, err = SQLite3(path, fmt.Sprintf("SELECT * FROM %s ORDER BY rowid;\n", t.name), "-csv")
+        if err != nil {
+            return nil, err
+        }
+        rows, err := csv.NewReader(bytes.NewReader(out)).ReadAll()
+        if err != nil {
+            return nil, fmt.Errorf("failed to read %s rows: %v", t.name, err)
+        }
+        t.table.Rows = rows
+    }
+    return inv, nil
+}
+
+// archiveName returns the file name prefix of an archive's CSVs
+func archiveName(path string) string {
+    name := filepath.Base(path)
+    for _, suffix := range []string{".tar.gz", ".tgz"} {
+        if strings.HasSuffix(strings.ToLower(name), suffix) {
+            return name[:len(name)-len(suffix)]
+        }
+    }
+    return name
+}
+
+// writeArchive packs the CSVs, and the downloads directory when given, in
+// a tar.gz at path
+func writeArchive(inv *Inventory, path, downloads string) error {
+    file, err := os.Create(path)
+    if err != nil {
+        return fmt.Errorf("failed to create %s: %v", path, err)
+    }
+    defer file.Close()
+
+    gz := gzip.NewWriter(file)
+    tw := tar.NewWriter(gz)
+
+    prefix := archiveName(path)
+    for _, t := range []struct {
+        name  string
+        table Table
+    }{{packagesTable, inv.Packages}, {versionsTable, inv.Versions}} {
+        var buf bytes.Buffer
+        if err := writeTable(&buf, t.table); err != nil {
+            return fmt.Errorf("failed to write %s CSV: %v", t.name, err)
+        }
+        header := &tar.Header{
+            Name: fmt.Sprintf("%s_%s.csv", prefix, t.name),
+            Mode: 0644,
+            Size: int64(buf.Len()),
+        }
+        if err := tw.WriteHeader(header); err != nil {
+            return fmt.Errorf("failed to write %s: %v", path, err)
+        }
+        if _, err := tw.Write(buf.Bytes()); err != nil {
+            return fmt.Errorf("failed to write %s: %v", path, err)
+        }
+    }
+
+    if downloads != "" {
+        if err := addDirectory(tw, downloads, downloadsDir); err != nil {
+            return fmt.Errorf("failed to archive %s: %v", downloads, err)
+        }
+    }
+
+    if err := tw.Close(); err != nil {
+        return fmt.Errorf("failed to write %s: %v", path, err)
+    }
+    if err := gz.Close(); err != nil {
+        return fmt.Errorf("failed to write %s: %v", path, err)
+    }
+    return file.Close()
+}
+
+func addDirectory(tw *tar.Writer, dir, name string) error {
+    return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+        if err != nil {
+            return err
+        }
+        if !info.Mode().IsRegular() {
+            return nil
+        }
+        rel, err := filepath.Rel(dir, path)
+        if err != nil {
+            return err
+        }
+
+        header, err := tar.FileInfoHeader(info, "")
+        if err != nil {
+            return err
+        }
+        header.Name = filepath.ToSlash(filepath.Join(name, rel))
+        if err := tw.WriteHeader(header); err != nil {
+            return err
+        }
+
+        file, err := os.Open(path)
+        if err != nil {
+            return err
+        }
+        defer file.Close()
+        _, err = io.Copy(tw, file)
+        return err
+    })
+}
+
+// readArchive reads the CSVs of an archive, extracting its downloads into
+// the downloads directory when given
+func readArchive(path, downloads string) (*Inventory, error) {
+    file, err := os.Open(path)
+    if err != nil {
+        return nil, fmt.Errorf("failed to open %s: %v", path, err)
+    }
+    defer file.Close()
+
+    gz, err := gzip.NewReader(file)
+    if err != nil {
+        return nil, fmt.Errorf("failed to read %s: %v", path, err)
+    }
+    tr := tar.NewReader(gz)
+
+    inv := &Inventory{}
+    found := make(map[string]bool)
+    for {
+        header, err := tr.Next()
+        if err == io.EOF {
+            break
+        }
+        if err != nil {
+            return nil, fmt.Errorf("failed to read %s: %v", path, err)
+        }
+        if header.Typeflag != tar.TypeReg {
+            continue
+        }
+
+        name := filepath.ToSlash(filepath.Clean(header.Name))
+        switch {
+        case !strings.Contains(name, "/") && strings.HasSuffix(name, "_"+packagesTable+".csv"):
+            if inv.Packages, err = readTable(tr); err != nil {
+                return nil, fmt.Errorf("failed to read %s: %v", name, err)
+            }
+            found[packagesTable] = true
+        case !strings.Contains(name, "/") && strings.HasSuffix(name, "_"+versionsTable+".csv"):
+            if inv.Versions, err = readTable(tr); err != nil {
+                return nil, fmt.Errorf("failed to read %s: %v", name, err)
+            }
+            found[versionsTable] = true
+        case downloads != "" && strings.HasPrefix(name, downloadsDir+"/"):
+            if err := extractFile(tr, downloads, strings.TrimPrefix(name, downloadsDir+"/")); err != nil {
+                return nil, err
+            }
+        }
+    }
+
+    for _, name := range []string{packagesTable, versionsTable} {
+        if !found[name] {
+            return nil, fmt.Errorf("%s has no %s CSV", path, name)
+        }
+    }
+    return inv, nil
+}
+
+// extractFile writes the archived file name into dir
+func extractFile(r io.Reader, dir, name string) error {
+    if !filepath.IsLocal(name) {
+        return fmt.Errorf("refusing to extract %s outside %s", name, dir)
+    }
+    path := filepath.Join(dir, name)
+    if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+        return fmt.Errorf("failed to create directory for %s: %v", path, err)
+    }
+    file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+    if err != nil {
+        return fmt.Errorf("failed to extract %s: %v", name, err)
+    }
+    defer file.Close()
+    if _, err := io.Copy(file, r); err != nil {
+        return fmt.Errorf("failed to extract %s: %v", name, err)
+    }
+    return file.Close()
+}
+
+// ConvertFromConfig converts the inventory at INPUT_FILE to OUTPUT_FILE,
+// each in its given format or the one its name suggests
+func ConvertFromConfig() error {
+    input := viper.GetString("INPUT_FILE")
+    output := viper.GetString("OUTPUT_FILE")
+    downloads := viper.GetString("DOWNLOAD_PATH")
+
+    from := viper.GetString("FROM_FORMAT")
+    if from == "" {
+        from = DetectFormat(input)
+    }
+    to := viper.GetString("TO_FORMAT")
+    if to == "" {
+        to = DetectFormat(output)
+    }
+
+    var inv *Inventory
+    var err error
+    if from == FormatArchive {
+        inv, err = readArchive(input, downloads)
+    } else {
+        inv, err = Read(input, from)
+    }
+    if err != nil {
+        return err
+    }
+
+    if to == FormatArchive {
+        err = writeArchive(inv, output, downloads)
+    } else {
+        err = Write(inv, output, to)
+    }
+    if err != nil {
+        return err
+    }
+
+    pterm.Success.Printf("Converted %d packages and %d versions from %s to %s (%s)\n",
+        len(inv.Packages.Rows), len(inv.Versions.Rows), from, to, output)
+    return nil
+}
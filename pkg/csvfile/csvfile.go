@@ -0,0 +1,130 @@
+package csvfile
+
+import (
+    "bufio"
+    "bytes"
+    "encoding/csv"
+    "fmt"
+    "io"
+    "unicode/utf8"
+)
+
+// bom marks a file as UTF-8 for spreadsheet applications, which otherwise
+// read non-ASCII package and owner names in the system's code page
+var bom = []byte{0xEF, 0xBB, 0xBF}
+
+// Options set how every CSV file the tool writes is laid out. Fields are
+// quoted as RFC 4180 requires whatever the options, and numbers are
+// written without separators so no locale misreads them
+type Options struct {
+    Delimiter rune
+    BOM       bool // start with a UTF-8 byte order mark
+    CRLF      bool // end lines with CRLF, as RFC 4180 does, instead of LF
+}
+
+var options = Options{Delimiter: ','}
+
+// Delimiters are the names --csv-delimiter accepts for delimiters awkward
+// to pass on a command line
+var Delimiters = map[string]rune{
+    "comma":     ',',
+    "semicolon": ';',
+    "tab":       '\t',
+    "pipe":      '|',
+}
+
+// ParseDelimiter accepts a delimiter by name or as a single character
+func ParseDelimiter(value string) (rune, error) {
+    if d, ok := Delimiters[value]; ok {
+        return d, nil
+    }
+    if value == `\t` {
+        return '\t', nil
+    }
+    d, size := utf8.DecodeRuneInString(value)
+    if size == 0 || size != len(value) || !validDelimiter(d) {
+        return 0, fmt.Errorf("expected comma, semicolon, tab, pipe, or a single character other than a quote or line break, got %q", value)
+    }
+    return d, nil
+}
+
+func validDelimiter(d rune) bool {
+    return d != '"' && d != '\r' && d != '\n' && d != utf8.RuneError && d != 0xFEFF
+}
+
+// Configure sets the options of the files written from now on
+func Configure(o Options) {
+    if o.Delimiter == 0 {
+        o.Delimiter = ','
+    }
+    options = o
+}
+
+// NewWriter returns a CSV writer to w laid out by the configured options
+func NewWriter(w io.Writer) *csv.Writer {
+    if options.BOM {
+        w = &bomWriter{w: w}
+    }
+    writer := csv.NewWriter(w)
+    writer.Comma = options.Delimiter
+    writer.UseCRLF = options.CRLF
+    return writer
+}
+
+// bomWriter writes the byte order mark ahead of the first write, so its
+// errors surface where the writer's own do
+type bomWriter struct {
+    w       io.Writer
+    written bool
+}
+
+func (b *bomWriter) Write(p []byte) (int, error) {
+    if !b.written {
+        b.written = true
+        if _, err := b.w.Write(bom); err != nil {
+            return 0, err
+        }
+    }
+    return b.w.Write(p)
+}
+
+// NewReader returns a CSV reader of r that skips a byte order mark and
+// takes the delimiter from the header row, so files written with any
+// options, or saved again by a spreadsheet application, read back
+func NewReader(r io.Reader) *csv.Reader {
+    buffered := bufio.NewReader(r)
+    if head, err := buffered.Peek(len(bom)); err == nil && bytes.Equal(head, bom) {
+        buffered.Discard(len(bom))
+    }
+    reader := csv.NewReader(buffered)
+    reader.Comma = sniffDelimiter(buffered)
+    return reader
+}
+
+// sniffDelimiter picks the delimiter, of the usual ones and the configured
+// one, found most often outside quotes in the first line, a comma when
+// there is none
+func sniffDelimiter(r *bufio.Reader) rune {
+    head, _ := r.Peek(r.Size())
+    if i := bytes.IndexByte(head, '\n'); i >= 0 {
+        head = head[:i]
+    }
+
+    counts := make(map[rune]int)
+    quoted := false
+    for _, c := range string(head) {
+        switch {
+        case c == '"':
+            quoted = !quoted
+        case !quoted && (c == ',' || c == ';' || c == '\t' || c == '|' || c == options.Delimiter):
+            counts[c]++
+        }
+    }
+    delimiter := ','
+    for _, c := range []rune{';', '\t', '|', options.Delimiter} {
+        if counts[c] > counts[delimiter] {
+            delimiter = c
+        }
+    }
+    return delimiter
+}
@@ -0,0 +1,368 @@
+package diff
+
+import (
+    "encoding/json"
+    "fmt"
+    "io/fs"
+    "os"
+    "path/filepath"
+    "sort"
+    "strconv"
+    "strings"
+
+    "github.com/cvega/gh-migrate-packages/pkg/csvfile"
+    "github.com/cvega/gh-migrate-packages/pkg/filter"
+    "github.com/cvega/gh-migrate-packages/pkg/snapshot"
+    "github.com/pterm/pterm"
+    "github.com/spf13/viper"
+)
+
+// Kinds of change between two exports
+const (
+    Added   = "added"
+    Removed = "removed"
+    Changed = "changed"
+)
+
+// Record is one version as an export saw it
+type Record struct {
+    Organization string
+    PackageType  string
+    Package      string
+    Version      string
+    VersionID    string
+    UpdatedAt    string
+    Size         int64
+    Files        map[string]string // name to SHA-256, nil when the export has no file list
+}
+
+func (r Record) key() string {
+    return strings.Join([]string{r.Organization, r.PackageType, r.Package, r.Version}, "\x00")
+}
+
+// Change is a version added, removed, or changed between two exports
+type Change struct {
+    Kind   string
+    Old    *Record
+    New    *Record
+    Detail string
+}
+
+// Record returns the newest side of the change
+func (c Change) Record() Record {
+    if c.New != nil {
+        return *c.New
+    }
+    return *c.Old
+}
+
+// manifest is the part of an export's metadata.json compared
+type manifest struct {
+    Package struct {
+        Name  string `json:"name"`
+        Type  string `json:"type"`
+        Owner struct {
+            Login string `json:"login"`
+        } `json:"owner"`
+    } `json:"package"`
+    Version struct {
+        ID        string `json:"id"`
+        Name      string `json:"name"`
+        UpdatedAt string `json:"updated_at"`
+        Files     []struct {
+            Name   string
+            Size   int64
+            SHA256 string
+        } `json:"files"`
+    } `json:"version"`
+}
+
+// Load reads the versions of an export: a download directory holding a
+// metadata.json per version, or a snapshot written by export --snapshot
+func Load(path string) ([]Record, error) {
+    info, err := os.Stat(path)
+    if err != nil {
+        return nil, fmt.Errorf("failed to read export %s: %v", path, err)
+    }
+    if info.IsDir() {
+        return loadManifests(path)
+    }
+    return loadSnapshot(path)
+}
+
+func loadManifests(dir string) ([]Record, error) {
+    var records []Record
+    err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+        if err != nil {
+            return err
+        }
+        if d.IsDir() || d.Name() != "metadata.json" {
+            return nil
+        }
+
+        data, err := os.ReadFile(path)
+        if err != nil {
+            return err
+        }
+        var m manifest
+        if err := json.Unmarshal(data, &m); err != nil {
+            return fmt.Errorf("failed to parse %s: %v", path, err)
+        }
+
+        record := Record{
+            Organization: m.Package.Owner.Login,
+            PackageType:  m.Package.Type,
+            Package:      m.Package.Name,
+            Version:      m.Version.Name,
+            VersionID:    m.Version.ID,
+            UpdatedAt:    m.Version.UpdatedAt,
+            Files:        make(map[string]string),
+        }
+        for _, f := range m.Version.Files {
+            record.Files[f.Name] = f.SHA256
+            record.Size += f.Size
+        }
+        records = append(records, record)
+        return nil
+    })
+    if err != nil {
+        return nil, fmt.Errorf("failed to read export %s: %v", dir, err)
+    }
+    if len(records) == 0 {
+        return nil, fmt.Errorf("no metadata.json found under %s, expected an export download directory", dir)
+    }
+    return records, nil
+}
+
+func loadSnapshot(path string) ([]Record, error) {
+    snap, err := snapshot.Load(path)
+    if err != nil {
+        return nil, err
+    }
+    var records []Record
+    for _, p := range snap.Packages {
+        for _, v := range p.Versions {
+            records = append(records, Record{
+                Organization: p.Organization,
+                PackageType:  p.PackageType,
+                Package:      p.Name,
+                Version:      v.Name,
+                VersionID:    v.ID,
+            })
+        }
+    }
+    return records, nil
+}
+
+// Compare lists what changed from old to current, ordered by
+// organization, type, package, and version
+func Compare(old, current []Record) []Change {
+    before := make(map[string]Record, len(old))
+    for _, r := range old {
+        before[r.key()] = r
+    }
+    after := make(map[string]Record, len(current))
+    for _, r := range current {
+        after[r.key()] = r
+    }
+
+    var changes []Change
+    for key, n := range after {
+        n := n
+        o, ok := before[key]
+        if !ok {
+            changes = append(changes, Change{Kind: Added, New: &n})
+            continue
+        }
+        if detail := compareRecords(o, n); detail != "" {
+            changes = append(changes, Change{Kind: Changed, Old: &o, New: &n, Detail: detail})
+        }
+    }
+    for key, o := range before {
+        o := o
+        if _, ok := after[key]; !ok {
+            changes = append(changes, Change{Kind: Removed, Old: &o})
+        }
+    }
+
+    sort.Slice(changes, func(i, j int) bool {
+        a, b := changes[i].Record(), changes[j].Record()
+        return a.key() < b.key()
+    })
+    return changes
+}
+
+// compareRecords describes how a version differs, or returns "" when it
+// doesn't. File lists are only compared when both exports have them
+func compareRecords(o, n Record) string {
+    var details []string
+    if o.VersionID != n.VersionID {
+        details = append(details, fmt.Sprintf("republished as version ID %s, was %s", n.VersionID, o.VersionID))
+    }
+    if o.UpdatedAt != n.UpdatedAt && o.UpdatedAt != "" && n.UpdatedAt != "" {
+        details = append(details, fmt.Sprintf("updated %s", n.UpdatedAt))
+    }
+    if o.Files == nil || n.Files == nil {
+        return strings.Join(details, "; ")
+    }
+
+    var added, removed, modified []string
+    for name, digest := range n.Files {
+        previous, ok := o.Files[name]
+        switch {
+        case !ok:
+            added = append(added, name)
+        case previous != digest:
+            modified = append(modified, name)
+        }
+    }
+    for name := range o.Files {
+        if _, ok := n.Files[name]; !ok {
+            removed = append(removed, name)
+        }
+    }
+    for _, files := range []struct {
+        label string
+        names []string
+    }{{"files added", added}, {"files removed", removed}, {"files changed", modified}} {
+        if len(files.names) > 0 {
+            sort.Strings(files.names)
+            details = append(details, fmt.Sprintf("%s: %s", files.label, strings.Join(files.names, ", ")))
+        }
+    }
+    return strings.Join(details, "; ")
+}
+
+// Delta is the snapshot of the added and changed versions, for a sync
+// --snapshot that migrates only what moved since the old export
+func Delta(changes []Change) *snapshot.Snapshot {
+    delta := snapshot.New()
+    index := make(map[string]int)
+    for _, c := range changes {
+        if c.Kind == Removed {
+            continue
+        }
+        r := *c.New
+        key := strings.Join([]string{r.Organization, r.PackageType, r.Package}, "\x00")
+        i, ok := index[key]
+        if !ok {
+            i = len(delta.Packages)
+            index[key] = i
+            delta.Packages = append(delta.Packages, snapshot.Package{
+                Organization: r.Organization,
+                PackageType:  r.PackageType,
+                Name:         r.Package,
+            })
+        }
+        delta.Packages[i].Versions = append(delta.Packages[i].Versions, snapshot.Version{ID: r.VersionID, Name: r.Version})
+    }
+    return delta
+}
+
+// DiffFromConfig compares the exports at oldPath and newPath
+func DiffFromConfig(oldPath, newPath string) error {
+    old, err := Load(oldPath)
+    if err != nil {
+        return err
+    }
+    current, err := Load(newPath)
+    if err != nil {
+        return err
+    }
+
+    changes := Compare(old, current)
+    reportChanges(changes)
+
+    if report := viper.GetString("OUTPUT_FILE"); report != "" {
+        if err := writeChanges(report, changes); err != nil {
+            return fmt.Errorf("failed to write diff report: %v", err)
+        }
+        pterm.Info.Printf("%d changed versions written to %s\n", len(changes), report)
+    }
+
+    if path := viper.GetString("DELTA_SNAPSHOT"); path != "" {
+        delta := Delta(changes)
+        if err := delta.Save(path); err != nil {
+            return err
+        }
+        pterm.Info.Printf("Added and changed versions of %d packages written to %s, migrate them with sync --snapshot %s\n", len(delta.Packages), path, path)
+    }
+    return nil
+}
+
+// reportChanges prints the number of changes and their size per type
+func reportChanges(changes []Change) {
+    if len(changes) == 0 {
+        pterm.Success.Println("The exports list the same versions")
+        return
+    }
+
+    type totals struct {
+        added, removed, changed int
+        size                    int64 // of added and changed versions
+    }
+    byType := make(map[string]*totals)
+    var types []string
+    for _, c := range changes {
+        r := c.Record()
+        t, ok := byType[r.PackageType]
+        if !ok {
+            t = &totals{}
+            byType[r.PackageType] = t
+            types = append(types, r.PackageType)
+        }
+        switch c.Kind {
+        case Added:
+            t.added++
+            t.size += r.Size
+        case Removed:
+            t.removed++
+        case Changed:
+            t.changed++
+            t.size += r.Size
+        }
+    }
+    sort.Strings(types)
+
+    table := pterm.TableData{
+        {"Type", "Added", "Removed", "Changed", "Size to sync"},
+    }
+    for _, name := range types {
+        t := byType[name]
+        table = append(table, []string{
+            name, strconv.Itoa(t.added), strconv.Itoa(t.removed), strconv.Itoa(t.changed), filter.FormatSize(t.size),
+        })
+    }
+    pterm.DefaultTable.WithHasHeader().WithData(table).Render()
+}
+
+func writeChanges(filename string, changes []Change) error {
+    file, err := os.Create(filename)
+    if err != nil {
+        return err
+    }
+    defer file.Close()
+
+    writer := csvfile.NewWriter(file)
+    defer writer.Flush()
+
+    header := []string{"Change", "Organization", "Type", "Package", "Version", "Old Version ID", "New Version ID", "Old Size", "New Size", "Detail"}
+    if err := writer.Write(header); err != nil {
+        return err
+    }
+    for _, c := range changes {
+        r := c.Record()
+        var oldID, newID, oldSize, newSize string
+        if c.Old != nil {
+            oldID, oldSize = c.Old.VersionID, strconv.FormatInt(c.Old.Size, 10)
+        }
+        if c.New != nil {
+            newID, newSize = c.New.VersionID, strconv.FormatInt(c.New.Size, 10)
+        }
+        row := []string{c.Kind, r.Organization, r.PackageType, r.Package, r.Version, oldID, newID, oldSize, newSize, c.Detail}
+        if err := writer.Write(row); err != nil {
+            return err
+        }
+    }
+    return nil
+}
@@ -0,0 +1,188 @@
+package doctor
+
+import (
+    "fmt"
+    "net/http"
+    "sort"
+    "strings"
+
+    "github.com/cvega/gh-migrate-packages/pkg/api"
+    "github.com/cvega/gh-migrate-packages/pkg/package"
+    "github.com/pterm/pterm"
+    "github.com/spf13/viper"
+)
+
+const (
+    StatusPass = "pass"
+    StatusWarn = "warn"
+    StatusFail = "fail"
+)
+
+// Check is the outcome of one preflight check
+type Check struct {
+    Name   string
+    Status string
+    Detail string
+}
+
+// RunFromConfig checks everything a migration needs before it starts: that
+// the source token can read packages and the target token can write them,
+// that both organizations exist and the tokens are authorized for their
+// SAML SSO, and that every registry endpoint answers through the proxy the
+// environment configures. Nothing is changed in either organization
+func RunFromConfig() error {
+    sourceOrg := viper.GetString("SOURCE_ORGANIZATION")
+    targetOrg := viper.GetString("TARGET_ORGANIZATION")
+
+    types := []string{viper.GetString("PACKAGE_TYPE")}
+    if types[0] == "" {
+        types = nil
+        for _, packageType := range pkg.HostedTypes {
+            types = append(types, string(packageType))
+        }
+    }
+
+    source := api.NewAPI(viper.GetString("SOURCE_TOKEN"), viper.GetString("SOURCE_HOSTNAME"))
+    target := api.NewAPI(viper.GetString("TARGET_TOKEN"), "")
+    source.SetReadOnly()
+    target.SetReadOnly()
+
+    sourceRegistries, err := api.ParseRegistries(viper.GetString("SOURCE_REGISTRY_URLS"))
+    if err != nil {
+        return fmt.Errorf("invalid source registry url: %v", err)
+    }
+    source.SetRegistries(sourceRegistries)
+    sourceTokens, err := api.ParseRegistryTokens(viper.GetString("SOURCE_REGISTRY_TOKENS"))
+    if err != nil {
+        return fmt.Errorf("invalid source registry token: %v", err)
+    }
+    source.SetRegistryTokens(sourceTokens)
+    targetRegistries, err := api.ParseRegistries(viper.GetString("TARGET_REGISTRY_URLS"))
+    if err != nil {
+        return fmt.Errorf("invalid target registry url: %v", err)
+    }
+    target.SetRegistries(targetRegistries)
+    targetTokens, err := api.ParseRegistryTokens(viper.GetString("TARGET_REGISTRY_TOKENS"))
+    if err != nil {
+        return fmt.Errorf("invalid target registry token: %v", err)
+    }
+    target.SetRegistryTokens(targetTokens)
+
+    spinner, _ := pterm.DefaultSpinner.Start("Running preflight checks...")
+    checks := []Check{
+        checkToken("source token", source, "read:packages"),
+        checkToken("target token", target, "write:packages"),
+        checkOrganization("source organization", source, sourceOrg, types[0]),
+        checkOrganization("target organization", target, targetOrg, types[0]),
+    }
+    checks = append(checks, checkRegistries("source", source, types, sourceRegistries)...)
+    checks = append(checks, checkRegistries("target", target, types, targetRegistries)...)
+    spinner.Stop()
+
+    failed, warned := render(checks)
+    if failed > 0 {
+        return fmt.Errorf("%d of %d preflight checks failed", failed, len(checks))
+    }
+    if warned > 0 {
+        pterm.Warning.Printf("All checks passed, %d with warnings to review\n", warned)
+        return nil
+    }
+    pterm.Success.Println("All checks passed, ready to migrate")
+    return nil
+}
+
+// checkToken makes sure the token works and, for classic tokens, that it
+// was granted scope. Other tokens can't be checked until they are used
+func checkToken(name string, client *api.API, scope string) Check {
+    info, err := client.GetTokenInfo()
+    if err != nil {
+        if access, ok := err.(*api.AccessError); ok && access.Status == http.StatusForbidden {
+            return Check{name, StatusWarn, fmt.Sprintf("can't read its user, as GitHub App tokens can't, make sure it has %s", scope)}
+        }
+        return Check{name, StatusFail, err.Error()}
+    }
+    if !info.Classic {
+        return Check{name, StatusWarn, fmt.Sprintf("%s has a fine-grained token, whose permissions can't be listed, make sure it allows %s", info.Login, scope)}
+    }
+    if !info.HasScope(scope) {
+        granted := strings.Join(info.Scopes, ", ")
+        if granted == "" {
+            granted = "none"
+        }
+        return Check{name, StatusFail, fmt.Sprintf("%s's token is missing %s, it has: %s", info.Login, scope, granted)}
+    }
+    return Check{name, StatusPass, fmt.Sprintf("%s, with %s", info.Login, scope)}
+}
+
+func checkOrganization(name string, client *api.API, org, packageType string) Check {
+    if err := client.CheckOrganization(org, packageType); err != nil {
+        return Check{name, StatusFail, fmt.Sprintf("%s: %v", org, err)}
+    }
+    return Check{name, StatusPass, fmt.Sprintf("%s, packages can be listed", org)}
+}
+
+// checkRegistries makes sure the registry endpoint of every type, and of
+// every configured external registry, answers. Any HTTP response will do,
+// even 401, as the point is that a connection can be made at all
+func checkRegistries(side string, client *api.API, types []string, registries api.Registries) []Check {
+    var configured []string
+    for packageType := range registries {
+        configured = append(configured, packageType)
+    }
+    sort.Strings(configured)
+
+    var checks []Check
+    seen := make(map[string]bool)
+    for _, packageType := range append(append([]string{}, types...), configured...) {
+        endpoint := client.RegistryBaseURL(packageType)
+        if seen[endpoint] {
+            continue
+        }
+        seen[endpoint] = true
+        if packageType == string(pkg.PackageTypeContainer) && registries[packageType] == "" {
+            endpoint += "/v2/"
+        }
+        checks = append(checks, checkEndpoint(fmt.Sprintf("%s %s registry", side, packageType), client, packageType, endpoint))
+    }
+    return checks
+}
+
+func checkEndpoint(name string, client *api.API, packageType, endpoint string) Check {
+    route := "direct"
+    if req, err := http.NewRequest(http.MethodGet, endpoint, nil); err == nil {
+        if proxy, err := http.ProxyFromEnvironment(req); err != nil {
+            return Check{name, StatusFail, fmt.Sprintf("%s: invalid proxy: %v", endpoint, err)}
+        } else if proxy != nil {
+            route = "via " + proxy.Redacted()
+        }
+    }
+
+    resp, err := client.FetchRegistry(packageType, http.MethodGet, endpoint, nil)
+    if err != nil {
+        return Check{name, StatusFail, fmt.Sprintf("%s unreachable %s: %v", endpoint, route, err)}
+    }
+    resp.Body.Close()
+    return Check{name, StatusPass, fmt.Sprintf("%s answered %d %s", endpoint, resp.StatusCode, route)}
+}
+
+// render prints the checks as a table, and counts failures and warnings
+func render(checks []Check) (int, int) {
+    failed, warned := 0, 0
+    table := pterm.TableData{{"Check", "Status", "Detail"}}
+    for _, c := range checks {
+        status := c.Status
+        switch c.Status {
+        case StatusPass:
+            status = pterm.Green(status)
+        case StatusWarn:
+            warned++
+            status = pterm.Yellow(status)
+        case StatusFail:
+            failed++
+            status = pterm.Red(status)
+        }
+        table = append(table, []string{c.Name, status, c.Detail})
+    }
+    pterm.DefaultTable.WithHasHeader().WithData(table).Render()
+    return failed, warned
+}
@@ -0,0 +1,268 @@
+package export
+
+import (
+    "archive/tar"
+    "bytes"
+    "compress/gzip"
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "fmt"
+    "io"
+    "os"
+    "os/exec"
+    "path/filepath"
+    "sort"
+    "strings"
+    "time"
+
+    "github.com/cvega/gh-migrate-packages/pkg/run"
+)
+
+// Compressions of an export archive, by the archive's extension
+const (
+    compressNone = ""
+    compressGzip = "gzip"
+    compressZstd = "zstd" // through the zstd CLI
+)
+
+// Paths within an export archive
+const (
+    archiveManifest  = "manifest.json"
+    archiveDownloads = "downloads"
+)
+
+// ArchiveCompression returns how an archive named path is compressed:
+// .tar.zst/.tzst with zstd, .tar.gz/.tgz with gzip, or .tar not at all
+func ArchiveCompression(path string) (string, error) {
+    lower := strings.ToLower(path)
+    switch {
+    case strings.HasSuffix(lower, ".tar.zst"), strings.HasSuffix(lower, ".tzst"):
+        return compressZstd, nil
+    case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+        return compressGzip, nil
+    case strings.HasSuffix(lower, ".tar"):
+        return compressNone, nil
+    }
+    return "", fmt.Errorf("unsupported archive %q, expected .tar.zst, .tar.gz, or .tar", path)
+}
+
+// ArchiveManifest is the manifest.json at the top of an export archive,
+// written last: every other file in the archive with its checksum
+type ArchiveManifest struct {
+    RunID         string           `json:"run_id"`
+    CreatedAt     time.Time        `json:"created_at"`
+    Organizations []DocumentSource `json:"organizations"`
+    Downloads     ArchiveDownloads `json:"downloads"`
+    Files         []ArchiveFile    `json:"files"`
+}
+
+// ArchiveDownloads counts the versions whose downloads the archive holds
+type ArchiveDownloads struct {
+    Complete  int `json:"complete"`
+    Failed    int `json:"failed"`    // archived as far as they got, import reports them as failed
+    Remaining int `json:"remaining"` // left by --time-limit, not in the archive
+}
+
+type ArchiveFile struct {
+    Path   string `json:"path"`
+    Size   int64  `json:"size"`
+    SHA256 string `json:"sha256"`
+}
+
+// requireZstd fails with how to get the zstd CLI when it isn't on the PATH.
+// The module has no zstd encoder of its own, so export checks this before
+// listing anything rather than failing once the downloads are done
+func requireZstd() error {
+    if _, err := exec.LookPath("zstd"); err != nil {
+        return fmt.Errorf(".tar.zst archives need the zstd command on the PATH: install zstd (e.g. apt install zstd or brew install zstd) or name a .tar.gz or .tar archive")
+    }
+    return nil
+}
+
+// zstdWriter compresses what is written to it into a file with the zstd
+// CLI
+type zstdWriter struct {
+    stdin  io.WriteCloser
+    cmd    *exec.Cmd
+    stderr bytes.Buffer
+}
+
+func newZstdWriter(path string) (*zstdWriter, error) {
+    if err := requireZstd(); err != nil {
+        return nil, err
+    }
+    w := &zstdWriter{cmd: exec.Command("zstd", "-q", "-f", "-T0", "-o", path)}
+    w.cmd.Stderr = &w.stderr
+    stdin, err := w.cmd.StdinPipe()
+    if err != nil {
+        return nil, err
+    }
+    w.stdin = stdin
+    if err := w.cmd.Start(); err != nil {
+        return nil, fmt.Errorf("failed to start zstd: %v", err)
+    }
+    return w, nil
+}
+
+func (w *zstdWriter) Write(p []byte) (int, error) {
+    return w.stdin.Write(p)
+}
+
+func (w *zstdWriter) Close() error {
+    w.stdin.Close()
+    if err := w.cmd.Wait(); err != nil {
+        return fmt.Errorf("zstd failed: %v: %s", err, strings.TrimSpace(w.stderr.String()))
+    }
+    return nil
+}
+
+// gzipFile closes the gzip stream before the file under it
+type gzipFile struct {
+    *gzip.Writer
+    file *os.File
+}
+
+func (g gzipFile) Close() error {
+    if err := g.Writer.Close(); err != nil {
+        g.file.Close()
+        return err
+    }
+    return g.file.Close()
+}
+
+// createCompressed opens path for writing, compressed as its name says
+func createCompressed(path string) (io.WriteCloser, error) {
+    compression, err := ArchiveCompression(path)
+    if err != nil {
+        return nil, err
+    }
+    if compression == compressZstd {
+        return newZstdWriter(path)
+    }
+
+    file, err := os.Create(path)
+    if err != nil {
+        return nil, err
+    }
+    if compression == compressGzip {
+        return gzipFile{gzip.NewWriter(file), file}, nil
+    }
+    return file, nil
+}
+
+// archiveWriter adds files to a tar stream, recording their checksums for
+// the manifest
+type archiveWriter struct {
+    tw       *tar.Writer
+    manifest *ArchiveManifest
+}
+
+// addFile adds the file at path to the archive as name
+func (a *archiveWriter) addFile(path, name string, info os.FileInfo) error {
+    header, err := tar.FileInfoHeader(info, "")
+    if err != nil {
+        return err
+    }
+    header.Name = name
+    if err := a.tw.WriteHeader(header); err != nil {
+        return err
+    }
+
+    file, err := os.Open(path)
+    if err != nil {
+        return err
+    }
+    defer file.Close()
+    hash := sha256.New()
+    size, err := io.Copy(io.MultiWriter(a.tw, hash), file)
+    if err != nil {
+        return err
+    }
+    a.manifest.Files = append(a.manifest.Files, ArchiveFile{Path: name, Size: size, SHA256: hex.EncodeToString(hash.Sum(nil))})
+    return nil
+}
+
+// addDirectory adds the regular files under dir as name/..., leaving out
+// the archive itself when it is written inside dir
+func (a *archiveWriter) addDirectory(dir, name, skip string) error {
+    return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+        if err != nil {
+            return err
+        }
+        if !info.Mode().IsRegular() || sameFile(path, skip) {
+            return nil
+        }
+        rel, err := filepath.Rel(dir, path)
+        if err != nil {
+            return err
+        }
+        return a.addFile(path, filepath.ToSlash(filepath.Join(name, rel)), info)
+    })
+}
+
+func sameFile(a, b string) bool {
+    absA, errA := filepath.Abs(a)
+    absB, errB := filepath.Abs(b)
+    return errA == nil && errB == nil && absA == absB
+}
+
+// createArchive packs the listing files, at the top, and the downloads
+// directory, under downloads/, into one archive at path, then adds a
+// manifest of everything in it with SHA-256 checksums
+func createArchive(path string, listing []string, downloadPath string, manifest *ArchiveManifest) error {
+    out, err := createCompressed(path)
+    if err != nil {
+        return err
+    }
+    // Nothing half written is left behind under the archive's name
+    complete := false
+    defer func() {
+        if !complete {
+            out.Close()
+            os.Remove(path)
+        }
+    }()
+
+    archive := &archiveWriter{tw: tar.NewWriter(out), manifest: manifest}
+    for _, file := range listing {
+        info, err := os.Stat(file)
+        if err != nil {
+            return fmt.Errorf("failed to archive %s: %v", file, err)
+        }
+        if err := archive.addFile(file, filepath.Base(file), info); err != nil {
+            return fmt.Errorf("failed to archive %s: %v", file, err)
+        }
+    }
+    if err := archive.addDirectory(downloadPath, archiveDownloads, path); err != nil {
+        return fmt.Errorf("failed to archive %s: %v", downloadPath, err)
+    }
+
+    sort.Slice(manifest.Files, func(i, j int) bool {
+        return manifest.Files[i].Path < manifest.Files[j].Path
+    })
+    manifest.RunID = run.ID()
+    manifest.CreatedAt = time.Now().UTC()
+    data, err := json.MarshalIndent(manifest, "", "  ")
+    if err != nil {
+        return fmt.Errorf("failed to encode archive manifest: %v", err)
+    }
+    data = append(data, '\n')
+    header := &tar.Header{Name: archiveManifest, Mode: 0644, Size: int64(len(data)), ModTime: manifest.CreatedAt}
+    if err := archive.tw.WriteHeader(header); err != nil {
+        return fmt.Errorf("failed to write %s: %v", path, err)
+    }
+    if _, err := archive.tw.Write(data); err != nil {
+        return fmt.Errorf("failed to write %s: %v", path, err)
+    }
+
+    if err := archive.tw.Close(); err != nil {
+        return fmt.Errorf("failed to write %s: %v", path, err)
+    }
+    complete = true
+    if err := out.Close(); err != nil {
+        os.Remove(path)
+        return fmt.Errorf("failed to write %s: %v", path, err)
+    }
+    return nil
+}
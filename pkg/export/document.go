@@ -0,0 +1,171 @@
+package export
+
+import (
+    "encoding/json"
+    "fmt"
+    "os"
+    "strings"
+    "time"
+
+    "github.com/cvega/gh-migrate-packages/pkg/api"
+    "github.com/cvega/gh-migrate-packages/pkg/run"
+)
+
+// Formats the export writes its packages and versions listing in
+const (
+    FormatCSV    = "csv"    // PREFIX_packages.csv and PREFIX_versions.csv
+    FormatJSON   = "json"   // PREFIX_export.json, packages with their versions and files nested
+    FormatSQLite = "sqlite" // PREFIX_export.db, packages, versions, and files tables, through the sqlite3 CLI
+    FormatBoth   = "both"   // the CSVs and the JSON document
+)
+
+var Formats = []string{FormatCSV, FormatJSON, FormatSQLite, FormatBoth}
+
+// ParseFormats parses a comma-separated list of formats into the set to
+// write, with both standing for csv and json
+func ParseFormats(spec string) (map[string]bool, error) {
+    formats := make(map[string]bool)
+    for _, format := range strings.Split(spec, ",") {
+        switch format = strings.TrimSpace(format); format {
+        case "":
+        case FormatBoth:
+            formats[FormatCSV] = true
+            formats[FormatJSON] = true
+        case FormatCSV, FormatJSON, FormatSQLite:
+            formats[format] = true
+        default:
+            return nil, fmt.Errorf("unsupported format %q, expected %s", format, strings.Join(Formats, ", "))
+        }
+    }
+    if len(formats) == 0 {
+        formats[FormatCSV] = true
+    }
+    return formats, nil
+}
+
+// Document is the JSON export: every package with its versions and their
+// files, typed, so tooling needn't know the CSV columns
+type Document struct {
+    RunID         string            `json:"run_id"`
+    ExportedAt    time.Time         `json:"exported_at"`
+    Organizations []DocumentSource  `json:"organizations"`
+    Packages      []DocumentPackage `json:"packages"`
+}
+
+// DocumentSource is an organization exported into the document
+type DocumentSource struct {
+    Hostname     string `json:"hostname"`
+    Organization string `json:"organization"`
+}
+
+type DocumentPackage struct {
+    ID         string              `json:"id"`
+    Name       string              `json:"name"`
+    Type       string              `json:"type"`
+    Status     string              `json:"status"`
+    Visibility string              `json:"visibility"`
+    Owner      DocumentOwner       `json:"owner"`
+    Repository *DocumentRepository `json:"repository,omitempty"` // nil for orphaned packages
+    Downloads  int                 `json:"downloads"`
+    Source     *DocumentSource     `json:"source,omitempty"` // only in merged inventories
+    Versions   []DocumentVersion   `json:"versions"`
+}
+
+type DocumentOwner struct {
+    Login string `json:"login"`
+    Type  string `json:"type"`
+}
+
+type DocumentRepository struct {
+    Name     string `json:"name"`
+    FullName string `json:"full_name,omitempty"`
+    URL      string `json:"url"`
+}
+
+type DocumentVersion struct {
+    ID        string                 `json:"id"`
+    Name      string                 `json:"name"`
+    CreatedAt string                 `json:"created_at,omitempty"`
+    UpdatedAt string                 `json:"updated_at,omitempty"`
+    Size      int64                  `json:"size"`
+    Metadata  map[string]interface{} `json:"metadata,omitempty"`
+    Files     []DocumentFile         `json:"files"`
+}
+
+type DocumentFile struct {
+    Name   string `json:"name"`
+    Size   int    `json:"size"`
+    SHA256 string `json:"sha256,omitempty"`
+    URL    string `json:"url,omitempty"`
+}
+
+// newDocument builds the document of the exported packages. origins is
+// only given for a merged inventory, as with the CSVs
+func newDocument(sources []Source, packages []api.Package, origins []Source, empty map[string]bool) *Document {
+    doc := &Document{
+        RunID:      run.ID(),
+        ExportedAt: time.Now().UTC(),
+        Packages:   make([]DocumentPackage, 0, len(packages)),
+    }
+    for _, source := range sources {
+        doc.Organizations = append(doc.Organizations, DocumentSource{Hostname: source.Host(), Organization: source.Organization})
+    }
+
+    for i, pkg := range packages {
+        entry := DocumentPackage{
+            ID:         pkg.ID,
+            Name:       pkg.Name,
+            Type:       pkg.PackageType,
+            Status:     api.PackageStatusActive,
+            Visibility: pkg.Visibility,
+            Owner:      DocumentOwner{Login: pkg.Owner.Login, Type: pkg.Owner.Type},
+            Versions:   make([]DocumentVersion, 0, len(pkg.Versions)),
+        }
+        if empty[pkg.ID] {
+            entry.Status = api.PackageStatusEmpty
+        }
+        if !pkg.IsOrphaned() {
+            entry.Repository = &DocumentRepository{Name: pkg.Repository.Name, FullName: pkg.Repository.FullName, URL: pkg.Repository.URL}
+        }
+        if pkg.Statistics != nil {
+            entry.Downloads = pkg.Statistics.DownloadsCount
+        }
+        if origins != nil {
+            entry.Source = &DocumentSource{Hostname: origins[i].Host(), Organization: origins[i].Organization}
+        }
+
+        for _, ver := range pkg.Versions {
+            version := DocumentVersion{
+                ID:        ver.ID,
+                Name:      ver.Name,
+                CreatedAt: ver.CreatedAt,
+                UpdatedAt: ver.UpdatedAt,
+                Metadata:  ver.Metadata,
+                Files:     make([]DocumentFile, 0, len(ver.Files)),
+            }
+            for _, file := range ver.Files {
+                version.Size += int64(file.Size)
+                version.Files = append(version.Files, DocumentFile{Name: file.Name, Size: file.Size, SHA256: file.SHA256, URL: file.URL})
+            }
+            entry.Versions = append(entry.Versions, version)
+        }
+        doc.Packages = append(doc.Packages, entry)
+    }
+    return doc
+}
+
+func createDocument(prefix string, doc *Document) (string, error) {
+    filename := fmt.Sprintf("%s_export.json", prefix)
+    file, err := os.Create(filename)
+    if err != nil {
+        return "", err
+    }
+    defer file.Close()
+
+    encoder := json.NewEncoder(file)
+    encoder.SetIndent("", "  ")
+    if err := encoder.Encode(doc); err != nil {
+        return "", err
+    }
+    return filename, nil
+}
@@ -5,17 +5,69 @@ import (
     "io"
     "net/http"
     "os"
+    "path/filepath"
+    "strings"
+
+    "github.com/cvega/gh-migrate-packages/pkg/extension"
 )
 
-func (a *API) DownloadFile(url, destPath string) error {
-    // Create a new HTTP request
-    req, err := http.NewRequestWithContext(a.ctx, "GET", url, nil)
+// DownloadFile saves url, served by the registry of packageType, to destPath
+func (a *API) DownloadFile(packageType, url, destPath string) error {
+    return a.downloadFile(packageType, url, destPath, nil)
+}
+
+// DownloadVersionFile saves one file of a packageType version to destPath,
+// hashing it with SHA-256 on the way for VerifyFile
+func (a *API) DownloadVersionFile(packageType string, file File, destPath string) error {
+    return a.downloadFile(packageType, file.URL, destPath, []string{"sha256"})
+}
+
+// ChecksumError is a download whose SHA-256 isn't the one the API listed
+type ChecksumError struct {
+    Name     string
+    Expected string
+    Got      string
+}
+
+func (e *ChecksumError) Error() string {
+    return fmt.Sprintf("checksum mismatch for %s: expected %s, got %s", e.Name, e.Expected, e.Got)
+}
+
+// ListedSHA256 is the SHA-256 the API listed for file, lowercase hex, or
+// empty when it listed none
+func ListedSHA256(file File) string {
+    return strings.ToLower(strings.TrimPrefix(file.SHA256, "sha256:"))
+}
+
+// VerifyFile checks the file at path against the SHA-256 listed for it,
+// reusing the digest computed while it downloaded. A file without a
+// listed SHA-256 passes
+func VerifyFile(path string, file File) error {
+    expected := ListedSHA256(file)
+    if expected == "" {
+        return nil
+    }
+    digest, err := FileSHA256(path)
     if err != nil {
-        return fmt.Errorf("failed to create request: %v", err)
+        return err
+    }
+    if digest != expected {
+        return &ChecksumError{Name: file.Name, Expected: expected, Got: digest}
     }
+    return nil
+}
 
-    // Send the request
-    resp, err := http.DefaultClient.Do(req)
+// downloadFile saves url to destPath, hashing it with each algorithm on
+// the way so later uploads find the digests already computed. The request
+// is authenticated for the registry of packageType, and a failed download
+// leaves no partial file behind
+func (a *API) downloadFile(packageType, url, destPath string, algorithms []string) error {
+    digests, err := NewMultiHash(algorithms...)
+    if err != nil {
+        return err
+    }
+
+    resp, err := a.FetchRegistry(packageType, http.MethodGet, url, nil)
     if err != nil {
         return fmt.Errorf("failed to download file: %v", err)
     }
@@ -30,13 +82,81 @@ func (a *API) DownloadFile(url, destPath string) error {
     if err != nil {
         return fmt.Errorf("failed to create file: %v", err)
     }
-    defer file.Close()
 
     // Copy the response body to the file
-    _, err = io.Copy(file, resp.Body)
+    _, err = io.Copy(io.MultiWriter(file, digests), resp.Body)
+    if closeErr := file.Close(); err == nil {
+        err = closeErr
+    }
     if err != nil {
+        os.Remove(destPath)
         return fmt.Errorf("failed to save file: %v", err)
     }
 
+    if len(algorithms) > 0 {
+        rememberDigests(destPath, digests.Digests())
+    }
+
     return nil
 }
+
+// downloadPath is where file name, as the registry listed it, goes in
+// destDir. Names that would land outside destDir are refused
+func downloadPath(destDir, name string) (string, error) {
+    if !filepath.IsLocal(name) {
+        return "", fmt.Errorf("refusing to download %s outside %s", name, destDir)
+    }
+    return filepath.Join(destDir, name), nil
+}
+
+// DownloadPackageVersion downloads every file of a version into destDir
+func (a *API) DownloadPackageVersion(org string, p Package, v Version, destDir string) ([]string, error) {
+    if err := os.MkdirAll(destDir, 0755); err != nil {
+        return nil, fmt.Errorf("failed to create directory: %v", err)
+    }
+
+    // Custom package types are fetched by their external handler
+    if handler, ok := extension.Lookup(p.PackageType); ok {
+        return handler.Download(a.ctx, a.token, extension.Request{
+            Organization: org,
+            Hostname:     a.hostname,
+            PackageName:  p.Name,
+            Version:      v.Name,
+            DestDir:      destDir,
+        })
+    }
+
+    algorithms := approvedAlgorithms(digestAlgorithms[p.PackageType])
+    if len(algorithms) == 0 {
+        algorithms = []string{"sha256"}
+    }
+
+    var files []string
+    for _, file := range v.Files {
+        path, err := downloadPath(destDir, file.Name)
+        if err != nil {
+            return nil, err
+        }
+
+        // File names may carry a layout prefix such as a conda subdir
+        if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+            return nil, fmt.Errorf("failed to create directory: %v", err)
+        }
+
+        if err := a.downloadFile(p.PackageType, file.URL, path, algorithms); err != nil {
+            return nil, fmt.Errorf("failed to download %s: %v", file.Name, err)
+        }
+
+        // Opaque file sets are only trustworthy if their digests match
+        if p.PackageType == "generic" {
+            if err := VerifyFile(path, file); err != nil {
+                os.Remove(path)
+                return nil, err
+            }
+        }
+
+        files = append(files, path)
+    }
+
+    return files, nil
+}
@@ -0,0 +1,25 @@
+package export
+
+import (
+    "github.com/cvega/gh-migrate-packages/pkg/api"
+    "github.com/pterm/pterm"
+)
+
+// reportEmptyPackages lists the inventoried packages that have no versions
+// left to export; they stay in the packages CSV with status empty but don't
+// count towards the exported totals
+func reportEmptyPackages(empty []api.Package) {
+    if len(empty) == 0 {
+        return
+    }
+
+    pterm.DefaultSection.Println("Empty packages")
+    table := pterm.TableData{
+        {"Package", "Type", "Status", "Visibility"},
+    }
+    for _, pkg := range empty {
+        table = append(table, []string{pkg.Name, pkg.PackageType, api.PackageStatusEmpty, pkg.Visibility})
+    }
+    pterm.DefaultTable.WithHasHeader().WithData(table).Render()
+    pterm.Info.Printf("%d packages have no versions left in the source and were not exported\n", len(empty))
+}
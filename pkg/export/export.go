@@ -1,28 +1,41 @@
 package export
 
 import (
-    "encoding/csv"
     "fmt"
     "os"
     "path/filepath"
     "strconv"
+    "strings"
     "sync"
     "time"
 
     "github.com/pterm/pterm"
     "github.com/spf13/viper"
     "github.com/cvega/gh-migrate-packages/pkg/api"
+    "github.com/cvega/gh-migrate-packages/pkg/checkpoint"
+    "github.com/cvega/gh-migrate-packages/pkg/convert"
+    "github.com/cvega/gh-migrate-packages/pkg/csvfile"
+    "github.com/cvega/gh-migrate-packages/pkg/extension"
+    "github.com/cvega/gh-migrate-packages/pkg/filter"
+    "github.com/cvega/gh-migrate-packages/pkg/run"
+    "github.com/cvega/gh-migrate-packages/pkg/snapshot"
 )
 
+// checkpointFile is kept next to the downloads it describes
+const checkpointFile = "export-state.jsonl"
+
 type ExportOptions struct {
     DownloadPath string
     FilePrefix   string
     Organization string
     PackageType  string
+    Formats      map[string]bool
 }
 
 type ExportResult struct {
     PackagesExported   int
+    PackagesEmpty      int
+    PackagesOrphaned   int
     VersionsExported   int
     DownloadsComplete  int
     DownloadsFailed    int
@@ -30,6 +43,8 @@ type ExportResult struct {
 }
 
 func CreateCSVs() (*ExportResult, error) {
+    pterm.Info.Printf("Export run %s\n", run.ID())
+
     opt := ExportOptions{
         DownloadPath: viper.GetString("DOWNLOAD_PATH"),
         FilePrefix:   viper.GetString("OUTPUT_FILE"),
@@ -45,11 +60,63 @@ func CreateCSVs() (*ExportResult, error) {
         opt.FilePrefix = opt.Organization
     }
 
-    // Initialize API client
-    apiClient := api.NewAPI(
-        viper.GetString("SOURCE_TOKEN"),
-        viper.GetString("SOURCE_HOSTNAME"),
-    )
+    formats, err := ParseFormats(viper.GetString("EXPORT_FORMAT"))
+    if err != nil {
+        return nil, err
+    }
+    opt.Formats = formats
+    if formats[FormatSQLite] {
+        // Found missing before the listing is fetched, not after
+        if err := convert.RequireSQLite3(); err != nil {
+            return nil, err
+        }
+    }
+    archivePath := viper.GetString("EXPORT_ARCHIVE")
+    if archivePath != "" {
+        compression, err := ArchiveCompression(archivePath)
+        if err != nil {
+            return nil, err
+        }
+        if compression == compressZstd {
+            if err := requireZstd(); err != nil {
+                return nil, err
+            }
+        }
+    }
+
+    // Register external handlers for custom package types
+    if err := extension.RegisterSpecs(viper.GetString("HANDLERS")); err != nil {
+        return nil, fmt.Errorf("failed to register package handlers: %v", err)
+    }
+
+    // Every organization in this inventory, the one given by --organization first
+    sources := []Source{{
+        Hostname:     viper.GetString("SOURCE_HOSTNAME"),
+        Organization: opt.Organization,
+        Token:        viper.GetString("SOURCE_TOKEN"),
+    }}
+    merged, err := ParseSources(viper.GetString("MERGE_SOURCES"), sources[0].Token)
+    if err != nil {
+        return nil, err
+    }
+    sources = append(sources, merged...)
+    merging := len(sources) > 1
+
+    // Configure registries for package types not hosted by GitHub
+    registries, err := api.ParseRegistries(viper.GetString("SOURCE_REGISTRY_URLS"))
+    if err != nil {
+        return nil, fmt.Errorf("invalid source registry url: %v", err)
+    }
+    registryTokens, err := api.ParseRegistryTokens(viper.GetString("SOURCE_REGISTRY_TOKENS"))
+    if err != nil {
+        return nil, fmt.Errorf("invalid source registry token: %v", err)
+    }
+
+    // Select which versions are exported
+    versionFilter, err := filter.FromConfig(opt.PackageType)
+    if err != nil {
+        return nil, fmt.Errorf("invalid version filter: %v", err)
+    }
 
     // Create results struct
     result := &ExportResult{}
@@ -59,26 +126,156 @@ func CreateCSVs() (*ExportResult, error) {
         return nil, fmt.Errorf("failed to create download directory: %v", err)
     }
 
-    // Initialize progress tracking
-    packagesSpinner, _ := pterm.DefaultSpinner.Start("Fetching packages...")
+    // Fetch packages from each source, remembering where each one came from
+    clients := make([]*api.API, len(sources))
+    var packages []api.Package
+    var origins []Source
+    var excludedFiles []filter.ExcludedFile
+    var emptyPackages []api.Package
+    var orphanedPackages []api.Package
+    empty := make(map[string]bool)
+    excludeOrphaned := viper.GetBool("EXCLUDE_ORPHANED")
+
+    // The plan's version list, replayed by sync --snapshot
+    var snap *snapshot.Snapshot
+    if viper.GetString("SNAPSHOT") != "" {
+        snap = snapshot.New()
+    }
+    for i, source := range sources {
+        // Initialize API client
+        clients[i] = api.NewAPI(source.Token, source.Hostname)
+        clients[i].SetRegistries(registries)
+        clients[i].SetRegistryTokens(registryTokens)
+        if i == 0 {
+            // Extra tokens only rotate with the --token they were given for
+            clients[i].SetTokens(strings.Split(viper.GetString("SOURCE_TOKENS"), ","))
+        }
 
-    // Fetch packages
-    packages, err := apiClient.GetOrganizationPackages(opt.Organization, opt.PackageType)
-    if err != nil {
-        packagesSpinner.Fail(err.Error())
-        return nil, err
+        // Bring back versions deleted shortly before the export
+        if viper.GetBool("RESTORE_DELETED") {
+            restored, err := clients[i].RestoreDeletedVersions(source.Organization, opt.PackageType)
+            if err != nil {
+                pterm.Warning.Printf("Some deleted versions in %s weren't restored and won't be exported: %v\n", source, err)
+            }
+            if len(restored) > 0 {
+                pterm.Info.Printf("Restored %d recently deleted versions in %s\n", len(restored), source)
+            }
+        }
+
+        packagesSpinner, _ := pterm.DefaultSpinner.Start(fmt.Sprintf("Fetching packages from %s...", source))
+        found, err := clients[i].GetOrganizationPackages(source.Organization, opt.PackageType)
+        if err != nil {
+            packagesSpinner.Fail(err.Error())
+            return nil, err
+        }
+
+        packagesSpinner.Success(fmt.Sprintf("Found %d packages in %s", len(found), source))
+
+        // Everything listed, filters are applied again by sync
+        if snap != nil {
+            snap.Add(source.Organization, found)
+        }
+
+        // Packages without a repository are reported whether exported or not
+        found, orphaned := selectOrphaned(found, excludeOrphaned, viper.GetBool("ONLY_ORPHANED"))
+        orphanedPackages = append(orphanedPackages, orphaned...)
+
+        // Classify before filtering, a filter may leave no versions behind too
+        for _, pkg := range found {
+            if pkg.IsEmpty() {
+                empty[pkg.ID] = true
+                emptyPackages = append(emptyPackages, pkg)
+            }
+        }
+
+        found, excluded, err := filterVersions(found, versionFilter)
+        if err != nil {
+            return nil, err
+        }
+        excludedFiles = append(excludedFiles, excluded...)
+        for range found {
+            origins = append(origins, source)
+        }
+        packages = append(packages, found...)
+    }
+
+    if merging {
+        warnMergeDuplicates(packages, origins)
     }
 
-    packagesSpinner.Success(fmt.Sprintf("Found %d packages", len(packages)))
+    // Origin columns are only added to a merged inventory
+    var csvOrigins []Source
+    if merging {
+        csvOrigins = origins
+    }
+
+    // Listing files, in the order they're archived
+    var listing []string
 
     // Create CSV files
-    if err := createPackagesCSV(opt.FilePrefix, packages); err != nil {
-        return nil, fmt.Errorf("failed to create packages CSV: %v", err)
+    if opt.Formats[FormatCSV] {
+        if err := createPackagesCSV(opt.FilePrefix, packages, csvOrigins, empty); err != nil {
+            return nil, fmt.Errorf("failed to create packages CSV: %v", err)
+        }
+        if err := createVersionsCSV(opt.FilePrefix, packages, csvOrigins); err != nil {
+            return nil, fmt.Errorf("failed to create versions CSV: %v", err)
+        }
+        listing = append(listing, fmt.Sprintf("%s_packages.csv", opt.FilePrefix), fmt.Sprintf("%s_versions.csv", opt.FilePrefix))
+    }
+
+    // The same listing as one document, with every version's files
+    if opt.Formats[FormatJSON] || opt.Formats[FormatSQLite] {
+        doc := newDocument(sources, packages, csvOrigins, empty)
+        if opt.Formats[FormatJSON] {
+            filename, err := createDocument(opt.FilePrefix, doc)
+            if err != nil {
+                return nil, fmt.Errorf("failed to create JSON export: %v", err)
+            }
+            pterm.Info.Printf("Packages, versions, and files written to %s\n", filename)
+            listing = append(listing, filename)
+        }
+        if opt.Formats[FormatSQLite] {
+            filename, err := createDatabase(opt.FilePrefix, doc)
+            if err != nil {
+                return nil, fmt.Errorf("failed to create SQLite export: %v", err)
+            }
+            pterm.Info.Printf("Packages, versions, and files tables written to %s\n", filename)
+            listing = append(listing, filename)
+        }
+    }
+    result.PackagesExported = len(packages) - len(emptyPackages)
+    result.PackagesEmpty = len(emptyPackages)
+    result.PackagesOrphaned = len(orphanedPackages)
+
+    if snap != nil {
+        if err := snap.Save(viper.GetString("SNAPSHOT")); err != nil {
+            return nil, err
+        }
+        pterm.Info.Printf("Version snapshot written to %s, pass it to sync --snapshot to migrate exactly this plan\n", viper.GetString("SNAPSHOT"))
+        listing = append(listing, viper.GetString("SNAPSHOT"))
+    }
+
+    if len(excludedFiles) > 0 {
+        report := run.ReportPath(viper.GetString("EXCLUDED_FILES_REPORT"))
+        if err := filter.WriteExcludedFiles(report, excludedFiles); err != nil {
+            return nil, err
+        }
+        pterm.Info.Printf("%d files left out by --file-filter, see %s\n", len(excludedFiles), report)
     }
-    result.PackagesExported = len(packages)
 
-    if err := createVersionsCSV(opt.FilePrefix, packages); err != nil {
-        return nil, fmt.Errorf("failed to create versions CSV: %v", err)
+    // Publishers can't be carried over, so record who they were
+    if report := run.ReportPath(viper.GetString("PUBLISHER_REPORT")); report != "" {
+        publishers := make(map[Source]map[string]api.Publisher)
+        for i, source := range sources {
+            found, err := clients[i].GetPackagePublishers(source.Organization)
+            if err != nil {
+                pterm.Warning.Printf("Publisher attribution unavailable for %s, listing its versions without publishers: %v\n", source, err)
+            }
+            publishers[source] = found
+        }
+        if err := createPublishersCSV(report, packages, origins, publishers); err != nil {
+            return nil, fmt.Errorf("failed to create publisher report: %v", err)
+        }
     }
 
     // Count total versions
@@ -88,18 +285,99 @@ func CreateCSVs() (*ExportResult, error) {
     }
     result.VersionsExported = totalVersions
 
-    // Download packages if path is specified
-    if opt.DownloadPath != "" {
-        downloadResults := downloadPackages(apiClient, packages, opt.DownloadPath)
-        result.DownloadsComplete = downloadResults.complete
-        result.DownloadsFailed = downloadResults.failed
-        result.TotalSizeDownloaded = downloadResults.totalSize
+    var deadline time.Time
+    if limit := viper.GetDuration("TIME_LIMIT"); limit > 0 {
+        deadline = time.Now().Add(limit)
+    }
+
+    // Outcomes are collected in one place and reported while the export runs
+    report := run.ReportPath(viper.GetString("DOWNLOAD_REPORT"))
+    downloads := newCollector(report, viper.GetDuration("REPORT_INTERVAL"))
+    defer downloads.close() // an export failing part way still reports its downloads
+
+    for i, source := range sources {
+        // Merged sources download side by side instead of on top of each other
+        downloadPath := opt.DownloadPath
+        if merging {
+            downloadPath = filepath.Join(opt.DownloadPath, source.Host(), source.Organization)
+            if err := os.MkdirAll(downloadPath, 0755); err != nil {
+                return nil, fmt.Errorf("failed to create download directory: %v", err)
+            }
+        }
+
+        // Keep the conda channel metadata alongside the downloaded builds
+        if opt.PackageType == "conda" {
+            if err := clients[i].DownloadCondaRepodata(filepath.Join(downloadPath, "conda", "repodata")); err != nil {
+                return nil, fmt.Errorf("failed to export conda repodata: %v", err)
+            }
+        }
+
+        // Versions finished by earlier runs are skipped, so a large org can
+        // be exported over several invocations
+        state, err := checkpoint.Open(filepath.Join(downloadPath, checkpointFile))
+        if err != nil {
+            return nil, err
+        }
+
+        var sourcePackages []api.Package
+        for j, pkg := range packages {
+            if origins[j] == source {
+                sourcePackages = append(sourcePackages, pkg)
+            }
+        }
+
+        downloadPackages(clients[i], source, sourcePackages, downloadPath, state, deadline, downloads)
+        state.Close()
+    }
+
+    downloadResults := downloads.close()
+    result.DownloadsComplete = downloadResults.complete
+    result.DownloadsFailed = downloadResults.failed
+    result.TotalSizeDownloaded = downloadResults.totalSize
+    pterm.Info.Printf("Downloaded %d versions (%s), %d failed\n", downloadResults.complete, filter.FormatSize(downloadResults.totalSize), downloadResults.failed)
+    if downloadResults.mismatched > 0 {
+        pterm.Warning.Printf("%d files didn't match their listed SHA-256 after %d attempts and were removed, see the Checksum column of the download report\n", downloadResults.mismatched, downloadAttempts)
+    }
+    if report != "" {
+        pterm.Info.Printf("Download results written to %s\n", report)
+    }
+
+    reportEmptyPackages(emptyPackages)
+    reportOrphanedPackages(orphanedPackages, excludeOrphaned)
+
+    if downloadResults.remaining > 0 {
+        pterm.Info.Printf("Time limit reached with %d versions left, run export again to continue\n", downloadResults.remaining)
+    }
+
+    // Everything the export wrote, in one file to carry to another network
+    if archivePath != "" {
+        manifest := &ArchiveManifest{
+            Downloads: ArchiveDownloads{
+                Complete:  downloadResults.complete,
+                Failed:    downloadResults.failed,
+                Remaining: downloadResults.remaining,
+            },
+        }
+        for _, source := range sources {
+            manifest.Organizations = append(manifest.Organizations, DocumentSource{Hostname: source.Host(), Organization: source.Organization})
+        }
+        spinner, _ := pterm.DefaultSpinner.Start(fmt.Sprintf("Archiving the export to %s...", archivePath))
+        if err := createArchive(archivePath, listing, opt.DownloadPath, manifest); err != nil {
+            spinner.Fail(err.Error())
+            return nil, fmt.Errorf("failed to create export archive: %v", err)
+        }
+        spinner.Success(fmt.Sprintf("Archived %d files to %s", len(manifest.Files), archivePath))
+        if downloadResults.failed > 0 || downloadResults.remaining > 0 {
+            pterm.Warning.Printf("The archive is incomplete: %d versions failed to download and %d weren't started; run export again for a complete one\n", downloadResults.failed, downloadResults.remaining)
+        }
     }
 
     return result, nil
 }
 
-func createPackagesCSV(prefix string, packages []api.Package) error {
+// createPackagesCSV writes one row per package, marking those in empty as
+// having no versions left in the source
+func createPackagesCSV(prefix string, packages []api.Package, origins []Source, empty map[string]bool) error {
     filename := fmt.Sprintf("%s_packages.csv", prefix)
     file, err := os.Create(filename)
     if err != nil {
@@ -107,20 +385,27 @@ func createPackagesCSV(prefix string, packages []api.Package) error {
     }
     defer file.Close()
 
-    writer := csv.NewWriter(file)
+    writer := csvfile.NewWriter(file)
     defer writer.Flush()
 
     // Write header
     header := []string{
         "ID", "Name", "Type", "Repository", "Repository URL",
-        "Downloads Count", "Version Count",
+        "Downloads Count", "Version Count", "Visibility", "Owner", "Owner Type", "Status",
+    }
+    if origins != nil {
+        header = append(header, originHeader...)
     }
     if err := writer.Write(header); err != nil {
         return err
     }
 
     // Write package data
-    for _, pkg := range packages {
+    for i, pkg := range packages {
+        status := api.PackageStatusActive
+        if empty[pkg.ID] {
+            status = api.PackageStatusEmpty
+        }
         row := []string{
             pkg.ID,
             pkg.Name,
@@ -129,6 +414,13 @@ func createPackagesCSV(prefix string, packages []api.Package) error {
             pkg.Repository.URL,
             strconv.Itoa(pkg.Statistics.DownloadsCount),
             strconv.Itoa(len(pkg.Versions)),
+            pkg.Visibility,
+            pkg.Owner.Login,
+            pkg.Owner.Type,
+            status,
+        }
+        if origins != nil {
+            row = append(row, origins[i].columns()...)
         }
         if err := writer.Write(row); err != nil {
             return err
@@ -138,7 +430,7 @@ func createPackagesCSV(prefix string, packages []api.Package) error {
     return nil
 }
 
-func createVersionsCSV(prefix string, packages []api.Package) error {
+func createVersionsCSV(prefix string, packages []api.Package, origins []Source) error {
     filename := fmt.Sprintf("%s_versions.csv", prefix)
     file, err := os.Create(filename)
     if err != nil {
@@ -146,7 +438,7 @@ func createVersionsCSV(prefix string, packages []api.Package) error {
     }
     defer file.Close()
 
-    writer := csv.NewWriter(file)
+    writer := csvfile.NewWriter(file)
     defer writer.Flush()
 
     // Write header
@@ -154,12 +446,15 @@ func createVersionsCSV(prefix string, packages []api.Package) error {
         "Package ID", "Package Name", "Version ID", "Version",
         "Created At", "Updated At", "File Count", "Total Size",
     }
+    if origins != nil {
+        header = append(header, originHeader...)
+    }
     if err := writer.Write(header); err != nil {
         return err
     }
 
     // Write version data
-    for _, pkg := range packages {
+    for i, pkg := range packages {
         for _, ver := range pkg.Versions {
             var totalSize int
             for _, file := range ver.Files {
@@ -176,6 +471,100 @@ func createVersionsCSV(prefix string, packages []api.Package) error {
                 strconv.Itoa(len(ver.Files)),
                 strconv.Itoa(totalSize),
             }
+            if origins != nil {
+                row = append(row, origins[i].columns()...)
+            }
+            if err := writer.Write(row); err != nil {
+                return err
+            }
+        }
+    }
+
+    return nil
+}
+
+// filterVersions drops the versions, and files within them, the filters
+// leave out, returning the files dropped from the remaining versions
+func filterVersions(packages []api.Package, versionFilter *filter.Filter) ([]api.Package, []filter.ExcludedFile, error) {
+    var excluded []filter.ExcludedFile
+    for i := range packages {
+        var versions []api.Version
+        for _, version := range packages[i].Versions {
+            allowed, err := versionFilter.Allows(packages[i].PackageType, version.Name)
+            if err != nil {
+                return nil, nil, err
+            }
+            if !allowed {
+                continue
+            }
+
+            var files []api.File
+            var dropped []filter.ExcludedFile
+            for _, file := range version.Files {
+                if versionFilter.AllowsFile(file.Name) {
+                    files = append(files, file)
+                    continue
+                }
+                dropped = append(dropped, filter.ExcludedFile{
+                    PackageName: packages[i].Name,
+                    PackageType: packages[i].PackageType,
+                    Version:     version.Name,
+                    File:        file.Name,
+                    Size:        int64(file.Size),
+                })
+            }
+            version.Files = files
+
+            var size int64
+            for _, file := range version.Files {
+                size += int64(file.Size)
+            }
+            if versionFilter.AllowsSize(size) {
+                versions = append(versions, version)
+                excluded = append(excluded, dropped...)
+            }
+        }
+        packages[i].Versions = versions
+    }
+    return packages, excluded, nil
+}
+
+func createPublishersCSV(filename string, packages []api.Package, origins []Source, publishers map[Source]map[string]api.Publisher) error {
+    file, err := os.Create(filename)
+    if err != nil {
+        return err
+    }
+    defer file.Close()
+
+    writer := csvfile.NewWriter(file)
+    defer writer.Flush()
+
+    // Write header
+    header := []string{
+        "Package Name", "Type", "Version", "Publisher", "Published At", "Source",
+    }
+    merged := len(publishers) > 1
+    if merged {
+        header = append(header, originHeader...)
+    }
+    if err := writer.Write(header); err != nil {
+        return err
+    }
+
+    // Write one row per version, marking those the audit log doesn't cover
+    for i, pkg := range packages {
+        for _, ver := range pkg.Versions {
+            row := []string{pkg.Name, pkg.PackageType, ver.Name, "", ver.CreatedAt, "unknown"}
+            if publisher, ok := publishers[origins[i]][api.PublisherKey(pkg.Name, ver.Name)]; ok {
+                row[3] = publisher.Login
+                if publisher.PublishedAt != "" {
+                    row[4] = publisher.PublishedAt
+                }
+                row[5] = "audit-log"
+            }
+            if merged {
+                row = append(row, origins[i].columns()...)
+            }
             if err := writer.Write(row); err != nil {
                 return err
             }
@@ -186,16 +575,21 @@ func createVersionsCSV(prefix string, packages []api.Package) error {
 }
 
 type downloadResult struct {
-    complete  int
-    failed    int
-    totalSize int64
+    complete   int
+    failed     int
+    skipped    int // versions completed by an earlier run
+    remaining  int // versions not started before the deadline
+    mismatched int // files whose SHA-256 never matched
+    totalSize  int64
 }
 
-func downloadPackages(client *api.API, packages []api.Package, downloadPath string) downloadResult {
-    result := downloadResult{}
+// downloadPackages downloads every version not yet in the checkpoint,
+// starting no new version once deadline (if set) has passed. Each version's
+// outcome goes to downloads, the only place results are tallied
+func downloadPackages(client *api.API, source Source, packages []api.Package, downloadPath string, state *checkpoint.Checkpoint, deadline time.Time, downloads *collector) {
     var wg sync.WaitGroup
     semaphore := make(chan struct{}, 5) // Limit concurrent downloads
-    
+
     // Create progress bar
     progressbar, _ := pterm.DefaultProgressbar.
         WithTotal(getTotalVersions(packages)).
@@ -211,17 +605,40 @@ func downloadPackages(client *api.API, packages []api.Package, downloadPath stri
         }
 
         for _, version := range pkg.Versions {
+            outcome := versionOutcome{
+                Source:      source.String(),
+                PackageType: pkg.PackageType,
+                PackageName: pkg.Name,
+                Version:     version.Name,
+            }
+
+            if state.Done(pkg.PackageType, pkg.Name, version.ID) {
+                outcome.Status = downloadSkipped
+                downloads.add(outcome)
+                progressbar.Increment()
+                continue
+            }
+
+            if !deadline.IsZero() && time.Now().After(deadline) {
+                outcome.Status = downloadRemaining
+                downloads.add(outcome)
+                progressbar.Increment()
+                continue
+            }
+
             wg.Add(1)
             semaphore <- struct{}{} // Acquire semaphore
 
-            go func(p api.Package, v api.Version, dir string) {
+            go func(p api.Package, v api.Version, dir string, outcome versionOutcome) {
                 defer wg.Done()
                 defer func() { <-semaphore }() // Release semaphore
+                defer progressbar.Increment()
 
                 versionDir := filepath.Join(dir, v.Name)
                 if err := os.MkdirAll(versionDir, 0755); err != nil {
                     pterm.Error.Printf("Failed to create directory for version %s: %v\n", v.Name, err)
-                    result.failed++
+                    outcome.Status, outcome.Failed, outcome.Error = downloadFailed, 1, err.Error()
+                    downloads.add(outcome)
                     return
                 }
 
@@ -232,33 +649,79 @@ func downloadPackages(client *api.API, packages []api.Package, downloadPath stri
                 }
 
                 // Download each file
+                var errors []string
+                var size int64
+                var sums checksums
                 for _, file := range v.Files {
+                    size += int64(file.Size)
+
+                    // File names come from the registry, never write outside the version
+                    if !filepath.IsLocal(file.Name) {
+                        pterm.Error.Printf("Refusing to download %s outside %s\n", file.Name, versionDir)
+                        outcome.Failed++
+                        errors = append(errors, fmt.Sprintf("%s: outside the version directory", file.Name))
+                        continue
+                    }
                     filePath := filepath.Join(versionDir, file.Name)
-                    
-                    // Skip if file already exists with correct size
-                    if fileExists(filePath, file.Size) {
-                        progressbar.Increment()
+
+                    // Skip if file already exists with correct size and digest
+                    if fileVerified(filePath, file) {
+                        sums.add(file)
+                        continue
+                    }
+
+                    // File names may carry a layout prefix such as a conda subdir
+                    if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+                        pterm.Error.Printf("Failed to create directory for %s: %v\n", file.Name, err)
+                        outcome.Failed++
+                        errors = append(errors, err.Error())
                         continue
                     }
 
-                    if err := downloadFile(client, file.URL, filePath); err != nil {
+                    if err := downloadVerified(client, p.PackageType, file, filePath); err != nil {
                         pterm.Error.Printf("Failed to download %s: %v\n", file.Name, err)
-                        result.failed++
-                    } else {
-                        result.complete++
-                        result.totalSize += int64(file.Size)
+                        if _, ok := err.(*api.ChecksumError); ok {
+                            sums.mismatched++
+                        }
+                        outcome.Failed++
+                        errors = append(errors, fmt.Sprintf("%s: %v", file.Name, err))
+                        continue
                     }
+                    sums.add(file)
+                    outcome.Files++
+                    outcome.Size += int64(file.Size)
                 }
 
-                progressbar.Increment()
-            }(pkg, version, pkgDir)
+                outcome.Checksum = sums.status()
+                outcome.Mismatched = sums.mismatched
+                outcome.Status = downloadComplete
+                if outcome.Failed > 0 {
+                    outcome.Status = downloadFailed
+                    outcome.Error = strings.Join(errors, "; ")
+                }
+                downloads.add(outcome)
+
+                // Only a version with every file on disk is checkpointed
+                if outcome.Failed == 0 {
+                    err := state.MarkDone(checkpoint.Entry{
+                        PackageType: p.PackageType,
+                        PackageName: p.Name,
+                        VersionID:   v.ID,
+                        Version:     v.Name,
+                        Files:       len(v.Files),
+                        Size:        size,
+                        CompletedAt: time.Now().UTC(),
+                    })
+                    if err != nil {
+                        pterm.Error.Printf("Failed to checkpoint version %s: %v\n", v.Name, err)
+                    }
+                }
+            }(pkg, version, pkgDir, outcome)
         }
     }
 
     wg.Wait()
     progressbar.Stop()
-
-    return result
 }
 
 func getTotalVersions(packages []api.Package) int {
@@ -277,6 +740,11 @@ func createMetadataFile(path string, pkg api.Package, version api.Version) error
             "type":        pkg.PackageType,
             "repository":  pkg.Repository,
             "statistics": pkg.Statistics,
+            "visibility":  pkg.Visibility,
+            "owner": map[string]interface{}{
+                "login": pkg.Owner.Login,
+                "type":  pkg.Owner.Type,
+            },
         },
         "version": map[string]interface{}{
             "id":         version.ID,
@@ -284,6 +752,7 @@ func createMetadataFile(path string, pkg api.Package, version api.Version) error
             "created_at": version.CreatedAt,
             "updated_at": version.UpdatedAt,
             "files":      version.Files,
+            "metadata":   version.Metadata,
         },
         "exported_at": time.Now().UTC(),
     }
@@ -306,9 +775,3 @@ func fileExists(path string, expectedSize int) bool {
     }
     return info.Size() == int64(expectedSize)
 }
-
-func downloadFile(client *api.API, url, path string) error {
-    // Implementation to be added in API client
-    // This should handle the actual file download using the client
-    return client.DownloadFile(url, path)
-}
@@ -0,0 +1,53 @@
+package export
+
+import (
+    "strconv"
+
+    "github.com/cvega/gh-migrate-packages/pkg/api"
+    "github.com/pterm/pterm"
+)
+
+// selectOrphaned applies --exclude-orphaned and --only-orphaned to the
+// listed packages, returning those kept and every orphaned package found
+func selectOrphaned(packages []api.Package, exclude, only bool) ([]api.Package, []api.Package) {
+    var kept, orphaned []api.Package
+    for _, pkg := range packages {
+        if !pkg.IsOrphaned() {
+            if !only {
+                kept = append(kept, pkg)
+            }
+            continue
+        }
+        orphaned = append(orphaned, pkg)
+        if !exclude {
+            kept = append(kept, pkg)
+        }
+    }
+    return kept, orphaned
+}
+
+// reportOrphanedPackages lists the packages without a linked repository,
+// which need an owner decided before they're worth migrating
+func reportOrphanedPackages(orphaned []api.Package, excluded bool) {
+    if len(orphaned) == 0 {
+        return
+    }
+
+    pterm.DefaultSection.Println("Orphaned packages")
+    table := pterm.TableData{
+        {"Package", "Type", "Visibility", "Owner", "Downloads", "Versions"},
+    }
+    for _, pkg := range orphaned {
+        downloads := 0
+        if pkg.Statistics != nil {
+            downloads = pkg.Statistics.DownloadsCount
+        }
+        table = append(table, []string{pkg.Name, pkg.PackageType, pkg.Visibility, pkg.Owner.Login, strconv.Itoa(downloads), strconv.Itoa(len(pkg.Versions))})
+    }
+    pterm.DefaultTable.WithHasHeader().WithData(table).Render()
+    if excluded {
+        pterm.Info.Printf("%d packages have no linked repository and were left out by --exclude-orphaned\n", len(orphaned))
+        return
+    }
+    pterm.Info.Printf("%d packages have no linked repository, decide who owns them before migrating\n", len(orphaned))
+}
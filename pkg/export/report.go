@@ -0,0 +1,165 @@
+package export
+
+import (
+    "os"
+    "path/filepath"
+    "strconv"
+    "sync"
+    "time"
+
+    "github.com/cvega/gh-migrate-packages/pkg/csvfile"
+    "github.com/pterm/pterm"
+)
+
+// Download statuses of a version in the download report
+const (
+    downloadComplete  = "complete"
+    downloadFailed    = "failed"
+    downloadSkipped   = "skipped"   // finished by an earlier run
+    downloadRemaining = "remaining" // not started before the time limit
+)
+
+// versionOutcome is what a download worker reports for one version
+type versionOutcome struct {
+    Source      string
+    PackageType string
+    PackageName string
+    Version     string
+    Status      string
+    Files       int    // files downloaded by this run
+    Failed      int    // files that failed to download
+    Size        int64  // bytes downloaded by this run
+    Checksum    string // how the files compared with their listed SHA-256
+    Mismatched  int    // files whose SHA-256 never matched
+    Error       string
+}
+
+// collector owns the download results. Workers send their outcomes over a
+// channel and only the collector's goroutine touches the counters and rows,
+// writing them to a partial report every interval so an interrupted or
+// crashed export still leaves a record of what it did
+type collector struct {
+    outcomes chan versionOutcome
+    done     chan struct{}
+    closing  sync.Once
+    result   downloadResult
+    rows     []versionOutcome
+    report   string
+    interval time.Duration
+}
+
+// newCollector starts collecting; report may be empty to keep no report
+// and interval zero to only write it at the end
+func newCollector(report string, interval time.Duration) *collector {
+    c := &collector{
+        outcomes: make(chan versionOutcome, 64),
+        done:     make(chan struct{}),
+        report:   report,
+        interval: interval,
+    }
+    go c.run()
+    return c
+}
+
+func (c *collector) run() {
+    defer close(c.done)
+
+    var tick <-chan time.Time
+    if c.report != "" && c.interval > 0 {
+        ticker := time.NewTicker(c.interval)
+        defer ticker.Stop()
+        tick = ticker.C
+    }
+
+    for {
+        select {
+        case o, ok := <-c.outcomes:
+            if !ok {
+                c.flush()
+                return
+            }
+            c.record(o)
+        case <-tick:
+            c.flush()
+        }
+    }
+}
+
+func (c *collector) record(o versionOutcome) {
+    switch o.Status {
+    case downloadSkipped:
+        c.result.skipped++
+    case downloadRemaining:
+        c.result.remaining++
+    }
+    c.result.complete += o.Files
+    c.result.failed += o.Failed
+    c.result.totalSize += o.Size
+    c.result.mismatched += o.Mismatched
+    if c.report != "" {
+        c.rows = append(c.rows, o)
+    }
+}
+
+// flush rewrites the report with every outcome so far
+func (c *collector) flush() {
+    if c.report == "" {
+        return
+    }
+    if err := writeDownloadReport(c.report, c.rows); err != nil {
+        pterm.Warning.Printf("Failed to write download report: %v\n", err)
+    }
+}
+
+// add hands a worker's outcome to the collector
+func (c *collector) add(o versionOutcome) {
+    c.outcomes <- o
+}
+
+// close waits for every outcome to be recorded, writes the final report,
+// and returns the totals. Closing again returns the same totals
+func (c *collector) close() downloadResult {
+    c.closing.Do(func() { close(c.outcomes) })
+    <-c.done
+    return c.result
+}
+
+// writeDownloadReport replaces filename atomically, so a crash mid-write
+// leaves the previous report intact
+func writeDownloadReport(filename string, rows []versionOutcome) error {
+    tmp, err := os.CreateTemp(filepath.Dir(filename), filepath.Base(filename)+".*")
+    if err != nil {
+        return err
+    }
+    defer os.Remove(tmp.Name())
+
+    writer := csvfile.NewWriter(tmp)
+    header := []string{"Source", "Type", "Package", "Version", "Status", "Files", "Failed Files", "Size", "Checksum", "Error"}
+    if err := writer.Write(header); err != nil {
+        tmp.Close()
+        return err
+    }
+    for _, o := range rows {
+        row := []string{
+            o.Source, o.PackageType, o.PackageName, o.Version, o.Status,
+            strconv.Itoa(o.Files), strconv.Itoa(o.Failed), strconv.FormatInt(o.Size, 10), o.Checksum, o.Error,
+        }
+        if err := writer.Write(row); err != nil {
+            tmp.Close()
+            return err
+        }
+    }
+    writer.Flush()
+    if err := writer.Error(); err != nil {
+        tmp.Close()
+        return err
+    }
+    if err := tmp.Chmod(0644); err != nil {
+        tmp.Close()
+        return err
+    }
+    if err := tmp.Close(); err != nil {
+        return err
+    }
+    return os.Rename(tmp.Name(), filename)
+}
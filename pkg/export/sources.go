@@ -0,0 +1,96 @@
+package export
+
+import (
+    "fmt"
+    "strings"
+
+    "github.com/cvega/gh-migrate-packages/pkg/api"
+    "github.com/pterm/pterm"
+)
+
+// Source is an organization exported into the inventory
+type Source struct {
+    Hostname     string // empty for github.com
+    Organization string
+    Token        string
+}
+
+// Columns added to every CSV of a merged inventory
+var originHeader = []string{"Source Hostname", "Source Organization"}
+
+// Host returns the source's hostname, github.com when none was given
+func (s Source) Host() string {
+    host := strings.TrimPrefix(strings.TrimPrefix(s.Hostname, "https://"), "http://")
+    host = strings.TrimSuffix(host, "/")
+    if host == "" {
+        return "github.com"
+    }
+    return host
+}
+
+func (s Source) String() string {
+    return s.Host() + "/" + s.Organization
+}
+
+func (s Source) columns() []string {
+    return []string{s.Host(), s.Organization}
+}
+
+// ParseSources parses ;-separated [HOSTNAME/]ORG[=TOKEN] entries naming the
+// organizations merged into one inventory; entries without a token use
+// defaultToken
+func ParseSources(specs, defaultToken string) ([]Source, error) {
+    var sources []Source
+    if specs == "" {
+        return sources, nil
+    }
+
+    for _, spec := range strings.Split(specs, ";") {
+        spec = strings.TrimSpace(spec)
+        if spec == "" {
+            continue
+        }
+
+        source := Source{Token: defaultToken}
+        if name, token, ok := strings.Cut(spec, "="); ok {
+            spec, source.Token = name, token
+        }
+
+        spec = strings.TrimSuffix(strings.TrimPrefix(strings.TrimPrefix(spec, "https://"), "http://"), "/")
+        if i := strings.LastIndex(spec, "/"); i >= 0 {
+            source.Hostname, source.Organization = spec[:i], spec[i+1:]
+        } else {
+            source.Organization = spec
+        }
+        if source.Hostname == "github.com" {
+            source.Hostname = ""
+        }
+
+        if source.Organization == "" || source.Token == "" {
+            return nil, fmt.Errorf("invalid merge source %q, expected [HOSTNAME/]ORG[=TOKEN]", spec)
+        }
+        sources = append(sources, source)
+    }
+
+    return sources, nil
+}
+
+// warnMergeDuplicates lists packages that exist under the same type and
+// name in more than one source, which would collide in the consolidated org
+func warnMergeDuplicates(packages []api.Package, origins []Source) {
+    seen := make(map[string][]string)
+    var order []string
+    for i, pkg := range packages {
+        key := pkg.PackageType + "/" + pkg.Name
+        if _, exists := seen[key]; !exists {
+            order = append(order, key)
+        }
+        seen[key] = append(seen[key], origins[i].String())
+    }
+
+    for _, key := range order {
+        if len(seen[key]) > 1 {
+            pterm.Warning.Printf("Package %s exists in %s\n", key, strings.Join(seen[key], ", "))
+        }
+    }
+}
@@ -0,0 +1,148 @@
+package export
+
+import (
+    "encoding/json"
+    "fmt"
+    "io"
+    "os"
+    "time"
+
+    "github.com/cvega/gh-migrate-packages/pkg/convert"
+)
+
+// databaseSchema holds the SQLite export. Rows are keyed by their own
+// integer ids, since package IDs of merged organizations may collide;
+// versions and files point to the row they belong to
+const databaseSchema = `CREATE TABLE export (run_id TEXT NOT NULL, exported_at TEXT NOT NULL);
+CREATE TABLE packages (
+    id INTEGER PRIMARY KEY,
+    package_id TEXT NOT NULL,
+    name TEXT NOT NULL,
+    type TEXT NOT NULL,
+    status TEXT NOT NULL,
+    visibility TEXT,
+    owner TEXT,
+    owner_type TEXT,
+    repository TEXT,
+    repository_url TEXT,
+    downloads INTEGER NOT NULL,
+    version_count INTEGER NOT NULL,
+    source_hostname TEXT NOT NULL,
+    source_organization TEXT NOT NULL
+);
+CREATE TABLE versions (
+    id INTEGER PRIMARY KEY,
+    package INTEGER NOT NULL REFERENCES packages(id),
+    version_id TEXT NOT NULL,
+    name TEXT NOT NULL,
+    created_at TEXT,
+    updated_at TEXT,
+    file_count INTEGER NOT NULL,
+    size INTEGER NOT NULL,
+    metadata TEXT
+);
+CREATE TABLE files (
+    id INTEGER PRIMARY KEY,
+    version INTEGER NOT NULL REFERENCES versions(id),
+    name TEXT NOT NULL,
+    size INTEGER NOT NULL,
+    sha256 TEXT,
+    url TEXT
+);
+`
+
+// databaseIndexes are created once the rows are in, which is faster than
+// keeping them up to date row by row
+const databaseIndexes = `CREATE INDEX packages_type_name ON packages (type, name);
+CREATE INDEX packages_package_id ON packages (package_id);
+CREATE INDEX packages_repository ON packages (repository);
+CREATE INDEX versions_package ON versions (package);
+CREATE INDEX versions_name ON versions (name);
+CREATE INDEX versions_created_at ON versions (created_at);
+CREATE INDEX versions_size ON versions (size);
+CREATE INDEX files_version ON files (version);
+CREATE INDEX files_sha256 ON files (sha256);
+`
+
+// sqlNullable quotes value, or writes NULL for an empty one
+func sqlNullable(value string) string {
+    if value == "" {
+        return "NULL"
+    }
+    return convert.SQLQuote(value)
+}
+
+// writeDatabaseScript writes the SQL creating the database of doc to
+// script. Write errors are left to the caller's buffered writer
+func writeDatabaseScript(script io.Writer, doc *Document) error {
+    io.WriteString(script, "PRAGMA journal_mode = OFF;\nPRAGMA synchronous = OFF;\nBEGIN;\n")
+    io.WriteString(script, databaseSchema)
+    fmt.Fprintf(script, "INSERT INTO export VALUES (%s, %s);\n", convert.SQLQuote(doc.RunID), convert.SQLQuote(doc.ExportedAt.Format(time.RFC3339)))
+
+    // Packages of an unmerged export are all from its one organization
+    var source DocumentSource
+    if len(doc.Organizations) > 0 {
+        source = doc.Organizations[0]
+    }
+
+    versionID, fileID := 0, 0
+    for i, pkg := range doc.Packages {
+        packageID := i + 1
+        origin := source
+        if pkg.Source != nil {
+            origin = *pkg.Source
+        }
+        repository, repositoryURL := "", ""
+        if pkg.Repository != nil {
+            repository, repositoryURL = pkg.Repository.Name, pkg.Repository.URL
+        }
+        fmt.Fprintf(script, "INSERT INTO packages VALUES (%d, %s, %s, %s, %s, %s, %s, %s, %s, %s, %d, %d, %s, %s);\n",
+            packageID, convert.SQLQuote(pkg.ID), convert.SQLQuote(pkg.Name), convert.SQLQuote(pkg.Type), convert.SQLQuote(pkg.Status),
+            sqlNullable(pkg.Visibility), sqlNullable(pkg.Owner.Login), sqlNullable(pkg.Owner.Type),
+            sqlNullable(repository), sqlNullable(repositoryURL), pkg.Downloads, len(pkg.Versions),
+            convert.SQLQuote(origin.Hostname), convert.SQLQuote(origin.Organization))
+
+        for _, ver := range pkg.Versions {
+            versionID++
+            metadata := "NULL"
+            if len(ver.Metadata) > 0 {
+                data, err := json.Marshal(ver.Metadata)
+                if err != nil {
+                    return fmt.Errorf("failed to encode metadata of %s %s: %v", pkg.Name, ver.Name, err)
+                }
+                metadata = convert.SQLQuote(string(data))
+            }
+            fmt.Fprintf(script, "INSERT INTO versions VALUES (%d, %d, %s, %s, %s, %s, %d, %d, %s);\n",
+                versionID, packageID, convert.SQLQuote(ver.ID), convert.SQLQuote(ver.Name),
+                sqlNullable(ver.CreatedAt), sqlNullable(ver.UpdatedAt), len(ver.Files), ver.Size, metadata)
+
+            for _, file := range ver.Files {
+                fileID++
+                fmt.Fprintf(script, "INSERT INTO files VALUES (%d, %d, %s, %d, %s, %s);\n",
+                    fileID, versionID, convert.SQLQuote(file.Name), file.Size, sqlNullable(file.SHA256), sqlNullable(file.URL))
+            }
+        }
+    }
+
+    io.WriteString(script, databaseIndexes)
+    io.WriteString(script, "COMMIT;\n")
+    return nil
+}
+
+// createDatabase replaces PREFIX_export.db with a database of doc. The
+// statements are streamed to sqlite3 as they are written; a database left
+// by a failure is removed
+func createDatabase(prefix string, doc *Document) (string, error) {
+    filename := fmt.Sprintf("%s_export.db", prefix)
+    if err := os.Remove(filename); err != nil && !os.IsNotExist(err) {
+        return "", fmt.Errorf("failed to replace %s: %v", filename, err)
+    }
+    err := convert.SQLite3Stream(filename, func(script io.Writer) error {
+        return writeDatabaseScript(script, doc)
+    })
+    if err != nil {
+        os.Remove(filename)
+        return "", err
+    }
+    return filename, nil
+}
@@ -10,8 +10,12 @@ import (
     "os"
     "path/filepath"
     "strings"
+    "time"
 
+    "github.com/cvega/gh-migrate-packages/pkg/extension"
     "github.com/cvega/gh-migrate-packages/pkg/package"
+    "github.com/cvega/gh-migrate-packages/pkg/run"
+    "github.com/cvega/gh-migrate-packages/pkg/transform"
 )
 
 // UploadOptions contains parameters for package uploads
@@ -22,7 +26,13 @@ type UploadOptions struct {
     PackageType  string
     Metadata     map[string]interface{}
     Files        []string
-    Visibility   string // "public" or "private"
+    Visibility   string    // "public" or "private"
+    Repository   string    // target repository URL the package links to, defaults to one named after the package
+    Note         string    // migration note added to the package description, empty to leave it as published
+    NotePlacement string   // NoteAppend or NotePrepend
+    Uploaded     *[]string    // when set, receives the files as sent, after transforms and rewrites
+    Results      *FileResults // when set, receives the outcome of each file of multi-file uploads
+    Staging      string       // directory rewritten files are written to, a run staging directory removed after the upload when empty
 }
 
 // Upload error types for specific handling
@@ -59,6 +69,36 @@ func (a *API) UploadPackageVersion(opts UploadOptions) error {
         return fmt.Errorf("invalid package type: %v", err)
     }
 
+    if opts.Staging == "" {
+        staging, err := run.TempDir("upload")
+        if err != nil {
+            return fmt.Errorf("failed to create staging directory: %v", err)
+        }
+        defer run.RemoveTempDir(staging)
+        opts.Staging = staging
+    }
+
+    // Let transformation plugins rewrite the artifact before it is checked
+    if len(a.transformers) > 0 {
+        artifact := &transform.Artifact{
+            PackageType:  opts.PackageType,
+            PackageName:  opts.PackageName,
+            Version:      opts.Version,
+            Organization: opts.Organization,
+            Files:        opts.Files,
+            Metadata:     opts.Metadata,
+            Workdir:      opts.Staging,
+        }
+        if err := a.transformers.Apply(a.ctx, artifact); err != nil {
+            return fmt.Errorf("transform failed: %v", err)
+        }
+        opts.Files = artifact.Files
+        opts.Metadata = artifact.Metadata
+    }
+    if opts.Uploaded != nil {
+        *opts.Uploaded = append([]string(nil), opts.Files...)
+    }
+
     // Check file size limits
     maxSize := validator.GetMaxFileSize()
     for _, filePath := range opts.Files {
@@ -83,7 +123,37 @@ func (a *API) UploadPackageVersion(opts UploadOptions) error {
         return a.uploadNuGet(opts)
     case pkg.PackageTypeRubyGems:
         return a.uploadRubyGems(opts)
+    case pkg.PackageTypeCargo:
+        return a.uploadCargo(opts)
+    case pkg.PackageTypeGo:
+        return a.uploadGoModule(opts)
+    case pkg.PackageTypeDeb:
+        return a.uploadDeb(opts)
+    case pkg.PackageTypeRPM:
+        return a.uploadRPM(opts)
+    case pkg.PackageTypeComposer:
+        return a.uploadComposer(opts)
+    case pkg.PackageTypeConda:
+        return a.uploadConda(opts)
+    case pkg.PackageTypeTerraform:
+        return a.uploadTerraform(opts)
+    case pkg.PackageTypeSwift:
+        return a.uploadSwift(opts)
+    case pkg.PackageTypeCocoaPods:
+        return a.uploadCocoaPod(opts)
+    case pkg.PackageTypeGeneric:
+        return a.uploadGeneric(opts)
     default:
+        if handler, ok := extension.Lookup(opts.PackageType); ok {
+            return handler.Upload(a.ctx, a.token, extension.Request{
+                Organization: opts.Organization,
+                Hostname:     a.hostname,
+                PackageName:  opts.PackageName,
+                Version:      opts.Version,
+                Files:        opts.Files,
+                Metadata:     opts.Metadata,
+            })
+        }
         return fmt.Errorf("unsupported package type: %s", opts.PackageType)
     }
 }
@@ -106,7 +176,9 @@ func (a *API) uploadContainer(opts UploadOptions) error {
     layers := []string{}
     for _, file := range opts.Files {
         if strings.HasSuffix(file, ".tar.gz") {
+            start := time.Now()
             digest, err := a.uploadContainerLayer(baseURL, file)
+            opts.Results.record(file, start, digest, err == nil, err)
             if err != nil {
                 return fmt.Errorf("failed to upload layer %s: %v", file, err)
             }
@@ -140,7 +212,8 @@ func (a *API) uploadNpm(opts UploadOptions) error {
     }
 
     // Construct the upload URL for npm packages
-    url := fmt.Sprintf("https://npm.pkg.github.com/%s", opts.Organization)
+    // Scoped names are published to their escaped path, e.g. /@scope%2fname
+    url := fmt.Sprintf("https://npm.pkg.github.com/%s", pkg.EscapeNpmName(opts.PackageName))
 
     // Create multipart form data
     body := &bytes.Buffer{}
@@ -188,7 +261,7 @@ func (a *API) uploadNpm(opts UploadOptions) error {
     req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", a.token))
 
     // Send request
-    resp, err := http.DefaultClient.Do(req)
+    resp, err := a.client.Do(req)
     if err != nil {
         return err
     }
@@ -202,14 +275,18 @@ func (a *API) uploadNpm(opts UploadOptions) error {
 }
 
 func (a *API) uploadMaven(opts UploadOptions) error {
-    // Maven requires specific handling for pom.xml and jar files
-    var pomFile, jarFile string
+    // The POM says how the version is packaged, every other file is an
+    // artifact uploaded as is
+    var pomFile string
+    var files []string
     for _, file := range opts.Files {
         switch {
-        case strings.HasSuffix(file, "pom.xml"):
+        case strings.HasSuffix(file, ".pom") || strings.HasSuffix(file, "pom.xml"):
             pomFile = file
-        case strings.HasSuffix(file, ".jar"):
-            jarFile = file
+        case isMavenSidecar(file):
+            // Uploaded with the file it belongs to
+        default:
+            files = append(files, file)
         }
     }
 
@@ -223,23 +300,44 @@ func (a *API) uploadMaven(opts UploadOptions) error {
         return err
     }
 
-    // Construct Maven repository URL
-    baseURL := fmt.Sprintf("https://maven.pkg.github.com/%s/%s/%s/%s",
-        opts.Organization, groupID, artifactID, opts.Version)
-
-    // Upload POM
-    if err := a.uploadMavenFile(baseURL+"/pom.xml", pomFile); err != nil {
+    // BOMs and parent POMs have no jar, plugins need their descriptor
+    packaging, err := parseMavenPackaging(pomFile)
+    if err != nil {
+        return err
+    }
+    artifacts, err := parseMavenArtifacts(opts.Version, files)
+    if err != nil {
         return err
     }
+    if err := checkMavenPackaging(packaging, artifactID, opts.Version, artifacts); err != nil {
+        return err
+    }
+
+    // A renamed or prefixed target name (groupId.artifactId) moves the group
+    if group := strings.TrimSuffix(opts.PackageName, "."+artifactID); group != opts.PackageName && group != "" {
+        groupID = group
+    }
 
-    // Upload JAR if present
-    if jarFile != "" {
-        if err := a.uploadMavenFile(baseURL+"/"+filepath.Base(jarFile), jarFile); err != nil {
+    // Construct Maven repository URL
+    baseURL := fmt.Sprintf("https://maven.pkg.github.com/%s/%s/%s/%s",
+        opts.Organization, strings.ReplaceAll(groupID, ".", "/"), artifactID, opts.Version)
+
+    // Artifacts go first, so the version is only resolvable once the POM
+    // describing them is there
+    for _, artifact := range artifacts {
+        start := time.Now()
+        err := a.uploadMavenFile(baseURL+"/"+artifact.TargetName(artifactID, opts.Version), artifact.File)
+        opts.Results.record(artifact.File, start, "", false, err)
+        if err != nil {
             return err
         }
     }
 
-    return nil
+    // Clients resolve the POM by its repository layout name
+    start := time.Now()
+    err = a.uploadMavenFile(fmt.Sprintf("%s/%s-%s.pom", baseURL, artifactID, opts.Version), pomFile)
+    opts.Results.record(pomFile, start, "", false, err)
+    return err
 }
 
 func (a *API) uploadNuGet(opts UploadOptions) error {
@@ -256,6 +354,12 @@ func (a *API) uploadNuGet(opts UploadOptions) error {
         return fmt.Errorf("missing required .nupkg file")
     }
 
+    // Point the nuspec at the target organization, unless --no-rewrite
+    nupkgFile, err := a.prepareNuGetPackage(opts, nupkgFile)
+    if err != nil {
+        return err
+    }
+
     // Construct NuGet push URL
     url := fmt.Sprintf("https://nuget.pkg.github.com/%s/upload", opts.Organization)
 
@@ -290,7 +394,7 @@ func (a *API) uploadNuGet(opts UploadOptions) error {
     req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", a.token))
 
     // Send request
-    resp, err := http.DefaultClient.Do(req)
+    resp, err := a.client.Do(req)
     if err != nil {
         return err
     }
@@ -317,6 +421,11 @@ func (a *API) uploadRubyGems(opts UploadOptions) error {
         return fmt.Errorf("missing required .gem file")
     }
 
+    // Gems bound for a registry outside GitHub, e.g. gemstash
+    if registry, err := a.registryURL("rubygems"); err == nil {
+        return a.pushExternalGem(opts, registry, gemFile)
+    }
+
     // Construct RubyGems push URL
     url := fmt.Sprintf("https://rubygems.pkg.github.com/%s/api/v1/gems", opts.Organization)
 
@@ -337,7 +446,7 @@ func (a *API) uploadRubyGems(opts UploadOptions) error {
     req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", a.token))
 
     // Send request
-    resp, err := http.DefaultClient.Do(req)
+    resp, err := a.client.Do(req)
     if err != nil {
         return err
     }
@@ -385,7 +494,7 @@ func (a *API) checkExists(url string) (bool, error) {
         return false, err
     }
 
-    resp, err := http.DefaultClient.Do(req)
+    resp, err := a.client.Do(req)
     if err != nil {
         return false, err
     }
@@ -0,0 +1,79 @@
+package export
+
+import (
+    "os"
+
+    "github.com/cvega/gh-migrate-packages/pkg/api"
+    "github.com/pterm/pterm"
+)
+
+// downloadAttempts is how many times a file whose SHA-256 doesn't match
+// the listed one is downloaded before it counts as failed
+const downloadAttempts = 3
+
+// Checksum results of a version in the download report
+const (
+    checksumVerified = "verified" // every file matched the SHA-256 the API listed
+    checksumPartial  = "partial"  // files with a listed SHA-256 matched, the others had none
+    checksumUnlisted = "unlisted" // the API listed no SHA-256 for any file
+    checksumMismatch = "mismatch" // a file still didn't match after every attempt
+)
+
+// checksums tallies how a version's files compared with their listed
+// SHA-256
+type checksums struct {
+    verified   int
+    unlisted   int
+    mismatched int
+}
+
+// add counts a file on disk, checked against its listed SHA-256 if any
+func (c *checksums) add(file api.File) {
+    if api.ListedSHA256(file) == "" {
+        c.unlisted++
+    } else {
+        c.verified++
+    }
+}
+
+func (c checksums) status() string {
+    switch {
+    case c.mismatched > 0:
+        return checksumMismatch
+    case c.verified == 0 && c.unlisted > 0:
+        return checksumUnlisted
+    case c.unlisted > 0:
+        return checksumPartial
+    case c.verified > 0:
+        return checksumVerified
+    }
+    return ""
+}
+
+// fileVerified reports whether an earlier download of file at path is
+// complete: of the listed size, and of the listed SHA-256 when there is one
+func fileVerified(path string, file api.File) bool {
+    return fileExists(path, file.Size) && api.VerifyFile(path, file) == nil
+}
+
+// downloadVerified downloads file to path, and again while its SHA-256
+// doesn't match the listed one. A file that never matches is removed, so
+// a later run doesn't take it as complete by its size
+func downloadVerified(client *api.API, packageType string, file api.File, path string) error {
+    var mismatch error
+    for attempt := 1; attempt <= downloadAttempts; attempt++ {
+        if err := client.DownloadVersionFile(packageType, file, path); err != nil {
+            return err
+        }
+        mismatch = api.VerifyFile(path, file)
+        if _, ok := mismatch.(*api.ChecksumError); !ok {
+            return mismatch
+        }
+        if attempt < downloadAttempts {
+            pterm.Warning.Printf("SHA-256 of %s doesn't match the listed one (attempt %d of %d), downloading it again\n", file.Name, attempt, downloadAttempts)
+        }
+    }
+
+    os.Remove(path)
+    return mismatch
+}
@@ -0,0 +1,152 @@
+package extension
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "fmt"
+    "os"
+    "os/exec"
+    "strings"
+    "sync"
+
+    "github.com/cvega/gh-migrate-packages/pkg/package"
+)
+
+// Handler delegates list/download/upload of a custom package type to an
+// external executable. Each call runs `<command> <verb>` with a JSON request
+// on stdin and expects a JSON response on stdout.
+type Handler struct {
+    Type    string
+    Command string
+}
+
+// Protocol messages
+type Request struct {
+    Organization string                 `json:"organization"`
+    Hostname     string                 `json:"hostname,omitempty"`
+    PackageName  string                 `json:"package_name,omitempty"`
+    Version      string                 `json:"version,omitempty"`
+    DestDir      string                 `json:"dest_dir,omitempty"`
+    Files        []string               `json:"files,omitempty"`
+    Metadata     map[string]interface{} `json:"metadata,omitempty"`
+}
+
+type Response struct {
+    Packages []pkg.Package `json:"packages,omitempty"`
+    Files    []string      `json:"files,omitempty"`
+    Error    string        `json:"error,omitempty"`
+}
+
+var (
+    registryMu sync.RWMutex
+    registry   = make(map[string]*Handler)
+)
+
+// ParseSpec parses a handler spec in the form "type=/path/to/handler"
+func ParseSpec(spec string) (*Handler, error) {
+    parts := strings.SplitN(spec, "=", 2)
+    if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+        return nil, fmt.Errorf("invalid handler spec %q: expected type=command", spec)
+    }
+
+    pkgType := strings.ToLower(strings.TrimSpace(parts[0]))
+    if _, err := pkg.GetValidator(pkg.PackageType(pkgType)); err == nil {
+        return nil, fmt.Errorf("handler type %q conflicts with a built-in package type", pkgType)
+    }
+
+    return &Handler{Type: pkgType, Command: strings.TrimSpace(parts[1])}, nil
+}
+
+// Register makes a handler available to export and sync
+func Register(h *Handler) {
+    registryMu.Lock()
+    defer registryMu.Unlock()
+    registry[h.Type] = h
+    pkg.RegisterValidator(pkg.PackageType(h.Type), &pkg.CustomValidator{})
+}
+
+// RegisterSpecs registers every handler in a ";"-separated list of specs
+func RegisterSpecs(specs string) error {
+    for _, spec := range strings.Split(specs, ";") {
+        if strings.TrimSpace(spec) == "" {
+            continue
+        }
+        h, err := ParseSpec(spec)
+        if err != nil {
+            return err
+        }
+        Register(h)
+    }
+    return nil
+}
+
+// Lookup returns the handler registered for a package type
+func Lookup(pkgType string) (*Handler, bool) {
+    registryMu.RLock()
+    defer registryMu.RUnlock()
+    h, ok := registry[pkgType]
+    return h, ok
+}
+
+// List returns the packages of this type in an organization
+func (h *Handler) List(ctx context.Context, token string, req Request) ([]pkg.Package, error) {
+    resp, err := h.call(ctx, "list", token, req)
+    if err != nil {
+        return nil, err
+    }
+
+    for i := range resp.Packages {
+        resp.Packages[i].PackageType = h.Type
+    }
+
+    return resp.Packages, nil
+}
+
+// Download fetches a version's files into req.DestDir and returns their paths
+func (h *Handler) Download(ctx context.Context, token string, req Request) ([]string, error) {
+    resp, err := h.call(ctx, "download", token, req)
+    if err != nil {
+        return nil, err
+    }
+    return resp.Files, nil
+}
+
+// Upload publishes a version's files to the target organization
+func (h *Handler) Upload(ctx context.Context, token string, req Request) error {
+    _, err := h.call(ctx, "upload", token, req)
+    return err
+}
+
+func (h *Handler) call(ctx context.Context, verb, token string, req Request) (*Response, error) {
+    input, err := json.Marshal(req)
+    if err != nil {
+        return nil, fmt.Errorf("failed to marshal %s request: %v", verb, err)
+    }
+
+    var stdout, stderr bytes.Buffer
+    cmd := exec.CommandContext(ctx, h.Command, verb)
+    cmd.Stdin = bytes.NewReader(input)
+    cmd.Stdout = &stdout
+    cmd.Stderr = &stderr
+
+    // Tokens are passed through the environment to keep them out of process listings
+    cmd.Env = append(os.Environ(), "GHMP_HANDLER_TOKEN="+token)
+
+    if err := cmd.Run(); err != nil {
+        return nil, fmt.Errorf("%s handler %s failed: %v: %s", h.Type, verb, err, strings.TrimSpace(stderr.String()))
+    }
+
+    var resp Response
+    if len(bytes.TrimSpace(stdout.Bytes())) > 0 {
+        if err := json.Unmarshal(stdout.Bytes(), &resp); err != nil {
+            return nil, fmt.Errorf("%s handler %s returned invalid response: %v", h.Type, verb, err)
+        }
+    }
+
+    if resp.Error != "" {
+        return nil, fmt.Errorf("%s handler %s: %s", h.Type, verb, resp.Error)
+    }
+
+    return &resp, nil
+}
@@ -0,0 +1,199 @@
+package failure
+
+import (
+    "regexp"
+    "sort"
+    "strconv"
+    "strings"
+)
+
+// Categories of failure
+const (
+    Authentication = "authentication"
+    SSO            = "sso"
+    OrgPolicy      = "org-policy"
+    Permission     = "permission"
+    NotFound       = "not-found"
+    Conflict       = "conflict"
+    SizeLimit      = "size-limit"
+    Invalid        = "invalid"
+    RateLimit      = "rate-limit"
+    Server         = "server"
+    Network        = "network"
+    Integrity      = "integrity"
+    Unknown        = "unknown"
+)
+
+// Class is what a failure most likely means and what to do about it
+type Class struct {
+    Category string
+    Status   int    // HTTP status found in the error, 0 when there is none
+    Hint     string // remediation, empty for unknown failures
+}
+
+// rule matches errors by HTTP status, any of a set of phrases, or both;
+// a nil status matches errors with or without one
+type rule struct {
+    status   func(int) bool
+    phrases  []string // lower case, any one matches
+    category string
+    hint     string
+}
+
+func is(codes ...int) func(int) bool {
+    return func(status int) bool {
+        for _, code := range codes {
+            if status == code {
+                return true
+            }
+        }
+        return false
+    }
+}
+
+// Rules are tried in order, so those reading the registry's error body
+// come before the bare status they refine
+var rules = []rule{
+    {
+        status:   is(403),
+        phrases:  []string{"saml", "single sign-on", " sso"},
+        category: SSO,
+        hint:     "The token isn't authorized for the organization's SAML single sign-on: authorize it under Settings > Developer settings > Tokens > Configure SSO",
+    },
+    {
+        status:   is(403, 422),
+        phrases:  []string{"public packages", "public package", "visibility"},
+        category: OrgPolicy,
+        hint:     "The target organization's policy doesn't allow packages with this visibility: allow it in the organization's package settings (see org-settings) or migrate the package as private",
+    },
+    {
+        status:   is(403, 429),
+        phrases:  []string{"rate limit", "abuse detection"},
+        category: RateLimit,
+        hint:     "The API rate limit was hit: wait for it to reset and rerun, with --checkpoint to skip finished versions, or spread the run with --max-api-calls",
+    },
+    {
+        status:   is(429),
+        category: RateLimit,
+        hint:     "The API rate limit was hit: wait for it to reset and rerun, with --checkpoint to skip finished versions, or spread the run with --max-api-calls",
+    },
+    {
+        status:   is(401),
+        category: Authentication,
+        hint:     "The token was rejected: check it hasn't expired or been revoked, and that it is a classic token with read:packages on the source and write:packages on the target",
+    },
+    {
+        status:   is(403),
+        category: Permission,
+        hint:     "The token lacks access to the package: it needs read:packages on the source or write:packages on the target, and access to the package or to the repository it inherits access from",
+    },
+    {
+        status:   is(404),
+        category: NotFound,
+        hint:     "The organization, package, or version isn't visible to the token: check the names and that the token has read:packages and can see private packages",
+    },
+    {
+        status:   is(409),
+        category: Conflict,
+        hint:     "The version already exists in the target and registries don't overwrite versions: rerun with --skip-existing, or delete the target version first",
+    },
+    {
+        phrases:  []string{"already exists", "cannot publish over"},
+        category: Conflict,
+        hint:     "The version already exists in the target and registries don't overwrite versions: rerun with --skip-existing, or delete the target version first",
+    },
+    {
+        status:   is(413),
+        category: SizeLimit,
+        hint:     "A file exceeds the registry's size limit: leave it out with --file-filter, send the version to review with --review-threshold, or archive it with --archive-older-than",
+    },
+    {
+        status:   is(400, 422),
+        category: Invalid,
+        hint:     "The registry rejected the package as invalid: check the name rules of the target registry (see --normalize-names) and that the package files are complete",
+    },
+    {
+        status:   func(status int) bool { return status >= 500 },
+        category: Server,
+        hint:     "The registry failed while handling the request, usually temporarily: rerun, with --checkpoint to skip finished versions",
+    },
+    {
+        phrases:  []string{"checksum mismatch", "digest mismatch", "digest did not match"},
+        category: Integrity,
+        hint:     "The downloaded file doesn't match its published digest: rerun to download it again, and if it persists the source artifact is corrupt",
+    },
+    {
+        phrases:  []string{"timeout", "connection reset", "connection refused", "no such host", "tls handshake", "unexpected eof", "broken pipe"},
+        category: Network,
+        hint:     "The connection to the registry failed: check network access and proxies to the registry hosts, then rerun",
+    },
+}
+
+var (
+    afterStatus = regexp.MustCompile(`(?i)status(?: code)?:?\s+([1-5][0-9]{2})\b`)
+    statusText  = regexp.MustCompile(`\b([1-5][0-9]{2}) [A-Z][a-z]+`) // e.g. 413 Request Entity Too Large
+)
+
+// Classify maps an error message, as the registry clients word them with
+// "failed with status: 403 Forbidden" and any response body, to its class
+func Classify(message string) Class {
+    status := Status(message)
+    lower := strings.ToLower(message)
+    for _, r := range rules {
+        if r.status != nil && !r.status(status) {
+            continue
+        }
+        if len(r.phrases) > 0 && !containsAny(lower, r.phrases) {
+            continue
+        }
+        return Class{Category: r.category, Status: status, Hint: r.hint}
+    }
+    return Class{Category: Unknown, Status: status}
+}
+
+// Status finds the HTTP status in an error message, or returns 0
+func Status(message string) int {
+    for _, pattern := range []*regexp.Regexp{afterStatus, statusText} {
+        if match := pattern.FindStringSubmatch(message); match != nil {
+            status, _ := strconv.Atoi(match[1])
+            return status
+        }
+    }
+    return 0
+}
+
+func containsAny(s string, phrases []string) bool {
+    for _, phrase := range phrases {
+        if strings.Contains(s, phrase) {
+            return true
+        }
+    }
+    return false
+}
+
+// Summary counts failures by category, most frequent first
+type Summary struct {
+    Category string
+    Count    int
+    Hint     string
+}
+
+// Summarize classifies each message and counts them by category
+func Summarize(messages []string) []Summary {
+    index := make(map[string]int)
+    var summaries []Summary
+    for _, message := range messages {
+        class := Classify(message)
+        i, ok := index[class.Category]
+        if !ok {
+            i = len(summaries)
+            index[class.Category] = i
+            summaries = append(summaries, Summary{Category: class.Category, Hint: class.Hint})
+        }
+        summaries[i].Count++
+    }
+    sort.SliceStable(summaries, func(i, j int) bool {
+        return summaries[i].Count > summaries[j].Count
+    })
+    return summaries
+}
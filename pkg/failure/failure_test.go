@@ -0,0 +1,75 @@
+package failure
+
+import "testing"
+
+func TestClassify(t *testing.T) {
+    tests := []struct {
+        message  string
+        category string
+        status   int
+    }{
+        {"upload failed with status: 401 Unauthorized", Authentication, 401},
+        {"failed with status: 403 Forbidden: Resource protected by organization SAML enforcement", SSO, 403},
+        {"failed with status: 403 Forbidden: public packages are not allowed in this organization", OrgPolicy, 403},
+        {"failed with status: 403 Forbidden: API rate limit exceeded", RateLimit, 403},
+        {"failed with status: 429 Too Many Requests", RateLimit, 429},
+        {"failed with status: 403 Forbidden", Permission, 403},
+        {"manifest request for v1 failed with status: 404 Not Found", NotFound, 404},
+        {"failed with status: 409 Conflict", Conflict, 409},
+        {"cargo publish failed: crate version `1.0.0` already exists", Conflict, 0},
+        {"layer upload failed with status: 413 Request Entity Too Large", SizeLimit, 413},
+        {"failed with status code 422", Invalid, 422},
+        {"failed with status: 502 Bad Gateway", Server, 502},
+        {"verification failed: checksum mismatch for lib.jar", Integrity, 0},
+        {"failed to fetch blob: read tcp: connection reset by peer", Network, 0},
+        {"dial tcp: lookup npm.pkg.github.com: no such host", Network, 0},
+        {"something unexpected", Unknown, 0},
+    }
+
+    for _, tt := range tests {
+        got := Classify(tt.message)
+        if got.Category != tt.category || got.Status != tt.status {
+            t.Errorf("Classify(%q) = %s/%d, want %s/%d", tt.message, got.Category, got.Status, tt.category, tt.status)
+        }
+        if (got.Hint == "") != (tt.category == Unknown) {
+            t.Errorf("Classify(%q) hint = %q", tt.message, got.Hint)
+        }
+    }
+}
+
+func TestStatus(t *testing.T) {
+    tests := []struct {
+        message string
+        want    int
+    }{
+        {"failed with status: 503 Service Unavailable", 503},
+        {"unexpected status code 401", 401},
+        {"got 413 Request Entity Too Large", 413},
+        {"retried 3 times", 0},
+        {"version 404 of the package", 0},
+    }
+
+    for _, tt := range tests {
+        if got := Status(tt.message); got != tt.want {
+            t.Errorf("Status(%q) = %d, want %d", tt.message, got, tt.want)
+        }
+    }
+}
+
+func TestSummarize(t *testing.T) {
+    summaries := Summarize([]string{
+        "failed with status: 404 Not Found",
+        "failed with status: 401 Unauthorized",
+        "failed with status: 404 Not Found",
+    })
+
+    if len(summaries) != 2 {
+        t.Fatalf("Summarize returned %d categories, want 2", len(summaries))
+    }
+    if summaries[0].Category != NotFound || summaries[0].Count != 2 {
+        t.Errorf("first summary = %+v, want %s counted twice", summaries[0], NotFound)
+    }
+    if summaries[1].Category != Authentication || summaries[1].Count != 1 {
+        t.Errorf("second summary = %+v, want %s counted once", summaries[1], Authentication)
+    }
+}
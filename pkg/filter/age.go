@@ -0,0 +1,59 @@
+package filter
+
+import (
+    "fmt"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// Age is a calendar age such as 2y, 18mo, 6w, or 90d
+type Age struct {
+    Years  int
+    Months int
+    Days   int
+}
+
+// Longest suffixes first so mo isn't read as a bare number
+var ageUnits = []struct {
+    suffix string
+    apply  func(a *Age, n int)
+}{
+    {"mo", func(a *Age, n int) { a.Months = n }},
+    {"y", func(a *Age, n int) { a.Years = n }},
+    {"w", func(a *Age, n int) { a.Days = 7 * n }},
+    {"d", func(a *Age, n int) { a.Days = n }},
+}
+
+// ParseAge parses a number of years (y), months (mo), weeks (w), or days (d)
+func ParseAge(s string) (Age, error) {
+    value := strings.ToLower(strings.TrimSpace(s))
+    for _, unit := range ageUnits {
+        if !strings.HasSuffix(value, unit.suffix) {
+            continue
+        }
+        n, err := strconv.Atoi(strings.TrimSuffix(value, unit.suffix))
+        if err != nil || n <= 0 {
+            break
+        }
+        var age Age
+        unit.apply(&age, n)
+        return age, nil
+    }
+    return Age{}, fmt.Errorf("invalid age %q: expected a number of years, months, weeks, or days such as 2y, 18mo, 6w, or 90d", s)
+}
+
+// Cutoff returns the time an age before now
+func (a Age) Cutoff(now time.Time) time.Time {
+    return now.AddDate(-a.Years, -a.Months, -a.Days)
+}
+
+func (a Age) String() string {
+    switch {
+    case a.Years > 0:
+        return fmt.Sprintf("%dy", a.Years)
+    case a.Months > 0:
+        return fmt.Sprintf("%dmo", a.Months)
+    }
+    return fmt.Sprintf("%dd", a.Days)
+}
@@ -0,0 +1,106 @@
+package filter
+
+import (
+    "fmt"
+    "os"
+    "path"
+    "strconv"
+    "strings"
+
+    "github.com/cvega/gh-migrate-packages/pkg/csvfile"
+)
+
+// fileRule is one --file-filter glob; a leading ! excludes matching files
+type fileRule struct {
+    pattern string
+    exclude bool
+}
+
+// ExcludedFile is a file left out of a version by the file filters
+type ExcludedFile struct {
+    PackageName string
+    PackageType string
+    Version     string
+    File        string
+    Size        int64
+}
+
+func parseFileRules(patterns []string) ([]fileRule, error) {
+    var rules []fileRule
+    for _, pattern := range patterns {
+        pattern = strings.TrimSpace(pattern)
+        if pattern == "" {
+            continue
+        }
+
+        rule := fileRule{pattern: pattern}
+        if strings.HasPrefix(pattern, "!") {
+            rule = fileRule{pattern: pattern[1:], exclude: true}
+        }
+        if _, err := path.Match(rule.pattern, ""); err != nil {
+            return nil, fmt.Errorf("invalid file filter %q: %v", pattern, err)
+        }
+        rules = append(rules, rule)
+    }
+    return rules, nil
+}
+
+func (r fileRule) matches(name string) bool {
+    if ok, _ := path.Match(r.pattern, name); ok {
+        return true
+    }
+    // Patterns without a directory match the file name in any directory
+    if !strings.Contains(r.pattern, "/") {
+        ok, _ := path.Match(r.pattern, path.Base(name))
+        return ok
+    }
+    return false
+}
+
+// AllowsFile reports whether a file of a version is transferred: it must
+// match one of the include globs, if there are any, and none of the ! globs
+func (f *Filter) AllowsFile(name string) bool {
+    if f == nil || len(f.files) == 0 {
+        return true
+    }
+
+    name = strings.TrimPrefix(path.Clean("/"+strings.ReplaceAll(name, "\\", "/")), "/")
+    included, hasIncludes := false, false
+    for _, rule := range f.files {
+        if rule.exclude {
+            if rule.matches(name) {
+                return false
+            }
+            continue
+        }
+        hasIncludes = true
+        if rule.matches(name) {
+            included = true
+        }
+    }
+    return included || !hasIncludes
+}
+
+// WriteExcludedFiles lists the files the file filters left out
+func WriteExcludedFiles(filename string, files []ExcludedFile) error {
+    file, err := os.Create(filename)
+    if err != nil {
+        return fmt.Errorf("failed to create excluded files report: %v", err)
+    }
+    defer file.Close()
+
+    writer := csvfile.NewWriter(file)
+    defer writer.Flush()
+
+    if err := writer.Write([]string{"Package", "Type", "Version", "File", "Size"}); err != nil {
+        return err
+    }
+    for _, f := range files {
+        row := []string{f.PackageName, f.PackageType, f.Version, f.File, strconv.FormatInt(f.Size, 10)}
+        if err := writer.Write(row); err != nil {
+            return err
+        }
+    }
+
+    return nil
+}
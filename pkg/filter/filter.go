@@ -0,0 +1,153 @@
+package filter
+
+import (
+    "fmt"
+    "strings"
+    "sync"
+
+    "github.com/spf13/viper"
+)
+
+// Options are the version selection flags shared by export and sync
+type Options struct {
+    VersionRange       string
+    ExcludePrereleases bool // drop -beta, -rc, SNAPSHOT and the like
+    OnlyReleases       bool // also drop build metadata and non-version tags
+    MinVersionSize     int64
+    MaxVersionSize     int64
+    ReviewThreshold    int64           // versions above this need approval
+    Approved           map[string]bool // package@version cleared for review
+    FileFilters        []string        // file globs, ! to exclude
+}
+
+// Filter decides which versions of each package are migrated
+type Filter struct {
+    opts Options
+
+    files []fileRule
+
+    mu     sync.Mutex
+    ranges map[string]Range // parsed per package type
+}
+
+// New creates a filter from the command line options, any of which may be
+// empty; packageType is the selected type, if any, used to validate them early
+func New(packageType string, opts Options) (*Filter, error) {
+    f := &Filter{
+        opts:   opts,
+        ranges: make(map[string]Range),
+    }
+
+    files, err := parseFileRules(opts.FileFilters)
+    if err != nil {
+        return nil, err
+    }
+    f.files = files
+
+    // Catch malformed expressions before any package is processed
+    if opts.VersionRange != "" {
+        if _, err := f.rangeFor(packageType); err != nil {
+            return nil, err
+        }
+    }
+
+    return f, nil
+}
+
+// Allows reports whether a version of a packageType package passes the filter
+func (f *Filter) Allows(packageType, version string) (bool, error) {
+    if f == nil {
+        return true, nil
+    }
+
+    if f.opts.OnlyReleases && !IsRelease(packageType, version) {
+        return false, nil
+    }
+    if f.opts.ExcludePrereleases && IsPrerelease(packageType, version) {
+        return false, nil
+    }
+
+    if f.opts.VersionRange == "" {
+        return true, nil
+    }
+
+    r, err := f.rangeFor(packageType)
+    if err != nil {
+        return false, err
+    }
+    return r.Contains(version), nil
+}
+
+// AllowsSize reports whether a version's total size is within the size limits
+func (f *Filter) AllowsSize(size int64) bool {
+    if f == nil {
+        return true
+    }
+    if f.opts.MinVersionSize > 0 && size < f.opts.MinVersionSize {
+        return false
+    }
+    if f.opts.MaxVersionSize > 0 && size > f.opts.MaxVersionSize {
+        return false
+    }
+    return true
+}
+
+// NeedsReview reports whether a version is too large to transfer without
+// being listed in the approvals file
+func (f *Filter) NeedsReview(packageName, version string, size int64) bool {
+    if f == nil || f.opts.ReviewThreshold <= 0 || size <= f.opts.ReviewThreshold {
+        return false
+    }
+    return !f.opts.Approved[approvalKey(packageName, version)]
+}
+
+func (f *Filter) rangeFor(packageType string) (Range, error) {
+    f.mu.Lock()
+    defer f.mu.Unlock()
+
+    if r, ok := f.ranges[packageType]; ok {
+        return r, nil
+    }
+
+    r, err := ParseRange(packageType, f.opts.VersionRange)
+    if err != nil {
+        return nil, fmt.Errorf("invalid version range for %s packages: %v", packageType, err)
+    }
+    f.ranges[packageType] = r
+    return r, nil
+}
+
+// FromConfig builds a filter from the version selection flags
+func FromConfig(packageType string) (*Filter, error) {
+    opts := Options{
+        VersionRange:       viper.GetString("VERSION_RANGE"),
+        ExcludePrereleases: viper.GetBool("EXCLUDE_PRERELEASES"),
+        OnlyReleases:       viper.GetBool("ONLY_RELEASES"),
+    }
+    if patterns := viper.GetString("FILE_FILTERS"); patterns != "" {
+        opts.FileFilters = strings.Split(patterns, ";")
+    }
+
+    sizes := map[string]*int64{
+        "MIN_VERSION_SIZE": &opts.MinVersionSize,
+        "MAX_VERSION_SIZE": &opts.MaxVersionSize,
+        "REVIEW_THRESHOLD": &opts.ReviewThreshold,
+    }
+    for key, dest := range sizes {
+        size, err := ParseSize(viper.GetString(key))
+        if err != nil {
+            return nil, fmt.Errorf("invalid %s: %v", strings.ToLower(strings.ReplaceAll(key, "_", "-")), err)
+        }
+        *dest = size
+    }
+
+    if approvals := viper.GetString("APPROVALS_FILE"); approvals != "" {
+        approved, err := LoadApprovals(approvals)
+        if err != nil {
+            return nil, err
+        }
+        opts.Approved = approved
+    }
+
+    return New(packageType, opts)
+}
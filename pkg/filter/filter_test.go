@@ -0,0 +1,207 @@
+package filter
+
+import "testing"
+
+func TestAllows(t *testing.T) {
+    tests := []struct {
+        name        string
+        packageType string
+        opts        Options
+        version     string
+        want        bool
+    }{
+        {"no options", "npm", Options{}, "1.0.0", true},
+        {"comparator inside", "npm", Options{VersionRange: ">=1.2.0 <2.0.0"}, "1.5.0", true},
+        {"comparator below", "npm", Options{VersionRange: ">=1.2.0 <2.0.0"}, "1.1.9", false},
+        {"comparator upper bound excluded", "npm", Options{VersionRange: ">=1.2.0 <2.0.0"}, "2.0.0", false},
+        {"caret", "npm", Options{VersionRange: "^1.2"}, "1.9.3", true},
+        {"caret next major", "npm", Options{VersionRange: "^1.2"}, "2.0.0", false},
+        {"pessimistic", "rubygems", Options{VersionRange: "~> 2.1"}, "2.9", true},
+        {"pessimistic next major", "rubygems", Options{VersionRange: "~> 2.1"}, "3.0", false},
+        {"alternatives", "npm", Options{VersionRange: "<1.0.0 || >=3.0.0"}, "3.1.0", true},
+        {"hyphen range", "npm", Options{VersionRange: "1.0.0 - 2.0.0"}, "2.0.0", true},
+        {"not equal", "npm", Options{VersionRange: "!=1.0.0"}, "1.0.0", false},
+        {"interval inside", "maven", Options{VersionRange: "[1.0,2.0)"}, "1.5", true},
+        {"interval open end", "maven", Options{VersionRange: "[1.0,2.0)"}, "2.0", false},
+        {"interval pin", "nuget", Options{VersionRange: "[1.0]"}, "1.0", true},
+        {"container glob", "container", Options{VersionRange: "v1.*, release-*"}, "release-7", true},
+        {"container glob miss", "container", Options{VersionRange: "v1.*"}, "v2.0", false},
+        {"prerelease excluded", "npm", Options{ExcludePrereleases: true}, "1.0.0-rc.1", false},
+        {"release kept", "npm", Options{ExcludePrereleases: true}, "1.0.0", true},
+        {"maven snapshot excluded", "maven", Options{ExcludePrereleases: true}, "1.0-SNAPSHOT", false},
+        {"only releases drops tags", "container", Options{OnlyReleases: true}, "latest", false},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            f, err := New(tt.packageType, tt.opts)
+            if err != nil {
+                t.Fatalf("New: %v", err)
+            }
+            got, err := f.Allows(tt.packageType, tt.version)
+            if err != nil {
+                t.Fatalf("Allows: %v", err)
+            }
+            if got != tt.want {
+                t.Errorf("Allows(%q, %q) = %v, want %v", tt.packageType, tt.version, got, tt.want)
+            }
+        })
+    }
+}
+
+func TestNewRejectsInvalidRanges(t *testing.T) {
+    tests := []struct {
+        packageType string
+        opts        Options
+    }{
+        {"npm", Options{VersionRange: "~>"}},
+        {"maven", Options{VersionRange: "[1.0,2.0,3.0]"}},
+        {"maven", Options{VersionRange: "(1.0)"}},
+        {"container", Options{VersionRange: "v1.["}},
+        {"npm", Options{FileFilters: []string{"!["}}},
+    }
+
+    for _, tt := range tests {
+        if _, err := New(tt.packageType, tt.opts); err == nil {
+            t.Errorf("New(%q, %+v) succeeded, want an error", tt.packageType, tt.opts)
+        }
+    }
+}
+
+func TestNilFilterAllowsEverything(t *testing.T) {
+    var f *Filter
+    if ok, err := f.Allows("npm", "1.0.0-beta"); !ok || err != nil {
+        t.Errorf("Allows = %v, %v, want true, nil", ok, err)
+    }
+    if !f.AllowsSize(1 << 40) {
+        t.Error("AllowsSize = false, want true")
+    }
+    if !f.AllowsFile("any/file.bin") {
+        t.Error("AllowsFile = false, want true")
+    }
+    if f.NeedsReview("pkg", "1.0.0", 1<<40) {
+        t.Error("NeedsReview = true, want false")
+    }
+}
+
+func TestAllowsSize(t *testing.T) {
+    f, err := New("", Options{MinVersionSize: 10, MaxVersionSize: 100})
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    tests := []struct {
+        size int64
+        want bool
+    }{
+        {9, false},
+        {10, true},
+        {100, true},
+        {101, false},
+    }
+    for _, tt := range tests {
+        if got := f.AllowsSize(tt.size); got != tt.want {
+            t.Errorf("AllowsSize(%d) = %v, want %v", tt.size, got, tt.want)
+        }
+    }
+}
+
+func TestNeedsReview(t *testing.T) {
+    f, err := New("", Options{ReviewThreshold: 100, Approved: map[string]bool{approvalKey("big", "2.0"): true}})
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    tests := []struct {
+        name, version string
+        size          int64
+        want          bool
+    }{
+        {"small", "1.0", 100, false},
+        {"big", "1.0", 101, true},
+        {"big", "2.0", 101, false},
+    }
+    for _, tt := range tests {
+        if got := f.NeedsReview(tt.name, tt.version, tt.size); got != tt.want {
+            t.Errorf("NeedsReview(%q, %q, %d) = %v, want %v", tt.name, tt.version, tt.size, got, tt.want)
+        }
+    }
+}
+
+func TestAllowsFile(t *testing.T) {
+    tests := []struct {
+        name    string
+        filters []string
+        file    string
+        want    bool
+    }{
+        {"no filters", nil, "lib.jar", true},
+        {"include match", []string{"*.jar"}, "lib.jar", true},
+        {"include miss", []string{"*.jar"}, "lib.pom", false},
+        {"include in any directory", []string{"*.jar"}, "com/example/lib.jar", true},
+        {"pattern with directory", []string{"docs/*"}, "src/readme.md", false},
+        {"exclude only", []string{"!*.sig"}, "lib.jar", true},
+        {"exclude wins", []string{"*", "!*.sig"}, "lib.jar.sig", false},
+        {"backslashes normalized", []string{"!build/*"}, "build\\out.bin", false},
+        {"dot segments cleaned", []string{"!secret/*"}, "a/../secret/key", false},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            f, err := New("", Options{FileFilters: tt.filters})
+            if err != nil {
+                t.Fatal(err)
+            }
+            if got := f.AllowsFile(tt.file); got != tt.want {
+                t.Errorf("AllowsFile(%q) with %q = %v, want %v", tt.file, tt.filters, got, tt.want)
+            }
+        })
+    }
+}
+
+func TestParseSize(t *testing.T) {
+    tests := []struct {
+        in      string
+        want    int64
+        wantErr bool
+    }{
+        {"", 0, false},
+        {"1048576", 1048576, false},
+        {"500MB", 500 * 1000 * 1000, false},
+        {"1.5GiB", 3 << 29, false},
+        {"10mib", 10 << 20, false},
+        {"2K", 2048, false},
+        {" 7 B ", 7, false},
+        {"-1MB", 0, true},
+        {"lots", 0, true},
+    }
+
+    for _, tt := range tests {
+        got, err := ParseSize(tt.in)
+        if (err != nil) != tt.wantErr {
+            t.Errorf("ParseSize(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+            continue
+        }
+        if got != tt.want {
+            t.Errorf("ParseSize(%q) = %d, want %d", tt.in, got, tt.want)
+        }
+    }
+}
+
+func TestFormatSize(t *testing.T) {
+    tests := []struct {
+        in   int64
+        want string
+    }{
+        {512, "512B"},
+        {1536, "1.5KiB"},
+        {10 << 20, "10.0MiB"},
+        {3 << 29, "1.5GiB"},
+    }
+
+    for _, tt := range tests {
+        if got := FormatSize(tt.in); got != tt.want {
+            t.Errorf("FormatSize(%d) = %q, want %q", tt.in, got, tt.want)
+        }
+    }
+}
@@ -0,0 +1,307 @@
+package filter
+
+import (
+    "fmt"
+    "path"
+    "strconv"
+    "strings"
+)
+
+// Range is a set of versions selected by a --version-range expression
+type Range interface {
+    Contains(version string) bool
+}
+
+// ParseRange parses expr with packageType's conventions:
+//   - containers take comma separated tag globs (v1.*, release-*)
+//   - [1.0,2.0) style interval sets work for every type, as in Maven and NuGet
+//   - otherwise comparators (>=, <, ~>, ^, ~, 1.2.x, 1.0 - 2.0) joined by || alternatives
+func ParseRange(packageType, expr string) (Range, error) {
+    expr = strings.TrimSpace(expr)
+    if expr == "" {
+        return nil, fmt.Errorf("empty version range")
+    }
+
+    if packageType == "container" {
+        return parseGlobs(expr)
+    }
+    if strings.HasPrefix(expr, "[") || strings.HasPrefix(expr, "(") {
+        return parseIntervals(packageType, expr)
+    }
+    return parseComparators(packageType, expr)
+}
+
+type globRange []string
+
+func parseGlobs(expr string) (Range, error) {
+    var globs globRange
+    for _, glob := range strings.Split(expr, ",") {
+        glob = strings.TrimSpace(glob)
+        if _, err := path.Match(glob, ""); err != nil {
+            return nil, fmt.Errorf("invalid tag pattern %q: %v", glob, err)
+        }
+        globs = append(globs, glob)
+    }
+    return globs, nil
+}
+
+func (g globRange) Contains(tag string) bool {
+    for _, glob := range g {
+        if ok, _ := path.Match(glob, tag); ok {
+            return true
+        }
+    }
+    return false
+}
+
+// bound is one side of an interval, an empty version meaning unbounded
+type bound struct {
+    version   string
+    inclusive bool
+}
+
+type interval struct {
+    packageType  string
+    lower, upper bound
+}
+
+func (i interval) Contains(v string) bool {
+    if i.lower.version != "" {
+        c := compareVersions(i.packageType, v, i.lower.version)
+        if c < 0 || (c == 0 && !i.lower.inclusive) {
+            return false
+        }
+    }
+    if i.upper.version != "" {
+        c := compareVersions(i.packageType, v, i.upper.version)
+        if c > 0 || (c == 0 && !i.upper.inclusive) {
+            return false
+        }
+    }
+    return true
+}
+
+// anyOf matches if any of its ranges does
+type anyOf []Range
+
+func (a anyOf) Contains(v string) bool {
+    for _, r := range a {
+        if r.Contains(v) {
+            return true
+        }
+    }
+    return false
+}
+
+// allOf matches if all of its ranges do
+type allOf []Range
+
+func (a allOf) Contains(v string) bool {
+    for _, r := range a {
+        if !r.Contains(v) {
+            return false
+        }
+    }
+    return true
+}
+
+type notEqual struct {
+    packageType string
+    version     string
+}
+
+func (n notEqual) Contains(v string) bool {
+    return compareVersions(n.packageType, v, n.version) != 0
+}
+
+// parseIntervals parses Maven/NuGet notation such as [1.0,2.0) or (,1.0],[1.2,)
+func parseIntervals(packageType, expr string) (Range, error) {
+    var sets anyOf
+    rest := expr
+    for rest != "" {
+        end := strings.IndexAny(rest, ")]")
+        if end < 0 || (rest[0] != '[' && rest[0] != '(') {
+            return nil, fmt.Errorf("invalid version range %q", expr)
+        }
+
+        set := rest[:end+1]
+        rest = strings.TrimPrefix(strings.TrimSpace(rest[end+1:]), ",")
+        rest = strings.TrimSpace(rest)
+
+        body := set[1 : len(set)-1]
+        lower := bound{inclusive: set[0] == '['}
+        upper := bound{inclusive: set[len(set)-1] == ']'}
+
+        parts := strings.Split(body, ",")
+        switch len(parts) {
+        case 1:
+            // [1.0] pins a single version
+            if !lower.inclusive || !upper.inclusive {
+                return nil, fmt.Errorf("invalid version range %q", set)
+            }
+            lower.version = strings.TrimSpace(parts[0])
+            upper.version = lower.version
+        case 2:
+            lower.version = strings.TrimSpace(parts[0])
+            upper.version = strings.TrimSpace(parts[1])
+        default:
+            return nil, fmt.Errorf("invalid version range %q", set)
+        }
+
+        sets = append(sets, interval{packageType: packageType, lower: lower, upper: upper})
+    }
+    return sets, nil
+}
+
+// parseComparators parses npm, RubyGems and Composer style constraints
+func parseComparators(packageType, expr string) (Range, error) {
+    var alternatives anyOf
+    for _, group := range strings.Split(expr, "||") {
+        fields := strings.Fields(strings.ReplaceAll(group, ",", " "))
+        var constraints allOf
+
+        for i := 0; i < len(fields); i++ {
+            // Hyphen ranges: 1.0.0 - 2.0.0
+            if i+2 < len(fields) && fields[i+1] == "-" {
+                constraints = append(constraints, interval{
+                    packageType: packageType,
+                    lower:       bound{version: fields[i], inclusive: true},
+                    upper:       bound{version: fields[i+2], inclusive: true},
+                })
+                i += 2
+                continue
+            }
+
+            // Allow an operator separated from its version: >= 1.0, ~> 2.1
+            op, operand := splitOperator(fields[i])
+            if operand == "" && i+1 < len(fields) {
+                i++
+                operand = fields[i]
+            }
+
+            r, err := comparator(packageType, op, operand)
+            if err != nil {
+                return nil, err
+            }
+            constraints = append(constraints, r)
+        }
+
+        if len(constraints) == 0 {
+            return nil, fmt.Errorf("invalid version range %q", expr)
+        }
+        alternatives = append(alternatives, constraints)
+    }
+    return alternatives, nil
+}
+
+var operators = []string{"~>", ">=", "<=", "!=", "==", ">", "<", "=", "^", "~"}
+
+func splitOperator(field string) (string, string) {
+    for _, op := range operators {
+        if strings.HasPrefix(field, op) {
+            return op, strings.TrimPrefix(field, op)
+        }
+    }
+    return "", field
+}
+
+func comparator(packageType, op, operand string) (Range, error) {
+    if operand == "" {
+        return nil, fmt.Errorf("missing version after %q", op)
+    }
+
+    at := func(lower, upper string, lowerInclusive, upperInclusive bool) Range {
+        return interval{
+            packageType: packageType,
+            lower:       bound{version: lower, inclusive: lowerInclusive},
+            upper:       bound{version: upper, inclusive: upperInclusive},
+        }
+    }
+
+    switch op {
+    case ">=":
+        return at(operand, "", true, false), nil
+    case ">":
+        return at(operand, "", false, false), nil
+    case "<=":
+        return at("", operand, false, true), nil
+    case "<":
+        return at("", operand, false, false), nil
+    case "!=":
+        return notEqual{packageType: packageType, version: operand}, nil
+    }
+
+    parts := numericParts(operand)
+    if (op == "~>" || op == "^" || op == "~") && len(parts) == 0 {
+        return nil, fmt.Errorf("invalid version %q after %q", operand, op)
+    }
+
+    switch op {
+    case "~>":
+        // Pessimistic: ~> 2.1 allows 2.x, ~> 2.1.3 allows 2.1.x
+        if len(parts) < 2 {
+            return at(operand, "", true, false), nil
+        }
+        return at(operand, bump(parts[:len(parts)-1]), true, false), nil
+    case "^":
+        // Caret: changes that don't touch the first non-zero segment
+        keep := 1
+        for keep < len(parts) && parts[keep-1] == 0 {
+            keep++
+        }
+        return at(operand, bump(parts[:keep]), true, false), nil
+    case "~":
+        // Tilde: patch changes, or minor changes when only a major is given
+        keep := 2
+        if len(parts) < 2 {
+            keep = 1
+        }
+        return at(operand, bump(parts[:keep]), true, false), nil
+    }
+
+    // Wildcards: *, 1.x, 1.2.*
+    if operand == "*" || operand == "x" || operand == "X" {
+        return at("", "", false, false), nil
+    }
+    segments := strings.Split(operand, ".")
+    for i, seg := range segments {
+        if seg == "*" || seg == "x" || seg == "X" {
+            prefix := numericParts(strings.Join(segments[:i], "."))
+            if len(prefix) != i {
+                return nil, fmt.Errorf("invalid wildcard version %q", operand)
+            }
+            return at(strings.Join(segments[:i], "."), bump(prefix), true, false), nil
+        }
+    }
+
+    // A bare version or = pins exactly
+    return at(operand, operand, true, true), nil
+}
+
+// numericParts returns the leading numeric segments of a version
+func numericParts(v string) []int {
+    var parts []int
+    for _, seg := range strings.Split(strings.TrimPrefix(v, "v"), ".") {
+        n, err := strconv.Atoi(seg)
+        if err != nil {
+            break
+        }
+        parts = append(parts, n)
+    }
+    return parts
+}
+
+// bump increments the last segment, giving the exclusive upper bound of a
+// range: [1 2] -> 1.3
+func bump(parts []int) string {
+    if len(parts) == 0 {
+        return ""
+    }
+
+    segs := make([]string, len(parts))
+    for i, n := range parts {
+        segs[i] = strconv.Itoa(n)
+    }
+    segs[len(segs)-1] = strconv.Itoa(parts[len(parts)-1] + 1)
+    return strings.Join(segs, ".")
+}
@@ -0,0 +1,72 @@
+package filter
+
+import (
+    "fmt"
+    "os"
+    "strconv"
+
+    "github.com/cvega/gh-migrate-packages/pkg/csvfile"
+)
+
+// ReviewItem is a version held back because it exceeds the review threshold
+type ReviewItem struct {
+    PackageName string
+    PackageType string
+    Version     string
+    Size        int64
+}
+
+// LoadApprovals reads package/version pairs cleared for transfer despite
+// their size, in the format written by WriteReviewQueue
+func LoadApprovals(filename string) (map[string]bool, error) {
+    file, err := os.Open(filename)
+    if err != nil {
+        return nil, fmt.Errorf("failed to open approvals file: %v", err)
+    }
+    defer file.Close()
+
+    reader := csvfile.NewReader(file)
+    reader.FieldsPerRecord = -1
+    records, err := reader.ReadAll()
+    if err != nil {
+        return nil, fmt.Errorf("failed to read approvals file: %v", err)
+    }
+
+    approved := make(map[string]bool)
+    for i, record := range records {
+        if i == 0 || len(record) < 3 {
+            continue // Skip header row
+        }
+        approved[approvalKey(record[0], record[2])] = true
+    }
+    return approved, nil
+}
+
+// WriteReviewQueue writes the versions needing approval; after review the
+// same file, trimmed to the approved rows, can be passed back as approvals
+func WriteReviewQueue(filename string, items []ReviewItem) error {
+    file, err := os.Create(filename)
+    if err != nil {
+        return fmt.Errorf("failed to create review queue: %v", err)
+    }
+    defer file.Close()
+
+    writer := csvfile.NewWriter(file)
+    defer writer.Flush()
+
+    if err := writer.Write([]string{"Package", "Type", "Version", "Size"}); err != nil {
+        return err
+    }
+    for _, item := range items {
+        row := []string{item.PackageName, item.PackageType, item.Version, strconv.FormatInt(item.Size, 10)}
+        if err := writer.Write(row); err != nil {
+            return err
+        }
+    }
+
+    return nil
+}
+
+func approvalKey(packageName, version string) string {
+    return packageName + "@" + version
+}
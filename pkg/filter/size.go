@@ -0,0 +1,55 @@
+package filter
+
+import (
+    "fmt"
+    "strconv"
+    "strings"
+)
+
+// Binary units come first so KiB isn't read as K
+var sizeUnits = []struct {
+    suffix string
+    factor int64
+}{
+    {"KIB", 1 << 10}, {"MIB", 1 << 20}, {"GIB", 1 << 30}, {"TIB", 1 << 40},
+    {"KB", 1000}, {"MB", 1000 * 1000}, {"GB", 1000 * 1000 * 1000}, {"TB", 1000 * 1000 * 1000 * 1000},
+    {"K", 1 << 10}, {"M", 1 << 20}, {"G", 1 << 30}, {"T", 1 << 40},
+    {"B", 1},
+}
+
+// ParseSize parses a byte count such as 1048576, 500MB or 1.5GiB
+func ParseSize(s string) (int64, error) {
+    value := strings.ToUpper(strings.TrimSpace(s))
+    if value == "" {
+        return 0, nil
+    }
+
+    factor := int64(1)
+    for _, unit := range sizeUnits {
+        if strings.HasSuffix(value, unit.suffix) {
+            factor = unit.factor
+            value = strings.TrimSpace(strings.TrimSuffix(value, unit.suffix))
+            break
+        }
+    }
+
+    n, err := strconv.ParseFloat(value, 64)
+    if err != nil || n < 0 {
+        return 0, fmt.Errorf("invalid size %q", s)
+    }
+    return int64(n * float64(factor)), nil
+}
+
+// FormatSize writes a byte count in the largest binary unit it fills, the
+// inverse of ParseSize up to rounding, e.g. 1.5GiB
+func FormatSize(n int64) string {
+    for _, unit := range []struct {
+        suffix string
+        factor int64
+    }{{"TiB", 1 << 40}, {"GiB", 1 << 30}, {"MiB", 1 << 20}, {"KiB", 1 << 10}} {
+        if n >= unit.factor {
+            return strconv.FormatFloat(float64(n)/float64(unit.factor), 'f', 1, 64) + unit.suffix
+        }
+    }
+    return strconv.FormatInt(n, 10) + "B"
+}
@@ -0,0 +1,285 @@
+package filter
+
+import (
+    "regexp"
+    "strconv"
+    "strings"
+)
+
+// scheme is the versioning convention a package type orders its versions by
+type scheme int
+
+const (
+    schemeSemver scheme = iota
+    schemeMaven
+    schemeNuGet
+    schemeRubyGems
+)
+
+func schemeFor(packageType string) scheme {
+    switch packageType {
+    case "maven":
+        return schemeMaven
+    case "nuget":
+        return schemeNuGet
+    case "rubygems":
+        return schemeRubyGems
+    default:
+        return schemeSemver
+    }
+}
+
+// version is a parsed version: numeric release segments followed by
+// prerelease identifiers, e.g. 1.2.0-beta.3 is [1 2 0] [beta 3]
+type version struct {
+    release    []int
+    prerelease []string
+}
+
+var gemSegmentPattern = regexp.MustCompile(`[0-9]+|[a-zA-Z]+`)
+
+func parseVersion(s scheme, raw string) version {
+    raw = strings.TrimPrefix(strings.TrimSpace(raw), "v")
+
+    // Build metadata never takes part in ordering
+    if i := strings.Index(raw, "+"); i >= 0 {
+        raw = raw[:i]
+    }
+
+    var v version
+    if s == schemeRubyGems {
+        // Gem::Version treats everything from the first letter on as prerelease
+        for _, seg := range gemSegmentPattern.FindAllString(raw, -1) {
+            n, err := strconv.Atoi(seg)
+            if err == nil && len(v.prerelease) == 0 {
+                v.release = append(v.release, n)
+            } else {
+                v.prerelease = append(v.prerelease, seg)
+            }
+        }
+        return v
+    }
+
+    release := raw
+    if i := strings.Index(raw, "-"); i >= 0 {
+        release = raw[:i]
+        v.prerelease = strings.Split(raw[i+1:], ".")
+    }
+    for _, seg := range strings.Split(release, ".") {
+        n, err := strconv.Atoi(seg)
+        if err != nil {
+            // Odd release segments such as 1.0a sort as prerelease
+            v.prerelease = append([]string{seg}, v.prerelease...)
+            break
+        }
+        v.release = append(v.release, n)
+    }
+    return v
+}
+
+// compareVersions orders a and b the way packageType's ecosystem does
+func compareVersions(packageType, a, b string) int {
+    s := schemeFor(packageType)
+    if s == schemeMaven {
+        return compareMaven(a, b)
+    }
+
+    va, vb := parseVersion(s, a), parseVersion(s, b)
+    for i := 0; i < len(va.release) || i < len(vb.release); i++ {
+        if c := compareInt(segment(va.release, i), segment(vb.release, i)); c != 0 {
+            return c
+        }
+    }
+
+    // A release sorts after any of its prereleases
+    switch {
+    case len(va.prerelease) == 0 && len(vb.prerelease) == 0:
+        return 0
+    case len(va.prerelease) == 0:
+        return 1
+    case len(vb.prerelease) == 0:
+        return -1
+    }
+
+    for i := 0; i < len(va.prerelease) && i < len(vb.prerelease); i++ {
+        if c := compareIdentifier(s, va.prerelease[i], vb.prerelease[i]); c != 0 {
+            return c
+        }
+    }
+    return compareInt(len(va.prerelease), len(vb.prerelease))
+}
+
+func compareIdentifier(s scheme, a, b string) int {
+    na, errA := strconv.Atoi(a)
+    nb, errB := strconv.Atoi(b)
+    switch {
+    case errA == nil && errB == nil:
+        return compareInt(na, nb)
+    case errA == nil:
+        return -1 // Numeric identifiers sort before alphanumeric ones
+    case errB == nil:
+        return 1
+    }
+
+    // NuGet compares prerelease labels case-insensitively
+    if s == schemeNuGet {
+        a, b = strings.ToLower(a), strings.ToLower(b)
+    }
+    return strings.Compare(a, b)
+}
+
+// IsPrerelease reports whether version is a prerelease under packageType's
+// rules: a semver/NuGet -suffix, a RubyGems letter segment, or a Maven
+// alpha, beta, milestone, rc or SNAPSHOT qualifier
+func IsPrerelease(packageType, raw string) bool {
+    s := schemeFor(packageType)
+    if s == schemeMaven {
+        for _, item := range parseMaven(raw) {
+            if !item.numeric && qualifierRank(item.qualifier) < mavenQualifiers[""] {
+                return true
+            }
+        }
+        return false
+    }
+    // Tags that aren't versions, like latest, aren't prereleases either
+    v := parseVersion(s, raw)
+    return len(v.release) > 0 && len(v.prerelease) > 0
+}
+
+// IsRelease reports whether version is a plain release: numeric segments
+// only, without prerelease labels or build metadata. Maven's GA and service
+// pack qualifiers still count as releases; container tags such as latest or
+// main aren't versions at all and never do
+func IsRelease(packageType, raw string) bool {
+    if strings.Contains(raw, "+") {
+        return false
+    }
+
+    s := schemeFor(packageType)
+    if s == schemeMaven {
+        items := parseMaven(raw)
+        if len(items) == 0 || !items[0].numeric {
+            return false
+        }
+        for _, item := range items {
+            if item.numeric {
+                continue
+            }
+            if rank := qualifierRank(item.qualifier); rank < mavenQualifiers[""] || rank > mavenQualifiers["sp"] {
+                return false
+            }
+        }
+        return true
+    }
+
+    v := parseVersion(s, raw)
+    return len(v.release) > 0 && len(v.prerelease) == 0
+}
+
+// Maven qualifier order, unknown qualifiers sort after all of these
+var mavenQualifiers = map[string]int{
+    "alpha": 0, "a": 0,
+    "beta": 1, "b": 1,
+    "milestone": 2, "m": 2,
+    "rc": 3, "cr": 3,
+    "snapshot": 4,
+    "": 5, "ga": 5, "final": 5, "release": 5,
+    "sp": 6,
+}
+
+type mavenItem struct {
+    number    int
+    qualifier string
+    numeric   bool
+}
+
+var mavenTokenPattern = regexp.MustCompile(`[0-9]+|[a-zA-Z]+`)
+
+func parseMaven(raw string) []mavenItem {
+    var items []mavenItem
+    for _, tok := range mavenTokenPattern.FindAllString(strings.ToLower(raw), -1) {
+        if n, err := strconv.Atoi(tok); err == nil {
+            items = append(items, mavenItem{number: n, numeric: true})
+        } else {
+            items = append(items, mavenItem{qualifier: tok})
+        }
+    }
+
+    // Trailing zeros and release qualifiers don't change the version
+    for len(items) > 0 {
+        last := items[len(items)-1]
+        if (last.numeric && last.number == 0) || (!last.numeric && qualifierRank(last.qualifier) == mavenQualifiers[""]) {
+            items = items[:len(items)-1]
+            continue
+        }
+        break
+    }
+    return items
+}
+
+// compareMaven is a simplified ComparableVersion ordering
+func compareMaven(a, b string) int {
+    ia, ib := parseMaven(a), parseMaven(b)
+    for i := 0; i < len(ia) || i < len(ib); i++ {
+        var x, y *mavenItem
+        if i < len(ia) {
+            x = &ia[i]
+        }
+        if i < len(ib) {
+            y = &ib[i]
+        }
+        if c := compareMavenItem(x, y); c != 0 {
+            return c
+        }
+    }
+    return 0
+}
+
+// compareMavenItem compares two items, nil standing in for a missing one
+func compareMavenItem(a, b *mavenItem) int {
+    switch {
+    case a == nil && b == nil:
+        return 0
+    case a == nil:
+        return -compareMavenItem(b, nil)
+    case a.numeric && b == nil:
+        return compareInt(a.number, 0)
+    case a.numeric && b.numeric:
+        return compareInt(a.number, b.number)
+    case a.numeric:
+        return 1 // 1.0.1 is newer than 1.0-sp
+    case b == nil:
+        return compareInt(qualifierRank(a.qualifier), mavenQualifiers[""])
+    case b.numeric:
+        return -1
+    }
+
+    if c := compareInt(qualifierRank(a.qualifier), qualifierRank(b.qualifier)); c != 0 {
+        return c
+    }
+    return strings.Compare(a.qualifier, b.qualifier)
+}
+
+func qualifierRank(q string) int {
+    if rank, ok := mavenQualifiers[q]; ok {
+        return rank
+    }
+    return len(mavenQualifiers)
+}
+
+func segment(parts []int, i int) int {
+    if i < len(parts) {
+        return parts[i]
+    }
+    return 0
+}
+
+func compareInt(a, b int) int {
+    switch {
+    case a < b:
+        return -1
+    case a > b:
+        return 1
+    }
+    return 0
+}
@@ -0,0 +1,368 @@
+package importer
+
+import (
+    "encoding/json"
+    "fmt"
+    "os"
+    "path"
+    "path/filepath"
+    "sort"
+    "strings"
+    "time"
+
+    "github.com/cvega/gh-migrate-packages/pkg/api"
+    "github.com/cvega/gh-migrate-packages/pkg/package"
+    "github.com/cvega/gh-migrate-packages/pkg/run"
+)
+
+// ociLayoutFile marks a directory as an OCI image layout, as written by
+// skopeo, crane, buildah, or docker buildx
+const ociLayoutFile = "oci-layout"
+
+// ociIndexMediaTypes are the index and manifest list media types, whose
+// entries are manifests of their own
+var ociIndexMediaTypes = map[string]bool{
+    "application/vnd.oci.image.index.v1+json":                   true,
+    "application/vnd.docker.distribution.manifest.list.v2+json": true,
+}
+
+// ociDescriptor is an entry of an OCI index or manifest
+type ociDescriptor struct {
+    MediaType   string            `json:"mediaType"`
+    Digest      string            `json:"digest"`
+    Size        int               `json:"size"`
+    Annotations map[string]string `json:"annotations"`
+    Platform    *struct {
+        Architecture string `json:"architecture"`
+        OS           string `json:"os"`
+    } `json:"platform"`
+}
+
+// detector identifies versions in directories another tool wrote, which
+// have no metadata.json, from the signatures of their files
+type detector struct {
+    staging string // for the package.json of npm tarballs found without one
+}
+
+// detect returns the versions in dir identified from the files directly in
+// it: an OCI image layout, .nupkg and .gem files, Maven POMs, and npm
+// package.json files or tarballs. It reports whether dir is an OCI layout,
+// whose subdirectories belong to it. Files that carry a signature but
+// can't be read are returned as failures
+func (d *detector) detect(dir string) (versions []Version, failures []Result, layout bool, err error) {
+    entries, err := os.ReadDir(dir)
+    if err != nil {
+        return nil, nil, false, err
+    }
+    var files []string
+    for _, entry := range entries {
+        if entry.Name() == ociLayoutFile && !entry.IsDir() {
+            versions, failures = detectOCILayout(dir)
+            return versions, failures, true, nil
+        }
+        if !entry.IsDir() {
+            files = append(files, entry.Name())
+        }
+    }
+
+    var poms, tarballs []string
+    packageJSON := false
+    for _, name := range files {
+        switch {
+        case strings.HasSuffix(name, ".nupkg"):
+            versions, failures = d.add(versions, failures, dir, name, pkg.PackageTypeNuGet, name, []string{name})
+        case strings.HasSuffix(name, ".gem"):
+            versions, failures = d.add(versions, failures, dir, name, pkg.PackageTypeRubyGems, name, []string{name})
+        case strings.HasSuffix(name, ".pom") || name == "pom.xml":
+            poms = append(poms, name)
+        case strings.HasSuffix(name, ".tgz"):
+            tarballs = append(tarballs, name)
+        case name == "package.json":
+            packageJSON = true
+        }
+    }
+
+    // The longest POM name first, so app-1.0-SNAPSHOT.pom claims its
+    // files before app-1.0.pom can
+    sort.Slice(poms, func(i, j int) bool {
+        return len(poms[i]) > len(poms[j])
+    })
+    claimed := make(map[string]bool)
+    for _, pom := range poms {
+        versions, failures = d.add(versions, failures, dir, pom, pkg.PackageTypeMaven, pom, mavenFiles(dir, pom, files, claimed))
+    }
+
+    if packageJSON {
+        tarball := npmTarball(dir, tarballs)
+        if tarball != "" {
+            versions, failures = d.add(versions, failures, dir, "package.json", pkg.PackageTypeNpm, "package.json", []string{"package.json", tarball})
+        }
+        tarballs = remove(tarballs, tarball)
+    }
+    for _, tarball := range tarballs {
+        // Tarballs that aren't npm packages are left alone
+        staged, err := d.stageManifest(filepath.Join(dir, tarball))
+        if err != nil {
+            continue
+        }
+        versions, failures = d.add(versions, failures, dir, tarball, pkg.PackageTypeNpm, staged, []string{staged, tarball})
+    }
+    return versions, failures, false, nil
+}
+
+// add identifies the version whose coordinates manifest, a file in dir or
+// a staged one, declares, and appends it with files to versions. Why it
+// can't be identified is appended to failures, naming source, the file
+// the version was found by
+func (d *detector) add(versions []Version, failures []Result, dir, source string, packageType pkg.PackageType, manifest string, files []string) ([]Version, []Result) {
+    manifestPath := manifest
+    if !filepath.IsAbs(manifest) {
+        manifestPath = filepath.Join(dir, manifest)
+    }
+    name, version, err := api.ReadCoordinates(string(packageType), manifestPath)
+    if err != nil {
+        return versions, append(failures, Result{
+            PackageType: string(packageType),
+            Package:     filepath.Join(dir, source),
+            Status:      StatusFailed,
+            Detail:      "not identified: " + err.Error(),
+        })
+    }
+
+    v := Version{
+        Dir:      dir,
+        Detected: true,
+        Package:  api.Package{Name: name, PackageType: string(packageType)},
+        // The version name keys the checkpoint, there is no export ID
+        Version: api.Version{ID: version, Name: version},
+    }
+    var newest time.Time
+    for _, file := range files {
+        filePath := file
+        if !filepath.IsAbs(file) {
+            filePath = filepath.Join(dir, file)
+        }
+        info, err := os.Stat(filePath)
+        if err != nil {
+            return versions, append(failures, Result{
+                PackageType: string(packageType),
+                Package:     name,
+                Version:     version,
+                Status:      StatusFailed,
+                Detail:      fmt.Sprintf("not identified: %v", err),
+            })
+        }
+        if info.ModTime().After(newest) {
+            newest = info.ModTime()
+        }
+        v.Files = append(v.Files, filePath)
+        v.Version.Files = append(v.Version.Files, api.File{Name: filepath.Base(file), Size: int(info.Size())})
+    }
+    v.Version.CreatedAt = newest.UTC().Format(time.RFC3339)
+    return append(versions, v), failures
+}
+
+// stageManifest extracts the package.json of an npm tarball to a staging
+// directory of its own, as the npm upload reads it from a file
+func (d *detector) stageManifest(tarball string) (string, error) {
+    if d.staging == "" {
+        staging, err := run.TempDir("detect")
+        if err != nil {
+            return "", err
+        }
+        d.staging = staging
+    }
+    dir, err := os.MkdirTemp(d.staging, "npm-*")
+    if err != nil {
+        return "", err
+    }
+    manifest, err := api.ExtractNPMManifest(tarball, dir)
+    if err != nil {
+        os.RemoveAll(dir)
+        return "", err
+    }
+    return manifest, nil
+}
+
+// mavenFiles returns pom and the files in dir it describes: those named
+// after it, like app-1.0-sources.jar for app-1.0.pom, or for a pom.xml,
+// those whose name contains its version. claimed keeps a file with one POM
+func mavenFiles(dir, pom string, files []string, claimed map[string]bool) []string {
+    stem := strings.TrimSuffix(pom, ".pom")
+    if pom == "pom.xml" {
+        stem = ""
+        if _, version, err := api.ReadCoordinates(string(pkg.PackageTypeMaven), filepath.Join(dir, pom)); err == nil {
+            stem = "-" + version
+        }
+    }
+
+    selected := []string{pom}
+    for _, name := range files {
+        if name == pom || claimed[name] || strings.HasSuffix(name, ".pom") || name == "pom.xml" {
+            continue
+        }
+        match := strings.HasPrefix(name, stem+".") || strings.HasPrefix(name, stem+"-")
+        if pom == "pom.xml" {
+            match = stem != "" && (strings.Contains(name, stem+".") || strings.Contains(name, stem+"-"))
+        }
+        if match {
+            claimed[name] = true
+            selected = append(selected, name)
+        }
+    }
+    return selected
+}
+
+// npmTarball picks the tarball a package.json in dir goes with: the one
+// named after its version, or the only one
+func npmTarball(dir string, tarballs []string) string {
+    _, version, err := api.ReadCoordinates(string(pkg.PackageTypeNpm), filepath.Join(dir, "package.json"))
+    if err != nil {
+        return ""
+    }
+    for _, tarball := range tarballs {
+        if strings.HasSuffix(tarball, "-"+version+".tgz") {
+            return tarball
+        }
+    }
+    if len(tarballs) == 1 {
+        return tarballs[0]
+    }
+    return ""
+}
+
+func remove(list []string, item string) []string {
+    var kept []string
+    for _, entry := range list {
+        if entry != item {
+            kept = append(kept, entry)
+        }
+    }
+    return kept
+}
+
+// detectOCILayout returns a version for every tagged image in the OCI
+// layout dir. A multi-platform image is imported as its linux/amd64
+// manifest, or its first one, as the container upload builds a single
+// platform image. The package is named by the image name annotation, or
+// after dir without one
+func detectOCILayout(dir string) ([]Version, []Result) {
+    var versions []Version
+    var failures []Result
+    fail := func(name, version, detail string) {
+        failures = append(failures, Result{
+            PackageType: string(pkg.PackageTypeContainer),
+            Package:     name,
+            Version:     version,
+            Status:      StatusFailed,
+            Detail:      "not identified: " + detail,
+        })
+    }
+
+    var index struct {
+        Manifests []ociDescriptor `json:"manifests"`
+    }
+    if err := readOCIJSON(filepath.Join(dir, "index.json"), &index); err != nil {
+        fail(dir, "", err.Error())
+        return nil, failures
+    }
+
+    for _, descriptor := range index.Manifests {
+        name, tag := ociReference(descriptor.Annotations)
+        if name == "" {
+            name = filepath.Base(dir)
+        }
+        if tag == "" {
+            fail(name, descriptor.Digest, "the image has no tag annotation")
+            continue
+        }
+
+        manifest := descriptor
+        if ociIndexMediaTypes[descriptor.MediaType] {
+            var nested struct {
+                Manifests []ociDescriptor `json:"manifests"`
+            }
+            if err := readOCIJSON(ociBlob(dir, descriptor.Digest), &nested); err != nil || len(nested.Manifests) == 0 {
+                fail(name, tag, fmt.Sprintf("unreadable image index %s", descriptor.Digest))
+                continue
+            }
+            manifest = nested.Manifests[0]
+            for _, m := range nested.Manifests {
+                if m.Platform != nil && m.Platform.OS == "linux" && m.Platform.Architecture == "amd64" {
+                    manifest = m
+                    break
+                }
+            }
+        }
+
+        var image struct {
+            Config ociDescriptor   `json:"config"`
+            Layers []ociDescriptor `json:"layers"`
+        }
+        if err := readOCIJSON(ociBlob(dir, manifest.Digest), &image); err != nil {
+            fail(name, tag, err.Error())
+            continue
+        }
+        var config struct {
+            Created string `json:"created"`
+        }
+        readOCIJSON(ociBlob(dir, image.Config.Digest), &config)
+
+        v := Version{
+            Dir:      dir,
+            Detected: true,
+            Package:  api.Package{Name: name, PackageType: string(pkg.PackageTypeContainer)},
+            Version: api.Version{
+                ID:        manifest.Digest,
+                Name:      tag,
+                CreatedAt: config.Created,
+                Metadata:  map[string]interface{}{"created": config.Created},
+            },
+        }
+        for _, layer := range image.Layers {
+            file := ociBlob(dir, layer.Digest)
+            v.Files = append(v.Files, file)
+            v.Version.Files = append(v.Version.Files, api.File{Name: filepath.ToSlash(strings.TrimPrefix(file, dir+string(filepath.Separator))), Size: layer.Size})
+        }
+        versions = append(versions, v)
+    }
+    return versions, failures
+}
+
+// ociReference reads the image name and tag from a manifest's annotations.
+// The ref name is a tag, or a full reference like ghcr.io/org/app:1.0
+func ociReference(annotations map[string]string) (string, string) {
+    image := annotations["io.containerd.image.name"]
+    ref := annotations["org.opencontainers.image.ref.name"]
+    if ref == "" {
+        ref = image
+    }
+    name, tag := image, ref
+    if i := strings.LastIndex(ref, ":"); i >= 0 && !strings.Contains(ref[i:], "/") {
+        name, tag = ref[:i], ref[i+1:]
+    }
+    if i := strings.LastIndex(name, ":"); i >= 0 && !strings.Contains(name[i:], "/") {
+        name = name[:i]
+    }
+    if name == "" {
+        return "", tag
+    }
+    return path.Base(name), tag
+}
+
+// ociBlob is where an OCI layout keeps the blob with digest
+func ociBlob(dir, digest string) string {
+    algorithm, hex, _ := strings.Cut(digest, ":")
+    return filepath.Join(dir, "blobs", algorithm, hex)
+}
+
+func readOCIJSON(file string, v interface{}) error {
+    data, err := os.ReadFile(file)
+    if err != nil {
+        return err
+    }
+    if err := json.Unmarshal(data, v); err != nil {
+        return fmt.Errorf("failed to parse %s: %v", file, err)
+    }
+    return nil
+}
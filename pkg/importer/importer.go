@@ -0,0 +1,428 @@
+package importer
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "io/fs"
+    "os"
+    "path/filepath"
+    "sort"
+    "strings"
+    "time"
+
+    "github.com/cvega/gh-migrate-packages/pkg/api"
+    "github.com/cvega/gh-migrate-packages/pkg/checkpoint"
+    "github.com/cvega/gh-migrate-packages/pkg/csvfile"
+    "github.com/cvega/gh-migrate-packages/pkg/extension"
+    "github.com/cvega/gh-migrate-packages/pkg/filter"
+    "github.com/cvega/gh-migrate-packages/pkg/run"
+    "github.com/pterm/pterm"
+    "github.com/spf13/viper"
+)
+
+// metadataFile is the file export writes next to every downloaded version
+const metadataFile = "metadata.json"
+
+// Import statuses of a version in the import report
+const (
+    StatusImported = "imported"
+    StatusSkipped  = "skipped" // imported by an earlier run
+    StatusFailed   = "failed"
+)
+
+// Version is one exported version found on disk, with its files
+type Version struct {
+    Dir      string
+    Package  api.Package
+    Version  api.Version
+    Files    []string
+    Detected bool // identified by its files, it had no metadata.json
+}
+
+// Result is the outcome of importing one version
+type Result struct {
+    PackageType string
+    Package     string
+    Version     string
+    Status      string
+    Detail      string
+}
+
+// exportedMetadata is the metadata.json layout export writes
+type exportedMetadata struct {
+    Package struct {
+        ID         string          `json:"id"`
+        Name       string          `json:"name"`
+        Type       string          `json:"type"`
+        Visibility string          `json:"visibility"`
+        Repository *api.Repository `json:"repository"`
+        Statistics *api.Statistics `json:"statistics"`
+        Owner      api.Owner       `json:"owner"`
+    } `json:"package"`
+    Version struct {
+        ID        string                 `json:"id"`
+        Name      string                 `json:"name"`
+        CreatedAt string                 `json:"created_at"`
+        UpdatedAt string                 `json:"updated_at"`
+        Files     []api.File             `json:"files"`
+        Metadata  map[string]interface{} `json:"metadata"`
+    } `json:"version"`
+}
+
+// Scan walks an export's download directory, merged or not, and returns
+// every version with a metadata.json, oldest first within each package so
+// the target ends with the same latest version. Versions missing a file
+// export listed are returned in incomplete, since export failed on them.
+// Directories without a metadata.json, as other tools write them, have
+// their versions detected from the files in them
+func Scan(root, packageType string) (versions []Version, incomplete []Result, err error) {
+    // Directories export's metadata.json files describe, with everything
+    // under them
+    exported := make(map[string]bool)
+    detection := &detector{}
+    err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+        if err != nil {
+            return err
+        }
+        if d.IsDir() {
+            if exported[filepath.Dir(path)] {
+                exported[path] = true
+                return nil
+            }
+            if _, err := os.Stat(filepath.Join(path, metadataFile)); err == nil {
+                exported[path] = true
+                return nil
+            }
+
+            detected, failures, layout, err := detection.detect(path)
+            if err != nil {
+                return err
+            }
+            for _, v := range detected {
+                if packageType != "" && v.Package.PackageType != packageType {
+                    continue
+                }
+                if missing := missingFiles(v); len(missing) > 0 {
+                    incomplete = append(incomplete, Result{
+                        PackageType: v.Package.PackageType,
+                        Package:     v.Package.Name,
+                        Version:     v.Version.Name,
+                        Status:      StatusFailed,
+                        Detail:      "missing " + strings.Join(missing, ", "),
+                    })
+                    continue
+                }
+                versions = append(versions, v)
+            }
+            for _, r := range failures {
+                if packageType == "" || r.PackageType == packageType {
+                    incomplete = append(incomplete, r)
+                }
+            }
+            if layout {
+                return filepath.SkipDir
+            }
+            return nil
+        }
+        if d.Name() != metadataFile {
+            return nil
+        }
+
+        version, err := readVersion(filepath.Dir(path))
+        if err != nil {
+            return err
+        }
+        if packageType != "" && version.Package.PackageType != packageType {
+            return nil
+        }
+        if missing := missingFiles(version); len(missing) > 0 {
+            incomplete = append(incomplete, Result{
+                PackageType: version.Package.PackageType,
+                Package:     version.Package.Name,
+                Version:     version.Version.Name,
+                Status:      StatusFailed,
+                Detail:      "not fully exported, missing " + strings.Join(missing, ", "),
+            })
+            return nil
+        }
+        versions = append(versions, version)
+        return nil
+    })
+    if err != nil {
+        return nil, nil, fmt.Errorf("failed to scan %s: %v", root, err)
+    }
+
+    sort.SliceStable(versions, func(i, j int) bool {
+        a, b := versions[i], versions[j]
+        if a.Package.PackageType != b.Package.PackageType {
+            return a.Package.PackageType < b.Package.PackageType
+        }
+        if a.Package.Name != b.Package.Name {
+            return a.Package.Name < b.Package.Name
+        }
+        return a.Version.CreatedAt < b.Version.CreatedAt
+    })
+    return versions, incomplete, nil
+}
+
+// readVersion loads the metadata.json in dir
+func readVersion(dir string) (Version, error) {
+    data, err := os.ReadFile(filepath.Join(dir, metadataFile))
+    if err != nil {
+        return Version{}, err
+    }
+    var metadata exportedMetadata
+    if err := json.Unmarshal(data, &metadata); err != nil {
+        return Version{}, fmt.Errorf("failed to parse %s: %v", filepath.Join(dir, metadataFile), err)
+    }
+    if metadata.Package.Name == "" || metadata.Package.Type == "" || metadata.Version.Name == "" {
+        return Version{}, fmt.Errorf("%s has no package name, type or version", filepath.Join(dir, metadataFile))
+    }
+
+    v := Version{
+        Dir: dir,
+        Package: api.Package{
+            ID:          metadata.Package.ID,
+            Name:        metadata.Package.Name,
+            PackageType: metadata.Package.Type,
+            Visibility:  metadata.Package.Visibility,
+            Owner:       metadata.Package.Owner,
+            Repository:  metadata.Package.Repository,
+            Statistics:  metadata.Package.Statistics,
+        },
+        Version: api.Version{
+            ID:        metadata.Version.ID,
+            Name:      metadata.Version.Name,
+            Metadata:  metadata.Version.Metadata,
+            Files:     metadata.Version.Files,
+            CreatedAt: metadata.Version.CreatedAt,
+            UpdatedAt: metadata.Version.UpdatedAt,
+        },
+    }
+    for _, file := range v.Version.Files {
+        v.Files = append(v.Files, filepath.Join(dir, filepath.FromSlash(file.Name)))
+    }
+    return v, nil
+}
+
+// missingFiles lists the files of v that aren't on disk with their size
+func missingFiles(v Version) []string {
+    var missing []string
+    for i, file := range v.Version.Files {
+        info, err := os.Stat(v.Files[i])
+        if err != nil || (file.Size > 0 && info.Size() != int64(file.Size)) {
+            missing = append(missing, file.Name)
+        }
+    }
+    return missing
+}
+
+// ImportFromConfig uploads an export's download directory to the target
+// organization, for migrations whose export and import can't share a
+// network. Versions a previous import finished are skipped
+func ImportFromConfig() error {
+    pterm.Info.Printf("Import run %s\n", run.ID())
+
+    if err := extension.RegisterSpecs(viper.GetString("HANDLERS")); err != nil {
+        return err
+    }
+
+    sourceDir := viper.GetString("SOURCE_DIR")
+    targetOrg := viper.GetString("TARGET_ORGANIZATION")
+    versions, incomplete, err := Scan(sourceDir, viper.GetString("PACKAGE_TYPE"))
+    if err != nil {
+        return err
+    }
+    if len(versions) == 0 && len(incomplete) == 0 {
+        return fmt.Errorf("no exported versions found in %s", sourceDir)
+    }
+    pterm.Info.Printf("Found %d exported versions in %s\n", len(versions)+len(incomplete), sourceDir)
+    if detected := countDetected(versions); detected > 0 {
+        pterm.Info.Printf("Detected the package type of %d versions without a metadata.json from their files\n", detected)
+    }
+
+    target := api.NewAPI(viper.GetString("TARGET_TOKEN"), "")
+    target.SetTokens(strings.Split(viper.GetString("TARGET_TOKENS"), ","))
+    registries, err := api.ParseRegistries(viper.GetString("TARGET_REGISTRY_URLS"))
+    if err != nil {
+        return fmt.Errorf("invalid target registry url: %v", err)
+    }
+    target.SetRegistries(registries)
+    targetTokens, err := api.ParseRegistryTokens(viper.GetString("TARGET_REGISTRY_TOKENS"))
+    if err != nil {
+        return fmt.Errorf("invalid target registry token: %v", err)
+    }
+    target.SetRegistryTokens(targetTokens)
+    sidecars, err := api.ParseSidecars(viper.GetString("SIDECARS"))
+    if err != nil {
+        return fmt.Errorf("invalid sidecar rule: %v", err)
+    }
+    target.SetSidecars(sidecars)
+    if viper.GetBool("COMPRESS_UPLOADS") {
+        target.SetCompression()
+    }
+    if s := viper.GetString("CARGO_MAX_CRATE_SIZE"); s != "" {
+        size, err := filter.ParseSize(s)
+        if err != nil {
+            return fmt.Errorf("invalid --cargo-max-crate-size: %v", err)
+        }
+        target.SetCargoMaxCrateSize(size)
+    }
+    uploads := api.NewUploadManager(target)
+
+    state, err := checkpoint.Open(viper.GetString("CHECKPOINT"))
+    if err != nil {
+        return err
+    }
+    defer state.Close()
+    if err := state.Claim(checkpoint.Scope{Target: targetOrg}); err != nil {
+        return err
+    }
+
+    results := append([]Result(nil), incomplete...)
+    // An interrupt stops the import between versions, the checkpoint picks
+    // up from there
+    ctx := run.StopOnSignal()
+    progressbar, _ := pterm.DefaultProgressbar.WithTotal(len(versions)).WithTitle("Importing package versions").Start()
+    for _, v := range versions {
+        if ctx.Err() != nil {
+            pterm.Warning.Printf("Import stopped before %s %s: %v\n", v.Package.Name, v.Version.Name, ctx.Err())
+            break
+        }
+        progressbar.UpdateTitle(fmt.Sprintf("Importing %s %s", v.Package.Name, v.Version.Name))
+        results = append(results, importVersion(ctx, uploads, state, targetOrg, v))
+        progressbar.Increment()
+    }
+    progressbar.Stop()
+
+    imported, skipped, failed := 0, 0, 0
+    for _, r := range results {
+        switch r.Status {
+        case StatusImported:
+            imported++
+        case StatusSkipped:
+            skipped++
+        default:
+            failed++
+        }
+    }
+    reportFailures(results)
+
+    if report := run.ReportPath(viper.GetString("IMPORT_REPORT")); report != "" {
+        if err := writeResults(report, results); err != nil {
+            return fmt.Errorf("failed to write import report: %v", err)
+        }
+        pterm.Info.Printf("Import results written to %s\n", report)
+    }
+
+    pterm.Info.Printf("Import Summary:\n")
+    pterm.Info.Printf("- Imported: %d\n", imported)
+    pterm.Info.Printf("- Skipped (imported before): %d\n", skipped)
+    pterm.Info.Printf("- Failed: %d\n", failed)
+    if failed > 0 {
+        return fmt.Errorf("%d of %d versions failed to import", failed, len(results))
+    }
+    pterm.Success.Printf("Imported %s into %s\n", sourceDir, targetOrg)
+    return nil
+}
+
+// importVersion uploads v unless the checkpoint has it, recording it once
+// every file is in
+func importVersion(ctx context.Context, uploads *api.UploadManager, state *checkpoint.Checkpoint, targetOrg string, v Version) Result {
+    result := Result{
+        PackageType: v.Package.PackageType,
+        Package:     v.Package.Name,
+        Version:     v.Version.Name,
+    }
+    if state.Done(v.Package.PackageType, v.Package.Name, v.Version.ID) {
+        result.Status = StatusSkipped
+        return result
+    }
+
+    var size int64
+    for _, file := range v.Version.Files {
+        size += int64(file.Size)
+    }
+    entry := checkpoint.Entry{
+        PackageType: v.Package.PackageType,
+        PackageName: v.Package.Name,
+        VersionID:   v.Version.ID,
+        Version:     v.Version.Name,
+        Files:       len(v.Files),
+        Size:        size,
+    }
+
+    err := uploads.Upload(ctx, api.UploadOptions{
+        Organization: targetOrg,
+        PackageName:  v.Package.Name,
+        Version:      v.Version.Name,
+        PackageType:  v.Package.PackageType,
+        Metadata:     v.Version.Metadata,
+        Files:        v.Files,
+        Visibility:   v.Package.Visibility,
+    })
+    if err != nil {
+        result.Status, result.Detail = StatusFailed, err.Error()
+        if err := state.MarkFailed(entry, err); err != nil {
+            pterm.Warning.Printf("Failed to record %s %s in the checkpoint: %v\n", v.Package.Name, v.Version.Name, err)
+        }
+        return result
+    }
+
+    entry.CompletedAt = time.Now().UTC()
+    err = state.MarkDone(entry)
+    if err != nil {
+        // Imported all the same, only a rerun would upload it again
+        pterm.Warning.Printf("Failed to record %s %s in the checkpoint: %v\n", v.Package.Name, v.Version.Name, err)
+    }
+    result.Status = StatusImported
+    return result
+}
+
+// countDetected counts the versions identified by their files
+func countDetected(versions []Version) int {
+    n := 0
+    for _, v := range versions {
+        if v.Detected {
+            n++
+        }
+    }
+    return n
+}
+
+// reportFailures prints the versions that failed to import
+func reportFailures(results []Result) {
+    table := pterm.TableData{
+        {"Type", "Package", "Version", "Detail"},
+    }
+    for _, r := range results {
+        if r.Status == StatusFailed {
+            table = append(table, []string{r.PackageType, r.Package, r.Version, r.Detail})
+        }
+    }
+    if len(table) > 1 {
+        pterm.DefaultTable.WithHasHeader().WithData(table).Render()
+    }
+}
+
+func writeResults(filename string, results []Result) error {
+    file, err := os.Create(filename)
+    if err != nil {
+        return err
+    }
+    defer file.Close()
+
+    writer := csvfile.NewWriter(file)
+    defer writer.Flush()
+
+    if err := writer.Write([]string{"Type", "Package", "Version", "Status", "Detail"}); err != nil {
+        return err
+    }
+    for _, r := range results {
+        if err := writer.Write([]string{r.PackageType, r.Package, r.Version, r.Status, r.Detail}); err != nil {
+            return err
+        }
+    }
+    return nil
+}
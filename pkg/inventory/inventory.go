@@ -0,0 +1,217 @@
+package inventory
+
+import (
+    "fmt"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/cvega/gh-migrate-packages/pkg/api"
+    "github.com/cvega/gh-migrate-packages/pkg/filter"
+    "github.com/cvega/gh-migrate-packages/pkg/package"
+    "github.com/pterm/pterm"
+    "github.com/spf13/viper"
+)
+
+// TypeTotals adds up the packages of one type
+type TypeTotals struct {
+    PackageType string
+    Packages    int
+    Empty       int // listed without versions
+    Versions    int
+    Files       int
+    Size        int64
+    Downloads   int
+}
+
+// PackageTotals adds up the versions of one package
+type PackageTotals struct {
+    PackageType   string
+    Name          string
+    Versions      int
+    Size          int64
+    Downloads     int
+    LastPublished time.Time // zero when no version says when it was created
+}
+
+// Summary is the aggregate statistics of an organization's packages
+type Summary struct {
+    Types   []TypeTotals
+    Total   TypeTotals
+    Largest []PackageTotals // biggest first
+    Stale   []PackageTotals // longest unpublished first
+}
+
+// Summarize adds up packages by type and finds the top largest packages,
+// and those without a new version since staleAfter before now. GitHub only
+// reports downloads as a total, so a stale package is one nobody published
+// to in that time, whatever its downloads
+func Summarize(packages []api.Package, top int, staleAfter time.Duration, now time.Time) Summary {
+    var summary Summary
+    byType := make(map[string]*TypeTotals)
+    var all []PackageTotals
+    for _, p := range packages {
+        totals, ok := byType[p.PackageType]
+        if !ok {
+            totals = &TypeTotals{PackageType: p.PackageType}
+            byType[p.PackageType] = totals
+        }
+
+        pt := PackageTotals{PackageType: p.PackageType, Name: p.Name, Versions: len(p.Versions)}
+        if p.Statistics != nil {
+            pt.Downloads = p.Statistics.DownloadsCount
+        }
+        for _, v := range p.Versions {
+            totals.Files += len(v.Files)
+            for _, file := range v.Files {
+                pt.Size += int64(file.Size)
+            }
+            if created, err := time.Parse(time.RFC3339, v.CreatedAt); err == nil && created.After(pt.LastPublished) {
+                pt.LastPublished = created
+            }
+        }
+
+        totals.Packages++
+        if p.IsEmpty() {
+            totals.Empty++
+        }
+        totals.Versions += pt.Versions
+        totals.Size += pt.Size
+        totals.Downloads += pt.Downloads
+        all = append(all, pt)
+    }
+
+    for _, totals := range byType {
+        summary.Types = append(summary.Types, *totals)
+        summary.Total.Packages += totals.Packages
+        summary.Total.Empty += totals.Empty
+        summary.Total.Versions += totals.Versions
+        summary.Total.Files += totals.Files
+        summary.Total.Size += totals.Size
+        summary.Total.Downloads += totals.Downloads
+    }
+    sort.Slice(summary.Types, func(i, j int) bool {
+        return summary.Types[i].PackageType < summary.Types[j].PackageType
+    })
+
+    sort.SliceStable(all, func(i, j int) bool {
+        return all[i].Size > all[j].Size
+    })
+    for _, pt := range all {
+        if len(summary.Largest) == top {
+            break
+        }
+        if pt.Size > 0 {
+            summary.Largest = append(summary.Largest, pt)
+        }
+    }
+
+    cutoff := now.Add(-staleAfter)
+    for _, pt := range all {
+        if !pt.LastPublished.IsZero() && pt.LastPublished.Before(cutoff) {
+            summary.Stale = append(summary.Stale, pt)
+        }
+    }
+    sort.SliceStable(summary.Stale, func(i, j int) bool {
+        return summary.Stale[i].LastPublished.Before(summary.Stale[j].LastPublished)
+    })
+    return summary
+}
+
+// InventoryFromConfig lists an organization's packages, of one type or of
+// every type GitHub Packages hosts, and prints their aggregate statistics.
+// Nothing is downloaded or changed
+func InventoryFromConfig() error {
+    org := viper.GetString("SOURCE_ORGANIZATION")
+    top := viper.GetInt("INVENTORY_TOP")
+    staleDays := viper.GetInt("STALE_DAYS")
+
+    client := api.NewAPI(viper.GetString("SOURCE_TOKEN"), viper.GetString("SOURCE_HOSTNAME"))
+    client.SetTokens(strings.Split(viper.GetString("SOURCE_TOKENS"), ","))
+    registries, err := api.ParseRegistries(viper.GetString("SOURCE_REGISTRY_URLS"))
+    if err != nil {
+        return fmt.Errorf("invalid source registry url: %v", err)
+    }
+    client.SetRegistries(registries)
+    sourceTokens, err := api.ParseRegistryTokens(viper.GetString("SOURCE_REGISTRY_TOKENS"))
+    if err != nil {
+        return fmt.Errorf("invalid source registry token: %v", err)
+    }
+    client.SetRegistryTokens(sourceTokens)
+
+    packageTypes := []string{viper.GetString("PACKAGE_TYPE")}
+    if packageTypes[0] == "" {
+        packageTypes = nil
+        for _, packageType := range pkg.HostedTypes {
+            packageTypes = append(packageTypes, string(packageType))
+        }
+    }
+
+    var packages []api.Package
+    for _, packageType := range packageTypes {
+        spinner, _ := pterm.DefaultSpinner.Start(fmt.Sprintf("Fetching %s packages from %s...", packageType, org))
+        found, err := client.GetOrganizationPackages(org, packageType)
+        if err != nil {
+            spinner.Fail(err.Error())
+            return err
+        }
+        spinner.Success(fmt.Sprintf("Found %d %s packages in %s", len(found), packageType, org))
+        packages = append(packages, found...)
+    }
+
+    summary := Summarize(packages, top, time.Duration(staleDays)*24*time.Hour, time.Now())
+    printSummary(org, summary, top, staleDays)
+    return nil
+}
+
+func printSummary(org string, summary Summary, top, staleDays int) {
+    pterm.DefaultSection.Printf("Packages in %s by type", org)
+    table := pterm.TableData{{"Type", "Packages", "Empty", "Versions", "Files", "Size", "Downloads"}}
+    for _, t := range append(summary.Types, summary.Total) {
+        if t.PackageType == "" {
+            t.PackageType = "total"
+        }
+        table = append(table, []string{
+            t.PackageType,
+            strconv.Itoa(t.Packages),
+            strconv.Itoa(t.Empty),
+            strconv.Itoa(t.Versions),
+            strconv.Itoa(t.Files),
+            filter.FormatSize(t.Size),
+            strconv.Itoa(t.Downloads),
+        })
+    }
+    pterm.DefaultTable.WithHasHeader().WithData(table).Render()
+
+    if len(summary.Largest) > 0 {
+        pterm.DefaultSection.Println("Largest packages")
+        table = pterm.TableData{{"Type", "Package", "Versions", "Size", "Downloads"}}
+        for _, p := range summary.Largest {
+            table = append(table, []string{p.PackageType, p.Name, strconv.Itoa(p.Versions), filter.FormatSize(p.Size), strconv.Itoa(p.Downloads)})
+        }
+        pterm.DefaultTable.WithHasHeader().WithData(table).Render()
+    }
+
+    pterm.DefaultSection.Printf("Stale packages, nothing published in %d days", staleDays)
+    if len(summary.Stale) == 0 {
+        pterm.Info.Println("No stale packages")
+        return
+    }
+    var size int64
+    for _, p := range summary.Stale {
+        size += p.Size
+    }
+    table = pterm.TableData{{"Type", "Package", "Last published", "Versions", "Size", "Downloads"}}
+    for i, p := range summary.Stale {
+        if i == top {
+            break
+        }
+        table = append(table, []string{p.PackageType, p.Name, p.LastPublished.Format("2006-01-02"), strconv.Itoa(p.Versions), filter.FormatSize(p.Size), strconv.Itoa(p.Downloads)})
+    }
+    pterm.DefaultTable.WithHasHeader().WithData(table).Render()
+    pterm.Info.Printf("%d stale packages hold %s\n", len(summary.Stale), filter.FormatSize(size))
+    if len(summary.Stale) > top {
+        pterm.Info.Printf("Only the %d published longest ago are listed, raise --top to see more\n", top)
+    }
+}
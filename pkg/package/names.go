@@ -0,0 +1,172 @@
+package pkg
+
+import (
+    "fmt"
+    "net/url"
+    "strings"
+    "unicode"
+)
+
+// nameRule describes what a target registry accepts in a package name
+type nameRule struct {
+    lowercase bool
+    maxLength int
+    allowed   func(r rune) bool
+}
+
+var nameRules = map[PackageType]nameRule{
+    PackageTypeContainer: {lowercase: true, maxLength: 255, allowed: allowRunes("._-/")},
+    PackageTypeNpm:       {lowercase: true, maxLength: 214, allowed: allowRunes("._-~@/")},
+    PackageTypeRubyGems:  {lowercase: true, maxLength: 100, allowed: allowRunes("._-")},
+    PackageTypeNuGet:     {maxLength: 100, allowed: allowRunes("._-")},
+    PackageTypeMaven:     {maxLength: 255, allowed: allowRunes("._-:")},
+}
+
+func allowRunes(extra string) func(r rune) bool {
+    return func(r rune) bool {
+        return r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune(extra, r))
+    }
+}
+
+// NormalizeName rewrites name to satisfy the target registry's constraints
+// for packageType and describes every change it made; a name that needs no
+// changes is returned as is with no fixes
+func NormalizeName(packageType PackageType, name string) (string, []string) {
+    rule, ok := nameRules[packageType]
+    if !ok {
+        return name, nil
+    }
+
+    var fixes []string
+    normalized := strings.TrimSpace(name)
+    if normalized != name {
+        fixes = append(fixes, "trimmed whitespace")
+    }
+
+    // Accented Latin letters keep their base letter instead of becoming '-'
+    if folded := foldAccents(normalized); folded != normalized {
+        normalized = folded
+        fixes = append(fixes, "removed accents")
+    }
+
+    if rule.lowercase && strings.ToLower(normalized) != normalized {
+        normalized = strings.ToLower(normalized)
+        fixes = append(fixes, "lowercased")
+    }
+
+    var b strings.Builder
+    replaced := false
+    for _, r := range normalized {
+        if rule.allowed(r) {
+            b.WriteRune(r)
+            continue
+        }
+        replaced = true
+        b.WriteRune('-')
+    }
+    if replaced {
+        normalized = b.String()
+        for strings.Contains(normalized, "--") {
+            normalized = strings.ReplaceAll(normalized, "--", "-")
+        }
+        fixes = append(fixes, "replaced unsupported characters with '-'")
+    }
+
+    // Scopes and path segments can't start or end with a separator
+    if packageType == PackageTypeContainer || packageType == PackageTypeNpm {
+        segments := strings.Split(normalized, "/")
+        for i, seg := range segments {
+            trimmed := strings.Trim(seg, "._-")
+            if strings.HasPrefix(seg, "@") {
+                trimmed = "@" + strings.Trim(seg[1:], "._-")
+            }
+            if trimmed != seg {
+                segments[i] = trimmed
+                fixes = appendOnce(fixes, "trimmed leading or trailing separators")
+            }
+        }
+        normalized = strings.Join(segments, "/")
+    }
+
+    if rule.maxLength > 0 && len(normalized) > rule.maxLength {
+        normalized = normalized[:rule.maxLength]
+        fixes = append(fixes, fmt.Sprintf("truncated to %d characters", rule.maxLength))
+    }
+
+    return normalized, fixes
+}
+
+// ValidateName reports a target registry constraint name doesn't satisfy
+func ValidateName(packageType PackageType, name string) error {
+    normalized, fixes := NormalizeName(packageType, name)
+    if len(fixes) == 0 {
+        return nil
+    }
+    return &ValidationError{
+        PackageName: name,
+        PackageType: packageType,
+        Message:     fmt.Sprintf("name not accepted by target registry (%s), would be normalized to '%s'", strings.Join(fixes, ", "), normalized),
+    }
+}
+
+// EscapeNpmName escapes a possibly scoped npm name for a registry URL path,
+// e.g. @scope/name becomes @scope%2fname
+func EscapeNpmName(name string) string {
+    if strings.HasPrefix(name, "@") {
+        if i := strings.Index(name, "/"); i >= 0 {
+            return "@" + url.PathEscape(name[1:i]) + "%2f" + url.PathEscape(name[i+1:])
+        }
+    }
+    return url.PathEscape(name)
+}
+
+// Latin-1 and Latin Extended-A letters by base letter
+var accentFolds = map[rune]string{
+    'a': "àáâãäåāăą", 'A': "ÀÁÂÃÄÅĀĂĄ",
+    'c': "çćĉċč", 'C': "ÇĆĈĊČ",
+    'd': "ďđ", 'D': "ĎĐ",
+    'e': "èéêëēĕėęě", 'E': "ÈÉÊËĒĔĖĘĚ",
+    'g': "ĝğġģ", 'G': "ĜĞĠĢ",
+    'h': "ĥħ", 'H': "ĤĦ",
+    'i': "ìíîïĩīĭįı", 'I': "ÌÍÎÏĨĪĬĮİ",
+    'j': "ĵ", 'J': "Ĵ",
+    'k': "ķ", 'K': "Ķ",
+    'l': "ĺļľŀł", 'L': "ĹĻĽĿŁ",
+    'n': "ñńņňŉ", 'N': "ÑŃŅŇ",
+    'o': "òóôõöøōŏő", 'O': "ÒÓÔÕÖØŌŎŐ",
+    'r': "ŕŗř", 'R': "ŔŖŘ",
+    's': "śŝşšß", 'S': "ŚŜŞŠ",
+    't': "ţťŧ", 'T': "ŢŤŦ",
+    'u': "ùúûüũūŭůűų", 'U': "ÙÚÛÜŨŪŬŮŰŲ",
+    'w': "ŵ", 'W': "Ŵ",
+    'y': "ýÿŷ", 'Y': "ÝŶŸ",
+    'z': "źżž", 'Z': "ŹŻŽ",
+}
+
+var accentTable = func() map[rune]rune {
+    table := make(map[rune]rune)
+    for base, accented := range accentFolds {
+        for _, r := range accented {
+            table[r] = base
+        }
+    }
+    return table
+}()
+
+func foldAccents(s string) string {
+    return strings.Map(func(r rune) rune {
+        if base, ok := accentTable[r]; ok {
+            return base
+        }
+        return r
+    }, s)
+}
+
+func appendOnce(list []string, s string) []string {
+    for _, existing := range list {
+        if existing == s {
+            return list
+        }
+    }
+    return append(list, s)
+}
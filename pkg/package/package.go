@@ -3,7 +3,9 @@ package pkg
 
 import (
     "fmt"
+    "regexp"
     "strings"
+    "sync"
 )
 
 // Core domain models
@@ -49,6 +51,32 @@ type Statistics struct {
     DownloadsCount int
 }
 
+// Package statuses reported in inventories and migration summaries
+const (
+    PackageStatusActive = "active"
+    PackageStatusEmpty  = "empty"
+)
+
+// IsEmpty reports whether a package is listed without any versions, which
+// is how registries keep showing a package whose versions were all deleted
+func (p *Package) IsEmpty() bool {
+    return len(p.Versions) == 0
+}
+
+// IsOrphaned reports whether a package has no linked repository, so no
+// repository's owners answer for it
+func (p *Package) IsOrphaned() bool {
+    return p.Repository == nil || (p.Repository.Name == "" && p.Repository.URL == "")
+}
+
+// Status classifies a package as active or empty
+func (p *Package) Status() string {
+    if p.IsEmpty() {
+        return PackageStatusEmpty
+    }
+    return PackageStatusActive
+}
+
 // Package type definitions
 type PackageType string
 
@@ -58,8 +86,28 @@ const (
     PackageTypeMaven    PackageType = "maven"
     PackageTypeNuGet    PackageType = "nuget"
     PackageTypeRubyGems PackageType = "rubygems"
+    PackageTypeCargo    PackageType = "cargo"
+    PackageTypeGo       PackageType = "go"
+    PackageTypeDeb      PackageType = "deb"
+    PackageTypeRPM      PackageType = "rpm"
+    PackageTypeComposer PackageType = "composer"
+    PackageTypeConda    PackageType = "conda"
+    PackageTypeTerraform PackageType = "terraform"
+    PackageTypeSwift    PackageType = "swift"
+    PackageTypeCocoaPods PackageType = "cocoapods"
+    PackageTypeGeneric  PackageType = "generic"
 )
 
+// HostedTypes are the package types GitHub Packages hosts and lists itself,
+// the others live in a registry of their own
+var HostedTypes = []PackageType{
+    PackageTypeContainer,
+    PackageTypeNpm,
+    PackageTypeMaven,
+    PackageTypeNuGet,
+    PackageTypeRubyGems,
+}
+
 // Validation types and interfaces
 type ValidationError struct {
     PackageName string
@@ -324,6 +372,524 @@ func (v *RubyGemsValidator) GetRequiredFiles() []string {
     return []string{".gem", ".gemspec"}
 }
 
+// Largest crate crates.io accepts; other registries may set their own
+const DefaultCargoMaxFileSize int64 = 10 * 1024 * 1024
+
+type CargoValidator struct {
+    MaxFileSize int64 // DefaultCargoMaxFileSize when zero
+}
+
+func (v *CargoValidator) ValidatePackage(pkg *Package) error {
+    // Crate names are ASCII alphanumerics, '-' and '_', starting with a letter
+    if len(pkg.Name) == 0 || len(pkg.Name) > 64 {
+        return &ValidationError{
+            PackageName: pkg.Name,
+            PackageType: PackageTypeCargo,
+            Message:    "crate name must be between 1 and 64 characters",
+        }
+    }
+
+    first := pkg.Name[0]
+    if !(first >= 'a' && first <= 'z' || first >= 'A' && first <= 'Z') {
+        return &ValidationError{
+            PackageName: pkg.Name,
+            PackageType: PackageTypeCargo,
+            Message:    "crate name must start with a letter",
+        }
+    }
+
+    for _, r := range pkg.Name {
+        if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+            return &ValidationError{
+                PackageName: pkg.Name,
+                PackageType: PackageTypeCargo,
+                Message:    "invalid crate name: can only contain alphanumeric characters, dashes, and underscores",
+            }
+        }
+    }
+
+    return nil
+}
+
+func (v *CargoValidator) ValidateVersion(ver *Version) error {
+    hasCrate := false
+    for _, file := range ver.Files {
+        if strings.HasSuffix(file.Name, ".crate") {
+            hasCrate = true
+            break
+        }
+    }
+    if !hasCrate {
+        return &ValidationError{
+            PackageType: PackageTypeCargo,
+            Message:    "missing required .crate file",
+        }
+    }
+    return nil
+}
+
+func (v *CargoValidator) GetMaxFileSize() int64 {
+    if v.MaxFileSize > 0 {
+        return v.MaxFileSize
+    }
+    return DefaultCargoMaxFileSize
+}
+
+func (v *CargoValidator) GetRequiredFiles() []string {
+    return []string{".crate"}
+}
+
+type GoValidator struct{}
+
+func (v *GoValidator) ValidatePackage(pkg *Package) error {
+    // Module paths start with a domain-like element, e.g. example.com/mod
+    first := strings.SplitN(pkg.Name, "/", 2)[0]
+    if !strings.Contains(first, ".") || strings.ContainsAny(pkg.Name, " @\\") {
+        return &ValidationError{
+            PackageName: pkg.Name,
+            PackageType: PackageTypeGo,
+            Message:    "invalid module path: must start with a domain name, e.g. example.com/module",
+        }
+    }
+    return nil
+}
+
+func (v *GoValidator) ValidateVersion(ver *Version) error {
+    // Each version is a .info/.mod/.zip triplet
+    for _, ext := range v.GetRequiredFiles() {
+        found := false
+        for _, file := range ver.Files {
+            if strings.HasSuffix(file.Name, ext) {
+                found = true
+                break
+            }
+        }
+        if !found {
+            return &ValidationError{
+                PackageType: PackageTypeGo,
+                Message:    fmt.Sprintf("missing required %s file", ext),
+            }
+        }
+    }
+    return nil
+}
+
+func (v *GoValidator) GetMaxFileSize() int64 {
+    return 500 * 1024 * 1024 // 500MB (module zip limit enforced by the go command)
+}
+
+func (v *GoValidator) GetRequiredFiles() []string {
+    return []string{".info", ".mod", ".zip"}
+}
+
+// Debian policy: lowercase alphanumerics, '+', '-', '.', at least two characters
+var debNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9+.-]+$`)
+
+type DebValidator struct{}
+
+func (v *DebValidator) ValidatePackage(pkg *Package) error {
+    if !debNamePattern.MatchString(pkg.Name) {
+        return &ValidationError{
+            PackageName: pkg.Name,
+            PackageType: PackageTypeDeb,
+            Message:    "invalid package name: must be lowercase alphanumerics, '+', '-' or '.', starting with an alphanumeric",
+        }
+    }
+    return nil
+}
+
+func (v *DebValidator) ValidateVersion(ver *Version) error {
+    hasDeb := false
+    for _, file := range ver.Files {
+        if strings.HasSuffix(file.Name, ".deb") {
+            hasDeb = true
+            break
+        }
+    }
+    if !hasDeb {
+        return &ValidationError{
+            PackageType: PackageTypeDeb,
+            Message:    "missing required .deb file",
+        }
+    }
+    return nil
+}
+
+func (v *DebValidator) GetMaxFileSize() int64 {
+    return 2 * 1024 * 1024 * 1024 // 2GB
+}
+
+func (v *DebValidator) GetRequiredFiles() []string {
+    return []string{".deb"}
+}
+
+// NEVRA filenames: name-version-release.arch.rpm
+var rpmFilePattern = regexp.MustCompile(`^(.+)-([^-]+)-([^-]+)\.([^.]+)\.rpm$`)
+
+type RPMValidator struct{}
+
+func (v *RPMValidator) ValidatePackage(pkg *Package) error {
+    if pkg.Name == "" || strings.ContainsAny(pkg.Name, " /\\:") {
+        return &ValidationError{
+            PackageName: pkg.Name,
+            PackageType: PackageTypeRPM,
+            Message:    "invalid package name: cannot contain spaces, slashes, or ':'",
+        }
+    }
+    return nil
+}
+
+func (v *RPMValidator) ValidateVersion(ver *Version) error {
+    hasRPM := false
+    for _, file := range ver.Files {
+        if !strings.HasSuffix(file.Name, ".rpm") {
+            continue
+        }
+        if !rpmFilePattern.MatchString(file.Name) {
+            return &ValidationError{
+                PackageType: PackageTypeRPM,
+                Message:    fmt.Sprintf("file %s does not follow name-version-release.arch.rpm naming", file.Name),
+            }
+        }
+        hasRPM = true
+    }
+    if !hasRPM {
+        return &ValidationError{
+            PackageType: PackageTypeRPM,
+            Message:    "missing required .rpm file",
+        }
+    }
+    return nil
+}
+
+func (v *RPMValidator) GetMaxFileSize() int64 {
+    return 2 * 1024 * 1024 * 1024 // 2GB
+}
+
+func (v *RPMValidator) GetRequiredFiles() []string {
+    return []string{".rpm"}
+}
+
+// Composer package names are vendor/package in lowercase
+var composerNamePattern = regexp.MustCompile(`^[a-z0-9]([_.-]?[a-z0-9]+)*/[a-z0-9](([_.]|-{1,2})?[a-z0-9]+)*$`)
+
+type ComposerValidator struct{}
+
+func (v *ComposerValidator) ValidatePackage(pkg *Package) error {
+    if !composerNamePattern.MatchString(pkg.Name) {
+        return &ValidationError{
+            PackageName: pkg.Name,
+            PackageType: PackageTypeComposer,
+            Message:    "invalid package name: must be lowercase vendor/package",
+        }
+    }
+    return nil
+}
+
+func (v *ComposerValidator) ValidateVersion(ver *Version) error {
+    // composer.json travels inside the dist archive and is checked on upload
+    hasDist := false
+    for _, file := range ver.Files {
+        if strings.HasSuffix(file.Name, ".zip") {
+            hasDist = true
+            break
+        }
+    }
+    if !hasDist {
+        return &ValidationError{
+            PackageType: PackageTypeComposer,
+            Message:    "missing required .zip dist archive",
+        }
+    }
+    return nil
+}
+
+func (v *ComposerValidator) GetMaxFileSize() int64 {
+    return 500 * 1024 * 1024 // 500MB
+}
+
+func (v *ComposerValidator) GetRequiredFiles() []string {
+    return []string{".zip"}
+}
+
+// Platform subdirectories of a conda channel
+var CondaSubdirs = []string{
+    "noarch",
+    "linux-64", "linux-32", "linux-aarch64", "linux-armv6l", "linux-armv7l", "linux-ppc64le", "linux-s390x",
+    "osx-64", "osx-arm64",
+    "win-64", "win-32", "win-arm64",
+    "emscripten-wasm32", "wasi-wasm32",
+}
+
+// IsCondaSubdir reports whether name is a known conda platform subdir
+func IsCondaSubdir(name string) bool {
+    for _, subdir := range CondaSubdirs {
+        if subdir == name {
+            return true
+        }
+    }
+    return false
+}
+
+type CondaValidator struct{}
+
+func (v *CondaValidator) ValidatePackage(pkg *Package) error {
+    // Conda package names are lowercase
+    if pkg.Name == "" || strings.ToLower(pkg.Name) != pkg.Name || strings.ContainsAny(pkg.Name, " /\\") {
+        return &ValidationError{
+            PackageName: pkg.Name,
+            PackageType: PackageTypeConda,
+            Message:    "invalid package name: must be lowercase without spaces or slashes",
+        }
+    }
+    return nil
+}
+
+func (v *CondaValidator) ValidateVersion(ver *Version) error {
+    hasArtifact := false
+    for _, file := range ver.Files {
+        if !strings.HasSuffix(file.Name, ".conda") && !strings.HasSuffix(file.Name, ".tar.bz2") {
+            continue
+        }
+        hasArtifact = true
+
+        // Files are named <subdir>/<filename> to keep the channel layout
+        subdir, _, ok := strings.Cut(file.Name, "/")
+        if !ok || !IsCondaSubdir(subdir) {
+            return &ValidationError{
+                PackageType: PackageTypeConda,
+                Message:    fmt.Sprintf("file %s is not inside a known platform subdir (e.g. linux-64, noarch)", file.Name),
+            }
+        }
+    }
+    if !hasArtifact {
+        return &ValidationError{
+            PackageType: PackageTypeConda,
+            Message:    "missing required .conda or .tar.bz2 file",
+        }
+    }
+    return nil
+}
+
+func (v *CondaValidator) GetMaxFileSize() int64 {
+    return 2 * 1024 * 1024 * 1024 // 2GB
+}
+
+func (v *CondaValidator) GetRequiredFiles() []string {
+    return []string{".conda", ".tar.bz2"}
+}
+
+type TerraformValidator struct{}
+
+func (v *TerraformValidator) ValidatePackage(pkg *Package) error {
+    // Names are modules/<name>/<provider> or providers/<type>
+    parts := strings.Split(pkg.Name, "/")
+    valid := (len(parts) == 3 && parts[0] == "modules" && parts[1] != "" && parts[2] != "") ||
+        (len(parts) == 2 && parts[0] == "providers" && parts[1] != "")
+    if !valid {
+        return &ValidationError{
+            PackageName: pkg.Name,
+            PackageType: PackageTypeTerraform,
+            Message:    "terraform package name must be 'modules/<name>/<provider>' or 'providers/<type>'",
+        }
+    }
+    return nil
+}
+
+func (v *TerraformValidator) ValidateVersion(ver *Version) error {
+    hasArchive, hasShasums, hasSignature := false, false, false
+    for _, file := range ver.Files {
+        switch {
+        case strings.HasSuffix(file.Name, ".tar.gz"), strings.HasSuffix(file.Name, ".zip"):
+            hasArchive = true
+        case strings.HasSuffix(file.Name, "_SHA256SUMS"):
+            hasShasums = true
+        case strings.HasSuffix(file.Name, "_SHA256SUMS.sig"):
+            hasSignature = true
+        }
+    }
+    if !hasArchive {
+        return &ValidationError{
+            PackageType: PackageTypeTerraform,
+            Message:    "missing required module or provider archive",
+        }
+    }
+    // Provider releases must keep their checksums and signature together
+    if hasShasums != hasSignature {
+        return &ValidationError{
+            PackageType: PackageTypeTerraform,
+            Message:    "provider SHA256SUMS and SHA256SUMS.sig must be migrated together",
+        }
+    }
+    return nil
+}
+
+func (v *TerraformValidator) GetMaxFileSize() int64 {
+    return 500 * 1024 * 1024 // 500MB
+}
+
+func (v *TerraformValidator) GetRequiredFiles() []string {
+    return []string{".tar.gz", ".zip"}
+}
+
+// Swift registry identifiers are scope.name
+var swiftIdentifierPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9-]{0,38}\.[A-Za-z0-9][A-Za-z0-9_-]{0,99}$`)
+
+type SwiftValidator struct{}
+
+func (v *SwiftValidator) ValidatePackage(pkg *Package) error {
+    if !swiftIdentifierPattern.MatchString(pkg.Name) {
+        return &ValidationError{
+            PackageName: pkg.Name,
+            PackageType: PackageTypeSwift,
+            Message:    "swift package identifier must be scope.name",
+        }
+    }
+    return nil
+}
+
+func (v *SwiftValidator) ValidateVersion(ver *Version) error {
+    hasArchive := false
+    for _, file := range ver.Files {
+        if strings.HasSuffix(file.Name, ".zip") {
+            hasArchive = true
+            break
+        }
+    }
+    if !hasArchive {
+        return &ValidationError{
+            PackageType: PackageTypeSwift,
+            Message:    "missing required source archive .zip file",
+        }
+    }
+    return nil
+}
+
+func (v *SwiftValidator) GetMaxFileSize() int64 {
+    return 500 * 1024 * 1024 // 500MB
+}
+
+func (v *SwiftValidator) GetRequiredFiles() []string {
+    return []string{".zip"}
+}
+
+type CocoaPodsValidator struct{}
+
+func (v *CocoaPodsValidator) ValidatePackage(pkg *Package) error {
+    if pkg.Name == "" || strings.ContainsAny(pkg.Name, " /\\") {
+        return &ValidationError{
+            PackageName: pkg.Name,
+            PackageType: PackageTypeCocoaPods,
+            Message:    "invalid pod name: cannot contain spaces or slashes",
+        }
+    }
+    return nil
+}
+
+func (v *CocoaPodsValidator) ValidateVersion(ver *Version) error {
+    hasSpec := false
+    for _, file := range ver.Files {
+        if strings.HasSuffix(file.Name, ".podspec.json") {
+            hasSpec = true
+            break
+        }
+    }
+    if !hasSpec {
+        return &ValidationError{
+            PackageType: PackageTypeCocoaPods,
+            Message:    "missing required .podspec.json file",
+        }
+    }
+    return nil
+}
+
+func (v *CocoaPodsValidator) GetMaxFileSize() int64 {
+    return 10 * 1024 * 1024 // 10MB
+}
+
+func (v *CocoaPodsValidator) GetRequiredFiles() []string {
+    return []string{".podspec.json"}
+}
+
+type GenericValidator struct{}
+
+func (v *GenericValidator) ValidatePackage(pkg *Package) error {
+    // Names end up in target URL paths
+    if pkg.Name == "" || strings.Contains(pkg.Name, "..") || strings.HasPrefix(pkg.Name, "/") {
+        return &ValidationError{
+            PackageName: pkg.Name,
+            PackageType: PackageTypeGeneric,
+            Message:    "invalid package name: must be a relative path without '..'",
+        }
+    }
+    return nil
+}
+
+func (v *GenericValidator) ValidateVersion(ver *Version) error {
+    if len(ver.Files) == 0 {
+        return &ValidationError{
+            PackageType: PackageTypeGeneric,
+            Message:    "version has no files",
+        }
+    }
+    for _, file := range ver.Files {
+        if file.Name == "" || strings.Contains(file.Name, "..") || strings.HasPrefix(file.Name, "/") {
+            return &ValidationError{
+                PackageType: PackageTypeGeneric,
+                Message:    fmt.Sprintf("invalid file name %q: must be a relative path without '..'", file.Name),
+            }
+        }
+    }
+    return nil
+}
+
+func (v *GenericValidator) GetMaxFileSize() int64 {
+    return 10 * 1024 * 1024 * 1024 // 10GB
+}
+
+func (v *GenericValidator) GetRequiredFiles() []string {
+    return nil
+}
+
+// CustomValidator is used for package types provided by external handlers,
+// which are responsible for their own format checks
+type CustomValidator struct{}
+
+func (v *CustomValidator) ValidatePackage(pkg *Package) error {
+    if pkg.Name == "" {
+        return &ValidationError{
+            PackageType: PackageType(pkg.PackageType),
+            Message:    "package name is required",
+        }
+    }
+    return nil
+}
+
+func (v *CustomValidator) ValidateVersion(ver *Version) error {
+    return nil
+}
+
+func (v *CustomValidator) GetMaxFileSize() int64 {
+    return 10 * 1024 * 1024 * 1024 // 10GB
+}
+
+func (v *CustomValidator) GetRequiredFiles() []string {
+    return nil
+}
+
+// Validators for package types registered at runtime
+var (
+    customValidatorsMu sync.RWMutex
+    customValidators   = make(map[PackageType]PackageValidator)
+)
+
+// RegisterValidator adds a validator for a package type not built into the tool
+func RegisterValidator(pkgType PackageType, validator PackageValidator) {
+    customValidatorsMu.Lock()
+    defer customValidatorsMu.Unlock()
+    customValidators[pkgType] = validator
+}
+
 // Factory for getting the appropriate validator
 func GetValidator(pkgType PackageType) (PackageValidator, error) {
     switch pkgType {
@@ -337,7 +903,32 @@ func GetValidator(pkgType PackageType) (PackageValidator, error) {
         return &NuGetValidator{}, nil
     case PackageTypeRubyGems:
         return &RubyGemsValidator{}, nil
+    case PackageTypeCargo:
+        return &CargoValidator{}, nil
+    case PackageTypeGo:
+        return &GoValidator{}, nil
+    case PackageTypeDeb:
+        return &DebValidator{}, nil
+    case PackageTypeRPM:
+        return &RPMValidator{}, nil
+    case PackageTypeComposer:
+        return &ComposerValidator{}, nil
+    case PackageTypeConda:
+        return &CondaValidator{}, nil
+    case PackageTypeTerraform:
+        return &TerraformValidator{}, nil
+    case PackageTypeSwift:
+        return &SwiftValidator{}, nil
+    case PackageTypeCocoaPods:
+        return &CocoaPodsValidator{}, nil
+    case PackageTypeGeneric:
+        return &GenericValidator{}, nil
     default:
+        customValidatorsMu.RLock()
+        defer customValidatorsMu.RUnlock()
+        if validator, ok := customValidators[pkgType]; ok {
+            return validator, nil
+        }
         return nil, fmt.Errorf("unsupported package type: %s", pkgType)
     }
 }
@@ -0,0 +1,204 @@
+package progress
+
+import (
+    "bytes"
+    "crypto/hmac"
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "sync"
+    "sync/atomic"
+    "time"
+
+    "github.com/cvega/gh-migrate-packages/pkg/run"
+    "github.com/pterm/pterm"
+)
+
+// Event types
+const (
+    EventStarted  = "started"
+    EventProgress = "progress"
+    EventFinished = "finished"
+)
+
+// Final run outcomes
+const (
+    OutcomeCompleted  = "completed"
+    OutcomeIncomplete = "incomplete" // finished, but required versions are missing
+    OutcomeStopped    = "stopped"    // aborted, or out of budget
+)
+
+// SignatureHeader carries the HMAC-SHA256 of the body when a secret is set,
+// as sha256=<hex> like GitHub's own webhooks
+const SignatureHeader = "X-Ghmp-Signature-256"
+
+const postTimeout = 10 * time.Second
+
+// Event is the JSON body posted to the progress endpoint
+type Event struct {
+    Event              string    `json:"event"`
+    RunID              string    `json:"run_id"`
+    Command            string    `json:"command"`
+    Timestamp          time.Time `json:"timestamp"`
+    ElapsedSeconds     int64     `json:"elapsed_seconds"`
+    SourceOrganization string    `json:"source_organization"`
+    TargetOrganization string    `json:"target_organization"`
+    PackageType        string    `json:"package_type,omitempty"`
+    State              string    `json:"state"`
+    Outcome            string    `json:"outcome,omitempty"` // set on the finished event
+    Current            string    `json:"current_package,omitempty"`
+
+    PackagesTotal     int   `json:"packages_total"`
+    PackagesProcessed int   `json:"packages_processed"`
+    VersionsMigrated  int64 `json:"versions_migrated"`
+    VersionsFailed    int64 `json:"versions_failed"`
+    BytesTransferred  int64 `json:"bytes_transferred"`
+    APICalls          int64 `json:"api_calls"`
+
+    // Bytes per second since the previous event, and since the start
+    Throughput        float64 `json:"throughput_bytes_per_second"`
+    AverageThroughput float64 `json:"average_throughput_bytes_per_second"`
+}
+
+// Counters are the version totals of a run, updated by the run while the
+// reporter reads them
+type Counters struct {
+    Migrated atomic.Int64
+    Failed   atomic.Int64
+}
+
+// Reporter posts the run's progress to an endpoint every interval, and
+// once when it starts and finishes. Delivery failures are logged and never
+// affect the run
+type Reporter struct {
+    endpoint string
+    interval time.Duration
+    secret   []byte
+    snapshot func() Event
+    client   *http.Client
+
+    started   time.Time
+    mu        sync.Mutex // serializes posts and the throughput baseline
+    lastAt    time.Time
+    lastBytes int64
+    failing   bool
+
+    stop chan struct{}
+    done chan struct{}
+}
+
+// NewReporter reports to endpoint, or does nothing when endpoint is
+// empty. snapshot returns the run's current counts; the reporter fills
+// in the event type, run ID, timing and throughput
+func NewReporter(endpoint string, interval time.Duration, secret string, snapshot func() Event) *Reporter {
+    r := &Reporter{
+        endpoint: endpoint,
+        interval: interval,
+        snapshot: snapshot,
+        client:   &http.Client{Timeout: postTimeout},
+        stop:     make(chan struct{}),
+        done:     make(chan struct{}),
+    }
+    if secret != "" {
+        r.secret = []byte(secret)
+    }
+    return r
+}
+
+// Start posts the started event and then a progress event every interval
+func (r *Reporter) Start() {
+    if r.endpoint == "" {
+        return
+    }
+    r.started = time.Now()
+    r.lastAt = r.started
+    r.post(EventStarted, "")
+
+    if r.interval <= 0 {
+        close(r.done)
+        return
+    }
+    go func() {
+        defer close(r.done)
+        ticker := time.NewTicker(r.interval)
+        defer ticker.Stop()
+        for {
+            select {
+            case <-ticker.C:
+                r.post(EventProgress, "")
+            case <-r.stop:
+                return
+            }
+        }
+    }()
+}
+
+// Finish stops the periodic events and posts the finished one with outcome
+func (r *Reporter) Finish(outcome string) {
+    if r.endpoint == "" {
+        return
+    }
+    close(r.stop)
+    <-r.done
+    r.post(EventFinished, outcome)
+}
+
+func (r *Reporter) post(event, outcome string) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    e := r.snapshot()
+    now := time.Now()
+    e.Event = event
+    e.Outcome = outcome
+    e.RunID = run.ID()
+    e.Timestamp = now.UTC()
+    e.ElapsedSeconds = int64(now.Sub(r.started).Seconds())
+    if event != EventStarted {
+        e.Throughput = float64(e.BytesTransferred-r.lastBytes) / now.Sub(r.lastAt).Seconds()
+        e.AverageThroughput = float64(e.BytesTransferred) / now.Sub(r.started).Seconds()
+    }
+    r.lastAt, r.lastBytes = now, e.BytesTransferred
+
+    err := r.send(e)
+    switch {
+    case err != nil && !r.failing:
+        // Once per outage, not once per interval
+        pterm.Warning.Printf("Failed to post progress to %s, retrying at the next interval: %v\n", r.endpoint, err)
+        r.failing = true
+    case err == nil && r.failing:
+        pterm.Info.Printf("Posting progress to %s again\n", r.endpoint)
+        r.failing = false
+    }
+}
+
+func (r *Reporter) send(e Event) error {
+    body, err := json.Marshal(e)
+    if err != nil {
+        return fmt.Errorf("failed to encode progress event: %v", err)
+    }
+
+    req, err := http.NewRequest("POST", r.endpoint, bytes.NewReader(body))
+    if err != nil {
+        return err
+    }
+    req.Header.Set("Content-Type", "application/json")
+    req.Header.Set("User-Agent", run.UserAgent())
+    if r.secret != nil {
+        mac := hmac.New(sha256.New, r.secret)
+        mac.Write(body)
+        req.Header.Set(SignatureHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+    }
+
+    resp, err := r.client.Do(req)
+    if err != nil {
+        return err
+    }
+    resp.Body.Close()
+    if resp.StatusCode >= 300 {
+        return fmt.Errorf("endpoint returned %s", resp.Status)
+    }
+    return nil
+}
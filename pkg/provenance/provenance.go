@@ -0,0 +1,439 @@
+package provenance
+
+import (
+    "bufio"
+    "crypto"
+    "crypto/ecdsa"
+    "crypto/ed25519"
+    "crypto/rand"
+    "crypto/rsa"
+    "crypto/sha256"
+    "crypto/x509"
+    "encoding/base64"
+    "encoding/json"
+    "encoding/pem"
+    "fmt"
+    "os"
+    "sync"
+    "time"
+
+    "github.com/cvega/gh-migrate-packages/pkg/run"
+    "github.com/cvega/gh-migrate-packages/pkg/version"
+)
+
+// in-toto and SLSA identifiers of the statements written
+const (
+    StatementType = "https://in-toto.io/Statement/v1"
+    PredicateType = "https://slsa.dev/provenance/v1"
+    PayloadType   = "application/vnd.in-toto+json"
+    BuildType     = "https://github.com/cvega/gh-migrate-packages/migration/v1"
+    BuilderID     = "https://github.com/cvega/gh-migrate-packages"
+)
+
+// Statement is an in-toto statement with a SLSA provenance predicate
+type Statement struct {
+    Type          string               `json:"_type"`
+    Subject       []ResourceDescriptor `json:"subject"`
+    PredicateType string               `json:"predicateType"`
+    Predicate     Predicate            `json:"predicate"`
+}
+
+// ResourceDescriptor names an artifact and its digests, by algorithm
+type ResourceDescriptor struct {
+    Name   string            `json:"name,omitempty"`
+    URI    string            `json:"uri,omitempty"`
+    Digest map[string]string `json:"digest"`
+}
+
+type Predicate struct {
+    BuildDefinition BuildDefinition `json:"buildDefinition"`
+    RunDetails      RunDetails      `json:"runDetails"`
+}
+
+type BuildDefinition struct {
+    BuildType            string                 `json:"buildType"`
+    ExternalParameters   map[string]interface{} `json:"externalParameters"`
+    ResolvedDependencies []ResourceDescriptor   `json:"resolvedDependencies,omitempty"`
+}
+
+type RunDetails struct {
+    Builder  Builder  `json:"builder"`
+    Metadata Metadata `json:"metadata"`
+}
+
+type Builder struct {
+    ID      string            `json:"id"`
+    Version map[string]string `json:"version,omitempty"`
+}
+
+type Metadata struct {
+    InvocationID string    `json:"invocationId"`
+    StartedOn    time.Time `json:"startedOn"`
+    FinishedOn   time.Time `json:"finishedOn"`
+}
+
+// Transfer is one version copied from the source to the target. Sources are
+// the artifacts as downloaded and Targets those uploaded in their place
+type Transfer struct {
+    PackageType        string
+    SourceOrganization string
+    SourceName         string
+    SourceVersion      string
+    TargetOrganization string
+    TargetName         string
+    TargetVersion      string
+    Sources            []ResourceDescriptor
+    Targets            []ResourceDescriptor
+    StartedOn          time.Time
+    FinishedOn         time.Time
+}
+
+// NewStatement describes t as provenance: the target artifacts are the
+// subject and the source artifacts the resolved dependencies, attributed
+// to this tool's version and run
+func NewStatement(t Transfer) Statement {
+    return Statement{
+        Type:          StatementType,
+        Subject:       t.Targets,
+        PredicateType: PredicateType,
+        Predicate: Predicate{
+            BuildDefinition: BuildDefinition{
+                BuildType: BuildType,
+                ExternalParameters: map[string]interface{}{
+                    "packageType": t.PackageType,
+                    "source": map[string]string{
+                        "organization": t.SourceOrganization,
+                        "name":         t.SourceName,
+                        "version":      t.SourceVersion,
+                    },
+                    "target": map[string]string{
+                        "organization": t.TargetOrganization,
+                        "name":         t.TargetName,
+                        "version":      t.TargetVersion,
+                    },
+                },
+                ResolvedDependencies: t.Sources,
+            },
+            RunDetails: RunDetails{
+                Builder: Builder{
+                    ID:      BuilderID,
+                    Version: map[string]string{"gh-migrate-packages": version.Get().Version},
+                },
+                Metadata: Metadata{
+                    InvocationID: run.ID(),
+                    StartedOn:    t.StartedOn,
+                    FinishedOn:   t.FinishedOn,
+                },
+            },
+        },
+    }
+}
+
+// Envelope is a DSSE envelope carrying a signed statement
+type Envelope struct {
+    PayloadType string      `json:"payloadType"`
+    Payload     string      `json:"payload"`
+    Signatures  []Signature `json:"signatures"`
+}
+
+type Signature struct {
+    KeyID string `json:"keyid"`
+    Sig   string `json:"sig"`
+}
+
+// Signer signs statements with a private key
+type Signer struct {
+    key   crypto.Signer
+    keyID string
+}
+
+// LoadSigner reads a PEM private key: PKCS#8 Ed25519, ECDSA, or RSA, or
+// the SEC 1 and PKCS#1 forms of the latter two. The key ID is the SHA-256
+// of the public key
+func LoadSigner(path string) (*Signer, error) {
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return nil, fmt.Errorf("failed to read signing key: %v", err)
+    }
+    block, _ := pem.Decode(data)
+    if block == nil {
+        return nil, fmt.Errorf("signing key %s is not PEM encoded", path)
+    }
+
+    var key interface{}
+    switch block.Type {
+    case "EC PRIVATE KEY":
+        key, err = x509.ParseECPrivateKey(block.Bytes)
+    case "RSA PRIVATE KEY":
+        key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+    default:
+        key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to parse signing key %s: %v", path, err)
+    }
+
+    signer, ok := key.(crypto.Signer)
+    if !ok {
+        return nil, fmt.Errorf("signing key %s can't sign", path)
+    }
+    s, err := NewSigner(signer)
+    if err != nil {
+        return nil, fmt.Errorf("failed to read public key of %s: %v", path, err)
+    }
+    return s, nil
+}
+
+// NewSigner signs with a key held in memory, such as an ephemeral one
+func NewSigner(key crypto.Signer) (*Signer, error) {
+    public, err := x509.MarshalPKIXPublicKey(key.Public())
+    if err != nil {
+        return nil, err
+    }
+    return &Signer{key: key, keyID: fmt.Sprintf("%x", sha256.Sum256(public))}, nil
+}
+
+// pae is the DSSE pre-authentication encoding the signature covers
+func pae(payloadType string, payload []byte) []byte {
+    return []byte(fmt.Sprintf("DSSEv1 %d %s %d %s", len(payloadType), payloadType, len(payload), payload))
+}
+
+// Sign wraps payload in a DSSE envelope signed by s
+func (s *Signer) Sign(payload []byte) (*Envelope, error) {
+    return s.SignAs(PayloadType, payload)
+}
+
+// SignAs signs a payload other than an in-toto statement, such as a
+// migration plan, as payloadType
+func (s *Signer) SignAs(payloadType string, payload []byte) (*Envelope, error) {
+    message := pae(payloadType, payload)
+
+    var sig []byte
+    var err error
+    switch s.key.(type) {
+    case ed25519.PrivateKey:
+        sig, err = s.key.Sign(rand.Reader, message, crypto.Hash(0))
+    case *ecdsa.PrivateKey, *rsa.PrivateKey:
+        digest := sha256.Sum256(message)
+        sig, err = s.key.Sign(rand.Reader, digest[:], crypto.SHA256)
+    default:
+        return nil, fmt.Errorf("unsupported signing key type %T", s.key)
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to sign payload: %v", err)
+    }
+
+    return &Envelope{
+        PayloadType: payloadType,
+        Payload:     base64.StdEncoding.EncodeToString(payload),
+        Signatures:  []Signature{{KeyID: s.keyID, Sig: base64.StdEncoding.EncodeToString(sig)}},
+    }, nil
+}
+
+// Log appends one statement per transferred version to a JSON Lines file,
+// each wrapped in a signed DSSE envelope when a signer is set
+type Log struct {
+    mu     sync.Mutex
+    file   *os.File
+    signer *Signer
+    count  int
+}
+
+// Open appends to the log at path, so resumed runs add to it
+func Open(path string, signer *Signer) (*Log, error) {
+    file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+    if err != nil {
+        return nil, fmt.Errorf("failed to open provenance log: %v", err)
+    }
+    return &Log{file: file, signer: signer}, nil
+}
+
+// Record writes the provenance of t
+func (l *Log) Record(t Transfer) error {
+    statement, err := json.Marshal(NewStatement(t))
+    if err != nil {
+        return fmt.Errorf("failed to encode statement: %v", err)
+    }
+
+    line := statement
+    if l.signer != nil {
+        envelope, err := l.signer.Sign(statement)
+        if err != nil {
+            return err
+        }
+        if line, err = json.Marshal(envelope); err != nil {
+            return fmt.Errorf("failed to encode envelope: %v", err)
+        }
+    }
+
+    l.mu.Lock()
+    defer l.mu.Unlock()
+    if _, err := l.file.Write(append(line, '\n')); err != nil {
+        return fmt.Errorf("failed to write provenance: %v", err)
+    }
+    l.count++
+    return nil
+}
+
+// Count returns the statements recorded by this run
+func (l *Log) Count() int {
+    l.mu.Lock()
+    defer l.mu.Unlock()
+    return l.count
+}
+
+func (l *Log) Close() error {
+    return l.file.Close()
+}
+
+// PublicKey checks the envelopes a Signer wrote
+type PublicKey struct {
+    key   crypto.PublicKey
+    keyID string
+}
+
+// LoadPublicKey reads a PEM public key, as PKIX or PKCS#1, or takes the
+// public half of a private key LoadSigner accepts
+func LoadPublicKey(path string) (*PublicKey, error) {
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return nil, fmt.Errorf("failed to read public key: %v", err)
+    }
+    block, _ := pem.Decode(data)
+    if block == nil {
+        return nil, fmt.Errorf("public key %s is not PEM encoded", path)
+    }
+
+    var key crypto.PublicKey
+    switch block.Type {
+    case "PUBLIC KEY":
+        key, err = x509.ParsePKIXPublicKey(block.Bytes)
+    case "RSA PUBLIC KEY":
+        key, err = x509.ParsePKCS1PublicKey(block.Bytes)
+    default:
+        var signer *Signer
+        if signer, err = LoadSigner(path); err == nil {
+            key = signer.key.Public()
+        }
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to parse public key %s: %v", path, err)
+    }
+
+    public, err := x509.MarshalPKIXPublicKey(key)
+    if err != nil {
+        return nil, fmt.Errorf("unsupported public key %s: %v", path, err)
+    }
+    return &PublicKey{key: key, keyID: fmt.Sprintf("%x", sha256.Sum256(public))}, nil
+}
+
+// Verify checks that one of the envelope's signatures is k's
+func (k *PublicKey) Verify(envelope Envelope) error {
+    payload, err := base64.StdEncoding.DecodeString(envelope.Payload)
+    if err != nil {
+        return fmt.Errorf("failed to decode payload: %v", err)
+    }
+    message := pae(envelope.PayloadType, payload)
+    digest := sha256.Sum256(message)
+
+    for _, signature := range envelope.Signatures {
+        if signature.KeyID != "" && signature.KeyID != k.keyID {
+            continue
+        }
+        sig, err := base64.StdEncoding.DecodeString(signature.Sig)
+        if err != nil {
+            continue
+        }
+        var valid bool
+        switch key := k.key.(type) {
+        case ed25519.PublicKey:
+            valid = ed25519.Verify(key, message, sig)
+        case *ecdsa.PublicKey:
+            valid = ecdsa.VerifyASN1(key, digest[:], sig)
+        case *rsa.PublicKey:
+            valid = rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig) == nil
+        default:
+            return fmt.Errorf("unsupported public key type %T", k.key)
+        }
+        if valid {
+            return nil
+        }
+    }
+    return fmt.Errorf("no valid signature by key %s", k.keyID)
+}
+
+// ReadLog reads the statements of a provenance log, unwrapping DSSE
+// envelopes without checking their signatures
+func ReadLog(path string) ([]Statement, error) {
+    return ReadSignedLog(path, nil)
+}
+
+// ReadSignedLog reads a provenance log like ReadLog, and with a key also
+// requires every line to be an envelope it signed, so a log edited after
+// the run is rejected
+func ReadSignedLog(path string, key *PublicKey) ([]Statement, error) {
+    file, err := os.Open(path)
+    if err != nil {
+        return nil, fmt.Errorf("failed to open provenance log: %v", err)
+    }
+    defer file.Close()
+
+    var statements []Statement
+    scanner := bufio.NewScanner(file)
+    scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+    for line := 1; scanner.Scan(); line++ {
+        data := scanner.Bytes()
+        if len(data) == 0 {
+            continue
+        }
+
+        var envelope Envelope
+        if err := json.Unmarshal(data, &envelope); err != nil {
+            return nil, fmt.Errorf("failed to parse %s line %d: %v", path, line, err)
+        }
+        if key != nil {
+            if envelope.PayloadType == "" {
+                return nil, fmt.Errorf("%s line %d is not signed", path, line)
+            }
+            if err := key.Verify(envelope); err != nil {
+                return nil, fmt.Errorf("%s line %d: %v", path, line, err)
+            }
+        }
+        if envelope.PayloadType != "" {
+            if data, err = base64.StdEncoding.DecodeString(envelope.Payload); err != nil {
+                return nil, fmt.Errorf("failed to decode %s line %d: %v", path, line, err)
+            }
+        }
+
+        var statement Statement
+        if err := json.Unmarshal(data, &statement); err != nil {
+            return nil, fmt.Errorf("failed to parse %s line %d: %v", path, line, err)
+        }
+        if statement.Type != StatementType || statement.PredicateType != PredicateType {
+            return nil, fmt.Errorf("%s line %d is not a provenance statement", path, line)
+        }
+        statements = append(statements, statement)
+    }
+    if err := scanner.Err(); err != nil {
+        return nil, fmt.Errorf("failed to read provenance log: %v", err)
+    }
+    return statements, nil
+}
+
+// Target returns the package type and the target organization, name, and
+// version a statement was recorded for
+func (s Statement) Target() (packageType, org, name, version string) {
+    params := s.Predicate.BuildDefinition.ExternalParameters
+    packageType, _ = params["packageType"].(string)
+
+    // Decoded statements hold a generic map, new ones the typed one
+    switch target := params["target"].(type) {
+    case map[string]string:
+        return packageType, target["organization"], target["name"], target["version"]
+    case map[string]interface{}:
+        org, _ = target["organization"].(string)
+        name, _ = target["name"].(string)
+        version, _ = target["version"].(string)
+    }
+    return packageType, org, name, version
+}
@@ -0,0 +1,97 @@
+package proxy
+
+import (
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "fmt"
+    "io"
+    "net/http"
+    "os"
+    "path/filepath"
+    "strconv"
+)
+
+// Headers kept with a cached artifact
+var cachedHeaders = []string{"Content-Type", "Docker-Content-Digest"}
+
+// cache keeps artifacts fetched from the source on disk, so repeated
+// requests don't go back to it. Only immutable artifacts are cached, by
+// their source path
+type cache struct {
+    dir string
+}
+
+func openCache(dir string) (*cache, error) {
+    if err := os.MkdirAll(dir, 0755); err != nil {
+        return nil, fmt.Errorf("failed to create cache directory: %v", err)
+    }
+    return &cache{dir: dir}, nil
+}
+
+func (c *cache) path(key string) string {
+    sum := sha256.Sum256([]byte(key))
+    return filepath.Join(c.dir, hex.EncodeToString(sum[:]))
+}
+
+// serve answers r from the cache, and reports false when key isn't cached
+func (c *cache) serve(w http.ResponseWriter, r *http.Request, key string) bool {
+    path := c.path(key)
+    file, err := os.Open(path)
+    if err != nil {
+        return false
+    }
+    defer file.Close()
+    info, err := file.Stat()
+    if err != nil {
+        return false
+    }
+
+    var header map[string]string
+    if data, err := os.ReadFile(path + ".json"); err == nil {
+        json.Unmarshal(data, &header)
+    }
+    for name, value := range header {
+        w.Header().Set(name, value)
+    }
+    w.Header().Set("Content-Length", strconv.FormatInt(info.Size(), 10))
+    w.WriteHeader(http.StatusOK)
+    if r.Method == http.MethodGet {
+        io.Copy(w, file)
+    }
+    return true
+}
+
+// store streams resp to w and into the cache. Partial downloads, whether
+// the registry or the client broke off, are discarded
+func (c *cache) store(w io.Writer, resp *http.Response, key string) error {
+    partial, err := os.CreateTemp(c.dir, "partial-*")
+    if err != nil {
+        io.Copy(w, resp.Body)
+        return err
+    }
+    _, err = io.Copy(w, io.TeeReader(resp.Body, partial))
+    if closeErr := partial.Close(); err == nil {
+        err = closeErr
+    }
+    if err != nil {
+        os.Remove(partial.Name())
+        return err
+    }
+
+    header := make(map[string]string)
+    for _, name := range cachedHeaders {
+        if value := resp.Header.Get(name); value != "" {
+            header[name] = value
+        }
+    }
+    data, err := json.Marshal(header)
+    if err == nil {
+        err = os.WriteFile(c.path(key)+".json", data, 0644)
+    }
+    if err != nil {
+        os.Remove(partial.Name())
+        return err
+    }
+    return os.Rename(partial.Name(), c.path(key))
+}
@@ -0,0 +1,433 @@
+package proxy
+
+import (
+    "context"
+    "crypto/subtle"
+    "encoding/json"
+    "fmt"
+    "io"
+    "net/http"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/cvega/gh-migrate-packages/pkg/api"
+    "github.com/cvega/gh-migrate-packages/pkg/run"
+    "github.com/pterm/pterm"
+    "github.com/spf13/viper"
+)
+
+// Path prefixes of the registries the proxy serves. Containers have none,
+// Docker clients always request /v2/ from the registry root
+var prefixes = map[string]string{
+    "/npm":      "npm",
+    "/maven":    "maven",
+    "/nuget":    "nuget",
+    "/rubygems": "rubygems",
+}
+
+// Response headers that describe the connection to the registry, or its
+// authentication, rather than the content
+var skipHeaders = map[string]bool{
+    "Connection":        true,
+    "Keep-Alive":        true,
+    "Transfer-Encoding": true,
+    "Www-Authenticate":  true,
+    "Set-Cookie":        true,
+}
+
+// Options configure a proxy in front of the target organization
+type Options struct {
+    Source    *api.API
+    Target    *api.API
+    SourceOrg string
+    TargetOrg string
+    PublicURL string // base URL clients reach the proxy at, defaults to the request's host
+    CacheDir  string // empty disables the cache
+    Token     string // when set, clients must present it as a bearer token or password
+    Publish   bool   // forward-publish versions served from the source to the target
+}
+
+// Server answers registry requests from the target organization and falls
+// back to the source for what hasn't been migrated yet, so consumers can
+// switch to the target before the migration is complete
+type Server struct {
+    opts      Options
+    cache     *cache
+    publisher *publisher
+}
+
+func NewServer(opts Options) (*Server, error) {
+    s := &Server{opts: opts}
+    if opts.CacheDir != "" {
+        c, err := openCache(opts.CacheDir)
+        if err != nil {
+            return nil, err
+        }
+        s.cache = c
+    }
+    if opts.Publish {
+        s.publisher = newPublisher(opts)
+    }
+    return s, nil
+}
+
+// Close waits for queued forward-publishes to finish
+func (s *Server) Close() {
+    if s.publisher != nil {
+        s.publisher.close()
+    }
+}
+
+// route is a request mapped to a package type and a registry path
+type route struct {
+    packageType string
+    prefix      string // proxy path prefix of the type
+    path        string // escaped registry path
+    query       string
+}
+
+func parseRoute(r *http.Request) (route, bool) {
+    path := r.URL.EscapedPath()
+    if path == "/v2" || strings.HasPrefix(path, "/v2/") {
+        return route{packageType: "container", path: path, query: r.URL.RawQuery}, true
+    }
+    for prefix, packageType := range prefixes {
+        if path != prefix && !strings.HasPrefix(path, prefix+"/") {
+            continue
+        }
+        rest := strings.TrimPrefix(path, prefix)
+        if rest == "" {
+            rest = "/"
+        }
+        return route{packageType: packageType, prefix: prefix, path: rest, query: r.URL.RawQuery}, true
+    }
+    return route{}, false
+}
+
+func (rt route) url(base, path string) string {
+    if rt.query != "" {
+        return base + path + "?" + rt.query
+    }
+    return base + path
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+    rt, ok := parseRoute(r)
+    if !ok {
+        http.Error(w, "unknown registry, request /npm, /maven, /nuget, /rubygems, or /v2 for containers", http.StatusNotFound)
+        return
+    }
+    if !s.authorized(r) {
+        w.Header().Set("WWW-Authenticate", `Basic realm="gh-migrate-packages proxy"`)
+        http.Error(w, "proxy token required", http.StatusUnauthorized)
+        return
+    }
+    if r.Method != http.MethodGet && r.Method != http.MethodHead {
+        http.Error(w, "the proxy only serves reads, publish to the target registry directly", http.StatusMethodNotAllowed)
+        return
+    }
+    // Docker checks the registry API version before anything else
+    if rt.packageType == "container" && (rt.path == "/v2" || rt.path == "/v2/") {
+        w.Header().Set("Docker-Distribution-API-Version", "registry/2.0")
+        w.WriteHeader(http.StatusOK)
+        return
+    }
+
+    header := http.Header{}
+    if accept := r.Header.Values("Accept"); len(accept) > 0 {
+        header["Accept"] = accept
+    }
+
+    resp, err := s.opts.Target.Fetch(r.Method, rt.url(s.opts.Target.RegistryBaseURL(rt.packageType), rt.path), header)
+    if err != nil {
+        http.Error(w, fmt.Sprintf("failed to reach the target registry: %v", err), http.StatusBadGateway)
+        return
+    }
+    if resp.StatusCode != http.StatusNotFound {
+        defer resp.Body.Close()
+        if rt.packageType == "npm" && r.Method == http.MethodGet && resp.StatusCode == http.StatusOK && !isImmutable(rt.packageType, rt.path) {
+            s.serveNpmMetadata(w, r, rt, resp, header)
+            return
+        }
+        s.relay(w, r, rt, resp, s.opts.Target, false)
+        return
+    }
+    resp.Body.Close()
+
+    sourcePath := s.toSource(rt.path)
+    immutable := isImmutable(rt.packageType, rt.path)
+    key := rt.packageType + sourcePath
+    if immutable && s.cache != nil && s.cache.serve(w, r, key) {
+        pterm.Info.Printf("%s %s: served from cache\n", r.Method, r.URL.Path)
+        s.forward(rt)
+        return
+    }
+
+    resp, err = s.opts.Source.Fetch(r.Method, rt.url(s.opts.Source.RegistryBaseURL(rt.packageType), sourcePath), header)
+    if err != nil {
+        http.Error(w, fmt.Sprintf("failed to reach the source registry: %v", err), http.StatusBadGateway)
+        return
+    }
+    defer resp.Body.Close()
+    if resp.StatusCode != http.StatusOK {
+        s.relay(w, r, rt, resp, s.opts.Source, true)
+        return
+    }
+
+    pterm.Info.Printf("%s %s: missing from %s, served from %s\n", r.Method, r.URL.Path, s.opts.TargetOrg, s.opts.SourceOrg)
+    if immutable && s.cache != nil && r.Method == http.MethodGet {
+        copyHeader(w.Header(), resp.Header)
+        w.WriteHeader(resp.StatusCode)
+        if err := s.cache.store(w, resp, key); err != nil {
+            pterm.Warning.Printf("Failed to cache %s: %v\n", r.URL.Path, err)
+        }
+    } else {
+        s.relay(w, r, rt, resp, s.opts.Source, true)
+    }
+    s.forward(rt)
+}
+
+// authorized checks the proxy token, which clients send as a bearer token
+// (npm) or as the password of basic authentication (everything else)
+func (s *Server) authorized(r *http.Request) bool {
+    if s.opts.Token == "" {
+        return true
+    }
+    presented := ""
+    if _, password, ok := r.BasicAuth(); ok {
+        presented = password
+    } else if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+        presented = strings.TrimPrefix(auth, "Bearer ")
+    }
+    return subtle.ConstantTimeCompare([]byte(presented), []byte(s.opts.Token)) == 1
+}
+
+// toSource maps a registry path in the target organization to the same
+// path in the source organization. The organization is one of the first
+// segments in every registry's layout, as a scope for npm
+func (s *Server) toSource(path string) string {
+    target := strings.ToLower(s.opts.TargetOrg)
+    segments := strings.Split(path, "/")
+    for i := 1; i < len(segments) && i <= 2; i++ {
+        segment := strings.ToLower(segments[i])
+        switch {
+        case segment == target:
+            segments[i] = s.opts.SourceOrg
+        case segment == "@"+target:
+            segments[i] = "@" + strings.ToLower(s.opts.SourceOrg)
+        case strings.HasPrefix(segment, "@"+target+"%2f"):
+            segments[i] = "@" + strings.ToLower(s.opts.SourceOrg) + segments[i][len(target)+1:]
+        default:
+            continue
+        }
+        return strings.Join(segments, "/")
+    }
+    return path
+}
+
+// forward queues the version a request belongs to for publishing to the target
+func (s *Server) forward(rt route) {
+    if s.publisher == nil {
+        return
+    }
+    if req, ok := parseRequest(rt.packageType, rt.path); ok {
+        s.publisher.enqueue(req)
+    }
+}
+
+// relay copies resp to the client, with registry URLs in metadata pointed
+// at the proxy so follow-up requests come back through it
+func (s *Server) relay(w http.ResponseWriter, r *http.Request, rt route, resp *http.Response, from *api.API, fromSource bool) {
+    copyHeader(w.Header(), resp.Header)
+    if r.Method == http.MethodHead || !s.rewritable(rt, resp) {
+        w.WriteHeader(resp.StatusCode)
+        io.Copy(w, resp.Body)
+        return
+    }
+
+    body, err := s.readRewritten(r, rt, resp, from, fromSource)
+    if err != nil {
+        http.Error(w, fmt.Sprintf("failed to read registry response: %v", err), http.StatusBadGateway)
+        return
+    }
+    writeBody(w, resp.StatusCode, body)
+}
+
+// rewritable reports whether resp is registry metadata. Artifacts and
+// container manifests are addressed by digest and must pass unchanged
+func (s *Server) rewritable(rt route, resp *http.Response) bool {
+    if rt.packageType == "container" || isImmutable(rt.packageType, rt.path) {
+        return false
+    }
+    contentType := resp.Header.Get("Content-Type")
+    return strings.Contains(contentType, "json") || strings.Contains(contentType, "xml") || strings.HasPrefix(contentType, "text/")
+}
+
+func (s *Server) readRewritten(r *http.Request, rt route, resp *http.Response, from *api.API, fromSource bool) ([]byte, error) {
+    body, err := io.ReadAll(resp.Body)
+    if err != nil {
+        return nil, err
+    }
+    text := strings.ReplaceAll(string(body), from.RegistryBaseURL(rt.packageType), s.baseURL(r)+rt.prefix)
+    if fromSource {
+        text = replaceOrganization(text, s.opts.SourceOrg, s.opts.TargetOrg)
+    }
+    return []byte(text), nil
+}
+
+// serveNpmMetadata answers a packument request with the versions of both
+// organizations, so versions not migrated yet stay installable. Where both
+// have a version or dist-tag, the target's wins
+func (s *Server) serveNpmMetadata(w http.ResponseWriter, r *http.Request, rt route, resp *http.Response, header http.Header) {
+    targetBody, err := s.readRewritten(r, rt, resp, s.opts.Target, false)
+    if err != nil {
+        http.Error(w, fmt.Sprintf("failed to read registry response: %v", err), http.StatusBadGateway)
+        return
+    }
+    copyHeader(w.Header(), resp.Header)
+
+    sourceResp, err := s.opts.Source.Fetch(http.MethodGet, rt.url(s.opts.Source.RegistryBaseURL(rt.packageType), s.toSource(rt.path)), header)
+    if err != nil {
+        writeBody(w, resp.StatusCode, targetBody)
+        return
+    }
+    defer sourceResp.Body.Close()
+    if sourceResp.StatusCode != http.StatusOK {
+        writeBody(w, resp.StatusCode, targetBody)
+        return
+    }
+    sourceBody, err := s.readRewritten(r, rt, sourceResp, s.opts.Source, true)
+    if err != nil {
+        writeBody(w, resp.StatusCode, targetBody)
+        return
+    }
+
+    merged, err := mergePackuments(targetBody, sourceBody)
+    if err != nil {
+        pterm.Warning.Printf("Failed to merge npm metadata of %s: %v\n", r.URL.Path, err)
+        merged = targetBody
+    }
+    w.Header().Del("Etag")
+    writeBody(w, resp.StatusCode, merged)
+}
+
+func mergePackuments(target, source []byte) ([]byte, error) {
+    var merged, other map[string]interface{}
+    if err := json.Unmarshal(target, &merged); err != nil {
+        return nil, err
+    }
+    if err := json.Unmarshal(source, &other); err != nil {
+        return nil, err
+    }
+    for _, field := range []string{"versions", "time", "dist-tags"} {
+        from, _ := other[field].(map[string]interface{})
+        into, _ := merged[field].(map[string]interface{})
+        if into == nil {
+            into = make(map[string]interface{})
+        }
+        for key, value := range from {
+            if _, ok := into[key]; !ok {
+                into[key] = value
+            }
+        }
+        if len(into) > 0 {
+            merged[field] = into
+        }
+    }
+    return json.Marshal(merged)
+}
+
+// baseURL is where clients reach the proxy
+func (s *Server) baseURL(r *http.Request) string {
+    if s.opts.PublicURL != "" {
+        return strings.TrimSuffix(s.opts.PublicURL, "/")
+    }
+    scheme := "http"
+    if r.TLS != nil {
+        scheme = "https"
+    }
+    if forwarded := r.Header.Get("X-Forwarded-Proto"); forwarded != "" {
+        scheme = forwarded
+    }
+    return scheme + "://" + r.Host
+}
+
+// replaceOrganization points references to the source organization, as
+// an npm scope or a path segment, at the target
+func replaceOrganization(text, from, to string) string {
+    lowerFrom, lowerTo := strings.ToLower(from), strings.ToLower(to)
+    for _, pair := range [][2]string{
+        {"@" + lowerFrom + "/", "@" + lowerTo + "/"},
+        {"@" + lowerFrom + "%2f", "@" + lowerTo + "%2f"},
+        {"@" + lowerFrom + "%2F", "@" + lowerTo + "%2F"},
+        {"/" + from + "/", "/" + to + "/"},
+        {"/" + lowerFrom + "/", "/" + lowerTo + "/"},
+    } {
+        text = strings.ReplaceAll(text, pair[0], pair[1])
+    }
+    return text
+}
+
+func copyHeader(dst, src http.Header) {
+    for name, values := range src {
+        if skipHeaders[name] {
+            continue
+        }
+        dst[name] = values
+    }
+}
+
+func writeBody(w http.ResponseWriter, status int, body []byte) {
+    w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+    w.WriteHeader(status)
+    w.Write(body)
+}
+
+// ServeFromConfig runs the proxy until interrupted, then waits for queued
+// forward-publishes to finish
+func ServeFromConfig() error {
+    source := api.NewAPI(viper.GetString("SOURCE_TOKEN"), viper.GetString("SOURCE_HOSTNAME"))
+    source.SetReadOnly()
+    target := api.NewAPI(viper.GetString("TARGET_TOKEN"), "")
+
+    server, err := NewServer(Options{
+        Source:    source,
+        Target:    target,
+        SourceOrg: viper.GetString("SOURCE_ORGANIZATION"),
+        TargetOrg: viper.GetString("TARGET_ORGANIZATION"),
+        PublicURL: viper.GetString("PUBLIC_URL"),
+        CacheDir:  viper.GetString("CACHE_DIR"),
+        Token:     viper.GetString("PROXY_TOKEN"),
+        Publish:   !viper.GetBool("NO_PUBLISH"),
+    })
+    if err != nil {
+        return err
+    }
+
+    listen := viper.GetString("LISTEN")
+    httpServer := &http.Server{Addr: listen, Handler: server}
+    ctx := run.StopOnSignal()
+
+    errs := make(chan error, 1)
+    go func() {
+        errs <- httpServer.ListenAndServe()
+    }()
+    pterm.Info.Printf("Proxying %s with fallback to %s on %s\n", server.opts.TargetOrg, server.opts.SourceOrg, listen)
+
+    select {
+    case err := <-errs:
+        server.Close()
+        return fmt.Errorf("failed to serve: %v", err)
+    case <-ctx.Done():
+    }
+
+    pterm.Info.Println("Shutting down, waiting for queued forward-publishes")
+    shutdown, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+    defer cancel()
+    if err := httpServer.Shutdown(shutdown); err != nil {
+        pterm.Warning.Printf("Failed to close open connections: %v\n", err)
+    }
+    server.Close()
+    return nil
+}
@@ -0,0 +1,161 @@
+package proxy
+
+import (
+    "fmt"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/cvega/gh-migrate-packages/pkg/api"
+    "github.com/cvega/gh-migrate-packages/pkg/run"
+    "github.com/pterm/pterm"
+)
+
+const (
+    queueSize  = 100
+    listingTTL = 10 * time.Minute // how long source package listings are reused
+)
+
+// publisher copies versions served from the source to the target in the
+// background, one at a time, so each miss happens at most once
+type publisher struct {
+    opts   Options
+    queue  chan request
+    done   chan struct{}
+    mu     sync.Mutex
+    queued map[request]bool // queued or published, failures are removed to retry
+    listed map[string]listing
+}
+
+type listing struct {
+    packages []api.Package
+    at       time.Time
+}
+
+func newPublisher(opts Options) *publisher {
+    p := &publisher{
+        opts:   opts,
+        queue:  make(chan request, queueSize),
+        done:   make(chan struct{}),
+        queued: make(map[request]bool),
+        listed: make(map[string]listing),
+    }
+    go p.run()
+    return p
+}
+
+func (p *publisher) enqueue(req request) {
+    p.mu.Lock()
+    defer p.mu.Unlock()
+    if p.queued[req] {
+        return
+    }
+    select {
+    case p.queue <- req:
+        p.queued[req] = true
+    default:
+        pterm.Warning.Printf("Forward-publish queue full, %s %s@%s is retried on its next request\n", req.PackageType, req.Name, req.Version)
+    }
+}
+
+// close stops accepting versions and waits for the queued ones
+func (p *publisher) close() {
+    close(p.queue)
+    <-p.done
+}
+
+func (p *publisher) run() {
+    defer close(p.done)
+    for req := range p.queue {
+        if err := p.publish(req); err != nil {
+            pterm.Error.Printf("Failed to forward-publish %s %s@%s: %v\n", req.PackageType, req.Name, req.Version, err)
+            p.mu.Lock()
+            delete(p.queued, req)
+            p.mu.Unlock()
+            continue
+        }
+        pterm.Success.Printf("Forward-published %s %s@%s to %s\n", req.PackageType, req.Name, req.Version, p.opts.TargetOrg)
+    }
+}
+
+func (p *publisher) publish(req request) error {
+    pkg, version, err := p.find(req)
+    if err != nil {
+        return err
+    }
+
+    dir, err := run.TempDir("proxy")
+    if err != nil {
+        return fmt.Errorf("failed to create staging directory: %v", err)
+    }
+    defer run.RemoveTempDir(dir)
+
+    files, err := p.opts.Source.DownloadPackageVersion(p.opts.SourceOrg, pkg, version, dir)
+    if err != nil {
+        return fmt.Errorf("failed to download: %v", err)
+    }
+
+    var metadata map[string]interface{}
+    if pkg.PackageType == "container" {
+        metadata = version.Metadata
+    }
+    return p.opts.Target.UploadPackageVersion(api.UploadOptions{
+        Organization: p.opts.TargetOrg,
+        PackageName:  pkg.Name,
+        Version:      version.Name,
+        PackageType:  pkg.PackageType,
+        Metadata:     metadata,
+        Files:        files,
+    })
+}
+
+// find looks req up in the source, listing its packages again when the
+// listing is stale or doesn't have the version yet
+func (p *publisher) find(req request) (api.Package, api.Version, error) {
+    for _, refresh := range []bool{false, true} {
+        packages, err := p.packages(req.PackageType, refresh)
+        if err != nil {
+            return api.Package{}, api.Version{}, err
+        }
+        for _, pkg := range packages {
+            if !strings.EqualFold(pkg.Name, req.Name) {
+                continue
+            }
+            for _, v := range pkg.Versions {
+                if versionMatches(v, req.Version) {
+                    return pkg, v, nil
+                }
+            }
+        }
+    }
+    return api.Package{}, api.Version{}, fmt.Errorf("version not found in %s", p.opts.SourceOrg)
+}
+
+func (p *publisher) packages(packageType string, refresh bool) ([]api.Package, error) {
+    l, ok := p.listed[packageType]
+    if ok && !refresh && time.Since(l.at) < listingTTL {
+        return l.packages, nil
+    }
+    packages, err := p.opts.Source.GetOrganizationPackages(p.opts.SourceOrg, packageType)
+    if err != nil {
+        return nil, fmt.Errorf("failed to list %s packages: %v", packageType, err)
+    }
+    p.listed[packageType] = listing{packages: packages, at: time.Now()}
+    return packages, nil
+}
+
+// versionMatches compares by name, and for containers by tag too, since
+// clients pull tags while versions are named by digest
+func versionMatches(v api.Version, name string) bool {
+    if strings.EqualFold(v.Name, name) {
+        return true
+    }
+    container, _ := v.Metadata["container"].(map[string]interface{})
+    tags, _ := container["tags"].([]interface{})
+    for _, tag := range tags {
+        if tag == name {
+            return true
+        }
+    }
+    return false
+}
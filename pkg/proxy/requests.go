@@ -0,0 +1,123 @@
+package proxy
+
+import (
+    "net/url"
+    "path"
+    "regexp"
+    "strings"
+)
+
+// request is the version a registry request belongs to
+type request struct {
+    PackageType string
+    Name        string // as the packages API names it, without an npm scope
+    Version     string
+}
+
+// gemFile splits a gem file name into name and version, dropping any
+// platform suffix
+var gemFile = regexp.MustCompile(`^(.+?)-(\d[^-]*)(?:-.+)?\.gem$`)
+
+// isImmutable reports whether a registry path addresses an artifact that
+// never changes once published, as opposed to metadata listing versions
+func isImmutable(packageType, p string) bool {
+    switch packageType {
+    case "npm":
+        return strings.Contains(p, "/-/") || strings.HasPrefix(p, "/download/")
+    case "maven":
+        base := path.Base(p)
+        return strings.Contains(base, ".") && !strings.HasPrefix(base, "maven-metadata.xml") && !strings.Contains(p, "-SNAPSHOT/")
+    case "nuget":
+        return strings.Contains(p, "/download/") && strings.HasSuffix(p, ".nupkg")
+    case "rubygems":
+        return strings.Contains(p, "/gems/") && strings.HasSuffix(p, ".gem")
+    case "container":
+        return strings.Contains(p, "/blobs/sha256:") || strings.Contains(p, "/manifests/sha256:")
+    }
+    return false
+}
+
+// parseRequest finds the package and version an artifact path belongs to,
+// in each registry's layout
+func parseRequest(packageType, p string) (request, bool) {
+    req := request{PackageType: packageType}
+    var segments []string
+    for _, segment := range strings.Split(strings.Trim(p, "/"), "/") {
+        unescaped, err := url.PathUnescape(segment)
+        if err != nil {
+            return req, false
+        }
+        segments = append(segments, unescaped)
+    }
+
+    switch packageType {
+    case "npm":
+        // /download/@org/name/VERSION/HASH
+        if len(segments) == 5 && segments[0] == "download" {
+            req.Name, req.Version = segments[2], segments[3]
+            return req, true
+        }
+        // /@org/name/-/name-VERSION.tgz, the scope may be escaped with the name
+        dash := -1
+        for i, segment := range segments {
+            if segment == "-" {
+                dash = i
+                break
+            }
+        }
+        if dash < 1 || dash != len(segments)-2 {
+            return req, false
+        }
+        name := strings.Join(segments[:dash], "/")
+        if i := strings.Index(name, "/"); strings.HasPrefix(name, "@") && i > 0 {
+            name = name[i+1:]
+        }
+        file := strings.TrimSuffix(segments[dash+1], ".tgz")
+        if !strings.HasPrefix(file, path.Base(name)+"-") {
+            return req, false
+        }
+        req.Name, req.Version = name, strings.TrimPrefix(file, path.Base(name)+"-")
+        return req, true
+
+    case "maven":
+        // /org/group/parts/artifact/VERSION/file
+        if len(segments) < 5 || !isImmutable(packageType, p) {
+            return req, false
+        }
+        n := len(segments)
+        req.Name = strings.Join(segments[1:n-3], ".") + "." + segments[n-3]
+        req.Version = segments[n-2]
+        return req, true
+
+    case "nuget":
+        // /org/download/ID/VERSION/file.nupkg
+        if len(segments) != 5 || segments[1] != "download" {
+            return req, false
+        }
+        req.Name, req.Version = segments[2], segments[3]
+        return req, true
+
+    case "rubygems":
+        // /org/gems/name-VERSION.gem
+        if len(segments) != 3 || segments[1] != "gems" {
+            return req, false
+        }
+        match := gemFile.FindStringSubmatch(segments[2])
+        if match == nil {
+            return req, false
+        }
+        req.Name, req.Version = match[1], match[2]
+        return req, true
+
+    case "container":
+        // /v2/org/name/manifests/REFERENCE, the name may have slashes
+        n := len(segments)
+        if n < 5 || segments[n-2] != "manifests" {
+            return req, false
+        }
+        req.Name = strings.Join(segments[2:n-2], "/")
+        req.Version = segments[n-1]
+        return req, true
+    }
+    return req, false
+}
@@ -0,0 +1,96 @@
+package run
+
+import (
+    "fmt"
+    "io"
+    "log"
+    "os"
+    "strings"
+)
+
+// Arg is a flag the run was started with. Secrets are replaced with the
+// environment variable that can stand in for them
+type Arg struct {
+    Flag  string
+    Value string
+    Bool  bool // given without a value
+}
+
+var (
+    commandPath string
+    commandArgs []Arg
+    logFile     string
+)
+
+// SetCommand records how the run was started, so its summary can print
+// the commands that continue or check it
+func SetCommand(path string, args []Arg) {
+    commandPath = path
+    commandArgs = args
+}
+
+// Command renders the command the run was started with, less the flags in
+// without and followed by extra, for the user to copy
+func Command(without []string, extra ...Arg) string {
+    return CommandAs(commandPath, without, extra...)
+}
+
+// CommandAs renders the flags of Command for another command path, such
+// as the sync that applies what a plan command wrote
+func CommandAs(path string, without []string, extra ...Arg) string {
+    if path == "" {
+        return ""
+    }
+    dropped := make(map[string]bool, len(without))
+    for _, flag := range without {
+        dropped[flag] = true
+    }
+    var args []Arg
+    for _, arg := range commandArgs {
+        if !dropped[arg.Flag] {
+            args = append(args, arg)
+        }
+    }
+    return Invocation(path, append(args, extra...))
+}
+
+// Invocation renders the gh command path with args, quoted for a shell
+func Invocation(path string, args []Arg) string {
+    var b strings.Builder
+    b.WriteString("gh " + path)
+    for _, arg := range args {
+        fmt.Fprintf(&b, " --%s", arg.Flag)
+        if !arg.Bool {
+            b.WriteString(" " + quote(arg.Value))
+        }
+    }
+    return b.String()
+}
+
+// quote makes value one shell word. Environment variables stay expandable
+func quote(value string) string {
+    if value != "" && !strings.ContainsAny(value, " \t\n'\"\\*?[]<>|&;()#~`!") && !strings.Contains(value, "$") {
+        return value
+    }
+    if strings.HasPrefix(value, "$") && strings.Trim(value[1:], "ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789_") == "" {
+        return `"` + value + `"`
+    }
+    return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
+
+// OpenLog copies every log line to path as well as stderr, appending to
+// what earlier runs wrote there
+func OpenLog(path string) error {
+    file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+    if err != nil {
+        return fmt.Errorf("failed to open log file: %v", err)
+    }
+    log.SetOutput(io.MultiWriter(os.Stderr, file))
+    logFile = path
+    return nil
+}
+
+// LogFile is where log lines are copied to, if anywhere
+func LogFile() string {
+    return logFile
+}
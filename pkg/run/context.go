@@ -0,0 +1,60 @@
+package run
+
+import (
+    "context"
+    "fmt"
+    "os"
+    "os/signal"
+    "sync"
+    "sync/atomic"
+    "syscall"
+)
+
+var (
+    contextOnce sync.Once
+    runContext  context.Context
+    cancelRun   context.CancelFunc
+    graceful    atomic.Bool
+)
+
+// HandleSignals removes the staging directories when the run is
+// interrupted or sent SIGTERM, then exits. Commands that asked for Context
+// get the first signal as a cancellation instead, so they can stop at
+// their next checkpoint; a second one exits at once
+func HandleSignals() {
+    Context()
+    signals := make(chan os.Signal, 2)
+    signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+    go func() {
+        stopping := false
+        for sig := range signals {
+            if graceful.Load() && !stopping {
+                stopping = true
+                fmt.Fprintln(os.Stderr, "Stopping after the current step, interrupt again to stop now")
+                cancelRun()
+                continue
+            }
+            Cleanup()
+            if sig == syscall.SIGTERM {
+                os.Exit(143)
+            }
+            os.Exit(130)
+        }
+    }()
+}
+
+// Context returns the run context, cancelled by the first interrupt or
+// SIGTERM once HandleSignals is set up
+func Context() context.Context {
+    contextOnce.Do(func() {
+        runContext, cancelRun = context.WithCancel(context.Background())
+    })
+    return runContext
+}
+
+// StopOnSignal makes the first interrupt or SIGTERM cancel Context rather
+// than exit, for commands that check it between steps
+func StopOnSignal() context.Context {
+    graceful.Store(true)
+    return Context()
+}
@@ -0,0 +1,49 @@
+package run
+
+import (
+    "crypto/rand"
+    "encoding/hex"
+    "os"
+    "path/filepath"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/cvega/gh-migrate-packages/pkg/version"
+)
+
+var (
+    once sync.Once
+    id   string
+)
+
+// ID identifies this migration run in log lines, request headers, state
+// and report filenames, so concurrent or past runs can be told apart.
+// GHMP_RUN_ID overrides the generated one, e.g. to tie a run to a CI job
+func ID() string {
+    once.Do(func() {
+        if id = strings.TrimSpace(os.Getenv("GHMP_RUN_ID")); id != "" {
+            return
+        }
+
+        suffix := make([]byte, 3)
+        rand.Read(suffix)
+        id = time.Now().UTC().Format("20060102T150405Z") + "-" + hex.EncodeToString(suffix)
+    })
+    return id
+}
+
+// UserAgent is sent with every request so the run shows up in server logs
+func UserAgent() string {
+    return "gh-migrate-packages/" + version.Get().Version + " (run " + ID() + ")"
+}
+
+// ReportPath puts the run ID in a report filename before its extension,
+// e.g. excluded-files.csv becomes excluded-files-<id>.csv
+func ReportPath(path string) string {
+    if path == "" {
+        return ""
+    }
+    ext := filepath.Ext(path)
+    return strings.TrimSuffix(path, ext) + "-" + ID() + ext
+}
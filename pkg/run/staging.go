@@ -0,0 +1,199 @@
+package run
+
+import (
+    "errors"
+    "fmt"
+    "io/fs"
+    "os"
+    "path/filepath"
+    "runtime"
+    "sort"
+    "strconv"
+    "strings"
+    "sync"
+    "syscall"
+    "time"
+)
+
+// StagingPrefix starts the name of every directory a run stages files in
+const StagingPrefix = "ghmp-"
+
+var (
+    stagingMu sync.Mutex
+    staging   = make(map[string]bool)
+)
+
+// TempDir creates a staging directory for kind, e.g. "stage" or "verify",
+// in the system temp directory. It is named ghmp-<kind>-<pid>-<random> so
+// clean can tell it from a live run's, and removed by Cleanup if the run
+// ends or is interrupted before RemoveTempDir
+func TempDir(kind string) (string, error) {
+    dir, err := os.MkdirTemp("", fmt.Sprintf("%s%s-%d-*", StagingPrefix, kind, os.Getpid()))
+    if err != nil {
+        return "", err
+    }
+
+    stagingMu.Lock()
+    defer stagingMu.Unlock()
+    staging[dir] = true
+    return dir, nil
+}
+
+// RemoveTempDir removes a directory made by TempDir
+func RemoveTempDir(dir string) error {
+    stagingMu.Lock()
+    delete(staging, dir)
+    stagingMu.Unlock()
+    return os.RemoveAll(dir)
+}
+
+// Cleanup removes the staging directories this run still holds
+func Cleanup() {
+    stagingMu.Lock()
+    defer stagingMu.Unlock()
+    for dir := range staging {
+        os.RemoveAll(dir)
+        delete(staging, dir)
+    }
+}
+
+// Staged is staging data an earlier run left behind
+type Staged struct {
+    Path     string
+    Kind     string
+    PID      int // 0 when the name doesn't say, as with older versions
+    Size     int64
+    Modified time.Time
+}
+
+// Stale lists the staging directories whose run is over: those naming a
+// process that is no longer running, and those naming none that haven't
+// changed in olderThan. Directories of the current process are never stale
+func Stale(olderThan time.Duration) ([]Staged, error) {
+    root := os.TempDir()
+    entries, err := os.ReadDir(root)
+    if err != nil {
+        return nil, fmt.Errorf("failed to read %s: %v", root, err)
+    }
+
+    var stale []Staged
+    for _, entry := range entries {
+        if !entry.IsDir() {
+            continue
+        }
+        kind, pid, ok := parseStagingName(entry.Name())
+        if !ok || pid == os.Getpid() {
+            continue
+        }
+        info, err := entry.Info()
+        if err != nil {
+            continue
+        }
+        if pid != 0 && running(pid) {
+            continue
+        }
+        if pid == 0 && time.Since(info.ModTime()) < olderThan {
+            continue
+        }
+
+        path := filepath.Join(root, entry.Name())
+        stale = append(stale, Staged{Path: path, Kind: kind, PID: pid, Size: dirSize(path), Modified: info.ModTime()})
+    }
+    sort.Slice(stale, func(i, j int) bool {
+        return stale[i].Modified.Before(stale[j].Modified)
+    })
+    return stale, nil
+}
+
+// parseStagingName reads the kind and process ID from a staging directory
+// name. Older versions named them ghmp-<random>, ghmp-<kind>-<random>, or
+// gem-extract-<random>, without a process ID
+func parseStagingName(name string) (string, int, bool) {
+    if strings.HasPrefix(name, "gem-extract-") {
+        return "gem", 0, true
+    }
+    if !strings.HasPrefix(name, StagingPrefix) {
+        return "", 0, false
+    }
+    parts := strings.Split(strings.TrimPrefix(name, StagingPrefix), "-")
+    switch len(parts) {
+    case 1:
+        return "stage", 0, true
+    case 2:
+        return parts[0], 0, true
+    }
+    pid, err := strconv.Atoi(parts[1])
+    if err != nil || pid <= 0 {
+        return parts[0], 0, true
+    }
+    return parts[0], pid, true
+}
+
+// running reports whether process pid still exists
+func running(pid int) bool {
+    process, err := os.FindProcess(pid)
+    if err != nil {
+        return false
+    }
+    // Windows only finds running processes, and can't be sent signal 0
+    if runtime.GOOS == "windows" {
+        return true
+    }
+    err = process.Signal(syscall.Signal(0))
+    return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+// dirSize adds up the size of the files under dir
+func dirSize(dir string) int64 {
+    var size int64
+    filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+        if err != nil || d.IsDir() {
+            return nil
+        }
+        if info, err := d.Info(); err == nil {
+            size += info.Size()
+        }
+        return nil
+    })
+    return size
+}
+
+// Leftovers lists what interrupted runs can leave under dir, an export or
+// proxy cache directory, that hasn't changed in olderThan: the repacked
+// directories older versions wrote next to NuGet packages, and the proxy's
+// partial-* downloads
+func Leftovers(dir string, olderThan time.Duration) ([]Staged, error) {
+    var leftovers []Staged
+    err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+        if err != nil {
+            return err
+        }
+        kind := ""
+        switch {
+        case d.IsDir() && d.Name() == "repacked":
+            kind = "repacked"
+        case !d.IsDir() && strings.HasPrefix(d.Name(), "partial-"):
+            kind = "partial"
+        default:
+            return nil
+        }
+
+        info, err := d.Info()
+        if err != nil || time.Since(info.ModTime()) < olderThan {
+            return nil
+        }
+        size := info.Size()
+        if d.IsDir() {
+            size = dirSize(path)
+        }
+        leftovers = append(leftovers, Staged{Path: path, Kind: kind, Size: size, Modified: info.ModTime()})
+        if d.IsDir() {
+            return filepath.SkipDir
+        }
+        return nil
+    })
+    if err != nil {
+        return nil, fmt.Errorf("failed to read %s: %v", dir, err)
+    }
+    return leftovers, nil
+}
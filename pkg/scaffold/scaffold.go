@@ -0,0 +1,49 @@
+package scaffold
+
+import (
+    "embed"
+    "fmt"
+    "os"
+    "path/filepath"
+)
+
+//go:embed templates
+var templates embed.FS
+
+// files maps each template to where it goes in a new project
+var files = []struct {
+    template string
+    path     string
+}{
+    {"migrate-packages.yaml", "migrate-packages.yaml"},
+    {"mappings.csv", "mappings.csv"},
+    {"gitignore", ".gitignore"},
+    {"workflow.yml", filepath.Join(".github", "workflows", "migrate-packages.yml")},
+}
+
+// Create writes a starter migration project into dir: a config file, an
+// empty mapping file, a .gitignore for state and downloads, and a GitHub
+// Actions workflow. Existing files are left alone unless force is set; the
+// paths written are returned relative to dir
+func Create(dir string, force bool) ([]string, error) {
+    var written []string
+    for _, f := range files {
+        path := filepath.Join(dir, f.path)
+        if _, err := os.Stat(path); err == nil && !force {
+            continue
+        }
+
+        data, err := templates.ReadFile("templates/" + f.template)
+        if err != nil {
+            return written, fmt.Errorf("failed to read template %s: %v", f.template, err)
+        }
+        if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+            return written, fmt.Errorf("failed to create %s: %v", filepath.Dir(path), err)
+        }
+        if err := os.WriteFile(path, data, 0644); err != nil {
+            return written, fmt.Errorf("failed to write %s: %v", path, err)
+        }
+        written = append(written, f.path)
+    }
+    return written, nil
+}
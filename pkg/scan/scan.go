@@ -0,0 +1,271 @@
+package scan
+
+import (
+    "fmt"
+    "os"
+    "path/filepath"
+    "regexp"
+    "sort"
+    "strings"
+
+    "github.com/cvega/gh-migrate-packages/pkg/csvfile"
+    "github.com/pterm/pterm"
+    "github.com/spf13/viper"
+)
+
+// Finding is an image reference to the source registry found in a manifest
+type Finding struct {
+    File        string
+    Line        int
+    Reference   string
+    Replacement string // empty when the migration has no mapping for it
+}
+
+// ImageMap resolves source image references to their migrated location
+// using the digest map written by sync
+type ImageMap struct {
+    digests  map[string]string // registry/org/name@digest -> target@digest
+    tags     map[string]string // registry/org/name:tag -> target:tag
+    repos    map[string]string // registry/org/name -> target repository
+    prefixes []string          // registry/org/ of every source image
+}
+
+// Files that may carry image references in Kubernetes manifests and Helm charts
+var manifestExtensions = map[string]bool{
+    ".yaml": true,
+    ".yml":  true,
+    ".tpl":  true,
+}
+
+// LoadImageMap reads a digest map CSV produced by sync
+func LoadImageMap(filename string) (*ImageMap, error) {
+    file, err := os.Open(filename)
+    if err != nil {
+        return nil, fmt.Errorf("failed to open digest map: %v", err)
+    }
+    defer file.Close()
+
+    records, err := csvfile.NewReader(file).ReadAll()
+    if err != nil {
+        return nil, fmt.Errorf("failed to read digest map: %v", err)
+    }
+
+    m := &ImageMap{
+        digests: make(map[string]string),
+        tags:    make(map[string]string),
+        repos:   make(map[string]string),
+    }
+
+    seen := make(map[string]bool)
+    for i, record := range records {
+        if i == 0 || len(record) < 4 {
+            continue // Skip header row
+        }
+
+        // Repository names are case-insensitive, tags are not
+        sourceRepo, sourceDigest := splitDigest(record[0])
+        sourceRepo = strings.ToLower(sourceRepo)
+        targetRepo, _ := splitDigest(record[1])
+
+        m.digests[sourceRepo+"@"+sourceDigest] = record[1]
+        m.tags[sourceRepo+":"+record[2]] = targetRepo + ":" + record[3]
+        if _, exists := m.repos[sourceRepo]; !exists {
+            m.repos[sourceRepo] = targetRepo
+        }
+
+        if i := strings.LastIndex(sourceRepo, "/"); i >= 0 && !seen[sourceRepo[:i+1]] {
+            seen[sourceRepo[:i+1]] = true
+            m.prefixes = append(m.prefixes, sourceRepo[:i+1])
+        }
+    }
+
+    if len(m.prefixes) == 0 {
+        return nil, fmt.Errorf("digest map %s has no entries", filename)
+    }
+    sort.Strings(m.prefixes)
+
+    return m, nil
+}
+
+// Resolve returns the migrated reference for a source image reference
+func (m *ImageMap) Resolve(ref string) (string, bool) {
+    repo, digest := splitDigest(ref)
+    repo, tag := splitTag(repo)
+    repo = strings.ToLower(repo)
+
+    if digest != "" {
+        if target, ok := m.digests[repo+"@"+digest]; ok {
+            return target, true
+        }
+    }
+
+    if tag != "" {
+        if target, ok := m.tags[repo+":"+tag]; ok {
+            return target, true
+        }
+    }
+
+    // Unknown digests can't be rewritten, they were never migrated
+    target, ok := m.repos[repo]
+    if !ok || digest != "" {
+        return "", false
+    }
+    if tag != "" {
+        return target + ":" + tag, true
+    }
+    return target, true
+}
+
+// pattern matches any image in one of the source registry/org prefixes
+func (m *ImageMap) pattern() *regexp.Regexp {
+    quoted := make([]string, len(m.prefixes))
+    for i, prefix := range m.prefixes {
+        quoted[i] = regexp.QuoteMeta(prefix)
+    }
+    return regexp.MustCompile(`(?i)(?:` + strings.Join(quoted, "|") +
+        `)[a-z0-9][a-z0-9._/-]*(?::[a-z0-9_][a-z0-9_.-]{0,127})?(?:@sha256:[a-f0-9]{64})?`)
+}
+
+// ScanManifests walks root for YAML and Helm template files referencing
+// source images, rewriting them in place when rewrite is set
+func ScanManifests(root string, m *ImageMap, rewrite bool) ([]Finding, error) {
+    pattern := m.pattern()
+    var findings []Finding
+
+    err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+        if err != nil {
+            return err
+        }
+        if info.IsDir() {
+            if info.Name() == ".git" {
+                return filepath.SkipDir
+            }
+            return nil
+        }
+        if !manifestExtensions[strings.ToLower(filepath.Ext(path))] {
+            return nil
+        }
+
+        data, err := os.ReadFile(path)
+        if err != nil {
+            return fmt.Errorf("failed to read %s: %v", path, err)
+        }
+
+        lines := strings.Split(string(data), "\n")
+        changed := false
+        for i, line := range lines {
+            lines[i] = pattern.ReplaceAllStringFunc(line, func(ref string) string {
+                replacement, _ := m.Resolve(ref)
+                findings = append(findings, Finding{
+                    File:        path,
+                    Line:        i + 1,
+                    Reference:   ref,
+                    Replacement: replacement,
+                })
+                if rewrite && replacement != "" {
+                    changed = true
+                    return replacement
+                }
+                return ref
+            })
+        }
+
+        if changed {
+            if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")), info.Mode()); err != nil {
+                return fmt.Errorf("failed to rewrite %s: %v", path, err)
+            }
+        }
+        return nil
+    })
+    if err != nil {
+        return nil, err
+    }
+
+    return findings, nil
+}
+
+// ScanManifestsFromConfig runs the scan-manifests command
+func ScanManifestsFromConfig() error {
+    root := viper.GetString("MANIFEST_PATH")
+    rewrite := viper.GetBool("REWRITE")
+
+    imageMap, err := LoadImageMap(viper.GetString("DIGEST_MAP"))
+    if err != nil {
+        return err
+    }
+
+    spinner, _ := pterm.DefaultSpinner.Start(fmt.Sprintf("Scanning %s for source image references...", root))
+    findings, err := ScanManifests(root, imageMap, rewrite)
+    if err != nil {
+        spinner.Fail(err.Error())
+        return err
+    }
+    spinner.Success(fmt.Sprintf("Found %d source image references", len(findings)))
+
+    if len(findings) == 0 {
+        return nil
+    }
+
+    table := pterm.TableData{
+        {"File", "Line", "Reference", "Replacement"},
+    }
+    unmapped := 0
+    for _, f := range findings {
+        replacement := f.Replacement
+        if replacement == "" {
+            unmapped++
+            replacement = pterm.Yellow("not migrated")
+        }
+        table = append(table, []string{f.File, fmt.Sprintf("%d", f.Line), f.Reference, replacement})
+    }
+    pterm.DefaultTable.WithHasHeader().WithData(table).Render()
+
+    if output := viper.GetString("OUTPUT_FILE"); output != "" {
+        if err := writeFindings(output, findings); err != nil {
+            return err
+        }
+    }
+
+    if rewrite {
+        pterm.Info.Printf("Rewrote %d references, %d left unchanged\n", len(findings)-unmapped, unmapped)
+    }
+
+    return nil
+}
+
+func writeFindings(filename string, findings []Finding) error {
+    file, err := os.Create(filename)
+    if err != nil {
+        return fmt.Errorf("failed to create report: %v", err)
+    }
+    defer file.Close()
+
+    writer := csvfile.NewWriter(file)
+    defer writer.Flush()
+
+    if err := writer.Write([]string{"File", "Line", "Reference", "Replacement"}); err != nil {
+        return err
+    }
+    for _, f := range findings {
+        if err := writer.Write([]string{f.File, fmt.Sprintf("%d", f.Line), f.Reference, f.Replacement}); err != nil {
+            return err
+        }
+    }
+
+    return nil
+}
+
+func splitDigest(ref string) (string, string) {
+    if i := strings.Index(ref, "@"); i >= 0 {
+        return ref[:i], ref[i+1:]
+    }
+    return ref, ""
+}
+
+func splitTag(repo string) (string, string) {
+    i := strings.LastIndex(repo, ":")
+    if i < 0 || strings.Contains(repo[i:], "/") {
+        return repo, ""
+    }
+    return repo[:i], repo[i+1:]
+}
@@ -0,0 +1,48 @@
+package schema
+
+import (
+    "embed"
+    "fmt"
+    "strings"
+)
+
+//go:embed schemas
+var schemas embed.FS
+
+// Schema is the JSON Schema of one machine-readable output
+type Schema struct {
+    Name        string
+    Description string
+    Files       string // outputs the schema describes
+}
+
+// All lists the published schemas. A schema only gains optional fields
+// within a major version, so tooling built on one keeps working
+var All = []Schema{
+    {"archive", "One archived version in an archive manifest", "ARCHIVE_PATH/archive-manifest.jsonl"},
+    {"export", "Packages with their versions and files", "export --format json"},
+    {"export-manifest", "Checksums of the files in an export archive", "manifest.json in export --archive"},
+    {"inventory", "Packages and versions inventory in JSON", "convert --to json"},
+    {"metadata", "Manifest of a downloaded version", "DOWNLOAD_PATH/TYPE/NAME/VERSION/metadata.json"},
+    {"migration-plan", "Actions a sync will take, unsigned or as the payload of its DSSE envelope", "plan --out, sync --plan-file"},
+    {"plan", "Version snapshot of a plan", "export --snapshot, sync --snapshot"},
+    {"state", "One line of a checkpoint state file", "export-state.jsonl, sync-state.jsonl"},
+}
+
+// Names returns the names of the published schemas
+func Names() []string {
+    names := make([]string, len(All))
+    for i, s := range All {
+        names[i] = s.Name
+    }
+    return names
+}
+
+// Get returns the JSON Schema document published as name
+func Get(name string) ([]byte, error) {
+    data, err := schemas.ReadFile("schemas/" + name + ".schema.json")
+    if err != nil {
+        return nil, fmt.Errorf("unknown schema %q, expected one of %s", name, strings.Join(Names(), ", "))
+    }
+    return data, nil
+}
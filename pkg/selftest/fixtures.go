@@ -0,0 +1,257 @@
+package selftest
+
+import (
+    "archive/tar"
+    "archive/zip"
+    "bytes"
+    "compress/gzip"
+    "encoding/json"
+    "fmt"
+    "os"
+    "path/filepath"
+    "sort"
+    "strings"
+    "time"
+)
+
+const (
+    fixtureVersion = "1.0.0"
+    mavenGroup     = "com.github.ghmp"
+)
+
+// fixture is a tiny package published to the source for one type
+type fixture struct {
+    packageType string
+    name        string // as the packages API lists it
+    files       []string
+}
+
+// fixtureName names the fixture of packageType for this run, unique so
+// concurrent or failed runs don't collide
+func fixtureName(packageType, suffix string) string {
+    if packageType == "maven" {
+        return mavenGroup + ".selftest-" + suffix
+    }
+    return "ghmp-selftest-" + suffix
+}
+
+// writeFixture writes the files UploadPackageVersion publishes for
+// packageType into dir
+func writeFixture(dir, packageType, org, suffix string) (fixture, error) {
+    f := fixture{packageType: packageType, name: fixtureName(packageType, suffix)}
+    dir = filepath.Join(dir, packageType)
+    if err := os.MkdirAll(dir, 0755); err != nil {
+        return f, fmt.Errorf("failed to create fixture directory: %v", err)
+    }
+
+    var err error
+    switch packageType {
+    case "npm":
+        f.files, err = npmFixture(dir, "@"+strings.ToLower(org)+"/"+f.name)
+    case "maven":
+        f.files, err = mavenFixture(dir, "selftest-"+suffix)
+    case "nuget":
+        f.files, err = nugetFixture(dir, f.name)
+    case "rubygems":
+        f.files, err = gemFixture(dir, f.name)
+    case "container":
+        f.files, err = containerFixture(dir)
+    default:
+        err = fmt.Errorf("no fixture for %s packages", packageType)
+    }
+    if err != nil {
+        return f, fmt.Errorf("failed to write %s fixture: %v", packageType, err)
+    }
+    return f, nil
+}
+
+func npmFixture(dir, name string) ([]string, error) {
+    manifest, err := json.MarshalIndent(map[string]interface{}{
+        "name":        name,
+        "version":     fixtureVersion,
+        "description": "Fixture published by gh migrate-packages selftest",
+        "main":        "index.js",
+    }, "", "  ")
+    if err != nil {
+        return nil, err
+    }
+
+    packageJSON := filepath.Join(dir, "package.json")
+    if err := os.WriteFile(packageJSON, manifest, 0644); err != nil {
+        return nil, err
+    }
+    tarball := filepath.Join(dir, "package.tgz")
+    err = writeTarGz(tarball, map[string][]byte{
+        "package/package.json": manifest,
+        "package/index.js":     []byte("module.exports = 'selftest'\n"),
+    })
+    return []string{packageJSON, tarball}, err
+}
+
+func mavenFixture(dir, artifactID string) ([]string, error) {
+    pom := fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<project xmlns="http://maven.apache.org/POM/4.0.0">
+  <modelVersion>4.0.0</modelVersion>
+  <groupId>%s</groupId>
+  <artifactId>%s</artifactId>
+  <version>%s</version>
+  <packaging>pom</packaging>
+  <description>Fixture published by gh migrate-packages selftest</description>
+</project>
+`, mavenGroup, artifactID, fixtureVersion)
+    path := filepath.Join(dir, fmt.Sprintf("%s-%s.pom", artifactID, fixtureVersion))
+    return []string{path}, os.WriteFile(path, []byte(pom), 0644)
+}
+
+func nugetFixture(dir, id string) ([]string, error) {
+    nuspec := fmt.Sprintf(`<?xml version="1.0" encoding="utf-8"?>
+<package xmlns="http://schemas.microsoft.com/packaging/2013/05/nuspec.xsd">
+  <metadata>
+    <id>%s</id>
+    <version>%s</version>
+    <authors>gh-migrate-packages</authors>
+    <description>Fixture published by gh migrate-packages selftest</description>
+  </metadata>
+</package>
+`, id, fixtureVersion)
+    contentTypes := `<?xml version="1.0" encoding="utf-8"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"><Default Extension="nuspec" ContentType="application/octet" /></Types>
+`
+
+    path := filepath.Join(dir, fmt.Sprintf("%s.%s.nupkg", id, fixtureVersion))
+    var buf bytes.Buffer
+    archive := zip.NewWriter(&buf)
+    for _, entry := range []struct{ name, content string }{
+        {id + ".nuspec", nuspec},
+        {"[Content_Types].xml", contentTypes},
+    } {
+        w, err := archive.Create(entry.name)
+        if err != nil {
+            return nil, err
+        }
+        if _, err := w.Write([]byte(entry.content)); err != nil {
+            return nil, err
+        }
+    }
+    if err := archive.Close(); err != nil {
+        return nil, err
+    }
+    return []string{path}, os.WriteFile(path, buf.Bytes(), 0644)
+}
+
+// gemFixture builds a gem by hand: a tar of the gzipped YAML gemspec and
+// a gzipped tar of the (empty) contents
+func gemFixture(dir, name string) ([]string, error) {
+    spec := fmt.Sprintf(`--- !ruby/object:Gem::Specification
+name: %s
+version: !ruby/object:Gem::Version
+  version: %s
+platform: ruby
+authors:
+- gh-migrate-packages
+bindir: bin
+cert_chain: []
+date: %s
+dependencies: []
+description: Fixture published by gh migrate-packages selftest
+executables: []
+extensions: []
+extra_rdoc_files: []
+files: []
+licenses: []
+metadata: {}
+rdoc_options: []
+require_paths:
+- lib
+required_ruby_version: !ruby/object:Gem::Requirement
+  requirements:
+  - - ">="
+    - !ruby/object:Gem::Version
+      version: '0'
+required_rubygems_version: !ruby/object:Gem::Requirement
+  requirements:
+  - - ">="
+    - !ruby/object:Gem::Version
+      version: '0'
+requirements: []
+rubygems_version: 3.4.10
+specification_version: 4
+summary: gh migrate-packages selftest fixture
+test_files: []
+`, name, fixtureVersion, time.Now().UTC().Format("2006-01-02 00:00:00.000000000 Z"))
+
+    metadata, err := gzipBytes([]byte(spec))
+    if err != nil {
+        return nil, err
+    }
+    data, err := tarGzBytes(nil)
+    if err != nil {
+        return nil, err
+    }
+
+    path := filepath.Join(dir, fmt.Sprintf("%s-%s.gem", name, fixtureVersion))
+    var buf bytes.Buffer
+    if err := writeTar(&buf, map[string][]byte{"metadata.gz": metadata, "data.tar.gz": data}); err != nil {
+        return nil, err
+    }
+    return []string{path}, os.WriteFile(path, buf.Bytes(), 0644)
+}
+
+// containerFixture is a single layer holding one file
+func containerFixture(dir string) ([]string, error) {
+    path := filepath.Join(dir, "layer.tar.gz")
+    return []string{path}, writeTarGz(path, map[string][]byte{
+        "selftest.txt": []byte("gh migrate-packages selftest\n"),
+    })
+}
+
+func writeTarGz(path string, files map[string][]byte) error {
+    data, err := tarGzBytes(files)
+    if err != nil {
+        return err
+    }
+    return os.WriteFile(path, data, 0644)
+}
+
+func tarGzBytes(files map[string][]byte) ([]byte, error) {
+    var buf bytes.Buffer
+    if err := writeTar(&buf, files); err != nil {
+        return nil, err
+    }
+    return gzipBytes(buf.Bytes())
+}
+
+func gzipBytes(data []byte) ([]byte, error) {
+    var buf bytes.Buffer
+    gz := gzip.NewWriter(&buf)
+    if _, err := gz.Write(data); err != nil {
+        return nil, err
+    }
+    if err := gz.Close(); err != nil {
+        return nil, err
+    }
+    return buf.Bytes(), nil
+}
+
+func writeTar(buf *bytes.Buffer, files map[string][]byte) error {
+    tw := tar.NewWriter(buf)
+    for _, name := range sortedNames(files) {
+        header := &tar.Header{Name: name, Mode: 0644, Size: int64(len(files[name])), ModTime: time.Now()}
+        if err := tw.WriteHeader(header); err != nil {
+            return err
+        }
+        if _, err := tw.Write(files[name]); err != nil {
+            return err
+        }
+    }
+    return tw.Close()
+}
+
+func sortedNames(files map[string][]byte) []string {
+    names := make([]string, 0, len(files))
+    for name := range files {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+    return names
+}
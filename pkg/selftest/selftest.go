@@ -0,0 +1,299 @@
+package selftest
+
+import (
+    "fmt"
+    "os"
+    "path/filepath"
+    "strings"
+    "time"
+
+    "github.com/cvega/gh-migrate-packages/pkg/api"
+    "github.com/cvega/gh-migrate-packages/pkg/export"
+    "github.com/cvega/gh-migrate-packages/pkg/run"
+    "github.com/cvega/gh-migrate-packages/pkg/snapshot"
+    "github.com/cvega/gh-migrate-packages/pkg/sync"
+    "github.com/cvega/gh-migrate-packages/pkg/verify"
+    "github.com/pterm/pterm"
+    "github.com/spf13/viper"
+)
+
+// Types are the package types with a fixture, in the order they run
+var Types = []string{"npm", "maven", "nuget", "rubygems", "container"}
+
+const (
+    listingTimeout = 2 * time.Minute // how long published fixtures may take to be listed
+    listingPoll    = 5 * time.Second
+)
+
+// step is one stage of the run as the summary table shows it
+type step struct {
+    name     string
+    err      error
+    duration time.Duration
+    detail   string
+}
+
+// RunFromConfig publishes a fixture of each type to a scratch source
+// organization, runs export, sync, and verify against it and the scratch
+// target, and deletes the fixtures from both afterwards unless --keep is
+// set. Both organizations must be disposable: the fixtures are the only
+// packages migrated, but they are published and deleted for real
+func RunFromConfig() error {
+    sourceOrg := viper.GetString("SOURCE_ORGANIZATION")
+    targetOrg := viper.GetString("TARGET_ORGANIZATION")
+    if strings.EqualFold(sourceOrg, targetOrg) {
+        return fmt.Errorf("source and target organization must differ")
+    }
+
+    types := Types
+    if packageType := viper.GetString("PACKAGE_TYPE"); packageType != "" {
+        types = []string{packageType}
+    }
+
+    source := api.NewAPI(viper.GetString("SOURCE_TOKEN"), viper.GetString("SOURCE_HOSTNAME"))
+    target := api.NewAPI(viper.GetString("TARGET_TOKEN"), "")
+
+    dir, err := run.TempDir("selftest")
+    if err != nil {
+        return fmt.Errorf("failed to create working directory: %v", err)
+    }
+
+    // The run ID makes the fixture names unique to this run
+    suffix := run.ID()[strings.LastIndex(run.ID(), "-")+1:]
+    pterm.Info.Printf("Self-test run %s: %s -> %s, working in %s\n", run.ID(), sourceOrg, targetOrg, dir)
+    if chaos := viper.GetString("CHAOS"); chaos != "" {
+        pterm.Info.Printf("The sync step fails or pauses %s of its target requests on purpose, expect it and verify to report failures\n", chaos)
+    }
+
+    var steps []*step
+    var published []fixture
+    defer func() {
+        if viper.GetBool("KEEP") {
+            pterm.Info.Printf("Keeping fixtures and %s for inspection\n", dir)
+        } else {
+            steps = append(steps, timed("cleanup", func() (string, error) {
+                return cleanup(source, target, sourceOrg, targetOrg, published), run.RemoveTempDir(dir)
+            }))
+        }
+        renderSteps(steps)
+    }()
+
+    steps = append(steps, timed("publish", func() (string, error) {
+        var failed []string
+        for _, packageType := range types {
+            f, err := writeFixture(dir, packageType, sourceOrg, suffix)
+            if err == nil {
+                err = source.UploadPackageVersion(api.UploadOptions{
+                    Organization: sourceOrg,
+                    PackageName:  f.name,
+                    Version:      fixtureVersion,
+                    PackageType:  packageType,
+                    Files:        f.files,
+                })
+            }
+            if err != nil {
+                pterm.Error.Printf("Failed to publish %s fixture %s: %v\n", packageType, f.name, err)
+                failed = append(failed, packageType)
+                continue
+            }
+            published = append(published, f)
+        }
+        detail := fmt.Sprintf("%d of %d fixtures published", len(published), len(types))
+        if len(failed) > 0 {
+            return detail, fmt.Errorf("failed to publish %s fixtures", strings.Join(failed, ", "))
+        }
+        return detail, nil
+    }))
+    if len(published) == 0 {
+        return fmt.Errorf("self-test failed: no fixture could be published")
+    }
+
+    var listed []api.Package
+    steps = append(steps, timed("list", func() (string, error) {
+        listed, err = waitForListing(source, sourceOrg, published)
+        return fmt.Sprintf("%d of %d fixtures listed in %s", len(listed), len(published), sourceOrg), err
+    }))
+    if len(listed) == 0 {
+        return fmt.Errorf("self-test failed: no fixture was listed in %s", sourceOrg)
+    }
+
+    snapshotPath := filepath.Join(dir, "snapshot.json")
+    steps = append(steps, timed("export", func() (string, error) {
+        viper.Set("OUTPUT_FILE", filepath.Join(dir, sourceOrg))
+        viper.Set("DOWNLOAD_PATH", filepath.Join(dir, "downloads"))
+        viper.Set("SNAPSHOT", snapshotPath)
+        result, err := export.CreateCSVs()
+        if err != nil {
+            return "", err
+        }
+        detail := fmt.Sprintf("%d versions exported, %d downloads failed", result.VersionsExported, result.DownloadsFailed)
+        if result.DownloadsFailed > 0 {
+            return detail, fmt.Errorf("%d downloads failed", result.DownloadsFailed)
+        }
+        // Only the fixtures are migrated, whatever else the source holds
+        return detail, narrowSnapshot(snapshotPath, listed)
+    }))
+
+    provenancePath := filepath.Join(dir, "provenance.jsonl")
+    steps = append(steps, timed("sync", func() (string, error) {
+        mustMigrate := filepath.Join(dir, "must-migrate.txt")
+        if err := writeMustMigrate(mustMigrate, listed); err != nil {
+            return "", err
+        }
+        viper.Set("PROVENANCE", provenancePath)
+        viper.Set("MUST_MIGRATE", mustMigrate)
+        return fmt.Sprintf("%d fixtures migrated to %s", len(listed), targetOrg), sync.SyncPackages()
+    }))
+
+    steps = append(steps, timed("verify", func() (string, error) {
+        viper.Set("VERIFY_SAMPLE", "")
+        viper.Set("VERIFY_FULL", "")
+        viper.Set("VERIFY_REPORT", "")
+        return "target digests checked against the provenance log", verify.VerifyFromConfig()
+    }))
+
+    var failed []string
+    for _, s := range steps {
+        if s.err != nil {
+            failed = append(failed, s.name)
+        }
+    }
+    if len(failed) > 0 {
+        return fmt.Errorf("self-test failed at %s", strings.Join(failed, ", "))
+    }
+    pterm.Success.Printf("Self-test passed for %s\n", strings.Join(types, ", "))
+    return nil
+}
+
+// timed runs fn as the named step, printing its outcome as it finishes
+func timed(name string, fn func() (string, error)) *step {
+    pterm.DefaultSection.Println("Self-test: " + name)
+    start := time.Now()
+    detail, err := fn()
+    s := &step{name: name, err: err, duration: time.Since(start).Round(time.Second), detail: detail}
+    if err != nil {
+        pterm.Error.Printf("Self-test step %s failed: %v\n", name, err)
+    }
+    return s
+}
+
+func renderSteps(steps []*step) {
+    table := pterm.TableData{
+        {"Step", "Status", "Duration", "Detail"},
+    }
+    for _, s := range steps {
+        status, detail := "passed", s.detail
+        if s.err != nil {
+            status = "failed"
+            detail = strings.TrimPrefix(strings.Join([]string{detail, s.err.Error()}, ": "), ": ")
+        }
+        table = append(table, []string{s.name, status, s.duration.String(), detail})
+    }
+    pterm.Println()
+    pterm.DefaultTable.WithHasHeader().WithData(table).Render()
+}
+
+// waitForListing polls the source until every published fixture is listed
+// with its version, since new packages take a moment to show up
+func waitForListing(source *api.API, org string, published []fixture) ([]api.Package, error) {
+    deadline := time.Now().Add(listingTimeout)
+    for {
+        var listed []api.Package
+        var missing []string
+        for _, f := range published {
+            p, err := findFixture(source, org, f)
+            if err != nil {
+                return nil, err
+            }
+            if p == nil {
+                missing = append(missing, f.packageType+":"+f.name)
+                continue
+            }
+            listed = append(listed, *p)
+        }
+        if len(missing) == 0 {
+            return listed, nil
+        }
+        if time.Now().After(deadline) {
+            return listed, fmt.Errorf("not listed after %s: %s", listingTimeout, strings.Join(missing, ", "))
+        }
+        time.Sleep(listingPoll)
+    }
+}
+
+func findFixture(client *api.API, org string, f fixture) (*api.Package, error) {
+    packages, err := client.GetOrganizationPackages(org, f.packageType)
+    if err != nil {
+        return nil, fmt.Errorf("failed to list %s packages: %v", f.packageType, err)
+    }
+    for _, p := range packages {
+        if p.Name == f.name && len(p.Versions) > 0 {
+            return &p, nil
+        }
+    }
+    return nil, nil
+}
+
+// narrowSnapshot keeps only the fixtures in the snapshot export wrote, so
+// sync leaves anything else in the scratch source alone
+func narrowSnapshot(path string, fixtures []api.Package) error {
+    snap, err := snapshot.Load(path)
+    if err != nil {
+        return err
+    }
+    keep := make(map[string]bool)
+    for _, p := range fixtures {
+        keep[p.PackageType+"/"+p.Name] = true
+    }
+    var packages []snapshot.Package
+    for _, p := range snap.Packages {
+        if keep[p.PackageType+"/"+p.Name] {
+            packages = append(packages, p)
+        }
+    }
+    if len(packages) < len(fixtures) {
+        return fmt.Errorf("export listed %d of %d fixtures", len(packages), len(fixtures))
+    }
+    snap.Packages = packages
+    return snap.Save(path)
+}
+
+// writeMustMigrate lists every fixture for sync --must-migrate, so a
+// fixture that doesn't land in the target fails the sync step
+func writeMustMigrate(path string, fixtures []api.Package) error {
+    var lines []string
+    for _, p := range fixtures {
+        lines = append(lines, p.PackageType+":"+p.Name)
+    }
+    if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+        return fmt.Errorf("failed to write must-migrate file: %v", err)
+    }
+    return nil
+}
+
+// cleanup deletes the fixtures from both organizations, carrying on past
+// failures so as much as possible is removed. Fixtures that never reached
+// the target are only deleted from the source
+func cleanup(source, target *api.API, sourceOrg, targetOrg string, published []fixture) string {
+    deleted, failed := 0, 0
+    for _, f := range published {
+        for _, org := range []struct {
+            client *api.API
+            name   string
+        }{{source, sourceOrg}, {target, targetOrg}} {
+            if p, err := findFixture(org.client, org.name, f); err == nil && p == nil {
+                continue
+            }
+            if err := org.client.DeletePackage(org.name, f.packageType, f.name); err != nil {
+                pterm.Warning.Printf("Failed to clean up %s %s in %s: %v\n", f.packageType, f.name, org.name, err)
+                failed++
+                continue
+            }
+            deleted++
+        }
+    }
+    if failed > 0 {
+        return fmt.Sprintf("%d fixtures deleted, %d left behind", deleted, failed)
+    }
+    return fmt.Sprintf("%d fixtures deleted", deleted)
+}
@@ -0,0 +1,317 @@
+package smoke
+
+import (
+    "bytes"
+    "context"
+    "encoding/base64"
+    "encoding/json"
+    "encoding/xml"
+    "fmt"
+    "io"
+    "math/rand"
+    "os"
+    "os/exec"
+    "path/filepath"
+    "sort"
+    "strings"
+    "time"
+
+    "github.com/cvega/gh-migrate-packages/pkg/api"
+    "github.com/cvega/gh-migrate-packages/pkg/csvfile"
+    "github.com/cvega/gh-migrate-packages/pkg/run"
+)
+
+// Smoke test statuses
+const (
+    StatusPassed  = "passed"
+    StatusFailed  = "failed"
+    StatusSkipped = "skipped" // no test for the type, or its client isn't installed
+)
+
+const (
+    npmRegistry = "https://npm.pkg.github.com"
+    timeout     = 2 * time.Minute
+)
+
+// Target is a migrated version to resolve from the target registry
+type Target struct {
+    PackageType  string
+    Organization string
+    Name         string
+    Version      string
+}
+
+// Result is the outcome of resolving one target with its ecosystem's client
+type Result struct {
+    Target
+    Status   string
+    Command  string // as run, with the token redacted
+    Duration time.Duration
+    Detail   string
+}
+
+// Select picks count targets at random, in a stable order
+func Select(targets []Target, count int, seed int64) []Target {
+    picked := append([]Target(nil), targets...)
+    sort.Slice(picked, func(i, j int) bool {
+        if picked[i].PackageType != picked[j].PackageType {
+            return picked[i].PackageType < picked[j].PackageType
+        }
+        return picked[i].Name < picked[j].Name
+    })
+    if count >= len(picked) {
+        return picked
+    }
+    rng := rand.New(rand.NewSource(seed))
+    rng.Shuffle(len(picked), func(i, j int) { picked[i], picked[j] = picked[j], picked[i] })
+    return picked[:count]
+}
+
+// Tester runs the clients consumers use (npm, mvn, docker, nuget, gem)
+// against the target, authenticated with the target token through
+// configuration files in a scratch directory, never the user's own
+type Tester struct {
+    target *api.API
+    token  string
+    dir    string
+}
+
+// NewTester prepares client configuration for the target; Close removes it
+func NewTester(target *api.API, token string) (*Tester, error) {
+    dir, err := run.TempDir("smoke")
+    if err != nil {
+        return nil, fmt.Errorf("failed to create smoke test directory: %v", err)
+    }
+    t := &Tester{target: target, token: token, dir: dir}
+    if err := t.writeDockerConfig(); err != nil {
+        t.Close()
+        return nil, err
+    }
+    return t, nil
+}
+
+func (t *Tester) Close() error {
+    return run.RemoveTempDir(t.dir)
+}
+
+// Run resolves target with its ecosystem's client
+func (t *Tester) Run(target Target) Result {
+    result := Result{Target: target}
+
+    command, env, check, err := t.command(target)
+    if err != nil {
+        result.Status = StatusFailed
+        result.Detail = err.Error()
+        return result
+    }
+    if command == nil {
+        result.Status = StatusSkipped
+        result.Detail = fmt.Sprintf("no smoke test for %s packages", target.PackageType)
+        return result
+    }
+    result.Command = t.redact(strings.Join(command, " "))
+    if _, err := exec.LookPath(command[0]); err != nil {
+        result.Status = StatusSkipped
+        result.Detail = fmt.Sprintf("%s not found in PATH", command[0])
+        return result
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), timeout)
+    defer cancel()
+    cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+    cmd.Dir = t.dir
+    cmd.Env = append(os.Environ(), env...)
+    var stdout, output bytes.Buffer
+    cmd.Stdout = io.MultiWriter(&stdout, &output)
+    cmd.Stderr = &output
+
+    start := time.Now()
+    err = cmd.Run()
+    result.Duration = time.Since(start)
+
+    if err == nil && check != nil {
+        err = check(stdout.String())
+    }
+    if err != nil {
+        result.Status = StatusFailed
+        result.Detail = t.redact(summarize(err, output.String()))
+        return result
+    }
+    result.Status = StatusPassed
+    return result
+}
+
+// command returns the command line resolving target, extra environment,
+// and an optional check of its output. A nil command means the type has
+// no smoke test
+func (t *Tester) command(target Target) ([]string, []string, func(string) error, error) {
+    switch target.PackageType {
+    case "npm":
+        npmrc, err := t.writeNpmrc(target.Organization)
+        if err != nil {
+            return nil, nil, nil, err
+        }
+        name := target.Name
+        if !strings.HasPrefix(name, "@") {
+            name = "@" + strings.ToLower(target.Organization) + "/" + name
+        }
+        return []string{"npm", "view", name + "@" + target.Version, "version",
+            "--registry", npmRegistry, "--userconfig", npmrc}, nil, expectOutput(target.Version), nil
+
+    case "maven":
+        i := strings.LastIndex(target.Name, ".")
+        if i <= 0 || i == len(target.Name)-1 {
+            return nil, nil, nil, fmt.Errorf("maven package %s is not named groupId.artifactId", target.Name)
+        }
+        settings, err := t.writeMavenSettings()
+        if err != nil {
+            return nil, nil, nil, err
+        }
+        // The POM exists for every packaging, a scratch local repository
+        // makes sure it comes from the target
+        return []string{"mvn", "-B", "-q", "-s", settings,
+            "-Dmaven.repo.local=" + filepath.Join(t.dir, "m2"),
+            "dependency:get", "-Dtransitive=false",
+            fmt.Sprintf("-Dartifact=%s:%s:%s:pom", target.Name[:i], target.Name[i+1:], target.Version),
+            fmt.Sprintf("-DremoteRepositories=github::default::https://maven.pkg.github.com/%s/*", target.Organization),
+        }, nil, nil, nil
+
+    case "container":
+        reference := ":" + target.Version
+        if strings.HasPrefix(target.Version, "sha256:") {
+            reference = "@" + target.Version
+        }
+        image := fmt.Sprintf("%s/%s/%s%s", t.target.ContainerRegistry(), strings.ToLower(target.Organization), target.Name, reference)
+        return []string{"docker", "manifest", "inspect", image},
+            []string{"DOCKER_CONFIG=" + filepath.Join(t.dir, "docker")}, nil, nil
+
+    case "nuget":
+        config, err := t.writeNuGetConfig(target.Organization)
+        if err != nil {
+            return nil, nil, nil, err
+        }
+        return []string{"nuget", "list", target.Name, "-Source", "github", "-ConfigFile", config,
+            "-AllVersions", "-Prerelease", "-NonInteractive"}, nil, expectOutput(target.Version), nil
+
+    case "rubygems":
+        source := t.target.PackageURL(target.Organization, target.PackageType, target.Name)
+        if strings.HasPrefix(source, "https://rubygems.pkg.github.com/") {
+            source = "https://x:" + t.token + "@" + strings.TrimPrefix(source, "https://")
+        }
+        return []string{"gem", "fetch", target.Name, "-v", target.Version,
+            "--clear-sources", "--source", source}, nil, nil, nil
+    }
+    return nil, nil, nil, nil
+}
+
+// expectOutput fails a command that succeeded without printing version
+func expectOutput(version string) func(string) error {
+    return func(output string) error {
+        if !strings.Contains(strings.ToLower(output), strings.ToLower(version)) {
+            return fmt.Errorf("version %s not listed", version)
+        }
+        return nil
+    }
+}
+
+func (t *Tester) writeNpmrc(org string) (string, error) {
+    path := filepath.Join(t.dir, "npmrc")
+    content := fmt.Sprintf("@%s:registry=%s\n//npm.pkg.github.com/:_authToken=%s\n", strings.ToLower(org), npmRegistry, t.token)
+    if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+        return "", fmt.Errorf("failed to write npm configuration: %v", err)
+    }
+    return path, nil
+}
+
+func (t *Tester) writeMavenSettings() (string, error) {
+    var token bytes.Buffer
+    xml.EscapeText(&token, []byte(t.token))
+    path := filepath.Join(t.dir, "settings.xml")
+    content := fmt.Sprintf(`<settings><servers><server><id>github</id><username>x</username><password>%s</password></server></servers></settings>`, token.String())
+    if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+        return "", fmt.Errorf("failed to write Maven settings: %v", err)
+    }
+    return path, nil
+}
+
+func (t *Tester) writeNuGetConfig(org string) (string, error) {
+    var source, token bytes.Buffer
+    xml.EscapeText(&source, []byte(fmt.Sprintf("https://nuget.pkg.github.com/%s/index.json", org)))
+    xml.EscapeText(&token, []byte(t.token))
+    path := filepath.Join(t.dir, "NuGet.Config")
+    content := fmt.Sprintf(`<?xml version="1.0" encoding="utf-8"?>
+<configuration>
+  <packageSources><clear /><add key="github" value="%s" /></packageSources>
+  <packageSourceCredentials><github><add key="Username" value="x" /><add key="ClearTextPassword" value="%s" /></github></packageSourceCredentials>
+</configuration>
+`, source.String(), token.String())
+    if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+        return "", fmt.Errorf("failed to write NuGet configuration: %v", err)
+    }
+    return path, nil
+}
+
+func (t *Tester) writeDockerConfig() error {
+    dir := filepath.Join(t.dir, "docker")
+    if err := os.MkdirAll(dir, 0700); err != nil {
+        return fmt.Errorf("failed to write Docker configuration: %v", err)
+    }
+    config := map[string]interface{}{
+        "auths": map[string]interface{}{
+            t.target.ContainerRegistry(): map[string]string{
+                "auth": base64.StdEncoding.EncodeToString([]byte("x:" + t.token)),
+            },
+        },
+    }
+    data, err := json.Marshal(config)
+    if err != nil {
+        return fmt.Errorf("failed to encode Docker configuration: %v", err)
+    }
+    if err := os.WriteFile(filepath.Join(dir, "config.json"), data, 0600); err != nil {
+        return fmt.Errorf("failed to write Docker configuration: %v", err)
+    }
+    return nil
+}
+
+func (t *Tester) redact(s string) string {
+    if t.token == "" {
+        return s
+    }
+    return strings.ReplaceAll(s, t.token, "***")
+}
+
+// summarize keeps the last line of output, usually the client's error
+func summarize(err error, output string) string {
+    lines := strings.Split(strings.TrimSpace(output), "\n")
+    last := strings.TrimSpace(lines[len(lines)-1])
+    if last == "" {
+        return err.Error()
+    }
+    if len(last) > 300 {
+        last = last[:300] + "..."
+    }
+    return fmt.Sprintf("%v: %s", err, last)
+}
+
+// WriteReport writes results as CSV
+func WriteReport(filename string, results []Result) error {
+    file, err := os.Create(filename)
+    if err != nil {
+        return err
+    }
+    defer file.Close()
+
+    writer := csvfile.NewWriter(file)
+    defer writer.Flush()
+
+    if err := writer.Write([]string{"Type", "Package", "Version", "Status", "Command", "Duration (ms)", "Detail"}); err != nil {
+        return err
+    }
+    for _, r := range results {
+        row := []string{r.PackageType, r.Name, r.Version, r.Status, r.Command, fmt.Sprintf("%d", r.Duration.Milliseconds()), r.Detail}
+        if err := writer.Write(row); err != nil {
+            return err
+        }
+    }
+    return nil
+}
@@ -0,0 +1,199 @@
+package snapshot
+
+import (
+    "encoding/json"
+    "fmt"
+    "os"
+    "time"
+
+    "github.com/cvega/gh-migrate-packages/pkg/csvfile"
+    "github.com/cvega/gh-migrate-packages/pkg/package"
+    "github.com/cvega/gh-migrate-packages/pkg/run"
+)
+
+// Snapshot is the version list of a plan, taken by export and replayed by
+// sync so the apply works on exactly what was planned. Versions published
+// in between are surfaced instead of silently changing the totals
+type Snapshot struct {
+    RunID    string    `json:"run_id"`
+    TakenAt  time.Time `json:"taken_at"`
+    Packages []Package `json:"packages"`
+}
+
+// Package is one package as it was listed at snapshot time
+type Package struct {
+    Organization string    `json:"organization"`
+    PackageType  string    `json:"package_type"`
+    Name         string    `json:"name"`
+    Versions     []Version `json:"versions"`
+}
+
+type Version struct {
+    ID   string `json:"id"`
+    Name string `json:"name"`
+}
+
+// LateVersion is a version the source lists that the snapshot doesn't
+type LateVersion struct {
+    Organization string
+    PackageType  string
+    PackageName  string
+    Version      string
+    CreatedAt    string
+}
+
+// New starts an empty snapshot stamped with this run
+func New() *Snapshot {
+    return &Snapshot{RunID: run.ID(), TakenAt: time.Now().UTC()}
+}
+
+// Add records org's packages and every version they list
+func (s *Snapshot) Add(org string, packages []pkg.Package) {
+    for _, p := range packages {
+        entry := Package{Organization: org, PackageType: p.PackageType, Name: p.Name}
+        for _, v := range p.Versions {
+            entry.Versions = append(entry.Versions, Version{ID: v.ID, Name: v.Name})
+        }
+        s.Packages = append(s.Packages, entry)
+    }
+}
+
+// Save writes the snapshot to path as JSON
+func (s *Snapshot) Save(path string) error {
+    data, err := json.MarshalIndent(s, "", "  ")
+    if err != nil {
+        return fmt.Errorf("failed to encode snapshot: %v", err)
+    }
+    if err := os.WriteFile(path, data, 0644); err != nil {
+        return fmt.Errorf("failed to write snapshot: %v", err)
+    }
+    return nil
+}
+
+// Load reads a snapshot written by Save
+func Load(path string) (*Snapshot, error) {
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return nil, fmt.Errorf("failed to read snapshot: %v", err)
+    }
+    var s Snapshot
+    if err := json.Unmarshal(data, &s); err != nil {
+        return nil, fmt.Errorf("failed to parse snapshot %s: %v", path, err)
+    }
+    return &s, nil
+}
+
+// Covers reports whether the snapshot listed any package of org
+func (s *Snapshot) Covers(org string) bool {
+    for _, p := range s.Packages {
+        if p.Organization == org {
+            return true
+        }
+    }
+    return false
+}
+
+// Freeze narrows packages listed now in org to the versions the snapshot
+// holds, and returns the versions published since as late. Packages and
+// versions deleted since simply drop out, there is nothing to migrate
+func (s *Snapshot) Freeze(org string, packages []pkg.Package) ([]pkg.Package, []LateVersion) {
+    known := s.versionIDs(org)
+
+    var frozen []pkg.Package
+    var late []LateVersion
+    for _, p := range packages {
+        ids, listed := known[p.PackageType+"/"+p.Name]
+
+        var versions []pkg.Version
+        for _, v := range p.Versions {
+            if ids[v.ID] {
+                versions = append(versions, v)
+                continue
+            }
+            late = append(late, lateVersion(org, p, v))
+        }
+
+        // A package created after the snapshot isn't part of the plan at all
+        if !listed {
+            continue
+        }
+        p.Versions = versions
+        frozen = append(frozen, p)
+    }
+    return frozen, late
+}
+
+// Unlisted narrows packages listed now in org to the versions the snapshot
+// doesn't hold, dropping packages with none, so the versions published
+// since can be migrated on their own
+func (s *Snapshot) Unlisted(org string, packages []pkg.Package) ([]pkg.Package, []LateVersion) {
+    known := s.versionIDs(org)
+
+    var unlisted []pkg.Package
+    var late []LateVersion
+    for _, p := range packages {
+        ids := known[p.PackageType+"/"+p.Name]
+
+        var versions []pkg.Version
+        for _, v := range p.Versions {
+            if !ids[v.ID] {
+                versions = append(versions, v)
+                late = append(late, lateVersion(org, p, v))
+            }
+        }
+        if len(versions) == 0 {
+            continue
+        }
+        p.Versions = versions
+        unlisted = append(unlisted, p)
+    }
+    return unlisted, late
+}
+
+// versionIDs indexes the snapshot's version IDs of org by type/name
+func (s *Snapshot) versionIDs(org string) map[string]map[string]bool {
+    known := make(map[string]map[string]bool)
+    for _, p := range s.Packages {
+        if p.Organization != org {
+            continue
+        }
+        ids := make(map[string]bool, len(p.Versions))
+        for _, v := range p.Versions {
+            ids[v.ID] = true
+        }
+        known[p.PackageType+"/"+p.Name] = ids
+    }
+    return known
+}
+
+func lateVersion(org string, p pkg.Package, v pkg.Version) LateVersion {
+    return LateVersion{
+        Organization: org,
+        PackageType:  p.PackageType,
+        PackageName:  p.Name,
+        Version:      v.Name,
+        CreatedAt:    v.CreatedAt,
+    }
+}
+
+// WriteLateVersions lists late versions as CSV for a follow-up delta sync
+func WriteLateVersions(path string, late []LateVersion) error {
+    file, err := os.Create(path)
+    if err != nil {
+        return fmt.Errorf("failed to create late publish report: %v", err)
+    }
+    defer file.Close()
+
+    writer := csvfile.NewWriter(file)
+    defer writer.Flush()
+
+    if err := writer.Write([]string{"Organization", "Type", "Package", "Version", "Created At"}); err != nil {
+        return err
+    }
+    for _, v := range late {
+        if err := writer.Write([]string{v.Organization, v.PackageType, v.PackageName, v.Version, v.CreatedAt}); err != nil {
+            return err
+        }
+    }
+    return nil
+}
@@ -0,0 +1,180 @@
+package sync
+
+import (
+    "encoding/json"
+    "fmt"
+    "os"
+    "path/filepath"
+    "time"
+
+    "github.com/cvega/gh-migrate-packages/pkg/api"
+    "github.com/cvega/gh-migrate-packages/pkg/filter"
+    "github.com/cvega/gh-migrate-packages/pkg/run"
+)
+
+// ArchiveManifestName is the manifest kept at the root of an archive
+const ArchiveManifestName = "archive-manifest.jsonl"
+
+// ArchiveEntry is one line of the archive manifest: a version kept in cold
+// storage instead of the target, and where to find its files
+type ArchiveEntry struct {
+    PackageType  string        `json:"package_type"`
+    Organization string        `json:"organization"`
+    Package      string        `json:"package"`
+    Version      string        `json:"version"`
+    VersionID    string        `json:"version_id"`
+    CreatedAt    string        `json:"created_at"`
+    Path         string        `json:"path"` // relative to the archive root
+    Files        []ArchiveFile `json:"files"`
+    Size         int64         `json:"size"`
+    ArchivedAt   time.Time     `json:"archived_at"`
+    RunID        string        `json:"run_id"`
+}
+
+type ArchiveFile struct {
+    Name   string `json:"name"` // relative to the version directory
+    Size   int64  `json:"size"`
+    SHA256 string `json:"sha256"`
+}
+
+// Archive stores versions older than a cutoff in the layout export uses
+// for downloads, TYPE/NAME/VERSION with a metadata.json, and appends each
+// one to the manifest as soon as its files are on disk
+type Archive struct {
+    dir      string
+    age      filter.Age
+    cutoff   time.Time
+    manifest *os.File
+    count    int
+    size     int64
+}
+
+// OpenArchive archives into dir the versions created more than age ago.
+// The manifest is appended to, so resumed runs add to it
+func OpenArchive(dir string, age filter.Age) (*Archive, error) {
+    if err := os.MkdirAll(dir, 0755); err != nil {
+        return nil, fmt.Errorf("failed to create archive directory: %v", err)
+    }
+    manifest, err := os.OpenFile(filepath.Join(dir, ArchiveManifestName), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+    if err != nil {
+        return nil, fmt.Errorf("failed to open archive manifest: %v", err)
+    }
+    return &Archive{dir: dir, age: age, cutoff: age.Cutoff(time.Now()), manifest: manifest}, nil
+}
+
+// Covers reports whether v is old enough to be archived. Versions without
+// a readable creation date stay live
+func (a *Archive) Covers(v api.Version) bool {
+    created, err := time.Parse(time.RFC3339, v.CreatedAt)
+    if err != nil {
+        return false
+    }
+    return created.Before(a.cutoff)
+}
+
+// Store downloads v into the archive and records it in the manifest
+func (a *Archive) Store(source *api.API, org string, p api.Package, v api.Version) (*ArchiveEntry, error) {
+    rel := filepath.Join(p.PackageType, p.Name, v.Name)
+    if !filepath.IsLocal(rel) {
+        return nil, fmt.Errorf("version %s of %s can't be stored under the archive", v.Name, p.Name)
+    }
+    versionDir := filepath.Join(a.dir, rel)
+    if err := os.MkdirAll(versionDir, 0755); err != nil {
+        return nil, fmt.Errorf("failed to create archive directory: %v", err)
+    }
+
+    files, err := source.DownloadPackageVersion(org, p, v, versionDir)
+    if err != nil {
+        return nil, fmt.Errorf("failed to download: %v", err)
+    }
+
+    entry := ArchiveEntry{
+        PackageType:  p.PackageType,
+        Organization: org,
+        Package:      p.Name,
+        Version:      v.Name,
+        VersionID:    v.ID,
+        CreatedAt:    v.CreatedAt,
+        Path:         filepath.ToSlash(rel),
+        ArchivedAt:   time.Now().UTC(),
+        RunID:        run.ID(),
+    }
+    for _, file := range files {
+        name, err := filepath.Rel(versionDir, file)
+        if err != nil {
+            name = filepath.Base(file)
+        }
+        info, err := os.Stat(file)
+        if err != nil {
+            return nil, fmt.Errorf("failed to stat %s: %v", name, err)
+        }
+        digest, err := api.FileSHA256(file)
+        if err != nil {
+            return nil, fmt.Errorf("failed to hash %s: %v", name, err)
+        }
+        entry.Files = append(entry.Files, ArchiveFile{Name: filepath.ToSlash(name), Size: info.Size(), SHA256: digest})
+        entry.Size += info.Size()
+    }
+
+    if err := writeArchiveMetadata(filepath.Join(versionDir, "metadata.json"), p, v); err != nil {
+        return nil, fmt.Errorf("failed to write metadata: %v", err)
+    }
+
+    line, err := json.Marshal(entry)
+    if err != nil {
+        return nil, fmt.Errorf("failed to encode manifest entry: %v", err)
+    }
+    if _, err := a.manifest.Write(append(line, '\n')); err != nil {
+        return nil, fmt.Errorf("failed to write archive manifest: %v", err)
+    }
+    a.count++
+    a.size += entry.Size
+    return &entry, nil
+}
+
+// Count returns the versions archived by this run and their total size
+func (a *Archive) Count() (int, int64) {
+    return a.count, a.size
+}
+
+func (a *Archive) Close() error {
+    return a.manifest.Close()
+}
+
+// writeArchiveMetadata writes the metadata.json export keeps next to every
+// downloaded version, so archives and export downloads read the same
+func writeArchiveMetadata(path string, p api.Package, v api.Version) error {
+    metadata := map[string]interface{}{
+        "package": map[string]interface{}{
+            "id":         p.ID,
+            "name":       p.Name,
+            "type":       p.PackageType,
+            "repository": p.Repository,
+            "statistics": p.Statistics,
+            "visibility": p.Visibility,
+            "owner": map[string]interface{}{
+                "login": p.Owner.Login,
+                "type":  p.Owner.Type,
+            },
+        },
+        "version": map[string]interface{}{
+            "id":         v.ID,
+            "name":       v.Name,
+            "created_at": v.CreatedAt,
+            "updated_at": v.UpdatedAt,
+            "files":      v.Files,
+            "metadata":   v.Metadata,
+        },
+        "exported_at": time.Now().UTC(),
+    }
+
+    file, err := os.Create(path)
+    if err != nil {
+        return err
+    }
+    defer file.Close()
+
+    encoder := json.NewEncoder(file)
+    encoder.SetIndent("", "  ")
+    return encoder.Encode(metadata)
+}
@@ -0,0 +1,59 @@
+package sync
+
+import (
+    "log"
+
+    "github.com/cvega/gh-migrate-packages/pkg/api"
+    "github.com/pterm/pterm"
+)
+
+// attachedCopies counts the signatures, attestations and SBOMs copied
+// alongside the migrated images
+type attachedCopies struct {
+    copied  int
+    skipped int
+    failed  int
+}
+
+// copyAttached copies the artifacts attached to a migrated image to its
+// target, through the target's referrers API when it has one and cosign's
+// tag schema otherwise, so the strategy follows each GHES version
+func (s *PackageSync) copyAttached(mapping *DigestMapping, sourceOrg, sourceName, targetOrg, targetName string, copies *attachedCopies) {
+    attached, err := s.sourceAPI.ListAttached(sourceOrg, sourceName, mapping.SourceDigest)
+    if err != nil {
+        log.Printf("Error listing artifacts attached to %s@%s: %v", sourceName, mapping.SourceDigest, err)
+        copies.failed++
+        return
+    }
+    if len(attached) == 0 {
+        return
+    }
+
+    strategy := s.targetAPI.ReferrersStrategy(targetOrg, targetName)
+    for _, artifact := range attached {
+        if strategy != api.ReferrersAPI && artifact.Kind == "" {
+            log.Printf("Skipping %s attached to %s@%s, %s has no tag to fall back to", artifact.Digest, sourceName, mapping.SourceDigest, artifact.ArtifactType)
+            copies.skipped++
+            continue
+        }
+        err := s.targetAPI.CopyAttached(s.sourceAPI, sourceOrg, sourceName, artifact, targetOrg, targetName, mapping.TargetDigest, strategy)
+        if err != nil {
+            log.Printf("Error copying %s attached to %s@%s: %v", artifact.Digest, sourceName, mapping.SourceDigest, err)
+            copies.failed++
+            continue
+        }
+        log.Printf("Copied %s attached to %s@%s to %s@%s", artifact.Digest, sourceName, mapping.SourceDigest, targetName, mapping.TargetDigest)
+        copies.copied++
+    }
+}
+
+// report prints what copyAttached did over the run
+func (c *attachedCopies) report() {
+    if c.copied == 0 && c.skipped == 0 && c.failed == 0 {
+        return
+    }
+    pterm.Info.Printf("Attached artifacts: %d copied, %d skipped, %d failed\n", c.copied, c.skipped, c.failed)
+    if c.failed > 0 {
+        pterm.Warning.Printf("Some signatures or attestations were not copied, see the log\n")
+    }
+}
@@ -0,0 +1,47 @@
+package sync
+
+import (
+    "fmt"
+
+    "github.com/spf13/viper"
+    "github.com/cvega/gh-migrate-packages/pkg/filter"
+    "github.com/cvega/gh-migrate-packages/pkg/transport"
+)
+
+// Where a budgeted run records its progress unless --checkpoint says otherwise
+const defaultCheckpoint = "sync-state.jsonl"
+
+// budgetFromConfig builds the transfer and API call budget shared by the
+// source and target clients
+func budgetFromConfig() (*transport.Budget, error) {
+    var maxBytes int64
+    if s := viper.GetString("MAX_TRANSFER"); s != "" {
+        size, err := filter.ParseSize(s)
+        if err != nil {
+            return nil, fmt.Errorf("invalid --max-transfer: %v", err)
+        }
+        maxBytes = size
+    }
+
+    maxCalls := viper.GetInt64("MAX_API_CALLS")
+    if maxCalls < 0 {
+        return nil, fmt.Errorf("invalid --max-api-calls: %d", maxCalls)
+    }
+
+    return transport.NewBudget(maxBytes, maxCalls), nil
+}
+
+// checkpointPath returns the sync checkpoint to resume from, if any. A
+// budgeted run always gets one so the next run continues where it stopped
+func checkpointPath(budget *transport.Budget) string {
+    if path := viper.GetString("RESUME"); path != "" {
+        return path
+    }
+    if path := viper.GetString("CHECKPOINT"); path != "" {
+        return path
+    }
+    if budget.Limited() {
+        return defaultCheckpoint
+    }
+    return ""
+}
@@ -0,0 +1,271 @@
+package sync
+
+import (
+    "fmt"
+    "sort"
+    "strings"
+
+    "github.com/cvega/gh-migrate-packages/pkg/api"
+    "github.com/cvega/gh-migrate-packages/pkg/checkpoint"
+    "github.com/cvega/gh-migrate-packages/pkg/filter"
+    "github.com/cvega/gh-migrate-packages/pkg/package"
+    "github.com/pterm/pterm"
+    "github.com/spf13/viper"
+)
+
+// DeletableTypes are the package types hosted by GitHub Packages, the only
+// ones the REST deletion endpoints reach
+var DeletableTypes = []string{
+    string(pkg.PackageTypeContainer),
+    string(pkg.PackageTypeNpm),
+    string(pkg.PackageTypeMaven),
+    string(pkg.PackageTypeNuGet),
+    string(pkg.PackageTypeRubyGems),
+}
+
+// Deletion is a package or version cleanup removes from the target
+type Deletion struct {
+    Package  string
+    Version  string // empty when the whole package goes
+    ID       int64
+    Versions int // of the package, when the whole package goes
+    entries  []checkpoint.Entry
+}
+
+// scopedPackage is what cleanup was asked to delete from one target
+// package: every version passing the filter, or just the named ones, with
+// the state file entries that migrated them
+type scopedPackage struct {
+    whole    bool
+    versions map[string][]checkpoint.Entry
+}
+
+type cleanupScope map[string]*scopedPackage
+
+// CleanupTarget deletes packages or versions from the target organization,
+// so a failed or partial migration can be rolled back before it is retried.
+// Source names are mapped to target names with the mapping file sync used
+func CleanupTarget() error {
+    targetOrg := viper.GetString("TARGET_ORGANIZATION")
+    packageType := viper.GetString("PACKAGE_TYPE")
+    dryRun := viper.GetBool("DRY_RUN")
+
+    s := NewPackageSync("", viper.GetString("TARGET_TOKEN"), "")
+    if err := s.LoadMappings(viper.GetString("MAPPING_FILE")); err != nil {
+        return err
+    }
+    versionFilter, err := filter.FromConfig(packageType)
+    if err != nil {
+        return fmt.Errorf("invalid version filter: %v", err)
+    }
+
+    names, err := s.targetAPI.ListPackageNames(targetOrg, packageType)
+    if err != nil {
+        return err
+    }
+    existing := make(map[string]bool, len(names))
+    for _, name := range names {
+        existing[name] = true
+    }
+
+    // A state file scopes the cleanup to what a sync run migrated
+    var state *checkpoint.Checkpoint
+    scope := make(cleanupScope)
+    if path := viper.GetString("CLEANUP_STATE"); path != "" {
+        if state, err = checkpoint.Open(path); err != nil {
+            return err
+        }
+        defer state.Close()
+        runID := viper.GetString("CLEANUP_RUN_ID")
+        for _, entry := range state.Entries() {
+            if entry.PackageType != packageType || entry.Target == "" || (runID != "" && entry.RunID != runID) {
+                continue
+            }
+            name, version := splitTarget(entry.Target)
+            scope.add(name, version, entry)
+        }
+    }
+
+    versions := splitList(viper.GetString("CLEANUP_VERSIONS"))
+    for _, source := range splitList(viper.GetString("CLEANUP_PACKAGES")) {
+        if len(versions) == 0 {
+            scope.add(s.getTargetPackageName(source), "", checkpoint.Entry{})
+            continue
+        }
+        for _, version := range versions {
+            name, target := s.getTargetVersion(source, version)
+            scope.add(name, target, checkpoint.Entry{})
+        }
+    }
+    if viper.GetBool("CLEANUP_ALL") {
+        for _, name := range names {
+            scope.add(name, "", checkpoint.Entry{})
+        }
+    }
+
+    spinner, _ := pterm.DefaultSpinner.Start("Planning the cleanup...")
+    deletions, missing, err := s.planCleanup(targetOrg, packageType, scope, existing, versionFilter)
+    if err != nil {
+        spinner.Fail(err.Error())
+        return err
+    }
+    spinner.Success(fmt.Sprintf("Found %d deletions in %s", len(deletions), targetOrg))
+    for _, name := range missing {
+        pterm.Warning.Printf("%s isn't in %s, nothing to delete\n", name, targetOrg)
+    }
+    if len(deletions) == 0 {
+        return nil
+    }
+
+    table := pterm.TableData{{"Package", "Version", "Deletes"}}
+    for _, d := range deletions {
+        if d.Version == "" {
+            table = append(table, []string{d.Package, "", fmt.Sprintf("the package with %d versions", d.Versions)})
+            continue
+        }
+        table = append(table, []string{d.Package, d.Version, "the version"})
+    }
+    pterm.DefaultTable.WithHasHeader().WithData(table).Render()
+    if dryRun {
+        pterm.Info.Printf("Dry run, nothing was deleted from %s\n", targetOrg)
+        return nil
+    }
+
+    deleted, failed := 0, 0
+    for _, d := range deletions {
+        if d.Version == "" {
+            err = s.targetAPI.DeletePackage(targetOrg, packageType, d.Package)
+        } else {
+            err = s.targetAPI.DeletePackageVersion(targetOrg, packageType, d.Package, d.ID)
+        }
+        if err != nil {
+            pterm.Warning.Println(err)
+            failed++
+            continue
+        }
+        deleted++
+
+        // The next run migrates the removed versions again
+        for _, entry := range d.entries {
+            if err := state.MarkRemoved(entry); err != nil {
+                pterm.Warning.Printf("Failed to record the removal of %s in the state file: %v\n", entry.Target, err)
+            }
+        }
+    }
+
+    pterm.Info.Printf("Cleanup Summary:\n")
+    pterm.Info.Printf("- Deleted: %d\n", deleted)
+    pterm.Info.Printf("- Failed: %d\n", failed)
+    if failed > 0 {
+        return fmt.Errorf("%d of %d deletions failed", failed, len(deletions))
+    }
+    return nil
+}
+
+// planCleanup resolves scope against the target's packages and versions.
+// A package loses all of its versions by being deleted whole, as GitHub
+// won't delete the last version of a package
+func (s *PackageSync) planCleanup(org, packageType string, scope cleanupScope, existing map[string]bool, versionFilter *filter.Filter) ([]Deletion, []string, error) {
+    var names []string
+    for name := range scope {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+
+    var deletions []Deletion
+    var missing []string
+    for _, name := range names {
+        if !existing[name] {
+            missing = append(missing, name)
+            continue
+        }
+        listed, err := s.targetAPI.ListPackageVersions(org, packageType, name)
+        if err != nil {
+            return nil, nil, err
+        }
+
+        wanted := scope[name]
+        var selected []Deletion
+        for _, v := range listed {
+            var entries []checkpoint.Entry
+            matched := false
+            for _, label := range append([]string{v.Name}, v.Tags...) {
+                if found, ok := wanted.versions[label]; ok {
+                    matched = true
+                    entries = append(entries, found...)
+                    continue
+                }
+                if wanted.whole {
+                    ok, err := versionFilter.Allows(packageType, label)
+                    if err != nil {
+                        return nil, nil, err
+                    }
+                    matched = matched || ok
+                }
+            }
+            if matched {
+                selected = append(selected, Deletion{Package: name, Version: versionLabel(v), ID: v.ID, entries: entries})
+            }
+        }
+
+        if len(selected) > 0 && len(selected) == len(listed) {
+            whole := Deletion{Package: name, Versions: len(listed)}
+            for _, d := range selected {
+                whole.entries = append(whole.entries, d.entries...)
+            }
+            deletions = append(deletions, whole)
+            continue
+        }
+        deletions = append(deletions, selected...)
+    }
+    return deletions, missing, nil
+}
+
+// add puts a whole package, or one of its versions, in the scope
+func (scope cleanupScope) add(name, version string, entry checkpoint.Entry) {
+    wanted, ok := scope[name]
+    if !ok {
+        wanted = &scopedPackage{versions: make(map[string][]checkpoint.Entry)}
+        scope[name] = wanted
+    }
+    switch {
+    case version == "":
+        wanted.whole = true
+    case entry.Target != "":
+        wanted.versions[version] = append(wanted.versions[version], entry)
+    default:
+        if _, ok := wanted.versions[version]; !ok {
+            wanted.versions[version] = nil
+        }
+    }
+}
+
+// splitTarget splits the name:version a checkpoint records a version as
+// migrated under. Maven names contain ':' and container digests do too
+func splitTarget(target string) (string, string) {
+    if i := strings.Index(target, ":sha256:"); i >= 0 {
+        return target[:i], target[i+1:]
+    }
+    if i := strings.LastIndex(target, ":"); i >= 0 {
+        return target[:i], target[i+1:]
+    }
+    return target, ""
+}
+
+// versionLabel names a version in the plan, by its tags when it has any
+func versionLabel(v api.PackageVersion) string {
+    if len(v.Tags) > 0 {
+        return strings.Join(v.Tags, ", ")
+    }
+    return v.Name
+}
+
+func splitList(value string) []string {
+    var list []string
+    for _, item := range strings.Split(value, ";") {
+        if item = strings.TrimSpace(item); item != "" {
+            list = append(list, item)
+        }
+    }
+    return list
+}
@@ -0,0 +1,113 @@
+package sync
+
+import (
+    "fmt"
+    "sort"
+    "strings"
+
+    "github.com/pterm/pterm"
+    "github.com/cvega/gh-migrate-packages/pkg/api"
+)
+
+// Kinds of package name conflicts
+const (
+    ConflictCollapse  = "collapse"   // several source packages map to one target
+    ConflictCrossType = "cross-type" // one name exists under several package types
+)
+
+// NameConflict describes packages that would clash on the target
+type NameConflict struct {
+    Kind        string
+    PackageType string
+    TargetName  string
+    Sources     []string
+}
+
+// FindConflicts checks the source packages and name mappings for targets
+// that more than one source would be written to
+func (s *PackageSync) FindConflicts(packages []api.Package) []NameConflict {
+    targets := make(map[string][]string)  // type + target name -> sources
+    versions := make(map[string][]string) // type + target name:tag -> sources
+    types := make(map[string][]string)    // name -> types
+
+    for _, p := range packages {
+        targetName := s.getTargetPackageName(p.Name)
+        targets[p.PackageType+"\x00"+targetName] = append(targets[p.PackageType+"\x00"+targetName], p.Name)
+        types[p.Name] = append(types[p.Name], p.PackageType)
+
+        for _, v := range p.Versions {
+            name, tag := s.getTargetVersion(p.Name, v.Name)
+            key := p.PackageType + "\x00" + name + ":" + tag
+            versions[key] = append(versions[key], p.Name+":"+v.Name)
+        }
+    }
+
+    var conflicts []NameConflict
+    for _, group := range []map[string][]string{targets, versions} {
+        for key, sources := range group {
+            if len(sources) < 2 {
+                continue
+            }
+            parts := strings.SplitN(key, "\x00", 2)
+            sort.Strings(sources)
+            conflicts = append(conflicts, NameConflict{
+                Kind:        ConflictCollapse,
+                PackageType: parts[0],
+                TargetName:  parts[1],
+                Sources:     sources,
+            })
+        }
+    }
+
+    for name, pkgTypes := range types {
+        if len(pkgTypes) < 2 {
+            continue
+        }
+        sort.Strings(pkgTypes)
+        conflicts = append(conflicts, NameConflict{
+            Kind:        ConflictCrossType,
+            PackageType: strings.Join(pkgTypes, ", "),
+            TargetName:  s.getTargetPackageName(name),
+            Sources:     []string{name},
+        })
+    }
+
+    sort.Slice(conflicts, func(i, j int) bool {
+        if conflicts[i].Kind != conflicts[j].Kind {
+            return conflicts[i].Kind < conflicts[j].Kind
+        }
+        return conflicts[i].TargetName < conflicts[j].TargetName
+    })
+    return conflicts
+}
+
+// reportConflicts prints the conflicts and returns an error if any of them
+// would lose data on the target
+func reportConflicts(conflicts []NameConflict) error {
+    if len(conflicts) == 0 {
+        return nil
+    }
+
+    table := pterm.TableData{
+        {"Conflict", "Type", "Target", "Sources"},
+    }
+
+    collapses := 0
+    for _, c := range conflicts {
+        kind := pterm.Yellow(c.Kind)
+        if c.Kind == ConflictCollapse {
+            collapses++
+            kind = pterm.Red(c.Kind)
+        }
+        table = append(table, []string{kind, c.PackageType, c.TargetName, strings.Join(c.Sources, ", ")})
+    }
+    pterm.DefaultTable.WithHasHeader().WithData(table).Render()
+
+    // The same name under different types is legal, but name-only mappings apply to all of them
+    if collapses == 0 {
+        pterm.Warning.Println("Some package names exist under more than one package type; mappings for them apply to every type")
+        return nil
+    }
+
+    return fmt.Errorf("%d target names would receive more than one source package or version, fix the mapping file", collapses)
+}
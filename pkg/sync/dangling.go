@@ -0,0 +1,88 @@
+package sync
+
+import (
+    "log"
+    "sort"
+    "strconv"
+
+    "github.com/cvega/gh-migrate-packages/pkg/api"
+    "github.com/cvega/gh-migrate-packages/pkg/filter"
+    "github.com/pterm/pterm"
+)
+
+// reportDangling lists the untagged versions of the migrated container
+// packages and the size of the blobs only they hold, which earlier failed
+// or repeated runs leave behind when a tag is pushed again. With cleanup,
+// the untagged versions a run of this tool pushed are deleted; versions
+// without its run ID annotation are only counted
+func (s *PackageSync) reportDangling(targetOrg string, names map[string]bool, cleanup bool) {
+    if len(names) == 0 {
+        return
+    }
+    sorted := make([]string, 0, len(names))
+    for name := range names {
+        sorted = append(sorted, name)
+    }
+    sort.Strings(sorted)
+
+    table := pterm.TableData{
+        {"Package", "Untagged", "Pushed By This Tool", "Unreferenced Blobs", "Size"},
+    }
+    var ours []api.DanglingVersion
+    var oursSize int64
+    for _, name := range sorted {
+        dangling, err := s.targetAPI.FindDanglingVersions(targetOrg, name)
+        if err != nil {
+            log.Printf("Error looking for untagged versions of %s: %v", name, err)
+            continue
+        }
+        if len(dangling) == 0 {
+            continue
+        }
+        tool, blobs := 0, 0
+        var size int64
+        for _, d := range dangling {
+            blobs += len(d.Blobs)
+            size += d.Size
+            if d.RunID != "" {
+                tool++
+                ours = append(ours, d)
+                oursSize += d.Size
+            }
+        }
+        table = append(table, []string{name, strconv.Itoa(len(dangling)), strconv.Itoa(tool), strconv.Itoa(blobs), filter.FormatSize(size)})
+    }
+    if len(table) == 1 {
+        return
+    }
+
+    pterm.Println()
+    pterm.DefaultSection.Println("Dangling container versions")
+    pterm.DefaultTable.WithHasHeader().WithData(table).Render()
+    if len(ours) == 0 {
+        pterm.Info.Println("No untagged version was pushed by this tool, nothing to clean up")
+        return
+    }
+    if !cleanup {
+        pterm.Warning.Printf("%d untagged versions pushed by this tool hold %s no tag references, rerun with --cleanup-dangling to delete them\n",
+            len(ours), filter.FormatSize(oursSize))
+        return
+    }
+
+    deleted := 0
+    var freed int64
+    for _, d := range ours {
+        if err := s.targetAPI.DeletePackageVersion(targetOrg, "container", d.PackageName, d.ID); err != nil {
+            log.Printf("Error deleting untagged %s@%s from run %s: %v", d.PackageName, d.Digest, d.RunID, err)
+            continue
+        }
+        log.Printf("Deleted untagged %s@%s from run %s", d.PackageName, d.Digest, d.RunID)
+        deleted++
+        freed += d.Size
+    }
+    if deleted < len(ours) {
+        pterm.Warning.Printf("Deleted %d of %d untagged versions pushed by this tool (%s), see the log for the rest\n", deleted, len(ours), filter.FormatSize(freed))
+        return
+    }
+    pterm.Success.Printf("Deleted %d untagged versions pushed by this tool (%s)\n", deleted, filter.FormatSize(freed))
+}
@@ -0,0 +1,127 @@
+package sync
+
+import (
+    "os"
+    "sort"
+    "strings"
+
+    "github.com/cvega/gh-migrate-packages/pkg/api"
+    "github.com/cvega/gh-migrate-packages/pkg/csvfile"
+)
+
+// DuplicateVersion is a source version whose content the target already
+// holds under its new name, left behind by an earlier partial migration
+type DuplicateVersion struct {
+    PackageType string
+    SourceName  string
+    Version     string
+    TargetName  string
+    Existing    string // target version with the same content
+}
+
+// targetInventory indexes the target's versions by the digest set of their files
+type targetInventory struct {
+    packages map[string]bool              // target package names
+    digests  map[string]map[string]string // package -> digest set -> version
+}
+
+// loadTargetInventory lists what the target organization already holds,
+// only needed when packages are renamed on their way over
+func (s *PackageSync) loadTargetInventory(targetOrg, packageType string, packages []api.Package) (*targetInventory, error) {
+    renamed := false
+    for _, p := range packages {
+        if s.getTargetPackageName(p.Name) != p.Name {
+            renamed = true
+            break
+        }
+    }
+    if !renamed && len(s.tags) == 0 {
+        return nil, nil
+    }
+
+    existing, err := s.targetAPI.GetOrganizationPackages(targetOrg, packageType)
+    if err != nil {
+        return nil, err
+    }
+
+    inventory := &targetInventory{
+        packages: make(map[string]bool),
+        digests:  make(map[string]map[string]string),
+    }
+    for _, p := range existing {
+        inventory.packages[p.Name] = true
+        inventory.digests[p.Name] = make(map[string]string)
+        for _, v := range p.Versions {
+            if key := digestSetKey(v.Files); key != "" {
+                inventory.digests[p.Name][key] = v.Name
+            }
+        }
+    }
+    return inventory, nil
+}
+
+// findDuplicate returns the version of targetName that already has exactly
+// the files of v. Container images are compared by manifest digest instead
+func (s *PackageSync) findDuplicate(inventory *targetInventory, sourceOrg, targetOrg string, p api.Package, v api.Version, targetName, targetVersion string) (string, bool) {
+    if inventory == nil || !inventory.packages[targetName] {
+        return "", false
+    }
+
+    if p.PackageType == "container" {
+        sourceDigest, err := s.sourceAPI.GetImageDigest(sourceOrg, p.Name, v.Name)
+        if err != nil {
+            return "", false
+        }
+        targetDigest, err := s.targetAPI.GetImageDigest(targetOrg, targetName, targetVersion)
+        if err != nil || targetDigest != sourceDigest {
+            return "", false
+        }
+        return targetVersion, true
+    }
+
+    key := digestSetKey(v.Files)
+    if key == "" {
+        return "", false
+    }
+    existing, ok := inventory.digests[targetName][key]
+    return existing, ok
+}
+
+// digestSetKey identifies a version by the sorted SHA-256 of its files, or
+// is empty if any file's digest is unknown
+func digestSetKey(files []api.File) string {
+    if len(files) == 0 {
+        return ""
+    }
+
+    digests := make([]string, len(files))
+    for i, f := range files {
+        if f.SHA256 == "" {
+            return ""
+        }
+        digests[i] = strings.ToLower(f.SHA256)
+    }
+    sort.Strings(digests)
+    return strings.Join(digests, ",")
+}
+
+func writeDuplicatesReport(filename string, duplicates []DuplicateVersion) error {
+    file, err := os.Create(filename)
+    if err != nil {
+        return err
+    }
+    defer file.Close()
+
+    writer := csvfile.NewWriter(file)
+    defer writer.Flush()
+
+    if err := writer.Write([]string{"Type", "Source", "Version", "Target", "Existing Version"}); err != nil {
+        return err
+    }
+    for _, d := range duplicates {
+        if err := writer.Write([]string{d.PackageType, d.SourceName, d.Version, d.TargetName, d.Existing}); err != nil {
+            return err
+        }
+    }
+    return nil
+}
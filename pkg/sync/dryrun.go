@@ -0,0 +1,224 @@
+package sync
+
+import (
+    "encoding/json"
+    "fmt"
+    "os"
+    "strconv"
+    "strings"
+
+    "github.com/cvega/gh-migrate-packages/pkg/api"
+    "github.com/cvega/gh-migrate-packages/pkg/checkpoint"
+    "github.com/cvega/gh-migrate-packages/pkg/csvfile"
+    "github.com/cvega/gh-migrate-packages/pkg/filter"
+    "github.com/pterm/pterm"
+)
+
+// What sync would do with a version, as reported by --dry-run
+const (
+    ActionCreate    = "create"
+    ActionSkip      = "skip"
+    ActionOverwrite = "overwrite" // the target already has a version by that name
+)
+
+// PlannedVersion is what a real run would do with one source version
+type PlannedVersion struct {
+    PackageType   string   `json:"package_type"`
+    Package       string   `json:"package"`
+    Version       string   `json:"version"`
+    TargetPackage string   `json:"target_package"`
+    TargetVersion string   `json:"target_version"`
+    Action        string   `json:"action"`
+    Reason        string   `json:"reason"`
+    Size          int64    `json:"size"`
+    VersionID     string   `json:"version_id,omitempty"`
+    Files         []string `json:"files,omitempty"` // transferred when created or overwritten
+}
+
+// dryRun decides each version's action the way the migration loop does,
+// with the target's current versions in hand instead of uploading
+type dryRun struct {
+    sync         *PackageSync
+    sourceOrg    string
+    targetOrg    string
+    skipExisting bool
+    filter       *filter.Filter
+    state        *checkpoint.Checkpoint
+    archive      *Archive
+    inventory    *targetInventory
+    target       map[string]map[string]bool // target package -> version names
+}
+
+// targetVersions lists the target organization's packages once, so every
+// version can be checked against what is already there
+func (s *PackageSync) targetVersions(targetOrg, packageType string) (map[string]map[string]bool, error) {
+    existing, err := s.targetAPI.GetOrganizationPackages(targetOrg, packageType)
+    if err != nil {
+        return nil, fmt.Errorf("failed to list target packages: %v", err)
+    }
+    target := make(map[string]map[string]bool)
+    for _, p := range existing {
+        versions := make(map[string]bool)
+        for _, v := range p.Versions {
+            versions[v.Name] = true
+        }
+        target[p.Name] = versions
+    }
+    return target, nil
+}
+
+// plan returns the action a real run would take for every version of pkg
+func (d *dryRun) plan(pkg api.Package) []PlannedVersion {
+    targetName := d.sync.getTargetPackageName(pkg.Name)
+    planned := make([]PlannedVersion, 0, len(pkg.Versions))
+    add := func(version api.Version, action, reason string) {
+        versionTarget, versionName := d.sync.getTargetVersion(pkg.Name, version.Name)
+        var files []string
+        if action != ActionSkip {
+            for _, file := range version.Files {
+                files = append(files, file.Name)
+            }
+        }
+        planned = append(planned, PlannedVersion{
+            PackageType:   pkg.PackageType,
+            Package:       pkg.Name,
+            Version:       version.Name,
+            TargetPackage: versionTarget,
+            TargetVersion: versionName,
+            Action:        action,
+            Reason:        reason,
+            Size:          versionSize(version),
+            VersionID:     version.ID,
+            Files:         files,
+        })
+    }
+
+    if err := pkg.ValidatePackage(&pkg); err != nil {
+        for _, version := range pkg.Versions {
+            add(version, ActionSkip, fmt.Sprintf("invalid package: %v", err))
+        }
+        return planned
+    }
+    if _, exists := d.target[targetName]; exists && d.skipExisting {
+        for _, version := range pkg.Versions {
+            add(version, ActionSkip, "package exists in target, --skip-existing")
+        }
+        return planned
+    }
+
+    for _, version := range pkg.Versions {
+        if d.state != nil && d.state.Done(pkg.PackageType, pkg.Name, version.ID) {
+            add(version, ActionSkip, "migrated by an earlier run, see the checkpoint")
+            continue
+        }
+
+        allowed, err := d.filter.Allows(pkg.PackageType, version.Name)
+        if err != nil {
+            add(version, ActionSkip, fmt.Sprintf("version filter failed: %v", err))
+            continue
+        }
+        if !allowed {
+            add(version, ActionSkip, "excluded by the version filters")
+            continue
+        }
+
+        version.Files, _ = excludeFiles(d.filter, pkg, version)
+        size := versionSize(version)
+        if !d.filter.AllowsSize(size) {
+            add(version, ActionSkip, "excluded by the size filters")
+            continue
+        }
+        if d.filter.NeedsReview(pkg.Name, version.Name, size) {
+            add(version, ActionSkip, "above the review threshold, needs an approval")
+            continue
+        }
+        if d.archive != nil && d.archive.Covers(version) {
+            add(version, ActionSkip, "older than --archive-older-than, goes to the archive")
+            continue
+        }
+
+        versionTarget, versionName := d.sync.getTargetVersion(pkg.Name, version.Name)
+        if existing, ok := d.sync.findDuplicate(d.inventory, d.sourceOrg, d.targetOrg, pkg, version, versionTarget, versionName); ok {
+            add(version, ActionSkip, fmt.Sprintf("already in target as %s:%s", versionTarget, existing))
+            continue
+        }
+
+        switch versions, exists := d.target[versionTarget]; {
+        case !exists:
+            add(version, ActionCreate, "new package")
+        case versions[versionName]:
+            add(version, ActionOverwrite, "target already has this version")
+        default:
+            add(version, ActionCreate, "new version")
+        }
+    }
+    return planned
+}
+
+// reportDryRun prints the number of versions per action and type
+func reportDryRun(planned []PlannedVersion) {
+    counts := make(map[string]map[string]int)
+    var types []string
+    var size int64
+    for _, p := range planned {
+        if counts[p.PackageType] == nil {
+            counts[p.PackageType] = make(map[string]int)
+            types = append(types, p.PackageType)
+        }
+        counts[p.PackageType][p.Action]++
+        if p.Action != ActionSkip {
+            size += p.Size
+        }
+    }
+
+    pterm.DefaultSection.Println("Dry run")
+    table := pterm.TableData{
+        {"Type", "Create", "Overwrite", "Skip"},
+    }
+    total := make(map[string]int)
+    for _, packageType := range types {
+        c := counts[packageType]
+        table = append(table, []string{packageType, strconv.Itoa(c[ActionCreate]), strconv.Itoa(c[ActionOverwrite]), strconv.Itoa(c[ActionSkip])})
+        for action, n := range c {
+            total[action] += n
+        }
+    }
+    if len(table) > 1 {
+        pterm.DefaultTable.WithHasHeader().WithData(table).Render()
+    }
+    pterm.Info.Printf("%d versions would be created, %d overwritten and %d skipped, transferring %s\n", total[ActionCreate], total[ActionOverwrite], total[ActionSkip], filter.FormatSize(size))
+}
+
+// writeDryRun writes the planned actions as JSON when filename ends in
+// .json, as CSV otherwise
+func writeDryRun(filename string, planned []PlannedVersion) error {
+    file, err := os.Create(filename)
+    if err != nil {
+        return err
+    }
+    defer file.Close()
+
+    if strings.HasSuffix(strings.ToLower(filename), ".json") {
+        encoder := json.NewEncoder(file)
+        encoder.SetIndent("", "  ")
+        if planned == nil {
+            planned = []PlannedVersion{}
+        }
+        return encoder.Encode(planned)
+    }
+
+    writer := csvfile.NewWriter(file)
+    defer writer.Flush()
+
+    header := []string{"Type", "Package", "Version", "Target Package", "Target Version", "Action", "Reason", "Size"}
+    if err := writer.Write(header); err != nil {
+        return err
+    }
+    for _, p := range planned {
+        row := []string{p.PackageType, p.Package, p.Version, p.TargetPackage, p.TargetVersion, p.Action, p.Reason, strconv.FormatInt(p.Size, 10)}
+        if err := writer.Write(row); err != nil {
+            return err
+        }
+    }
+    return nil
+}
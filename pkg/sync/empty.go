@@ -0,0 +1,38 @@
+package sync
+
+import (
+    "github.com/cvega/gh-migrate-packages/pkg/api"
+    "github.com/pterm/pterm"
+)
+
+// splitEmptyPackages separates packages whose versions were all deleted from
+// those with something left to migrate
+func splitEmptyPackages(packages []api.Package) ([]api.Package, []api.Package) {
+    var active, empty []api.Package
+    for _, pkg := range packages {
+        if pkg.IsEmpty() {
+            empty = append(empty, pkg)
+            continue
+        }
+        active = append(active, pkg)
+    }
+    return active, empty
+}
+
+// reportEmptyPackages lists the packages left out of the migration because
+// the source has no versions for them
+func reportEmptyPackages(empty []api.Package) {
+    if len(empty) == 0 {
+        return
+    }
+
+    pterm.DefaultSection.Println("Empty packages")
+    table := pterm.TableData{
+        {"Package", "Type", "Status", "Visibility"},
+    }
+    for _, pkg := range empty {
+        table = append(table, []string{pkg.Name, pkg.PackageType, pkg.Status(), pkg.Visibility})
+    }
+    pterm.DefaultTable.WithHasHeader().WithData(table).Render()
+    pterm.Info.Printf("%d packages have no versions left in the source and were not migrated\n", len(empty))
+}
@@ -0,0 +1,119 @@
+package sync
+
+import (
+    "os"
+    "path/filepath"
+    "strconv"
+    "time"
+
+    "github.com/cvega/gh-migrate-packages/pkg/api"
+    "github.com/cvega/gh-migrate-packages/pkg/csvfile"
+    "github.com/cvega/gh-migrate-packages/pkg/failure"
+)
+
+// FileOutcome is the upload result of one file of a migrated version
+type FileOutcome struct {
+    PackageType   string
+    PackageName   string
+    Version       string
+    TargetName    string
+    TargetVersion string
+    api.FileResult
+}
+
+// fileOutcomes lists what happened to each file of a version upload.
+// Uploads that don't report their files, usually single-file ones, give
+// every file the version's outcome. Files a failed upload never reached
+// are pending, so a retry knows exactly what is left
+func fileOutcomes(p api.Package, version, target, targetVersion string, files []string, results *api.FileResults, start time.Time, err error) []FileOutcome {
+    recorded := results.All()
+    if len(recorded) == 0 {
+        elapsed := time.Since(start)
+        status, message := api.FileUploaded, ""
+        if err != nil {
+            status, message = api.FileFailed, err.Error()
+        }
+        for _, file := range files {
+            result := api.FileResult{
+                File:     filepath.Base(file),
+                Status:   status,
+                Duration: elapsed,
+                Error:    message,
+            }
+            if info, statErr := os.Stat(file); statErr == nil {
+                result.Size = info.Size()
+            }
+            recorded = append(recorded, result)
+        }
+    } else if err != nil {
+        seen := make(map[string]bool)
+        for _, result := range recorded {
+            seen[result.File] = true
+        }
+        for _, file := range files {
+            if seen[filepath.Base(file)] {
+                continue
+            }
+            result := api.FileResult{File: filepath.Base(file), Status: api.FilePending}
+            if info, statErr := os.Stat(file); statErr == nil {
+                result.Size = info.Size()
+            }
+            recorded = append(recorded, result)
+        }
+    }
+
+    outcomes := make([]FileOutcome, 0, len(recorded))
+    for _, result := range recorded {
+        outcomes = append(outcomes, FileOutcome{
+            PackageType:   p.PackageType,
+            PackageName:   p.Name,
+            Version:       version,
+            TargetName:    target,
+            TargetVersion: targetVersion,
+            FileResult:    result,
+        })
+    }
+    return outcomes
+}
+
+// countFailedFiles returns the files that failed or were never attempted
+func countFailedFiles(outcomes []FileOutcome) int {
+    count := 0
+    for _, o := range outcomes {
+        if o.Status == api.FileFailed || o.Status == api.FilePending {
+            count++
+        }
+    }
+    return count
+}
+
+func writeFileReport(filename string, outcomes []FileOutcome) error {
+    file, err := os.Create(filename)
+    if err != nil {
+        return err
+    }
+    defer file.Close()
+
+    writer := csvfile.NewWriter(file)
+    defer writer.Flush()
+
+    header := []string{"Type", "Package", "Version", "Target", "Target Version", "File", "Status", "Size", "Duration (ms)", "Digest", "Digest Verified", "Error", "Likely Cause", "Remediation"}
+    if err := writer.Write(header); err != nil {
+        return err
+    }
+    for _, o := range outcomes {
+        var class failure.Class
+        if o.Error != "" {
+            class = failure.Classify(o.Error)
+        }
+        row := []string{
+            o.PackageType, o.PackageName, o.Version, o.TargetName, o.TargetVersion,
+            o.File, o.Status, strconv.FormatInt(o.Size, 10), strconv.FormatInt(o.Duration.Milliseconds(), 10),
+            o.Digest, strconv.FormatBool(o.Verified), o.Error, class.Category, class.Hint,
+        }
+        if err := writer.Write(row); err != nil {
+            return err
+        }
+    }
+    return nil
+}
@@ -0,0 +1,60 @@
+package sync
+
+import (
+    "os"
+    "path/filepath"
+
+    "github.com/cvega/gh-migrate-packages/pkg/api"
+    "github.com/cvega/gh-migrate-packages/pkg/filter"
+)
+
+// excludeFiles drops the files of a version the file filters leave out,
+// before anything is downloaded
+func excludeFiles(f *filter.Filter, p api.Package, v api.Version) ([]api.File, []filter.ExcludedFile) {
+    var kept []api.File
+    var excluded []filter.ExcludedFile
+    for _, file := range v.Files {
+        if f.AllowsFile(file.Name) {
+            kept = append(kept, file)
+            continue
+        }
+        excluded = append(excluded, filter.ExcludedFile{
+            PackageName: p.Name,
+            PackageType: p.PackageType,
+            Version:     v.Name,
+            File:        file.Name,
+            Size:        int64(file.Size),
+        })
+    }
+    return kept, excluded
+}
+
+// excludeDownloaded applies the file filters to files an external handler
+// downloaded into dir, since their names aren't known beforehand
+func excludeDownloaded(f *filter.Filter, p api.Package, v api.Version, dir string, files []string) ([]string, []filter.ExcludedFile) {
+    var kept []string
+    var excluded []filter.ExcludedFile
+    for _, path := range files {
+        name, err := filepath.Rel(dir, path)
+        if err != nil {
+            name = filepath.Base(path)
+        }
+        if f.AllowsFile(filepath.ToSlash(name)) {
+            kept = append(kept, path)
+            continue
+        }
+
+        var size int64
+        if info, err := os.Stat(path); err == nil {
+            size = info.Size()
+        }
+        excluded = append(excluded, filter.ExcludedFile{
+            PackageName: p.Name,
+            PackageType: p.PackageType,
+            Version:     v.Name,
+            File:        filepath.ToSlash(name),
+            Size:        size,
+        })
+    }
+    return kept, excluded
+}
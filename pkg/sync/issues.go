@@ -0,0 +1,112 @@
+package sync
+
+import (
+    "fmt"
+    "log"
+    "strings"
+
+    "github.com/cvega/gh-migrate-packages/pkg/failure"
+    "github.com/cvega/gh-migrate-packages/pkg/run"
+    "github.com/pterm/pterm"
+)
+
+// VersionFailure is a version that couldn't be migrated
+type VersionFailure struct {
+    Version  string
+    Stage    string // plan, archive, download, or upload
+    Error    string
+    Category string // likely cause, one of the failure package's categories
+    Hint     string // what to do about it
+}
+
+// newVersionFailure classifies err and logs how to fix it when the cause
+// is recognized
+func newVersionFailure(version, stage string, err error) VersionFailure {
+    class := failure.Classify(err.Error())
+    if class.Hint != "" {
+        log.Printf("Likely cause (%s): %s", class.Category, class.Hint)
+    }
+    return VersionFailure{Version: version, Stage: stage, Error: err.Error(), Category: class.Category, Hint: class.Hint}
+}
+
+// PackageFailure collects the failed versions of one package
+type PackageFailure struct {
+    Name        string
+    PackageType string
+    TargetName  string
+    Versions    []VersionFailure
+}
+
+// openFailureIssues files or refreshes one tracking issue per failed package
+// in repo (owner/name) using the target token
+func (s *PackageSync) openFailureIssues(repo, sourceOrg, targetOrg string, failures []PackageFailure) {
+    for _, f := range failures {
+        title := fmt.Sprintf("Package migration failed: %s %s", f.PackageType, f.Name)
+        url, err := s.targetAPI.UpsertIssue(repo, title, failureIssueBody(sourceOrg, targetOrg, f))
+        if err != nil {
+            log.Printf("Error filing issue for %s: %v", f.Name, err)
+            continue
+        }
+        pterm.Info.Printf("Tracking issue for %s: %s\n", f.Name, url)
+    }
+}
+
+func failureIssueBody(sourceOrg, targetOrg string, f PackageFailure) string {
+    var b strings.Builder
+
+    fmt.Fprintf(&b, "Migrating the %s package `%s` from `%s` to `%s/%s` failed for %d version(s).\n\n",
+        f.PackageType, f.Name, sourceOrg, targetOrg, f.TargetName, len(f.Versions))
+
+    b.WriteString("| Version | Stage | Error |\n")
+    b.WriteString("|---------|-------|-------|\n")
+    for _, v := range f.Versions {
+        // Keep the table intact when errors contain pipes or newlines
+        msg := strings.NewReplacer("|", "\\|", "\n", " ").Replace(v.Error)
+        fmt.Fprintf(&b, "| `%s` | %s | %s |\n", v.Version, v.Stage, msg)
+    }
+
+    seen := make(map[string]bool)
+    for _, v := range f.Versions {
+        if v.Hint == "" || seen[v.Category] {
+            continue
+        }
+        if len(seen) == 0 {
+            b.WriteString("\n### Likely cause\n\n")
+        }
+        seen[v.Category] = true
+        fmt.Fprintf(&b, "- **%s**: %s\n", v.Category, v.Hint)
+    }
+
+    b.WriteString("\n### Retry\n\n")
+    b.WriteString("Fix the cause above, then rerun the migration for this package type:\n\n")
+    fmt.Fprintf(&b, "```bash\ngh migrate-packages sync -s %s -t %s -a SOURCE_TOKEN -b TARGET_TOKEN -p %s\n```\n\n", sourceOrg, targetOrg, f.PackageType)
+    b.WriteString("Versions already on the target are reported as existing and are not uploaded again. ")
+    b.WriteString("This issue is updated on every run that still fails; close it once the package is migrated.\n\n")
+    fmt.Fprintf(&b, "_Last updated by migration run `%s`._\n", run.ID())
+
+    return b.String()
+}
+
+// reportFailureClasses prints the failed versions by likely cause, with
+// what to do about each
+func reportFailureClasses(failures []PackageFailure) {
+    var messages []string
+    for _, f := range failures {
+        for _, v := range f.Versions {
+            messages = append(messages, v.Error)
+        }
+    }
+
+    table := pterm.TableData{
+        {"Likely cause", "Versions", "Remediation"},
+    }
+    for _, s := range failure.Summarize(messages) {
+        hint := s.Hint
+        if hint == "" {
+            hint = "see the errors above"
+        }
+        table = append(table, []string{s.Category, fmt.Sprintf("%d", s.Count), hint})
+    }
+    pterm.Warning.Printf("%d versions failed to migrate\n", len(messages))
+    pterm.DefaultTable.WithHasHeader().WithData(table).Render()
+}
@@ -0,0 +1,207 @@
+package sync
+
+import (
+    "fmt"
+    "os"
+    "path"
+    "sort"
+    "strings"
+
+    "github.com/cvega/gh-migrate-packages/pkg/api"
+    "github.com/cvega/gh-migrate-packages/pkg/csvfile"
+    "github.com/cvega/gh-migrate-packages/pkg/package"
+    "github.com/pterm/pterm"
+    "github.com/spf13/viper"
+)
+
+// MappingRules propose the target name of every package in a generated
+// mapping file, applied in the order of the fields
+type MappingRules struct {
+    ReplacePrefixes [][2]string // the first matching leading part of a name is replaced, e.g. @old/ -> @new/
+    Lowercase       bool
+    Normalize       bool // as sync --normalize-names would
+}
+
+// ParsePrefixReplacements parses a ";"-separated list of from=to pairs
+func ParsePrefixReplacements(spec string) ([][2]string, error) {
+    var replacements [][2]string
+    for _, pair := range splitList(spec) {
+        from, to, ok := strings.Cut(pair, "=")
+        if !ok || from == "" {
+            return nil, fmt.Errorf("expected from=to, got %q", pair)
+        }
+        replacements = append(replacements, [2]string{from, to})
+    }
+    return replacements, nil
+}
+
+// Apply returns the proposed target name of a package
+func (r MappingRules) Apply(packageType, name string) string {
+    target := name
+    for _, replacement := range r.ReplacePrefixes {
+        if strings.HasPrefix(target, replacement[0]) {
+            target = replacement[1] + strings.TrimPrefix(target, replacement[0])
+            break
+        }
+    }
+    if r.Lowercase {
+        target = strings.ToLower(target)
+    }
+    if r.Normalize {
+        target, _ = pkg.NormalizeName(pkg.PackageType(packageType), target)
+    }
+    return target
+}
+
+// MappingRow is a row of a generated mapping file
+type MappingRow struct {
+    Source      string
+    Target      string
+    PackageType string
+    Visibility  string
+    Repository  string // name of the linked source repository, proposed for the target organization
+}
+
+// mappingRows proposes a row for every package, sorted by type and name
+func mappingRows(packages []api.Package, rules MappingRules) []MappingRow {
+    var rows []MappingRow
+    for _, p := range packages {
+        repository := ""
+        if p.Repository != nil {
+            repository = p.Repository.Name
+            if repository == "" && p.Repository.URL != "" {
+                repository = path.Base(strings.TrimSuffix(p.Repository.URL, ".git"))
+            }
+        }
+        rows = append(rows, MappingRow{
+            Source:      p.Name,
+            Target:      rules.Apply(p.PackageType, p.Name),
+            PackageType: p.PackageType,
+            Visibility:  p.Visibility,
+            Repository:  repository,
+        })
+    }
+    sort.SliceStable(rows, func(i, j int) bool {
+        if rows[i].PackageType != rows[j].PackageType {
+            return rows[i].PackageType < rows[j].PackageType
+        }
+        return rows[i].Source < rows[j].Source
+    })
+    return rows
+}
+
+// sharedNames lists the source names rows of different types propose
+// different targets for. A mapping row renames a name of every type, so
+// only one of them can hold
+func sharedNames(rows []MappingRow) []string {
+    targets := make(map[string]map[string]bool)
+    for _, row := range rows {
+        if targets[row.Source] == nil {
+            targets[row.Source] = make(map[string]bool)
+        }
+        targets[row.Source][row.Target] = true
+    }
+    var names []string
+    for name, proposed := range targets {
+        if len(proposed) > 1 {
+            names = append(names, name)
+        }
+    }
+    sort.Strings(names)
+    return names
+}
+
+func writeMappingFile(filename string, rows []MappingRow) error {
+    file, err := os.Create(filename)
+    if err != nil {
+        return err
+    }
+    defer file.Close()
+
+    writer := csvfile.NewWriter(file)
+    defer writer.Flush()
+
+    if err := writer.Write([]string{"source", "target", "type", "visibility", "repository"}); err != nil {
+        return err
+    }
+    for _, row := range rows {
+        if err := writer.Write([]string{row.Source, row.Target, row.PackageType, row.Visibility, row.Repository}); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// GenerateMapping lists the source packages and writes a mapping file for
+// sync -m with a row proposing a target name, visibility, and repository
+// for each, to be reviewed and edited before the migration
+func GenerateMapping() error {
+    org := viper.GetString("SOURCE_ORGANIZATION")
+    output := viper.GetString("OUTPUT_FILE")
+
+    if _, err := os.Stat(output); err == nil && !viper.GetBool("FORCE") {
+        return fmt.Errorf("%s already exists, pass --force to replace it", output)
+    }
+
+    replacements, err := ParsePrefixReplacements(viper.GetString("REPLACE_PREFIXES"))
+    if err != nil {
+        return fmt.Errorf("invalid prefix replacement: %v", err)
+    }
+    rules := MappingRules{
+        ReplacePrefixes: replacements,
+        Lowercase:       viper.GetBool("LOWERCASE_NAMES"),
+        Normalize:       viper.GetBool("NORMALIZE_NAMES"),
+    }
+
+    client := api.NewAPI(viper.GetString("SOURCE_TOKEN"), viper.GetString("SOURCE_HOSTNAME"))
+    client.SetReadOnly()
+    registries, err := api.ParseRegistries(viper.GetString("SOURCE_REGISTRY_URLS"))
+    if err != nil {
+        return fmt.Errorf("invalid source registry url: %v", err)
+    }
+    client.SetRegistries(registries)
+    sourceTokens, err := api.ParseRegistryTokens(viper.GetString("SOURCE_REGISTRY_TOKENS"))
+    if err != nil {
+        return fmt.Errorf("invalid source registry token: %v", err)
+    }
+    client.SetRegistryTokens(sourceTokens)
+
+    packageTypes := []string{viper.GetString("PACKAGE_TYPE")}
+    if packageTypes[0] == "" {
+        packageTypes = nil
+        for _, packageType := range pkg.HostedTypes {
+            packageTypes = append(packageTypes, string(packageType))
+        }
+    }
+
+    var packages []api.Package
+    for _, packageType := range packageTypes {
+        spinner, _ := pterm.DefaultSpinner.Start(fmt.Sprintf("Fetching %s packages from %s...", packageType, org))
+        found, err := client.GetOrganizationPackages(org, packageType)
+        if err != nil {
+            spinner.Fail(err.Error())
+            return err
+        }
+        spinner.Success(fmt.Sprintf("Found %d %s packages in %s", len(found), packageType, org))
+        packages = append(packages, found...)
+    }
+
+    rows := mappingRows(packages, rules)
+    if err := writeMappingFile(output, rows); err != nil {
+        return fmt.Errorf("failed to write mapping file: %v", err)
+    }
+
+    renamed := 0
+    for _, row := range rows {
+        if row.Target != row.Source {
+            renamed++
+        }
+    }
+    pterm.Success.Printf("Mapping rows for %d packages written to %s, %d of them renamed\n", len(rows), output, renamed)
+    if shared := sharedNames(rows); len(shared) > 0 {
+        pterm.Warning.Printf("%d names are used by packages of several types and proposed different targets, but a row renames every type; keep one row for each: %s\n",
+            len(shared), strings.Join(shared, ", "))
+    }
+    pterm.Info.Println("Review the target names, visibilities, and repositories, then pass the file to sync with -m")
+    return nil
+}
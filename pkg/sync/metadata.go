@@ -0,0 +1,209 @@
+package sync
+
+import (
+    "fmt"
+    "os"
+    "strconv"
+    "sync"
+    "time"
+
+    "github.com/cvega/gh-migrate-packages/pkg/csvfile"
+    "github.com/cvega/gh-migrate-packages/pkg/failure"
+    "github.com/pterm/pterm"
+)
+
+// Metadata update kinds
+const (
+    MetadataVisibility = "visibility"
+    MetadataVersion    = "version-metadata"
+)
+
+const (
+    defaultMetadataWorkers = 4
+    metadataBackoff        = 2 * time.Second
+)
+
+// MetadataUpdate is a REST metadata call on the target, queued while
+// artifacts transfer and applied once they are done, so slow or failing
+// metadata endpoints neither hold up nor fail the uploads
+type MetadataUpdate struct {
+    Kind        string
+    PackageType string
+    PackageName string // target name
+    Version     string // empty for package-level updates
+    Visibility  string
+    Metadata    map[string]interface{}
+
+    Attempts int
+    Duration time.Duration
+    Err      error
+}
+
+func (u MetadataUpdate) key() string {
+    return u.Kind + "/" + u.PackageType + "/" + u.PackageName + "@" + u.Version
+}
+
+// metadataQueue collects updates in the order they were queued, keeping
+// only the last of each for the same package or version
+type metadataQueue struct {
+    updates []MetadataUpdate
+    index   map[string]int
+}
+
+func newMetadataQueue() *metadataQueue {
+    return &metadataQueue{index: make(map[string]int)}
+}
+
+func (q *metadataQueue) add(u MetadataUpdate) {
+    if i, ok := q.index[u.key()]; ok {
+        q.updates[i] = u
+        return
+    }
+    q.index[u.key()] = len(q.updates)
+    q.updates = append(q.updates, u)
+}
+
+// applyMetadata runs the queued updates against targetOrg on workers
+// goroutines, retrying each failed call up to attempts times with
+// exponential backoff, and returns every update with its outcome
+func (s *PackageSync) applyMetadata(targetOrg string, q *metadataQueue, workers, attempts int) []MetadataUpdate {
+    if workers < 1 {
+        workers = defaultMetadataWorkers
+    }
+    if attempts < 1 {
+        attempts = 1
+    }
+    updates := q.updates
+
+    progressbar, _ := pterm.DefaultProgressbar.WithTotal(len(updates)).WithTitle("Updating package metadata").Start()
+    var mu sync.Mutex
+    var wg sync.WaitGroup
+    next := make(chan int)
+    for w := 0; w < workers; w++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            for i := range next {
+                s.applyMetadataUpdate(targetOrg, &updates[i], attempts)
+                mu.Lock()
+                progressbar.Increment()
+                mu.Unlock()
+            }
+        }()
+    }
+    for i := range updates {
+        next <- i
+    }
+    close(next)
+    wg.Wait()
+    progressbar.Stop()
+    return updates
+}
+
+func (s *PackageSync) applyMetadataUpdate(targetOrg string, u *MetadataUpdate, attempts int) {
+    start := time.Now()
+    defer func() { u.Duration = time.Since(start) }()
+
+    for u.Attempts = 1; ; u.Attempts++ {
+        switch u.Kind {
+        case MetadataVisibility:
+            u.Err = s.targetAPI.UpdatePackageVisibility(targetOrg, u.PackageName, u.Visibility)
+        case MetadataVersion:
+            u.Err = s.targetAPI.UpdatePackageMetadata(targetOrg, u.PackageName, u.Version, u.Metadata)
+        default:
+            u.Err = fmt.Errorf("unknown metadata update %q", u.Kind)
+            return
+        }
+        if u.Err == nil || u.Attempts >= attempts || !retryableMetadata(u.Err) {
+            return
+        }
+        time.Sleep(metadataBackoff << (u.Attempts - 1))
+    }
+}
+
+// retryableMetadata reports whether a failed call may succeed when sent
+// again; rejected requests fail the same way every time
+func retryableMetadata(err error) bool {
+    switch failure.Classify(err.Error()).Category {
+    case failure.RateLimit, failure.Server, failure.Network, failure.Unknown:
+        return true
+    }
+    return false
+}
+
+// reportMetadata prints the metadata phase's section of the run summary:
+// counts per kind, and every update that still failed after its retries
+func reportMetadata(updates []MetadataUpdate) int {
+    type counts struct{ applied, retried, failed int }
+    var kinds []string
+    byKind := make(map[string]*counts)
+    var failed []MetadataUpdate
+    for _, u := range updates {
+        c, ok := byKind[u.Kind]
+        if !ok {
+            c = &counts{}
+            byKind[u.Kind] = c
+            kinds = append(kinds, u.Kind)
+        }
+        switch {
+        case u.Err != nil:
+            c.failed++
+            failed = append(failed, u)
+        case u.Attempts > 1:
+            c.retried++
+            c.applied++
+        default:
+            c.applied++
+        }
+    }
+
+    table := pterm.TableData{
+        {"Update", "Applied", "After Retry", "Failed"},
+    }
+    for _, kind := range kinds {
+        c := byKind[kind]
+        table = append(table, []string{kind, strconv.Itoa(c.applied), strconv.Itoa(c.retried), strconv.Itoa(c.failed)})
+    }
+    pterm.Println()
+    pterm.DefaultSection.Println("Metadata updates")
+    pterm.DefaultTable.WithHasHeader().WithData(table).Render()
+
+    if len(failed) > 0 {
+        table = pterm.TableData{
+            {"Update", "Type", "Package", "Version", "Attempts", "Error"},
+        }
+        for _, u := range failed {
+            table = append(table, []string{u.Kind, u.PackageType, u.PackageName, u.Version, strconv.Itoa(u.Attempts), u.Err.Error()})
+        }
+        pterm.Warning.Printf("%d metadata updates failed after retries; their artifacts were migrated, so only the metadata needs fixing\n", len(failed))
+        pterm.DefaultTable.WithHasHeader().WithData(table).Render()
+    }
+    return len(failed)
+}
+
+func writeMetadataReport(filename string, updates []MetadataUpdate) error {
+    file, err := os.Create(filename)
+    if err != nil {
+        return err
+    }
+    defer file.Close()
+
+    writer := csvfile.NewWriter(file)
+    defer writer.Flush()
+
+    if err := writer.Write([]string{"Update", "Type", "Package", "Version", "Status", "Attempts", "Duration", "Error"}); err != nil {
+        return err
+    }
+    for _, u := range updates {
+        status, message := "applied", ""
+        if u.Err != nil {
+            status, message = "failed", u.Err.Error()
+        }
+        row := []string{u.Kind, u.PackageType, u.PackageName, u.Version, status,
+            strconv.Itoa(u.Attempts), u.Duration.Round(time.Millisecond).String(), message}
+        if err := writer.Write(row); err != nil {
+            return err
+        }
+    }
+    return nil
+}
@@ -0,0 +1,175 @@
+package sync
+
+import (
+    "bufio"
+    "fmt"
+    "os"
+    "path"
+    "strings"
+
+    "github.com/cvega/gh-migrate-packages/pkg/api"
+    "github.com/pterm/pterm"
+)
+
+// MustMigrate lists the packages, or single versions, a run fails without
+// however well the rest went
+type MustMigrate []pin
+
+type pin struct {
+    packageType string // empty for any type
+    name        string // glob
+    version     string // glob, empty for every version
+    line        string
+}
+
+// LoadMustMigrate reads one entry per line as [TYPE:]NAME[@VERSION], names
+// and versions as globs, the format of verify --verify-full with optional
+// versions. Blank lines and # comments are ignored
+func LoadMustMigrate(filename string) (MustMigrate, error) {
+    file, err := os.Open(filename)
+    if err != nil {
+        return nil, fmt.Errorf("failed to open must-migrate file: %v", err)
+    }
+    defer file.Close()
+
+    var pins MustMigrate
+    scanner := bufio.NewScanner(file)
+    for scanner.Scan() {
+        line := strings.TrimSpace(scanner.Text())
+        if line == "" || strings.HasPrefix(line, "#") {
+            continue
+        }
+
+        p := pin{name: line, line: line}
+        if i := strings.Index(p.name, ":"); i > 0 {
+            p.packageType, p.name = strings.ToLower(p.name[:i]), p.name[i+1:]
+        }
+        // Scoped npm names start with @, versions follow the last one
+        if i := strings.LastIndex(p.name, "@"); i > 0 {
+            p.name, p.version = p.name[:i], p.name[i+1:]
+        }
+        for _, glob := range []string{p.name, p.version} {
+            if _, err := path.Match(glob, ""); err != nil {
+                return nil, fmt.Errorf("invalid pattern %q in %s: %v", line, filename, err)
+            }
+        }
+        if p.name == "" {
+            return nil, fmt.Errorf("invalid entry %q in %s: no package name", line, filename)
+        }
+        pins = append(pins, p)
+    }
+    if err := scanner.Err(); err != nil {
+        return nil, fmt.Errorf("failed to read must-migrate file: %v", err)
+    }
+    return pins, nil
+}
+
+func (p pin) matches(packageType, name, version string) bool {
+    if p.packageType != "" && p.packageType != strings.ToLower(packageType) {
+        return false
+    }
+    if matched, _ := path.Match(p.name, name); !matched {
+        return false
+    }
+    if p.version == "" {
+        return true
+    }
+    matched, _ := path.Match(p.version, version)
+    return matched
+}
+
+// Select returns the listed versions that must be migrated, and the
+// entries that match none of them. Entries of other types than the run's
+// packageType are left out of both
+func (m MustMigrate) Select(packages []api.Package, packageType string) ([]api.Package, []string) {
+    var selected []api.Package
+    used := make([]bool, len(m))
+    for _, p := range packages {
+        pinned := p
+        pinned.Versions = nil
+        for _, v := range p.Versions {
+            found := false
+            for i, entry := range m {
+                if entry.matches(p.PackageType, p.Name, v.Name) {
+                    used[i], found = true, true
+                }
+            }
+            if found {
+                pinned.Versions = append(pinned.Versions, v)
+            }
+        }
+        if len(pinned.Versions) > 0 {
+            selected = append(selected, pinned)
+        }
+    }
+
+    var unmatched []string
+    for i, entry := range m {
+        if used[i] || (packageType != "" && entry.packageType != "" && entry.packageType != strings.ToLower(packageType)) {
+            continue
+        }
+        unmatched = append(unmatched, entry.line)
+    }
+    return selected, unmatched
+}
+
+// checkMustMigrate confirms every pinned version is in the target after the
+// run, whether this run or an earlier one migrated it. Missing versions are
+// listed with the error that kept them out when the run recorded one
+func (s *PackageSync) checkMustMigrate(pinned []api.Package, unmatched []string, failures []PackageFailure, targetOrg, packageType string) error {
+    actual, err := s.targetAPI.GetOrganizationPackages(targetOrg, packageType)
+    if err != nil {
+        return fmt.Errorf("failed to list target packages to check must-migrate versions: %v", err)
+    }
+    gaps := findGaps(pinned, actual, s.getTargetVersion)
+    if len(gaps) == 0 && len(unmatched) == 0 {
+        versions := 0
+        for _, p := range pinned {
+            versions += len(p.Versions)
+        }
+        pterm.Success.Printf("All %d must-migrate versions are in %s\n", versions, targetOrg)
+        return nil
+    }
+
+    reasons := make(map[string]string)
+    for _, f := range failures {
+        for _, v := range f.Versions {
+            reasons[f.PackageType+"/"+f.Name+"@"+v.Version] = fmt.Sprintf("%s failed: %s", v.Stage, v.Error)
+        }
+    }
+
+    table := pterm.TableData{
+        {"Type", "Package", "Version", "Target", "Reason"},
+    }
+    for _, entry := range unmatched {
+        table = append(table, []string{"", entry, "", "", "no matching version in the source"})
+    }
+    for _, gap := range gaps {
+        reason := reasons[gap.PackageType+"/"+gap.Expected+"@"+s.sourceVersion(pinned, gap)]
+        if reason == "" {
+            reason = "not migrated, check filters, archive, and review settings"
+        }
+        table = append(table, []string{gap.PackageType, gap.Expected, gap.Version, gap.Missing, reason})
+    }
+
+    pterm.Println()
+    pterm.Error.Printf("%d must-migrate versions are missing from %s\n", len(gaps)+len(unmatched), targetOrg)
+    pterm.DefaultTable.WithHasHeader().WithData(table).Render()
+    return fmt.Errorf("%d must-migrate versions were not migrated", len(gaps)+len(unmatched))
+}
+
+// sourceVersion finds the source name of the version a gap reports under
+// its target name
+func (s *PackageSync) sourceVersion(pinned []api.Package, gap InventoryGap) string {
+    for _, p := range pinned {
+        if p.PackageType != gap.PackageType || p.Name != gap.Expected {
+            continue
+        }
+        for _, v := range p.Versions {
+            if _, version := s.getTargetVersion(p.Name, v.Name); version == gap.Version {
+                return v.Name
+            }
+        }
+    }
+    return gap.Version
+}
@@ -0,0 +1,88 @@
+package sync
+
+import (
+    "fmt"
+    "os"
+    "strings"
+
+    "github.com/pterm/pterm"
+    "github.com/cvega/gh-migrate-packages/pkg/api"
+    "github.com/cvega/gh-migrate-packages/pkg/csvfile"
+    "github.com/cvega/gh-migrate-packages/pkg/package"
+)
+
+// NameNormalization records a target name rewritten to satisfy the target registry
+type NameNormalization struct {
+    PackageType string
+    SourceName  string
+    TargetName  string
+    Normalized  string
+    Fixes       []string
+}
+
+// NormalizeTargetNames checks every target name against the target registry's
+// naming rules. With autoFix the normalized names are used from then on,
+// otherwise any name needing changes is an error
+func (s *PackageSync) NormalizeTargetNames(packages []api.Package, autoFix bool) ([]NameNormalization, error) {
+    var normalizations []NameNormalization
+    for _, p := range packages {
+        targetName := s.getTargetPackageName(p.Name)
+        normalized, fixes := pkg.NormalizeName(pkg.PackageType(p.PackageType), targetName)
+        if len(fixes) == 0 {
+            continue
+        }
+
+        normalizations = append(normalizations, NameNormalization{
+            PackageType: p.PackageType,
+            SourceName:  p.Name,
+            TargetName:  targetName,
+            Normalized:  normalized,
+            Fixes:       fixes,
+        })
+        if autoFix {
+            s.mappings[p.Name] = normalized
+        }
+    }
+
+    if len(normalizations) == 0 {
+        return nil, nil
+    }
+
+    table := pterm.TableData{
+        {"Type", "Source", "Target", "Normalized", "Changes"},
+    }
+    for _, n := range normalizations {
+        table = append(table, []string{n.PackageType, n.SourceName, n.TargetName, n.Normalized, strings.Join(n.Fixes, ", ")})
+    }
+    pterm.DefaultTable.WithHasHeader().WithData(table).Render()
+
+    if !autoFix {
+        return normalizations, fmt.Errorf("%d target names are not accepted by the target registry, map them explicitly or rerun with --normalize-names", len(normalizations))
+    }
+    return normalizations, nil
+}
+
+func writeNormalizationReport(filename string, normalizations []NameNormalization) error {
+    file, err := os.Create(filename)
+    if err != nil {
+        return fmt.Errorf("failed to create normalization report: %v", err)
+    }
+    defer file.Close()
+
+    writer := csvfile.NewWriter(file)
+    defer writer.Flush()
+
+    header := []string{"Type", "Source", "Target", "Normalized", "Changes"}
+    if err := writer.Write(header); err != nil {
+        return err
+    }
+
+    for _, n := range normalizations {
+        row := []string{n.PackageType, n.SourceName, n.TargetName, n.Normalized, strings.Join(n.Fixes, "; ")}
+        if err := writer.Write(row); err != nil {
+            return err
+        }
+    }
+
+    return nil
+}
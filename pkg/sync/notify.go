@@ -0,0 +1,102 @@
+package sync
+
+import (
+    "encoding/json"
+    "fmt"
+    "log"
+    "os"
+    "sort"
+    "time"
+
+    "github.com/cvega/gh-migrate-packages/pkg/api"
+    "github.com/cvega/gh-migrate-packages/pkg/run"
+)
+
+// Team used for packages whose owner couldn't be inferred
+const unownedTeam = "unowned"
+
+// NotificationManifest lists, per owning team, the packages a sync migrated
+// and where they now live, ready to be turned into issues or chat messages
+type NotificationManifest struct {
+    SourceOrganization string             `json:"source_organization"`
+    TargetOrganization string             `json:"target_organization"`
+    GeneratedAt        string             `json:"generated_at"`
+    RunID              string             `json:"run_id"`
+    Teams              []TeamNotification `json:"teams"`
+}
+
+type TeamNotification struct {
+    Team     string            `json:"team"`
+    Packages []NotifiedPackage `json:"packages"`
+}
+
+type NotifiedPackage struct {
+    Name        string `json:"name"`
+    TargetName  string `json:"target_name"`
+    PackageType string `json:"package_type"`
+    Versions    int    `json:"versions_migrated"`
+    Repository  string `json:"repository,omitempty"`
+    OwnerSource string `json:"owner_source,omitempty"`
+    URL         string `json:"url"`
+}
+
+// buildNotifications groups migrated packages by the owners inferred from
+// their source repositories
+func (s *PackageSync) buildNotifications(sourceOrg, targetOrg string, migrated []NotifiedPackage) *NotificationManifest {
+    type ownership struct {
+        owners []string
+        source string
+    }
+    cache := make(map[string]ownership)
+    teams := make(map[string][]NotifiedPackage)
+
+    for _, p := range migrated {
+        p.URL = s.targetAPI.PackageURL(targetOrg, p.PackageType, p.TargetName)
+
+        owned, cached := cache[p.Repository]
+        if !cached && p.Repository != "" {
+            owners, source, err := s.sourceAPI.InferOwners(p.Repository)
+            if err != nil {
+                log.Printf("Error inferring owners of %s: %v", p.Repository, err)
+            }
+            owned = ownership{owners: owners, source: source}
+            cache[p.Repository] = owned
+        }
+
+        p.OwnerSource = owned.source
+        if len(owned.owners) == 0 {
+            teams[unownedTeam] = append(teams[unownedTeam], p)
+            continue
+        }
+        for _, owner := range owned.owners {
+            teams[owner] = append(teams[owner], p)
+        }
+    }
+
+    manifest := &NotificationManifest{
+        SourceOrganization: sourceOrg,
+        TargetOrganization: targetOrg,
+        GeneratedAt:        time.Now().UTC().Format(time.RFC3339),
+        RunID:              run.ID(),
+    }
+    for team, packages := range teams {
+        manifest.Teams = append(manifest.Teams, TeamNotification{Team: team, Packages: packages})
+    }
+    sort.Slice(manifest.Teams, func(i, j int) bool {
+        return manifest.Teams[i].Team < manifest.Teams[j].Team
+    })
+
+    return manifest
+}
+
+func writeNotificationManifest(filename string, manifest *NotificationManifest) error {
+    file, err := os.Create(filename)
+    if err != nil {
+        return fmt.Errorf("failed to create notification manifest: %v", err)
+    }
+    defer file.Close()
+
+    encoder := json.NewEncoder(file)
+    encoder.SetIndent("", "  ")
+    return encoder.Encode(manifest)
+}
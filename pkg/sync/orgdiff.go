@@ -0,0 +1,325 @@
+package sync
+
+import (
+    "fmt"
+    "os"
+    "sort"
+    "strconv"
+    "strings"
+
+    "github.com/cvega/gh-migrate-packages/pkg/api"
+    "github.com/cvega/gh-migrate-packages/pkg/csvfile"
+    "github.com/cvega/gh-migrate-packages/pkg/filter"
+    "github.com/cvega/gh-migrate-packages/pkg/package"
+    "github.com/cvega/gh-migrate-packages/pkg/snapshot"
+    "github.com/pterm/pterm"
+    "github.com/spf13/viper"
+)
+
+// Sides of a difference between the source and target organizations
+const (
+    MissingInTarget = "missing in target"
+    OnlyInTarget    = "only in target"
+)
+
+// OrganizationDifference is a version one organization lists that the
+// other doesn't, by the name a sync would migrate it to
+type OrganizationDifference struct {
+    Kind          string
+    PackageType   string
+    Package       string // source name, empty for versions only in the target
+    Version       string
+    VersionID     string // of the source version, empty for versions only in the target
+    TargetPackage string
+    TargetVersion string
+    Size          int64
+    WholePackage  bool // the other organization has no such package at all
+}
+
+// compareOrganizations matches source versions with target versions by
+// the target name and version they migrate to, honoring the mappings
+func (s *PackageSync) compareOrganizations(source, target []api.Package) []OrganizationDifference {
+    key := func(packageType, name, version string) string {
+        return strings.Join([]string{packageType, name, version}, "\x00")
+    }
+
+    inTarget := make(map[string]bool)
+    targetPackages := make(map[string]bool)
+    for _, p := range target {
+        targetPackages[key(p.PackageType, p.Name, "")] = true
+        for _, v := range p.Versions {
+            inTarget[key(p.PackageType, p.Name, v.Name)] = true
+        }
+    }
+
+    var differences []OrganizationDifference
+    expected := make(map[string]bool)
+    expectedPackages := make(map[string]bool)
+    for _, p := range source {
+        expectedPackages[key(p.PackageType, s.getTargetPackageName(p.Name), "")] = true
+        for _, v := range p.Versions {
+            targetName, targetVersion := s.getTargetVersion(p.Name, v.Name)
+            expectedPackages[key(p.PackageType, targetName, "")] = true
+            expected[key(p.PackageType, targetName, targetVersion)] = true
+            if inTarget[key(p.PackageType, targetName, targetVersion)] {
+                continue
+            }
+            differences = append(differences, OrganizationDifference{
+                Kind:          MissingInTarget,
+                PackageType:   p.PackageType,
+                Package:       p.Name,
+                Version:       v.Name,
+                VersionID:     v.ID,
+                TargetPackage: targetName,
+                TargetVersion: targetVersion,
+                Size:          versionSize(v),
+                WholePackage:  !targetPackages[key(p.PackageType, targetName, "")],
+            })
+        }
+    }
+    for _, p := range target {
+        for _, v := range p.Versions {
+            if expected[key(p.PackageType, p.Name, v.Name)] {
+                continue
+            }
+            differences = append(differences, OrganizationDifference{
+                Kind:          OnlyInTarget,
+                PackageType:   p.PackageType,
+                TargetPackage: p.Name,
+                TargetVersion: v.Name,
+                Size:          versionSize(v),
+                WholePackage:  !expectedPackages[key(p.PackageType, p.Name, "")],
+            })
+        }
+    }
+
+    sort.SliceStable(differences, func(i, j int) bool {
+        a, b := differences[i], differences[j]
+        return key(a.PackageType, a.TargetPackage, a.TargetVersion) < key(b.PackageType, b.TargetPackage, b.TargetVersion)
+    })
+    return differences
+}
+
+// DiffOrganizations lists the versions the source organization has that
+// the target lacks, and those only the target has. Source versions are
+// looked for under the name a sync with the same mappings, prefixes, and
+// name normalization would give them. Nothing is changed in either
+func DiffOrganizations() error {
+    sourceOrg := viper.GetString("SOURCE_ORGANIZATION")
+    targetOrg := viper.GetString("TARGET_ORGANIZATION")
+
+    sync := NewPackageSync(
+        viper.GetString("SOURCE_TOKEN"),
+        viper.GetString("TARGET_TOKEN"),
+        viper.GetString("SOURCE_HOSTNAME"),
+    )
+    sync.sourceAPI.SetReadOnly()
+    sync.targetAPI.SetReadOnly()
+    if err := sync.LoadMappings(viper.GetString("MAPPING_FILE")); err != nil {
+        return err
+    }
+
+    sourceRegistries, err := api.ParseRegistries(viper.GetString("SOURCE_REGISTRY_URLS"))
+    if err != nil {
+        return fmt.Errorf("invalid source registry url: %v", err)
+    }
+    sync.sourceAPI.SetRegistries(sourceRegistries)
+    sourceTokens, err := api.ParseRegistryTokens(viper.GetString("SOURCE_REGISTRY_TOKENS"))
+    if err != nil {
+        return fmt.Errorf("invalid source registry token: %v", err)
+    }
+    sync.sourceAPI.SetRegistryTokens(sourceTokens)
+    targetRegistries, err := api.ParseRegistries(viper.GetString("TARGET_REGISTRY_URLS"))
+    if err != nil {
+        return fmt.Errorf("invalid target registry url: %v", err)
+    }
+    sync.targetAPI.SetRegistries(targetRegistries)
+    targetTokens, err := api.ParseRegistryTokens(viper.GetString("TARGET_REGISTRY_TOKENS"))
+    if err != nil {
+        return fmt.Errorf("invalid target registry token: %v", err)
+    }
+    sync.targetAPI.SetRegistryTokens(targetTokens)
+
+    packageTypes := []string{viper.GetString("PACKAGE_TYPE")}
+    if packageTypes[0] == "" {
+        packageTypes = nil
+        for _, packageType := range pkg.HostedTypes {
+            packageTypes = append(packageTypes, string(packageType))
+        }
+    }
+
+    var source, target []api.Package
+    for _, packageType := range packageTypes {
+        for _, side := range []struct {
+            org      string
+            client   *api.API
+            packages *[]api.Package
+        }{{sourceOrg, sync.sourceAPI, &source}, {targetOrg, sync.targetAPI, &target}} {
+            spinner, _ := pterm.DefaultSpinner.Start(fmt.Sprintf("Fetching %s packages from %s...", packageType, side.org))
+            found, err := side.client.GetOrganizationPackages(side.org, packageType)
+            if err != nil {
+                spinner.Fail(err.Error())
+                return err
+            }
+            spinner.Success(fmt.Sprintf("Found %d %s packages in %s", len(found), packageType, side.org))
+            *side.packages = append(*side.packages, found...)
+        }
+    }
+
+    sync.ApplyTargetPrefixes(source, TargetPrefixes{
+        Name:          viper.GetString("TARGET_PREFIX"),
+        NpmScope:      viper.GetString("NPM_SCOPE_SUFFIX"),
+        MavenGroup:    viper.GetString("MAVEN_GROUP_PREFIX"),
+        ContainerPath: viper.GetString("CONTAINER_PATH_PREFIX"),
+    })
+    if viper.GetBool("NORMALIZE_NAMES") {
+        if _, err := sync.NormalizeTargetNames(source, true); err != nil {
+            return err
+        }
+    }
+
+    differences := sync.compareOrganizations(source, target)
+    reportOrganizationDifferences(sourceOrg, targetOrg, source, target, differences)
+
+    if report := viper.GetString("OUTPUT_FILE"); report != "" {
+        if err := writeOrganizationDifferences(report, differences); err != nil {
+            return fmt.Errorf("failed to write diff report: %v", err)
+        }
+        pterm.Info.Printf("%d differences written to %s\n", len(differences), report)
+    }
+
+    if path := viper.GetString("DELTA_SNAPSHOT"); path != "" {
+        delta := missingSnapshot(sourceOrg, source, differences)
+        if err := delta.Save(path); err != nil {
+            return err
+        }
+        pterm.Info.Printf("Missing versions of %d packages written to %s, migrate them with sync --snapshot %s\n", len(delta.Packages), path, path)
+    }
+    return nil
+}
+
+// missingSnapshot is the snapshot of the source versions missing in the
+// target, for a sync --snapshot that migrates only those
+func missingSnapshot(sourceOrg string, source []api.Package, differences []OrganizationDifference) *snapshot.Snapshot {
+    missing := make(map[string]bool)
+    for _, d := range differences {
+        if d.Kind == MissingInTarget {
+            missing[d.PackageType+"/"+d.Package+"@"+d.VersionID] = true
+        }
+    }
+
+    var packages []api.Package
+    for _, p := range source {
+        var versions []api.Version
+        for _, v := range p.Versions {
+            if missing[p.PackageType+"/"+p.Name+"@"+v.ID] {
+                versions = append(versions, v)
+            }
+        }
+        if len(versions) > 0 {
+            p.Versions = versions
+            packages = append(packages, p)
+        }
+    }
+    delta := snapshot.New()
+    delta.Add(sourceOrg, packages)
+    return delta
+}
+
+// reportOrganizationDifferences prints the versions on each side and the
+// differences between them by type
+func reportOrganizationDifferences(sourceOrg, targetOrg string, source, target []api.Package, differences []OrganizationDifference) {
+    type totals struct {
+        source, target, missing, only int
+        wholeMissing, wholeOnly       map[string]bool
+        size                          int64 // of the missing versions
+    }
+    byType := make(map[string]*totals)
+    get := func(packageType string) *totals {
+        t, ok := byType[packageType]
+        if !ok {
+            t = &totals{wholeMissing: make(map[string]bool), wholeOnly: make(map[string]bool)}
+            byType[packageType] = t
+        }
+        return t
+    }
+    for _, p := range source {
+        get(p.PackageType).source += len(p.Versions)
+    }
+    for _, p := range target {
+        get(p.PackageType).target += len(p.Versions)
+    }
+    for _, d := range differences {
+        t := get(d.PackageType)
+        if d.Kind == MissingInTarget {
+            t.missing++
+            t.size += d.Size
+            if d.WholePackage {
+                t.wholeMissing[d.Package] = true
+            }
+            continue
+        }
+        t.only++
+        if d.WholePackage {
+            t.wholeOnly[d.TargetPackage] = true
+        }
+    }
+
+    var types []string
+    for packageType := range byType {
+        types = append(types, packageType)
+    }
+    sort.Strings(types)
+
+    pterm.DefaultSection.Printf("%s compared with %s", sourceOrg, targetOrg)
+    table := pterm.TableData{{"Type", "Source versions", "Target versions", "Missing in target", "Packages missing", "Only in target", "Packages only in target", "Size to migrate"}}
+    var missing, only int
+    for _, packageType := range types {
+        t := byType[packageType]
+        missing += t.missing
+        only += t.only
+        table = append(table, []string{
+            packageType,
+            strconv.Itoa(t.source),
+            strconv.Itoa(t.target),
+            strconv.Itoa(t.missing),
+            strconv.Itoa(len(t.wholeMissing)),
+            strconv.Itoa(t.only),
+            strconv.Itoa(len(t.wholeOnly)),
+            filter.FormatSize(t.size),
+        })
+    }
+    pterm.DefaultTable.WithHasHeader().WithData(table).Render()
+
+    switch {
+    case missing == 0 && only == 0:
+        pterm.Success.Println("Both organizations list the same versions")
+    case missing == 0:
+        pterm.Success.Printf("The target has every source version, and %d versions the source doesn't\n", only)
+    default:
+        pterm.Warning.Printf("%d source versions are missing in the target, %d versions are only in the target\n", missing, only)
+    }
+}
+
+func writeOrganizationDifferences(filename string, differences []OrganizationDifference) error {
+    file, err := os.Create(filename)
+    if err != nil {
+        return err
+    }
+    defer file.Close()
+
+    writer := csvfile.NewWriter(file)
+    defer writer.Flush()
+
+    header := []string{"Difference", "Type", "Package", "Version", "Target Package", "Target Version", "Size", "Whole Package"}
+    if err := writer.Write(header); err != nil {
+        return err
+    }
+    for _, d := range differences {
+        row := []string{d.Kind, d.PackageType, d.Package, d.Version, d.TargetPackage, d.TargetVersion, strconv.FormatInt(d.Size, 10), strconv.FormatBool(d.WholePackage)}
+        if err := writer.Write(row); err != nil {
+            return err
+        }
+    }
+    return nil
+}
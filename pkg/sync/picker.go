@@ -0,0 +1,86 @@
+package sync
+
+import (
+    "fmt"
+
+    "github.com/cvega/gh-migrate-packages/pkg/api"
+    "github.com/cvega/gh-migrate-packages/pkg/filter"
+    "github.com/pterm/pterm"
+)
+
+// pickerHeight is how many packages the picker shows at once
+const pickerHeight = 15
+
+func pickKey(p api.Package) string {
+    return p.PackageType + "/" + p.Name
+}
+
+// pickerOptions labels each package with its type, version count, and
+// size, aligned in columns. Labels are unique, as type and name are
+func pickerOptions(packages []api.Package) []string {
+    typeWidth, nameWidth := 0, 0
+    for _, p := range packages {
+        typeWidth = max(typeWidth, len(p.PackageType))
+        nameWidth = max(nameWidth, len(p.Name))
+    }
+
+    options := make([]string, len(packages))
+    for i, p := range packages {
+        var size int64
+        for _, v := range p.Versions {
+            size += versionSize(v)
+        }
+        options[i] = fmt.Sprintf("%-*s  %-*s  %5d versions  %10s", typeWidth, p.PackageType, nameWidth, p.Name, len(p.Versions), filter.FormatSize(size))
+    }
+    return options
+}
+
+// pickPackages lets the operator choose which of the listed packages to
+// migrate from a multi-select list, and returns them with the set of
+// choices, by type and name, that late versions are held to
+func pickPackages(packages []api.Package) ([]api.Package, map[string]bool, error) {
+    if len(packages) == 0 {
+        return nil, map[string]bool{}, nil
+    }
+
+    options := pickerOptions(packages)
+    chosen, err := pterm.DefaultInteractiveMultiselect.
+        WithOptions(options).
+        WithMaxHeight(pickerHeight).
+        WithDefaultText(fmt.Sprintf("Select the packages to migrate out of %d (enter toggles, right selects all, left none, type to filter, tab confirms)", len(packages))).
+        Show()
+    if err != nil {
+        return nil, nil, fmt.Errorf("failed to pick packages: %v", err)
+    }
+
+    selected := make(map[string]bool, len(chosen))
+    for _, option := range chosen {
+        selected[option] = true
+    }
+    picked := make(map[string]bool, len(chosen))
+    var kept []api.Package
+    for i, p := range packages {
+        if selected[options[i]] {
+            picked[pickKey(p)] = true
+            kept = append(kept, p)
+        }
+    }
+
+    var versions int
+    for _, p := range kept {
+        versions += len(p.Versions)
+    }
+    pterm.Info.Printf("Migrating the %d picked packages, %d versions\n", len(kept), versions)
+    return kept, picked, nil
+}
+
+// keepPicked leaves out packages the operator didn't pick
+func keepPicked(packages []api.Package, picked map[string]bool) []api.Package {
+    var kept []api.Package
+    for _, p := range packages {
+        if picked[pickKey(p)] {
+            kept = append(kept, p)
+        }
+    }
+    return kept
+}
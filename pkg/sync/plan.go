@@ -0,0 +1,286 @@
+package sync
+
+import (
+    "encoding/base64"
+    "encoding/json"
+    "fmt"
+    "os"
+    "time"
+
+    "github.com/cvega/gh-migrate-packages/pkg/api"
+    "github.com/cvega/gh-migrate-packages/pkg/filter"
+    "github.com/cvega/gh-migrate-packages/pkg/provenance"
+    "github.com/cvega/gh-migrate-packages/pkg/run"
+    "github.com/pterm/pterm"
+    "github.com/spf13/viper"
+)
+
+// PlanPayloadType identifies a signed plan in its DSSE envelope
+const PlanPayloadType = "application/vnd.gh-migrate-packages.plan+json"
+
+// Plan is every action a sync would take, written by the plan command for
+// review and executed as is by sync --plan-file
+type Plan struct {
+    RunID              string           `json:"run_id"`
+    CreatedAt          time.Time        `json:"created_at"`
+    SourceHostname     string           `json:"source_hostname,omitempty"`
+    SourceOrganization string           `json:"source_organization"`
+    TargetOrganization string           `json:"target_organization"`
+    PackageType        string           `json:"package_type,omitempty"`
+    Command            string           `json:"command,omitempty"`
+    Totals             map[string]int   `json:"totals"`
+    Versions           []PlannedVersion `json:"versions"`
+}
+
+// planSelection are the settings, by flag, a plan was made with that decide
+// which versions it migrates. sync --plan-file refuses them rather than
+// selecting twice
+var planSelection = [][2]string{
+    {"skip-existing", "SKIP_EXISTING"},
+    {"version-range", "VERSION_RANGE"},
+    {"exclude-prereleases", "EXCLUDE_PRERELEASES"},
+    {"only-releases", "ONLY_RELEASES"},
+    {"exclude-orphaned", "EXCLUDE_ORPHANED"},
+    {"only-orphaned", "ONLY_ORPHANED"},
+    {"min-downloads", "MIN_DOWNLOADS"},
+    {"interactive", "INTERACTIVE"},
+    {"min-version-size", "MIN_VERSION_SIZE"},
+    {"max-version-size", "MAX_VERSION_SIZE"},
+    {"file-filter", "FILE_FILTERS"},
+    {"review-threshold", "REVIEW_THRESHOLD"},
+    {"approvals-file", "APPROVALS_FILE"},
+    {"snapshot", "SNAPSHOT"},
+    {"archive-older-than", "ARCHIVE_OLDER_THAN"},
+}
+
+func newPlan(sourceOrg, targetOrg, packageType string, planned []PlannedVersion) *Plan {
+    plan := &Plan{
+        RunID:              run.ID(),
+        CreatedAt:          time.Now().UTC(),
+        SourceHostname:     viper.GetString("SOURCE_HOSTNAME"),
+        SourceOrganization: sourceOrg,
+        TargetOrganization: targetOrg,
+        PackageType:        packageType,
+        Command:            run.Command(nil),
+        Totals:             map[string]int{ActionCreate: 0, ActionOverwrite: 0, ActionSkip: 0},
+        Versions:           planned,
+    }
+    for _, p := range planned {
+        plan.Totals[p.Action]++
+    }
+    if plan.Versions == nil {
+        plan.Versions = []PlannedVersion{}
+    }
+    return plan
+}
+
+// WritePlan writes plan to path as JSON, or as a DSSE envelope signed by
+// signer when there is one
+func WritePlan(path string, plan *Plan, signer *provenance.Signer) error {
+    data, err := json.MarshalIndent(plan, "", "  ")
+    if err != nil {
+        return fmt.Errorf("failed to encode plan: %v", err)
+    }
+    if signer != nil {
+        envelope, err := signer.SignAs(PlanPayloadType, data)
+        if err != nil {
+            return err
+        }
+        if data, err = json.MarshalIndent(envelope, "", "  "); err != nil {
+            return fmt.Errorf("failed to encode signed plan: %v", err)
+        }
+    }
+    if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+        return fmt.Errorf("failed to write plan: %v", err)
+    }
+    return nil
+}
+
+// LoadPlan reads a plan written by WritePlan. With a key the plan must be
+// signed by it, so a plan edited after review is rejected
+func LoadPlan(path string, key *provenance.PublicKey) (*Plan, error) {
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return nil, fmt.Errorf("failed to read plan: %v", err)
+    }
+
+    var envelope provenance.Envelope
+    if err := json.Unmarshal(data, &envelope); err != nil {
+        return nil, fmt.Errorf("failed to parse plan %s: %v", path, err)
+    }
+    switch {
+    case envelope.PayloadType == "" && key != nil:
+        return nil, fmt.Errorf("plan %s is not signed", path)
+    case envelope.PayloadType != "" && envelope.PayloadType != PlanPayloadType:
+        return nil, fmt.Errorf("%s holds a %s, not a migration plan", path, envelope.PayloadType)
+    case envelope.PayloadType != "":
+        if key != nil {
+            if err := key.Verify(envelope); err != nil {
+                return nil, fmt.Errorf("plan %s: %v", path, err)
+            }
+        }
+        if data, err = base64.StdEncoding.DecodeString(envelope.Payload); err != nil {
+            return nil, fmt.Errorf("failed to decode plan %s: %v", path, err)
+        }
+    }
+
+    var plan Plan
+    if err := json.Unmarshal(data, &plan); err != nil {
+        return nil, fmt.Errorf("failed to parse plan %s: %v", path, err)
+    }
+    if plan.SourceOrganization == "" || plan.TargetOrganization == "" {
+        return nil, fmt.Errorf("%s is not a migration plan", path)
+    }
+    return &plan, nil
+}
+
+// planExecution holds sync --plan-file to the versions its plan creates
+// or overwrites, and to what they were when it was made
+type planExecution struct {
+    plan   *Plan
+    steps  map[string]PlannedVersion // by type, package, and version ID
+    target map[string]map[string]bool
+}
+
+func planStepKey(packageType, name, versionID string) string {
+    return packageType + "/" + name + "@" + versionID
+}
+
+// executePlan loads the plan at path for this run's organizations and
+// package type, which must be those it was made for
+func (s *PackageSync) executePlan(path string, key *provenance.PublicKey, sourceOrg, targetOrg, packageType string) (*planExecution, error) {
+    plan, err := LoadPlan(path, key)
+    if err != nil {
+        return nil, err
+    }
+    if plan.SourceOrganization != sourceOrg || plan.TargetOrganization != targetOrg || plan.PackageType != packageType {
+        return nil, fmt.Errorf("plan %s was made for %s to %s (type %q), not %s to %s (type %q)", path,
+            plan.SourceOrganization, plan.TargetOrganization, plan.PackageType, sourceOrg, targetOrg, packageType)
+    }
+    for _, setting := range planSelection {
+        if value := viper.GetString(setting[1]); value != "" && value != "false" && value != "0" {
+            return nil, fmt.Errorf("the plan already selected its versions, --%s can't be combined with --plan-file", setting[0])
+        }
+    }
+
+    target, err := s.targetVersions(targetOrg, packageType)
+    if err != nil {
+        return nil, err
+    }
+    e := &planExecution{plan: plan, steps: make(map[string]PlannedVersion), target: target}
+    for _, step := range plan.Versions {
+        if step.Action == ActionCreate || step.Action == ActionOverwrite {
+            e.steps[planStepKey(step.PackageType, step.Package, step.VersionID)] = step
+        }
+    }
+    return e, nil
+}
+
+// Narrow keeps the versions the plan migrates, and warns about planned
+// versions the source no longer lists
+func (e *planExecution) Narrow(packages []api.Package) []api.Package {
+    listed := make(map[string]bool)
+    var narrowed []api.Package
+    for _, p := range packages {
+        var versions []api.Version
+        for _, v := range p.Versions {
+            key := planStepKey(p.PackageType, p.Name, v.ID)
+            if _, ok := e.steps[key]; ok {
+                versions = append(versions, v)
+                listed[key] = true
+            }
+        }
+        if len(versions) > 0 {
+            p.Versions = versions
+            narrowed = append(narrowed, p)
+        }
+    }
+
+    pterm.Info.Printf("Executing the plan made %s by run %s: %d versions to create, %d to overwrite\n",
+        e.plan.CreatedAt.Format(time.RFC3339), e.plan.RunID, e.plan.Totals[ActionCreate], e.plan.Totals[ActionOverwrite])
+    for key, step := range e.steps {
+        if !listed[key] {
+            pterm.Warning.Printf("Planned %s %s version %s is no longer in the source\n", step.PackageType, step.Package, step.Version)
+        }
+    }
+    return narrowed
+}
+
+// Check makes sure version is still what the plan was made for: going to
+// the same target, which still does or doesn't have it, with the same
+// files. It returns version with only the planned files
+func (e *planExecution) Check(s *PackageSync, p api.Package, version api.Version) (api.Version, error) {
+    step := e.steps[planStepKey(p.PackageType, p.Name, version.ID)]
+
+    targetName, targetVersion := s.getTargetVersion(p.Name, version.Name)
+    if targetName != step.TargetPackage || targetVersion != step.TargetVersion {
+        return version, fmt.Errorf("planned for %s:%s but now goes to %s:%s, run sync with the mapping and prefix flags the plan was made with",
+            step.TargetPackage, step.TargetVersion, targetName, targetVersion)
+    }
+
+    versions, exists := e.target[targetName]
+    switch {
+    case step.Action == ActionCreate && exists && versions[targetVersion]:
+        return version, fmt.Errorf("planned to create %s:%s but the target has it now, make a new plan", targetName, targetVersion)
+    case step.Action == ActionOverwrite && !versions[targetVersion]:
+        return version, fmt.Errorf("planned to overwrite %s:%s but the target no longer has it, make a new plan", targetName, targetVersion)
+    }
+
+    if step.Files != nil {
+        planned := make(map[string]bool, len(step.Files))
+        for _, name := range step.Files {
+            planned[name] = true
+        }
+        var files []api.File
+        for _, file := range version.Files {
+            if planned[file.Name] {
+                files = append(files, file)
+            }
+        }
+        if len(files) != len(step.Files) {
+            return version, fmt.Errorf("%d of its %d planned files are no longer in the source, make a new plan", len(step.Files)-len(files), len(step.Files))
+        }
+        version.Files = files
+    }
+    if size := versionSize(version); size != step.Size {
+        return version, fmt.Errorf("planned at %s but now %s, make a new plan", filter.FormatSize(step.Size), filter.FormatSize(size))
+    }
+    return version, nil
+}
+
+// writePlanFromConfig writes what the dry run found as the plan at
+// PLAN_OUT, signed with PLAN_KEY when set
+func writePlanFromConfig(sourceOrg, targetOrg, packageType string, planned []PlannedVersion) error {
+    var signer *provenance.Signer
+    if key := viper.GetString("PLAN_KEY"); key != "" {
+        var err error
+        if signer, err = provenance.LoadSigner(key); err != nil {
+            return err
+        }
+    }
+    path := viper.GetString("PLAN_OUT")
+    plan := newPlan(sourceOrg, targetOrg, packageType, planned)
+    if err := WritePlan(path, plan, signer); err != nil {
+        return err
+    }
+
+    pterm.Success.Printf("Plan for %d versions written to %s\n", len(planned), path)
+    without := []string{"out", "plan-key"}
+    for _, setting := range planSelection {
+        without = append(without, setting[0])
+    }
+    pterm.Info.Println("Review it, then apply exactly that with:")
+    pterm.Println("  " + run.CommandAs("migrate-packages sync", without, run.Arg{Flag: "plan-file", Value: path}))
+    if signer != nil {
+        pterm.Info.Println("Add --plan-public-key with the public half of --plan-key to refuse the plan if it is edited after review")
+    }
+    return nil
+}
+
+// PlanMigration lists and maps everything the way sync does, uploading
+// nothing, and writes the actions a sync would take as a plan
+func PlanMigration() error {
+    viper.Set("DRY_RUN", true)
+    viper.Set("DRY_RUN_REPORT", "")
+    return SyncPackages()
+}
@@ -0,0 +1,69 @@
+package sync
+
+import (
+    "strings"
+
+    "github.com/cvega/gh-migrate-packages/pkg/api"
+    "github.com/cvega/gh-migrate-packages/pkg/package"
+)
+
+// TargetPrefixes namespaces migrated packages so they can sit next to
+// packages already published in a busy target organization. A type specific
+// setting replaces Name for packages of that type
+type TargetPrefixes struct {
+    Name          string // before the package name, after any npm scope
+    NpmScope      string // appended to the npm scope, @acme/ui -> @acme-legacy/ui
+    MavenGroup    string // before the Maven groupId
+    ContainerPath string // before the container image path, e.g. legacy/
+}
+
+func (p TargetPrefixes) empty() bool {
+    return p == TargetPrefixes{}
+}
+
+// Apply returns name with the prefixes for packageType added
+func (p TargetPrefixes) Apply(packageType, name string) string {
+    switch pkg.PackageType(packageType) {
+    case pkg.PackageTypeNpm:
+        scope, bare := "", name
+        if strings.HasPrefix(name, "@") {
+            if i := strings.Index(name, "/"); i >= 0 {
+                scope, bare = name[:i], name[i+1:]
+            }
+        }
+        if p.NpmScope != "" {
+            if scope == "" {
+                return name // Only scoped packages have a scope to rename
+            }
+            return scope + p.NpmScope + "/" + bare
+        }
+        if scope != "" {
+            return scope + "/" + p.Name + bare
+        }
+    case pkg.PackageTypeMaven:
+        // GitHub names Maven packages groupId.artifactId
+        if p.MavenGroup != "" {
+            return p.MavenGroup + name
+        }
+    case pkg.PackageTypeContainer:
+        if p.ContainerPath != "" {
+            return p.ContainerPath + name
+        }
+    }
+    return p.Name + name
+}
+
+// ApplyTargetPrefixes prefixes the target name of every package that isn't
+// explicitly renamed by the mapping file
+func (s *PackageSync) ApplyTargetPrefixes(packages []api.Package, prefixes TargetPrefixes) {
+    if prefixes.empty() {
+        return
+    }
+
+    for _, p := range packages {
+        if s.getTargetPackageName(p.Name) != p.Name {
+            continue
+        }
+        s.mappings[p.Name] = prefixes.Apply(p.PackageType, p.Name)
+    }
+}
@@ -0,0 +1,56 @@
+package sync
+
+import (
+    "log"
+    "sort"
+
+    "github.com/cvega/gh-migrate-packages/pkg/api"
+    "github.com/pterm/pterm"
+)
+
+// Package orders of --order
+const (
+    OrderListing       = "listing"
+    OrderDownloadsDesc = "downloads-desc"
+)
+
+func downloadsCount(pkg api.Package) int {
+    if pkg.Statistics == nil {
+        return 0
+    }
+    return pkg.Statistics.DownloadsCount
+}
+
+// skipRarelyDownloaded leaves out the packages pulled fewer than min times
+// in the source, logging each one
+func skipRarelyDownloaded(packages []api.Package, min int) []api.Package {
+    if min <= 0 {
+        return packages
+    }
+    var kept []api.Package
+    skipped := 0
+    for _, pkg := range packages {
+        if downloads := downloadsCount(pkg); downloads < min {
+            log.Printf("Skipping %s, downloaded %d times", pkg.Name, downloads)
+            skipped++
+            continue
+        }
+        kept = append(kept, pkg)
+    }
+    if skipped > 0 {
+        pterm.Info.Printf("%d packages downloaded fewer than %d times left out by --min-downloads\n", skipped, min)
+    }
+    return kept
+}
+
+// orderPackages sorts the packages in the order they are migrated. With
+// downloads-desc the most pulled packages reach the target first, so a
+// phased cutover can start moving consumers before the long tail is done
+func orderPackages(packages []api.Package, order string) {
+    if order != OrderDownloadsDesc {
+        return
+    }
+    sort.SliceStable(packages, func(i, j int) bool {
+        return downloadsCount(packages[i]) > downloadsCount(packages[j])
+    })
+}
@@ -0,0 +1,167 @@
+package sync
+
+import (
+    "fmt"
+    "os"
+
+    "github.com/pterm/pterm"
+    "github.com/spf13/viper"
+    "github.com/cvega/gh-migrate-packages/pkg/api"
+    "github.com/cvega/gh-migrate-packages/pkg/csvfile"
+    "github.com/cvega/gh-migrate-packages/pkg/run"
+)
+
+// InventoryGap is a package version one organization has and another lacks
+type InventoryGap struct {
+    PackageType string
+    Expected    string // package name in the organization that has it
+    Missing     string // package name it was looked for under
+    Version     string
+}
+
+// findGaps returns every version of expected that actual lacks, after
+// rename maps an expected name and version to the one actual should hold
+func findGaps(expected, actual []api.Package, rename func(name, version string) (string, string)) []InventoryGap {
+    have := make(map[string]bool)
+    for _, p := range actual {
+        for _, v := range p.Versions {
+            have[p.PackageType+"/"+p.Name+"@"+v.Name] = true
+        }
+    }
+
+    var gaps []InventoryGap
+    for _, p := range expected {
+        for _, v := range p.Versions {
+            name, version := rename(p.Name, v.Name)
+            if have[p.PackageType+"/"+name+"@"+version] {
+                continue
+            }
+            gaps = append(gaps, InventoryGap{
+                PackageType: p.PackageType,
+                Expected:    p.Name,
+                Missing:     name,
+                Version:     version,
+            })
+        }
+    }
+    return gaps
+}
+
+func sameName(name, version string) (string, string) {
+    return name, version
+}
+
+// PromotePackages moves a migration that landed in a staging organization
+// into the final one. Staging is first checked against the original source,
+// when one is given, so a bad run never reaches production; staging is only
+// read, and the final organization is checked against staging afterwards
+func PromotePackages() {
+    stagingOrg := viper.GetString("STAGING_ORGANIZATION")
+    packageType := viper.GetString("PACKAGE_TYPE")
+    staging := api.NewAPI(viper.GetString("TARGET_TOKEN"), "")
+    staging.SetReadOnly()
+
+    spinner, _ := pterm.DefaultSpinner.Start("Fetching packages from staging organization...")
+    stagingPackages, err := staging.GetOrganizationPackages(stagingOrg, packageType)
+    if err != nil {
+        spinner.Fail(fmt.Sprintf("Failed to fetch staging packages: %v", err))
+        return
+    }
+    spinner.Success(fmt.Sprintf("Found %d packages in %s", len(stagingPackages), stagingOrg))
+
+    // Verify staging holds everything the source run was meant to migrate
+    if sourceOrg := viper.GetString("VERIFY_SOURCE_ORGANIZATION"); sourceOrg != "" {
+        if viper.GetString("VERIFY_SOURCE_TOKEN") == "" {
+            pterm.Error.Println("--verify-source-token is required to verify against the source organization")
+            return
+        }
+        check := NewPackageSync(viper.GetString("VERIFY_SOURCE_TOKEN"), "", viper.GetString("SOURCE_HOSTNAME"))
+        check.sourceAPI.SetReadOnly()
+        if err := check.LoadMappings(viper.GetString("MAPPING_FILE")); err != nil {
+            pterm.Error.Printf("Failed to load mappings: %v\n", err)
+            return
+        }
+
+        spinner, _ = pterm.DefaultSpinner.Start("Verifying staging against the source organization...")
+        sourcePackages, err := check.sourceAPI.GetOrganizationPackages(sourceOrg, packageType)
+        if err != nil {
+            spinner.Fail(fmt.Sprintf("Failed to fetch source packages: %v", err))
+            return
+        }
+
+        gaps := findGaps(sourcePackages, stagingPackages, check.getTargetVersion)
+        if len(gaps) > 0 && !viper.GetBool("FORCE") {
+            spinner.Fail(fmt.Sprintf("Staging is missing %d versions from %s, not promoting", len(gaps), sourceOrg))
+            reportGaps(gaps)
+            return
+        }
+        spinner.Success("Staging verified against the source organization")
+    }
+
+    // Copy staging into the final organization with the regular sync,
+    // reading staging through a read-only client
+    viper.Set("SOURCE_ORGANIZATION", stagingOrg)
+    viper.Set("SOURCE_TOKEN", viper.GetString("TARGET_TOKEN"))
+    viper.Set("SOURCE_HOSTNAME", "")
+    viper.Set("MAPPING_FILE", "")
+    viper.Set("ASSERT_READ_ONLY_SOURCE", true)
+    viper.Set("RESTORE_DELETED", false)
+    viper.Set("SNAPSHOT", "") // snapshots describe the original source
+    if err := SyncPackages(); err != nil {
+        pterm.Error.Println(err)
+        return
+    }
+
+    // Confirm every staged version reached the final organization
+    final := api.NewAPI(viper.GetString("TARGET_TOKEN"), "")
+    finalPackages, err := final.GetOrganizationPackages(viper.GetString("TARGET_ORGANIZATION"), packageType)
+    if err != nil {
+        pterm.Error.Printf("Failed to fetch promoted packages: %v\n", err)
+        return
+    }
+
+    gaps := findGaps(stagingPackages, finalPackages, sameName)
+    if len(gaps) > 0 {
+        pterm.Error.Printf("%d staged versions are missing from the final organization, rerun promote to retry them\n", len(gaps))
+        reportGaps(gaps)
+        return
+    }
+    pterm.Success.Printf("Promoted %d packages from %s\n", len(stagingPackages), stagingOrg)
+}
+
+func reportGaps(gaps []InventoryGap) {
+    table := pterm.TableData{
+        {"Type", "Package", "Expected As", "Version"},
+    }
+    for _, g := range gaps {
+        table = append(table, []string{g.PackageType, g.Expected, g.Missing, g.Version})
+    }
+    pterm.DefaultTable.WithHasHeader().WithData(table).Render()
+
+    if report := run.ReportPath(viper.GetString("GAP_REPORT")); report != "" {
+        if err := writeGapReport(report, gaps); err != nil {
+            pterm.Error.Printf("Failed to write gap report: %v\n", err)
+        }
+    }
+}
+
+func writeGapReport(filename string, gaps []InventoryGap) error {
+    file, err := os.Create(filename)
+    if err != nil {
+        return err
+    }
+    defer file.Close()
+
+    writer := csvfile.NewWriter(file)
+    defer writer.Flush()
+
+    if err := writer.Write([]string{"Type", "Package", "Expected As", "Version"}); err != nil {
+        return err
+    }
+    for _, g := range gaps {
+        if err := writer.Write([]string{g.PackageType, g.Expected, g.Missing, g.Version}); err != nil {
+            return err
+        }
+    }
+    return nil
+}
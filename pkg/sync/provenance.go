@@ -0,0 +1,53 @@
+package sync
+
+import (
+    "path/filepath"
+    "strings"
+
+    "github.com/cvega/gh-migrate-packages/pkg/api"
+    "github.com/cvega/gh-migrate-packages/pkg/provenance"
+)
+
+// fileDescriptors digests files for a provenance statement, naming each by
+// its base name and adding the URL it was listed under when urls has one
+func fileDescriptors(files []string, urls map[string]string) ([]provenance.ResourceDescriptor, error) {
+    var descriptors []provenance.ResourceDescriptor
+    for _, file := range files {
+        digest, err := api.FileSHA256(file)
+        if err != nil {
+            return nil, err
+        }
+        name := filepath.Base(file)
+        descriptors = append(descriptors, provenance.ResourceDescriptor{
+            Name:   name,
+            URI:    urls[name],
+            Digest: map[string]string{"sha256": digest},
+        })
+    }
+    return descriptors, nil
+}
+
+// sourceURLs maps the base name of every file a version lists to the URL
+// it downloads from
+func sourceURLs(version api.Version) map[string]string {
+    urls := make(map[string]string, len(version.Files))
+    for _, file := range version.Files {
+        if file.URL != "" {
+            urls[filepath.Base(file.Name)] = file.URL
+        }
+    }
+    return urls
+}
+
+// imageDescriptor describes an image tag pinned by an algorithm:hex digest
+func imageDescriptor(image, tag, digest string) provenance.ResourceDescriptor {
+    algorithm, hex, found := strings.Cut(digest, ":")
+    if !found {
+        algorithm, hex = "sha256", digest
+    }
+    return provenance.ResourceDescriptor{
+        Name:   image + ":" + tag,
+        URI:    image + "@" + digest,
+        Digest: map[string]string{algorithm: hex},
+    }
+}
@@ -0,0 +1,30 @@
+package sync
+
+import (
+    "fmt"
+    "strings"
+
+    "github.com/spf13/viper"
+)
+
+// assertReadOnlySource rejects configurations where the target token would
+// write into the source organization. The target client always talks to
+// github.com, so only a source on github.com can overlap with it
+func assertReadOnlySource(sourceOrg, targetOrg string) error {
+    host := strings.TrimSuffix(strings.TrimPrefix(strings.TrimPrefix(viper.GetString("SOURCE_HOSTNAME"), "https://"), "http://"), "/")
+    if host != "" && host != "github.com" && host != "api.github.com" {
+        return nil
+    }
+
+    if strings.EqualFold(sourceOrg, targetOrg) {
+        return fmt.Errorf("read-only source asserted but the target organization is the source organization %s", sourceOrg)
+    }
+
+    if repo := viper.GetString("OPEN_ISSUES"); repo != "" {
+        if owner, _, _ := strings.Cut(repo, "/"); strings.EqualFold(owner, sourceOrg) {
+            return fmt.Errorf("read-only source asserted but --open-issues would file issues in the source organization %s", sourceOrg)
+        }
+    }
+
+    return nil
+}
@@ -0,0 +1,206 @@
+package sync
+
+import (
+    "archive/tar"
+    "compress/gzip"
+    "encoding/csv"
+    "encoding/json"
+    "fmt"
+    "io"
+    "net/url"
+    "os"
+    "path"
+    "path/filepath"
+    "sort"
+    "strings"
+
+    "github.com/cvega/gh-migrate-packages/pkg/api"
+    "github.com/pterm/pterm"
+)
+
+// RepositoryLinks resolves the repository a source package is linked to to
+// the repository it became in the target, from the archive of a repository
+// migration made with ghe-migrator or GitHub Enterprise Importer
+type RepositoryLinks struct {
+    repositories map[string]string // source owner/name, lower case, to its name in the archive
+    mapped       map[string]string // source owner/name, lower case, to a mapping row's target
+}
+
+// archiveRepository is the part of a repositories_*.json record we need
+type archiveRepository struct {
+    URL  string `json:"url"`
+    Name string `json:"name"`
+}
+
+// LoadMigrationArchive reads the repositories_*.json files of a migration
+// archive, as a .tar.gz, .tar, or extracted directory, and any mapping CSV
+// in it in the model_name,source_url,target_url format of ghe-migrator
+// conflicts. Repositories without a mapping row keep their name
+func LoadMigrationArchive(archivePath string) (*RepositoryLinks, error) {
+    links := &RepositoryLinks{repositories: make(map[string]string), mapped: make(map[string]string)}
+    var mappings [][]string
+
+    visit := func(name string, r io.Reader) error {
+        base := path.Base(filepath.ToSlash(name))
+        switch {
+        case strings.HasPrefix(base, "repositories_") && strings.HasSuffix(base, ".json"):
+            var repos []archiveRepository
+            if err := json.NewDecoder(r).Decode(&repos); err != nil {
+                return fmt.Errorf("failed to parse %s: %v", name, err)
+            }
+            for _, repo := range repos {
+                if key := repositoryKey(repo.URL); key != "" {
+                    links.repositories[key] = repo.Name
+                }
+            }
+        case strings.HasSuffix(base, ".csv"):
+            rows, err := csv.NewReader(r).ReadAll()
+            if err != nil || len(rows) == 0 || len(rows[0]) < 3 || rows[0][0] != "model_name" {
+                return nil // not a mapping file
+            }
+            mappings = append(mappings, rows[1:]...)
+        }
+        return nil
+    }
+
+    info, err := os.Stat(archivePath)
+    if err != nil {
+        return nil, fmt.Errorf("failed to open migration archive: %v", err)
+    }
+    if info.IsDir() {
+        err = walkArchiveDir(archivePath, visit)
+    } else {
+        err = walkArchiveTar(archivePath, visit)
+    }
+    if err != nil {
+        return nil, err
+    }
+
+    // Mapping rows are applied last, whichever order the files came in
+    for _, row := range mappings {
+        if len(row) < 3 || row[0] != "repository" || row[2] == "" {
+            continue
+        }
+        if key := repositoryKey(row[1]); key != "" {
+            links.mapped[key] = row[2]
+        }
+    }
+
+    if len(links.repositories) == 0 && len(links.mapped) == 0 {
+        return nil, fmt.Errorf("no repositories found in migration archive %s", archivePath)
+    }
+    return links, nil
+}
+
+func walkArchiveDir(root string, visit func(name string, r io.Reader) error) error {
+    return filepath.Walk(root, func(name string, info os.FileInfo, err error) error {
+        if err != nil || info.IsDir() {
+            return err
+        }
+        file, err := os.Open(name)
+        if err != nil {
+            return fmt.Errorf("failed to read migration archive: %v", err)
+        }
+        defer file.Close()
+        return visit(name, file)
+    })
+}
+
+func walkArchiveTar(archivePath string, visit func(name string, r io.Reader) error) error {
+    file, err := os.Open(archivePath)
+    if err != nil {
+        return fmt.Errorf("failed to open migration archive: %v", err)
+    }
+    defer file.Close()
+
+    var r io.Reader = file
+    if strings.HasSuffix(archivePath, ".gz") || strings.HasSuffix(archivePath, ".tgz") {
+        gz, err := gzip.NewReader(file)
+        if err != nil {
+            return fmt.Errorf("failed to decompress migration archive: %v", err)
+        }
+        defer gz.Close()
+        r = gz
+    }
+
+    tr := tar.NewReader(r)
+    for {
+        header, err := tr.Next()
+        if err == io.EOF {
+            return nil
+        }
+        if err != nil {
+            return fmt.Errorf("failed to read migration archive: %v", err)
+        }
+        if header.Typeflag != tar.TypeReg {
+            continue
+        }
+        if err := visit(header.Name, tr); err != nil {
+            return err
+        }
+    }
+}
+
+// repositoryKey reduces a repository URL, or owner/name, to a lower case
+// owner/name, since the archive and the package API may differ in host
+func repositoryKey(repository string) string {
+    if u, err := url.Parse(repository); err == nil && u.Host != "" {
+        repository = u.Path
+    }
+    parts := strings.Split(strings.Trim(strings.TrimSuffix(repository, ".git"), "/"), "/")
+    if len(parts) < 2 || parts[len(parts)-2] == "" || parts[len(parts)-1] == "" {
+        return ""
+    }
+    return strings.ToLower(parts[len(parts)-2] + "/" + parts[len(parts)-1])
+}
+
+// Resolve returns the target URL of the repository repo was migrated to, in
+// targetOrg unless a mapping row moved it, or false when the archive
+// doesn't cover repo
+func (l *RepositoryLinks) Resolve(repo *api.Repository, targetOrg string) (string, bool) {
+    if l == nil || repo == nil {
+        return "", false
+    }
+    key := repositoryKey(repo.URL)
+    if key == "" {
+        key = repositoryKey(repo.FullName)
+    }
+    if target, ok := l.mapped[key]; ok {
+        if u, err := url.Parse(target); err == nil && u.Host != "" {
+            return strings.TrimSuffix(target, ".git"), true
+        }
+        return "https://github.com/" + strings.Trim(target, "/"), true
+    }
+
+    // Unmapped repositories keep their name and move to the target organization
+    name, ok := l.repositories[key]
+    if !ok {
+        return "", false
+    }
+    if name == "" {
+        name = key[strings.Index(key, "/")+1:]
+    }
+    return fmt.Sprintf("https://github.com/%s/%s", targetOrg, name), true
+}
+
+// reportUnlinked lists linked source repositories the archive doesn't
+// cover; their packages are linked by name as without an archive
+func reportUnlinked(unlinked map[string][]string) {
+    if len(unlinked) == 0 {
+        return
+    }
+    repos := make([]string, 0, len(unlinked))
+    for repo := range unlinked {
+        repos = append(repos, repo)
+    }
+    sort.Strings(repos)
+
+    table := pterm.TableData{
+        {"Source Repository", "Packages"},
+    }
+    for _, repo := range repos {
+        table = append(table, []string{repo, strings.Join(unlinked[repo], ", ")})
+    }
+    pterm.Warning.Printf("%d linked repositories are not in the migration archive, their packages were linked by package name\n", len(unlinked))
+    pterm.DefaultTable.WithHasHeader().WithData(table).Render()
+}
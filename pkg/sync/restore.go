@@ -0,0 +1,23 @@
+package sync
+
+import (
+    "log"
+
+    "github.com/cvega/gh-migrate-packages/pkg/api"
+    "github.com/pterm/pterm"
+)
+
+// restoreDeleted restores the source versions deleted within the recovery
+// window; a version that can't be restored is logged and left out
+func restoreDeleted(client *api.API, org, packageType string) {
+    restored, err := client.RestoreDeletedVersions(org, packageType)
+    if err != nil {
+        log.Printf("Error restoring deleted versions in %s: %v", org, err)
+    }
+    for _, v := range restored {
+        log.Printf("Restored %s version %s, deleted at %s", v.PackageName, v.Version, v.DeletedAt)
+    }
+    if len(restored) > 0 {
+        pterm.Info.Printf("Restored %d recently deleted versions in %s\n", len(restored), org)
+    }
+}
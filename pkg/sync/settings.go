@@ -0,0 +1,195 @@
+package sync
+
+import (
+    "fmt"
+    "os"
+    "strings"
+
+    "github.com/cvega/gh-migrate-packages/pkg/api"
+    "github.com/pterm/pterm"
+    "github.com/spf13/viper"
+)
+
+// Outcomes of comparing one organization setting
+const (
+    SettingMatch   = "match"
+    SettingDiffers = "differs"
+    SettingApplied = "applied"
+    SettingUnknown = "unknown" // a token can't read it
+    SettingManual  = "manual"  // only the web UI has it
+)
+
+// orgSetting is an organization setting that shapes how packages behave
+type orgSetting struct {
+    Name  string
+    Field string // REST field of /orgs/{org}, empty when only the web UI has it
+    About string
+}
+
+// packageSettings are replicated when the API exposes them and otherwise
+// become checklist items to compare by hand
+var packageSettings = []orgSetting{
+    {
+        Name:  "Base permission",
+        Field: "default_repository_permission",
+        About: "members get this access to packages that inherit access from their repository",
+    },
+    {
+        Name:  "Package creation",
+        About: "which visibilities (public, private, internal) members may publish new packages with",
+    },
+    {
+        Name:  "Default package access",
+        About: "whether new packages inherit access from the repository that publishes them",
+    },
+    {
+        Name:  "Package deletion",
+        About: "who may delete and restore packages, and any cleanup automation pruning old versions",
+    },
+}
+
+// SettingCheck is the comparison of one setting between the organizations
+type SettingCheck struct {
+    Setting string
+    Field   string
+    Source  string
+    Target  string
+    Status  string
+    About   string
+}
+
+// ReplicateSettings compares the package settings of the source and target
+// organizations, copies those the API can set when --apply is given, and
+// writes the rest as a checklist
+func ReplicateSettings() error {
+    sourceOrg := viper.GetString("SOURCE_ORGANIZATION")
+    targetOrg := viper.GetString("TARGET_ORGANIZATION")
+    source := api.NewAPI(viper.GetString("SOURCE_TOKEN"), viper.GetString("SOURCE_HOSTNAME"))
+    source.SetReadOnly()
+    target := api.NewAPI(viper.GetString("TARGET_TOKEN"), "")
+    apply := viper.GetBool("APPLY")
+
+    sourceSettings, err := source.GetOrganizationSettings(sourceOrg)
+    if err != nil {
+        return err
+    }
+    targetSettings, err := target.GetOrganizationSettings(targetOrg)
+    if err != nil {
+        return err
+    }
+
+    checks := compareSettings(sourceSettings, targetSettings)
+
+    if apply {
+        update := make(map[string]interface{})
+        for _, c := range checks {
+            if c.Status == SettingDiffers {
+                update[c.Field] = sourceSettings[c.Field]
+            }
+        }
+        if len(update) > 0 {
+            if err := target.UpdateOrganizationSettings(targetOrg, update); err != nil {
+                return err
+            }
+            for i := range checks {
+                if checks[i].Status == SettingDiffers {
+                    checks[i].Status = SettingApplied
+                    checks[i].Target = checks[i].Source
+                }
+            }
+        }
+    }
+
+    reportSettings(checks)
+
+    checklist := viper.GetString("CHECKLIST")
+    if checklist != "" {
+        content := settingsChecklist(sourceOrg, targetOrg, source.PackageSettingsURL(sourceOrg), target.PackageSettingsURL(targetOrg), checks)
+        if err := os.WriteFile(checklist, []byte(content), 0644); err != nil {
+            return fmt.Errorf("failed to write checklist: %v", err)
+        }
+        pterm.Info.Printf("Settings checklist written to %s\n", checklist)
+    }
+
+    differs := 0
+    for _, c := range checks {
+        if c.Status == SettingDiffers {
+            differs++
+        }
+    }
+    if differs > 0 {
+        pterm.Warning.Printf("%d package settings differ; rerun with --apply to copy them to %s\n", differs, targetOrg)
+    }
+    return nil
+}
+
+// compareSettings checks every package setting, API fields by value
+func compareSettings(source, target map[string]interface{}) []SettingCheck {
+    var checks []SettingCheck
+    for _, s := range packageSettings {
+        check := SettingCheck{Setting: s.Name, Field: s.Field, About: s.About}
+        if s.Field == "" {
+            check.Status = SettingManual
+            checks = append(checks, check)
+            continue
+        }
+
+        sourceValue, inSource := source[s.Field]
+        targetValue, inTarget := target[s.Field]
+        check.Source, check.Target = settingValue(sourceValue, inSource), settingValue(targetValue, inTarget)
+        switch {
+        case !inSource || !inTarget:
+            check.Status = SettingUnknown
+        case check.Source == check.Target:
+            check.Status = SettingMatch
+        default:
+            check.Status = SettingDiffers
+        }
+        checks = append(checks, check)
+    }
+    return checks
+}
+
+func settingValue(value interface{}, ok bool) string {
+    if !ok {
+        return "?"
+    }
+    return fmt.Sprintf("%v", value)
+}
+
+func reportSettings(checks []SettingCheck) {
+    table := pterm.TableData{
+        {"Setting", "Source", "Target", "Status"},
+    }
+    for _, c := range checks {
+        if c.Status == SettingManual {
+            table = append(table, []string{c.Setting, "-", "-", "check manually"})
+            continue
+        }
+        table = append(table, []string{c.Setting, c.Source, c.Target, c.Status})
+    }
+    pterm.DefaultTable.WithHasHeader().WithData(table).Render()
+}
+
+// settingsChecklist renders the comparison as a Markdown task list, with
+// settings that match or were applied already ticked
+func settingsChecklist(sourceOrg, targetOrg, sourceURL, targetURL string, checks []SettingCheck) string {
+    var b strings.Builder
+    fmt.Fprintf(&b, "# Package settings: %s -> %s\n\n", sourceOrg, targetOrg)
+    for _, c := range checks {
+        switch c.Status {
+        case SettingMatch:
+            fmt.Fprintf(&b, "- [x] **%s** (`%s`): `%s` in both\n", c.Setting, c.Field, c.Source)
+        case SettingApplied:
+            fmt.Fprintf(&b, "- [x] **%s** (`%s`): set to `%s` in %s\n", c.Setting, c.Field, c.Source, targetOrg)
+        case SettingDiffers:
+            fmt.Fprintf(&b, "- [ ] **%s** (`%s`): `%s` in %s but `%s` in %s; %s\n", c.Setting, c.Field, c.Source, sourceOrg, c.Target, targetOrg, c.About)
+        case SettingUnknown:
+            fmt.Fprintf(&b, "- [ ] **%s** (`%s`): not readable with the given tokens (source `%s`, target `%s`), use owner tokens or compare by hand; %s\n", c.Setting, c.Field, c.Source, c.Target, c.About)
+        default:
+            fmt.Fprintf(&b, "- [ ] **%s**: %s, not available in the API\n", c.Setting, c.About)
+        }
+    }
+    fmt.Fprintf(&b, "\nCompare the remaining items between %s and %s\n", sourceURL, targetURL)
+    return b.String()
+}
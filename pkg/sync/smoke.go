@@ -0,0 +1,65 @@
+package sync
+
+import (
+    "log"
+    "time"
+
+    "github.com/cvega/gh-migrate-packages/pkg/smoke"
+    "github.com/cvega/gh-migrate-packages/pkg/verify"
+    "github.com/pterm/pterm"
+    "github.com/spf13/viper"
+)
+
+// runSmokeTests resolves a sample of the migrated packages with the
+// clients their consumers use, so a registry that accepted an upload but
+// can't serve it is caught before cutover. It returns the report written,
+// if any
+func (s *PackageSync) runSmokeTests(targets map[string]smoke.Target, sample verify.Sample, report string) string {
+    var all []smoke.Target
+    for _, target := range targets {
+        all = append(all, target)
+    }
+    selected := smoke.Select(all, sample.Size(len(all)), time.Now().UnixNano())
+
+    tester, err := smoke.NewTester(s.targetAPI, viper.GetString("TARGET_TOKEN"))
+    if err != nil {
+        log.Printf("Error preparing smoke tests: %v", err)
+        return ""
+    }
+    defer tester.Close()
+
+    var results []smoke.Result
+    passed, failed, skipped := 0, 0, 0
+    progressbar, _ := pterm.DefaultProgressbar.WithTotal(len(selected)).WithTitle("Smoke testing migrated packages").Start()
+    for _, target := range selected {
+        result := tester.Run(target)
+        switch result.Status {
+        case smoke.StatusPassed:
+            passed++
+        case smoke.StatusFailed:
+            failed++
+            log.Printf("Smoke test of %s %s@%s failed: %s", target.PackageType, target.Name, target.Version, result.Detail)
+        default:
+            skipped++
+        }
+        results = append(results, result)
+        progressbar.Increment()
+    }
+    progressbar.Stop()
+
+    written := ""
+    if report != "" {
+        if err := smoke.WriteReport(report, results); err != nil {
+            log.Printf("Error writing smoke test report: %v", err)
+            report = ""
+        } else {
+            written = ", see " + report
+        }
+    }
+    if failed > 0 {
+        pterm.Warning.Printf("%d of %d smoke tests failed, %d skipped%s\n", failed, len(results), skipped, written)
+        return report
+    }
+    pterm.Info.Printf("%d of %d smoke tests passed, %d skipped%s\n", passed, len(results), skipped, written)
+    return report
+}
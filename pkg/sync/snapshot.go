@@ -0,0 +1,75 @@
+package sync
+
+import (
+    "fmt"
+    "log"
+
+    "github.com/cvega/gh-migrate-packages/pkg/api"
+    "github.com/cvega/gh-migrate-packages/pkg/run"
+    "github.com/cvega/gh-migrate-packages/pkg/snapshot"
+    "github.com/pterm/pterm"
+    "github.com/spf13/viper"
+)
+
+// reportLateVersions warns about versions published after the snapshot,
+// which this run leaves alone, and lists them for a follow-up delta sync
+func reportLateVersions(late []snapshot.LateVersion) {
+    if len(late) == 0 {
+        return
+    }
+
+    pterm.Warning.Printf("%d versions were published after the snapshot and won't be migrated by this run\n", len(late))
+    report := run.ReportPath(viper.GetString("LATE_PUBLISHES_REPORT"))
+    if report == "" {
+        return
+    }
+    if err := snapshot.WriteLateVersions(report, late); err != nil {
+        log.Printf("Error writing late publish report: %v", err)
+        return
+    }
+    pterm.Info.Printf("Late versions listed in %s\n", report)
+}
+
+// Final check modes of --final-check
+const (
+    FinalCheckReport  = "report"
+    FinalCheckMigrate = "migrate"
+)
+
+// finalCheck lists the source again once the main pass is done and reports
+// the versions published since baseline was taken, the gap a cutover would
+// otherwise leave behind. With migrate, they are returned to be migrated
+// in one more pass
+func (s *PackageSync) finalCheck(baseline *snapshot.Snapshot, sourceOrg, packageType string, migrate bool) []api.Package {
+    spinner, _ := pterm.DefaultSpinner.Start("Final check: listing the source organization again...")
+    packages, err := s.sourceAPI.GetOrganizationPackages(sourceOrg, packageType)
+    if err != nil {
+        spinner.Fail(fmt.Sprintf("Final check failed, versions published during the run may be missing: %v", err))
+        return nil
+    }
+
+    unlisted, late := baseline.Unlisted(sourceOrg, packages)
+    if len(late) == 0 {
+        spinner.Success("Final check: no versions were published during the run")
+        return nil
+    }
+
+    report := run.ReportPath(viper.GetString("LATE_PUBLISHES_REPORT"))
+    if report != "" {
+        if err := snapshot.WriteLateVersions(report, late); err != nil {
+            log.Printf("Error writing late publish report: %v", err)
+            report = ""
+        }
+    }
+
+    message := fmt.Sprintf("Final check: %d versions were published during the run", len(late))
+    if report != "" {
+        message += ", see " + report
+    }
+    if !migrate {
+        spinner.Warning(message + "; rerun with --final-check migrate or a delta sync to transfer them")
+        return nil
+    }
+    spinner.Warning(message + "; migrating them now")
+    return unlisted
+}
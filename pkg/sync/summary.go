@@ -0,0 +1,144 @@
+package sync
+
+import (
+    "sort"
+    "strconv"
+    "time"
+
+    "github.com/cvega/gh-migrate-packages/pkg/filter"
+    "github.com/cvega/gh-migrate-packages/pkg/run"
+    "github.com/pterm/pterm"
+    "github.com/spf13/viper"
+)
+
+// What happened to each version a run looked at, as the summary counts it
+const (
+    OutcomeMigrated  = "migrated"
+    OutcomeDuplicate = "already migrated"
+    OutcomeArchived  = "archived"
+    OutcomeFailed    = "failed"
+    OutcomeReview    = "held for review"
+    OutcomeSkipped   = "skipped"
+)
+
+var summaryOutcomes = []string{OutcomeMigrated, OutcomeDuplicate, OutcomeArchived, OutcomeFailed, OutcomeReview, OutcomeSkipped}
+
+// runSummary is printed at the end of a sync: what happened to the versions
+// of each type, what was transferred, the files the run wrote, and the
+// commands that retry and verify it
+type runSummary struct {
+    started time.Time
+    counts  map[string]map[string]int
+    sizes   map[string]int64 // of the versions that reached the target
+    files   [][2]string      // what each file holds, and its path
+}
+
+func newRunSummary() *runSummary {
+    return &runSummary{
+        started: time.Now(),
+        counts:  make(map[string]map[string]int),
+        sizes:   make(map[string]int64),
+    }
+}
+
+// count records the outcome of versions of packageType. The size of
+// migrated ones is added to the total
+func (r *runSummary) count(packageType, outcome string, versions int, size int64) {
+    if r.counts[packageType] == nil {
+        r.counts[packageType] = make(map[string]int)
+    }
+    r.counts[packageType][outcome] += versions
+    if outcome == OutcomeMigrated {
+        r.sizes[packageType] += size
+    }
+}
+
+// file lists a file the run wrote, the state file, a report, or a log
+func (r *runSummary) file(what, path string) {
+    if path != "" {
+        r.files = append(r.files, [2]string{what, path})
+    }
+}
+
+// print renders the summary. state is the checkpoint the run kept, if any,
+// provenance the log verify checks the target against, and stopped tells
+// a run that ended before reaching every version
+func (r *runSummary) print(transferred int64, state, provenance string, stopped bool) {
+    var types []string
+    for packageType := range r.counts {
+        types = append(types, packageType)
+    }
+    sort.Strings(types)
+
+    pterm.DefaultSection.Printf("Run %s summary", run.ID())
+    header := []string{"Type"}
+    for _, outcome := range summaryOutcomes {
+        header = append(header, outcome)
+    }
+    table := pterm.TableData{append(header, "Migrated size")}
+    total := make(map[string]int)
+    var size int64
+    for _, packageType := range types {
+        row := []string{packageType}
+        for _, outcome := range summaryOutcomes {
+            total[outcome] += r.counts[packageType][outcome]
+            row = append(row, strconv.Itoa(r.counts[packageType][outcome]))
+        }
+        size += r.sizes[packageType]
+        table = append(table, append(row, filter.FormatSize(r.sizes[packageType])))
+    }
+    row := []string{"total"}
+    for _, outcome := range summaryOutcomes {
+        row = append(row, strconv.Itoa(total[outcome]))
+    }
+    table = append(table, append(row, filter.FormatSize(size)))
+    pterm.DefaultTable.WithHasHeader().WithData(table).Render()
+    pterm.Info.Printf("%s transferred in %s\n", filter.FormatSize(transferred), time.Since(r.started).Round(time.Second))
+
+    files := r.files
+    if state != "" {
+        files = append([][2]string{{"State file", state}}, files...)
+    }
+    if path := run.LogFile(); path != "" {
+        files = append(files, [2]string{"Log", path})
+    }
+    if len(files) > 0 {
+        table = pterm.TableData{{"File", "Path"}}
+        for _, f := range files {
+            table = append(table, []string{f[0], f[1]})
+        }
+        pterm.DefaultTable.WithHasHeader().WithData(table).Render()
+    }
+
+    pterm.DefaultSection.Println("Next steps")
+    failed := total[OutcomeFailed]
+    switch {
+    case state != "" && stopped:
+        pterm.Info.Printf("Continue where the run stopped and retry its %d failed versions, skipping what it migrated, with:\n", failed)
+        pterm.Println("  " + run.Command([]string{"checkpoint", "resume"}, run.Arg{Flag: "resume", Value: state}))
+    case state != "" && failed > 0:
+        pterm.Info.Printf("Retry the %d failed versions, skipping what the run migrated, with:\n", failed)
+        pterm.Println("  " + run.Command([]string{"checkpoint", "resume"}, run.Arg{Flag: "resume", Value: state}))
+    case failed > 0:
+        pterm.Info.Printf("Retry the %d failed versions by running the sync again. This run kept no state file, so every version is attempted again, and the next run keeps one:\n", failed)
+        pterm.Println("  " + run.Command([]string{"checkpoint"}, run.Arg{Flag: "checkpoint", Value: defaultCheckpoint}))
+    }
+    if provenance != "" {
+        pterm.Info.Println("Check the migrated artifacts against the digests this run recorded with:")
+        pterm.Println("  " + verifyCommand(provenance))
+    } else if total[OutcomeMigrated] > 0 {
+        pterm.Info.Println("Run sync with --provenance to record digests verify can check the target against")
+    }
+}
+
+// verifyCommand is the verify invocation for a run's provenance log
+func verifyCommand(provenance string) string {
+    args := []run.Arg{
+        {Flag: "provenance", Value: provenance},
+        {Flag: "target-token", Value: "$GHMP_TARGET_TOKEN"},
+    }
+    for _, registry := range splitList(viper.GetString("TARGET_REGISTRY_URLS")) {
+        args = append(args, run.Arg{Flag: "registry-url", Value: registry})
+    }
+    return run.Invocation("migrate-packages verify", args)
+}
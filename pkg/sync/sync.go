@@ -5,19 +5,47 @@ import (
     "log"
     "path/filepath"
     "strings"
-    "encoding/csv"
     "os"
+    "time"
 
     "github.com/pterm/pterm"
     "github.com/spf13/viper"
     "github.com/cvega/gh-migrate-packages/pkg/api"
+    "github.com/cvega/gh-migrate-packages/pkg/attest"
+    "github.com/cvega/gh-migrate-packages/pkg/checkpoint"
+    "github.com/cvega/gh-migrate-packages/pkg/control"
+    "github.com/cvega/gh-migrate-packages/pkg/csvfile"
+    "github.com/cvega/gh-migrate-packages/pkg/extension"
+    "github.com/cvega/gh-migrate-packages/pkg/filter"
     "github.com/cvega/gh-migrate-packages/pkg/package"
+    "github.com/cvega/gh-migrate-packages/pkg/progress"
+    "github.com/cvega/gh-migrate-packages/pkg/provenance"
+    "github.com/cvega/gh-migrate-packages/pkg/run"
+    "github.com/cvega/gh-migrate-packages/pkg/smoke"
+    "github.com/cvega/gh-migrate-packages/pkg/snapshot"
+    "github.com/cvega/gh-migrate-packages/pkg/transform"
+    "github.com/cvega/gh-migrate-packages/pkg/transport"
+    "github.com/cvega/gh-migrate-packages/pkg/verify"
 )
 
 type PackageSync struct {
     sourceAPI *api.API
     targetAPI *api.API
     mappings  map[string]string // For package name mappings if provided
+    tags      map[string]string // For container name:tag mappings if provided
+
+    visibilities map[string]string // target visibility by source name, from the mapping file
+    repositories map[string]string // target repository by source name, from the mapping file
+}
+
+// DigestMapping pairs a source image pinned by digest with its migrated copy
+type DigestMapping struct {
+    SourceImage  string
+    SourceTag    string
+    SourceDigest string
+    TargetImage  string
+    TargetTag    string
+    TargetDigest string
 }
 
 type ValidationReport struct {
@@ -34,6 +62,10 @@ func NewPackageSync(sourceToken, targetToken, sourceHost string) *PackageSync {
         sourceAPI: api.NewAPI(sourceToken, sourceHost),
         targetAPI: api.NewAPI(targetToken, ""),
         mappings:  make(map[string]string),
+        tags:      make(map[string]string),
+
+        visibilities: make(map[string]string),
+        repositories: make(map[string]string),
     }
 }
 
@@ -48,28 +80,127 @@ func (s *PackageSync) LoadMappings(mappingFile string) error {
     }
     defer file.Close()
 
-    reader := csv.NewReader(file)
+    reader := csvfile.NewReader(file)
+    reader.Comment = '#'
     records, err := reader.ReadAll()
     if err != nil {
         return fmt.Errorf("failed to read mapping file: %v", err)
     }
 
+    if len(records) == 0 {
+        return nil
+    }
+
+    // Optional columns, found by their header, set the visibility and the
+    // linked repository of a package in the target
+    visibilityColumn, repositoryColumn := -1, -1
+    for i, name := range records[0] {
+        switch strings.ToLower(strings.TrimSpace(name)) {
+        case "visibility":
+            visibilityColumn = i
+        case "repository":
+            repositoryColumn = i
+        }
+    }
+    column := func(record []string, i int) string {
+        if i < 0 || i >= len(record) {
+            return ""
+        }
+        return strings.TrimSpace(record[i])
+    }
+
     for _, record := range records[1:] { // Skip header row
         if len(record) >= 2 {
+            // Container rows may rename a single tag, e.g. tools/foo:prod -> platform/foo:stable
+            if strings.Contains(record[0], ":") {
+                s.tags[record[0]] = record[1]
+                continue
+            }
             s.mappings[record[0]] = record[1]
+
+            if visibility := strings.ToLower(column(record, visibilityColumn)); visibility != "" {
+                if visibility != "public" && visibility != "private" && visibility != "internal" {
+                    return fmt.Errorf("invalid visibility %q for %s in mapping file, expected public, private, or internal", visibility, record[0])
+                }
+                s.visibilities[record[0]] = visibility
+            }
+            if repository := column(record, repositoryColumn); repository != "" {
+                s.repositories[record[0]] = repository
+            }
         }
     }
 
     return nil
 }
 
+// getTargetVisibility returns the visibility the mapping file gives a source
+// package, or the one it has in the source
+func (s *PackageSync) getTargetVisibility(p api.Package) string {
+    if visibility, exists := s.visibilities[p.Name]; exists {
+        return visibility
+    }
+    return p.Visibility
+}
+
+// getTargetRepository returns the URL of the repository the mapping file
+// links a source package to, given as a URL, owner/name, or a name in
+// targetOrg, and false when it has none
+func (s *PackageSync) getTargetRepository(sourceName, targetOrg string) (string, bool) {
+    repository, exists := s.repositories[sourceName]
+    switch {
+    case !exists:
+        return "", false
+    case strings.Contains(repository, "://"):
+        return strings.TrimSuffix(repository, ".git"), true
+    case strings.Contains(repository, "/"):
+        return "https://github.com/" + strings.Trim(repository, "/"), true
+    }
+    return fmt.Sprintf("https://github.com/%s/%s", targetOrg, repository), true
+}
+
 func (s *PackageSync) getTargetPackageName(sourceName string) string {
     if targetName, exists := s.mappings[sourceName]; exists {
         return targetName
     }
+    // Maven coordinates contain ':' too, so their rows land with the tag mappings
+    if targetName, exists := s.tags[sourceName]; exists {
+        return targetName
+    }
     return sourceName
 }
 
+// getTargetVersion returns the package name and version a source version is
+// pushed as, honoring container name:tag mappings before plain name mappings
+func (s *PackageSync) getTargetVersion(sourceName, version string) (string, string) {
+    target, exists := s.tags[sourceName+":"+version]
+    if !exists {
+        return s.getTargetPackageName(sourceName), version
+    }
+
+    if i := strings.LastIndex(target, ":"); i >= 0 {
+        return target[:i], target[i+1:]
+    }
+    return target, version
+}
+
+// renameImageMetadata rewrites metadata values that mention the source image
+// so the pushed manifest annotations reference its new name
+func renameImageMetadata(metadata map[string]interface{}, from, fromTag, to, toTag string) map[string]interface{} {
+    if len(metadata) == 0 || (from == to && fromTag == toTag) {
+        return metadata
+    }
+
+    renamed := make(map[string]interface{}, len(metadata))
+    for k, v := range metadata {
+        if str, ok := v.(string); ok {
+            str = strings.ReplaceAll(str, from+":"+fromTag, to+":"+toTag)
+            v = strings.ReplaceAll(str, from, to)
+        }
+        renamed[k] = v
+    }
+    return renamed
+}
+
 func (s *PackageSync) processConcurrently(packages []pkg.Package) {
     const maxConcurrent = 5
     sem := make(chan bool, maxConcurrent)
@@ -82,8 +213,12 @@ func (s *PackageSync) processConcurrently(packages []pkg.Package) {
         WithTitle("Migrating packages").
         Start()
 
-    // Start validation reporter
-    go s.reportValidation(results)
+    // The reporter is the only goroutine touching the report table
+    reported := make(chan struct{})
+    go func() {
+        s.reportValidation(results)
+        close(reported)
+    }()
 
     for _, p := range packages {
         wg.Add(1)
@@ -101,11 +236,20 @@ func (s *PackageSync) processConcurrently(packages []pkg.Package) {
                 VersionsCount: len(pkg.Versions),
             }
 
+            // Nothing is left to migrate once every version is deleted
+            if pkg.IsEmpty() {
+                report.Status = "Empty"
+                results <- report
+                progressbar.Increment()
+                return
+            }
+
             // Validate package
             if err := pkg.ValidatePackage(&pkg); err != nil {
                 report.Status = "Failed"
                 report.ErrorMessage = err.Error()
                 results <- report
+                progressbar.Increment()
                 return
             }
 
@@ -179,12 +323,14 @@ func (s *PackageSync) processConcurrently(packages []pkg.Package) {
     wg.Wait()
     close(results)
     progressbar.Stop()
+    <-reported
 }
 
 func (s *PackageSync) reportValidation(results chan *ValidationReport) {
     successCount := 0
     failureCount := 0
     partialCount := 0
+    emptyCount := 0
     
     table := pterm.TableData{
         {"Package", "Type", "Status", "Versions", "Error"},
@@ -202,6 +348,9 @@ func (s *PackageSync) reportValidation(results chan *ValidationReport) {
         case "Partial Success":
             partialCount++
             status = pterm.Yellow(status)
+        case "Empty":
+            emptyCount++
+            status = pterm.Gray(status)
         }
 
         table = append(table, []string{
@@ -219,10 +368,20 @@ func (s *PackageSync) reportValidation(results chan *ValidationReport) {
     pterm.Info.Printf("- Successful: %d\n", successCount)
     pterm.Info.Printf("- Partial Success: %d\n", partialCount)
     pterm.Info.Printf("- Failed: %d\n", failureCount)
+    pterm.Info.Printf("- Empty (no versions): %d\n", emptyCount)
 }
 
-func SyncPackages() {
+func SyncPackages() error {
+    return syncPass(nil)
+}
+
+// syncPass migrates the source packages once. A pass of sync --watch only
+// migrates the versions published since its last complete pass, and is
+// told how the pass went
+func syncPass(watch *watchPass) error {
+    pterm.Info.Printf("Migration run %s\n", run.ID())
     spinner, _ := pterm.DefaultSpinner.Start("Initializing package synchronization...")
+    summary := newRunSummary()
 
     // Initialize sync client
     sync := NewPackageSync(
@@ -235,86 +394,1236 @@ func SyncPackages() {
     if mappingFile := viper.GetString("MAPPING_FILE"); mappingFile != "" {
         spinner.UpdateText("Loading package name mappings...")
         if err := sync.LoadMappings(mappingFile); err != nil {
-            spinner.Fail(fmt.Sprintf("Failed to load mappings: %v", err))
-            return
+            spinner.Stop()
+            return fmt.Errorf("failed to load mappings: %v", err)
         }
     }
 
+    // Link packages to the repositories they became in a repository migration
+    var repoLinks *RepositoryLinks
+    if archivePath := viper.GetString("MIGRATION_ARCHIVE"); archivePath != "" {
+        spinner.UpdateText("Reading repository migration archive...")
+        links, err := LoadMigrationArchive(archivePath)
+        if err != nil {
+            spinner.Stop()
+            return err
+        }
+        repoLinks = links
+    }
+    unlinked := make(map[string][]string)
+
+    // Container packages written to, checked for untagged leftovers at the end
+    containerTargets := make(map[string]bool)
+
+    // Register external handlers for custom package types
+    if err := extension.RegisterSpecs(viper.GetString("HANDLERS")); err != nil {
+        spinner.Stop()
+        return fmt.Errorf("failed to register package handlers: %v", err)
+    }
+
+    // Configure registries for package types not hosted by GitHub
+    sourceRegistries, err := api.ParseRegistries(viper.GetString("SOURCE_REGISTRY_URLS"))
+    if err != nil {
+        spinner.Stop()
+        return fmt.Errorf("invalid source registry url: %v", err)
+    }
+    sync.sourceAPI.SetRegistries(sourceRegistries)
+    sourceTokens, err := api.ParseRegistryTokens(viper.GetString("SOURCE_REGISTRY_TOKENS"))
+    if err != nil {
+        spinner.Stop()
+        return fmt.Errorf("invalid source registry token: %v", err)
+    }
+    sync.sourceAPI.SetRegistryTokens(sourceTokens)
+
+    targetRegistries, err := api.ParseRegistries(viper.GetString("TARGET_REGISTRY_URLS"))
+    if err != nil {
+        spinner.Stop()
+        return fmt.Errorf("invalid target registry url: %v", err)
+    }
+    sync.targetAPI.SetRegistries(targetRegistries)
+    targetTokens, err := api.ParseRegistryTokens(viper.GetString("TARGET_REGISTRY_TOKENS"))
+    if err != nil {
+        spinner.Stop()
+        return fmt.Errorf("invalid target registry token: %v", err)
+    }
+    sync.targetAPI.SetRegistryTokens(targetTokens)
+
+    // Extra tokens multiply the rate limits a very large organization gets
+    sync.sourceAPI.SetTokens(strings.Split(viper.GetString("SOURCE_TOKENS"), ","))
+    sync.targetAPI.SetTokens(strings.Split(viper.GetString("TARGET_TOKENS"), ","))
+
+    // Upload exactly what was downloaded
+    if viper.GetBool("NO_REWRITE") {
+        sync.targetAPI.SetNoRewrite()
+    }
+
+    // Metadata-heavy uploads cross slow links faster compressed
+    if viper.GetBool("COMPRESS_UPLOADS") {
+        sync.targetAPI.SetCompression()
+    }
+
+    // Self-hosted cargo registries often allow larger crates than crates.io
+    if s := viper.GetString("CARGO_MAX_CRATE_SIZE"); s != "" {
+        size, err := filter.ParseSize(s)
+        if err != nil {
+            spinner.Stop()
+            return fmt.Errorf("invalid --cargo-max-crate-size: %v", err)
+        }
+        sync.targetAPI.SetCargoMaxCrateSize(size)
+    }
+
+    // Checksum and signature files copied, regenerated, or left out
+    sidecars, err := api.ParseSidecars(viper.GetString("SIDECARS"))
+    if err != nil {
+        spinner.Stop()
+        return fmt.Errorf("invalid sidecar rule: %v", err)
+    }
+    sync.targetAPI.SetSidecars(sidecars)
+
+    // Register artifact transformation plugins
+    if plugins := viper.GetString("TRANSFORM_PLUGINS"); plugins != "" {
+        chain, err := transform.NewChain(strings.Split(plugins, ";"))
+        if err != nil {
+            spinner.Stop()
+            return fmt.Errorf("failed to load transform plugins: %v", err)
+        }
+        sync.targetAPI.SetTransformers(chain)
+    }
+
+    // Select which versions are migrated
+    versionFilter, err := filter.FromConfig(viper.GetString("PACKAGE_TYPE"))
+    if err != nil {
+        spinner.Stop()
+        return fmt.Errorf("invalid version filter: %v", err)
+    }
+
     sourceOrg := viper.GetString("SOURCE_ORGANIZATION")
     targetOrg := viper.GetString("TARGET_ORGANIZATION")
     packageType := viper.GetString("PACKAGE_TYPE")
     skipExisting := viper.GetBool("SKIP_EXISTING")
+    imageReport := run.ReportPath(viper.GetString("IMAGE_REPORT"))
+    digestMap := viper.GetString("DIGEST_MAP")
+    copyAttached := viper.GetBool("COPY_ATTACHED")
+    var attached attachedCopies
+    fileReport := run.ReportPath(viper.GetString("FILE_REPORT"))
+
+    // Consumers' clients resolve a sample of the migrated packages afterwards
+    var smokeSample *verify.Sample
+    if value := viper.GetString("SMOKE_TEST"); value != "" {
+        sample, err := verify.ParseSample(value)
+        if err != nil {
+            spinner.Stop()
+            return fmt.Errorf("invalid smoke test sample: %v", err)
+        }
+        smokeSample = &sample
+    }
+    smokeTargets := make(map[string]smoke.Target)
+
+    // Old versions go to cold storage instead of the target
+    var archive *Archive
+    if value := viper.GetString("ARCHIVE_OLDER_THAN"); value != "" {
+        age, err := filter.ParseAge(value)
+        if err != nil {
+            spinner.Stop()
+            return fmt.Errorf("invalid --archive-older-than: %v", err)
+        }
+        archive, err = OpenArchive(viper.GetString("ARCHIVE_PATH"), age)
+        if err != nil {
+            spinner.Stop()
+            return err
+        }
+        defer archive.Close()
+    }
+
+    // Critical versions fail the run when they don't reach the target
+    var mustMigrate MustMigrate
+    if path := viper.GetString("MUST_MIGRATE"); path != "" {
+        mustMigrate, err = LoadMustMigrate(path)
+        if err != nil {
+            spinner.Stop()
+            return err
+        }
+    }
+
+    var reviewQueue []filter.ReviewItem
+    var excludedFiles []filter.ExcludedFile
+    var duplicates []DuplicateVersion
+    var failures []PackageFailure
+    var fileOutcomeRows []FileOutcome
+
+    // Owners are told which of their packages moved where
+    notifyManifest := viper.GetString("NOTIFY_MANIFEST")
+    var notified []NotifiedPackage
+
+    // Digest pins need old and new image digests side by side
+    var digests []DigestMapping
+
+    // Migrated images may still name the source organization in labels and build steps
+    var imageRefs []api.ImageReference
+    sourcePrefixes := api.SourceReferencePrefixes(viper.GetString("SOURCE_HOSTNAME"), sourceOrg)
+
+    // Refuse anything that could write to the source organization
+    if viper.GetBool("ASSERT_READ_ONLY_SOURCE") {
+        if viper.GetBool("RESTORE_DELETED") {
+            spinner.Stop()
+            return fmt.Errorf("--restore-deleted writes to the source and can't be combined with --assert-read-only-source")
+        }
+        if err := assertReadOnlySource(sourceOrg, targetOrg); err != nil {
+            spinner.Stop()
+            return err
+        }
+        sync.sourceAPI.SetReadOnly()
+    }
+
+    // Work on the planned version list rather than whatever is listed now
+    var snap *snapshot.Snapshot
+    if path := viper.GetString("SNAPSHOT"); path != "" {
+        snap, err = snapshot.Load(path)
+        if err != nil {
+            spinner.Stop()
+            return err
+        }
+        if !snap.Covers(sourceOrg) {
+            spinner.Stop()
+            return fmt.Errorf("snapshot %s has no packages of %s", path, sourceOrg)
+        }
+    }
+
+    // Execute a reviewed plan rather than selecting versions again
+    var execution *planExecution
+    if path := viper.GetString("PLAN_FILE"); path != "" {
+        var key *provenance.PublicKey
+        if keyPath := viper.GetString("PLAN_PUBLIC_KEY"); keyPath != "" {
+            if key, err = provenance.LoadPublicKey(keyPath); err != nil {
+                spinner.Stop()
+                return err
+            }
+        }
+        spinner.UpdateText("Loading migration plan...")
+        if execution, err = sync.executePlan(path, key, sourceOrg, targetOrg, packageType); err != nil {
+            spinner.Stop()
+            return err
+        }
+        // The plan's versions passed the filters when it was made
+        if versionFilter, err = filter.New(packageType, filter.Options{}); err != nil {
+            spinner.Stop()
+            return fmt.Errorf("invalid version filter: %v", err)
+        }
+    }
+
+    // Stop cleanly once the transfer or API call budget is spent
+    budget, err := budgetFromConfig()
+    if err != nil {
+        spinner.Stop()
+        return err
+    }
+    sync.sourceAPI.SetBudget(budget)
+    sync.targetAPI.SetBudget(budget)
+
+    // Rehearsals inject simulated failures on the target side only
+    if value := viper.GetString("CHAOS"); value != "" {
+        rate, err := transport.ParseRate(value)
+        if err != nil {
+            spinner.Stop()
+            return fmt.Errorf("invalid chaos rate: %v", err)
+        }
+        sync.targetAPI.SetChaos(rate)
+        pterm.Warning.Printf("Simulating upload failures and rate limit pauses for %s of target requests\n", value)
+    }
+
+    // Versions a previous run finished are skipped
+    var state *checkpoint.Checkpoint
+    if path := checkpointPath(budget); path != "" {
+        state, err = checkpoint.Open(path)
+        if err != nil {
+            spinner.Stop()
+            return err
+        }
+        defer state.Close()
+        source := sourceOrg
+        if hostname := viper.GetString("SOURCE_HOSTNAME"); hostname != "" {
+            source = hostname + "/" + sourceOrg
+        }
+        if err := state.Claim(checkpoint.Scope{Source: source, Target: targetOrg}); err != nil {
+            spinner.Stop()
+            return err
+        }
+        if done, retry := state.Completed(), state.Failed(); done+retry > 0 {
+            pterm.Info.Printf("Resuming from %s, %d versions already migrated, %d failed versions to retry\n", path, done, retry)
+        }
+    }
+    var exhausted error
+
+    // Evidence that every migrated version was copied, not rebuilt
+    provenancePath := viper.GetString("PROVENANCE")
+    var provenanceLog *provenance.Log
+    if provenancePath != "" {
+        var signer *provenance.Signer
+        if key := viper.GetString("PROVENANCE_KEY"); key != "" {
+            signer, err = provenance.LoadSigner(key)
+            if err != nil {
+                spinner.Stop()
+                return err
+            }
+        }
+        provenanceLog, err = provenance.Open(provenancePath, signer)
+        if err != nil {
+            spinner.Stop()
+            return err
+        }
+        defer provenanceLog.Close()
+    }
+
+    // The same statements, signed in this workflow and stored as artifact
+    // attestations for the target organization's policies
+    var attester *attest.Attester
+    if repository := viper.GetString("ATTEST_REPOSITORY"); repository != "" {
+        spinner.UpdateText("Requesting a signing certificate for attestations...")
+        attester, err = attest.New(sync.targetAPI, targetOrg, repository)
+        if err != nil {
+            spinner.Stop()
+            return fmt.Errorf("failed to set up attestations: %v", err)
+        }
+    }
+    recordProvenance := provenanceLog != nil || attester != nil
+    attestFailed := 0
+
+    // Expose pause/resume/abort controls if a socket was requested, an
+    // interrupt stops the run like an abort
+    ctx := run.StopOnSignal()
+    controller := control.NewController()
+    if socket := viper.GetString("CONTROL_SOCKET"); socket != "" {
+        if err := controller.Serve(socket); err != nil {
+            spinner.Stop()
+            return fmt.Errorf("failed to start control socket: %v", err)
+        }
+        defer controller.Close()
+    }
+
+    // Tell migrated packages apart from those published to the target
+    var note string
+    notePlacement := viper.GetString("DESCRIBE_MIGRATION")
+    if notePlacement != "" {
+        note = api.MigrationNote(viper.GetString("SOURCE_HOSTNAME"), sourceOrg, time.Now())
+    }
+
+    // Nothing is written anywhere, only what would be is reported
+    dryRun := viper.GetBool("DRY_RUN")
+
+    // Bring back versions deleted shortly before the migration
+    if viper.GetBool("RESTORE_DELETED") && dryRun {
+        pterm.Warning.Println("Dry run: recently deleted versions are not restored, and are missing from the plan")
+    } else if viper.GetBool("RESTORE_DELETED") {
+        spinner.UpdateText("Restoring recently deleted source versions...")
+        restoreDeleted(sync.sourceAPI, sourceOrg, packageType)
+    }
 
     // Fetch source packages
     spinner.UpdateText("Fetching packages from source organization...")
     packages, err := sync.sourceAPI.GetOrganizationPackages(sourceOrg, packageType)
     if err != nil {
-        spinner.Fail(fmt.Sprintf("Failed to fetch source packages: %v", err))
-        return
+        spinner.Stop()
+        return fmt.Errorf("failed to fetch source packages: %v", err)
     }
 
     spinner.Success("Package list retrieved successfully")
 
-    // Process each package
-    progressbar, _ := pterm.DefaultProgressbar.WithTotal(len(packages)).WithTitle("Migrating packages").Start()
-    
-    for _, pkg := range packages {
-        progressbar.UpdateTitle(fmt.Sprintf("Processing %s", pkg.Name))
+    // The final check looks for versions published after this listing, or
+    // after the snapshot when there is one
+    finalCheck := viper.GetString("FINAL_CHECK")
+    baseline := snap
+    if baseline == nil && finalCheck != "" {
+        baseline = snapshot.New()
+        baseline.Add(sourceOrg, packages)
+    }
+    latePass := false
+
+    if snap != nil {
+        var late []snapshot.LateVersion
+        packages, late = snap.Freeze(sourceOrg, packages)
+        pterm.Info.Printf("Migrating the snapshot taken %s by run %s\n", snap.TakenAt.Format(time.RFC3339), snap.RunID)
+        reportLateVersions(late)
+    }
+    if execution != nil {
+        packages = execution.Narrow(packages)
+    }
+
+    if watch != nil {
+        packages = watch.newVersions(packages)
+    }
+
+    // Packages whose versions were all deleted have nothing to migrate
+    packages, empty := splitEmptyPackages(packages)
+
+    // Packages without a repository are reported whether migrated or not
+    excludeOrphaned := viper.GetBool("EXCLUDE_ORPHANED")
+    packages, orphaned := selectOrphaned(packages, excludeOrphaned, viper.GetBool("ONLY_ORPHANED"))
+
+    // Packages nobody pulls may not be worth migrating, and those pulled
+    // the most are wanted first
+    packages = skipRarelyDownloaded(packages, viper.GetInt("MIN_DOWNLOADS"))
+    orderPackages(packages, viper.GetString("ORDER"))
+
+    // The operator may cherry-pick from what is left
+    var picked map[string]bool
+    if viper.GetBool("INTERACTIVE") {
+        if packages, picked, err = pickPackages(packages); err != nil {
+            return err
+        }
+        if len(packages) == 0 {
+            pterm.Warning.Println("No packages picked, nothing to migrate")
+            return nil
+        }
+    }
+
+    var pinned []api.Package
+    var unmatchedPins []string
+    if mustMigrate != nil {
+        pinned, unmatchedPins = mustMigrate.Select(packages, packageType)
+        for _, entry := range unmatchedPins {
+            pterm.Warning.Printf("Must-migrate entry %s matches no version in %s\n", entry, sourceOrg)
+        }
+    }
+
+    // Keep migrated packages apart from those already in the target
+    prefixes := TargetPrefixes{
+        Name:          viper.GetString("TARGET_PREFIX"),
+        NpmScope:      viper.GetString("NPM_SCOPE_SUFFIX"),
+        MavenGroup:    viper.GetString("MAVEN_GROUP_PREFIX"),
+        ContainerPath: viper.GetString("CONTAINER_PATH_PREFIX"),
+    }
+    sync.ApplyTargetPrefixes(packages, prefixes)
 
-        // Validate package
-        if err := pkg.ValidatePackage(&pkg); err != nil {
-            log.Printf("Warning: Package %s validation failed: %v", pkg.Name, err)
-            continue
+    // Target registries restrict names more than the source may have
+    normalizations, err := sync.NormalizeTargetNames(packages, viper.GetBool("NORMALIZE_NAMES"))
+    if err != nil {
+        return err
+    }
+    if len(normalizations) > 0 {
+        report := run.ReportPath(viper.GetString("NORMALIZATION_REPORT"))
+        if err := writeNormalizationReport(report, normalizations); err != nil {
+            log.Printf("Error writing normalization report: %v", err)
+        } else {
+            pterm.Info.Printf("%d package names normalized, see %s\n", len(normalizations), report)
+            summary.file("Normalized names", report)
         }
+    }
 
-        // Check if package exists in target
-        targetName := sync.getTargetPackageName(pkg.Name)
-        exists, err := sync.targetAPI.PackageExists(targetOrg, targetName)
+    // Refuse to start if two sources would land on the same target
+    if err := reportConflicts(sync.FindConflicts(packages)); err != nil {
+        return err
+    }
+
+    // Renamed versions may already be in the target from an earlier attempt
+    inventory, err := sync.loadTargetInventory(targetOrg, packageType, packages)
+    if err != nil {
+        log.Printf("Error listing target packages, duplicate versions won't be detected: %v", err)
+    }
+
+    if dryRun {
+        target, err := sync.targetVersions(targetOrg, packageType)
         if err != nil {
-            log.Printf("Error checking package %s existence: %v", targetName, err)
-            continue
+            return err
+        }
+        plan := &dryRun{
+            sync:         sync,
+            sourceOrg:    sourceOrg,
+            targetOrg:    targetOrg,
+            skipExisting: skipExisting,
+            filter:       versionFilter,
+            state:        state,
+            archive:      archive,
+            inventory:    inventory,
+            target:       target,
         }
 
-        if exists && skipExisting {
-            log.Printf("Skipping existing package: %s", targetName)
-            progressbar.Increment()
-            continue
+        var planned []PlannedVersion
+        for _, pkg := range packages {
+            planned = append(planned, plan.plan(pkg)...)
+        }
+        reportEmptyPackages(empty)
+        reportOrphanedPackages(orphaned, excludeOrphaned)
+        reportDryRun(planned)
+        if report := run.ReportPath(viper.GetString("DRY_RUN_REPORT")); report != "" {
+            if err := writeDryRun(report, planned); err != nil {
+                log.Printf("Error writing dry run report: %v", err)
+            } else {
+                pterm.Info.Printf("Planned actions for %d versions written to %s\n", len(planned), report)
+            }
+        }
+        if viper.GetString("PLAN_OUT") != "" {
+            return writePlanFromConfig(sourceOrg, targetOrg, packageType, planned)
         }
+        pterm.Success.Println("Dry run complete, nothing was uploaded")
+        return nil
+    }
+    controller.SetTotal(len(packages))
 
-        // Migrate each version
-        for _, version := range pkg.Versions {
-            spinner.UpdateText(fmt.Sprintf("Migrating %s version %s", pkg.Name, version.Name))
+    // Report progress to an external migration dashboard, if one is set
+    counters := &progress.Counters{}
+    reporter := progress.NewReporter(viper.GetString("PROGRESS_URL"), viper.GetDuration("PROGRESS_INTERVAL"), viper.GetString("PROGRESS_SECRET"), func() progress.Event {
+        status := controller.Status()
+        transferred, calls := budget.Usage()
+        return progress.Event{
+            Command:            "sync",
+            SourceOrganization: sourceOrg,
+            TargetOrganization: targetOrg,
+            PackageType:        packageType,
+            State:              status.State,
+            Current:            status.Current,
+            PackagesTotal:      status.Total,
+            PackagesProcessed:  status.Processed,
+            VersionsMigrated:   counters.Migrated.Load(),
+            VersionsFailed:     counters.Failed.Load(),
+            BytesTransferred:   transferred,
+            APICalls:           calls,
+        }
+    })
+    outcome := progress.OutcomeStopped
+    reporter.Start()
+    defer func() { reporter.Finish(outcome) }()
 
-            // Download package files
-            files, err := sync.sourceAPI.DownloadPackageVersion(sourceOrg, pkg.Name, version.Name)
-            if err != nil {
-                log.Printf("Error downloading version %s of package %s: %v", version.Name, pkg.Name, err)
+    // Metadata calls are slow and flaky compared to uploads, so they are
+    // queued and applied after the transfers in their own phase with retries
+    metadataUpdates := newMetadataQueue()
+    applyQueuedMetadata := func() int {
+        if len(metadataUpdates.updates) == 0 {
+            return 0
+        }
+        updates := sync.applyMetadata(targetOrg, metadataUpdates, viper.GetInt("METADATA_WORKERS"), viper.GetInt("METADATA_RETRIES")+1)
+        failed := reportMetadata(updates)
+        if report := run.ReportPath(viper.GetString("METADATA_REPORT")); report != "" {
+            if err := writeMetadataReport(report, updates); err != nil {
+                log.Printf("Error writing metadata report: %v", err)
+            } else {
+                pterm.Info.Printf("Outcome of %d metadata updates written to %s\n", len(updates), report)
+                summary.file("Metadata updates", report)
+            }
+        }
+        return failed
+    }
+
+    // Process each package
+    progressbar, _ := pterm.DefaultProgressbar.WithTotal(len(packages)).WithTitle("Migrating packages").Start()
+    
+    // The final check may queue versions published while this run migrated
+    for pass := packages; len(pass) > 0; {
+        for _, pkg := range pass {
+            if exhausted != nil {
+                break
+            }
+
+            // Block here while paused, stop cleanly if aborted
+            if err := controller.Wait(ctx); err != nil {
+                progressbar.Stop()
+                // Versions already migrated still get their metadata
+                applyQueuedMetadata()
+                spinner.Warning(fmt.Sprintf("Package migration stopped: %v", err))
+                transferred, _ := budget.Usage()
+                summary.print(transferred, checkpointPath(budget), provenancePath, true)
+                return nil
+            }
+
+            controller.Track(pkg.Name)
+            progressbar.UpdateTitle(fmt.Sprintf("Processing %s", pkg.Name))
+
+            // Validate package
+            if err := pkg.ValidatePackage(&pkg); err != nil {
+                log.Printf("Warning: Package %s validation failed: %v", pkg.Name, err)
+                controller.Done()
+                progressbar.Increment()
                 continue
             }
 
-            // Upload to target
-            err = sync.targetAPI.UploadPackageVersion(targetOrg, targetName, version.Name, files)
+            // Check if package exists in target
+            targetName := sync.getTargetPackageName(pkg.Name)
+            exists, err := sync.targetAPI.PackageExists(targetOrg, targetName)
             if err != nil {
-                log.Printf("Error uploading version %s of package %s: %v", version.Name, targetName, err)
+                log.Printf("Error checking package %s existence: %v", targetName, err)
+                // None of its versions were tried, they all still need migrating
+                var notTried []VersionFailure
+                for _, version := range pkg.Versions {
+                    notTried = append(notTried, newVersionFailure(version.Name, "plan", err))
+                }
+                failures = append(failures, PackageFailure{
+                    Name:        pkg.Name,
+                    PackageType: pkg.PackageType,
+                    TargetName:  targetName,
+                    Versions:    notTried,
+                })
+                counters.Failed.Add(int64(len(notTried)))
+                summary.count(pkg.PackageType, OutcomeFailed, len(notTried), 0)
+                controller.Done()
+                progressbar.Increment()
                 continue
             }
 
-            // Copy package metadata
-            err = sync.targetAPI.UpdatePackageMetadata(targetOrg, targetName, version.Name, version.Metadata)
-            if err != nil {
-                log.Printf("Error updating metadata for %s version %s: %v", targetName, version.Name, err)
+            if exists && skipExisting && !latePass {
+                log.Printf("Skipping existing package: %s", targetName)
+                summary.count(pkg.PackageType, OutcomeSkipped, len(pkg.Versions), 0)
+                controller.Done()
+                progressbar.Increment()
+                continue
             }
-        }
 
-        // Update visibility and permissions
-        err = sync.targetAPI.UpdatePackageVisibility(targetOrg, targetName, pkg.Visibility)
-        if err != nil {
-            log.Printf("Error updating visibility for package %s: %v", targetName, err)
+            // Renamed tags may push into other container repositories
+            targetNames := map[string]bool{targetName: true}
+            migrated := 0
+            var failed []VersionFailure
+
+            // The repository the source one became, when the migration archive has it
+            // or the one the mapping file names
+            targetRepository, mapped := sync.getTargetRepository(pkg.Name, targetOrg)
+            if !mapped && repoLinks != nil && pkg.Repository != nil && pkg.Repository.URL != "" {
+                linked := false
+                if targetRepository, linked = repoLinks.Resolve(pkg.Repository, targetOrg); !linked {
+                    unlinked[pkg.Repository.URL] = append(unlinked[pkg.Repository.URL], pkg.Name)
+                }
+            }
+
+            // Migrate each version
+            for _, version := range pkg.Versions {
+                if err := controller.Wait(ctx); err != nil {
+                    log.Printf("Stopping migration of %s before version %s: %v", pkg.Name, version.Name, err)
+                    break
+                }
+
+                if exhausted = budget.Exhausted(); exhausted != nil {
+                    log.Printf("Stopping migration of %s before version %s: %v", pkg.Name, version.Name, exhausted)
+                    break
+                }
+
+                if state != nil && state.Done(pkg.PackageType, pkg.Name, version.ID) {
+                    continue
+                }
+
+                // A planned version is only migrated while it is what was reviewed
+                if execution != nil {
+                    if version, err = execution.Check(sync, pkg, version); err != nil {
+                        log.Printf("Not migrating %s version %s as planned: %v", pkg.Name, version.Name, err)
+                        failed = append(failed, newVersionFailure(version.Name, "plan", err))
+                        counters.Failed.Add(1)
+                        summary.count(pkg.PackageType, OutcomeFailed, 1, 0)
+                        markFailed(state, pkg, version, err)
+                        continue
+                    }
+                }
+
+                allowed, err := versionFilter.Allows(pkg.PackageType, version.Name)
+                if err != nil {
+                    log.Printf("Error filtering %s version %s: %v", pkg.Name, version.Name, err)
+                    continue
+                }
+                if !allowed {
+                    continue
+                }
+
+                // Artifact classes the target doesn't need are never transferred
+                kept, excluded := excludeFiles(versionFilter, pkg, version)
+                if len(excluded) > 0 {
+                    version.Files = kept
+                    excludedFiles = append(excludedFiles, excluded...)
+                }
+
+                size := versionSize(version)
+                if !versionFilter.AllowsSize(size) {
+                    continue
+                }
+
+                // Very large versions wait for an explicit approval
+                if versionFilter.NeedsReview(pkg.Name, version.Name, size) {
+                    reviewQueue = append(reviewQueue, filter.ReviewItem{
+                        PackageName: pkg.Name,
+                        PackageType: pkg.PackageType,
+                        Version:     version.Name,
+                        Size:        size,
+                    })
+                    summary.count(pkg.PackageType, OutcomeReview, 1, 0)
+                    continue
+                }
+
+                if archive != nil && archive.Covers(version) {
+                    spinner.UpdateText(fmt.Sprintf("Archiving %s version %s", pkg.Name, version.Name))
+                    entry, err := archive.Store(sync.sourceAPI, sourceOrg, pkg, version)
+                    if err != nil {
+                        log.Printf("Error archiving version %s of package %s: %v", version.Name, pkg.Name, err)
+                        failed = append(failed, newVersionFailure(version.Name, "archive", err))
+                        counters.Failed.Add(1)
+                        summary.count(pkg.PackageType, OutcomeFailed, 1, 0)
+                        markFailed(state, pkg, version, err)
+                        continue
+                    }
+                    summary.count(pkg.PackageType, OutcomeArchived, 1, 0)
+                    if state != nil {
+                        err := state.MarkDone(checkpoint.Entry{
+                            PackageType: pkg.PackageType,
+                            PackageName: pkg.Name,
+                            VersionID:   version.ID,
+                            Version:     version.Name,
+                            Target:      "archive:" + entry.Path,
+                            Files:       len(entry.Files),
+                            Size:        entry.Size,
+                            CompletedAt: time.Now().UTC(),
+                        })
+                        if err != nil {
+                            log.Printf("Error checkpointing %s version %s: %v", pkg.Name, version.Name, err)
+                        }
+                    }
+                    continue
+                }
+
+                // Content already migrated under the new name counts as done
+                dupTarget, dupVersion := sync.getTargetVersion(pkg.Name, version.Name)
+                if existing, ok := sync.findDuplicate(inventory, sourceOrg, targetOrg, pkg, version, dupTarget, dupVersion); ok {
+                    duplicates = append(duplicates, DuplicateVersion{
+                        PackageType: pkg.PackageType,
+                        SourceName:  pkg.Name,
+                        Version:     version.Name,
+                        TargetName:  dupTarget,
+                        Existing:    existing,
+                    })
+                    targetNames[dupTarget] = true
+                    migrated++
+                    counters.Migrated.Add(1)
+                    summary.count(pkg.PackageType, OutcomeDuplicate, 1, 0)
+                    if state != nil {
+                        err := state.MarkDone(checkpoint.Entry{
+                            PackageType: pkg.PackageType,
+                            PackageName: pkg.Name,
+                            VersionID:   version.ID,
+                            Version:     version.Name,
+                            Target:      dupTarget + ":" + existing,
+                            Files:       len(version.Files),
+                            Size:        size,
+                            CompletedAt: time.Now().UTC(),
+                        })
+                        if err != nil {
+                            log.Printf("Error checkpointing %s version %s: %v", pkg.Name, version.Name, err)
+                        }
+                    }
+                    continue
+                }
+
+                spinner.UpdateText(fmt.Sprintf("Migrating %s version %s", pkg.Name, version.Name))
+
+                // Download package files into a scratch directory
+                versionDir, err := run.TempDir("stage")
+                if err != nil {
+                    log.Printf("Error creating staging directory for %s version %s: %v", pkg.Name, version.Name, err)
+                    continue
+                }
+
+                files, err := sync.sourceAPI.DownloadPackageVersion(sourceOrg, pkg, version, versionDir)
+                if err != nil {
+                    log.Printf("Error downloading version %s of package %s: %v", version.Name, pkg.Name, err)
+                    failed = append(failed, newVersionFailure(version.Name, "download", err))
+                    counters.Failed.Add(1)
+                    summary.count(pkg.PackageType, OutcomeFailed, 1, 0)
+                    markFailed(state, pkg, version, err)
+                    run.RemoveTempDir(versionDir)
+                    continue
+                }
+
+                files, excluded = excludeDownloaded(versionFilter, pkg, version, versionDir, files)
+                excludedFiles = append(excludedFiles, excluded...)
+
+                versionTarget, versionName := sync.getTargetVersion(pkg.Name, version.Name)
+                targetNames[versionTarget] = true
+
+                // Source files are hashed before transforms can rewrite them
+                started := time.Now().UTC()
+                var sources, targets []provenance.ResourceDescriptor
+                var uploaded *[]string
+                if recordProvenance && pkg.PackageType != "container" {
+                    if sources, err = fileDescriptors(files, sourceURLs(version)); err != nil {
+                        log.Printf("Error hashing %s version %s for provenance: %v", pkg.Name, version.Name, err)
+                    }
+                }
+                var results *api.FileResults
+                if fileReport != "" {
+                    results = &api.FileResults{}
+                }
+                if results != nil || (recordProvenance && pkg.PackageType != "container") {
+                    uploaded = new([]string)
+                }
+
+                var metadata map[string]interface{}
+                if pkg.PackageType == "container" {
+                    metadata = renameImageMetadata(version.Metadata,
+                        sourceOrg+"/"+pkg.Name, version.Name, targetOrg+"/"+versionTarget, versionName)
+                }
+
+                // Upload to target
+                err = sync.targetAPI.UploadPackageVersion(api.UploadOptions{
+                    Organization: targetOrg,
+                    PackageName:  versionTarget,
+                    Version:      versionName,
+                    PackageType:  pkg.PackageType,
+                    Metadata:     metadata,
+                    Files:        files,
+                    Repository:   targetRepository,
+                    Note:          note,
+                    NotePlacement: notePlacement,
+                    Uploaded:     uploaded,
+                    Results:      results,
+                    Staging:      versionDir,
+                })
+                if results != nil {
+                    // Named as sent, transforms may have replaced the downloaded files
+                    sent := files
+                    if uploaded != nil && len(*uploaded) > 0 {
+                        sent = *uploaded
+                    }
+                    fileOutcomeRows = append(fileOutcomeRows, fileOutcomes(pkg, version.Name, versionTarget, versionName, sent, results, started, err)...)
+                }
+                if err == nil && uploaded != nil && recordProvenance && pkg.PackageType != "container" {
+                    // Hashed before the staging directory goes away
+                    var hashErr error
+                    if targets, hashErr = fileDescriptors(*uploaded, nil); hashErr != nil {
+                        log.Printf("Error hashing uploaded %s version %s for provenance: %v", versionTarget, versionName, hashErr)
+                    }
+                }
+                run.RemoveTempDir(versionDir)
+                if err != nil {
+                    log.Printf("Error uploading version %s of package %s: %v", versionName, versionTarget, err)
+                    failed = append(failed, newVersionFailure(version.Name, "upload", err))
+                    counters.Failed.Add(1)
+                    summary.count(pkg.PackageType, OutcomeFailed, 1, 0)
+                    markFailed(state, pkg, version, err)
+                    continue
+                }
+
+                migrated++
+                counters.Migrated.Add(1)
+                summary.count(pkg.PackageType, OutcomeMigrated, 1, size)
+
+                // One version per package, the newest as versions are listed
+                if key := pkg.PackageType + "/" + versionTarget; smokeSample != nil && smokeTargets[key].Name == "" {
+                    smokeTargets[key] = smoke.Target{
+                        PackageType:  pkg.PackageType,
+                        Organization: targetOrg,
+                        Name:         versionTarget,
+                        Version:      versionName,
+                    }
+                }
+
+                var mapping *DigestMapping
+                if pkg.PackageType == "container" && (digestMap != "" || recordProvenance || copyAttached) {
+                    mapping, err = sync.mapDigest(sourceOrg, pkg.Name, version.Name, targetOrg, versionTarget, versionName)
+                    if err != nil {
+                        log.Printf("Error resolving digests for %s:%s: %v", pkg.Name, version.Name, err)
+                    } else if digestMap != "" {
+                        digests = append(digests, *mapping)
+                    }
+                    if mapping != nil && copyAttached {
+                        sync.copyAttached(mapping, sourceOrg, pkg.Name, targetOrg, versionTarget, &attached)
+                    }
+                }
+
+                if imageReport != "" && pkg.PackageType == "container" {
+                    refs, err := sync.targetAPI.FindSourceReferences(targetOrg, versionTarget, versionName, sourcePrefixes)
+                    if err != nil {
+                        log.Printf("Error inspecting image %s:%s for source references: %v", versionTarget, versionName, err)
+                    }
+                    imageRefs = append(imageRefs, refs...)
+                }
+
+                // Copy package metadata once every artifact is across
+                metadataUpdates.add(MetadataUpdate{
+                    Kind:        MetadataVersion,
+                    PackageType: pkg.PackageType,
+                    PackageName: versionTarget,
+                    Version:     versionName,
+                    Metadata:    version.Metadata,
+                })
+
+                if recordProvenance {
+                    if mapping != nil {
+                        sources = []provenance.ResourceDescriptor{imageDescriptor(mapping.SourceImage, mapping.SourceTag, mapping.SourceDigest)}
+                        targets = []provenance.ResourceDescriptor{imageDescriptor(mapping.TargetImage, mapping.TargetTag, mapping.TargetDigest)}
+                    }
+                    if len(targets) == 0 {
+                        log.Printf("No provenance recorded for %s version %s, its target digests are unknown", versionTarget, versionName)
+                    } else {
+                        transfer := provenance.Transfer{
+                            PackageType:        pkg.PackageType,
+                            SourceOrganization: sourceOrg,
+                            SourceName:         pkg.Name,
+                            SourceVersion:      version.Name,
+                            TargetOrganization: targetOrg,
+                            TargetName:         versionTarget,
+                            TargetVersion:      versionName,
+                            Sources:            sources,
+                            Targets:            targets,
+                            StartedOn:          started,
+                            FinishedOn:         time.Now().UTC(),
+                        }
+                        if provenanceLog != nil {
+                            if err := provenanceLog.Record(transfer); err != nil {
+                                log.Printf("Error recording provenance of %s version %s: %v", versionTarget, versionName, err)
+                            }
+                        }
+                        if attester != nil {
+                            // The artifacts are migrated either way, only the attestation is missing
+                            if id, err := attester.Attest(provenance.NewStatement(transfer)); err != nil {
+                                log.Printf("Error attesting %s version %s: %v", versionTarget, versionName, err)
+                                attestFailed++
+                            } else {
+                                log.Printf("Attested %s version %s as attestation %d", versionTarget, versionName, id)
+                            }
+                        }
+                    }
+                }
+
+                if state != nil {
+                    err = state.MarkDone(checkpoint.Entry{
+                        PackageType: pkg.PackageType,
+                        PackageName: pkg.Name,
+                        VersionID:   version.ID,
+                        Version:     version.Name,
+                        Target:      versionTarget + ":" + versionName,
+                        Files:       len(files),
+                        Size:        size,
+                        CompletedAt: time.Now().UTC(),
+                    })
+                    if err != nil {
+                        log.Printf("Error checkpointing %s version %s: %v", pkg.Name, version.Name, err)
+                    }
+                }
+            }
+
+            // Update visibility and permissions after the transfer phase
+            for name := range targetNames {
+                metadataUpdates.add(MetadataUpdate{
+                    Kind:        MetadataVisibility,
+                    PackageType: pkg.PackageType,
+                    PackageName: name,
+                    Visibility:  sync.getTargetVisibility(pkg),
+                })
+                if pkg.PackageType == "container" {
+                    containerTargets[name] = true
+                }
+            }
+
+            if len(failed) > 0 {
+                failures = append(failures, PackageFailure{
+                    Name:        pkg.Name,
+                    PackageType: pkg.PackageType,
+                    TargetName:  targetName,
+                    Versions:    failed,
+                })
+            }
+
+            if migrated > 0 && notifyManifest != "" {
+                repository := ""
+                if pkg.Repository != nil {
+                    repository = pkg.Repository.URL
+                }
+                notified = append(notified, NotifiedPackage{
+                    Name:        pkg.Name,
+                    TargetName:  targetName,
+                    PackageType: pkg.PackageType,
+                    Versions:    migrated,
+                    Repository:  repository,
+                })
+            }
+
+            controller.Done()
+            progressbar.Increment()
         }
 
-        progressbar.Increment()
+        pass = nil
+        if finalCheck != "" && exhausted == nil {
+            progressbar.Stop()
+            pass = sync.finalCheck(baseline, sourceOrg, packageType, finalCheck == FinalCheckMigrate)
+            finalCheck = ""
+            if len(pass) == 0 {
+                break
+            }
+
+            if picked != nil {
+                if pass = keepPicked(pass, picked); len(pass) == 0 {
+                    break
+                }
+            }
+
+            // Late versions of packages this run created must not be skipped
+            latePass = true
+            sync.ApplyTargetPrefixes(pass, prefixes)
+            controller.SetTotal(len(packages) + len(pass))
+            progressbar, _ = pterm.DefaultProgressbar.WithTotal(len(pass)).WithTitle("Migrating late versions").Start()
+        }
     }
 
     progressbar.Stop()
+
+    metadataFailed := applyQueuedMetadata()
+
+    // External gem registries may only serve new gems once reindexed
+    if err := sync.targetAPI.ReindexGems(viper.GetString("GEM_REINDEX")); err != nil {
+        pterm.Warning.Printf("Migrated gems may not resolve until the target is reindexed: %v\n", err)
+    }
+
+    reportEmptyPackages(empty)
+    reportOrphanedPackages(orphaned, excludeOrphaned)
+    if injected, pauses := sync.targetAPI.ChaosInjected(); injected+pauses > 0 {
+        pterm.Info.Printf("Chaos: %d simulated upload failures and %d simulated rate limit pauses\n", injected, pauses)
+    }
+    if sent, saved := sync.targetAPI.CompressionSaved(); saved > 0 {
+        pterm.Info.Printf("Compressed request bodies: %s sent, %s saved\n", filter.FormatSize(sent), filter.FormatSize(saved))
+    }
+    reportTokens("Source", sync.sourceAPI)
+    reportTokens("Target", sync.targetAPI)
+    reportUnlinked(unlinked)
+    sync.reportDangling(targetOrg, containerTargets, viper.GetBool("CLEANUP_DANGLING"))
+
+    if len(failures) > 0 {
+        reportFailureClasses(failures)
+    }
+
+    if exhausted != nil {
+        transferred, calls := budget.Usage()
+        pterm.Warning.Printf("Stopped early, %v (%s transferred, %d API calls). Run sync again to continue from %s\n",
+            exhausted, filter.FormatSize(transferred), calls, checkpointPath(budget))
+    }
+
+    if repo := viper.GetString("OPEN_ISSUES"); repo != "" && len(failures) > 0 {
+        sync.openFailureIssues(repo, sourceOrg, targetOrg, failures)
+    }
+
+    if notifyManifest != "" && len(notified) > 0 {
+        manifest := sync.buildNotifications(sourceOrg, targetOrg, notified)
+        if err := writeNotificationManifest(notifyManifest, manifest); err != nil {
+            log.Printf("Error writing notification manifest: %v", err)
+        } else {
+            pterm.Info.Printf("Notifications for %d owners written to %s\n", len(manifest.Teams), notifyManifest)
+            summary.file("Owner notifications", notifyManifest)
+        }
+    }
+
+    if len(duplicates) > 0 {
+        report := run.ReportPath(viper.GetString("DUPLICATES_REPORT"))
+        if err := writeDuplicatesReport(report, duplicates); err != nil {
+            log.Printf("Error writing duplicates report: %v", err)
+        } else {
+            pterm.Info.Printf("%d versions were already in the target under their new names and were marked complete, see %s\n", len(duplicates), report)
+            summary.file("Duplicate versions", report)
+        }
+    }
+
+    if len(excludedFiles) > 0 {
+        report := run.ReportPath(viper.GetString("EXCLUDED_FILES_REPORT"))
+        if err := filter.WriteExcludedFiles(report, excludedFiles); err != nil {
+            log.Printf("Error writing excluded files report: %v", err)
+        } else {
+            pterm.Info.Printf("%d files left out by --file-filter, see %s\n", len(excludedFiles), report)
+            summary.file("Excluded files", report)
+        }
+    }
+
+    if len(reviewQueue) > 0 {
+        reviewFile := run.ReportPath(viper.GetString("REVIEW_FILE"))
+        if err := filter.WriteReviewQueue(reviewFile, reviewQueue); err != nil {
+            log.Printf("Error writing review queue: %v", err)
+        } else {
+            pterm.Warning.Printf("%d versions above the review threshold were not migrated, see %s and rerun with --approvals-file\n", len(reviewQueue), reviewFile)
+            summary.file("Review queue", reviewFile)
+        }
+    }
+
+    if digestMap != "" && len(digests) > 0 {
+        if err := writeDigestMap(digestMap, digests); err != nil {
+            log.Printf("Error writing digest map: %v", err)
+        } else {
+            pterm.Info.Printf("Digest map for %d images written to %s\n", len(digests), digestMap)
+            summary.file("Digest map", digestMap)
+        }
+    }
+
+    attached.report()
+
+    if provenanceLog != nil && provenanceLog.Count() > 0 {
+        pterm.Info.Printf("Provenance for %d versions appended to %s\n", provenanceLog.Count(), provenancePath)
+        summary.file("Provenance", provenancePath)
+    }
+    if attester != nil {
+        if attester.Count() > 0 {
+            pterm.Info.Printf("%d versions attested in %s/%s\n", attester.Count(), targetOrg, attester.Repository())
+        }
+        if attestFailed > 0 {
+            pterm.Warning.Printf("%d migrated versions could not be attested, see the log\n", attestFailed)
+        }
+    }
+
+    if fileReport != "" && len(fileOutcomeRows) > 0 {
+        if err := writeFileReport(fileReport, fileOutcomeRows); err != nil {
+            log.Printf("Error writing file report: %v", err)
+        } else {
+            summary.file("File outcomes", fileReport)
+            if failedFiles := countFailedFiles(fileOutcomeRows); failedFiles > 0 {
+                pterm.Warning.Printf("%d of %d files were not uploaded, see %s\n", failedFiles, len(fileOutcomeRows), fileReport)
+            } else {
+                pterm.Info.Printf("Upload results of %d files written to %s\n", len(fileOutcomeRows), fileReport)
+            }
+        }
+    }
+
+    if archive != nil {
+        if count, size := archive.Count(); count > 0 {
+            pterm.Info.Printf("%d versions created more than %s ago (%s) archived to %s, listed in %s\n",
+                count, archive.age, filter.FormatSize(size), archive.dir, ArchiveManifestName)
+            summary.file("Archive", archive.dir)
+        }
+    }
+
+    if smokeSample != nil && len(smokeTargets) > 0 {
+        summary.file("Smoke tests", sync.runSmokeTests(smokeTargets, *smokeSample, run.ReportPath(viper.GetString("SMOKE_REPORT"))))
+    }
+
+    if imageReport != "" {
+        if err := writeImageReport(imageReport, imageRefs); err != nil {
+            log.Printf("Error writing image reference report: %v", err)
+        } else if len(imageRefs) > 0 {
+            pterm.Warning.Printf("%d image references to the source organization written to %s\n", len(imageRefs), imageReport)
+            summary.file("Source image references", imageReport)
+        }
+    }
+
+    transferred, _ := budget.Usage()
+    summary.print(transferred, checkpointPath(budget), provenancePath, exhausted != nil)
+
+    if exhausted == nil {
+        outcome = progress.OutcomeCompleted
+    }
+    if watch != nil {
+        watch.finished = exhausted == nil && ctx.Err() == nil && len(reviewQueue) == 0
+        watch.migrated = int(counters.Migrated.Load())
+        watch.failed = int(counters.Failed.Load())
+    }
+    if mustMigrate != nil {
+        if err := sync.checkMustMigrate(pinned, unmatchedPins, failures, targetOrg, packageType); err != nil {
+            outcome = progress.OutcomeIncomplete
+            spinner.Fail("Package migration incomplete")
+            return err
+        }
+    }
+
+    if metadataFailed > 0 {
+        spinner.Warning(fmt.Sprintf("Package migration completed, %d metadata updates failed", metadataFailed))
+        return nil
+    }
     spinner.Success("Package migration completed")
+    return nil
+}
+
+func writeImageReport(filename string, refs []api.ImageReference) error {
+    file, err := os.Create(filename)
+    if err != nil {
+        return fmt.Errorf("failed to create image report: %v", err)
+    }
+    defer file.Close()
+
+    writer := csvfile.NewWriter(file)
+    defer writer.Flush()
+
+    header := []string{"Package", "Version", "Digest", "Location", "Key", "Value"}
+    if err := writer.Write(header); err != nil {
+        return err
+    }
+
+    for _, ref := range refs {
+        row := []string{ref.PackageName, ref.Version, ref.Digest, ref.Location, ref.Key, ref.Value}
+        if err := writer.Write(row); err != nil {
+            return err
+        }
+    }
+
+    return nil
+}
+
+// markFailed records a failed attempt at a version in the checkpoint, so a
+// resumed run knows to retry it
+func markFailed(state *checkpoint.Checkpoint, pkg api.Package, version api.Version, cause error) {
+    if state == nil {
+        return
+    }
+    err := state.MarkFailed(checkpoint.Entry{
+        PackageType: pkg.PackageType,
+        PackageName: pkg.Name,
+        VersionID:   version.ID,
+        Version:     version.Name,
+        Files:       len(version.Files),
+        Size:        versionSize(version),
+    }, cause)
+    if err != nil {
+        log.Printf("Error checkpointing %s version %s: %v", pkg.Name, version.Name, err)
+    }
+}
+
+// reportTokens summarizes a token pool, when the side has one
+func reportTokens(side string, client *api.API) {
+    tokens, exhausted, invalid := client.TokenCounts()
+    if tokens < 2 {
+        return
+    }
+    pterm.Info.Printf("%s tokens: %d in rotation, %d waiting for a rate limit reset, %d removed as invalid\n", side, tokens-invalid, exhausted, invalid)
+}
+
+func versionSize(version api.Version) int64 {
+    var size int64
+    for _, file := range version.Files {
+        size += int64(file.Size)
+    }
+    return size
+}
+
+func (s *PackageSync) mapDigest(sourceOrg, sourceName, sourceTag, targetOrg, targetName, targetTag string) (*DigestMapping, error) {
+    sourceDigest, err := s.sourceAPI.GetImageDigest(sourceOrg, sourceName, sourceTag)
+    if err != nil {
+        return nil, fmt.Errorf("failed to resolve source digest: %v", err)
+    }
+
+    targetDigest, err := s.targetAPI.GetImageDigest(targetOrg, targetName, targetTag)
+    if err != nil {
+        return nil, fmt.Errorf("failed to resolve target digest: %v", err)
+    }
+
+    return &DigestMapping{
+        SourceImage:  fmt.Sprintf("%s/%s/%s", s.sourceAPI.ContainerRegistry(), sourceOrg, sourceName),
+        SourceTag:    sourceTag,
+        SourceDigest: sourceDigest,
+        TargetImage:  fmt.Sprintf("%s/%s/%s", s.targetAPI.ContainerRegistry(), targetOrg, targetName),
+        TargetTag:    targetTag,
+        TargetDigest: targetDigest,
+    }, nil
+}
+
+func writeDigestMap(filename string, digests []DigestMapping) error {
+    file, err := os.Create(filename)
+    if err != nil {
+        return fmt.Errorf("failed to create digest map: %v", err)
+    }
+    defer file.Close()
+
+    writer := csvfile.NewWriter(file)
+    defer writer.Flush()
+
+    header := []string{"Source", "Target", "Source Tag", "Target Tag"}
+    if err := writer.Write(header); err != nil {
+        return err
+    }
+
+    for _, d := range digests {
+        row := []string{
+            d.SourceImage + "@" + d.SourceDigest,
+            d.TargetImage + "@" + d.TargetDigest,
+            d.SourceTag,
+            d.TargetTag,
+        }
+        if err := writer.Write(row); err != nil {
+            return err
+        }
+    }
+
+    return nil
 }
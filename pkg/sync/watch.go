@@ -0,0 +1,176 @@
+package sync
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+    "os"
+    "path/filepath"
+    "time"
+
+    "github.com/cvega/gh-migrate-packages/pkg/api"
+    "github.com/cvega/gh-migrate-packages/pkg/run"
+    "github.com/pterm/pterm"
+    "github.com/spf13/viper"
+)
+
+// watchOverlap is how far before the last complete pass a watch pass
+// looks, for versions the source listed late. Those already migrated are
+// skipped by the state file
+const watchOverlap = 10 * time.Minute
+
+// WatchState is what sync --watch keeps between passes, so a restarted
+// watch continues from its last complete pass
+type WatchState struct {
+    SourceOrganization string    `json:"source_organization"`
+    TargetOrganization string    `json:"target_organization"`
+    PackageType        string    `json:"package_type,omitempty"`
+    Since              time.Time `json:"since,omitempty"` // start of the last pass that migrated everything it found
+    Passes             int       `json:"passes"`
+    UpdatedAt          time.Time `json:"updated_at"`
+}
+
+// LoadWatchState reads the state at path, which must be for the same
+// organizations and type, or starts a new one when there is none
+func LoadWatchState(path, sourceOrg, targetOrg, packageType string) (*WatchState, error) {
+    data, err := os.ReadFile(path)
+    if errors.Is(err, os.ErrNotExist) {
+        return &WatchState{SourceOrganization: sourceOrg, TargetOrganization: targetOrg, PackageType: packageType}, nil
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to read watch state: %v", err)
+    }
+
+    var state WatchState
+    if err := json.Unmarshal(data, &state); err != nil {
+        return nil, fmt.Errorf("failed to parse watch state %s: %v", path, err)
+    }
+    if state.SourceOrganization != sourceOrg || state.TargetOrganization != targetOrg || state.PackageType != packageType {
+        return nil, fmt.Errorf("watch state %s is for %s to %s (type %q), not %s to %s (type %q)", path,
+            state.SourceOrganization, state.TargetOrganization, state.PackageType, sourceOrg, targetOrg, packageType)
+    }
+    return &state, nil
+}
+
+// Save writes the state to path, replacing the previous one only once it
+// is complete
+func (s *WatchState) Save(path string) error {
+    s.UpdatedAt = time.Now().UTC()
+    data, err := json.MarshalIndent(s, "", "  ")
+    if err != nil {
+        return fmt.Errorf("failed to encode watch state: %v", err)
+    }
+
+    tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+    if err != nil {
+        return fmt.Errorf("failed to write watch state: %v", err)
+    }
+    if _, err := tmp.Write(append(data, '\n')); err != nil {
+        tmp.Close()
+        os.Remove(tmp.Name())
+        return fmt.Errorf("failed to write watch state: %v", err)
+    }
+    if err := tmp.Close(); err != nil {
+        os.Remove(tmp.Name())
+        return fmt.Errorf("failed to write watch state: %v", err)
+    }
+    if err := os.Rename(tmp.Name(), path); err != nil {
+        return fmt.Errorf("failed to write watch state: %v", err)
+    }
+    return nil
+}
+
+// watchPass is one pass of sync --watch: what it looks at, and how it went
+type watchPass struct {
+    since    time.Time // zero on the first pass, which looks at everything
+    finished bool      // every version found was tried, none held for review
+    migrated int
+    failed   int
+}
+
+// newVersions keeps the versions published since the pass's start time,
+// and the packages that have any. Versions without a readable creation
+// time are kept
+func (w *watchPass) newVersions(packages []api.Package) []api.Package {
+    if w.since.IsZero() {
+        return packages
+    }
+
+    var kept []api.Package
+    for _, p := range packages {
+        var versions []api.Version
+        for _, v := range p.Versions {
+            created, err := time.Parse(time.RFC3339, v.CreatedAt)
+            if err != nil || !created.Before(w.since) {
+                versions = append(versions, v)
+            }
+        }
+        if len(versions) > 0 {
+            p.Versions = versions
+            kept = append(kept, p)
+        }
+    }
+    return kept
+}
+
+// WatchPackages keeps the target current: it migrates the source, waits
+// WATCH_INTERVAL, and migrates again what was published since the last
+// pass that had no failures, until interrupted
+func WatchPackages() error {
+    sourceOrg := viper.GetString("SOURCE_ORGANIZATION")
+    targetOrg := viper.GetString("TARGET_ORGANIZATION")
+    packageType := viper.GetString("PACKAGE_TYPE")
+    interval := viper.GetDuration("WATCH_INTERVAL")
+    path := viper.GetString("WATCH_STATE")
+
+    // Failed versions are retried, and overlapping passes skip what is done
+    if viper.GetString("RESUME") == "" && viper.GetString("CHECKPOINT") == "" {
+        viper.Set("CHECKPOINT", defaultCheckpoint)
+    }
+
+    state, err := LoadWatchState(path, sourceOrg, targetOrg, packageType)
+    if err != nil {
+        return err
+    }
+
+    ctx := run.StopOnSignal()
+    for {
+        started := time.Now().UTC()
+        pass := &watchPass{}
+        if state.Since.IsZero() {
+            pterm.DefaultSection.Printf("Watch pass %d: every version", state.Passes+1)
+        } else {
+            pass.since = state.Since.Add(-watchOverlap)
+            pterm.DefaultSection.Printf("Watch pass %d: versions published since %s", state.Passes+1, state.Since.Format(time.RFC3339))
+        }
+
+        if err := syncPass(pass); err != nil {
+            pterm.Error.Printf("Watch pass %d: %v\n", state.Passes+1, err)
+        }
+        state.Passes++
+        switch {
+        case pass.finished && pass.failed == 0:
+            state.Since = started
+            pterm.Success.Printf("Watch pass %d migrated %d versions, the target is current as of %s\n", state.Passes, pass.migrated, started.Format(time.RFC3339))
+        case pass.failed > 0:
+            pterm.Warning.Printf("Watch pass %d migrated %d versions, %d failed, the next pass retries them\n", state.Passes, pass.migrated, pass.failed)
+        default:
+            pterm.Warning.Printf("Watch pass %d migrated %d versions but didn't finish, the next pass looks at the same versions again\n", state.Passes, pass.migrated)
+        }
+        if err := state.Save(path); err != nil {
+            return err
+        }
+
+        if ctx.Err() != nil {
+            pterm.Info.Printf("Watch stopped, run it again to continue from %s\n", path)
+            return nil
+        }
+        pterm.Info.Printf("Next pass at %s, interrupt to stop\n", time.Now().Add(interval).Format(time.RFC3339))
+        select {
+        case <-ctx.Done():
+            pterm.Info.Printf("Watch stopped, run it again to continue from %s\n", path)
+            return nil
+        case <-time.After(interval):
+        }
+    }
+}
@@ -0,0 +1,122 @@
+package transform
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "fmt"
+    "os/exec"
+    "strings"
+)
+
+// Artifact is a package version handed to transformers before upload
+type Artifact struct {
+    PackageType  string                 `json:"package_type"`
+    PackageName  string                 `json:"package_name"`
+    Version      string                 `json:"version"`
+    Organization string                 `json:"organization"`
+    Files        []string               `json:"files"`
+    Metadata     map[string]interface{} `json:"metadata,omitempty"`
+    Workdir      string                 `json:"workdir,omitempty"` // where rewritten files go, removed with the run's staging files
+}
+
+// Transformer may rewrite an artifact's files and metadata before upload
+type Transformer interface {
+    Name() string
+    Transform(ctx context.Context, artifact *Artifact) error
+}
+
+// ExecTransformer runs an external executable speaking the JSON protocol:
+// the artifact is written to stdin and a Response is read from stdout
+type ExecTransformer struct {
+    Command string
+    Args    []string
+}
+
+// Response is the JSON document an exec plugin writes to stdout
+type Response struct {
+    Files    []string               `json:"files,omitempty"`
+    Metadata map[string]interface{} `json:"metadata,omitempty"`
+    Error    string                 `json:"error,omitempty"`
+}
+
+// NewExecTransformer parses a plugin spec such as "./resign-jars --key k.pem"
+func NewExecTransformer(spec string) (*ExecTransformer, error) {
+    fields := strings.Fields(spec)
+    if len(fields) == 0 {
+        return nil, fmt.Errorf("empty transform plugin command")
+    }
+    return &ExecTransformer{Command: fields[0], Args: fields[1:]}, nil
+}
+
+func (t *ExecTransformer) Name() string {
+    return t.Command
+}
+
+func (t *ExecTransformer) Transform(ctx context.Context, artifact *Artifact) error {
+    input, err := json.Marshal(artifact)
+    if err != nil {
+        return fmt.Errorf("failed to marshal artifact: %v", err)
+    }
+
+    var stdout, stderr bytes.Buffer
+    cmd := exec.CommandContext(ctx, t.Command, t.Args...)
+    cmd.Stdin = bytes.NewReader(input)
+    cmd.Stdout = &stdout
+    cmd.Stderr = &stderr
+
+    if err := cmd.Run(); err != nil {
+        return fmt.Errorf("plugin %s failed: %v: %s", t.Command, err, strings.TrimSpace(stderr.String()))
+    }
+
+    // An empty response leaves the artifact untouched
+    if len(bytes.TrimSpace(stdout.Bytes())) == 0 {
+        return nil
+    }
+
+    var resp Response
+    if err := json.Unmarshal(stdout.Bytes(), &resp); err != nil {
+        return fmt.Errorf("plugin %s returned invalid response: %v", t.Command, err)
+    }
+
+    if resp.Error != "" {
+        return fmt.Errorf("plugin %s rejected %s@%s: %s", t.Command, artifact.PackageName, artifact.Version, resp.Error)
+    }
+
+    if resp.Files != nil {
+        artifact.Files = resp.Files
+    }
+    if resp.Metadata != nil {
+        artifact.Metadata = resp.Metadata
+    }
+
+    return nil
+}
+
+// Chain applies transformers in order, stopping at the first failure
+type Chain []Transformer
+
+// NewChain builds an exec transformer chain from plugin specs
+func NewChain(specs []string) (Chain, error) {
+    var chain Chain
+    for _, spec := range specs {
+        if strings.TrimSpace(spec) == "" {
+            continue
+        }
+        t, err := NewExecTransformer(spec)
+        if err != nil {
+            return nil, err
+        }
+        chain = append(chain, t)
+    }
+    return chain, nil
+}
+
+func (c Chain) Apply(ctx context.Context, artifact *Artifact) error {
+    for _, t := range c {
+        if err := t.Transform(ctx, artifact); err != nil {
+            return err
+        }
+    }
+    return nil
+}
@@ -0,0 +1,119 @@
+package transport
+
+import (
+    "fmt"
+    "io"
+    "net/http"
+    "sync"
+    "sync/atomic"
+
+    "github.com/cvega/gh-migrate-packages/pkg/filter"
+)
+
+// Budget caps the bytes transferred and API calls made by every client
+// sharing it. Requests are never cut off mid-flight; callers check
+// Exhausted between units of work and stop there
+type Budget struct {
+    maxBytes int64 // 0 for no limit
+    maxCalls int64 // 0 for no limit
+
+    bytes atomic.Int64
+    calls atomic.Int64
+}
+
+// ErrBudgetExhausted reports which limit a run reached
+type ErrBudgetExhausted struct {
+    Limit string
+    Used  int64
+    Max   int64
+}
+
+func (e *ErrBudgetExhausted) Error() string {
+    if e.Limit == "transfer" {
+        return fmt.Sprintf("%s budget exhausted: used %s of %s", e.Limit, filter.FormatSize(e.Used), filter.FormatSize(e.Max))
+    }
+    return fmt.Sprintf("%s budget exhausted: used %d of %d", e.Limit, e.Used, e.Max)
+}
+
+func NewBudget(maxBytes, maxCalls int64) *Budget {
+    return &Budget{maxBytes: maxBytes, maxCalls: maxCalls}
+}
+
+// Limited reports whether the budget has any limit set
+func (b *Budget) Limited() bool {
+    return b.maxBytes > 0 || b.maxCalls > 0
+}
+
+// Exhausted returns an *ErrBudgetExhausted once either limit is reached
+func (b *Budget) Exhausted() error {
+    if used := b.bytes.Load(); b.maxBytes > 0 && used >= b.maxBytes {
+        return &ErrBudgetExhausted{Limit: "transfer", Used: used, Max: b.maxBytes}
+    }
+    if used := b.calls.Load(); b.maxCalls > 0 && used >= b.maxCalls {
+        return &ErrBudgetExhausted{Limit: "API call", Used: used, Max: b.maxCalls}
+    }
+    return nil
+}
+
+// Usage returns the bytes transferred and calls made so far
+func (b *Budget) Usage() (int64, int64) {
+    return b.bytes.Load(), b.calls.Load()
+}
+
+// Meter counts every request and the bytes sent and received through it
+// against a budget, when one is set
+type Meter struct {
+    next http.RoundTripper
+
+    mu     sync.RWMutex
+    budget *Budget
+}
+
+// NewMeter wraps next, or http.DefaultTransport if next is nil
+func NewMeter(next http.RoundTripper) *Meter {
+    if next == nil {
+        next = http.DefaultTransport
+    }
+    return &Meter{next: next}
+}
+
+// SetBudget starts counting against budget
+func (m *Meter) SetBudget(budget *Budget) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    m.budget = budget
+}
+
+func (m *Meter) RoundTrip(req *http.Request) (*http.Response, error) {
+    m.mu.RLock()
+    budget := m.budget
+    m.mu.RUnlock()
+
+    if budget == nil {
+        return m.next.RoundTrip(req)
+    }
+
+    budget.calls.Add(1)
+    if req.ContentLength > 0 {
+        budget.bytes.Add(req.ContentLength)
+    }
+
+    resp, err := m.next.RoundTrip(req)
+    if err != nil {
+        return nil, err
+    }
+    resp.Body = &countingBody{ReadCloser: resp.Body, budget: budget}
+    return resp, nil
+}
+
+// countingBody adds what is read from a response to its budget
+type countingBody struct {
+    io.ReadCloser
+    budget *Budget
+}
+
+func (c *countingBody) Read(p []byte) (int, error) {
+    n, err := c.ReadCloser.Read(p)
+    c.budget.bytes.Add(int64(n))
+    return n, err
+}
@@ -0,0 +1,122 @@
+package transport
+
+import (
+    "fmt"
+    "io"
+    "log"
+    "math/rand"
+    "net/http"
+    "strconv"
+    "strings"
+    "sync"
+    "sync/atomic"
+    "time"
+)
+
+// Longest simulated rate limit pause
+const maxChaosPause = 10 * time.Second
+
+// Chaos injects simulated failures for rehearsing a migration's retry and
+// rollback runbooks. At the configured rate, uploads fail with a 503 before
+// leaving the process, and any request first waits out a simulated rate
+// limit pause. It passes everything through untouched until a rate is set
+type Chaos struct {
+    next http.RoundTripper
+
+    mu     sync.Mutex
+    rate   float64
+    random *rand.Rand
+
+    failures atomic.Int64
+    pauses   atomic.Int64
+}
+
+// NewChaos wraps next, or http.DefaultTransport if next is nil
+func NewChaos(next http.RoundTripper) *Chaos {
+    if next == nil {
+        next = http.DefaultTransport
+    }
+    return &Chaos{next: next, random: rand.New(rand.NewSource(time.Now().UnixNano()))}
+}
+
+// ParseRate reads a chaos rate as a percentage such as 2% or a fraction
+// such as 0.02
+func ParseRate(value string) (float64, error) {
+    value = strings.TrimSpace(value)
+    percent := strings.HasSuffix(value, "%")
+    rate, err := strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64)
+    if err != nil {
+        return 0, fmt.Errorf("invalid rate %q, expected a percentage such as 2%%", value)
+    }
+    if percent {
+        rate /= 100
+    }
+    if rate < 0 || rate > 1 {
+        return 0, fmt.Errorf("rate %q must be between 0%% and 100%%", value)
+    }
+    return rate, nil
+}
+
+// SetRate sets the share of requests that get a simulated failure or pause
+func (c *Chaos) SetRate(rate float64) {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    c.rate = rate
+}
+
+// Injected returns the simulated upload failures and pauses so far
+func (c *Chaos) Injected() (int64, int64) {
+    return c.failures.Load(), c.pauses.Load()
+}
+
+// roll reports whether an event at the configured rate happens, and a pause
+// length for it
+func (c *Chaos) roll() (bool, time.Duration) {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    if c.rate == 0 || c.random.Float64() >= c.rate {
+        return false, 0
+    }
+    return true, time.Second + time.Duration(c.random.Int63n(int64(maxChaosPause-time.Second)))
+}
+
+func (c *Chaos) RoundTrip(req *http.Request) (*http.Response, error) {
+    if hit, pause := c.roll(); hit {
+        c.pauses.Add(1)
+        log.Printf("Chaos: simulated rate limit, pausing %v before %s %s", pause.Round(time.Second), req.Method, req.URL.Redacted())
+        if err := sleep(req.Context(), pause); err != nil {
+            return nil, err
+        }
+    }
+
+    if isUpload(req) {
+        if hit, _ := c.roll(); hit {
+            if req.Body != nil {
+                req.Body.Close()
+            }
+            c.failures.Add(1)
+            log.Printf("Chaos: simulated upload failure for %s %s", req.Method, req.URL.Redacted())
+            return &http.Response{
+                Status:     "503 Service Unavailable",
+                StatusCode: http.StatusServiceUnavailable,
+                Proto:      "HTTP/1.1",
+                ProtoMajor: 1,
+                ProtoMinor: 1,
+                Header:     http.Header{"Content-Type": []string{"application/json"}},
+                Body:       io.NopCloser(strings.NewReader(`{"message":"simulated failure (--chaos)"}`)),
+                Request:    req,
+            }, nil
+        }
+    }
+    return c.next.RoundTrip(req)
+}
+
+// isUpload reports whether req sends something to a registry; GraphQL
+// posts are left alone
+func isUpload(req *http.Request) bool {
+    switch req.Method {
+    case "PUT", "POST", "PATCH":
+        return !strings.HasSuffix(req.URL.Path, "/graphql")
+    }
+    return false
+}
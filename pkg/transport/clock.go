@@ -0,0 +1,111 @@
+package transport
+
+import (
+    "log"
+    "net/http"
+    "strings"
+    "sync"
+    "time"
+)
+
+// Clock tracks how far the local clock is from the server's, measured from
+// the Date header of GitHub API responses. Rate limit resets are server
+// timestamps, so waiting for one on a runner whose clock is off would
+// otherwise sleep far too long or not at all. Other hosts, such as external
+// registries or storage, keep their own clocks and are ignored
+type Clock struct {
+    next http.RoundTripper
+
+    mu     sync.Mutex
+    hosts  map[string]bool // API hosts besides github.com's, see AddHost
+    skew   time.Duration   // server time minus local time
+    known  bool
+    logged time.Duration // last skew written to the log
+}
+
+// NewClock wraps next, or http.DefaultTransport if next is nil
+func NewClock(next http.RoundTripper) *Clock {
+    if next == nil {
+        next = http.DefaultTransport
+    }
+    return &Clock{next: next, hosts: make(map[string]bool)}
+}
+
+// AddHost samples the Date header of responses from host too, such as a
+// GitHub Enterprise Server
+func (c *Clock) AddHost(host string) {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    c.hosts[strings.ToLower(host)] = true
+}
+
+// apiHost reports whether host serves the GitHub API: api.github.com, a
+// GHE.com tenant's api subdomain, or a host added with AddHost
+func (c *Clock) apiHost(host string) bool {
+    host = strings.ToLower(host)
+    if host == "api.github.com" || strings.HasPrefix(host, "api.") && strings.HasSuffix(host, ".ghe.com") {
+        return true
+    }
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    return c.hosts[host]
+}
+
+func (c *Clock) RoundTrip(req *http.Request) (*http.Response, error) {
+    resp, err := c.next.RoundTrip(req)
+    if err != nil {
+        return resp, err
+    }
+
+    received := time.Now()
+    if !c.apiHost(req.URL.Hostname()) {
+        return resp, nil
+    }
+    if date, err := http.ParseTime(resp.Header.Get("Date")); err == nil {
+        // Date is truncated to the second, aim for the middle of it
+        c.mu.Lock()
+        c.skew = date.Add(500 * time.Millisecond).Sub(received)
+        c.known = true
+        c.mu.Unlock()
+    }
+    return resp, nil
+}
+
+// Skew returns the server time minus the local time, and false until an
+// API response with a Date header has been seen
+func (c *Clock) Skew() (time.Duration, bool) {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    return c.skew, c.known
+}
+
+// Until returns how long to wait for the server time t, corrected for the
+// measured skew and capped at limit
+func (c *Clock) Until(t time.Time, limit time.Duration) time.Duration {
+    skew, _ := c.Skew()
+    if c.skewChanged(skew) {
+        log.Printf("Clock skew against the server is %v (positive when the local clock is behind), adjusting rate limit waits\n", skew.Round(time.Second))
+    }
+
+    wait := time.Until(t) - skew
+    if wait < 0 {
+        return 0
+    }
+    if limit > 0 && wait > limit {
+        log.Printf("Rate limit wait of %v capped at %v\n", wait.Round(time.Second), limit)
+        return limit
+    }
+    return wait
+}
+
+// skewChanged reports whether skew is at least a second away from the last
+// one logged, so a steady skew is only logged once
+func (c *Clock) skewChanged(skew time.Duration) bool {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    if diff := skew - c.logged; diff > -time.Second && diff < time.Second {
+        return false
+    }
+    c.logged = skew
+    return true
+}
@@ -0,0 +1,88 @@
+package transport
+
+import (
+    "io"
+    "net/http"
+    "strings"
+    "testing"
+    "time"
+)
+
+// dated answers every request with a Date header offset from now
+func dated(offset time.Duration) roundTripFunc {
+    return func(req *http.Request) (*http.Response, error) {
+        header := http.Header{}
+        header.Set("Date", time.Now().Add(offset).UTC().Format(http.TimeFormat))
+        return &http.Response{StatusCode: http.StatusOK, Header: header, Body: io.NopCloser(strings.NewReader("")), Request: req}, nil
+    }
+}
+
+func TestClockSamplesAPIHosts(t *testing.T) {
+    tests := []struct {
+        name  string
+        url   string
+        hosts []string
+        known bool
+    }{
+        {"github.com api", "https://api.github.com/graphql", nil, true},
+        {"ghe.com api", "https://api.octocorp.ghe.com/graphql", nil, true},
+        {"added server", "https://ghes.example.com/api/v3/orgs/o", []string{"GHES.example.com"}, true},
+        {"container registry", "https://ghcr.io/v2/o/p/tags/list", nil, false},
+        {"package storage", "https://pkg-containers.githubusercontent.com/ghcr1/blobs/x", nil, false},
+        {"external registry", "https://crates.example.com/api/v1/crates", nil, false},
+        {"lookalike host", "https://api.github.com.example.net/graphql", nil, false},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            clock := NewClock(dated(time.Hour))
+            for _, host := range tt.hosts {
+                clock.AddHost(host)
+            }
+
+            req, err := http.NewRequest("GET", tt.url, nil)
+            if err != nil {
+                t.Fatal(err)
+            }
+            if _, err := clock.RoundTrip(req); err != nil {
+                t.Fatal(err)
+            }
+
+            skew, known := clock.Skew()
+            if known != tt.known {
+                t.Fatalf("skew known = %v, want %v", known, tt.known)
+            }
+            if known && (skew < 59*time.Minute || skew > 61*time.Minute) {
+                t.Errorf("skew = %v, want about an hour", skew)
+            }
+        })
+    }
+}
+
+func TestClockUntil(t *testing.T) {
+    tests := []struct {
+        name  string
+        skew  time.Duration
+        reset time.Duration // from local now
+        limit time.Duration
+        want  time.Duration
+    }{
+        {"no skew", 0, 10 * time.Minute, 0, 10 * time.Minute},
+        {"local clock behind", 5 * time.Minute, 10 * time.Minute, 0, 5 * time.Minute},
+        {"local clock ahead", -5 * time.Minute, 10 * time.Minute, 0, 15 * time.Minute},
+        {"reset already passed", 20 * time.Minute, 10 * time.Minute, 0, 0},
+        {"capped", 0, 3 * time.Hour, time.Hour, time.Hour},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            clock := NewClock(nil)
+            clock.skew, clock.known = tt.skew, true
+
+            got := clock.Until(time.Now().Add(tt.reset), tt.limit)
+            if diff := got - tt.want; diff < -time.Second || diff > time.Second {
+                t.Errorf("Until = %v, want %v", got, tt.want)
+            }
+        })
+    }
+}
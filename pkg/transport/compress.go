@@ -0,0 +1,161 @@
+package transport
+
+import (
+    "bytes"
+    "compress/gzip"
+    "io"
+    "log"
+    "mime"
+    "net/http"
+    "strings"
+    "sync"
+    "sync/atomic"
+)
+
+// Bodies outside these sizes are sent as they are: small ones don't gain
+// from gzip, and large ones are artifacts that are compressed already or
+// would be held in memory twice
+const (
+    minCompressBody = 1 << 10
+    maxCompressBody = 32 << 20
+)
+
+// Compress gzips the bodies of JSON, XML, and text requests, such as npm
+// publishes and metadata updates, and sends them with Content-Encoding:
+// gzip. A host that rejects a compressed body with 400 or 415 gets it again
+// uncompressed, and once the plain body is accepted, the host is sent plain
+// bodies for the rest of the run. Responses are negotiated by net/http,
+// which asks for gzip and decompresses transparently. It passes everything
+// through untouched until enabled
+type Compress struct {
+    next    http.RoundTripper
+    enabled atomic.Bool
+
+    mu      sync.Mutex
+    refused map[string]bool // hosts that only take plain bodies
+
+    sent  atomic.Int64 // compressed bytes sent
+    saved atomic.Int64 // bytes compression kept off the wire
+}
+
+// NewCompress wraps next, or http.DefaultTransport if next is nil
+func NewCompress(next http.RoundTripper) *Compress {
+    if next == nil {
+        next = http.DefaultTransport
+    }
+    return &Compress{next: next, refused: make(map[string]bool)}
+}
+
+// Enable starts compressing request bodies
+func (c *Compress) Enable() {
+    c.enabled.Store(true)
+}
+
+// Saved returns the compressed bytes sent and the bytes saved so far
+func (c *Compress) Saved() (int64, int64) {
+    return c.sent.Load(), c.saved.Load()
+}
+
+func (c *Compress) RoundTrip(req *http.Request) (*http.Response, error) {
+    if !c.enabled.Load() || !compressible(req) || c.isRefused(req.URL.Host) {
+        return c.next.RoundTrip(req)
+    }
+
+    plain, err := io.ReadAll(req.Body)
+    req.Body.Close()
+    if err != nil {
+        return nil, err
+    }
+    compressed, ok := gzipBody(plain)
+    if !ok {
+        return c.next.RoundTrip(withBody(req, plain))
+    }
+
+    zipped := withBody(req, compressed)
+    zipped.Header.Set("Content-Encoding", "gzip")
+    resp, err := c.next.RoundTrip(zipped)
+    if err != nil {
+        return nil, err
+    }
+    if resp.StatusCode != http.StatusBadRequest && resp.StatusCode != http.StatusUnsupportedMediaType {
+        c.sent.Add(int64(len(compressed)))
+        c.saved.Add(int64(len(plain) - len(compressed)))
+        return resp, nil
+    }
+
+    // The rejection may be about the content rather than the encoding,
+    // only a plain body that gets through tells them apart
+    io.Copy(io.Discard, resp.Body)
+    resp.Body.Close()
+    resp, err = c.next.RoundTrip(withBody(req, plain))
+    if err == nil && resp.StatusCode != http.StatusBadRequest && resp.StatusCode != http.StatusUnsupportedMediaType {
+        c.refuse(req.URL.Host)
+    }
+    return resp, err
+}
+
+// compressible reports whether req has a body worth compressing
+func compressible(req *http.Request) bool {
+    switch req.Method {
+    case http.MethodPost, http.MethodPut, http.MethodPatch:
+    default:
+        return false
+    }
+    if req.Body == nil || req.Header.Get("Content-Encoding") != "" {
+        return false
+    }
+    if req.ContentLength < minCompressBody || req.ContentLength > maxCompressBody {
+        return false
+    }
+
+    mediaType, _, err := mime.ParseMediaType(req.Header.Get("Content-Type"))
+    if err != nil {
+        return false
+    }
+    return strings.HasPrefix(mediaType, "text/") ||
+        mediaType == "application/json" || strings.HasSuffix(mediaType, "+json") ||
+        mediaType == "application/xml" || strings.HasSuffix(mediaType, "+xml")
+}
+
+// gzipBody compresses body, or reports false if that doesn't make it smaller
+func gzipBody(body []byte) ([]byte, bool) {
+    var buf bytes.Buffer
+    writer := gzip.NewWriter(&buf)
+    if _, err := writer.Write(body); err != nil {
+        return nil, false
+    }
+    if err := writer.Close(); err != nil {
+        return nil, false
+    }
+    if buf.Len() >= len(body) {
+        return nil, false
+    }
+    return buf.Bytes(), true
+}
+
+// withBody clones req with body, which can be sent again on a retry
+func withBody(req *http.Request, body []byte) *http.Request {
+    // Round trippers must not modify the caller's request
+    clone := req.Clone(req.Context())
+    clone.Body = io.NopCloser(bytes.NewReader(body))
+    clone.GetBody = func() (io.ReadCloser, error) {
+        return io.NopCloser(bytes.NewReader(body)), nil
+    }
+    clone.ContentLength = int64(len(body))
+    return clone
+}
+
+func (c *Compress) isRefused(host string) bool {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    return c.refused[host]
+}
+
+func (c *Compress) refuse(host string) {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    if !c.refused[host] {
+        c.refused[host] = true
+        log.Printf("%s rejected a gzip request body, sending it plain bodies from now on", host)
+    }
+}
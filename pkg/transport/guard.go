@@ -0,0 +1,215 @@
+package transport
+
+import (
+    "bytes"
+    "encoding/json"
+    "fmt"
+    "io"
+    "net/http"
+    "strings"
+    "sync"
+)
+
+// Methods that can't change state on any well-behaved server
+var safeMethods = []string{"GET", "HEAD", "OPTIONS"}
+
+// ErrMutationBlocked is returned for requests a read-only guard refuses
+type ErrMutationBlocked struct {
+    Method string
+    URL    string
+}
+
+func (e *ErrMutationBlocked) Error() string {
+    return fmt.Sprintf("read-only mode: refusing %s %s", e.Method, e.URL)
+}
+
+// Guard is the shared round tripper under every API client. In read-only
+// mode it only lets through methods on each host's allowlist, plus GraphQL
+// queries, and fails everything else before it leaves the process
+type Guard struct {
+    next http.RoundTripper
+
+    mu       sync.RWMutex
+    readOnly bool
+    allowed  map[string]map[string]bool // host -> methods, "*" for any host
+}
+
+// NewGuard wraps next, or http.DefaultTransport if next is nil
+func NewGuard(next http.RoundTripper) *Guard {
+    if next == nil {
+        next = http.DefaultTransport
+    }
+    return &Guard{next: next}
+}
+
+// SetReadOnly restricts every host to safe methods
+func (g *Guard) SetReadOnly() {
+    g.mu.Lock()
+    defer g.mu.Unlock()
+
+    g.readOnly = true
+    if g.allowed == nil {
+        g.allowed = make(map[string]map[string]bool)
+    }
+    if g.allowed["*"] == nil {
+        g.allowed["*"] = make(map[string]bool)
+    }
+    for _, m := range safeMethods {
+        g.allowed["*"][m] = true
+    }
+}
+
+// Allow adds methods to host's allowlist in read-only mode
+func (g *Guard) Allow(host string, methods ...string) {
+    g.mu.Lock()
+    defer g.mu.Unlock()
+
+    if g.allowed == nil {
+        g.allowed = make(map[string]map[string]bool)
+    }
+    if g.allowed[host] == nil {
+        g.allowed[host] = make(map[string]bool)
+    }
+    for _, m := range methods {
+        g.allowed[host][strings.ToUpper(m)] = true
+    }
+}
+
+// ReadOnly reports whether the guard is blocking mutations
+func (g *Guard) ReadOnly() bool {
+    g.mu.RLock()
+    defer g.mu.RUnlock()
+    return g.readOnly
+}
+
+func (g *Guard) RoundTrip(req *http.Request) (*http.Response, error) {
+    if g.ReadOnly() && !g.permits(req) {
+        if req.Body != nil {
+            req.Body.Close()
+        }
+        return nil, &ErrMutationBlocked{Method: req.Method, URL: req.URL.Redacted()}
+    }
+    return g.next.RoundTrip(req)
+}
+
+func (g *Guard) permits(req *http.Request) bool {
+    g.mu.RLock()
+    host, any := g.allowed[req.URL.Hostname()], g.allowed["*"]
+    g.mu.RUnlock()
+
+    if host[req.Method] || any[req.Method] {
+        return true
+    }
+
+    // GraphQL reads are POSTs too, only mutations change anything
+    if req.Method == "POST" && strings.HasSuffix(req.URL.Path, "/graphql") {
+        return isGraphQLQuery(req)
+    }
+    return false
+}
+
+// isGraphQLQuery peeks at the request body, restoring it for the next
+// transport. Every operation in the document must be a query: a mutation
+// anywhere in it is refused, whichever operationName the request selects
+func isGraphQLQuery(req *http.Request) bool {
+    if req.Body == nil {
+        return false
+    }
+
+    data, err := io.ReadAll(req.Body)
+    req.Body.Close()
+    req.Body = io.NopCloser(bytes.NewReader(data))
+    if err != nil {
+        return false
+    }
+
+    var payload struct {
+        Query string `json:"query"`
+    }
+    if err := json.Unmarshal(data, &payload); err != nil {
+        return false
+    }
+
+    definitions := graphQLDefinitions(payload.Query)
+    queries := 0
+    for _, keyword := range definitions {
+        switch keyword {
+        case "query", "{":
+            queries++
+        case "fragment":
+        default:
+            return false
+        }
+    }
+    return queries > 0
+}
+
+// graphQLDefinitions returns the keyword opening each top-level definition
+// of document: query, mutation, subscription, fragment, or "{" for a query
+// in shorthand. Comments and strings are skipped, and a document whose
+// brackets don't balance has none
+func graphQLDefinitions(document string) []string {
+    var definitions []string
+    depth, opening := 0, true
+    for i := 0; i < len(document); {
+        c := document[i]
+        switch {
+        case c == '#':
+            for i < len(document) && document[i] != '\n' && document[i] != '\r' {
+                i++
+            }
+            continue
+        case strings.HasPrefix(document[i:], `"""`):
+            i += 3
+            for i < len(document) && !strings.HasPrefix(document[i:], `"""`) {
+                if strings.HasPrefix(document[i:], `\"""`) {
+                    i += 3
+                }
+                i++
+            }
+            i += 3
+            continue
+        case c == '"':
+            i++
+            for i < len(document) && document[i] != '"' && document[i] != '\n' {
+                if document[i] == '\\' {
+                    i++
+                }
+                i++
+            }
+            i++
+            continue
+        case c == '{' || c == '(' || c == '[':
+            if depth == 0 && opening && c == '{' {
+                definitions = append(definitions, "{")
+            }
+            opening = false
+            depth++
+        case c == '}' || c == ')' || c == ']':
+            depth--
+            if depth < 0 {
+                return nil
+            }
+            if depth == 0 && c == '}' {
+                opening = true
+            }
+        case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+            end := i + 1
+            for end < len(document) && (document[end] == '_' || document[end] >= 'a' && document[end] <= 'z' ||
+                document[end] >= 'A' && document[end] <= 'Z' || document[end] >= '0' && document[end] <= '9') {
+                end++
+            }
+            if depth == 0 && opening {
+                definitions = append(definitions, document[i:end])
+                opening = false
+            }
+            i = end
+            continue
+        }
+        i++
+    }
+    if depth != 0 {
+        return nil
+    }
+    return definitions
+}
@@ -0,0 +1,130 @@
+package transport
+
+import (
+    "encoding/json"
+    "errors"
+    "io"
+    "net/http"
+    "strings"
+    "testing"
+)
+
+// roundTripFunc serves requests from a function instead of the network
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+    return f(req)
+}
+
+// respond answers every request with status and headers, counting them
+func respond(status int, header http.Header, calls *int) roundTripFunc {
+    return func(req *http.Request) (*http.Response, error) {
+        *calls++
+        if header == nil {
+            header = http.Header{}
+        }
+        return &http.Response{StatusCode: status, Header: header, Body: io.NopCloser(strings.NewReader("")), Request: req}, nil
+    }
+}
+
+func graphQLRequest(t *testing.T, query, operationName string) *http.Request {
+    body, err := json.Marshal(map[string]string{"query": query, "operationName": operationName})
+    if err != nil {
+        t.Fatal(err)
+    }
+    req, err := http.NewRequest("POST", "https://api.github.com/graphql", strings.NewReader(string(body)))
+    if err != nil {
+        t.Fatal(err)
+    }
+    return req
+}
+
+func TestGuardGraphQL(t *testing.T) {
+    tests := []struct {
+        name          string
+        query         string
+        operationName string
+        allowed       bool
+    }{
+        {"query", "query { viewer { login } }", "", true},
+        {"shorthand query", "{ viewer { login } }", "", true},
+        {"query with fragment", "query { viewer { ...F } } fragment F on User { login }", "", true},
+        {"string mentioning a mutation", `query Q($q: String = "mutation { x }") { search(query: "}") { total } }`, "", true},
+        {"mutation", "mutation { deletePackageVersion(input: {}) { success } }", "", false},
+        {"subscription", "subscription { events }", "", false},
+        {"mutation after a comment", "# just a read\nmutation { deletePackageVersion(input: {}) { success } }", "", false},
+        {"mutation after a query", "query A { viewer { login } } mutation B { deletePackageVersion(input: {}) { success } }", "A", false},
+        {"mutation selected by name", "query A { viewer { login } } mutation B { deletePackageVersion(input: {}) { success } }", "B", false},
+        {"leading whitespace", "\n\t  mutation { x }", "", false},
+        {"unbalanced", "query { viewer { login }", "", false},
+        {"empty", "", "", false},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            calls := 0
+            guard := NewGuard(respond(http.StatusOK, nil, &calls))
+            guard.SetReadOnly()
+
+            req := graphQLRequest(t, tt.query, tt.operationName)
+            _, err := guard.RoundTrip(req)
+
+            var blocked *ErrMutationBlocked
+            if tt.allowed && (err != nil || calls != 1) {
+                t.Fatalf("query was refused: %v", err)
+            }
+            if !tt.allowed && (!errors.As(err, &blocked) || calls != 0) {
+                t.Fatalf("document was let through, err = %v", err)
+            }
+            if tt.allowed {
+                // The body is restored for the next transport
+                body, _ := io.ReadAll(req.Body)
+                if !strings.Contains(string(body), `"query"`) {
+                    t.Errorf("request body was not restored: %q", body)
+                }
+            }
+        })
+    }
+}
+
+func TestGuardMethods(t *testing.T) {
+    tests := []struct {
+        name     string
+        readOnly bool
+        allow    map[string][]string
+        method   string
+        url      string
+        allowed  bool
+    }{
+        {"writable", false, nil, "DELETE", "https://api.github.com/orgs/o/packages/npm/p", true},
+        {"get", true, nil, "GET", "https://api.github.com/orgs/o/packages", true},
+        {"head", true, nil, "HEAD", "https://ghcr.io/v2/o/p/blobs/sha256:00", true},
+        {"delete", true, nil, "DELETE", "https://api.github.com/orgs/o/packages/npm/p", false},
+        {"put", true, nil, "PUT", "https://npm.pkg.github.com/p", false},
+        {"rest post", true, nil, "POST", "https://api.github.com/orgs/o/issues", false},
+        {"allowed on host", true, map[string][]string{"ghcr.io": {"post"}}, "POST", "https://ghcr.io/token", true},
+        {"allowed on another host", true, map[string][]string{"ghcr.io": {"post"}}, "POST", "https://api.github.com/orgs/o/issues", false},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            calls := 0
+            guard := NewGuard(respond(http.StatusOK, nil, &calls))
+            if tt.readOnly {
+                guard.SetReadOnly()
+            }
+            for host, methods := range tt.allow {
+                guard.Allow(host, methods...)
+            }
+
+            req, err := http.NewRequest(tt.method, tt.url, nil)
+            if err != nil {
+                t.Fatal(err)
+            }
+            _, err = guard.RoundTrip(req)
+            if got := err == nil && calls == 1; got != tt.allowed {
+                t.Errorf("%s %s allowed = %v, want %v (err %v)", tt.method, tt.url, got, tt.allowed, err)
+            }
+        })
+    }
+}
@@ -0,0 +1,96 @@
+package transport
+
+import (
+    "context"
+    "errors"
+    "io"
+    "net"
+    "net/http"
+    "syscall"
+    "time"
+)
+
+// Retry re-sends idempotent requests that failed before a response came
+// back: connection resets, DNS failures and unexpected EOFs, typically from
+// flaky proxies. Responses, whatever their status, are passed through
+// untouched so application level retries and failure counts stay unaffected
+type Retry struct {
+    next     http.RoundTripper
+    attempts int
+    backoff  time.Duration
+}
+
+// NewRetry wraps next, or http.DefaultTransport if next is nil, retrying up
+// to 3 more times with exponential backoff
+func NewRetry(next http.RoundTripper) *Retry {
+    if next == nil {
+        next = http.DefaultTransport
+    }
+    return &Retry{next: next, attempts: 4, backoff: 250 * time.Millisecond}
+}
+
+func (r *Retry) RoundTrip(req *http.Request) (*http.Response, error) {
+    resp, err := r.next.RoundTrip(req)
+    for attempt := 1; attempt < r.attempts && err != nil && retryable(req, err); attempt++ {
+        if err := sleep(req.Context(), r.backoff<<(attempt-1)); err != nil {
+            return nil, err
+        }
+
+        retry := req
+        if req.Body != nil && req.Body != http.NoBody {
+            body, err := req.GetBody()
+            if err != nil {
+                return nil, err
+            }
+            retry = req.Clone(req.Context())
+            retry.Body = body
+        }
+        resp, err = r.next.RoundTrip(retry)
+    }
+    return resp, err
+}
+
+// retryable reports whether req can safely be sent again after err
+func retryable(req *http.Request, err error) bool {
+    if req.Context().Err() != nil {
+        return false
+    }
+
+    switch req.Method {
+    case "GET", "HEAD", "OPTIONS":
+    case "PUT":
+        // A PUT is only idempotent if the same body can be sent again
+        if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+            return false
+        }
+    default:
+        return false
+    }
+
+    return transient(err)
+}
+
+// transient reports errors worth retrying at the transport layer
+func transient(err error) bool {
+    var dnsErr *net.DNSError
+    switch {
+    case errors.As(err, &dnsErr):
+        return true
+    case errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.ECONNABORTED), errors.Is(err, syscall.EPIPE):
+        return true
+    case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+        return true
+    }
+    return false
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+    timer := time.NewTimer(d)
+    defer timer.Stop()
+    select {
+    case <-ctx.Done():
+        return ctx.Err()
+    case <-timer.C:
+        return nil
+    }
+}
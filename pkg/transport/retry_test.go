@@ -0,0 +1,95 @@
+package transport
+
+import (
+    "bytes"
+    "context"
+    "errors"
+    "io"
+    "net"
+    "net/http"
+    "strings"
+    "syscall"
+    "testing"
+    "time"
+)
+
+// failing fails the first failures requests with err, then answers 200
+func failing(failures int, err error, calls *int) roundTripFunc {
+    return func(req *http.Request) (*http.Response, error) {
+        *calls++
+        if req.Body != nil {
+            io.Copy(io.Discard, req.Body)
+        }
+        if *calls <= failures {
+            return nil, err
+        }
+        return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader("")), Request: req}, nil
+    }
+}
+
+func TestRetry(t *testing.T) {
+    reset := &net.OpError{Op: "read", Err: syscall.ECONNRESET}
+    tests := []struct {
+        name      string
+        method    string
+        body      func() io.Reader
+        failures  int
+        err       error
+        wantCalls int
+        wantErr   bool
+    }{
+        {"get recovers", "GET", nil, 2, reset, 3, false},
+        {"get gives up", "GET", nil, 10, reset, 4, true},
+        {"dns failure", "HEAD", nil, 1, &net.DNSError{Err: "no such host", Name: "ghcr.io"}, 2, false},
+        {"unexpected eof", "GET", nil, 1, io.ErrUnexpectedEOF, 2, false},
+        {"other errors pass", "GET", nil, 1, errors.New("certificate expired"), 1, true},
+        {"post never retried", "POST", func() io.Reader { return strings.NewReader("{}") }, 1, reset, 1, true},
+        {"put with replayable body", "PUT", func() io.Reader { return bytes.NewReader([]byte("layer")) }, 1, reset, 2, false},
+        {"put with one-shot body", "PUT", func() io.Reader { return io.LimitReader(strings.NewReader("layer"), 5) }, 1, reset, 1, true},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            calls := 0
+            retry := NewRetry(failing(tt.failures, tt.err, &calls))
+            retry.backoff = time.Millisecond
+
+            var body io.Reader
+            if tt.body != nil {
+                body = tt.body()
+            }
+            req, err := http.NewRequest(tt.method, "https://ghcr.io/v2/o/p/blobs/uploads/1", body)
+            if err != nil {
+                t.Fatal(err)
+            }
+
+            _, err = retry.RoundTrip(req)
+            if (err != nil) != tt.wantErr {
+                t.Errorf("err = %v, wantErr %v", err, tt.wantErr)
+            }
+            if calls != tt.wantCalls {
+                t.Errorf("sent %d times, want %d", calls, tt.wantCalls)
+            }
+        })
+    }
+}
+
+func TestRetryStopsWhenCanceled(t *testing.T) {
+    calls := 0
+    retry := NewRetry(failing(10, io.EOF, &calls))
+    retry.backoff = time.Hour
+
+    ctx, cancel := context.WithCancel(context.Background())
+    req, err := http.NewRequestWithContext(ctx, "GET", "https://api.github.com/", nil)
+    if err != nil {
+        t.Fatal(err)
+    }
+    time.AfterFunc(10*time.Millisecond, cancel)
+
+    if _, err := retry.RoundTrip(req); !errors.Is(err, context.Canceled) {
+        t.Errorf("err = %v, want context.Canceled", err)
+    }
+    if calls != 1 {
+        t.Errorf("sent %d times, want 1", calls)
+    }
+}
@@ -0,0 +1,239 @@
+package transport
+
+import (
+    "log"
+    "net/http"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+)
+
+// Tokens spreads the requests made with one token over a pool of tokens
+// for the same organization, multiplying the rate limit a very large
+// migration can draw on. A request whose Authorization header carries the
+// primary token goes out with the next usable token in turn. A token whose
+// rate limit runs out is passed over until it resets, and one the API
+// rejects with 401 is removed for the rest of the run; either way the
+// request is sent again with another token when its body can be replayed.
+// Without extra tokens it passes everything through untouched
+type Tokens struct {
+    next    http.RoundTripper
+    primary string
+
+    mu   sync.Mutex
+    pool []*pooledToken
+    turn int
+}
+
+// pooledToken is a token's standing in the pool
+type pooledToken struct {
+    value     string
+    index     int                  // 1-based, tokens are never logged
+    remaining map[string]int       // by rate limit resource, e.g. core or graphql
+    resets    map[string]time.Time // by rate limit resource
+    invalid   bool
+}
+
+// NewTokens wraps next, or http.DefaultTransport if next is nil, with a
+// pool holding only primary until Add is called
+func NewTokens(next http.RoundTripper, primary string) *Tokens {
+    if next == nil {
+        next = http.DefaultTransport
+    }
+    return &Tokens{next: next, primary: primary, pool: []*pooledToken{newPooledToken(primary, 1)}}
+}
+
+func newPooledToken(value string, index int) *pooledToken {
+    return &pooledToken{value: value, index: index, remaining: make(map[string]int), resets: make(map[string]time.Time)}
+}
+
+// Add puts more tokens in the rotation, skipping empty ones and duplicates
+func (t *Tokens) Add(tokens []string) {
+    t.mu.Lock()
+    defer t.mu.Unlock()
+
+    known := make(map[string]bool)
+    for _, token := range t.pool {
+        known[token.value] = true
+    }
+    for _, value := range tokens {
+        value = strings.TrimSpace(value)
+        if value == "" || known[value] {
+            continue
+        }
+        known[value] = true
+        t.pool = append(t.pool, newPooledToken(value, len(t.pool)+1))
+    }
+}
+
+// Counts returns how many tokens are in the pool, how many of them are
+// waiting for a rate limit reset, and how many were removed as invalid
+func (t *Tokens) Counts() (int, int, int) {
+    t.mu.Lock()
+    defer t.mu.Unlock()
+
+    exhausted, invalid := 0, 0
+    for _, token := range t.pool {
+        switch {
+        case token.invalid:
+            invalid++
+        case token.exhausted("core") || token.exhausted("graphql"):
+            exhausted++
+        }
+    }
+    return len(t.pool), exhausted, invalid
+}
+
+func (t *Tokens) RoundTrip(req *http.Request) (*http.Response, error) {
+    auth := req.Header.Get("Authorization")
+    if t.primary == "" || !strings.Contains(auth, t.primary) || t.size() < 2 {
+        return t.next.RoundTrip(req)
+    }
+
+    resource := requestResource(req)
+    replayable := req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+    tried := make(map[*pooledToken]bool)
+    for {
+        token := t.pick(resource, tried)
+        tried[token] = true
+
+        attempt := req.Clone(req.Context())
+        attempt.Header.Set("Authorization", strings.Replace(auth, t.primary, token.value, 1))
+        if len(tried) > 1 && req.GetBody != nil {
+            body, err := req.GetBody()
+            if err != nil {
+                return nil, err
+            }
+            attempt.Body = body
+        }
+
+        resp, err := t.next.RoundTrip(attempt)
+        if err != nil {
+            return resp, err
+        }
+        if !t.update(token, req, resp, resource) || !replayable || !t.untried(tried) {
+            return resp, nil
+        }
+        // Another token gets the request the pool took this one out for
+        resp.Body.Close()
+    }
+}
+
+// pick returns the next usable token not yet tried for this request, or
+// when every token is spent, the one whose rate limit resets first
+func (t *Tokens) pick(resource string, tried map[*pooledToken]bool) *pooledToken {
+    t.mu.Lock()
+    defer t.mu.Unlock()
+
+    for i := 0; i < len(t.pool); i++ {
+        token := t.pool[(t.turn+i)%len(t.pool)]
+        if token.invalid || tried[token] || token.exhausted(resource) {
+            continue
+        }
+        t.turn = (t.turn + i + 1) % len(t.pool)
+        return token
+    }
+
+    var first *pooledToken
+    for _, token := range t.pool {
+        if token.invalid || tried[token] {
+            continue
+        }
+        if first == nil || token.resets[resource].Before(first.resets[resource]) {
+            first = token
+        }
+    }
+    if first == nil {
+        // Nothing left untried, the request goes out as it came in
+        return t.pool[0]
+    }
+    return first
+}
+
+// update records the rate limit a response reports for token, and reports
+// whether the request should be sent again with another one
+func (t *Tokens) update(token *pooledToken, req *http.Request, resp *http.Response, resource string) bool {
+    t.mu.Lock()
+    defer t.mu.Unlock()
+
+    if r := resp.Header.Get("X-RateLimit-Resource"); r != "" {
+        resource = r
+    }
+    if remaining, err := strconv.Atoi(resp.Header.Get("X-RateLimit-Remaining")); err == nil {
+        previous, known := token.remaining[resource]
+        token.remaining[resource] = remaining
+        if reset, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+            token.resets[resource] = time.Unix(reset, 0)
+        }
+        if remaining == 0 && (!known || previous > 0) {
+            log.Printf("Token #%d has no %s rate limit left, passing over it until %v\n", token.index, resource, token.resets[resource].Format(time.RFC3339))
+        }
+    }
+
+    switch resp.StatusCode {
+    case http.StatusUnauthorized:
+        // Registries answer 401 for reasons of their own, only the API
+        // saying so means the token is bad
+        if !apiRequest(req) || t.usable() < 2 {
+            return false
+        }
+        token.invalid = true
+        log.Printf("Token #%d was rejected as invalid, removing it from the pool\n", token.index)
+        return true
+    case http.StatusForbidden, http.StatusTooManyRequests:
+        return token.exhausted(resource)
+    }
+    return false
+}
+
+// exhausted reports whether token has no rate limit left for resource
+// until a reset still ahead
+func (token *pooledToken) exhausted(resource string) bool {
+    remaining, ok := token.remaining[resource]
+    return ok && remaining == 0 && time.Now().Before(token.resets[resource])
+}
+
+func (t *Tokens) size() int {
+    t.mu.Lock()
+    defer t.mu.Unlock()
+    return len(t.pool)
+}
+
+// untried reports whether a usable token is left that tried doesn't have
+func (t *Tokens) untried(tried map[*pooledToken]bool) bool {
+    t.mu.Lock()
+    defer t.mu.Unlock()
+    for _, token := range t.pool {
+        if !token.invalid && !tried[token] {
+            return true
+        }
+    }
+    return false
+}
+
+// usable counts the tokens not removed, callers hold t.mu
+func (t *Tokens) usable() int {
+    n := 0
+    for _, token := range t.pool {
+        if !token.invalid {
+            n++
+        }
+    }
+    return n
+}
+
+// requestResource guesses the rate limit a request draws on before the
+// response names it
+func requestResource(req *http.Request) string {
+    if strings.HasSuffix(req.URL.Path, "/graphql") {
+        return "graphql"
+    }
+    return "core"
+}
+
+// apiRequest reports whether req goes to the REST or GraphQL API rather
+// than a package registry
+func apiRequest(req *http.Request) bool {
+    return strings.HasPrefix(req.URL.Host, "api.") || strings.HasPrefix(req.URL.Path, "/api/")
+}
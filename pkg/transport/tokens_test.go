@@ -0,0 +1,176 @@
+package transport
+
+import (
+    "io"
+    "net/http"
+    "strconv"
+    "strings"
+    "testing"
+    "time"
+)
+
+// tokenServer answers each request with the status status returns for the
+// token it carries, recording the tokens in order
+type tokenServer struct {
+    used   []string
+    status func(token string) (int, http.Header)
+}
+
+func (s *tokenServer) RoundTrip(req *http.Request) (*http.Response, error) {
+    token := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+    s.used = append(s.used, token)
+    status, header := http.StatusOK, http.Header{}
+    if s.status != nil {
+        status, header = s.status(token)
+    }
+    return &http.Response{StatusCode: status, Header: header, Body: io.NopCloser(strings.NewReader("")), Request: req}, nil
+}
+
+func exhaustedHeader() http.Header {
+    header := http.Header{}
+    header.Set("X-RateLimit-Remaining", "0")
+    header.Set("X-RateLimit-Reset", strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10))
+    return header
+}
+
+func send(t *testing.T, tokens *Tokens, url, auth string) *http.Response {
+    req, err := http.NewRequest("GET", url, nil)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if auth != "" {
+        req.Header.Set("Authorization", auth)
+    }
+    resp, err := tokens.RoundTrip(req)
+    if err != nil {
+        t.Fatal(err)
+    }
+    resp.Body.Close()
+    return resp
+}
+
+func TestTokens(t *testing.T) {
+    tests := []struct {
+        name       string
+        extra      []string
+        url        string
+        auth       string
+        status     func(token string) (int, http.Header)
+        requests   int
+        wantUsed   []string
+        wantCounts [3]int // pool, exhausted, invalid
+        wantStatus int
+    }{
+        {
+            name:       "no extra tokens",
+            url:        "https://api.github.com/orgs/o/packages",
+            auth:       "Bearer primary",
+            requests:   2,
+            wantUsed:   []string{"primary", "primary"},
+            wantCounts: [3]int{1, 0, 0},
+            wantStatus: http.StatusOK,
+        },
+        {
+            name:       "round robin",
+            extra:      []string{"second", " ", "primary", "second"},
+            url:        "https://api.github.com/orgs/o/packages",
+            auth:       "Bearer primary",
+            requests:   3,
+            wantUsed:   []string{"primary", "second", "primary"},
+            wantCounts: [3]int{2, 0, 0},
+            wantStatus: http.StatusOK,
+        },
+        {
+            name:       "other credentials untouched",
+            extra:      []string{"second"},
+            url:        "https://crates.example.com/api/v1/crates",
+            auth:       "Bearer registry-token",
+            requests:   2,
+            wantUsed:   []string{"registry-token", "registry-token"},
+            wantCounts: [3]int{2, 0, 0},
+            wantStatus: http.StatusOK,
+        },
+        {
+            name:  "exhausted token passed over",
+            extra: []string{"second"},
+            url:   "https://api.github.com/orgs/o/packages",
+            auth:  "Bearer primary",
+            status: func(token string) (int, http.Header) {
+                if token == "primary" {
+                    return http.StatusForbidden, exhaustedHeader()
+                }
+                return http.StatusOK, http.Header{}
+            },
+            requests:   2,
+            wantUsed:   []string{"primary", "second", "second"},
+            wantCounts: [3]int{2, 1, 0},
+            wantStatus: http.StatusOK,
+        },
+        {
+            name:  "invalid token removed",
+            extra: []string{"second"},
+            url:   "https://api.github.com/orgs/o/packages",
+            auth:  "Bearer primary",
+            status: func(token string) (int, http.Header) {
+                if token == "primary" {
+                    return http.StatusUnauthorized, http.Header{}
+                }
+                return http.StatusOK, http.Header{}
+            },
+            requests:   2,
+            wantUsed:   []string{"primary", "second", "second"},
+            wantCounts: [3]int{2, 0, 1},
+            wantStatus: http.StatusOK,
+        },
+        {
+            name:  "registry 401 keeps the token",
+            extra: []string{"second"},
+            url:   "https://npm.pkg.github.com/p",
+            auth:  "Bearer primary",
+            status: func(token string) (int, http.Header) {
+                return http.StatusUnauthorized, http.Header{}
+            },
+            requests:   1,
+            wantUsed:   []string{"primary"},
+            wantCounts: [3]int{2, 0, 0},
+            wantStatus: http.StatusUnauthorized,
+        },
+        {
+            name:  "every token spent",
+            extra: []string{"second"},
+            url:   "https://api.github.com/orgs/o/packages",
+            auth:  "Bearer primary",
+            status: func(token string) (int, http.Header) {
+                return http.StatusForbidden, exhaustedHeader()
+            },
+            requests:   1,
+            wantUsed:   []string{"primary", "second"},
+            wantCounts: [3]int{2, 2, 0},
+            wantStatus: http.StatusForbidden,
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            server := &tokenServer{status: tt.status}
+            tokens := NewTokens(server, "primary")
+            tokens.Add(tt.extra)
+
+            var resp *http.Response
+            for i := 0; i < tt.requests; i++ {
+                resp = send(t, tokens, tt.url, tt.auth)
+            }
+
+            if strings.Join(server.used, ",") != strings.Join(tt.wantUsed, ",") {
+                t.Errorf("tokens sent %v, want %v", server.used, tt.wantUsed)
+            }
+            if resp.StatusCode != tt.wantStatus {
+                t.Errorf("last status %d, want %d", resp.StatusCode, tt.wantStatus)
+            }
+            pool, exhausted, invalid := tokens.Counts()
+            if got := [3]int{pool, exhausted, invalid}; got != tt.wantCounts {
+                t.Errorf("Counts() = %v, want %v", got, tt.wantCounts)
+            }
+        })
+    }
+}
@@ -0,0 +1,24 @@
+package transport
+
+import "net/http"
+
+// UserAgent sets the User-Agent header of every request that passes through
+type UserAgent struct {
+    next  http.RoundTripper
+    agent string
+}
+
+// NewUserAgent wraps next, or http.DefaultTransport if next is nil
+func NewUserAgent(next http.RoundTripper, agent string) *UserAgent {
+    if next == nil {
+        next = http.DefaultTransport
+    }
+    return &UserAgent{next: next, agent: agent}
+}
+
+func (u *UserAgent) RoundTrip(req *http.Request) (*http.Response, error) {
+    // Round trippers must not modify the caller's request
+    req = req.Clone(req.Context())
+    req.Header.Set("User-Agent", u.agent)
+    return u.next.RoundTrip(req)
+}
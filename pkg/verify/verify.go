@@ -0,0 +1,545 @@
+package verify
+
+import (
+    "bufio"
+    "fmt"
+    "math"
+    "math/rand"
+    "os"
+    "path"
+    "sort"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/cvega/gh-migrate-packages/pkg/api"
+    "github.com/cvega/gh-migrate-packages/pkg/csvfile"
+    "github.com/cvega/gh-migrate-packages/pkg/provenance"
+    "github.com/cvega/gh-migrate-packages/pkg/run"
+    "github.com/pterm/pterm"
+    "github.com/spf13/viper"
+)
+
+// Outcomes of checking a migrated version
+const (
+    StatusVerified = "verified" // every recorded digest is in the target
+    StatusMismatch = "mismatch" // the target holds different content
+    StatusMissing  = "missing"  // the target doesn't list the version
+    StatusError    = "error"    // the target couldn't be checked
+)
+
+// How a version's digests were checked
+const (
+    MethodManifest = "manifest" // container manifest digest, from a HEAD request
+    MethodListing  = "listing"  // file digests the registry lists
+    MethodDownload = "download" // files downloaded and hashed
+)
+
+// Confidence the failure rate bounds are reported at
+const confidence = 0.95
+
+const defaultWorkers = 8
+
+// Result is the outcome of checking one migrated version against the
+// digests its provenance statement recorded
+type Result struct {
+    PackageType string
+    Package     string
+    Version     string
+    Selection   string // full for critical packages, sample, or all
+    Status      string
+    Method      string
+    Detail      string
+}
+
+// Sample is how many versions --verify-sample asks for, as a percentage
+// or a count
+type Sample struct {
+    Percent float64
+    Count   int
+}
+
+// ParseSample reads a sample such as 5% or 200
+func ParseSample(value string) (Sample, error) {
+    if strings.HasSuffix(value, "%") {
+        percent, err := strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64)
+        if err != nil || percent <= 0 || percent > 100 {
+            return Sample{}, fmt.Errorf("expected a percentage above 0%% and at most 100%%, got %q", value)
+        }
+        return Sample{Percent: percent}, nil
+    }
+    count, err := strconv.Atoi(value)
+    if err != nil || count <= 0 {
+        return Sample{}, fmt.Errorf("expected a percentage such as 5%% or a number of versions, got %q", value)
+    }
+    return Sample{Count: count}, nil
+}
+
+// Size returns how many of total versions the sample covers, at least one
+func (s Sample) Size(total int) int {
+    n := s.Count
+    if s.Percent > 0 {
+        n = int(math.Ceil(float64(total) * s.Percent / 100))
+    }
+    if n < 1 {
+        n = 1
+    }
+    if n > total {
+        n = total
+    }
+    return n
+}
+
+// UpperBound returns the highest failure rate consistent, at the reported
+// confidence, with failures among n randomly sampled versions: the exact
+// binomial bound when none failed and the Wilson score bound otherwise
+func UpperBound(failures, n int) float64 {
+    if n == 0 {
+        return 1
+    }
+    if failures == 0 {
+        return 1 - math.Pow(1-confidence, 1/float64(n))
+    }
+    z := 1.959964 // two-sided 95%
+    p := float64(failures) / float64(n)
+    nf := float64(n)
+    center := p + z*z/(2*nf)
+    margin := z * math.Sqrt(p*(1-p)/nf+z*z/(4*nf*nf))
+    return math.Min(1, (center+margin)/(1+z*z/nf))
+}
+
+// CriticalPackages are the packages every version of which is verified
+type CriticalPackages []criticalPattern
+
+type criticalPattern struct {
+    packageType string // empty for any type
+    glob        string
+}
+
+// LoadCriticalPackages reads one package name or glob per line, optionally
+// prefixed with its type as TYPE:NAME. Blank lines and # comments are ignored
+func LoadCriticalPackages(filename string) (CriticalPackages, error) {
+    file, err := os.Open(filename)
+    if err != nil {
+        return nil, fmt.Errorf("failed to open critical packages file: %v", err)
+    }
+    defer file.Close()
+
+    var critical CriticalPackages
+    scanner := bufio.NewScanner(file)
+    for scanner.Scan() {
+        line := strings.TrimSpace(scanner.Text())
+        if line == "" || strings.HasPrefix(line, "#") {
+            continue
+        }
+
+        pattern := criticalPattern{glob: line}
+        if i := strings.Index(line, ":"); i > 0 {
+            pattern = criticalPattern{packageType: strings.ToLower(line[:i]), glob: line[i+1:]}
+        }
+        if _, err := path.Match(pattern.glob, ""); err != nil {
+            return nil, fmt.Errorf("invalid pattern %q in %s: %v", line, filename, err)
+        }
+        critical = append(critical, pattern)
+    }
+    if err := scanner.Err(); err != nil {
+        return nil, fmt.Errorf("failed to read critical packages file: %v", err)
+    }
+    return critical, nil
+}
+
+// Matches reports whether the named package of packageType is critical
+func (c CriticalPackages) Matches(packageType, name string) bool {
+    for _, p := range c {
+        if p.packageType != "" && p.packageType != strings.ToLower(packageType) {
+            continue
+        }
+        if matched, _ := path.Match(p.glob, name); matched {
+            return true
+        }
+    }
+    return false
+}
+
+// Verifier checks migrated versions in the target against their recorded
+// digests, listing each target organization once. Check is safe to call
+// from several goroutines
+type Verifier struct {
+    target   *api.API
+    download bool // hash downloaded files even when the listing has digests
+
+    mu       sync.Mutex
+    listings map[string]*listing // by org/type
+}
+
+// listing is one target organization's packages of a type, fetched by the
+// first check that needs it while the others wait
+type listing struct {
+    once     sync.Once
+    packages map[string]api.Package
+    err      error
+}
+
+// NewVerifier checks against the digests the target lists where it can,
+// or always downloads and hashes the files when download is set
+func NewVerifier(target *api.API, download bool) *Verifier {
+    return &Verifier{target: target, download: download, listings: make(map[string]*listing)}
+}
+
+// Check compares the digests a statement recorded with the target version:
+// by manifest digest for a container, by the file digests the registry
+// lists when it lists them, and otherwise by downloading the files
+func (v *Verifier) Check(statement provenance.Statement) Result {
+    packageType, org, name, version := statement.Target()
+    result := Result{PackageType: packageType, Package: name, Version: version}
+
+    expected := make(map[string]string) // sha256 -> subject name
+    for _, subject := range statement.Subject {
+        if digest := subject.Digest["sha256"]; digest != "" {
+            expected[strings.ToLower(digest)] = subject.Name
+        }
+    }
+    if len(expected) == 0 {
+        result.Status, result.Detail = StatusError, "statement records no sha256 digests"
+        return result
+    }
+
+    // Registries address images by manifest digest, so it covers every layer
+    if packageType == "container" {
+        result.Method = MethodManifest
+        digest, err := v.target.GetImageDigest(org, name, version)
+        if err != nil {
+            result.Status, result.Detail = StatusMissing, err.Error()
+            return result
+        }
+        if _, ok := expected[strings.ToLower(strings.TrimPrefix(digest, "sha256:"))]; !ok {
+            result.Status, result.Detail = StatusMismatch, "target manifest is "+digest
+            return result
+        }
+        result.Status = StatusVerified
+        return result
+    }
+
+    pkg, ver, err := v.find(org, packageType, name, version)
+    if err != nil {
+        result.Status, result.Detail = StatusError, err.Error()
+        return result
+    }
+    if ver == nil {
+        result.Status, result.Detail = StatusMissing, "version not listed in "+org
+        return result
+    }
+
+    // The registry's own digests spare downloading every file. A listing
+    // may be cut short, so only a download can confirm a mismatch
+    if listed := listedDigests(*ver); listed != nil && !v.download {
+        if listedResult := compareDigests(result, expected, listed); listedResult.Status == StatusVerified {
+            listedResult.Method = MethodListing
+            return listedResult
+        }
+    }
+
+    result.Method = MethodDownload
+    dir, err := run.TempDir("verify")
+    if err != nil {
+        result.Status, result.Detail = StatusError, err.Error()
+        return result
+    }
+    defer run.RemoveTempDir(dir)
+
+    files, err := v.target.DownloadPackageVersion(org, pkg, *ver, dir)
+    if err != nil {
+        result.Status, result.Detail = StatusError, err.Error()
+        return result
+    }
+
+    found := make(map[string]bool)
+    for _, file := range files {
+        digest, err := api.FileSHA256(file)
+        if err != nil {
+            result.Status, result.Detail = StatusError, err.Error()
+            return result
+        }
+        found[digest] = true
+    }
+    return compareDigests(result, expected, found)
+}
+
+// listedDigests returns the SHA-256 of every file of a listed version, or
+// nil when the registry left any of them out
+func listedDigests(version api.Version) map[string]bool {
+    if len(version.Files) == 0 {
+        return nil
+    }
+    found := make(map[string]bool, len(version.Files))
+    for _, file := range version.Files {
+        if file.SHA256 == "" {
+            return nil
+        }
+        found[strings.ToLower(file.SHA256)] = true
+    }
+    return found
+}
+
+// compareDigests requires every expected digest among the target's
+func compareDigests(result Result, expected map[string]string, found map[string]bool) Result {
+    // Target file names may differ, the content may not
+    var missing []string
+    for digest, subject := range expected {
+        if !found[digest] {
+            missing = append(missing, subject)
+        }
+    }
+    if len(missing) > 0 {
+        sort.Strings(missing)
+        result.Status, result.Detail = StatusMismatch, "no target file matches "+strings.Join(missing, ", ")
+        return result
+    }
+    result.Status = StatusVerified
+    return result
+}
+
+// find looks a version up in the target listing of org's packageType packages
+func (v *Verifier) find(org, packageType, name, version string) (api.Package, *api.Version, error) {
+    key := org + "/" + packageType
+    v.mu.Lock()
+    l, ok := v.listings[key]
+    if !ok {
+        l = &listing{}
+        v.listings[key] = l
+    }
+    v.mu.Unlock()
+
+    l.once.Do(func() {
+        packages, err := v.target.GetOrganizationPackages(org, packageType)
+        if err != nil {
+            l.err = fmt.Errorf("failed to list %s packages in %s: %v", packageType, org, err)
+            return
+        }
+        l.packages = make(map[string]api.Package, len(packages))
+        for _, p := range packages {
+            l.packages[p.Name] = p
+        }
+    })
+    if l.err != nil {
+        return api.Package{}, nil, l.err
+    }
+
+    pkg, ok := l.packages[name]
+    if !ok {
+        return pkg, nil, nil
+    }
+    for i := range pkg.Versions {
+        if pkg.Versions[i].Name == version {
+            return pkg, &pkg.Versions[i], nil
+        }
+    }
+    return pkg, nil, nil
+}
+
+// selectStatements splits the latest statement of every migrated version into those
+// of critical packages, all checked, and a seeded random sample of the rest
+func selectStatements(statements []provenance.Statement, critical CriticalPackages, sample *Sample, seed int64) (full, sampled []provenance.Statement, population int) {
+    // A version migrated again by a later run is checked against its latest record
+    latest := make(map[string]provenance.Statement)
+    var keys []string
+    for _, s := range statements {
+        packageType, org, name, version := s.Target()
+        key := strings.Join([]string{packageType, org, name, version}, "\x00")
+        if _, seen := latest[key]; !seen {
+            keys = append(keys, key)
+        }
+        latest[key] = s
+    }
+    sort.Strings(keys)
+
+    var rest []provenance.Statement
+    for _, key := range keys {
+        s := latest[key]
+        packageType, _, name, _ := s.Target()
+        if critical.Matches(packageType, name) {
+            full = append(full, s)
+        } else {
+            rest = append(rest, s)
+        }
+    }
+
+    if sample == nil || len(rest) == 0 {
+        return full, rest, len(rest)
+    }
+    rng := rand.New(rand.NewSource(seed))
+    rng.Shuffle(len(rest), func(i, j int) { rest[i], rest[j] = rest[j], rest[i] })
+    return full, rest[:sample.Size(len(rest))], len(rest)
+}
+
+// VerifyFromConfig checks the target against the provenance log sync
+// wrote, fully for critical packages and for a random sample of the rest
+// when --verify-sample is set. It fails when any checked version doesn't match
+func VerifyFromConfig() error {
+    var key *provenance.PublicKey
+    if path := viper.GetString("PROVENANCE_PUBLIC_KEY"); path != "" {
+        var err error
+        if key, err = provenance.LoadPublicKey(path); err != nil {
+            return err
+        }
+    }
+    statements, err := provenance.ReadSignedLog(viper.GetString("PROVENANCE"), key)
+    if err != nil {
+        return err
+    }
+    if key != nil {
+        pterm.Info.Printf("All %d statements are signed by the provenance key\n", len(statements))
+    }
+
+    var critical CriticalPackages
+    if file := viper.GetString("VERIFY_FULL"); file != "" {
+        if critical, err = LoadCriticalPackages(file); err != nil {
+            return err
+        }
+    }
+
+    var sample *Sample
+    if value := viper.GetString("VERIFY_SAMPLE"); value != "" {
+        parsed, err := ParseSample(value)
+        if err != nil {
+            return err
+        }
+        sample = &parsed
+    }
+
+    // The seed is printed so an auditor can repeat the same sample
+    seed := viper.GetInt64("VERIFY_SEED")
+    if seed == 0 {
+        seed = time.Now().UnixNano()
+    }
+
+    full, sampled, population := selectStatements(statements, critical, sample, seed)
+    if sample != nil {
+        pterm.Info.Printf("Verifying %d critical versions and a sample of %d of %d others (seed %d)\n", len(full), len(sampled), population, seed)
+    } else {
+        pterm.Info.Printf("Verifying all %d migrated versions\n", len(full)+len(sampled))
+    }
+
+    target := api.NewAPI(viper.GetString("TARGET_TOKEN"), "")
+    target.SetReadOnly()
+    registries, err := api.ParseRegistries(viper.GetString("TARGET_REGISTRY_URLS"))
+    if err != nil {
+        return fmt.Errorf("invalid target registry url: %v", err)
+    }
+    target.SetRegistries(registries)
+    targetTokens, err := api.ParseRegistryTokens(viper.GetString("TARGET_REGISTRY_TOKENS"))
+    if err != nil {
+        return fmt.Errorf("invalid target registry token: %v", err)
+    }
+    target.SetRegistryTokens(targetTokens)
+    verifier := NewVerifier(target, viper.GetBool("VERIFY_DOWNLOAD"))
+
+    selection := "all"
+    if sample != nil {
+        selection = "sample"
+    }
+
+    // Results keep the statements' order, whichever worker finishes first
+    checked := append(full, sampled...)
+    results := make([]Result, len(checked))
+    workers := viper.GetInt("VERIFY_WORKERS")
+    if workers < 1 {
+        workers = defaultWorkers
+    }
+    progressbar, _ := pterm.DefaultProgressbar.WithTotal(len(checked)).WithTitle("Verifying target digests").Start()
+    var mu sync.Mutex
+    var wg sync.WaitGroup
+    next := make(chan int)
+    for w := 0; w < workers; w++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            for i := range next {
+                result := verifier.Check(checked[i])
+                result.Selection = selection
+                if i < len(full) {
+                    result.Selection = "full"
+                }
+                results[i] = result
+                mu.Lock()
+                progressbar.Increment()
+                mu.Unlock()
+            }
+        }()
+    }
+    for i := range checked {
+        next <- i
+    }
+    close(next)
+    wg.Wait()
+    progressbar.Stop()
+
+    failed := reportResults(results)
+
+    if report := run.ReportPath(viper.GetString("VERIFY_REPORT")); report != "" {
+        if err := writeResults(report, results); err != nil {
+            return fmt.Errorf("failed to write verification report: %v", err)
+        }
+        pterm.Info.Printf("Verification results written to %s\n", report)
+    }
+
+    if sample != nil && len(sampled) > 0 {
+        sampleFailures := 0
+        for _, r := range results {
+            if r.Selection == "sample" && r.Status != StatusVerified {
+                sampleFailures++
+            }
+        }
+        if len(sampled) == population {
+            pterm.Info.Printf("The sample covered every version: %d of %d failed\n", sampleFailures, population)
+        } else {
+            pterm.Info.Printf("%d of %d sampled versions failed; with %.0f%% confidence at most %.2f%% of the %d unchecked versions are bad\n",
+                sampleFailures, len(sampled), confidence*100, UpperBound(sampleFailures, len(sampled))*100, population-len(sampled))
+        }
+    }
+
+    if failed > 0 {
+        return fmt.Errorf("%d of %d checked versions failed verification", failed, len(results))
+    }
+    pterm.Success.Printf("All %d checked versions match their recorded digests\n", len(results))
+    return nil
+}
+
+// reportResults prints the versions that failed and returns their count
+func reportResults(results []Result) int {
+    table := pterm.TableData{
+        {"Type", "Package", "Version", "Status", "Detail"},
+    }
+    for _, r := range results {
+        if r.Status != StatusVerified {
+            table = append(table, []string{r.PackageType, r.Package, r.Version, r.Status, r.Detail})
+        }
+    }
+    if len(table) == 1 {
+        return 0
+    }
+    pterm.DefaultTable.WithHasHeader().WithData(table).Render()
+    return len(table) - 1
+}
+
+func writeResults(filename string, results []Result) error {
+    file, err := os.Create(filename)
+    if err != nil {
+        return err
+    }
+    defer file.Close()
+
+    writer := csvfile.NewWriter(file)
+    defer writer.Flush()
+
+    if err := writer.Write([]string{"Type", "Package", "Version", "Selection", "Status", "Detail", "Method"}); err != nil {
+        return err
+    }
+    for _, r := range results {
+        if err := writer.Write([]string{r.PackageType, r.Package, r.Version, r.Selection, r.Status, r.Detail, r.Method}); err != nil {
+            return err
+        }
+    }
+    return nil
+}
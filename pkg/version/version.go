@@ -0,0 +1,190 @@
+package version
+
+import (
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "os"
+    "runtime"
+    "runtime/debug"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// Version is set at release time with
+// -ldflags "-X github.com/cvega/gh-migrate-packages/pkg/version.Version=v1.2.3"
+var Version = ""
+
+// releasesURL lists the extension's published releases, newest first
+const releasesURL = "https://api.github.com/repos/cvega/gh-migrate-packages/releases?per_page=30"
+
+// registryTag marks release note lines that fix how a registry protocol is
+// spoken, e.g. "- [registry] Handle the GHES 3.12 npm upload response"
+const registryTag = "[registry]"
+
+// Info describes the running build
+type Info struct {
+    Version   string
+    Commit    string
+    BuildTime string
+    GoVersion string
+    Platform  string
+}
+
+// Get returns the build info, falling back to what the Go toolchain
+// embedded when the binary was built without release ldflags
+func Get() Info {
+    info := Info{
+        Version:   Version,
+        GoVersion: runtime.Version(),
+        Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+    }
+
+    if build, ok := debug.ReadBuildInfo(); ok {
+        if info.Version == "" && build.Main.Version != "(devel)" {
+            info.Version = build.Main.Version
+        }
+        for _, s := range build.Settings {
+            switch s.Key {
+            case "vcs.revision":
+                info.Commit = s.Value
+            case "vcs.time":
+                info.BuildTime = s.Value
+            }
+        }
+    }
+    if info.Version == "" {
+        info.Version = "dev"
+    }
+    return info
+}
+
+// Release is a published release newer than the running build
+type Release struct {
+    Tag   string
+    URL   string
+    // RegistryFixes are the release note lines tagged [registry]
+    RegistryFixes []string
+}
+
+type githubRelease struct {
+    TagName    string `json:"tag_name"`
+    HTMLURL    string `json:"html_url"`
+    Body       string `json:"body"`
+    Draft      bool   `json:"draft"`
+    Prerelease bool   `json:"prerelease"`
+}
+
+// Newer returns the published releases newer than current, newest first.
+// token is optional and only raises the anonymous rate limit
+func Newer(current, token string) ([]Release, error) {
+    if _, ok := parse(current); !ok {
+        return nil, fmt.Errorf("can't compare development build %q against releases", current)
+    }
+
+    req, err := http.NewRequest("GET", releasesURL, nil)
+    if err != nil {
+        return nil, err
+    }
+    req.Header.Set("Accept", "application/vnd.github+json")
+    if token != "" {
+        req.Header.Set("Authorization", "Bearer "+token)
+    }
+
+    client := &http.Client{Timeout: 10 * time.Second}
+    resp, err := client.Do(req)
+    if err != nil {
+        return nil, fmt.Errorf("failed to fetch releases: %v", err)
+    }
+    defer resp.Body.Close()
+    if resp.StatusCode != http.StatusOK {
+        return nil, fmt.Errorf("failed to fetch releases: %s", resp.Status)
+    }
+
+    var releases []githubRelease
+    if err := json.NewDecoder(resp.Body).Decode(&releases); err != nil {
+        return nil, fmt.Errorf("failed to decode releases: %v", err)
+    }
+
+    var newer []Release
+    for _, r := range releases {
+        if r.Draft || r.Prerelease || compare(r.TagName, current) <= 0 {
+            continue
+        }
+        newer = append(newer, Release{
+            Tag:           r.TagName,
+            URL:           r.HTMLURL,
+            RegistryFixes: registryFixes(r.Body),
+        })
+    }
+    return newer, nil
+}
+
+// TokenFromEnv picks a token for the release check without requiring one
+func TokenFromEnv() string {
+    for _, name := range []string{"GHMP_SOURCE_TOKEN", "GH_TOKEN", "GITHUB_TOKEN"} {
+        if token := os.Getenv(name); token != "" {
+            return token
+        }
+    }
+    return ""
+}
+
+func registryFixes(body string) []string {
+    var fixes []string
+    for _, line := range strings.Split(body, "\n") {
+        line = strings.TrimSpace(line)
+        if i := strings.Index(strings.ToLower(line), registryTag); i >= 0 {
+            fix := strings.TrimSpace(line[i+len(registryTag):])
+            if fix != "" {
+                fixes = append(fixes, fix)
+            }
+        }
+    }
+    return fixes
+}
+
+// parse reads vMAJOR.MINOR.PATCH, ignoring any -suffix
+func parse(tag string) ([3]int, bool) {
+    var v [3]int
+    tag = strings.TrimPrefix(tag, "v")
+    if i := strings.IndexAny(tag, "-+"); i >= 0 {
+        tag = tag[:i]
+    }
+    parts := strings.Split(tag, ".")
+    if len(parts) != 3 {
+        return v, false
+    }
+    for i, p := range parts {
+        n, err := strconv.Atoi(p)
+        if err != nil {
+            return v, false
+        }
+        v[i] = n
+    }
+    return v, true
+}
+
+// compare orders release tags; tags that don't parse sort first
+func compare(a, b string) int {
+    va, okA := parse(a)
+    vb, okB := parse(b)
+    switch {
+    case !okA && !okB:
+        return 0
+    case !okA:
+        return -1
+    case !okB:
+        return 1
+    }
+    for i := range va {
+        if va[i] != vb[i] {
+            if va[i] < vb[i] {
+                return -1
+            }
+            return 1
+        }
+    }
+    return 0
+}